@@ -1,6 +1,7 @@
 package alertmanager
 
 import (
+	"container/heap"
 	"context"
 	"crypto/md5"
 	"encoding/binary"
@@ -12,6 +13,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	tmpltext "text/template"
 	"time"
 
 	"github.com/go-kit/log"
@@ -56,6 +58,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	util_net "github.com/cortexproject/cortex/pkg/util/net"
 	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 const (
@@ -88,6 +91,8 @@ type Config struct {
 	PersisterConfig   PersisterConfig
 	APIConcurrency    int
 	GCInterval        time.Duration
+
+	NotificationRetryBackoff validation.NotificationRetryBackoffMap
 }
 
 // An Alertmanager manages the alerts for one user.
@@ -122,6 +127,10 @@ type Alertmanager struct {
 	configHashMetric prometheus.Gauge
 
 	rateLimitedNotifications *prometheus.CounterVec
+	templateTimeouts         *prometheus.CounterVec
+
+	// Limits the in-flight notifications across all the tenant integrations. Nil if limits are not configured.
+	notificationsLimiter *notificationsLimiter
 }
 
 var (
@@ -176,6 +185,10 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 			Help: "Number of rate-limited notifications per integration.",
 		}, []string{"integration"}), // "integration" is consistent with other alertmanager metrics.
 
+		templateTimeouts: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "alertmanager_notification_template_timeouts_total",
+			Help: "Number of notifications failed because of the template execution timeout, per integration.",
+		}, []string{"integration"}),
 	}
 
 	am.registry = reg
@@ -263,6 +276,7 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 	var callback mem.AlertStoreCallback
 	if am.cfg.Limits != nil {
 		callback = newAlertsLimiter(am.cfg.UserID, am.cfg.Limits, reg)
+		am.notificationsLimiter = newNotificationsLimiter(&tenantConcurrencyLimits{tenant: am.cfg.UserID, limits: am.cfg.Limits}, reg)
 	}
 	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, am.cfg.GCInterval, callback, am.logger, am.registry)
 	if err != nil {
@@ -337,7 +351,8 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 		templateFiles[i] = templateFilepath
 	}
 
-	tmpl, err := template.FromGlobs(templateFiles)
+	var textTmpl *tmpltext.Template
+	tmpl, err := template.FromGlobs(templateFiles, captureTextTemplate(&textTmpl))
 	if err != nil {
 		return err
 	}
@@ -369,7 +384,7 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 	// Create a firewall binded to the per-tenant config.
 	firewallDialer := util_net.NewFirewallDialer(newFirewallDialerConfigProvider(userID, am.cfg.Limits))
 
-	integrationsMap, err := buildIntegrationsMap(conf.Receivers, tmpl, firewallDialer, am.logger, func(integrationName string, notifier notify.Notifier) notify.Notifier {
+	integrationsMap, err := buildIntegrationsMap(conf.Receivers, tmpl, firewallDialer, am.logger, func(integrationName string, integrationConfig interface{}, notifier notify.Notifier) notify.Notifier {
 		if am.cfg.Limits != nil {
 			rl := &tenantRateLimits{
 				tenant:      userID,
@@ -377,7 +392,20 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 				integration: integrationName,
 			}
 
-			return newRateLimitedNotifier(notifier, rl, 10*time.Second, am.rateLimitedNotifications.WithLabelValues(integrationName))
+			tl := &tenantTemplateLimits{
+				tenant: userID,
+				limits: am.cfg.Limits,
+			}
+
+			// The timeout doesn't include the time spent waiting for an in-flight notifications slot.
+			notifier = newTimeoutLimitedNotifier(notifier, tmpl, textTmpl, integrationConfig, tl, log.With(am.logger, "integration", integrationName), am.templateTimeouts.WithLabelValues(integrationName))
+			// Rate-limited notifications are rejected before waiting for an in-flight notifications slot.
+			notifier = newConcurrencyLimitedNotifier(notifier, am.notificationsLimiter)
+			notifier = newRateLimitedNotifier(notifier, rl, 10*time.Second, am.rateLimitedNotifications.WithLabelValues(integrationName))
+		}
+		// Every retry goes through the limits, and doesn't hold an in-flight notifications slot while backing off.
+		if backoff, ok := am.cfg.NotificationRetryBackoff[integrationName]; ok {
+			notifier = newRetryBackoffNotifier(notifier, backoff, log.With(am.logger, "integration", integrationName))
 		}
 		return notifier
 	})
@@ -385,6 +413,13 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 		return nil
 	}
 
+	// The templated receivers have already been validated while loading the config.
+	_, templatedReceivers, err := extractTemplatedReceivers(rawCfg)
+	if err != nil {
+		return err
+	}
+	templatedReceiversResolvers := buildTemplatedReceiversIntegrations(integrationsMap, templatedReceivers, tmpl, am.logger)
+
 	timeIntervals := make(map[string][]timeinterval.TimeInterval, len(conf.MuteTimeIntervals)+len(conf.TimeIntervals))
 	for _, ti := range conf.MuteTimeIntervals {
 		timeIntervals[ti.Name] = ti.TimeIntervals
@@ -394,7 +429,7 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 		timeIntervals[ti.Name] = ti.TimeIntervals
 	}
 
-	pipeline := am.pipelineBuilder.New(
+	pipeline := newTemplatedReceiversStage(am.pipelineBuilder.New(
 		integrationsMap,
 		waitFunc,
 		am.inhibitor,
@@ -402,7 +437,7 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 		timeinterval.NewIntervener(timeIntervals),
 		am.nflog,
 		am.state,
-	)
+	), templatedReceiversResolvers)
 	am.lastPipeline = pipeline
 	am.dispatcher = dispatch.NewDispatcher(
 		am.alerts,
@@ -478,7 +513,7 @@ func (am *Alertmanager) getFullState() (*clusterpb.FullState, error) {
 
 // buildIntegrationsMap builds a map of name to the list of integration notifiers off of a
 // list of receiver config.
-func buildIntegrationsMap(nc []config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, notifierWrapper func(string, notify.Notifier) notify.Notifier) (map[string][]notify.Integration, error) {
+func buildIntegrationsMap(nc []config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, notifierWrapper func(string, interface{}, notify.Notifier) notify.Notifier) (map[string][]notify.Integration, error) {
 	integrationsMap := make(map[string][]notify.Integration, len(nc))
 	for _, rcv := range nc {
 		integrations, err := buildReceiverIntegrations(rcv, tmpl, firewallDialer, logger, notifierWrapper)
@@ -493,7 +528,7 @@ func buildIntegrationsMap(nc []config.Receiver, tmpl *template.Template, firewal
 // buildReceiverIntegrations builds a list of integration notifiers off of a
 // receiver config.
 // Taken from https://github.com/prometheus/alertmanager/blob/d7b4f0c7322e7151d6e3b1e31cbc15361e295d8d/cmd/alertmanager/main.go#L135-L193.
-func buildReceiverIntegrations(nc config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, wrapper func(string, notify.Notifier) notify.Notifier) ([]notify.Integration, error) {
+func buildReceiverIntegrations(nc config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, wrapper func(string, interface{}, notify.Notifier) notify.Notifier) ([]notify.Integration, error) {
 	var (
 		errs         types.MultiError
 		integrations []notify.Integration
@@ -503,7 +538,7 @@ func buildReceiverIntegrations(nc config.Receiver, tmpl *template.Template, fire
 				errs.Add(err)
 				return
 			}
-			n = wrapper(name, n)
+			n = wrapper(name, rs, n)
 			integrations = append(integrations, notify.NewIntegration(n, rs, name, i, nc.Name))
 		}
 	)
@@ -619,6 +654,28 @@ func (t *tenantRateLimits) Burst() int {
 	return t.limits.NotificationBurstSize(t.tenant, t.integration)
 }
 
+type tenantConcurrencyLimits struct {
+	tenant string
+	limits Limits
+}
+
+func (t *tenantConcurrencyLimits) MaxConcurrentNotifications() int {
+	return t.limits.AlertmanagerMaxConcurrentNotifications(t.tenant)
+}
+
+type tenantTemplateLimits struct {
+	tenant string
+	limits Limits
+}
+
+func (t *tenantTemplateLimits) TemplateExecutionTimeout() time.Duration {
+	return t.limits.AlertmanagerTemplateExecutionTimeout(t.tenant)
+}
+
+func (t *tenantTemplateLimits) TemplateMaxOutputSizeBytes() int {
+	return t.limits.AlertmanagerTemplateMaxOutputSizeBytes(t.tenant)
+}
+
 type dispatcherLimits struct {
 	tenant string
 	limits Limits
@@ -629,23 +686,43 @@ func (g *dispatcherLimits) MaxNumberOfAggregationGroups() int {
 }
 
 var (
-	errTooManyAlerts = "too many alerts, limit: %d, alert name: %s"
-	errAlertsTooBig  = "alerts too big, total size limit: %d bytes"
+	errTooManyAlerts    = "too many alerts, limit: %d, alert name: %s"
+	errAlertsTooBig     = "alerts too big, total size limit: %d bytes"
+	errTooManyLabelSets = "too many distinct label sets for alert name within %s, limit: %d, alert name: %s"
+
+	errTooManyActiveAlerts = "too many active alerts, limit: %d, alert name: %s"
 )
 
 // alertsLimiter limits the number and size of alerts being received by the Alertmanager.
 // We consider an alert unique based on its fingerprint (a hash of its labels) and
 // its size it's determined by the sum of bytes of its labels, annotations, and generator URL.
+// It also limits the number of distinct label sets received for each alert name within a sliding
+// window, to protect the routing from alerts with an unbounded label cardinality, and the number of
+// active alerts, not counting the resolved ones still stored.
 type alertsLimiter struct {
 	tenant string
 	limits Limits
 
-	failureCounter prometheus.Counter
+	failureCounter      prometheus.Counter
+	labelSetsLimited    prometheus.Counter
+	activeAlertsLimited prometheus.Counter
 
 	mx        sync.Mutex
 	sizes     map[model.Fingerprint]int
 	count     int
 	totalSize int
+
+	// active tracks the active alerts, so that their number is len(active). An alert whose end
+	// time passed is resolved, even if it's not updated, so activeByEndsAt orders the active
+	// alerts with an end time by it, to remove the resolved ones without scanning all of them.
+	active         map[model.Fingerprint]*activeAlert
+	activeByEndsAt activeAlertsHeap
+
+	// labelSets tracks, for each alert name, when each label set was last received.
+	labelSets          map[model.LabelValue]map[model.Fingerprint]time.Time
+	labelSetsLastPrune time.Time
+
+	now func() time.Time
 }
 
 func newAlertsLimiter(tenant string, limits Limits, reg prometheus.Registerer) *alertsLimiter {
@@ -657,6 +734,17 @@ func newAlertsLimiter(tenant string, limits Limits, reg prometheus.Registerer) *
 			Name: "alertmanager_alerts_insert_limited_total",
 			Help: "Number of failures to insert new alerts to in-memory alert store.",
 		}),
+		labelSetsLimited: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "alertmanager_alerts_label_sets_limited_total",
+			Help: "Number of alerts rejected because their alert name reached the limit of distinct label sets.",
+		}),
+		activeAlertsLimited: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "alertmanager_alerts_active_limited_total",
+			Help: "Number of alerts rejected because the limit of active alerts was reached.",
+		}),
+		active:    map[model.Fingerprint]*activeAlert{},
+		labelSets: map[model.LabelValue]map[model.Fingerprint]time.Time{},
+		now:       time.Now,
 	}
 
 	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
@@ -688,6 +776,11 @@ func (a *alertsLimiter) PreStore(alert *types.Alert, existing bool) error {
 	countLimit := a.limits.AlertmanagerMaxAlertsCount(a.tenant)
 	sizeLimit := a.limits.AlertmanagerMaxAlertsSizeBytes(a.tenant)
 
+	labelSetsLimit := a.limits.AlertmanagerMaxLabelSetsPerAlertName(a.tenant)
+	labelSetsWindow := a.limits.AlertmanagerLabelSetsWindow(a.tenant)
+
+	activeLimit := a.limits.AlertmanagerMaxActiveAlerts(a.tenant)
+
 	sizeDiff := alertSize(alert.Alert)
 
 	a.mx.Lock()
@@ -698,6 +791,20 @@ func (a *alertsLimiter) PreStore(alert *types.Alert, existing bool) error {
 		return fmt.Errorf(errTooManyAlerts, countLimit, alert.Name())
 	}
 
+	// Updates of the alerts already stored are always allowed, so that a firing alert
+	// can't be rejected once the limit is reached.
+	if !existing && labelSetsLimit > 0 && !a.hasLabelSetCapacity(alert, labelSetsLimit, labelSetsWindow) {
+		a.labelSetsLimited.Inc()
+		return fmt.Errorf(errTooManyLabelSets, labelSetsWindow, labelSetsLimit, alert.Name())
+	}
+
+	// Only the alerts becoming active are limited: the updates of the active alerts and the
+	// resolved alerts are always allowed, so that resolving an alert frees its capacity.
+	if activeLimit > 0 && a.becomesActive(alert) && !a.hasActiveCapacity(activeLimit) {
+		a.activeAlertsLimited.Inc()
+		return fmt.Errorf(errTooManyActiveAlerts, activeLimit, alert.Name())
+	}
+
 	if existing {
 		sizeDiff -= a.sizes[fp]
 	}
@@ -728,6 +835,159 @@ func (a *alertsLimiter) PostStore(alert *types.Alert, existing bool) {
 	}
 	a.sizes[fp] = newSize
 	a.totalSize += newSize
+
+	a.removeActive(fp)
+	if isActiveAt(alert.EndsAt, a.now()) {
+		a.addActive(fp, alert.EndsAt)
+	}
+
+	if window := a.limits.AlertmanagerLabelSetsWindow(a.tenant); a.limits.AlertmanagerMaxLabelSetsPerAlertName(a.tenant) > 0 && window > 0 {
+		a.trackLabelSet(alert, window)
+	}
+}
+
+// hasLabelSetCapacity returns whether the label set of the alert has already been received within
+// the window, or if a new label set can still be received for its alert name. Must be called with
+// the lock held.
+func (a *alertsLimiter) hasLabelSetCapacity(alert *types.Alert, limit int, window time.Duration) bool {
+	if window <= 0 {
+		return true
+	}
+
+	seen := a.labelSets[model.LabelValue(alert.Name())]
+	if _, ok := seen[alert.Fingerprint()]; ok || len(seen) < limit {
+		return true
+	}
+
+	// The alert name reached the limit, so the label sets expired from the window are removed
+	// before checking the limit again.
+	deadline := a.now().Add(-window)
+	for fp, lastSeen := range seen {
+		if lastSeen.Before(deadline) {
+			delete(seen, fp)
+		}
+	}
+	return len(seen) < limit
+}
+
+// becomesActive returns whether the alert is active, while the stored alert with the same
+// fingerprint, if any, is not. Must be called with the lock held.
+func (a *alertsLimiter) becomesActive(alert *types.Alert) bool {
+	now := a.now()
+	if !isActiveAt(alert.EndsAt, now) {
+		return false
+	}
+	stored, ok := a.active[alert.Fingerprint()]
+	return !ok || !isActiveAt(stored.endsAt, now)
+}
+
+// hasActiveCapacity returns whether a new alert can become active. The alerts resolved since they
+// were stored are removed only once the limit is reached. Must be called with the lock held.
+func (a *alertsLimiter) hasActiveCapacity(limit int) bool {
+	if len(a.active) < limit {
+		return true
+	}
+
+	now := a.now()
+	for len(a.activeByEndsAt) > 0 && !isActiveAt(a.activeByEndsAt[0].endsAt, now) {
+		resolved := heap.Pop(&a.activeByEndsAt).(*activeAlert)
+		delete(a.active, resolved.fp)
+	}
+	return len(a.active) < limit
+}
+
+// addActive tracks the alert as active. Must be called with the lock held.
+func (a *alertsLimiter) addActive(fp model.Fingerprint, endsAt time.Time) {
+	alert := &activeAlert{fp: fp, endsAt: endsAt, index: -1}
+	a.active[fp] = alert
+	if !endsAt.IsZero() {
+		heap.Push(&a.activeByEndsAt, alert)
+	}
+}
+
+// removeActive stops tracking the alert as active, if it was. Must be called with the lock held.
+func (a *alertsLimiter) removeActive(fp model.Fingerprint) {
+	alert, ok := a.active[fp]
+	if !ok {
+		return
+	}
+	if alert.index >= 0 {
+		heap.Remove(&a.activeByEndsAt, alert.index)
+	}
+	delete(a.active, fp)
+}
+
+// activeAlert is an active alert tracked by the alertsLimiter.
+type activeAlert struct {
+	fp     model.Fingerprint
+	endsAt time.Time
+
+	// index is the position in the activeAlertsHeap, or -1 if the alert has no end time.
+	index int
+}
+
+// activeAlertsHeap is a min-heap of the active alerts ordered by end time.
+type activeAlertsHeap []*activeAlert
+
+func (h activeAlertsHeap) Len() int           { return len(h) }
+func (h activeAlertsHeap) Less(i, j int) bool { return h[i].endsAt.Before(h[j].endsAt) }
+
+func (h activeAlertsHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *activeAlertsHeap) Push(x interface{}) {
+	alert := x.(*activeAlert)
+	alert.index = len(*h)
+	*h = append(*h, alert)
+}
+
+func (h *activeAlertsHeap) Pop() interface{} {
+	old := *h
+	alert := old[len(old)-1]
+	old[len(old)-1] = nil
+	alert.index = -1
+	*h = old[:len(old)-1]
+	return alert
+}
+
+// isActiveAt returns whether an alert with the given end time is active at the given time, like
+// types.Alert.Resolved does.
+func isActiveAt(endsAt, now time.Time) bool {
+	return endsAt.IsZero() || endsAt.After(now)
+}
+
+// trackLabelSet records the label set of the alert as received now, and periodically removes the
+// label sets expired from the window. Must be called with the lock held.
+func (a *alertsLimiter) trackLabelSet(alert *types.Alert, window time.Duration) {
+	now := a.now()
+	name := model.LabelValue(alert.Name())
+
+	seen, ok := a.labelSets[name]
+	if !ok {
+		seen = map[model.Fingerprint]time.Time{}
+		a.labelSets[name] = seen
+	}
+	seen[alert.Fingerprint()] = now
+
+	if now.Sub(a.labelSetsLastPrune) < window {
+		return
+	}
+
+	deadline := now.Add(-window)
+	for name, seen := range a.labelSets {
+		for fp, lastSeen := range seen {
+			if lastSeen.Before(deadline) {
+				delete(seen, fp)
+			}
+		}
+		if len(seen) == 0 {
+			delete(a.labelSets, name)
+		}
+	}
+	a.labelSetsLastPrune = now
 }
 
 func (a *alertsLimiter) PostDelete(alert *types.Alert) {
@@ -742,6 +1002,7 @@ func (a *alertsLimiter) PostDelete(alert *types.Alert) {
 
 	a.totalSize -= a.sizes[fp]
 	delete(a.sizes, fp)
+	a.removeActive(fp)
 	a.count--
 }
 
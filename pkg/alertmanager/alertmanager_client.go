@@ -40,6 +40,8 @@ type ClientConfig struct {
 	GRPCCompression string           `yaml:"grpc_compression"`
 	MaxRecvMsgSize  int              `yaml:"max_recv_msg_size"`
 	MaxSendMsgSize  int              `yaml:"max_send_msg_size"`
+
+	TargetTLSConfigs grpcclient.TargetMatcherTLSProvider `yaml:"target_tls_configs" doc:"nocli|description=[Experimental] List of TLS configs used to connect to the alertmanagers whose address matches their regex, the first matching one being used. The global TLS config is used for the alertmanagers not matched by any of them."`
 }
 
 // RegisterFlagsWithPrefix registers flags with prefix.
@@ -67,6 +69,7 @@ func newAlertmanagerClientsPool(discovery client.PoolServiceDiscovery, amClientC
 		BackoffOnRatelimits: false,
 		TLSEnabled:          amClientCfg.TLSEnabled,
 		TLS:                 amClientCfg.TLS,
+		TargetTLSConfigs:    amClientCfg.TargetTLSConfigs,
 	}
 
 	requestDuration := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
@@ -103,7 +106,8 @@ func (f *alertmanagerClientsPool) GetClientFor(addr string) (Client, error) {
 }
 
 func dialAlertmanagerClient(cfg grpcclient.Config, addr string, requestDuration *prometheus.HistogramVec) (*alertmanagerClient, error) {
-	opts, err := cfg.DialOption(grpcclient.Instrument(requestDuration))
+	unaryInterceptors, streamInterceptors := grpcclient.Instrument(requestDuration)
+	opts, err := cfg.DialOptionForTarget(addr, unaryInterceptors, streamInterceptors)
 	if err != nil {
 		return nil, err
 	}
@@ -60,12 +60,17 @@ type alertmanagerMetrics struct {
 	persistFailed           *prometheus.Desc
 
 	notificationRateLimited                 *prometheus.Desc
+	notificationTemplateTimeouts            *prometheus.Desc
 	dispatcherAggregationGroups             *prometheus.Desc
 	dispatcherProcessingDuration            *prometheus.Desc
 	dispatcherAggregationGroupsLimitReached *prometheus.Desc
 	insertAlertFailures                     *prometheus.Desc
+	alertsLabelSetsLimited                  *prometheus.Desc
+	alertsActiveLimited                     *prometheus.Desc
 	alertsLimiterAlertsCount                *prometheus.Desc
 	alertsLimiterAlertsSize                 *prometheus.Desc
+	notificationsInFlight                   *prometheus.Desc
+	notificationsQueued                     *prometheus.Desc
 }
 
 func newAlertmanagerMetrics() *alertmanagerMetrics {
@@ -215,6 +220,10 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_notification_rate_limited_total",
 			"Total number of rate-limited notifications per integration.",
 			[]string{"user", "integration"}, nil),
+		notificationTemplateTimeouts: prometheus.NewDesc(
+			"cortex_alertmanager_notification_template_timeouts_total",
+			"Total number of notifications failed because of the template execution timeout per integration.",
+			[]string{"user", "integration"}, nil),
 		dispatcherAggregationGroupsLimitReached: prometheus.NewDesc(
 			"cortex_alertmanager_dispatcher_aggregation_group_limit_reached_total",
 			"Number of times when dispatcher failed to create new aggregation group due to limit.",
@@ -231,6 +240,14 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_alerts_insert_limited_total",
 			"Total number of failures to store alert due to hitting alertmanager limits.",
 			[]string{"user"}, nil),
+		alertsLabelSetsLimited: prometheus.NewDesc(
+			"cortex_alertmanager_alerts_label_sets_limited_total",
+			"Total number of alerts rejected because their alert name reached the limit of distinct label sets.",
+			[]string{"user"}, nil),
+		alertsActiveLimited: prometheus.NewDesc(
+			"cortex_alertmanager_alerts_active_limited_total",
+			"Total number of alerts rejected because the limit of active alerts was reached.",
+			[]string{"user"}, nil),
 		alertsLimiterAlertsCount: prometheus.NewDesc(
 			"cortex_alertmanager_alerts_limiter_current_alerts",
 			"Number of alerts tracked by alerts limiter.",
@@ -239,6 +256,14 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_alerts_limiter_current_alerts_size_bytes",
 			"Total size of alerts tracked by alerts limiter.",
 			[]string{"user"}, nil),
+		notificationsInFlight: prometheus.NewDesc(
+			"cortex_alertmanager_notifications_in_flight",
+			"Number of notifications currently being sent.",
+			[]string{"user"}, nil),
+		notificationsQueued: prometheus.NewDesc(
+			"cortex_alertmanager_notifications_queued",
+			"Number of notifications waiting for the number of in-flight notifications to go below the limit.",
+			[]string{"user"}, nil),
 	}
 }
 
@@ -289,12 +314,17 @@ func (m *alertmanagerMetrics) Describe(out chan<- *prometheus.Desc) {
 	out <- m.persistTotal
 	out <- m.persistFailed
 	out <- m.notificationRateLimited
+	out <- m.notificationTemplateTimeouts
 	out <- m.dispatcherAggregationGroups
 	out <- m.dispatcherProcessingDuration
 	out <- m.dispatcherAggregationGroupsLimitReached
 	out <- m.insertAlertFailures
+	out <- m.alertsLabelSetsLimited
+	out <- m.alertsActiveLimited
 	out <- m.alertsLimiterAlertsCount
 	out <- m.alertsLimiterAlertsSize
+	out <- m.notificationsInFlight
+	out <- m.notificationsQueued
 }
 
 func (m *alertmanagerMetrics) Collect(out chan<- prometheus.Metric) {
@@ -342,10 +372,15 @@ func (m *alertmanagerMetrics) Collect(out chan<- prometheus.Metric) {
 	data.SendSumOfCounters(out, m.persistFailed, "alertmanager_state_persist_failed_total")
 
 	data.SendSumOfCountersPerUserWithLabels(out, m.notificationRateLimited, "alertmanager_notification_rate_limited_total", "integration")
+	data.SendSumOfCountersPerUserWithLabels(out, m.notificationTemplateTimeouts, "alertmanager_notification_template_timeouts_total", "integration")
 	data.SendSumOfGaugesPerUser(out, m.dispatcherAggregationGroups, "alertmanager_dispatcher_aggregation_groups")
 	data.SendSumOfSummariesPerUser(out, m.dispatcherProcessingDuration, "alertmanager_dispatcher_alert_processing_duration_seconds")
 	data.SendSumOfCountersPerUser(out, m.dispatcherAggregationGroupsLimitReached, "alertmanager_dispatcher_aggregation_group_limit_reached_total")
 	data.SendSumOfCountersPerUser(out, m.insertAlertFailures, "alertmanager_alerts_insert_limited_total")
+	data.SendSumOfCountersPerUser(out, m.alertsLabelSetsLimited, "alertmanager_alerts_label_sets_limited_total")
+	data.SendSumOfCountersPerUser(out, m.alertsActiveLimited, "alertmanager_alerts_active_limited_total")
 	data.SendSumOfGaugesPerUser(out, m.alertsLimiterAlertsCount, "alertmanager_alerts_limiter_current_alerts")
 	data.SendSumOfGaugesPerUser(out, m.alertsLimiterAlertsSize, "alertmanager_alerts_limiter_current_alerts_size_bytes")
+	data.SendSumOfGaugesPerUser(out, m.notificationsInFlight, "alertmanager_notifications_in_flight")
+	data.SendSumOfGaugesPerUser(out, m.notificationsQueued, "alertmanager_notifications_queued")
 }
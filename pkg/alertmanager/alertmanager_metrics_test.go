@@ -313,6 +313,16 @@ func TestAlertmanagerMetricsStore(t *testing.T) {
 		cortex_alertmanager_alerts_insert_limited_total{user="user1"} 7
 		cortex_alertmanager_alerts_insert_limited_total{user="user2"} 70
 		cortex_alertmanager_alerts_insert_limited_total{user="user3"} 700
+		# HELP cortex_alertmanager_alerts_active_limited_total Total number of alerts rejected because the limit of active alerts was reached.
+		# TYPE cortex_alertmanager_alerts_active_limited_total counter
+		cortex_alertmanager_alerts_active_limited_total{user="user1"} 5
+		cortex_alertmanager_alerts_active_limited_total{user="user2"} 50
+		cortex_alertmanager_alerts_active_limited_total{user="user3"} 500
+		# HELP cortex_alertmanager_alerts_label_sets_limited_total Total number of alerts rejected because their alert name reached the limit of distinct label sets.
+		# TYPE cortex_alertmanager_alerts_label_sets_limited_total counter
+		cortex_alertmanager_alerts_label_sets_limited_total{user="user1"} 3
+		cortex_alertmanager_alerts_label_sets_limited_total{user="user2"} 30
+		cortex_alertmanager_alerts_label_sets_limited_total{user="user3"} 300
 `))
 	require.NoError(t, err)
 }
@@ -634,6 +644,16 @@ func TestAlertmanagerMetricsRemoval(t *testing.T) {
 						cortex_alertmanager_alerts_insert_limited_total{user="user1"} 7
 						cortex_alertmanager_alerts_insert_limited_total{user="user2"} 70
 						cortex_alertmanager_alerts_insert_limited_total{user="user3"} 700
+						# HELP cortex_alertmanager_alerts_active_limited_total Total number of alerts rejected because the limit of active alerts was reached.
+						# TYPE cortex_alertmanager_alerts_active_limited_total counter
+						cortex_alertmanager_alerts_active_limited_total{user="user1"} 5
+						cortex_alertmanager_alerts_active_limited_total{user="user2"} 50
+						cortex_alertmanager_alerts_active_limited_total{user="user3"} 500
+						# HELP cortex_alertmanager_alerts_label_sets_limited_total Total number of alerts rejected because their alert name reached the limit of distinct label sets.
+						# TYPE cortex_alertmanager_alerts_label_sets_limited_total counter
+						cortex_alertmanager_alerts_label_sets_limited_total{user="user1"} 3
+						cortex_alertmanager_alerts_label_sets_limited_total{user="user2"} 30
+						cortex_alertmanager_alerts_label_sets_limited_total{user="user3"} 300
 
 `))
 	require.NoError(t, err)
@@ -896,6 +916,14 @@ func TestAlertmanagerMetricsRemoval(t *testing.T) {
 			# TYPE cortex_alertmanager_alerts_insert_limited_total counter
 			cortex_alertmanager_alerts_insert_limited_total{user="user1"} 7
 			cortex_alertmanager_alerts_insert_limited_total{user="user2"} 70
+			# HELP cortex_alertmanager_alerts_active_limited_total Total number of alerts rejected because the limit of active alerts was reached.
+			# TYPE cortex_alertmanager_alerts_active_limited_total counter
+			cortex_alertmanager_alerts_active_limited_total{user="user1"} 5
+			cortex_alertmanager_alerts_active_limited_total{user="user2"} 50
+			# HELP cortex_alertmanager_alerts_label_sets_limited_total Total number of alerts rejected because their alert name reached the limit of distinct label sets.
+			# TYPE cortex_alertmanager_alerts_label_sets_limited_total counter
+			cortex_alertmanager_alerts_label_sets_limited_total{user="user1"} 3
+			cortex_alertmanager_alerts_label_sets_limited_total{user="user2"} 30
 `))
 	require.NoError(t, err)
 }
@@ -950,6 +978,8 @@ func populateAlertmanager(base float64) *prometheus.Registry {
 	lm.count.Set(10 * base)
 	lm.size.Set(100 * base)
 	lm.insertFailures.Add(7 * base)
+	lm.labelSetsLimited.Add(3 * base)
+	lm.activeAlertsLimited.Add(5 * base)
 
 	sr := newStateReplicationMetrics(reg)
 	sr.partialStateMergesFailed.WithLabelValues("nfl").Add(base * 2)
@@ -1160,9 +1190,11 @@ func newAPIMetrics(version string, r prometheus.Registerer) *apiMetrics {
 }
 
 type limiterMetrics struct {
-	count          prometheus.Gauge
-	size           prometheus.Gauge
-	insertFailures prometheus.Counter
+	count               prometheus.Gauge
+	size                prometheus.Gauge
+	insertFailures      prometheus.Counter
+	labelSetsLimited    prometheus.Counter
+	activeAlertsLimited prometheus.Counter
 }
 
 func newLimiterMetrics(r prometheus.Registerer) *limiterMetrics {
@@ -1181,10 +1213,22 @@ func newLimiterMetrics(r prometheus.Registerer) *limiterMetrics {
 		Help: "Number of failures to insert new alerts to in-memory alert store.",
 	})
 
+	labelSetsLimited := promauto.With(r).NewCounter(prometheus.CounterOpts{
+		Name: "alertmanager_alerts_label_sets_limited_total",
+		Help: "Number of alerts rejected because their alert name reached the limit of distinct label sets.",
+	})
+
+	activeAlertsLimited := promauto.With(r).NewCounter(prometheus.CounterOpts{
+		Name: "alertmanager_alerts_active_limited_total",
+		Help: "Number of alerts rejected because the limit of active alerts was reached.",
+	})
+
 	return &limiterMetrics{
-		count:          count,
-		size:           size,
-		insertFailures: insertAlertFailures,
+		count:               count,
+		size:                size,
+		insertFailures:      insertAlertFailures,
+		labelSetsLimited:    labelSetsLimited,
+		activeAlertsLimited: activeAlertsLimited,
 	}
 }
 
@@ -1,6 +1,7 @@
 package alertmanager
 
 import (
+	"bytes"
 	"fmt"
 	"net/url"
 	"strings"
@@ -213,6 +214,112 @@ func TestAlertsLimiterWithSizeLimitAndAnnotationUpdate(t *testing.T) {
 	})
 }
 
+func TestAlertsLimiterWithLabelSetsLimit(t *testing.T) {
+	newAlert := func(name, instance string) *types.Alert {
+		return &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": model.LabelValue(name), "instance": model.LabelValue(instance)}}}
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	limiter := newAlertsLimiter("test", &mockAlertManagerLimits{maxLabelSetsPerAlertName: 2, labelSetsWindow: time.Hour}, reg)
+
+	now := time.Unix(1000, 0)
+	limiter.now = func() time.Time { return now }
+
+	store := func(alert *types.Alert, existing bool) error {
+		if err := limiter.PreStore(alert, existing); err != nil {
+			return err
+		}
+		limiter.PostStore(alert, existing)
+		return nil
+	}
+
+	require.NoError(t, store(newAlert("HighLatency", "a"), false))
+	require.NoError(t, store(newAlert("HighLatency", "b"), false))
+
+	// A new label set exceeding the limit is rejected, while other alert names are not affected.
+	assert.Equal(t, fmt.Errorf(errTooManyLabelSets, time.Hour, 2, "HighLatency"), store(newAlert("HighLatency", "c"), false))
+	require.NoError(t, store(newAlert("InstanceDown", "c"), false))
+
+	// The label sets received within the window are accepted again, even if no more stored.
+	limiter.PostDelete(newAlert("HighLatency", "a"))
+	require.NoError(t, store(newAlert("HighLatency", "a"), false))
+
+	// Updates of the stored alerts are always accepted.
+	require.NoError(t, store(newAlert("HighLatency", "d"), true))
+
+	// Once a label set expires from the window, a new label set can be received.
+	now = now.Add(45 * time.Minute)
+	require.NoError(t, store(newAlert("HighLatency", "b"), true))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, store(newAlert("HighLatency", "c"), false))
+	assert.Equal(t, fmt.Errorf(errTooManyLabelSets, time.Hour, 2, "HighLatency"), store(newAlert("HighLatency", "e"), false))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+		# HELP alertmanager_alerts_label_sets_limited_total Number of alerts rejected because their alert name reached the limit of distinct label sets.
+		# TYPE alertmanager_alerts_label_sets_limited_total counter
+		alertmanager_alerts_label_sets_limited_total 2
+	`), "alertmanager_alerts_label_sets_limited_total"))
+}
+
+func TestAlertsLimiterWithActiveAlertsLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+	newAlert := func(instance string, endsAt time.Time) *types.Alert {
+		return &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "InstanceDown", "instance": model.LabelValue(instance)}, EndsAt: endsAt}}
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	limiter := newAlertsLimiter("test", &mockAlertManagerLimits{maxActiveAlerts: 2}, reg)
+	limiter.now = func() time.Time { return now }
+
+	store := func(alert *types.Alert, existing bool) error {
+		if err := limiter.PreStore(alert, existing); err != nil {
+			return err
+		}
+		limiter.PostStore(alert, existing)
+		return nil
+	}
+
+	require.NoError(t, store(newAlert("a", now.Add(time.Hour)), false))
+	require.NoError(t, store(newAlert("b", now.Add(10*time.Minute)), false))
+
+	// A new active alert exceeding the limit is rejected, while the active alerts keep being updated.
+	assert.Equal(t, fmt.Errorf(errTooManyActiveAlerts, 2, "InstanceDown"), store(newAlert("c", now.Add(time.Hour)), false))
+	require.NoError(t, store(newAlert("a", now.Add(2*time.Hour)), true))
+
+	// Resolved alerts are always accepted, and don't count towards the limit.
+	require.NoError(t, store(newAlert("d", now.Add(-time.Minute)), false))
+
+	// Resolving an active alert frees its capacity.
+	require.NoError(t, store(newAlert("a", now), true))
+	require.NoError(t, store(newAlert("c", now.Add(time.Hour)), false))
+
+	// A stored resolved alert firing again is limited like a new one.
+	assert.Equal(t, fmt.Errorf(errTooManyActiveAlerts, 2, "InstanceDown"), store(newAlert("d", now.Add(time.Hour)), true))
+
+	// Alerts resolved once their end time passed free their capacity, even if not updated.
+	now = now.Add(15 * time.Minute)
+	require.NoError(t, store(newAlert("d", now.Add(time.Hour)), true))
+
+	// Deleted alerts free their capacity.
+	assert.Equal(t, fmt.Errorf(errTooManyActiveAlerts, 2, "InstanceDown"), store(newAlert("e", now.Add(time.Hour)), false))
+	limiter.PostDelete(newAlert("c", time.Time{}))
+	require.NoError(t, store(newAlert("e", now.Add(time.Hour)), false))
+
+	// Alerts without an end time stay active until resolved.
+	limiter.PostDelete(newAlert("e", time.Time{}))
+	require.NoError(t, store(newAlert("f", time.Time{}), false))
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, store(newAlert("g", now.Add(time.Hour)), false))
+	assert.Equal(t, fmt.Errorf(errTooManyActiveAlerts, 2, "InstanceDown"), store(newAlert("h", now.Add(time.Hour)), false))
+	assert.Len(t, limiter.activeByEndsAt, 1)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+		# HELP alertmanager_alerts_active_limited_total Number of alerts rejected because the limit of active alerts was reached.
+		# TYPE alertmanager_alerts_active_limited_total counter
+		alertmanager_alerts_active_limited_total 4
+	`), "alertmanager_alerts_active_limited_total"))
+}
+
 // testLimiter sends sequence of alerts to limiter, and checks if limiter updated reacted correctly.
 func testLimiter(t *testing.T, limits Limits, ops []callbackOp) {
 	reg := prometheus.NewPedanticRegistry()
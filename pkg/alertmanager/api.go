@@ -143,7 +143,17 @@ func (am *MultitenantAlertmanager) SetUserConfig(w http.ResponseWriter, r *http.
 	}
 
 	cfgDesc := alertspb.ToProto(cfg.AlertmanagerConfig, cfg.TemplateFiles, userID)
-	if err := validateUserConfig(logger, cfgDesc, am.limits, userID); err != nil {
+
+	// The config is stored as submitted, but it's the one merged with the base config which is
+	// run by the Alertmanager, so it's the one validated.
+	validatedCfgDesc := cfgDesc
+	if cfgDesc.RawConfig != "" {
+		validatedCfgDesc.RawConfig, err = am.withBaseConfig(cfgDesc.RawConfig)
+	}
+	if err == nil {
+		err = validateUserConfig(logger, validatedCfgDesc, am.limits, userID)
+	}
+	if err != nil {
 		level.Warn(logger).Log("msg", errValidatingConfig, "err", err.Error())
 		http.Error(w, fmt.Sprintf("%s: %s", errValidatingConfig, err.Error()), http.StatusBadRequest)
 		return
@@ -190,7 +200,13 @@ func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits
 		return fmt.Errorf("configuration provided is empty, if you'd like to remove your configuration please use the delete configuration endpoint")
 	}
 
-	amCfg, err := config.Load(cfg.RawConfig)
+	// The configs of any supported version are valid, once upgraded to the current one.
+	rawCfg, _, _, err := migrateConfig(cfg.RawConfig)
+	if err != nil {
+		return err
+	}
+
+	amCfg, err := loadConfig(rawCfg)
 	if err != nil {
 		return err
 	}
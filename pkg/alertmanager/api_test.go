@@ -66,6 +66,34 @@ alertmanager_config: |
     - name: default-receiver
 `,
 		},
+		{
+			name: "Should pass if the alertmanager config of a prior version is valid once migrated",
+			cfg: `
+alertmanager_config: |
+  cortex_config_version: 2
+  route:
+    receiver: 'default-receiver'
+    group_by: [cluster, alertname]
+  receivers:
+    - name: default-receiver
+  mute_time_intervals:
+    - name: weekends
+      time_intervals:
+        - weekdays: [saturday, sunday]
+`,
+		},
+		{
+			name: "Should return error if the alertmanager config version is not supported",
+			cfg: `
+alertmanager_config: |
+  cortex_config_version: 4
+  route:
+    receiver: 'default-receiver'
+  receivers:
+    - name: default-receiver
+`,
+			err: fmt.Errorf("error validating Alertmanager config: unsupported Alertmanager config version 4, the supported versions are 1 to 3"),
+		},
 		{
 			name: "Should return error if the config is empty due to wrong indentation",
 			cfg: `
@@ -0,0 +1,123 @@
+package alertmanager
+
+import (
+	"gopkg.in/yaml.v2"
+)
+
+// Top-level sections of the Alertmanager config holding lists of items identified by name.
+var baseConfigNamedSections = []string{"receivers", "time_intervals", "mute_time_intervals"}
+
+// mergeBaseConfig merges the base Alertmanager config with the tenant one. The tenant config
+// takes precedence over the base one:
+//   - global: the settings are merged, the tenant ones override the base ones.
+//   - receivers, time_intervals and mute_time_intervals: the items are merged by name, the tenant
+//     ones override the base ones with the same name.
+//   - inhibit_rules: the base rules are appended to the tenant ones.
+//   - route: the settings of the root routes are merged, the tenant ones override the base ones.
+//     The base child routes are appended to the tenant ones, so they only match the alerts not
+//     matched by the tenant routes.
+//   - any other setting: the tenant one, if set, overrides the base one.
+//
+// The merged config is not validated, since it's loaded right after.
+func mergeBaseConfig(base, tenant string) (string, error) {
+	baseCfg := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(base), &baseCfg); err != nil {
+		return "", err
+	}
+
+	tenantCfg := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(tenant), &tenantCfg); err != nil {
+		return "", err
+	}
+
+	merged := make(map[string]interface{}, len(baseCfg)+len(tenantCfg))
+	for key, value := range baseCfg {
+		merged[key] = value
+	}
+	for key, value := range tenantCfg {
+		merged[key] = value
+	}
+
+	if base, tenant, ok := bothMaps(baseCfg["global"], tenantCfg["global"]); ok {
+		merged["global"] = mergeMaps(base, tenant)
+	}
+
+	for _, section := range baseConfigNamedSections {
+		if base, tenant, ok := bothLists(baseCfg[section], tenantCfg[section]); ok {
+			merged[section] = mergeNamedLists(tenant, base)
+		}
+	}
+
+	if base, tenant, ok := bothLists(baseCfg["inhibit_rules"], tenantCfg["inhibit_rules"]); ok {
+		merged["inhibit_rules"] = append(tenant, base...)
+	}
+
+	if base, tenant, ok := bothMaps(baseCfg["route"], tenantCfg["route"]); ok {
+		route := mergeMaps(base, tenant)
+		if baseRoutes, tenantRoutes, ok := bothLists(base["routes"], tenant["routes"]); ok {
+			route["routes"] = append(tenantRoutes, baseRoutes...)
+		}
+		merged["route"] = route
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// bothMaps returns the base and tenant values as maps, if they're both set.
+func bothMaps(base, tenant interface{}) (map[interface{}]interface{}, map[interface{}]interface{}, bool) {
+	baseMap, baseOk := base.(map[interface{}]interface{})
+	tenantMap, tenantOk := tenant.(map[interface{}]interface{})
+	return baseMap, tenantMap, baseOk && tenantOk
+}
+
+// bothLists returns the base and tenant values as lists, if they're both set.
+func bothLists(base, tenant interface{}) ([]interface{}, []interface{}, bool) {
+	baseList, baseOk := base.([]interface{})
+	tenantList, tenantOk := tenant.([]interface{})
+	return baseList, tenantList, baseOk && tenantOk
+}
+
+func mergeMaps(base, override map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// mergeNamedLists returns the items of the first list, followed by the items of the
+// second list whose name is not in the first list.
+func mergeNamedLists(first, second []interface{}) []interface{} {
+	names := make(map[interface{}]struct{}, len(first))
+	for _, item := range first {
+		if m, ok := item.(map[interface{}]interface{}); ok {
+			names[m["name"]] = struct{}{}
+		}
+	}
+
+	merged := append([]interface{}{}, first...)
+	for _, item := range second {
+		if m, ok := item.(map[interface{}]interface{}); ok {
+			if _, exists := names[m["name"]]; exists {
+				continue
+			}
+		}
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// withBaseConfig returns the input config merged with the base config, if any.
+func (am *MultitenantAlertmanager) withBaseConfig(rawCfg string) (string, error) {
+	if am.baseConfig == "" {
+		return rawCfg, nil
+	}
+	return mergeBaseConfig(am.baseConfig, rawCfg)
+}
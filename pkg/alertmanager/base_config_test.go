@@ -0,0 +1,116 @@
+package alertmanager
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/alertmanager/alertspb"
+)
+
+const testBaseConfig = `
+global:
+  smtp_smarthost: base.example.com:25
+  smtp_from: base@example.com
+route:
+  receiver: base
+  group_by: [alertname]
+  routes:
+    - receiver: base
+      matchers: [team="base"]
+receivers:
+  - name: base
+  - name: shared
+    webhook_configs:
+      - url: http://base.example.com
+inhibit_rules:
+  - source_matchers: [severity="base"]
+    target_matchers: [severity="warning"]
+`
+
+func TestMergeBaseConfig(t *testing.T) {
+	tenant := `
+global:
+  smtp_from: tenant@example.com
+route:
+  receiver: shared
+  routes:
+    - receiver: tenant
+      matchers: [team="tenant"]
+receivers:
+  - name: tenant
+  - name: shared
+    webhook_configs:
+      - url: http://tenant.example.com
+inhibit_rules:
+  - source_matchers: [severity="tenant"]
+    target_matchers: [severity="warning"]
+`
+
+	merged, err := mergeBaseConfig(testBaseConfig, tenant)
+	require.NoError(t, err)
+
+	cfg, err := config.Load(merged)
+	require.NoError(t, err)
+
+	// The tenant global settings override the base ones.
+	assert.Equal(t, "base.example.com:25", cfg.Global.SMTPSmarthost.String())
+	assert.Equal(t, "tenant@example.com", cfg.Global.SMTPFrom)
+
+	// The tenant root route settings override the base ones, and the base child routes
+	// are evaluated after the tenant ones.
+	assert.Equal(t, "shared", cfg.Route.Receiver)
+	assert.Equal(t, []string{"alertname"}, cfg.Route.GroupByStr)
+	require.Len(t, cfg.Route.Routes, 2)
+	assert.Equal(t, "tenant", cfg.Route.Routes[0].Receiver)
+	assert.Equal(t, "base", cfg.Route.Routes[1].Receiver)
+
+	// The tenant receivers override the base ones with the same name.
+	require.Len(t, cfg.Receivers, 3)
+	assert.Equal(t, "tenant", cfg.Receivers[0].Name)
+	assert.Equal(t, "shared", cfg.Receivers[1].Name)
+	assert.Equal(t, "http://tenant.example.com", cfg.Receivers[1].WebhookConfigs[0].URL.String())
+	assert.Equal(t, "base", cfg.Receivers[2].Name)
+
+	// The base inhibition rules are appended to the tenant ones.
+	require.Len(t, cfg.InhibitRules, 2)
+	assert.Equal(t, "tenant", cfg.InhibitRules[0].SourceMatchers[0].Value)
+	assert.Equal(t, "base", cfg.InhibitRules[1].SourceMatchers[0].Value)
+}
+
+func TestMergeBaseConfig_ShouldKeepTheBaseSectionsNotSetByTheTenant(t *testing.T) {
+	merged, err := mergeBaseConfig(testBaseConfig, "templates: [tenant.tmpl]")
+	require.NoError(t, err)
+
+	cfg, err := config.Load(merged)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenant.tmpl"}, cfg.Templates)
+	assert.Equal(t, "base", cfg.Route.Receiver)
+	assert.Len(t, cfg.Receivers, 2)
+	assert.Len(t, cfg.InhibitRules, 1)
+}
+
+func TestMergeBaseConfig_ShouldFailOnInvalidConfig(t *testing.T) {
+	_, err := mergeBaseConfig("route: [", "")
+	assert.Error(t, err)
+
+	_, err = mergeBaseConfig(testBaseConfig, "receivers: {")
+	assert.Error(t, err)
+}
+
+func TestMultitenantAlertmanager_ValidateWithBaseConfig(t *testing.T) {
+	am := &MultitenantAlertmanager{baseConfig: testBaseConfig}
+
+	// The tenant config is only valid once merged with the base one, which defines the receiver.
+	merged, err := am.withBaseConfig("route:\n  receiver: base\n")
+	require.NoError(t, err)
+	require.NoError(t, validateUserConfig(log.NewNopLogger(), alertspb.ToProto(merged, nil, "user"), &mockAlertManagerLimits{}, "user"))
+
+	// The merged config is validated, so a tenant route referencing an unknown receiver fails.
+	merged, err = am.withBaseConfig("route:\n  receiver: unknown\n")
+	require.NoError(t, err)
+	require.Error(t, validateUserConfig(log.NewNopLogger(), alertspb.ToProto(merged, nil, "user"), &mockAlertManagerLimits{}, "user"))
+}
@@ -0,0 +1,111 @@
+package alertmanager
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type concurrencyLimits interface {
+	// MaxConcurrentNotifications returns the maximum number of in-flight notifications. 0 = no limit.
+	MaxConcurrentNotifications() int
+}
+
+// notificationsLimiter limits the number of in-flight notifications of a tenant, across all
+// its integrations. Notifications exceeding the limit are queued until a slot is released.
+type notificationsLimiter struct {
+	limits concurrencyLimits
+
+	inFlightGauge prometheus.Gauge
+	queuedGauge   prometheus.Gauge
+
+	mtx      sync.Mutex
+	inFlight int
+	// released is closed, and replaced, every time a slot is released.
+	released chan struct{}
+}
+
+func newNotificationsLimiter(limits concurrencyLimits, reg prometheus.Registerer) *notificationsLimiter {
+	return &notificationsLimiter{
+		limits:   limits,
+		released: make(chan struct{}),
+		inFlightGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "alertmanager_notifications_in_flight",
+			Help: "Number of notifications currently being sent.",
+		}),
+		queuedGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "alertmanager_notifications_queued",
+			Help: "Number of notifications waiting for the number of in-flight notifications to go below the limit.",
+		}),
+	}
+}
+
+// acquire blocks until the notification can be sent without exceeding the limit, or the context is done.
+func (l *notificationsLimiter) acquire(ctx context.Context) error {
+	queued := false
+	defer func() {
+		if queued {
+			l.queuedGauge.Dec()
+		}
+	}()
+
+	for {
+		l.mtx.Lock()
+		// The limit is read at every attempt, so that runtime changes are honored.
+		if limit := l.limits.MaxConcurrentNotifications(); limit <= 0 || l.inFlight < limit {
+			l.inFlight++
+			l.mtx.Unlock()
+			l.inFlightGauge.Inc()
+			return nil
+		}
+		released := l.released
+		l.mtx.Unlock()
+
+		if !queued {
+			queued = true
+			l.queuedGauge.Inc()
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *notificationsLimiter) release() {
+	l.mtx.Lock()
+	l.inFlight--
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mtx.Unlock()
+
+	l.inFlightGauge.Dec()
+}
+
+type concurrencyLimitedNotifier struct {
+	upstream notify.Notifier
+	limiter  *notificationsLimiter
+}
+
+func newConcurrencyLimitedNotifier(upstream notify.Notifier, limiter *notificationsLimiter) *concurrencyLimitedNotifier {
+	return &concurrencyLimitedNotifier{
+		upstream: upstream,
+		limiter:  limiter,
+	}
+}
+
+func (c *concurrencyLimitedNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return true, errors.Wrap(err, "failed to notify while waiting for the in-flight notifications to go below the limit")
+	}
+	defer c.limiter.release()
+
+	return c.upstream.Notify(ctx, alerts...)
+}
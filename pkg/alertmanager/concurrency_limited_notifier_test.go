@@ -0,0 +1,110 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestConcurrencyLimitedNotifier(t *testing.T) {
+	limits := &concurrencyLimiterLimits{}
+	limits.limit.Store(2)
+	limiter := newNotificationsLimiter(limits, prometheus.NewPedanticRegistry())
+
+	upstream := &blockingNotifier{unblock: make(chan struct{})}
+	notifier := newConcurrencyLimitedNotifier(upstream, limiter)
+
+	// Send more notifications than the limit.
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := notifier.Notify(context.Background(), &types.Alert{})
+			errs <- err
+		}()
+	}
+
+	test.Poll(t, time.Second, 2.0, func() interface{} { return testutil.ToFloat64(limiter.inFlightGauge) })
+	test.Poll(t, time.Second, 1.0, func() interface{} { return testutil.ToFloat64(limiter.queuedGauge) })
+	assert.Equal(t, int64(2), upstream.calls.Load())
+
+	// Once an in-flight notification completes, the queued one is sent.
+	upstream.unblock <- struct{}{}
+	require.NoError(t, <-errs)
+	test.Poll(t, time.Second, int64(3), func() interface{} { return upstream.calls.Load() })
+	assert.Equal(t, 2.0, testutil.ToFloat64(limiter.inFlightGauge))
+	assert.Equal(t, 0.0, testutil.ToFloat64(limiter.queuedGauge))
+
+	upstream.unblock <- struct{}{}
+	upstream.unblock <- struct{}{}
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	assert.Equal(t, 0.0, testutil.ToFloat64(limiter.inFlightGauge))
+}
+
+func TestConcurrencyLimitedNotifier_ShouldStopWaitingOnContextCancellation(t *testing.T) {
+	limits := &concurrencyLimiterLimits{}
+	limits.limit.Store(1)
+	limiter := newNotificationsLimiter(limits, prometheus.NewPedanticRegistry())
+
+	upstream := &blockingNotifier{unblock: make(chan struct{})}
+	notifier := newConcurrencyLimitedNotifier(upstream, limiter)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := notifier.Notify(context.Background(), &types.Alert{})
+		assert.NoError(t, err)
+	}()
+	test.Poll(t, time.Second, 1.0, func() interface{} { return testutil.ToFloat64(limiter.inFlightGauge) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	retry, err := notifier.Notify(ctx, &types.Alert{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, retry)
+	assert.Equal(t, int64(1), upstream.calls.Load())
+	assert.Equal(t, 0.0, testutil.ToFloat64(limiter.queuedGauge))
+
+	upstream.unblock <- struct{}{}
+	<-done
+}
+
+func TestConcurrencyLimitedNotifier_ShouldNotLimitWhenDisabled(t *testing.T) {
+	limiter := newNotificationsLimiter(&concurrencyLimiterLimits{}, prometheus.NewPedanticRegistry())
+	notifier := newConcurrencyLimitedNotifier(&mockNotifier{}, limiter)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, limiter.acquire(context.Background()))
+	}
+	_, err := notifier.Notify(context.Background(), &types.Alert{})
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, testutil.ToFloat64(limiter.inFlightGauge))
+}
+
+type concurrencyLimiterLimits struct {
+	limit atomic.Int64
+}
+
+func (l *concurrencyLimiterLimits) MaxConcurrentNotifications() int {
+	return int(l.limit.Load())
+}
+
+type blockingNotifier struct {
+	calls   atomic.Int64
+	unblock chan struct{}
+}
+
+func (b *blockingNotifier) Notify(_ context.Context, _ ...*types.Alert) (bool, error) {
+	b.calls.Inc()
+	<-b.unblock
+	return false, nil
+}
@@ -0,0 +1,205 @@
+package alertmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// configVersionKey is the top-level key of the tenant Alertmanager config holding the
+	// version of its schema. It's removed from the config before loading it.
+	configVersionKey = "cortex_config_version"
+
+	// currentConfigVersion is the version of the Alertmanager config schema currently supported.
+	currentConfigVersion = 3
+
+	// unversionedConfigVersion is the version of the configs without version, written before
+	// the config schema versioning was introduced.
+	unversionedConfigVersion = 1
+)
+
+// configMigration upgrades a tenant Alertmanager config from a version of the schema to the
+// next one, returning the description of the changes made.
+type configMigration func(cfg map[interface{}]interface{}) ([]string, error)
+
+// configMigrations are the migrations of the Alertmanager config schema. The migration at
+// index i upgrades the configs from version i+1 to version i+2.
+var configMigrations = []configMigration{
+	// Version 1 to 2: the match and match_re route settings, and the source_match(_re) and
+	// target_match(_re) inhibit rule settings, are replaced by the matchers settings.
+	migrateConfigMatchers,
+
+	// Version 2 to 3: the top-level mute_time_intervals are renamed to time_intervals.
+	migrateConfigTimeIntervals,
+}
+
+// migrateConfig upgrades the tenant Alertmanager config to the current version of the schema,
+// returning the upgraded config, the version it was upgraded from and the description of the
+// changes made. The config is returned untouched if there is nothing to upgrade, or if it can't
+// be parsed, so that the error is reported when loading it.
+func migrateConfig(rawCfg string) (string, int, []string, error) {
+	cfg := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(rawCfg), &cfg); err != nil {
+		return rawCfg, unversionedConfigVersion, nil, nil
+	}
+
+	version, versioned, err := configVersion(cfg)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	delete(cfg, configVersionKey)
+
+	var changes []string
+	for v := version; v < currentConfigVersion; v++ {
+		migrationChanges, err := configMigrations[v-1](cfg)
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("unable to migrate the Alertmanager config from version %d to %d: %w", v, v+1, err)
+		}
+		changes = append(changes, migrationChanges...)
+	}
+
+	if !versioned && len(changes) == 0 {
+		return rawCfg, version, nil, nil
+	}
+
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return string(out), version, changes, nil
+}
+
+// configVersion returns the version of the config schema, and whether the config is versioned.
+func configVersion(cfg map[interface{}]interface{}) (int, bool, error) {
+	value, ok := cfg[configVersionKey]
+	if !ok {
+		return unversionedConfigVersion, false, nil
+	}
+
+	version, ok := value.(int)
+	if !ok || version < 1 || version > currentConfigVersion {
+		return 0, false, fmt.Errorf("unsupported Alertmanager config version %v, the supported versions are 1 to %d", value, currentConfigVersion)
+	}
+	return version, true, nil
+}
+
+func migrateConfigMatchers(cfg map[interface{}]interface{}) ([]string, error) {
+	var changes []string
+
+	if route, ok := cfg["route"].(map[interface{}]interface{}); ok {
+		routeChanges, err := migrateRouteMatchers(route, "route")
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, routeChanges...)
+	}
+
+	rules, _ := cfg["inhibit_rules"].([]interface{})
+	for i, item := range rules {
+		rule, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for _, side := range []string{"source", "target"} {
+			path := fmt.Sprintf("inhibit_rules[%d]", i)
+			converted, err := convertMatchers(rule, side+"_match", side+"_match_re", side+"_matchers", path)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, converted...)
+		}
+	}
+
+	return changes, nil
+}
+
+func migrateRouteMatchers(route map[interface{}]interface{}, path string) ([]string, error) {
+	changes, err := convertMatchers(route, "match", "match_re", "matchers", path)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, _ := route["routes"].([]interface{})
+	for i, item := range routes {
+		child, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		childChanges, err := migrateRouteMatchers(child, fmt.Sprintf("%s.routes[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, childChanges...)
+	}
+	return changes, nil
+}
+
+// convertMatchers replaces the equality and regexp matches of the given settings with the
+// equivalent matchers, appended to the existing ones.
+func convertMatchers(section map[interface{}]interface{}, matchKey, matchREKey, matchersKey, path string) ([]string, error) {
+	var changes []string
+	matchers, _ := section[matchersKey].([]interface{})
+
+	for _, m := range []struct {
+		key       string
+		matchType labels.MatchType
+	}{{matchKey, labels.MatchEqual}, {matchREKey, labels.MatchRegexp}} {
+		values, ok := section[m.key].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, fmt.Sprint(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			matcher, err := labels.NewMatcher(m.matchType, name, fmt.Sprint(values[name]))
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", path, m.key, err)
+			}
+			matchers = append(matchers, matcher.String())
+		}
+
+		delete(section, m.key)
+		section[matchersKey] = matchers
+		changes = append(changes, fmt.Sprintf("%s: replaced %s with %s", path, m.key, matchersKey))
+	}
+
+	return changes, nil
+}
+
+func migrateConfigTimeIntervals(cfg map[interface{}]interface{}) ([]string, error) {
+	muteTimeIntervals, ok := cfg["mute_time_intervals"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	timeIntervals, _ := cfg["time_intervals"].([]interface{})
+	cfg["time_intervals"] = append(timeIntervals, muteTimeIntervals...)
+	delete(cfg, "mute_time_intervals")
+
+	return []string{"renamed mute_time_intervals to time_intervals"}, nil
+}
+
+// migrateConfig upgrades the tenant Alertmanager config to the current version of the schema,
+// logging the changes made. The configs are migrated each time they're polled, so the changes
+// are only logged when the config differs from the one currently set. It must be called with
+// the alertmanagersMtx held.
+func (am *MultitenantAlertmanager) migrateConfig(userID, rawCfg string) (string, error) {
+	migrated, version, changes, err := migrateConfig(rawCfg)
+	if err != nil {
+		return "", err
+	}
+	if current, ok := am.cfgs[userID]; len(changes) > 0 && (!ok || current.RawConfig != rawCfg) {
+		level.Info(am.logger).Log("msg", "migrated the Alertmanager configuration to the current version", "user", userID, "from_version", version, "to_version", currentConfigVersion, "changes", strings.Join(changes, "; "))
+	}
+	return migrated, nil
+}
@@ -0,0 +1,160 @@
+package alertmanager
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/alertmanager/alertspb"
+)
+
+const testLegacyConfig = `
+route:
+  receiver: default
+  routes:
+    - receiver: critical
+      match:
+        severity: critical
+      match_re:
+        service: "api|web"
+      mute_time_intervals: [weekends]
+      routes:
+        - receiver: critical
+          matchers: [env="prod"]
+          match:
+            region: 'eu "west"'
+receivers:
+  - name: default
+  - name: critical
+inhibit_rules:
+  - source_match:
+      severity: critical
+    target_match_re:
+      severity: "warning|info"
+    equal: [alertname]
+mute_time_intervals:
+  - name: weekends
+    time_intervals:
+      - weekdays: [saturday, sunday]
+time_intervals:
+  - name: nights
+    time_intervals:
+      - times:
+          - start_time: "00:00"
+            end_time: "06:00"
+`
+
+func TestMigrateConfig(t *testing.T) {
+	t.Run("should migrate the configs of version 1", func(t *testing.T) {
+		for _, rawCfg := range []string{testLegacyConfig, "cortex_config_version: 1\n" + testLegacyConfig} {
+			migrated, version, changes, err := migrateConfig(rawCfg)
+			require.NoError(t, err)
+			assert.Equal(t, 1, version)
+			assert.Equal(t, []string{
+				"route.routes[0]: replaced match with matchers",
+				"route.routes[0]: replaced match_re with matchers",
+				"route.routes[0].routes[0]: replaced match with matchers",
+				"inhibit_rules[0]: replaced source_match with source_matchers",
+				"inhibit_rules[0]: replaced target_match_re with target_matchers",
+				"renamed mute_time_intervals to time_intervals",
+			}, changes)
+
+			cfg, err := config.Load(migrated)
+			require.NoError(t, err)
+
+			assert.Empty(t, cfg.Route.Routes[0].MatchRE)
+			assert.Equal(t, `{service=~"api|web",severity="critical"}`, labels.Matchers(cfg.Route.Routes[0].Matchers).String())
+			assert.Equal(t, []string{"weekends"}, cfg.Route.Routes[0].MuteTimeIntervals)
+			assert.Equal(t, `{env="prod",region="eu \"west\""}`, labels.Matchers(cfg.Route.Routes[0].Routes[0].Matchers).String())
+
+			assert.Empty(t, cfg.InhibitRules[0].SourceMatch)
+			assert.Equal(t, `{severity="critical"}`, labels.Matchers(cfg.InhibitRules[0].SourceMatchers).String())
+			assert.Empty(t, cfg.InhibitRules[0].TargetMatchRE)
+			assert.Equal(t, `{severity=~"warning|info"}`, labels.Matchers(cfg.InhibitRules[0].TargetMatchers).String())
+
+			assert.Empty(t, cfg.MuteTimeIntervals)
+			require.Len(t, cfg.TimeIntervals, 2)
+			assert.Equal(t, "nights", cfg.TimeIntervals[0].Name)
+			assert.Equal(t, "weekends", cfg.TimeIntervals[1].Name)
+		}
+	})
+
+	t.Run("should migrate the configs of version 2", func(t *testing.T) {
+		migrated, version, changes, err := migrateConfig("cortex_config_version: 2\n" + testLegacyConfig)
+		require.NoError(t, err)
+		assert.Equal(t, 2, version)
+		assert.Equal(t, []string{"renamed mute_time_intervals to time_intervals"}, changes)
+
+		cfg, err := config.Load(migrated)
+		require.NoError(t, err)
+
+		// The matches are left untouched.
+		assert.Equal(t, map[string]string{"severity": "critical"}, cfg.Route.Routes[0].Match)
+		assert.Equal(t, map[string]string{"severity": "critical"}, cfg.InhibitRules[0].SourceMatch)
+
+		assert.Empty(t, cfg.MuteTimeIntervals)
+		assert.Len(t, cfg.TimeIntervals, 2)
+	})
+
+	t.Run("should only remove the version from the configs of the current version", func(t *testing.T) {
+		migrated, version, changes, err := migrateConfig("cortex_config_version: 3\n" + testLegacyConfig)
+		require.NoError(t, err)
+		assert.Equal(t, 3, version)
+		assert.Empty(t, changes)
+
+		cfg, err := config.Load(migrated)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"severity": "critical"}, cfg.Route.Routes[0].Match)
+		assert.Len(t, cfg.MuteTimeIntervals, 1)
+		assert.Len(t, cfg.TimeIntervals, 1)
+	})
+
+	t.Run("should return the unversioned configs with nothing to migrate untouched", func(t *testing.T) {
+		rawCfg := "route:\n  receiver: default\n  matchers: [team=\"ops\"]\nreceivers:\n  - name: default\n"
+		migrated, _, changes, err := migrateConfig(rawCfg)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.Equal(t, rawCfg, migrated)
+	})
+
+	t.Run("should fail on unsupported versions", func(t *testing.T) {
+		for _, version := range []string{"0", "4", "latest"} {
+			_, _, _, err := migrateConfig("cortex_config_version: " + version + "\n" + testLegacyConfig)
+			assert.EqualError(t, err, "unsupported Alertmanager config version "+version+", the supported versions are 1 to 3")
+		}
+	})
+
+	t.Run("should fail on invalid matches", func(t *testing.T) {
+		_, _, _, err := migrateConfig("route:\n  receiver: default\n  routes:\n    - match_re:\n        team: \"(\"\n")
+		assert.ErrorContains(t, err, "unable to migrate the Alertmanager config from version 1 to 2: route.routes[0].match_re:")
+	})
+}
+
+func TestMultitenantAlertmanager_MigrateConfig_ShouldOnlyLogTheChangesWhenTheConfigChanges(t *testing.T) {
+	logs := &bytes.Buffer{}
+	am := &MultitenantAlertmanager{
+		logger: log.NewLogfmtLogger(logs),
+		cfgs:   map[string]alertspb.AlertConfigDesc{},
+	}
+
+	_, err := am.migrateConfig("user-1", testLegacyConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(logs.String(), "migrated the Alertmanager configuration"))
+
+	// The config polled again is unchanged.
+	am.cfgs["user-1"] = alertspb.AlertConfigDesc{User: "user-1", RawConfig: testLegacyConfig}
+	_, err = am.migrateConfig("user-1", testLegacyConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(logs.String(), "migrated the Alertmanager configuration"))
+
+	// The config has changed.
+	_, err = am.migrateConfig("user-1", "cortex_config_version: 2\n"+testLegacyConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(logs.String(), "migrated the Alertmanager configuration"))
+}
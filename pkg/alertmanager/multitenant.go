@@ -39,6 +39,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 const (
@@ -75,6 +76,7 @@ type MultitenantAlertmanagerConfig struct {
 	ShardingRing    RingConfig `yaml:"sharding_ring"`
 
 	FallbackConfigFile string `yaml:"fallback_config_file"`
+	BaseConfigFile     string `yaml:"base_config_file"`
 	AutoWebhookRoot    string `yaml:"auto_webhook_root"`
 
 	Cluster ClusterConfig `yaml:"cluster"`
@@ -83,6 +85,8 @@ type MultitenantAlertmanagerConfig struct {
 	APIConcurrency int           `yaml:"api_concurrency"`
 	GCInterval     time.Duration `yaml:"gc_interval"`
 
+	NotificationRetryBackoff validation.NotificationRetryBackoffMap `yaml:"notification_retry_backoff"`
+
 	// For distributor.
 	AlertmanagerClient ClientConfig `yaml:"alertmanager_client"`
 
@@ -116,12 +120,15 @@ func (cfg *MultitenantAlertmanagerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&cfg.ExternalURL, "alertmanager.web.external-url", "The URL under which Alertmanager is externally reachable (for example, if Alertmanager is served via a reverse proxy). Used for generating relative and absolute links back to Alertmanager itself. If the URL has a path portion, it will be used to prefix all HTTP endpoints served by Alertmanager. If omitted, relevant URL components will be derived automatically.")
 
 	f.StringVar(&cfg.FallbackConfigFile, "alertmanager.configs.fallback", "", "Filename of fallback config to use if none specified for instance.")
+	f.StringVar(&cfg.BaseConfigFile, "alertmanager.configs.base", "", "[Experimental] Filename of the base config merged with each tenant config. The tenant config takes precedence over the base one: global settings are merged, receivers and time intervals are merged by name, and the base inhibition rules and child routes are appended to the tenant ones.")
 	f.StringVar(&cfg.AutoWebhookRoot, "alertmanager.configs.auto-webhook-root", "", "Root of URL to generate if config is "+autoWebhookURL)
 	f.DurationVar(&cfg.PollInterval, "alertmanager.configs.poll-interval", 15*time.Second, "How frequently to poll Cortex configs")
 
 	f.BoolVar(&cfg.EnableAPI, "experimental.alertmanager.enable-api", false, "Enable the experimental alertmanager config api.")
 	f.IntVar(&cfg.APIConcurrency, "alertmanager.api-concurrency", 0, "Maximum number of concurrent GET API requests before returning an error.")
 	f.DurationVar(&cfg.GCInterval, "alertmanager.alerts-gc-interval", 30*time.Minute, "Alertmanager alerts Garbage collection interval.")
+	cfg.NotificationRetryBackoff = validation.NotificationRetryBackoffMap{}
+	f.Var(&cfg.NotificationRetryBackoff, "alertmanager.notification-retry-backoff", `[Experimental] Per-integration exponential backoff between the retries of a failed notification, as a JSON object, for example {"email": {"base": "1m", "max": "10m", "multiplier": 2}}. Each retry waits base * multiplier^retry, capped to max. Integrations not listed use the default Alertmanager retry backoff.`)
 	f.BoolVar(&cfg.ShardingEnabled, "alertmanager.sharding-enabled", false, "Shard tenants across multiple alertmanager instances.")
 	f.Var(&cfg.EnabledTenants, "alertmanager.enabled-tenants", "Comma separated list of tenants whose alerts this alertmanager can process. If specified, only these tenants will be handled by alertmanager, otherwise this alertmanager can process alerts from all tenants.")
 	f.Var(&cfg.DisabledTenants, "alertmanager.disabled-tenants", "Comma separated list of tenants whose alerts this alertmanager cannot process. If specified, a alertmanager that would normally pick the specified tenant(s) for processing will ignore them instead.")
@@ -228,6 +235,28 @@ type Limits interface {
 	// AlertmanagerMaxAlertsSizeBytes returns total max size of alerts that tenant can have active at the same time. 0 = no limit.
 	// Size of the alert is computed from alert labels, annotations and generator URL.
 	AlertmanagerMaxAlertsSizeBytes(tenant string) int
+
+	// AlertmanagerMaxConcurrentNotifications returns max number of notifications that tenant can have in-flight at the same time,
+	// across all its integrations. Exceeding notifications are queued. 0 = no limit.
+	AlertmanagerMaxConcurrentNotifications(tenant string) int
+
+	// AlertmanagerTemplateExecutionTimeout returns max time the execution of the templates of a notification
+	// can take, before the notification is failed. 0 = no limit.
+	AlertmanagerTemplateExecutionTimeout(tenant string) time.Duration
+
+	// AlertmanagerTemplateMaxOutputSizeBytes returns max size of the output of a single template executed for
+	// a notification. 0 = no limit.
+	AlertmanagerTemplateMaxOutputSizeBytes(tenant string) int
+
+	// AlertmanagerMaxLabelSetsPerAlertName returns max number of distinct label sets that tenant can send for
+	// a single alert name within the window returned by AlertmanagerLabelSetsWindow. 0 = no limit.
+	AlertmanagerMaxLabelSetsPerAlertName(tenant string) int
+
+	// AlertmanagerLabelSetsWindow returns the sliding window over which the distinct label sets of an alert name are counted.
+	AlertmanagerLabelSetsWindow(tenant string) time.Duration
+
+	// AlertmanagerMaxActiveAlerts returns max number of active alerts, not counting the resolved ones, that tenant can have. 0 = no limit.
+	AlertmanagerMaxActiveAlerts(tenant string) int
 }
 
 // A MultitenantAlertmanager manages Alertmanager instances for multiple
@@ -263,6 +292,9 @@ type MultitenantAlertmanager struct {
 	// effect here.
 	fallbackConfig string
 
+	// The base config merged with every tenant config, stored as a string for the same reason.
+	baseConfig string
+
 	alertmanagersMtx sync.Mutex
 	alertmanagers    map[string]*Alertmanager
 	// Stores the current set of configurations we're running in each tenant's Alertmanager.
@@ -311,6 +343,17 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, store alerts
 		}
 	}
 
+	var baseConfig []byte
+	if cfg.BaseConfigFile != "" {
+		baseConfig, err = os.ReadFile(cfg.BaseConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read base config %q: %s", cfg.BaseConfigFile, err)
+		}
+		if _, err = mergeBaseConfig(string(baseConfig), ""); err != nil {
+			return nil, fmt.Errorf("unable to load base config %q: %s", cfg.BaseConfigFile, err)
+		}
+	}
+
 	var peer *cluster.Peer
 	// We need to take this case into account to support our legacy upstream clustering.
 	if cfg.Cluster.ListenAddr != "" && !cfg.ShardingEnabled {
@@ -355,7 +398,12 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, store alerts
 		}
 	}
 
-	return createMultitenantAlertmanager(cfg, fallbackConfig, peer, store, ringStore, limits, logger, registerer)
+	am, err := createMultitenantAlertmanager(cfg, fallbackConfig, peer, store, ringStore, limits, logger, registerer)
+	if err != nil {
+		return nil, err
+	}
+	am.baseConfig = string(baseConfig)
+	return am, nil
 }
 
 func createMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, fallbackConfig []byte, peer *cluster.Peer, store alertstore.AlertStore, ringStore kv.Client, limits Limits, logger log.Logger, registerer prometheus.Registerer) (*MultitenantAlertmanager, error) {
@@ -889,13 +937,24 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 			return fmt.Errorf("blank Alertmanager configuration for %v", cfg.User)
 		}
 		level.Debug(am.logger).Log("msg", "blank Alertmanager configuration; using fallback", "user", cfg.User)
-		userAmConfig, err = amconfig.Load(am.fallbackConfig)
+		rawCfg, err = am.withBaseConfig(am.fallbackConfig)
+		if err != nil {
+			return fmt.Errorf("unable to merge the base configuration with the fallback configuration for %v: %v", cfg.User, err)
+		}
+		userAmConfig, err = loadConfig(rawCfg)
 		if err != nil {
 			return fmt.Errorf("unable to load fallback configuration for %v: %v", cfg.User, err)
 		}
-		rawCfg = am.fallbackConfig
 	} else {
-		userAmConfig, err = amconfig.Load(cfg.RawConfig)
+		rawCfg, err = am.migrateConfig(cfg.User, cfg.RawConfig)
+		if err != nil {
+			return fmt.Errorf("unable to migrate the configuration for %v: %v", cfg.User, err)
+		}
+		rawCfg, err = am.withBaseConfig(rawCfg)
+		if err != nil {
+			return fmt.Errorf("unable to merge the base configuration with the configuration for %v: %v", cfg.User, err)
+		}
+		userAmConfig, err = loadConfig(rawCfg)
 		if err != nil && hasExisting {
 			// This means that if a user has a working config and
 			// they submit a broken one, the Manager will keep running the last known
@@ -978,6 +1037,8 @@ func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amco
 		Limits:            am.limits,
 		APIConcurrency:    am.cfg.APIConcurrency,
 		GCInterval:        am.cfg.GCInterval,
+
+		NotificationRetryBackoff: am.cfg.NotificationRetryBackoff,
 	}, reg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to start Alertmanager for user %v: %v", userID, err)
@@ -2219,6 +2219,12 @@ type mockAlertManagerLimits struct {
 	maxDispatcherAggregationGroups int
 	maxAlertsCount                 int
 	maxAlertsSizeBytes             int
+	maxConcurrentNotifications     int
+	templateMaxOutputSizeBytes     int
+	templateExecutionTimeout       time.Duration
+	maxLabelSetsPerAlertName       int
+	labelSetsWindow                time.Duration
+	maxActiveAlerts                int
 }
 
 func (m *mockAlertManagerLimits) AlertmanagerMaxConfigSize(tenant string) int {
@@ -2260,3 +2266,27 @@ func (m *mockAlertManagerLimits) AlertmanagerMaxAlertsCount(_ string) int {
 func (m *mockAlertManagerLimits) AlertmanagerMaxAlertsSizeBytes(_ string) int {
 	return m.maxAlertsSizeBytes
 }
+
+func (m *mockAlertManagerLimits) AlertmanagerMaxConcurrentNotifications(_ string) int {
+	return m.maxConcurrentNotifications
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerTemplateExecutionTimeout(_ string) time.Duration {
+	return m.templateExecutionTimeout
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerTemplateMaxOutputSizeBytes(_ string) int {
+	return m.templateMaxOutputSizeBytes
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerMaxLabelSetsPerAlertName(_ string) int {
+	return m.maxLabelSetsPerAlertName
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerLabelSetsWindow(_ string) time.Duration {
+	return m.labelSetsWindow
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerMaxActiveAlerts(_ string) int {
+	return m.maxActiveAlerts
+}
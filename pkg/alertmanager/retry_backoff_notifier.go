@@ -0,0 +1,53 @@
+package alertmanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// retryBackoffNotifier retries the failed notifications with the configured backoff, instead
+// of leaving them to the fixed backoff of the Alertmanager retry stage. Retries continue
+// until the notification succeeds, fails with a non-retryable error, or the context is done.
+type retryBackoffNotifier struct {
+	upstream notify.Notifier
+	backoff  validation.NotificationRetryBackoff
+	logger   log.Logger
+
+	// Replaced in tests.
+	after func(time.Duration) <-chan time.Time
+}
+
+func newRetryBackoffNotifier(upstream notify.Notifier, backoff validation.NotificationRetryBackoff, logger log.Logger) *retryBackoffNotifier {
+	return &retryBackoffNotifier{
+		upstream: upstream,
+		backoff:  backoff,
+		logger:   logger,
+		after:    time.After,
+	}
+}
+
+func (n *retryBackoffNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	for retry := 0; ; retry++ {
+		shouldRetry, err := n.upstream.Notify(ctx, alerts...)
+		if err == nil || !shouldRetry {
+			return shouldRetry, err
+		}
+
+		delay := n.backoff.Delay(retry)
+		level.Debug(n.logger).Log("msg", "notification failed, retrying", "attempt", retry+1, "backoff", delay, "err", err)
+
+		select {
+		case <-n.after(delay):
+		case <-ctx.Done():
+			// Let the Alertmanager retry stage report the failure.
+			return shouldRetry, err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestRetryBackoffNotifier_ShouldBackoffPerIntegration(t *testing.T) {
+	backoffs := validation.NotificationRetryBackoffMap{
+		"email":   {Base: model.Duration(time.Minute), Max: model.Duration(5 * time.Minute), Multiplier: 2},
+		"webhook": {Base: model.Duration(100 * time.Millisecond), Max: model.Duration(time.Second), Multiplier: 3},
+	}
+
+	tests := map[string]struct {
+		integration    string
+		expectedDelays []time.Duration
+	}{
+		"email": {
+			integration:    "email",
+			expectedDelays: []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute},
+		},
+		"webhook": {
+			integration:    "webhook",
+			expectedDelays: []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second},
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The notification fails for as many times as the expected delays, then succeeds.
+			attempts := 0
+			upstream := notifierFunc(func(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+				attempts++
+				if attempts <= len(testData.expectedDelays) {
+					return true, errors.New("failed")
+				}
+				return false, nil
+			})
+
+			notifier := newRetryBackoffNotifier(upstream, backoffs[testData.integration], log.NewNopLogger())
+
+			var delays []time.Duration
+			notifier.after = func(d time.Duration) <-chan time.Time {
+				delays = append(delays, d)
+				ch := make(chan time.Time, 1)
+				ch <- time.Now()
+				return ch
+			}
+
+			retry, err := notifier.Notify(context.Background())
+			require.NoError(t, err)
+			assert.False(t, retry)
+			assert.Equal(t, testData.expectedDelays, delays)
+			assert.Equal(t, len(testData.expectedDelays)+1, attempts)
+		})
+	}
+}
+
+func TestRetryBackoffNotifier_ShouldWaitTheBackoff(t *testing.T) {
+	attempts := []time.Time{}
+	upstream := notifierFunc(func(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 3 {
+			return true, errors.New("failed")
+		}
+		return false, nil
+	})
+
+	backoff := validation.NotificationRetryBackoff{Base: model.Duration(100 * time.Millisecond), Max: model.Duration(time.Second), Multiplier: 2}
+	_, err := newRetryBackoffNotifier(upstream, backoff, log.NewNopLogger()).Notify(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, attempts, 3)
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 100*time.Millisecond)
+	assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), 200*time.Millisecond)
+}
+
+func TestRetryBackoffNotifier_ShouldNotRetryNonRetryableErrors(t *testing.T) {
+	attempts := 0
+	upstream := notifierFunc(func(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+		attempts++
+		return false, errors.New("failed")
+	})
+
+	backoff := validation.NotificationRetryBackoff{Base: model.Duration(time.Millisecond), Max: model.Duration(time.Millisecond), Multiplier: 1}
+	retry, err := newRetryBackoffNotifier(upstream, backoff, log.NewNopLogger()).Notify(context.Background())
+	assert.Error(t, err)
+	assert.False(t, retry)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryBackoffNotifier_ShouldStopRetryingOnContextCancellation(t *testing.T) {
+	upstream := notifierFunc(func(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+		return true, errors.New("failed")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	backoff := validation.NotificationRetryBackoff{Base: model.Duration(time.Minute), Max: model.Duration(time.Minute), Multiplier: 1}
+	retry, err := newRetryBackoffNotifier(upstream, backoff, log.NewNopLogger()).Notify(ctx)
+	assert.EqualError(t, err, "failed")
+	assert.True(t, retry)
+}
+
+type notifierFunc func(ctx context.Context, alerts ...*types.Alert) (bool, error)
+
+func (f notifierFunc) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	return f(ctx, alerts...)
+}
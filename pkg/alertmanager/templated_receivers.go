@@ -0,0 +1,218 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	tmpltext "text/template"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"gopkg.in/yaml.v2"
+)
+
+// templatedReceiversKey is the top-level key of the tenant Alertmanager config holding the
+// templated receivers. It's removed from the config before loading it.
+const templatedReceiversKey = "cortex_templated_receivers"
+
+// templatedReceiverConfig configures a receiver which notifies one of the candidate receivers,
+// selected by the routing key rendered from the template for each alerts group. The routes
+// refer to a templated receiver like to any other receiver.
+type templatedReceiverConfig struct {
+	Name string `yaml:"name"`
+	// Template of the routing key, rendered with the same data as the notification templates.
+	RoutingKey string `yaml:"routing_key"`
+	// Receivers which can be selected by the routing key, matched by name.
+	Receivers []string `yaml:"receivers"`
+	// Receiver notified if the routing key doesn't match any candidate receiver.
+	DefaultReceiver string `yaml:"default_receiver"`
+}
+
+// extractTemplatedReceivers removes the templated receivers from the tenant Alertmanager config,
+// adding a receiver without integrations in place of each of them, so that the routes referring
+// to them are valid. The config is returned untouched if it has no templated receivers.
+func extractTemplatedReceivers(rawCfg string) (string, []templatedReceiverConfig, error) {
+	cfg := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(rawCfg), &cfg); err != nil {
+		return rawCfg, nil, nil
+	}
+
+	value, ok := cfg[templatedReceiversKey]
+	if !ok {
+		return rawCfg, nil, nil
+	}
+	delete(cfg, templatedReceiversKey)
+
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+	var templated []templatedReceiverConfig
+	if err := yaml.UnmarshalStrict(out, &templated); err != nil {
+		return "", nil, fmt.Errorf("invalid %s: %w", templatedReceiversKey, err)
+	}
+
+	receivers, _ := cfg["receivers"].([]interface{})
+	for _, r := range templated {
+		receivers = append(receivers, map[interface{}]interface{}{"name": r.Name})
+	}
+	cfg["receivers"] = receivers
+
+	out, err = yaml.Marshal(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(out), templated, nil
+}
+
+// loadConfig loads the tenant Alertmanager config, including the templated receivers.
+func loadConfig(rawCfg string) (*config.Config, error) {
+	rawCfg, templated, err := extractTemplatedReceivers(rawCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.Load(rawCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateTemplatedReceivers(cfg, templated); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validateTemplatedReceivers validates the templated receivers, ensuring all the receivers they
+// can resolve to exist. The templated receivers have been added to the config receivers.
+func validateTemplatedReceivers(cfg *config.Config, templated []templatedReceiverConfig) error {
+	templatedNames := make(map[string]struct{}, len(templated))
+	for _, r := range templated {
+		if _, ok := templatedNames[r.Name]; ok {
+			return fmt.Errorf("templated receiver %q is defined more than once", r.Name)
+		}
+		templatedNames[r.Name] = struct{}{}
+	}
+
+	// A templated receiver named like another receiver already failed loading the config, since
+	// the receiver names must be unique.
+	receiverNames := make(map[string]struct{}, len(cfg.Receivers))
+	for _, r := range cfg.Receivers {
+		receiverNames[r.Name] = struct{}{}
+	}
+
+	checkReceiver := func(templatedName, name string) error {
+		if _, ok := templatedNames[name]; ok {
+			return fmt.Errorf("templated receiver %q can't resolve to the templated receiver %q", templatedName, name)
+		}
+		if _, ok := receiverNames[name]; !ok {
+			return fmt.Errorf("templated receiver %q resolves to the undefined receiver %q", templatedName, name)
+		}
+		return nil
+	}
+
+	for _, r := range templated {
+		if r.RoutingKey == "" {
+			return fmt.Errorf("templated receiver %q has no routing key", r.Name)
+		}
+		if _, err := tmpltext.New("").Funcs(tmpltext.FuncMap(template.DefaultFuncs)).Parse(r.RoutingKey); err != nil {
+			return fmt.Errorf("invalid routing key of the templated receiver %q: %w", r.Name, err)
+		}
+		if r.DefaultReceiver == "" {
+			return fmt.Errorf("templated receiver %q has no default receiver", r.Name)
+		}
+		if err := checkReceiver(r.Name, r.DefaultReceiver); err != nil {
+			return err
+		}
+		for _, name := range r.Receivers {
+			if err := checkReceiver(r.Name, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// templatedReceiverStageName returns the name of the pipeline stage notifying the receiver on
+// behalf of the templated receiver.
+func templatedReceiverStageName(templated, receiver string) string {
+	return fmt.Sprintf("%s/%s/%s", templatedReceiversKey, templated, receiver)
+}
+
+// buildTemplatedReceiversIntegrations adds to the integrations map, for each receiver a templated
+// receiver can resolve to, a receiver with its integrations, named by templatedReceiverStageName(),
+// so that the pipeline has a stage notifying the receiver on behalf of the templated receiver. This
+// way the notifications log and the retries are kept separate from the ones of the receiver itself.
+// It returns the resolvers of the templated receivers, by templated receiver.
+func buildTemplatedReceiversIntegrations(integrationsMap map[string][]notify.Integration, templated []templatedReceiverConfig, tmpl *template.Template, logger log.Logger) map[string]*templatedReceiverResolver {
+	resolvers := make(map[string]*templatedReceiverResolver, len(templated))
+	for _, r := range templated {
+		resolvers[r.Name] = &templatedReceiverResolver{cfg: r, tmpl: tmpl, logger: log.With(logger, "templated_receiver", r.Name)}
+
+		for _, name := range append([]string{r.DefaultReceiver}, r.Receivers...) {
+			integrationsMap[templatedReceiverStageName(r.Name, name)] = integrationsMap[name]
+		}
+	}
+	return resolvers
+}
+
+// templatedReceiversStage routes the alerts groups of the templated receivers to the pipeline stage
+// of the receiver resolved for each alerts group, so that only its integrations are notified. The
+// alerts groups of the other receivers are routed as usual.
+type templatedReceiversStage struct {
+	routing   notify.RoutingStage
+	resolvers map[string]*templatedReceiverResolver
+}
+
+func newTemplatedReceiversStage(routing notify.RoutingStage, resolvers map[string]*templatedReceiverResolver) notify.Stage {
+	if len(resolvers) == 0 {
+		return routing
+	}
+	return &templatedReceiversStage{routing: routing, resolvers: resolvers}
+}
+
+// Exec implements notify.Stage.
+func (s *templatedReceiversStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	receiver, ok := notify.ReceiverName(ctx)
+	if !ok {
+		return s.routing.Exec(ctx, l, alerts...)
+	}
+	resolver, ok := s.resolvers[receiver]
+	if !ok {
+		return s.routing.Exec(ctx, l, alerts...)
+	}
+
+	stage, ok := s.routing[templatedReceiverStageName(receiver, resolver.resolve(ctx, alerts))]
+	if !ok {
+		return ctx, nil, fmt.Errorf("stage for the receiver resolved by the templated receiver %s missing", receiver)
+	}
+	return stage.Exec(ctx, l, alerts...)
+}
+
+// templatedReceiverResolver resolves the receiver notified by a templated receiver.
+type templatedReceiverResolver struct {
+	cfg    templatedReceiverConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// resolve returns the receiver matching the routing key rendered for the alerts group, or the
+// default receiver if none matches.
+func (r *templatedReceiverResolver) resolve(ctx context.Context, alerts []*types.Alert) string {
+	data := notify.GetTemplateData(ctx, r.tmpl, alerts, r.logger)
+	key, err := r.tmpl.ExecuteTextString(r.cfg.RoutingKey, data)
+	if err != nil {
+		level.Warn(r.logger).Log("msg", "failed to render the routing key, notifying the default receiver", "err", err)
+		return r.cfg.DefaultReceiver
+	}
+
+	for _, name := range r.cfg.Receivers {
+		if name == key {
+			return name
+		}
+	}
+	return r.cfg.DefaultReceiver
+}
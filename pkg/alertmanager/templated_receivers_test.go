@@ -0,0 +1,216 @@
+package alertmanager
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_TemplatedReceivers(t *testing.T) {
+	const receivers = `
+receivers:
+  - name: team-a
+  - name: team-b
+  - name: ops
+`
+
+	for name, tc := range map[string]struct {
+		templated   string
+		expectedErr string
+	}{
+		"valid templated receiver": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_key: '{{ .GroupLabels.team }}'
+    receivers: [team-a, team-b]
+    default_receiver: ops
+`,
+		},
+		"undefined candidate receiver": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_key: '{{ .GroupLabels.team }}'
+    receivers: [team-a, team-c]
+    default_receiver: ops
+`,
+			expectedErr: `templated receiver "by-team" resolves to the undefined receiver "team-c"`,
+		},
+		"undefined default receiver": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_key: '{{ .GroupLabels.team }}'
+    receivers: [team-a]
+    default_receiver: unknown
+`,
+			expectedErr: `templated receiver "by-team" resolves to the undefined receiver "unknown"`,
+		},
+		"missing default receiver": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_key: '{{ .GroupLabels.team }}'
+    receivers: [team-a]
+`,
+			expectedErr: `templated receiver "by-team" has no default receiver`,
+		},
+		"resolving to a templated receiver": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_key: '{{ .GroupLabels.team }}'
+    receivers: [by-cluster]
+    default_receiver: ops
+  - name: by-cluster
+    routing_key: '{{ .GroupLabels.cluster }}'
+    receivers: [team-a]
+    default_receiver: ops
+`,
+			expectedErr: `templated receiver "by-team" can't resolve to the templated receiver "by-cluster"`,
+		},
+		"missing routing key": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    receivers: [team-a]
+    default_receiver: ops
+`,
+			expectedErr: `templated receiver "by-team" has no routing key`,
+		},
+		"invalid routing key": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_key: '{{ .GroupLabels.team'
+    receivers: [team-a]
+    default_receiver: ops
+`,
+			expectedErr: `invalid routing key of the templated receiver "by-team"`,
+		},
+		"templated receiver named like a receiver": {
+			templated: `
+cortex_templated_receivers:
+  - name: ops
+    routing_key: '{{ .GroupLabels.team }}'
+    receivers: [team-a]
+    default_receiver: team-b
+`,
+			expectedErr: `notification config name "ops" is not unique`,
+		},
+		"unknown setting": {
+			templated: `
+cortex_templated_receivers:
+  - name: by-team
+    routing_keys: '{{ .GroupLabels.team }}'
+`,
+			expectedErr: "invalid cortex_templated_receivers",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := loadConfig(receivers + tc.templated + `
+route:
+  receiver: by-team
+`)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "by-team", cfg.Route.Receiver)
+			assert.Equal(t, "by-team", cfg.Receivers[len(cfg.Receivers)-1].Name)
+		})
+	}
+}
+
+func TestBuildTemplatedReceiversIntegrations(t *testing.T) {
+	integration := func(receiver, name string, idx int) notify.Integration {
+		n := notifierFunc(func(context.Context, ...*types.Alert) (bool, error) { return false, nil })
+		return notify.NewIntegration(n, sendResolved(true), name, idx, receiver)
+	}
+
+	integrationsMap := map[string][]notify.Integration{
+		"team-a":  {integration("team-a", "webhook", 0), integration("team-a", "webhook", 1)},
+		"team-b":  {integration("team-b", "webhook", 0)},
+		"ops":     {integration("ops", "email", 0)},
+		"by-team": nil,
+	}
+	resolvers := buildTemplatedReceiversIntegrations(integrationsMap, []templatedReceiverConfig{{
+		Name:            "by-team",
+		RoutingKey:      "team-{{ .GroupLabels.team }}",
+		Receivers:       []string{"team-a", "team-b"},
+		DefaultReceiver: "ops",
+	}}, nil, log.NewNopLogger())
+
+	// Each receiver the templated receiver can resolve to gets its own stage, with its integrations.
+	assert.Len(t, resolvers, 1)
+	assert.Len(t, integrationsMap, 7)
+	for _, name := range []string{"team-a", "team-b", "ops"} {
+		assert.Equal(t, integrationsMap[name], integrationsMap[templatedReceiverStageName("by-team", name)])
+	}
+	assert.Empty(t, integrationsMap["by-team"])
+}
+
+func TestTemplatedReceiversStage(t *testing.T) {
+	tmpl, err := template.FromGlobs(nil)
+	require.NoError(t, err)
+	tmpl.ExternalURL = &url.URL{}
+
+	// Only the stage of the resolved receiver is executed, so that the integrations of the other
+	// receivers don't record the alerts group as notified in the notifications log.
+	var executed []string
+	routing := notify.RoutingStage{}
+	for _, name := range []string{"other", templatedReceiverStageName("by-team", "team-a"), templatedReceiverStageName("by-team", "team-b"), templatedReceiverStageName("by-team", "ops")} {
+		name := name
+		routing[name] = notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			executed = append(executed, name)
+			return ctx, alerts, nil
+		})
+	}
+
+	stage := newTemplatedReceiversStage(routing, map[string]*templatedReceiverResolver{
+		"by-team": {
+			cfg: templatedReceiverConfig{
+				Name:            "by-team",
+				RoutingKey:      "team-{{ .GroupLabels.team }}",
+				Receivers:       []string{"team-a", "team-b"},
+				DefaultReceiver: "ops",
+			},
+			tmpl:   tmpl,
+			logger: log.NewNopLogger(),
+		},
+	})
+
+	notifyTeam := func(receiver, team string) []string {
+		executed = nil
+		ctx := notify.WithReceiverName(context.Background(), receiver)
+		ctx = notify.WithGroupLabels(ctx, model.LabelSet{"team": model.LabelValue(team)})
+		_, _, err := stage.Exec(ctx, log.NewNopLogger(), &types.Alert{})
+		require.NoError(t, err)
+		return executed
+	}
+
+	assert.Equal(t, []string{templatedReceiverStageName("by-team", "team-a")}, notifyTeam("by-team", "a"))
+	assert.Equal(t, []string{templatedReceiverStageName("by-team", "team-b")}, notifyTeam("by-team", "b"))
+
+	// The default receiver is notified if the routing key doesn't match any receiver.
+	assert.Equal(t, []string{templatedReceiverStageName("by-team", "ops")}, notifyTeam("by-team", "c"))
+
+	// The other receivers are routed as usual.
+	assert.Equal(t, []string{"other"}, notifyTeam("other", "a"))
+}
+
+type sendResolved bool
+
+func (s sendResolved) SendResolved() bool { return bool(s) }
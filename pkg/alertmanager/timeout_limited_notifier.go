@@ -0,0 +1,169 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	tmplhtml "html/template"
+	"reflect"
+	"strings"
+	tmpltext "text/template"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type templateLimits interface {
+	TemplateExecutionTimeout() time.Duration
+	TemplateMaxOutputSizeBytes() int
+}
+
+// timeoutLimitedNotifier executes the templates of an integration under the tenant's template limits
+// before notifying. Go templates can't be interrupted, so the templates are rendered by the caller through
+// a writer which fails the execution at the first write after the timeout expired or once the output
+// exceeds the max size. Only when all templates are rendered within the limits the upstream notifier is called,
+// so the time spent by the receiver isn't accounted to the templates.
+type timeoutLimitedNotifier struct {
+	upstream  notify.Notifier
+	tmpl      *template.Template
+	text      *tmpltext.Template
+	templates []string
+	limits    templateLimits
+	logger    log.Logger
+	counter   prometheus.Counter
+}
+
+// newTimeoutLimitedNotifier returns a notifier limiting the execution of the templates found in the
+// integration config. The text template is the one parsed into tmpl, see captureTextTemplate().
+func newTimeoutLimitedNotifier(upstream notify.Notifier, tmpl *template.Template, text *tmpltext.Template, integrationConfig interface{}, limits templateLimits, logger log.Logger, counter prometheus.Counter) *timeoutLimitedNotifier {
+	return &timeoutLimitedNotifier{
+		upstream:  upstream,
+		tmpl:      tmpl,
+		text:      text,
+		templates: findTemplates(reflect.ValueOf(integrationConfig), nil),
+		limits:    limits,
+		logger:    logger,
+		counter:   counter,
+	}
+}
+
+var (
+	errTemplateExecutionTimeout = errors.New("failed to notify due to template execution timeout")
+	errTemplateOutputTooLarge   = errors.New("failed to notify because the template output exceeds the max size")
+)
+
+func (t *timeoutLimitedNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	timeout := t.limits.TemplateExecutionTimeout()
+	maxSize := t.limits.TemplateMaxOutputSizeBytes()
+	if (timeout <= 0 && maxSize <= 0) || len(t.templates) == 0 {
+		return t.upstream.Notify(ctx, alerts...)
+	}
+
+	execCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// The templates are executed by the caller, so that a timed out execution doesn't keep running
+	// in the background: it's aborted at its first write after the timeout.
+	err := t.executeTemplates(execCtx, notify.GetTemplateData(ctx, t.tmpl, alerts, t.logger), maxSize)
+
+	switch {
+	case err == nil:
+		return t.upstream.Notify(ctx, alerts...)
+	case ctx.Err() != nil:
+		// The notification has been canceled by the caller, not by the timeout.
+		return false, ctx.Err()
+	case errors.Is(err, errTemplateExecutionTimeout):
+		t.counter.Inc()
+		level.Warn(t.logger).Log("msg", "notification has been failed because it exceeded the template execution timeout", "timeout", timeout, "alerts", len(alerts))
+		// Retrying would execute the same templates against the same alerts again.
+		return false, errTemplateExecutionTimeout
+	case errors.Is(err, errTemplateOutputTooLarge):
+		level.Warn(t.logger).Log("msg", "notification has been failed because the template output exceeded the max size", "max_size_bytes", maxSize, "alerts", len(alerts))
+		return false, errTemplateOutputTooLarge
+	default:
+		// Template errors are reported by the upstream notifier, which executes the same templates.
+		return t.upstream.Notify(ctx, alerts...)
+	}
+}
+
+func (t *timeoutLimitedNotifier) executeTemplates(ctx context.Context, data *template.Data, maxSize int) error {
+	for _, text := range t.templates {
+		tmpl, err := t.text.Clone()
+		if err != nil {
+			return err
+		}
+		tmpl, err = tmpl.New("").Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return err
+		}
+		// The text/template package returns the writer errors as is.
+		if err := tmpl.Execute(&limitedTemplateWriter{ctx: ctx, maxSize: maxSize}, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedTemplateWriter discards the template output, failing the template execution once the context
+// is done or the output exceeds the max size.
+type limitedTemplateWriter struct {
+	ctx     context.Context
+	maxSize int
+	written int
+}
+
+func (w *limitedTemplateWriter) Write(p []byte) (int, error) {
+	if w.ctx.Err() != nil {
+		return 0, errTemplateExecutionTimeout
+	}
+	w.written += len(p)
+	if w.maxSize > 0 && w.written > w.maxSize {
+		return 0, errTemplateOutputTooLarge
+	}
+	return len(p), nil
+}
+
+// captureTextTemplate returns a template option storing the text template used by the Alertmanager template.
+func captureTextTemplate(text **tmpltext.Template) template.Option {
+	return func(t *tmpltext.Template, _ *tmplhtml.Template) {
+		*text = t
+	}
+}
+
+// findTemplates returns the string fields of the integration config which contain a template.
+func findTemplates(v reflect.Value, templates []string) []string {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			templates = findTemplates(v.Elem(), templates)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				templates = findTemplates(v.Field(i), templates)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			templates = findTemplates(v.Index(i), templates)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			templates = findTemplates(iter.Value(), templates)
+		}
+	case reflect.String:
+		if strings.Contains(v.String(), "{{") {
+			templates = append(templates, v.String())
+		}
+	}
+	return templates
+}
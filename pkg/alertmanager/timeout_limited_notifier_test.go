@@ -0,0 +1,144 @@
+package alertmanager
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+	tmpltext "text/template"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const expensiveTemplate = `{{ range .Alerts }}{{ range $.Alerts }}{{ range $.Alerts }}x{{ end }}{{ end }}{{ end }}`
+
+func TestTimeoutLimitedNotifier(t *testing.T) {
+	tmpl, text := newTestTemplate(t)
+	alerts := make([]*types.Alert, 1000)
+	for i := range alerts {
+		alerts[i] = &types.Alert{}
+	}
+
+	tests := map[string]struct {
+		template       string
+		upstream       notify.Notifier
+		limits         *templateLimitsMock
+		expectedRetry  bool
+		expectedErr    error
+		expectedTimout float64
+	}{
+		"templates executed within the limits": {
+			template: `{{ len .Alerts }} alerts`,
+			upstream: &mockNotifier{},
+			limits:   &templateLimitsMock{timeout: time.Second, maxSize: 100},
+		},
+		"expensive template is failed once the timeout expires and not retried": {
+			template:       expensiveTemplate,
+			upstream:       &mockNotifier{},
+			limits:         &templateLimitsMock{timeout: 100 * time.Millisecond},
+			expectedErr:    errTemplateExecutionTimeout,
+			expectedTimout: 1,
+		},
+		"time spent by the receiver is not accounted to the templates": {
+			template: `{{ len .Alerts }} alerts`,
+			upstream: &slowNotifier{delay: 200 * time.Millisecond},
+			limits:   &templateLimitsMock{timeout: 50 * time.Millisecond},
+		},
+		"template output exceeding the max size is failed and not retried": {
+			template:    `{{ range .Alerts }}xxxxxxxxxx{{ end }}`,
+			upstream:    &mockNotifier{},
+			limits:      &templateLimitsMock{maxSize: 1000},
+			expectedErr: errTemplateOutputTooLarge,
+		},
+		"limits disabled": {
+			template: expensiveTemplate,
+			upstream: &mockNotifier{},
+			limits:   &templateLimitsMock{},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			counter := prometheus.NewCounter(prometheus.CounterOpts{})
+			cfg := &config.SlackConfig{Title: testData.template}
+
+			notifier := newTimeoutLimitedNotifier(testData.upstream, tmpl, text, cfg, testData.limits, log.NewNopLogger(), counter)
+			retry, err := notifier.Notify(context.Background(), alerts...)
+			assert.Equal(t, testData.expectedErr, err)
+			assert.Equal(t, testData.expectedRetry, retry)
+			assert.Equal(t, testData.expectedTimout, testutil.ToFloat64(counter))
+		})
+	}
+}
+
+func TestTimeoutLimitedNotifier_ShouldNotCountCallerCancellation(t *testing.T) {
+	tmpl, text := newTestTemplate(t)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{})
+	cfg := &config.SlackConfig{Title: expensiveTemplate}
+	alerts := make([]*types.Alert, 1000)
+	for i := range alerts {
+		alerts[i] = &types.Alert{}
+	}
+
+	notifier := newTimeoutLimitedNotifier(&mockNotifier{}, tmpl, text, cfg, &templateLimitsMock{timeout: time.Minute}, log.NewNopLogger(), counter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := notifier.Notify(ctx, alerts...)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0.0, testutil.ToFloat64(counter))
+}
+
+func TestFindTemplates(t *testing.T) {
+	cfg := &config.SlackConfig{
+		Channel: "alerts",
+		Title:   `{{ template "slack.default.title" . }}`,
+		Fields: []*config.SlackField{
+			{Title: "static", Value: `{{ .CommonLabels.job }}`},
+		},
+	}
+
+	assert.ElementsMatch(t, []string{`{{ template "slack.default.title" . }}`, `{{ .CommonLabels.job }}`}, findTemplates(reflect.ValueOf(cfg), nil))
+}
+
+func newTestTemplate(t *testing.T) (*template.Template, *tmpltext.Template) {
+	var text *tmpltext.Template
+	tmpl, err := template.FromGlobs(nil, captureTextTemplate(&text))
+	require.NoError(t, err)
+	tmpl.ExternalURL, err = url.Parse("http://localhost")
+	require.NoError(t, err)
+	return tmpl, text
+}
+
+type templateLimitsMock struct {
+	timeout time.Duration
+	maxSize int
+}
+
+func (l *templateLimitsMock) TemplateExecutionTimeout() time.Duration {
+	return l.timeout
+}
+
+func (l *templateLimitsMock) TemplateMaxOutputSizeBytes() int {
+	return l.maxSize
+}
+
+// slowNotifier simulates a slow receiver.
+type slowNotifier struct {
+	delay time.Duration
+}
+
+func (s *slowNotifier) Notify(_ context.Context, _ ...*types.Alert) (bool, error) {
+	time.Sleep(s.delay)
+	return false, nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/prometheus/prometheus/util/httputil"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/server"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 
 	"github.com/cortexproject/cortex/pkg/alertmanager"
 	"github.com/cortexproject/cortex/pkg/alertmanager/alertmanagerpb"
@@ -259,6 +260,9 @@ func (a *API) RegisterRuntimeConfig(runtimeConfigHandler http.HandlerFunc) {
 // RegisterDistributor registers the endpoints associated with the distributor.
 func (a *API) RegisterDistributor(d *distributor.Distributor, pushConfig distributor.Config) {
 	distributorpb.RegisterDistributorServer(a.server.GRPC, d)
+	if pushConfig.OTLPGRPCEnabled {
+		pmetricotlp.RegisterGRPCServer(a.server.GRPC, push.NewOTLPGRPCServer(a.cfg.wrapDistributorPush(d)))
+	}
 
 	a.RegisterRoute("/api/v1/push", push.Handler(pushConfig.MaxRecvMsgSize, a.sourceIPs, a.cfg.wrapDistributorPush(d)), true, "POST")
 	a.RegisterRoute("/api/v1/otlp/v1/metrics", push.OTLPHandler(a.sourceIPs, a.cfg.wrapDistributorPush(d)), true, "POST")
@@ -324,6 +328,12 @@ func (a *API) RegisterRuler(r *ruler.Ruler) {
 	ruler.RegisterRulerServer(a.server.GRPC, r)
 }
 
+// RegisterRuleEvaluationTracker registers the endpoint listing the slowest and most failing rules.
+func (a *API) RegisterRuleEvaluationTracker(t *ruler.RuleEvaluationTracker) {
+	a.indexPage.AddLink(SectionAdminEndpoints, "/ruler/rule_evaluations", "Ruler Slowest and Failing Rules")
+	a.RegisterRoute("/ruler/rule_evaluations", t, false, "GET")
+}
+
 // RegisterRulerAPI registers routes associated with the Ruler API
 func (a *API) RegisterRulerAPI(r *ruler.API) {
 	// Prometheus Rule API Routes
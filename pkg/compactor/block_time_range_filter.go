@@ -0,0 +1,107 @@
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+const (
+	// invalidTimeRangeNoCompactReason is the reason of the no compaction marks of the
+	// blocks with an invalid time range.
+	invalidTimeRangeNoCompactReason metadata.NoCompactReason = "invalid-time-range"
+
+	// invalidTimeRangeMeta is the synced metric state of the blocks with an invalid time range.
+	invalidTimeRangeMeta = "invalid-time-range"
+)
+
+// BlockTimeRangeFilter filters out the blocks whose time range is invalid, so that a block with
+// an absurd time range, uploaded by a buggy client, doesn't get compacted with the valid blocks.
+// A time range is invalid if the min time is not before the max time, if the max time is further
+// in the future than the max future margin, or if the min time is older than the max age. A zero
+// margin or max age disables the related check. Only the blocks whose min time is not before the
+// max time are marked for no compaction: the other checks are relative to the current time, so
+// those blocks are only filtered out from the current planning, and a block in the future gets
+// compacted once its max time is within the margin.
+type BlockTimeRangeFilter struct {
+	logger             log.Logger
+	bkt                objstore.Bucket
+	maxFutureMargin    time.Duration
+	maxAge             time.Duration
+	noCompactMarked    func() map[ulid.ULID]*metadata.NoCompactMark
+	invalidBlocks      prometheus.Counter
+	markedForNoCompact prometheus.Counter
+
+	now func() time.Time
+}
+
+// NewBlockTimeRangeFilter creates a BlockTimeRangeFilter. The noCompactMarkedBlocks function returns
+// the blocks already marked for no compaction, which are filtered out without being marked again.
+func NewBlockTimeRangeFilter(logger log.Logger, bkt objstore.Bucket, maxFutureMargin, maxAge time.Duration, noCompactMarkedBlocks func() map[ulid.ULID]*metadata.NoCompactMark, invalidBlocks, markedForNoCompact prometheus.Counter) *BlockTimeRangeFilter {
+	return &BlockTimeRangeFilter{
+		logger:             logger,
+		bkt:                bkt,
+		maxFutureMargin:    maxFutureMargin,
+		maxAge:             maxAge,
+		noCompactMarked:    noCompactMarkedBlocks,
+		invalidBlocks:      invalidBlocks,
+		markedForNoCompact: markedForNoCompact,
+		now:                time.Now,
+	}
+}
+
+// Filter implements block.MetadataFilter.
+func (f *BlockTimeRangeFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced block.GaugeVec, _ block.GaugeVec) error {
+	now := f.now()
+	marked := f.noCompactMarked()
+
+	for id, meta := range metas {
+		reason := f.invalidTimeRange(meta, now)
+		if reason == "" {
+			continue
+		}
+
+		delete(metas, id)
+		synced.WithLabelValues(invalidTimeRangeMeta).Inc()
+
+		if meta.MinTime < meta.MaxTime {
+			level.Debug(f.logger).Log("msg", "excluding block with invalid time range from compaction", "block", id, "reason", reason)
+			continue
+		}
+
+		if _, ok := marked[id]; ok {
+			continue
+		}
+
+		level.Warn(f.logger).Log("msg", "marking block with invalid time range for no compaction", "block", id, "reason", reason)
+		if err := block.MarkForNoCompact(ctx, f.logger, f.bkt, id, invalidTimeRangeNoCompactReason, reason, f.markedForNoCompact); err != nil {
+			return err
+		}
+		f.invalidBlocks.Inc()
+	}
+
+	return nil
+}
+
+// invalidTimeRange returns why the time range of the block is invalid, or an empty string if it's valid.
+func (f *BlockTimeRangeFilter) invalidTimeRange(meta *metadata.Meta, now time.Time) string {
+	minTime, maxTime := time.UnixMilli(meta.MinTime), time.UnixMilli(meta.MaxTime)
+
+	switch {
+	case meta.MinTime >= meta.MaxTime:
+		return fmt.Sprintf("min time %d is not before max time %d", meta.MinTime, meta.MaxTime)
+	case f.maxFutureMargin > 0 && maxTime.After(now.Add(f.maxFutureMargin)):
+		return fmt.Sprintf("max time %s is more than %s in the future", maxTime.UTC().Format(time.RFC3339), f.maxFutureMargin)
+	case f.maxAge > 0 && minTime.Before(now.Add(-f.maxAge)):
+		return fmt.Sprintf("min time %s is older than %s", minTime.UTC().Format(time.RFC3339), f.maxAge)
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package compactor
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestBlockTimeRangeFilter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hour := time.Hour.Milliseconds()
+
+	validBlock := ulid.MustNew(1, nil)
+	emptyRangeBlock := ulid.MustNew(2, nil)
+	futureBlock := ulid.MustNew(3, nil)
+	oldBlock := ulid.MustNew(4, nil)
+	alreadyMarkedBlock := ulid.MustNew(5, nil)
+
+	newMeta := func(minT, maxT int64) *metadata.Meta {
+		return &metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: minT, MaxTime: maxT}}
+	}
+
+	metas := map[ulid.ULID]*metadata.Meta{
+		validBlock:         newMeta(now.UnixMilli()-2*hour, now.UnixMilli()),
+		emptyRangeBlock:    newMeta(now.UnixMilli(), now.UnixMilli()),
+		futureBlock:        newMeta(now.UnixMilli(), now.UnixMilli()+48*hour),
+		oldBlock:           newMeta(now.UnixMilli()-48*hour, now.UnixMilli()-46*hour),
+		alreadyMarkedBlock: newMeta(now.UnixMilli(), now.UnixMilli()+48*hour),
+	}
+
+	bkt := objstore.NewInMemBucket()
+	invalidBlocks := prometheus.NewCounter(prometheus.CounterOpts{})
+	markedForNoCompact := prometheus.NewCounter(prometheus.CounterOpts{})
+	noCompactMarked := func() map[ulid.ULID]*metadata.NoCompactMark {
+		return map[ulid.ULID]*metadata.NoCompactMark{alreadyMarkedBlock: {ID: alreadyMarkedBlock}}
+	}
+	synced := prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"state"})
+
+	f := NewBlockTimeRangeFilter(log.NewNopLogger(), bkt, time.Hour, 24*time.Hour, noCompactMarked, invalidBlocks, markedForNoCompact)
+	f.now = func() time.Time { return now }
+	require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+	// Only the valid block is kept.
+	assert.Len(t, metas, 1)
+	assert.Contains(t, metas, validBlock)
+	assert.Equal(t, float64(4), testutil.ToFloat64(synced.WithLabelValues(invalidTimeRangeMeta)))
+
+	// Only the blocks whose min time is not before the max time are marked for no compaction, unless already marked.
+	exists, err := bkt.Exists(context.Background(), path.Join(emptyRangeBlock.String(), metadata.NoCompactMarkFilename))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	for _, id := range []ulid.ULID{validBlock, futureBlock, oldBlock, alreadyMarkedBlock} {
+		exists, err := bkt.Exists(context.Background(), path.Join(id.String(), metadata.NoCompactMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists, id.String())
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(invalidBlocks))
+	assert.Equal(t, float64(1), testutil.ToFloat64(markedForNoCompact))
+
+	// The block in the future is compacted once its max time is within the margin.
+	metas = map[ulid.ULID]*metadata.Meta{futureBlock: newMeta(now.UnixMilli()+46*hour, now.UnixMilli()+48*hour)}
+	require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+	assert.Empty(t, metas)
+
+	metas = map[ulid.ULID]*metadata.Meta{futureBlock: newMeta(now.UnixMilli()+46*hour, now.UnixMilli()+48*hour)}
+	f.now = func() time.Time { return now.Add(48 * time.Hour) }
+	require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+	assert.Contains(t, metas, futureBlock)
+}
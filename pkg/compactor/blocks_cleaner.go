@@ -29,12 +29,23 @@ const (
 	defaultDeleteBlocksConcurrency = 16
 )
 
+// Phases of the deletion of a tenant marked for deletion.
+const (
+	tenantDeletionPhaseGracePeriod    = "grace_period"
+	tenantDeletionPhaseDeletingBlocks = "deleting_blocks"
+	tenantDeletionPhaseCleanupDelay   = "cleanup_delay"
+	tenantDeletionPhaseDeleted        = "deleted"
+)
+
+var tenantDeletionPhases = []string{tenantDeletionPhaseGracePeriod, tenantDeletionPhaseDeletingBlocks, tenantDeletionPhaseCleanupDelay}
+
 type BlocksCleanerConfig struct {
 	DeletionDelay                      time.Duration
 	CleanupInterval                    time.Duration
 	CleanupConcurrency                 int
 	BlockDeletionMarksMigrationEnabled bool          // TODO Discuss whether we should remove it in Cortex 1.8.0 and document that upgrading to 1.7.0 before 1.8.0 is required.
 	TenantCleanupDelay                 time.Duration // Delay before removing tenant deletion mark and "debug".
+	TenantDeletionGracePeriod          time.Duration // Delay before deleting the blocks of a tenant marked for deletion.
 }
 
 type BlocksCleaner struct {
@@ -62,6 +73,7 @@ type BlocksCleaner struct {
 	tenantBlocksMarkedForNoCompaction *prometheus.GaugeVec
 	tenantPartialBlocks               *prometheus.GaugeVec
 	tenantBucketIndexLastUpdate       *prometheus.GaugeVec
+	tenantsMarkedForDeletion          *prometheus.GaugeVec
 }
 
 func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.InstrumentedBucket, usersScanner *cortex_tsdb.UsersScanner, cfgProvider ConfigProvider, logger log.Logger, reg prometheus.Registerer) *BlocksCleaner {
@@ -124,6 +136,10 @@ func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.Instrumente
 			Name: "cortex_bucket_index_last_successful_update_timestamp_seconds",
 			Help: "Timestamp of the last successful update of a tenant's bucket index.",
 		}, []string{"user"}),
+		tenantsMarkedForDeletion: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_compactor_tenants_marked_for_deletion",
+			Help: "Number of tenants marked for deletion which haven't been fully deleted yet, by deletion phase.",
+		}, []string{"phase"}),
 	}
 
 	c.Service = services.NewTimerService(cfg.CleanupInterval, c.starting, c.ticker, nil)
@@ -186,30 +202,57 @@ func (c *BlocksCleaner) cleanUsers(ctx context.Context, firstRun bool) error {
 	}
 	c.lastOwnedUsers = allUsers
 
-	return concurrency.ForEachUser(ctx, allUsers, c.cfg.CleanupConcurrency, func(ctx context.Context, userID string) error {
+	// Keep track of the deletion phase of the tenants marked for deletion.
+	phasesMx := sync.Mutex{}
+	phases := make(map[string]int, len(tenantDeletionPhases))
+
+	err = concurrency.ForEachUser(ctx, allUsers, c.cfg.CleanupConcurrency, func(ctx context.Context, userID string) error {
 		if isDeleted[userID] {
-			return errors.Wrapf(c.deleteUserMarkedForDeletion(ctx, userID), "failed to delete user marked for deletion: %s", userID)
+			phase, err := c.deleteUserMarkedForDeletion(ctx, userID)
+
+			phasesMx.Lock()
+			phases[phase]++
+			phasesMx.Unlock()
+
+			return errors.Wrapf(err, "failed to delete user marked for deletion: %s", userID)
 		}
 		return errors.Wrapf(c.cleanUser(ctx, userID, firstRun), "failed to delete blocks for user: %s", userID)
 	})
+
+	for _, phase := range tenantDeletionPhases {
+		c.tenantsMarkedForDeletion.WithLabelValues(phase).Set(float64(phases[phase]))
+	}
+
+	return err
 }
 
-// Remove blocks and remaining data for tenant marked for deletion.
-func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID string) error {
+// Remove blocks and remaining data for tenant marked for deletion. Returns the deletion phase the tenant is in.
+func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID string) (string, error) {
 	userLogger := util_log.WithUserID(userID, c.logger)
 	userBucket := bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider)
 
+	if c.cfg.TenantDeletionGracePeriod > 0 {
+		mark, err := cortex_tsdb.ReadTenantDeletionMark(ctx, c.bucketClient, userID)
+		if err != nil {
+			return tenantDeletionPhaseGracePeriod, errors.Wrap(err, "failed to read tenant deletion mark")
+		}
+		if mark != nil && time.Since(time.Unix(mark.DeletionTime, 0)) < c.cfg.TenantDeletionGracePeriod {
+			level.Debug(userLogger).Log("msg", "tenant marked for deletion is within the deletion grace period, its blocks will be deleted later")
+			return tenantDeletionPhaseGracePeriod, nil
+		}
+	}
+
 	level.Info(userLogger).Log("msg", "deleting blocks for tenant marked for deletion")
 
 	// We immediately delete the bucket index, to signal to its consumers that
 	// the tenant has "no blocks" in the storage.
 	if err := bucketindex.DeleteIndex(ctx, c.bucketClient, userID, c.cfgProvider); err != nil {
-		return err
+		return tenantDeletionPhaseDeletingBlocks, err
 	}
 
 	// Delete the bucket sync status
 	if err := bucketindex.DeleteIndexSyncStatus(ctx, c.bucketClient, userID); err != nil {
-		return err
+		return tenantDeletionPhaseDeletingBlocks, err
 	}
 	c.tenantBucketIndexLastUpdate.DeleteLabelValues(userID)
 
@@ -239,7 +282,7 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 	})
 
 	if err != nil {
-		return err
+		return tenantDeletionPhaseDeletingBlocks, err
 	}
 
 	if failed > 0 {
@@ -250,7 +293,7 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 		c.tenantBlocksMarkedForDelete.WithLabelValues(userID).Set(float64(failed))
 		c.tenantPartialBlocks.WithLabelValues(userID).Set(0)
 
-		return errors.Errorf("failed to delete %d blocks", failed)
+		return tenantDeletionPhaseDeletingBlocks, errors.Errorf("failed to delete %d blocks", failed)
 	}
 
 	// Given all blocks have been deleted, we can also remove the metrics.
@@ -265,10 +308,10 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 
 	mark, err := cortex_tsdb.ReadTenantDeletionMark(ctx, c.bucketClient, userID)
 	if err != nil {
-		return errors.Wrap(err, "failed to read tenant deletion mark")
+		return tenantDeletionPhaseCleanupDelay, errors.Wrap(err, "failed to read tenant deletion mark")
 	}
 	if mark == nil {
-		return errors.Wrap(err, "cannot find tenant deletion mark anymore")
+		return tenantDeletionPhaseCleanupDelay, errors.Wrap(err, "cannot find tenant deletion mark anymore")
 	}
 
 	// If we have just deleted some blocks, update "finished" time. Also update "finished" time if it wasn't set yet, but there are no blocks.
@@ -277,33 +320,33 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 	if deletedBlocks > 0 || mark.FinishedTime == 0 {
 		level.Info(userLogger).Log("msg", "updating finished time in tenant deletion mark")
 		mark.FinishedTime = time.Now().Unix()
-		return errors.Wrap(cortex_tsdb.WriteTenantDeletionMark(ctx, c.bucketClient, userID, mark), "failed to update tenant deletion mark")
+		return tenantDeletionPhaseCleanupDelay, errors.Wrap(cortex_tsdb.WriteTenantDeletionMark(ctx, c.bucketClient, userID, mark), "failed to update tenant deletion mark")
 	}
 
 	if time.Since(time.Unix(mark.FinishedTime, 0)) < c.cfg.TenantCleanupDelay {
-		return nil
+		return tenantDeletionPhaseCleanupDelay, nil
 	}
 
 	level.Info(userLogger).Log("msg", "cleaning up remaining blocks data for tenant marked for deletion")
 
 	// Let's do final cleanup of tenant.
 	if deleted, err := bucket.DeletePrefix(ctx, userBucket, block.DebugMetas, userLogger); err != nil {
-		return errors.Wrap(err, "failed to delete "+block.DebugMetas)
+		return tenantDeletionPhaseCleanupDelay, errors.Wrap(err, "failed to delete "+block.DebugMetas)
 	} else if deleted > 0 {
 		level.Info(userLogger).Log("msg", "deleted files under "+block.DebugMetas+" for tenant marked for deletion", "count", deleted)
 	}
 
 	if deleted, err := bucket.DeletePrefix(ctx, userBucket, bucketindex.MarkersPathname, userLogger); err != nil {
-		return errors.Wrap(err, "failed to delete marker files")
+		return tenantDeletionPhaseCleanupDelay, errors.Wrap(err, "failed to delete marker files")
 	} else if deleted > 0 {
 		level.Info(userLogger).Log("msg", "deleted marker files for tenant marked for deletion", "count", deleted)
 	}
 
 	if err := cortex_tsdb.DeleteTenantDeletionMark(ctx, c.bucketClient, userID); err != nil {
-		return errors.Wrap(err, "failed to delete tenant deletion mark")
+		return tenantDeletionPhaseCleanupDelay, errors.Wrap(err, "failed to delete tenant deletion mark")
 	}
 
-	return nil
+	return tenantDeletionPhaseDeleted, nil
 }
 
 func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, firstRun bool) (returnErr error) {
@@ -365,6 +365,60 @@ func TestBlocksCleaner_ShouldContinueOnBlockDeletionFailure(t *testing.T) {
 	assert.ElementsMatch(t, []ulid.ULID{block3}, idx.BlockDeletionMarks.GetULIDs())
 }
 
+func TestBlocksCleaner_ShouldDeleteTenantBlocksAfterTheDeletionGracePeriod(t *testing.T) {
+	bucketClient, _ := cortex_testutil.PrepareFilesystemBucket(t)
+	bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+	// Create blocks for two tenants marked for deletion: only user-2 has been marked before the grace period.
+	ctx := context.Background()
+	now := time.Now()
+	gracePeriod := time.Hour
+	block1 := createTSDBBlock(t, bucketClient, "user-1", 10, 20, nil)
+	block2 := createTSDBBlock(t, bucketClient, "user-2", 10, 20, nil)
+	require.NoError(t, tsdb.WriteTenantDeletionMark(ctx, bucketClient, "user-1", tsdb.NewTenantDeletionMark(now)))
+	require.NoError(t, tsdb.WriteTenantDeletionMark(ctx, bucketClient, "user-2", tsdb.NewTenantDeletionMark(now.Add(-2*gracePeriod))))
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:             12 * time.Hour,
+		CleanupInterval:           time.Minute,
+		CleanupConcurrency:        1,
+		TenantCleanupDelay:        6 * time.Hour,
+		TenantDeletionGracePeriod: gracePeriod,
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	logger := log.NewNopLogger()
+	scanner := tsdb.NewUsersScanner(bucketClient, tsdb.AllUsers, logger)
+	cfgProvider := newMockConfigProvider()
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, scanner, cfgProvider, logger, reg)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, cleaner))
+	defer services.StopAndAwaitTerminated(ctx, cleaner) //nolint:errcheck
+
+	for _, tc := range []struct {
+		path           string
+		expectedExists bool
+	}{
+		{path: path.Join("user-1", block1.String(), metadata.MetaFilename), expectedExists: true},
+		{path: path.Join("user-2", block2.String(), metadata.MetaFilename), expectedExists: false},
+	} {
+		exists, err := bucketClient.Exists(ctx, tc.path)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedExists, exists, tc.path)
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(cleaner.runsCompleted))
+	assert.Equal(t, float64(1), testutil.ToFloat64(cleaner.blocksCleanedTotal))
+
+	assert.NoError(t, prom_testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_tenants_marked_for_deletion Number of tenants marked for deletion which haven't been fully deleted yet, by deletion phase.
+		# TYPE cortex_compactor_tenants_marked_for_deletion gauge
+		cortex_compactor_tenants_marked_for_deletion{phase="cleanup_delay"} 1
+		cortex_compactor_tenants_marked_for_deletion{phase="deleting_blocks"} 0
+		cortex_compactor_tenants_marked_for_deletion{phase="grace_period"} 1
+	`), "cortex_compactor_tenants_marked_for_deletion"))
+}
+
 func TestBlocksCleaner_ShouldRebuildBucketIndexOnCorruptedOne(t *testing.T) {
 	const userID = "user-1"
 
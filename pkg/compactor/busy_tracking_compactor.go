@@ -0,0 +1,38 @@
+package compactor
+
+import (
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/compact"
+)
+
+// busyTrackingCompactor wraps a compactor to track the number of compactions
+// running concurrently, across all tenants.
+type busyTrackingCompactor struct {
+	compactor compact.Compactor
+	busy      prometheus.Gauge
+}
+
+func newBusyTrackingCompactor(compactor compact.Compactor, busy prometheus.Gauge) *busyTrackingCompactor {
+	return &busyTrackingCompactor{
+		compactor: compactor,
+		busy:      busy,
+	}
+}
+
+// Compact implements compact.Compactor.
+func (c *busyTrackingCompactor) Compact(dest string, dirs []string, open []*tsdb.Block) (ulid.ULID, error) {
+	c.busy.Inc()
+	defer c.busy.Dec()
+
+	return c.compactor.Compact(dest, dirs, open)
+}
+
+// CompactWithBlockPopulator implements compact.Compactor.
+func (c *busyTrackingCompactor) CompactWithBlockPopulator(dest string, dirs []string, open []*tsdb.Block, blockPopulator tsdb.BlockPopulator) (ulid.ULID, error) {
+	c.busy.Inc()
+	defer c.busy.Dec()
+
+	return c.compactor.CompactWithBlockPopulator(dest, dirs, open, blockPopulator)
+}
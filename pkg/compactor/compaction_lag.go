@@ -0,0 +1,148 @@
+package compactor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// compactionLagTracker tracks, for each tenant, the max time of the oldest block still waiting
+// to be compacted, and exposes the compaction lag as the age of such block. The lag keeps
+// growing while the compactions of the tenant fail, since the tracked block is only updated
+// once the tenant is successfully compacted.
+type compactionLagTracker struct {
+	mtx    sync.Mutex
+	oldest map[string]time.Time
+
+	lag *prometheus.GaugeVec
+}
+
+func newCompactionLagTracker(reg prometheus.Registerer) *compactionLagTracker {
+	return &compactionLagTracker{
+		oldest: map[string]time.Time{},
+		lag: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_compactor_tenant_compaction_lag_seconds",
+			Help: "Age of the oldest block of the tenant not compacted yet, computed from the block max time. 0 if all the blocks of the tenant have been compacted.",
+		}, []string{"user"}),
+	}
+}
+
+// update records the oldest uncompacted block among the metas of the tenant, synced after
+// the compaction.
+func (t *compactionLagTracker) update(userID string, metas map[ulid.ULID]*metadata.Meta, blockRanges []int64, now time.Time) {
+	oldest, ok := oldestUncompactedBlock(metas, blockRanges)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if !ok {
+		delete(t.oldest, userID)
+		t.lag.WithLabelValues(userID).Set(0)
+		return
+	}
+
+	t.oldest[userID] = oldest
+	t.lag.WithLabelValues(userID).Set(compactionLag(oldest, now).Seconds())
+}
+
+// refresh updates the lag of all the tracked tenants.
+func (t *compactionLagTracker) refresh(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for userID, oldest := range t.oldest {
+		t.lag.WithLabelValues(userID).Set(compactionLag(oldest, now).Seconds())
+	}
+}
+
+// remove stops tracking the tenant, no longer compacted by this compactor.
+func (t *compactionLagTracker) remove(userID string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.oldest, userID)
+	t.lag.DeleteLabelValues(userID)
+}
+
+// removeAllExcept stops tracking all the tenants not in the keep set.
+func (t *compactionLagTracker) removeAllExcept(keep map[string]struct{}) {
+	t.mtx.Lock()
+	userIDs := make([]string, 0, len(t.oldest))
+	for userID := range t.oldest {
+		if _, ok := keep[userID]; !ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	t.mtx.Unlock()
+
+	for _, userID := range userIDs {
+		t.remove(userID)
+	}
+}
+
+// laggingTenants returns the tenants whose compaction lag exceeds the threshold, sorted.
+func (t *compactionLagTracker) laggingTenants(threshold time.Duration, now time.Time) []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var lagging []string
+	for userID, oldest := range t.oldest {
+		if compactionLag(oldest, now) > threshold {
+			lagging = append(lagging, userID)
+		}
+	}
+	sort.Strings(lagging)
+	return lagging
+}
+
+// checkLag returns an error if the compaction lag of any tenant exceeds the threshold.
+func (t *compactionLagTracker) checkLag(threshold time.Duration, now time.Time) error {
+	lagging := t.laggingTenants(threshold, now)
+	if len(lagging) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the compaction lag of %d tenant(s) exceeds the threshold of %s: %s", len(lagging), threshold, strings.Join(lagging, ", "))
+}
+
+func compactionLag(oldest, now time.Time) time.Duration {
+	return max(now.Sub(oldest), 0)
+}
+
+// oldestUncompactedBlock returns the max time of the oldest block waiting to be compacted. A
+// block is waiting to be compacted if it has never been compacted, and it shares the time
+// range of the largest compaction block range with other blocks to be compacted with.
+func oldestUncompactedBlock(metas map[ulid.ULID]*metadata.Meta, blockRanges []int64) (time.Time, bool) {
+	if len(blockRanges) == 0 {
+		return time.Time{}, false
+	}
+	largestRange := blockRanges[len(blockRanges)-1]
+
+	blocksPerRange := map[int64]int{}
+	for _, m := range metas {
+		blocksPerRange[m.MinTime/largestRange]++
+	}
+
+	var (
+		oldest int64
+		found  bool
+	)
+	for _, m := range metas {
+		if m.Compaction.Level > 1 || blocksPerRange[m.MinTime/largestRange] < 2 {
+			continue
+		}
+		if !found || m.MaxTime < oldest {
+			oldest, found = m.MaxTime, true
+		}
+	}
+	if !found {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(oldest), true
+}
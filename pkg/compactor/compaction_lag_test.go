@@ -0,0 +1,135 @@
+package compactor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestOldestUncompactedBlock(t *testing.T) {
+	blockRanges := []int64{(2 * time.Hour).Milliseconds(), (12 * time.Hour).Milliseconds()}
+	hours := func(h int64) int64 { return h * time.Hour.Milliseconds() }
+
+	newMeta := func(id uint64, minT, maxT int64, level int) *metadata.Meta {
+		return &metadata.Meta{BlockMeta: tsdb.BlockMeta{
+			ULID:       ulid.MustNew(id, nil),
+			MinTime:    minT,
+			MaxTime:    maxT,
+			Compaction: tsdb.BlockMetaCompaction{Level: level},
+		}}
+	}
+	metasOf := func(metas ...*metadata.Meta) map[ulid.ULID]*metadata.Meta {
+		m := map[ulid.ULID]*metadata.Meta{}
+		for _, meta := range metas {
+			m[meta.ULID] = meta
+		}
+		return m
+	}
+
+	tests := map[string]struct {
+		metas          map[ulid.ULID]*metadata.Meta
+		expectedOldest int64
+		expectedFound  bool
+	}{
+		"no blocks": {
+			metas: metasOf(),
+		},
+		"only compacted blocks": {
+			metas: metasOf(newMeta(1, hours(0), hours(12), 3), newMeta(2, hours(12), hours(24), 3)),
+		},
+		"single uncompacted block in the largest block range": {
+			metas: metasOf(newMeta(1, hours(0), hours(12), 3), newMeta(2, hours(12), hours(14), 1)),
+		},
+		"uncompacted blocks sharing the largest block range": {
+			metas:          metasOf(newMeta(1, hours(12), hours(14), 1), newMeta(2, hours(14), hours(16), 1), newMeta(3, hours(24), hours(26), 1), newMeta(4, hours(24), hours(26), 1)),
+			expectedOldest: hours(14),
+			expectedFound:  true,
+		},
+		"uncompacted block sharing the largest block range with a compacted block": {
+			metas:          metasOf(newMeta(1, hours(0), hours(2), 1), newMeta(2, hours(2), hours(8), 2)),
+			expectedOldest: hours(2),
+			expectedFound:  true,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			oldest, found := oldestUncompactedBlock(testData.metas, blockRanges)
+			assert.Equal(t, testData.expectedFound, found)
+			if testData.expectedFound {
+				assert.Equal(t, time.UnixMilli(testData.expectedOldest), oldest)
+			}
+		})
+	}
+}
+
+func TestCompactionLagTracker(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	tracker := newCompactionLagTracker(reg)
+	blockRanges := []int64{(2 * time.Hour).Milliseconds()}
+	now := time.Now().Truncate(time.Second)
+
+	uncompacted := func(maxT time.Time) map[ulid.ULID]*metadata.Meta {
+		metas := map[ulid.ULID]*metadata.Meta{}
+		for id := uint64(1); id <= 2; id++ {
+			meta := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), MaxTime: maxT.UnixMilli(), Compaction: tsdb.BlockMetaCompaction{Level: 1}}}
+			meta.MinTime = meta.MaxTime - 1
+			metas[meta.ULID] = meta
+		}
+		return metas
+	}
+
+	tracker.update("user-1", uncompacted(now.Add(-3*time.Hour)), blockRanges, now)
+	tracker.update("user-2", uncompacted(now.Add(-time.Hour)), blockRanges, now)
+	tracker.update("user-3", nil, blockRanges, now)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_tenant_compaction_lag_seconds Age of the oldest block of the tenant not compacted yet, computed from the block max time. 0 if all the blocks of the tenant have been compacted.
+		# TYPE cortex_compactor_tenant_compaction_lag_seconds gauge
+		cortex_compactor_tenant_compaction_lag_seconds{user="user-1"} 10800
+		cortex_compactor_tenant_compaction_lag_seconds{user="user-2"} 3600
+		cortex_compactor_tenant_compaction_lag_seconds{user="user-3"} 0
+	`), "cortex_compactor_tenant_compaction_lag_seconds"))
+
+	assert.NoError(t, tracker.checkLag(4*time.Hour, now))
+	assert.EqualError(t, tracker.checkLag(2*time.Hour, now), "the compaction lag of 1 tenant(s) exceeds the threshold of 2h0m0s: user-1")
+
+	// The lag keeps growing until the tenant is compacted again.
+	later := now.Add(2 * time.Hour)
+	tracker.refresh(later)
+	assert.EqualError(t, tracker.checkLag(2*time.Hour, later), "the compaction lag of 2 tenant(s) exceeds the threshold of 2h0m0s: user-1, user-2")
+
+	// The tenants not owned anymore are not tracked.
+	tracker.removeAllExcept(map[string]struct{}{"user-2": {}})
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_tenant_compaction_lag_seconds Age of the oldest block of the tenant not compacted yet, computed from the block max time. 0 if all the blocks of the tenant have been compacted.
+		# TYPE cortex_compactor_tenant_compaction_lag_seconds gauge
+		cortex_compactor_tenant_compaction_lag_seconds{user="user-2"} 10800
+		cortex_compactor_tenant_compaction_lag_seconds{user="user-3"} 0
+	`), "cortex_compactor_tenant_compaction_lag_seconds"))
+}
+
+func TestCompactor_CheckReady(t *testing.T) {
+	c := &Compactor{compactionLag: newCompactionLagTracker(nil)}
+	c.compactionLag.update("user-1", map[ulid.ULID]*metadata.Meta{
+		ulid.MustNew(1, nil): {BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MaxTime: time.Now().Add(-time.Hour).UnixMilli(), Compaction: tsdb.BlockMetaCompaction{Level: 1}}},
+		ulid.MustNew(2, nil): {BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil), MaxTime: time.Now().Add(-time.Hour).UnixMilli(), Compaction: tsdb.BlockMetaCompaction{Level: 1}}},
+	}, []int64{(2 * time.Hour).Milliseconds()}, time.Now())
+
+	// The readiness check is disabled by default.
+	assert.NoError(t, c.CheckReady(context.Background()))
+
+	c.compactorCfg.CompactionLagThreshold = 2 * time.Hour
+	assert.NoError(t, c.CheckReady(context.Background()))
+
+	c.compactorCfg.CompactionLagThreshold = 30 * time.Minute
+	assert.EqualError(t, c.CheckReady(context.Background()), "the compaction lag of 1 tenant(s) exceeds the threshold of 30m0s: user-1")
+}
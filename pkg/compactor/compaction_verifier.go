@@ -0,0 +1,240 @@
+package compactor
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+)
+
+const (
+	verificationSkipped   = "skipped"
+	verificationSucceeded = "succeeded"
+	verificationFailed    = "failed"
+	verificationErrored   = "error"
+)
+
+// compactionVerifier verifies a sample of the blocks resulting from the compactions, once
+// uploaded and before their source blocks are marked for deletion. The index of the block is
+// downloaded back from the bucket and checked, to catch the blocks corrupted after the compaction,
+// like during their upload. A block failing the check is marked for deletion in place of its
+// source blocks, so that they are compacted again.
+//
+// The sampling is deterministic: with a sample rate of 1/N, every Nth compaction is verified.
+type compactionVerifier struct {
+	sampleRate           float64
+	acceptMalformedIndex bool
+
+	mtx    sync.Mutex
+	credit float64
+
+	verifications *prometheus.CounterVec
+}
+
+func newCompactionVerifier(sampleRate float64, acceptMalformedIndex bool, reg prometheus.Registerer) *compactionVerifier {
+	v := &compactionVerifier{
+		sampleRate:           sampleRate,
+		acceptMalformedIndex: acceptMalformedIndex,
+		verifications: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_compactor_compacted_block_verifications_total",
+			Help: "Total number of blocks resulting from a compaction, by verification result. The result is skipped for the blocks not sampled for the verification, and error if the verification couldn't run.",
+		}, []string{"result"}),
+	}
+	for _, result := range []string{verificationSkipped, verificationSucceeded, verificationFailed, verificationErrored} {
+		v.verifications.WithLabelValues(result)
+	}
+	return v
+}
+
+// sample returns whether the next compaction should be verified.
+func (v *compactionVerifier) sample() bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	// The tolerance absorbs the rounding errors of the sums of rates like 0.1.
+	v.credit += v.sampleRate
+	if v.credit < 1-1e-9 {
+		return false
+	}
+	v.credit--
+	return true
+}
+
+// forTenant returns the verifier of the compactions run by the compactor on the tenant bucket,
+// downloading the verified blocks in the given directory.
+func (v *compactionVerifier) forTenant(ctx context.Context, logger log.Logger, compactor compact.Compactor, bkt objstore.Bucket, dir string, blocksMarkedForDeletion prometheus.Counter) *tenantCompactionVerifier {
+	return &tenantCompactionVerifier{
+		ctx:                     ctx,
+		logger:                  logger,
+		verifier:                v,
+		compactor:               compactor,
+		bkt:                     bkt,
+		dir:                     dir,
+		blocksMarkedForDeletion: blocksMarkedForDeletion,
+		pending:                 map[ulid.ULID]ulid.ULID{},
+		verified:                map[ulid.ULID]bool{},
+	}
+}
+
+// verify downloads the index of the block and checks it, returning the verification result.
+func (v *compactionVerifier) verify(ctx context.Context, logger log.Logger, bkt objstore.Bucket, dir string, id ulid.ULID) string {
+	bdir := filepath.Join(dir, id.String())
+	defer func() {
+		if err := os.RemoveAll(bdir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove the verified block directory", "block", id, "err", err)
+		}
+	}()
+
+	meta, err := block.DownloadMeta(ctx, logger, bkt, id)
+	if err == nil {
+		err = os.MkdirAll(bdir, os.ModePerm)
+	}
+	if err == nil {
+		err = objstore.DownloadFile(ctx, logger, bkt, path.Join(id.String(), block.IndexFilename), filepath.Join(bdir, block.IndexFilename))
+	}
+	if err != nil {
+		v.verifications.WithLabelValues(verificationErrored).Inc()
+		level.Warn(logger).Log("msg", "failed to download the compacted block index to verify it", "block", id, "err", err)
+		return verificationErrored
+	}
+
+	if err := v.checkIndex(ctx, logger, filepath.Join(bdir, block.IndexFilename), meta); err != nil {
+		if ctx.Err() != nil {
+			v.verifications.WithLabelValues(verificationErrored).Inc()
+			return verificationErrored
+		}
+		v.verifications.WithLabelValues(verificationFailed).Inc()
+		level.Error(logger).Log("msg", "compacted block failed the verification", "block", id, "err", err)
+		return verificationFailed
+	}
+
+	v.verifications.WithLabelValues(verificationSucceeded).Inc()
+	level.Info(logger).Log("msg", "compacted block verified", "block", id)
+	return verificationSucceeded
+}
+
+func (v *compactionVerifier) checkIndex(ctx context.Context, logger log.Logger, indexPath string, meta metadata.Meta) error {
+	stats, err := block.GatherIndexHealthStats(ctx, logger, indexPath, meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return err
+	}
+	// If the malformed indexes are accepted, only the critical issues are reported.
+	if v.acceptMalformedIndex {
+		return stats.CriticalErr()
+	}
+	return stats.AnyErr()
+}
+
+// tenantCompactionVerifier wraps the compactor to track the blocks resulting from the sampled
+// compactions of a tenant, and verifies them when Thanos checks whether their source blocks can
+// be marked for deletion, which happens right after the upload of the compacted block.
+type tenantCompactionVerifier struct {
+	compact.DefaultCompactionLifecycleCallback
+
+	ctx                     context.Context
+	logger                  log.Logger
+	verifier                *compactionVerifier
+	compactor               compact.Compactor
+	bkt                     objstore.Bucket
+	dir                     string
+	blocksMarkedForDeletion prometheus.Counter
+
+	mtx sync.Mutex
+	// The compacted block of each source block of the sampled compactions.
+	pending map[ulid.ULID]ulid.ULID
+	// Whether the source blocks of each compacted block can be deleted, once verified.
+	verified map[ulid.ULID]bool
+}
+
+// Compact implements compact.Compactor.
+func (t *tenantCompactionVerifier) Compact(dest string, dirs []string, open []*tsdb.Block) (ulid.ULID, error) {
+	id, err := t.compactor.Compact(dest, dirs, open)
+	if err == nil {
+		t.track(dirs, id)
+	}
+	return id, err
+}
+
+// CompactWithBlockPopulator implements compact.Compactor.
+func (t *tenantCompactionVerifier) CompactWithBlockPopulator(dest string, dirs []string, open []*tsdb.Block, blockPopulator tsdb.BlockPopulator) (ulid.ULID, error) {
+	id, err := t.compactor.CompactWithBlockPopulator(dest, dirs, open, blockPopulator)
+	if err == nil {
+		t.track(dirs, id)
+	}
+	return id, err
+}
+
+func (t *tenantCompactionVerifier) track(dirs []string, id ulid.ULID) {
+	// No block is written when the compaction result is empty.
+	if id == (ulid.ULID{}) {
+		return
+	}
+	if !t.verifier.sample() {
+		t.verifier.verifications.WithLabelValues(verificationSkipped).Inc()
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	// The source blocks are downloaded in directories named after their ID.
+	for _, dir := range dirs {
+		if source, err := ulid.Parse(filepath.Base(dir)); err == nil {
+			t.pending[source] = id
+		}
+	}
+}
+
+// CanDelete implements compact.BlockDeletableChecker. The compacted block is verified when the
+// first of its source blocks is checked. If the verification fails, the compacted block is marked
+// for deletion and its source blocks are kept.
+func (t *tenantCompactionVerifier) CanDelete(_ *compact.Group, blockID ulid.ULID) bool {
+	t.mtx.Lock()
+	id, sampled := t.pending[blockID]
+	delete(t.pending, blockID)
+	canDelete, verified := t.verified[id]
+	t.mtx.Unlock()
+
+	if !sampled {
+		return true
+	}
+	if verified {
+		return canDelete
+	}
+
+	// A verification which couldn't run doesn't prevent the deletion of the source blocks.
+	canDelete = t.verifier.verify(t.ctx, t.logger, t.bkt, t.dir, id) != verificationFailed
+	if !canDelete {
+		if err := block.MarkForDeletion(t.ctx, t.logger, t.bkt, id, "compacted block failed the verification", t.blocksMarkedForDeletion); err != nil {
+			// The source blocks are deleted anyway, since they would overlap with the compacted block.
+			level.Warn(t.logger).Log("msg", "failed to mark the compacted block failing the verification for deletion", "block", id, "err", err)
+			canDelete = true
+		}
+	}
+
+	t.mtx.Lock()
+	t.verified[id] = canDelete
+	t.mtx.Unlock()
+	return canDelete
+}
+
+// PostCompactionCallback implements compact.CompactionLifecycleCallback.
+func (t *tenantCompactionVerifier) PostCompactionCallback(_ context.Context, _ log.Logger, _ *compact.Group, blockID ulid.ULID) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.verified, blockID)
+	return nil
+}
@@ -0,0 +1,144 @@
+package compactor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
+	cortex_testutil "github.com/cortexproject/cortex/pkg/storage/tsdb/testutil"
+)
+
+func TestCompactionVerifier_Sample(t *testing.T) {
+	tests := map[string]struct {
+		sampleRate float64
+		expected   []bool
+	}{
+		"disabled": {
+			sampleRate: 0,
+			expected:   []bool{false, false, false, false},
+		},
+		"all": {
+			sampleRate: 1,
+			expected:   []bool{true, true, true, true},
+		},
+		"every 4th": {
+			sampleRate: 0.25,
+			expected:   []bool{false, false, false, true, false, false, false, true},
+		},
+		"every 10th": {
+			sampleRate: 0.1,
+			expected:   []bool{false, false, false, false, false, false, false, false, false, true},
+		},
+		"every other": {
+			sampleRate: 0.5,
+			expected:   []bool{false, true, false, true},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			v := newCompactionVerifier(testData.sampleRate, false, nil)
+
+			var actual []bool
+			for range testData.expected {
+				actual = append(actual, v.sample())
+			}
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+func TestCompactionVerifier_ShouldVerifyTheCompactedBlocksBeforeDeletingTheSourceBlocks(t *testing.T) {
+	bucketClient, _ := cortex_testutil.PrepareFilesystemBucket(t)
+	userBucket := bucket.NewPrefixedBucketClient(bucketClient, "user-1")
+	valid := createTSDBBlock(t, bucketClient, "user-1", 10, 20, nil)
+	corrupted := createTSDBBlock(t, bucketClient, "user-1", 20, 30, nil)
+	require.NoError(t, userBucket.Upload(context.Background(), path.Join(corrupted.String(), block.IndexFilename), bytes.NewReader([]byte("corrupted"))))
+	missing := ulid.MustNew(1, nil)
+
+	sources := map[ulid.ULID][]ulid.ULID{}
+	compactor := &tsdbCompactorMock{}
+	for _, id := range []ulid.ULID{valid, corrupted, missing} {
+		sources[id] = []ulid.ULID{ulid.MustNew(ulid.Now(), rand.Reader), ulid.MustNew(ulid.Now(), rand.Reader)}
+		compactor.On("Compact", "dest", []string{"dir/" + sources[id][0].String(), "dir/" + sources[id][1].String()}, mock.Anything).Return(id, nil)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	blocksMarkedForDeletion := prometheus.NewCounter(prometheus.CounterOpts{Name: "blocks_marked_for_deletion_total"})
+	v := newCompactionVerifier(1, false, reg).forTenant(context.Background(), log.NewNopLogger(), compactor, userBucket, t.TempDir(), blocksMarkedForDeletion)
+
+	for _, id := range []ulid.ULID{valid, corrupted, missing} {
+		compID, err := v.Compact("dest", []string{"dir/" + sources[id][0].String(), "dir/" + sources[id][1].String()}, nil)
+		require.NoError(t, err)
+		require.Equal(t, id, compID)
+	}
+
+	// The source blocks of the valid block are deleted, as well as the ones of the block which
+	// couldn't be verified.
+	for _, id := range []ulid.ULID{valid, missing} {
+		for _, source := range sources[id] {
+			assert.True(t, v.CanDelete(nil, source))
+		}
+		require.NoError(t, v.PostCompactionCallback(context.Background(), log.NewNopLogger(), nil, id))
+	}
+
+	// The source blocks of the corrupted block are kept, and the corrupted block is deleted instead.
+	for _, source := range sources[corrupted] {
+		assert.False(t, v.CanDelete(nil, source))
+	}
+	require.NoError(t, v.PostCompactionCallback(context.Background(), log.NewNopLogger(), nil, corrupted))
+	assert.Equal(t, float64(1), testutil.ToFloat64(blocksMarkedForDeletion))
+	for id, expected := range map[ulid.ULID]bool{valid: false, corrupted: true} {
+		exists, err := userBucket.Exists(context.Background(), path.Join(id.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.Equal(t, expected, exists)
+	}
+
+	// The blocks not resulting from a sampled compaction can be deleted.
+	assert.True(t, v.CanDelete(nil, ulid.MustNew(ulid.Now(), rand.Reader)))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_compacted_block_verifications_total Total number of blocks resulting from a compaction, by verification result. The result is skipped for the blocks not sampled for the verification, and error if the verification couldn't run.
+		# TYPE cortex_compactor_compacted_block_verifications_total counter
+		cortex_compactor_compacted_block_verifications_total{result="error"} 1
+		cortex_compactor_compacted_block_verifications_total{result="failed"} 1
+		cortex_compactor_compacted_block_verifications_total{result="skipped"} 0
+		cortex_compactor_compacted_block_verifications_total{result="succeeded"} 1
+	`)))
+}
+
+func TestCompactionVerifier_ShouldNotVerifyTheCompactionsNotSampled(t *testing.T) {
+	compactor := &tsdbCompactorMock{}
+	compactor.On("Compact", "dest", mock.Anything, mock.Anything).Return(ulid.MustNew(1, nil), nil)
+
+	reg := prometheus.NewPedanticRegistry()
+	v := newCompactionVerifier(0.5, false, reg).forTenant(context.Background(), log.NewNopLogger(), compactor, nil, t.TempDir(), nil)
+
+	source := ulid.MustNew(2, nil)
+	_, err := v.Compact("dest", []string{"dir/" + source.String()}, nil)
+	require.NoError(t, err)
+	assert.True(t, v.CanDelete(nil, source))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_compacted_block_verifications_total Total number of blocks resulting from a compaction, by verification result. The result is skipped for the blocks not sampled for the verification, and error if the verification couldn't run.
+		# TYPE cortex_compactor_compacted_block_verifications_total counter
+		cortex_compactor_compacted_block_verifications_total{result="error"} 0
+		cortex_compactor_compacted_block_verifications_total{result="failed"} 0
+		cortex_compactor_compacted_block_verifications_total{result="skipped"} 1
+		cortex_compactor_compacted_block_verifications_total{result="succeeded"} 0
+	`)))
+}
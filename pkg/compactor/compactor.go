@@ -8,7 +8,9 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -24,6 +26,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -54,8 +57,12 @@ var (
 	supportedShardingStrategies = []string{util.ShardingStrategyDefault, util.ShardingStrategyShuffle}
 	errInvalidShardingStrategy  = errors.New("invalid sharding strategy")
 	errInvalidTenantShardSize   = errors.New("invalid tenant shard size, the value must be greater than 0")
+	errInvalidTenantConcurrency = errors.New("invalid tenant concurrency, the value must be greater than 0")
 
-	DefaultBlocksGrouperFactory = func(ctx context.Context, cfg Config, bkt objstore.InstrumentedBucket, logger log.Logger, reg prometheus.Registerer, blocksMarkedForDeletion, blocksMarkedForNoCompaction, garbageCollectedBlocks prometheus.Counter, _ prometheus.Gauge, _ prometheus.Counter, _ prometheus.Counter, _ *ring.Ring, _ *ring.Lifecycler, _ Limits, _ string, _ *compact.GatherNoCompactionMarkFilter) compact.Grouper {
+	errInvalidVerificationSampleRate = errors.New("invalid verification sample rate, the value must be between 0 and 1")
+	errInvalidCompactionOrder        = errors.New("the newest-first compaction order is only supported by the shuffle-sharding strategy")
+
+	DefaultBlocksGrouperFactory = func(ctx context.Context, cfg Config, bkt objstore.InstrumentedBucket, logger log.Logger, reg prometheus.Registerer, blocksMarkedForDeletion, blocksMarkedForNoCompaction, garbageCollectedBlocks prometheus.Counter, _ prometheus.Gauge, _ *prometheus.CounterVec, _ prometheus.Counter, _ prometheus.Counter, _ *ring.Ring, _ *ring.Lifecycler, _ Limits, _ string, _ *compact.GatherNoCompactionMarkFilter) compact.Grouper {
 		return compact.NewDefaultGrouper(
 			logger,
 			bkt,
@@ -70,7 +77,7 @@ var (
 			cfg.BlocksFetchConcurrency)
 	}
 
-	ShuffleShardingGrouperFactory = func(ctx context.Context, cfg Config, bkt objstore.InstrumentedBucket, logger log.Logger, reg prometheus.Registerer, blocksMarkedForDeletion, blocksMarkedForNoCompaction, garbageCollectedBlocks prometheus.Counter, remainingPlannedCompactions prometheus.Gauge, blockVisitMarkerReadFailed prometheus.Counter, blockVisitMarkerWriteFailed prometheus.Counter, ring *ring.Ring, ringLifecycle *ring.Lifecycler, limits Limits, userID string, noCompactionMarkFilter *compact.GatherNoCompactionMarkFilter) compact.Grouper {
+	ShuffleShardingGrouperFactory = func(ctx context.Context, cfg Config, bkt objstore.InstrumentedBucket, logger log.Logger, reg prometheus.Registerer, blocksMarkedForDeletion, blocksMarkedForNoCompaction, garbageCollectedBlocks prometheus.Counter, remainingPlannedCompactions prometheus.Gauge, sizeCappedCompactions *prometheus.CounterVec, blockVisitMarkerReadFailed prometheus.Counter, blockVisitMarkerWriteFailed prometheus.Counter, ring *ring.Ring, ringLifecycle *ring.Lifecycler, limits Limits, userID string, noCompactionMarkFilter *compact.GatherNoCompactionMarkFilter) compact.Grouper {
 		return NewShuffleShardingGrouper(
 			ctx,
 			logger,
@@ -82,6 +89,7 @@ var (
 			blocksMarkedForNoCompaction,
 			garbageCollectedBlocks,
 			remainingPlannedCompactions,
+			sizeCappedCompactions,
 			metadata.NoneFunc,
 			cfg,
 			ring,
@@ -104,8 +112,10 @@ var (
 			return nil, nil, err
 		}
 
+		sizeCappedCompactions := newSizeCappedCompactionsMetric(reg)
 		plannerFactory := func(ctx context.Context, bkt objstore.InstrumentedBucket, logger log.Logger, cfg Config, noCompactionMarkFilter *compact.GatherNoCompactionMarkFilter, ringLifecycle *ring.Lifecycler, _ prometheus.Counter, _ prometheus.Counter) compact.Planner {
-			return compact.NewPlanner(logger, cfg.BlockRanges.ToMilliseconds(), noCompactionMarkFilter)
+			planner := compact.NewPlanner(logger, cfg.BlockRanges.ToMilliseconds(), noCompactionMarkFilter)
+			return NewSizeCappedPlanner(planner, logger, cfg.MaxOutputBlockSizeBytes, sizeCappedCompactions)
 		}
 
 		return compactor, plannerFactory, nil
@@ -119,6 +129,7 @@ var (
 
 		plannerFactory := func(ctx context.Context, bkt objstore.InstrumentedBucket, logger log.Logger, cfg Config, noCompactionMarkFilter *compact.GatherNoCompactionMarkFilter, ringLifecycle *ring.Lifecycler, blockVisitMarkerReadFailed prometheus.Counter, blockVisitMarkerWriteFailed prometheus.Counter) compact.Planner {
 
+			// The groups are already capped to the max output block size by the shuffle sharding grouper.
 			return NewShuffleShardingPlanner(ctx, bkt, logger, cfg.BlockRanges.ToMilliseconds(), noCompactionMarkFilter.NoCompactMarkedBlocks, ringLifecycle.ID, cfg.BlockVisitMarkerTimeout, cfg.BlockVisitMarkerFileUpdateInterval, blockVisitMarkerReadFailed, blockVisitMarkerWriteFailed)
 		}
 		return compactor, plannerFactory, nil
@@ -136,6 +147,7 @@ type BlocksGrouperFactory func(
 	blocksMarkedForNoCompact prometheus.Counter,
 	garbageCollectedBlocks prometheus.Counter,
 	remainingPlannedCompactions prometheus.Gauge,
+	sizeCappedCompactions *prometheus.CounterVec,
 	blockVisitMarkerReadFailed prometheus.Counter,
 	blockVisitMarkerWriteFailed prometheus.Counter,
 	ring *ring.Ring,
@@ -167,6 +179,7 @@ type PlannerFactory func(
 // Limits defines limits used by the Compactor.
 type Limits interface {
 	CompactorTenantShardSize(userID string) int
+	CompactorCompactionOrder(userID string) string
 }
 
 // Config holds the Compactor config.
@@ -179,13 +192,23 @@ type Config struct {
 	CompactionInterval                    time.Duration            `yaml:"compaction_interval"`
 	CompactionRetries                     int                      `yaml:"compaction_retries"`
 	CompactionConcurrency                 int                      `yaml:"compaction_concurrency"`
+	TenantConcurrency                     int                      `yaml:"tenant_concurrency"`
 	CleanupInterval                       time.Duration            `yaml:"cleanup_interval"`
 	CleanupConcurrency                    int                      `yaml:"cleanup_concurrency"`
 	DeletionDelay                         time.Duration            `yaml:"deletion_delay"`
 	TenantCleanupDelay                    time.Duration            `yaml:"tenant_cleanup_delay"`
+	TenantDeletionGracePeriod             time.Duration            `yaml:"tenant_deletion_grace_period"`
 	SkipBlocksWithOutOfOrderChunksEnabled bool                     `yaml:"skip_blocks_with_out_of_order_chunks_enabled"`
 	BlockFilesConcurrency                 int                      `yaml:"block_files_concurrency"`
 	BlocksFetchConcurrency                int                      `yaml:"blocks_fetch_concurrency"`
+	MaxOutputBlockSizeBytes               int64                    `yaml:"max_output_block_size_bytes"`
+
+	// Bounds of the valid block time ranges.
+	BlockMaxTimeFutureMargin time.Duration `yaml:"block_max_time_future_margin"`
+	BlockMinTimeMaxAge       time.Duration `yaml:"block_min_time_max_age"`
+
+	// Compaction lag above which the compactor is not ready.
+	CompactionLagThreshold time.Duration `yaml:"compaction_lag_threshold"`
 
 	// Whether the migration of block deletion marks to the global markers location is enabled.
 	BlockDeletionMarksMigrationEnabled bool `yaml:"block_deletion_marks_migration_enabled"`
@@ -193,6 +216,9 @@ type Config struct {
 	EnabledTenants  flagext.StringSliceCSV `yaml:"enabled_tenants"`
 	DisabledTenants flagext.StringSliceCSV `yaml:"disabled_tenants"`
 
+	// Returns the tenants excluded from compaction at runtime, without restarting the compactor.
+	RuntimeDisabledTenantsFn func() []string `yaml:"-"`
+
 	// Compactors sharding.
 	ShardingEnabled  bool       `yaml:"sharding_enabled"`
 	ShardingStrategy string     `yaml:"sharding_strategy"`
@@ -214,6 +240,9 @@ type Config struct {
 
 	AcceptMalformedIndex bool `yaml:"accept_malformed_index"`
 	CachingBucketEnabled bool `yaml:"caching_bucket_enabled"`
+
+	// Fraction of the compacted blocks verified once uploaded.
+	VerificationSampleRate float64 `yaml:"verification_sample_rate"`
 }
 
 // RegisterFlags registers the Compactor flags.
@@ -232,6 +261,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.CompactionInterval, "compactor.compaction-interval", time.Hour, "The frequency at which the compaction runs")
 	f.IntVar(&cfg.CompactionRetries, "compactor.compaction-retries", 3, "How many times to retry a failed compaction within a single compaction run.")
 	f.IntVar(&cfg.CompactionConcurrency, "compactor.compaction-concurrency", 1, "Max number of concurrent compactions running.")
+	f.IntVar(&cfg.TenantConcurrency, "compactor.tenant-concurrency", 1, "[Experimental] Max number of tenants compacted concurrently. The compactions of each tenant run with up to -compactor.compaction-concurrency concurrency, so the compactor runs up to the product of the two concurrencies compactions at the same time.")
 	f.DurationVar(&cfg.CleanupInterval, "compactor.cleanup-interval", 15*time.Minute, "How frequently compactor should run blocks cleanup and maintenance, as well as update the bucket index.")
 	f.IntVar(&cfg.CleanupConcurrency, "compactor.cleanup-concurrency", 20, "Max number of tenants for which blocks cleanup and maintenance should run concurrently.")
 	f.BoolVar(&cfg.ShardingEnabled, "compactor.sharding-enabled", false, "Shard tenants across multiple compactor instances. Sharding is required if you run multiple compactor instances, in order to coordinate compactions and avoid race conditions leading to the same tenant blocks simultaneously compacted by different instances.")
@@ -240,10 +270,16 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 		"If not 0, blocks will be marked for deletion and compactor component will permanently delete blocks marked for deletion from the bucket. "+
 		"If 0, blocks will be deleted straight away. Note that deleting blocks immediately can cause query failures.")
 	f.DurationVar(&cfg.TenantCleanupDelay, "compactor.tenant-cleanup-delay", 6*time.Hour, "For tenants marked for deletion, this is time between deleting of last block, and doing final cleanup (marker files, debug files) of the tenant.")
+	f.DurationVar(&cfg.TenantDeletionGracePeriod, "compactor.tenant-deletion-grace-period", 0, "[Experimental] For tenants marked for deletion, this is the time between the tenant being marked for deletion and its blocks and bucket index being deleted. Removing the tenant deletion mark within this period cancels the deletion of the blocks in the storage, but not of the data not shipped yet: the ingesters stop shipping the blocks of the tenant and delete its local TSDB as soon as the tenant is marked for deletion, regardless of this period. 0 to delete the blocks as soon as the tenant is marked for deletion.")
 	f.BoolVar(&cfg.BlockDeletionMarksMigrationEnabled, "compactor.block-deletion-marks-migration-enabled", false, "When enabled, at compactor startup the bucket will be scanned and all found deletion marks inside the block location will be copied to the markers global location too. This option can (and should) be safely disabled as soon as the compactor has successfully run at least once.")
 	f.BoolVar(&cfg.SkipBlocksWithOutOfOrderChunksEnabled, "compactor.skip-blocks-with-out-of-order-chunks-enabled", false, "When enabled, mark blocks containing index with out-of-order chunks for no compact instead of halting the compaction.")
 	f.IntVar(&cfg.BlockFilesConcurrency, "compactor.block-files-concurrency", 10, "Number of goroutines to use when fetching/uploading block files from object storage.")
 	f.IntVar(&cfg.BlocksFetchConcurrency, "compactor.blocks-fetch-concurrency", 3, "Number of goroutines to use when fetching blocks from object storage when compacting.")
+	f.Int64Var(&cfg.MaxOutputBlockSizeBytes, "compactor.max-output-block-size-bytes", 0, "The maximum estimated size of a block resulting from a compaction, computed as the sum of the input blocks size. A compaction exceeding it is split to only compact the oldest blocks fitting within the limit, or skipped if less than 2 blocks fit. 0 to disable.")
+	f.DurationVar(&cfg.BlockMaxTimeFutureMargin, "compactor.block-max-time-future-margin", 0, "[Experimental] Blocks whose max time is further in the future than this margin have an invalid time range. The blocks with an invalid time range are excluded from the compaction planning, and the ones whose min time is not before the max time are also marked for no compaction. 0 to disable the check.")
+	f.DurationVar(&cfg.BlockMinTimeMaxAge, "compactor.block-min-time-max-age", 0, "[Experimental] Blocks whose min time is older than this age have an invalid time range. The blocks with an invalid time range are excluded from the compaction planning, and the ones whose min time is not before the max time are also marked for no compaction. 0 to disable the check.")
+
+	f.DurationVar(&cfg.CompactionLagThreshold, "compactor.compaction-lag-threshold", 0, "[Experimental] The compactor is reported as not ready when the compaction lag of any tenant it owns, computed as the age of the oldest block of the tenant waiting to be compacted, exceeds this threshold. The lag is always exposed by the cortex_compactor_tenant_compaction_lag_seconds metric. 0 to disable the readiness check.")
 
 	f.Var(&cfg.EnabledTenants, "compactor.enabled-tenants", "Comma separated list of tenants that can be compacted. If specified, only these tenants will be compacted by compactor, otherwise all tenants can be compacted. Subject to sharding.")
 	f.Var(&cfg.DisabledTenants, "compactor.disabled-tenants", "Comma separated list of tenants that cannot be compacted by this compactor. If specified, and compactor would normally pick given tenant for compaction (via -compactor.enabled-tenants or sharding), it will be ignored instead.")
@@ -253,6 +289,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 
 	f.BoolVar(&cfg.AcceptMalformedIndex, "compactor.accept-malformed-index", false, "When enabled, index verification will ignore out of order label names.")
 	f.BoolVar(&cfg.CachingBucketEnabled, "compactor.caching-bucket-enabled", false, "When enabled, caching bucket will be used for compactor, except cleaner service, which serves as the source of truth for block status")
+	f.Float64Var(&cfg.VerificationSampleRate, "compactor.verification-sample-rate", 0, "[Experimental] Fraction of the blocks resulting from a compaction whose index is downloaded back once uploaded, and verified before the source blocks are marked for deletion. A block failing the verification is marked for deletion instead, and its source blocks are compacted again. The verified blocks are evenly spread: with a rate of 0.1, every 10th compaction is verified. 0 to disable the verification, 1 to verify all the compactions.")
 }
 
 func (cfg *Config) Validate(limits validation.Limits) error {
@@ -279,6 +316,20 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		}
 	}
 
+	if cfg.TenantConcurrency <= 0 {
+		return errInvalidTenantConcurrency
+	}
+
+	if cfg.VerificationSampleRate < 0 || cfg.VerificationSampleRate > 1 {
+		return errInvalidVerificationSampleRate
+	}
+
+	// The default grouper compacts all the blocks of a tenant in a single group, so the order
+	// of the time ranges can't be chosen.
+	if limits.CompactorCompactionOrder == validation.CompactionOrderNewestFirst && cfg.ShardingStrategy != util.ShardingStrategyShuffle {
+		return errInvalidCompactionOrder
+	}
+
 	return nil
 }
 
@@ -335,18 +386,31 @@ type Compactor struct {
 	compactionRunsLastSuccess      prometheus.Gauge
 	compactionRunDiscoveredTenants prometheus.Gauge
 	compactionRunSkippedTenants    prometheus.Gauge
+	compactionRunDisabledTenants   prometheus.Counter
 	compactionRunSucceededTenants  prometheus.Gauge
 	compactionRunFailedTenants     prometheus.Gauge
 	compactionRunInterval          prometheus.Gauge
 	blocksMarkedForDeletion        prometheus.Counter
 	blocksMarkedForNoCompaction    prometheus.Counter
+	blocksInvalidTimeRange         prometheus.Counter
 	garbageCollectedBlocks         prometheus.Counter
 	remainingPlannedCompactions    prometheus.Gauge
+	sizeCappedCompactions          *prometheus.CounterVec
 	blockVisitMarkerReadFailed     prometheus.Counter
 	blockVisitMarkerWriteFailed    prometheus.Counter
+	tenantWorkers                  prometheus.Gauge
+	tenantWorkersBusy              prometheus.Gauge
+	compactionWorkers              prometheus.Gauge
+	compactionWorkersBusy          prometheus.Gauge
 
 	// TSDB syncer metrics
 	syncerMetrics *syncerMetrics
+
+	// Compaction lag of the tenants owned by this compactor.
+	compactionLag *compactionLagTracker
+
+	// Verifies a sample of the compacted blocks.
+	compactionVerifier *compactionVerifier
 }
 
 // NewCompactor makes a new Compactor.
@@ -392,11 +456,13 @@ func newCompactor(
 	limits *validation.Overrides,
 ) (*Compactor, error) {
 	var remainingPlannedCompactions prometheus.Gauge
+	var sizeCappedCompactions *prometheus.CounterVec
 	if compactorCfg.ShardingStrategy == util.ShardingStrategyShuffle {
 		remainingPlannedCompactions = promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
 			Name: "cortex_compactor_remaining_planned_compactions",
 			Help: "Total number of plans that remain to be compacted. Only available with shuffle-sharding strategy",
 		})
+		sizeCappedCompactions = newSizeCappedCompactionsMetric(registerer)
 	}
 	c := &Compactor{
 		compactorCfg:           compactorCfg,
@@ -405,6 +471,8 @@ func newCompactor(
 		logger:                 log.With(logger, "component", "compactor"),
 		registerer:             registerer,
 		syncerMetrics:          newSyncerMetrics(registerer),
+		compactionLag:          newCompactionLagTracker(registerer),
+		compactionVerifier:     newCompactionVerifier(compactorCfg.VerificationSampleRate, compactorCfg.AcceptMalformedIndex, registerer),
 		bucketClientFactory:    bucketClientFactory,
 		blocksGrouperFactory:   blocksGrouperFactory,
 		blocksCompactorFactory: blocksCompactorFactory,
@@ -442,6 +510,10 @@ func newCompactor(
 			Name: "cortex_compactor_tenants_skipped",
 			Help: "Number of tenants skipped during the current compaction run. Reset to 0 when compactor is idle.",
 		}),
+		compactionRunDisabledTenants: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_runtime_disabled_tenants_skipped_total",
+			Help: "Total number of times a tenant has been skipped by a compaction run because its compaction is disabled in the runtime config.",
+		}),
 		compactionRunSucceededTenants: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
 			Name: "cortex_compactor_tenants_processing_succeeded",
 			Help: "Number of tenants successfully processed during the current compaction run. Reset to 0 when compactor is idle.",
@@ -463,6 +535,10 @@ func newCompactor(
 			Name: "cortex_compactor_blocks_marked_for_no_compaction_total",
 			Help: "Total number of blocks marked for no compact during a compaction run.",
 		}),
+		blocksInvalidTimeRange: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_blocks_invalid_time_range_total",
+			Help: "Total number of blocks whose min time is not before the max time marked for no compaction.",
+		}),
 		garbageCollectedBlocks: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_compactor_garbage_collected_blocks_total",
 			Help: "Total number of blocks marked for deletion by compactor.",
@@ -475,7 +551,24 @@ func newCompactor(
 			Name: "cortex_compactor_block_visit_marker_write_failed",
 			Help: "Number of block visit marker file failed to be written.",
 		}),
+		tenantWorkers: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_compactor_tenant_workers",
+			Help: "Maximum number of tenants compacted concurrently.",
+		}),
+		tenantWorkersBusy: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_compactor_tenant_workers_busy",
+			Help: "Number of tenants currently being compacted.",
+		}),
+		compactionWorkers: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_compactor_compaction_workers",
+			Help: "Maximum number of compactions running concurrently, across all tenants.",
+		}),
+		compactionWorkersBusy: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_compactor_compaction_workers_busy",
+			Help: "Number of compactions currently running, across all tenants.",
+		}),
 		remainingPlannedCompactions: remainingPlannedCompactions,
+		sizeCappedCompactions:       sizeCappedCompactions,
 		limits:                      limits,
 	}
 
@@ -491,6 +584,9 @@ func newCompactor(
 	// The last successful compaction run metric is exposed as seconds since epoch, so we need to use seconds for this metric.
 	c.compactionRunInterval.Set(c.compactorCfg.CompactionInterval.Seconds())
 
+	c.tenantWorkers.Set(float64(c.compactorCfg.TenantConcurrency))
+	c.compactionWorkers.Set(float64(c.compactorCfg.TenantConcurrency * c.compactorCfg.CompactionConcurrency))
+
 	return c, nil
 }
 
@@ -515,6 +611,7 @@ func (c *Compactor) starting(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize compactor dependencies")
 	}
+	c.blocksCompactor = newBusyTrackingCompactor(c.blocksCompactor, c.compactionWorkersBusy)
 
 	// Wrap the bucket client to write block deletion marks in the global location too.
 	c.bucketClient = bucketindex.BucketWithGlobalMarkers(c.bucketClient)
@@ -529,6 +626,7 @@ func (c *Compactor) starting(ctx context.Context) error {
 		CleanupConcurrency:                 c.compactorCfg.CleanupConcurrency,
 		BlockDeletionMarksMigrationEnabled: c.compactorCfg.BlockDeletionMarksMigrationEnabled,
 		TenantCleanupDelay:                 c.compactorCfg.TenantCleanupDelay,
+		TenantDeletionGracePeriod:          c.compactorCfg.TenantDeletionGracePeriod,
 	}, c.bucketClient, c.usersScanner, c.limits, c.parentLogger, c.registerer)
 
 	// Initialize the compactors ring if sharding is enabled.
@@ -689,11 +787,17 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 	})
 
 	// Keep track of users owned by this shard, so that we can delete the local files for all other users.
-	ownedUsers := map[string]struct{}{}
-	for _, userID := range users {
+	var (
+		ownedUsersMx sync.Mutex
+		ownedUsers   = map[string]struct{}{}
+		failedRun    = atomic.NewBool(false)
+		interruptRun = atomic.NewBool(false)
+	)
+
+	compactUser := func(userID string) {
 		// Ensure the context has not been canceled (ie. compactor shutdown has been triggered).
 		if ctx.Err() != nil {
-			interrupted = true
+			interruptRun.Store(true)
 			level.Info(c.logger).Log("msg", "interrupting compaction of user blocks", "user", userID)
 			return
 		}
@@ -702,11 +806,11 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 		if owned, err := c.ownUserForCompaction(userID); err != nil {
 			c.compactionRunSkippedTenants.Inc()
 			level.Warn(c.logger).Log("msg", "unable to check if user is owned by this shard", "user", userID, "err", err)
-			continue
+			return
 		} else if !owned {
 			c.compactionRunSkippedTenants.Inc()
 			level.Debug(c.logger).Log("msg", "skipping user because it is not owned by this shard", "user", userID)
-			continue
+			return
 		}
 
 		// Skipping compaction if the  bucket index failed to sync due to CMK errors.
@@ -714,42 +818,92 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 			if idxs.Status == bucketindex.CustomerManagedKeyError {
 				c.compactionRunSkippedTenants.Inc()
 				level.Info(c.logger).Log("msg", "skipping compactUser due CustomerManagedKeyError", "user", userID)
-				continue
+				return
 			}
 		}
 
+		ownedUsersMx.Lock()
 		ownedUsers[userID] = struct{}{}
+		ownedUsersMx.Unlock()
+
+		// The tenants disabled at runtime are still owned, so that their local files are kept, but
+		// their compaction lag is not tracked, so that they can't mark the compactor as not ready.
+		if c.isRuntimeDisabledUser(userID) {
+			c.compactionRunSkippedTenants.Inc()
+			c.compactionRunDisabledTenants.Inc()
+			c.compactionLag.remove(userID)
+			level.Info(c.logger).Log("msg", "skipping user because its compaction is disabled in the runtime config", "user", userID)
+			return
+		}
 
 		if markedForDeletion, err := cortex_tsdb.TenantDeletionMarkExists(ctx, c.bucketClient, userID); err != nil {
 			c.compactionRunSkippedTenants.Inc()
 			level.Warn(c.logger).Log("msg", "unable to check if user is marked for deletion", "user", userID, "err", err)
-			continue
+			return
 		} else if markedForDeletion {
 			c.compactionRunSkippedTenants.Inc()
+			c.compactionLag.remove(userID)
 			level.Debug(c.logger).Log("msg", "skipping user because it is marked for deletion", "user", userID)
-			continue
+			return
 		}
 
 		level.Info(c.logger).Log("msg", "starting compaction of user blocks", "user", userID)
 
-		if err = c.compactUserWithRetries(ctx, userID); err != nil {
+		c.tenantWorkersBusy.Inc()
+		defer c.tenantWorkersBusy.Dec()
+
+		if err := c.compactUserWithRetries(ctx, userID); err != nil {
 			// TODO: patch thanos error types to support errors.Is(err, context.Canceled) here
 			if ctx.Err() != nil && ctx.Err() == context.Canceled {
-				interrupted = true
+				interruptRun.Store(true)
 				level.Info(c.logger).Log("msg", "interrupting compaction of user blocks", "user", userID)
 				return
 			}
 
 			c.compactionRunFailedTenants.Inc()
-			failed = true
+			failedRun.Store(true)
 			level.Error(c.logger).Log("msg", "failed to compact user blocks", "user", userID, "err", err)
-			continue
+			return
 		}
 
 		c.compactionRunSucceededTenants.Inc()
 		level.Info(c.logger).Log("msg", "successfully compacted user blocks", "user", userID)
 	}
 
+	// Users are compacted by a pool of workers, each one compacting a single user at a time.
+	usersCh := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < c.compactorCfg.TenantConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range usersCh {
+				compactUser(userID)
+			}
+		}()
+	}
+
+	for _, userID := range users {
+		// Stop dispatching users once the run has been interrupted.
+		if interruptRun.Load() {
+			break
+		}
+		usersCh <- userID
+	}
+	close(usersCh)
+	wg.Wait()
+
+	failed = failedRun.Load()
+	if interruptRun.Load() {
+		interrupted = true
+		return
+	}
+
+	// Stop tracking the compaction lag of the tenants not owned anymore, and refresh the lag of
+	// the tenants whose compaction failed.
+	c.compactionLag.removeAllExcept(ownedUsers)
+	c.compactionLag.refresh(time.Now())
+
 	// Delete local files for unowned tenants, if there are any. This cleans up
 	// leftover local files for tenants that belong to different compactors now,
 	// or have been deleted completely.
@@ -778,6 +932,15 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 	}
 }
 
+// CheckReady returns an error if the compaction lag of any tenant owned by the compactor exceeds
+// the configured threshold, so that the compactor falling behind is reported as not ready.
+func (c *Compactor) CheckReady(_ context.Context) error {
+	if c.compactorCfg.CompactionLagThreshold <= 0 {
+		return nil
+	}
+	return c.compactionLag.checkLag(c.compactorCfg.CompactionLagThreshold, time.Now())
+}
+
 func (c *Compactor) compactUserWithRetries(ctx context.Context, userID string) error {
 	var lastErr error
 
@@ -827,6 +990,23 @@ func (c *Compactor) compactUser(ctx context.Context, userID string) error {
 	// out of order chunks or index file too big.
 	noCompactMarkerFilter := compact.NewGatherNoCompactionMarkFilter(ulogger, bucket, c.compactorCfg.MetaSyncConcurrency)
 
+	// List of filters to apply (order matters).
+	filters := []block.MetadataFilter{
+		// Remove the ingester ID because we don't shard blocks anymore, while still
+		// honoring the shard ID if sharding was done in the past. Remove the shard of the
+		// blocks split by the ingester too, so that the shards are merged back together.
+		NewLabelRemoverFilter([]string{cortex_tsdb.IngesterIDExternalLabel, cortex_tsdb.ShardExternalLabel}),
+		block.NewConsistencyDelayMetaFilter(ulogger, c.compactorCfg.ConsistencyDelay, reg),
+		ignoreDeletionMarkFilter,
+		deduplicateBlocksFilter,
+		noCompactMarkerFilter,
+	}
+
+	if c.compactorCfg.BlockMaxTimeFutureMargin > 0 || c.compactorCfg.BlockMinTimeMaxAge > 0 {
+		// Must be after the no compaction mark filter, to not mark the blocks again.
+		filters = append(filters, NewBlockTimeRangeFilter(ulogger, bucket, c.compactorCfg.BlockMaxTimeFutureMargin, c.compactorCfg.BlockMinTimeMaxAge, noCompactMarkerFilter.NoCompactMarkedBlocks, c.blocksInvalidTimeRange, c.blocksMarkedForNoCompaction))
+	}
+
 	var blockLister block.Lister
 	switch cortex_tsdb.BlockDiscoveryStrategy(c.storageCfg.BucketStore.BlockDiscoveryStrategy) {
 	case cortex_tsdb.ConcurrentDiscovery:
@@ -849,16 +1029,7 @@ func (c *Compactor) compactUser(ctx context.Context, userID string) error {
 		blockLister,
 		c.metaSyncDirForUser(userID),
 		reg,
-		// List of filters to apply (order matters).
-		[]block.MetadataFilter{
-			// Remove the ingester ID because we don't shard blocks anymore, while still
-			// honoring the shard ID if sharding was done in the past.
-			NewLabelRemoverFilter([]string{cortex_tsdb.IngesterIDExternalLabel}),
-			block.NewConsistencyDelayMetaFilter(ulogger, c.compactorCfg.ConsistencyDelay, reg),
-			ignoreDeletionMarkFilter,
-			deduplicateBlocksFilter,
-			noCompactMarkerFilter,
-		},
+		filters,
 	)
 	if err != nil {
 		return err
@@ -880,12 +1051,24 @@ func (c *Compactor) compactUser(ctx context.Context, userID string) error {
 
 	currentCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	compactor, err := compact.NewBucketCompactor(
+
+	// The verifier checks the sampled compacted blocks before their source blocks are marked for deletion.
+	blocksCompactor := c.blocksCompactor
+	var blockDeletableChecker compact.BlockDeletableChecker = compact.DefaultBlockDeletableChecker{}
+	var compactionLifecycleCallback compact.CompactionLifecycleCallback = compact.DefaultCompactionLifecycleCallback{}
+	if c.compactorCfg.VerificationSampleRate > 0 {
+		verifier := c.compactionVerifier.forTenant(currentCtx, ulogger, c.blocksCompactor, bucket, filepath.Join(c.compactDirForUser(userID), "verify"), c.blocksMarkedForDeletion)
+		blocksCompactor, blockDeletableChecker, compactionLifecycleCallback = verifier, verifier, verifier
+	}
+
+	compactor, err := compact.NewBucketCompactorWithCheckerAndCallback(
 		ulogger,
 		syncer,
-		c.blocksGrouperFactory(currentCtx, c.compactorCfg, bucket, ulogger, reg, c.blocksMarkedForDeletion, c.blocksMarkedForNoCompaction, c.garbageCollectedBlocks, c.remainingPlannedCompactions, c.blockVisitMarkerReadFailed, c.blockVisitMarkerWriteFailed, c.ring, c.ringLifecycler, c.limits, userID, noCompactMarkerFilter),
+		c.blocksGrouperFactory(currentCtx, c.compactorCfg, bucket, ulogger, reg, c.blocksMarkedForDeletion, c.blocksMarkedForNoCompaction, c.garbageCollectedBlocks, c.remainingPlannedCompactions, c.sizeCappedCompactions, c.blockVisitMarkerReadFailed, c.blockVisitMarkerWriteFailed, c.ring, c.ringLifecycler, c.limits, userID, noCompactMarkerFilter),
 		c.blocksPlannerFactory(currentCtx, bucket, ulogger, c.compactorCfg, noCompactMarkerFilter, c.ringLifecycler, c.blockVisitMarkerReadFailed, c.blockVisitMarkerWriteFailed),
-		c.blocksCompactor,
+		blocksCompactor,
+		blockDeletableChecker,
+		compactionLifecycleCallback,
 		c.compactDirForUser(userID),
 		bucket,
 		c.compactorCfg.CompactionConcurrency,
@@ -899,11 +1082,20 @@ func (c *Compactor) compactUser(ctx context.Context, userID string) error {
 		return errors.Wrap(err, "compaction")
 	}
 
+	// The metas are synced at the beginning of each compaction iteration, so after the last
+	// iteration they include the blocks which are still waiting to be compacted.
+	c.compactionLag.update(userID, syncer.Metas(), c.compactorCfg.BlockRanges.ToMilliseconds(), time.Now())
+
 	// Remove all files on the compact root dir
 	// We do this only if there is no error because potentially on the next run we would not have to download
-	// everything again.
-	if err := os.RemoveAll(c.compactRootDir()); err != nil {
-		level.Error(c.logger).Log("msg", "failed to remove compaction work directory", "path", c.compactRootDir(), "err", err)
+	// everything again. When tenants are compacted concurrently, only the tenant directory is removed to not
+	// interfere with the compactions of other tenants.
+	compactDir := c.compactRootDir()
+	if c.compactorCfg.TenantConcurrency > 1 {
+		compactDir = c.compactDirForUser(userID)
+	}
+	if err := os.RemoveAll(compactDir); err != nil {
+		level.Error(c.logger).Log("msg", "failed to remove compaction work directory", "path", compactDir, "err", err)
 	}
 
 	return nil
@@ -943,6 +1135,14 @@ func (c *Compactor) discoverUsers(ctx context.Context) ([]string, error) {
 	return users, err
 }
 
+// isRuntimeDisabledUser returns whether the compaction of the user is disabled in the runtime config.
+func (c *Compactor) isRuntimeDisabledUser(userID string) bool {
+	if c.compactorCfg.RuntimeDisabledTenantsFn == nil {
+		return false
+	}
+	return slices.Contains(c.compactorCfg.RuntimeDisabledTenantsFn(), userID)
+}
+
 func (c *Compactor) ownUserForCompaction(userID string) (bool, error) {
 	return c.ownUser(userID, false)
 }
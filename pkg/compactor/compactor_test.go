@@ -14,6 +14,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -31,6 +32,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
+	"go.uber.org/atomic"
 	"gopkg.in/yaml.v2"
 
 	"github.com/cortexproject/cortex/pkg/ring"
@@ -140,6 +142,40 @@ func TestConfig_Validate(t *testing.T) {
 			initLimits: func(_ *validation.Limits) {},
 			expected:   errInvalidTenantShardSize.Error(),
 		},
+		"should fail with non-positive tenant concurrency": {
+			setup: func(cfg *Config) {
+				cfg.TenantConcurrency = 0
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidTenantConcurrency.Error(),
+		},
+		"should fail with verification sample rate above 1": {
+			setup: func(cfg *Config) {
+				cfg.VerificationSampleRate = 1.5
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidVerificationSampleRate.Error(),
+		},
+		"should fail with the newest-first compaction order and the default sharding strategy": {
+			setup: func(cfg *Config) {
+				cfg.ShardingStrategy = util.ShardingStrategyDefault
+			},
+			initLimits: func(limits *validation.Limits) {
+				limits.CompactorCompactionOrder = validation.CompactionOrderNewestFirst
+			},
+			expected: errInvalidCompactionOrder.Error(),
+		},
+		"should pass with the newest-first compaction order and the shuffle-sharding strategy": {
+			setup: func(cfg *Config) {
+				cfg.ShardingStrategy = util.ShardingStrategyShuffle
+				cfg.ShardingEnabled = true
+			},
+			initLimits: func(limits *validation.Limits) {
+				limits.CompactorTenantShardSize = 1
+				limits.CompactorCompactionOrder = validation.CompactionOrderNewestFirst
+			},
+			expected: "",
+		},
 	}
 
 	for testName, testData := range tests {
@@ -193,6 +229,52 @@ func TestCompactor_SkipCompactionWhenCmkError(t *testing.T) {
 	assert.Contains(t, strings.Split(strings.TrimSpace(logs.String()), "\n"), `level=info component=compactor msg="skipping compactUser due CustomerManagedKeyError" user=user-1`)
 }
 
+func TestCompactor_ShouldSkipUsersDisabledAtRuntime(t *testing.T) {
+	t.Parallel()
+
+	// No user blocks stored in the bucket.
+	bucketClient := &bucket.ClientMock{}
+	bucketClient.MockIter("", []string{"user-1", "user-2"}, nil)
+	bucketClient.MockIter("__markers__", []string{}, nil)
+	for _, userID := range []string{"user-1", "user-2"} {
+		bucketClient.MockIter(userID+"/", []string{}, nil)
+		bucketClient.MockIter(userID+"/markers/", nil, nil)
+		bucketClient.MockGet(userID+"/bucket-index-sync-status.json", "", nil)
+		bucketClient.MockGet(userID+"/bucket-index.json.gz", "", nil)
+		bucketClient.MockUpload(userID+"/bucket-index-sync-status.json", nil)
+		bucketClient.MockUpload(userID+"/bucket-index.json.gz", nil)
+		bucketClient.MockExists(cortex_tsdb.GetGlobalDeletionMarkPath(userID), false, nil)
+		bucketClient.MockExists(cortex_tsdb.GetLocalDeletionMarkPath(userID), false, nil)
+	}
+
+	cfg := prepareConfig()
+	cfg.RuntimeDisabledTenantsFn = func() []string { return []string{"user-1"} }
+	c, _, _, logs, registry := prepare(t, cfg, bucketClient, nil)
+
+	// The compaction lag of the tenant, tracked before its compaction was disabled, is no longer tracked.
+	c.compactionLag.oldest["user-1"] = time.Now().Add(-24 * time.Hour)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+
+	// Wait until a run has completed.
+	cortex_testutil.Poll(t, time.Second, 1.0, func() interface{} {
+		return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+	})
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+
+	logLines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Contains(t, logLines, `level=info component=compactor msg="skipping user because its compaction is disabled in the runtime config" user=user-1`)
+	assert.NotContains(t, logLines, `level=info component=compactor msg="starting compaction of user blocks" user=user-1`)
+	assert.Contains(t, logLines, `level=info component=compactor msg="starting compaction of user blocks" user=user-2`)
+	assert.Empty(t, c.compactionLag.laggingTenants(0, time.Now()))
+
+	assert.NoError(t, prom_testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_compactor_runtime_disabled_tenants_skipped_total Total number of times a tenant has been skipped by a compaction run because its compaction is disabled in the runtime config.
+		# TYPE cortex_compactor_runtime_disabled_tenants_skipped_total counter
+		cortex_compactor_runtime_disabled_tenants_skipped_total 1
+	`), "cortex_compactor_runtime_disabled_tenants_skipped_total"))
+}
+
 func TestCompactor_ShouldDoNothingOnNoUserBlocks(t *testing.T) {
 	t.Parallel()
 
@@ -738,6 +820,86 @@ func TestCompactor_ShouldIterateOverUsersAndRunCompaction(t *testing.T) {
 	`), testedMetrics...))
 }
 
+func TestCompactor_ShouldCompactUsersConcurrently(t *testing.T) {
+	t.Parallel()
+
+	// Mock the bucket to contain two users, each one with two blocks.
+	blocks := map[string][]string{
+		"user-1": {"01DTVP434PA9VFXSW2JKB3392D", "01FN6CDF3PNEWWRY5MPGJPE3EX"},
+		"user-2": {"01DTW0ZCPDDNV4BV83Q2SV4QAZ", "01FN3V83ABR9992RF8WRJZ76ZQ"},
+	}
+	bucketClient := &bucket.ClientMock{}
+	bucketClient.MockIter("", []string{"user-1", "user-2"}, nil)
+	bucketClient.MockIter("__markers__", []string{}, nil)
+	for userID, blockIDs := range blocks {
+		var metas []string
+		for _, blockID := range blockIDs {
+			metas = append(metas, userID+"/"+blockID+"/meta.json")
+			bucketClient.MockGet(userID+"/"+blockID+"/meta.json", mockBlockMetaJSON(blockID), nil)
+			bucketClient.MockGet(userID+"/"+blockID+"/deletion-mark.json", "", nil)
+			bucketClient.MockGet(userID+"/"+blockID+"/no-compact-mark.json", "", nil)
+			bucketClient.MockGet(userID+"/"+blockID+"/visit-mark.json", "", nil)
+		}
+		bucketClient.MockExists(cortex_tsdb.GetGlobalDeletionMarkPath(userID), false, nil)
+		bucketClient.MockExists(cortex_tsdb.GetLocalDeletionMarkPath(userID), false, nil)
+		bucketClient.MockIter(userID+"/", metas, nil)
+		bucketClient.MockIter(userID+"/markers/", nil, nil)
+		bucketClient.MockGet(userID+"/bucket-index.json.gz", "", nil)
+		bucketClient.MockGet(userID+"/bucket-index-sync-status.json", "", nil)
+		bucketClient.MockUpload(userID+"/bucket-index.json.gz", nil)
+		bucketClient.MockUpload(userID+"/bucket-index-sync-status.json", nil)
+	}
+
+	cfg := prepareConfig()
+	cfg.TenantConcurrency = 2
+	c, _, tsdbPlanner, _, registry := prepare(t, cfg, bucketClient, nil)
+
+	// The planning of each user waits until both users are being compacted.
+	planning := sync.WaitGroup{}
+	planning.Add(2)
+	bothPlanning := make(chan struct{})
+	go func() {
+		planning.Wait()
+		close(bothPlanning)
+	}()
+
+	concurrent := atomic.NewBool(false)
+	tsdbPlanner.On("Plan", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+		planning.Done()
+		select {
+		case <-bothPlanning:
+			concurrent.Store(true)
+		case <-time.After(5 * time.Second):
+		}
+	}).Return([]*metadata.Meta{}, nil)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+
+	// Wait until a run has completed.
+	cortex_testutil.Poll(t, 15*time.Second, 1.0, func() interface{} {
+		return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+	})
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+
+	tsdbPlanner.AssertNumberOfCalls(t, "Plan", 2)
+	assert.True(t, concurrent.Load())
+
+	assert.NoError(t, prom_testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_compactor_tenant_workers Maximum number of tenants compacted concurrently.
+		# TYPE cortex_compactor_tenant_workers gauge
+		cortex_compactor_tenant_workers 2
+
+		# HELP cortex_compactor_tenant_workers_busy Number of tenants currently being compacted.
+		# TYPE cortex_compactor_tenant_workers_busy gauge
+		cortex_compactor_tenant_workers_busy 0
+
+		# HELP cortex_compactor_compaction_workers Maximum number of compactions running concurrently, across all tenants.
+		# TYPE cortex_compactor_compaction_workers gauge
+		cortex_compactor_compaction_workers 2
+	`), "cortex_compactor_tenant_workers", "cortex_compactor_tenant_workers_busy", "cortex_compactor_compaction_workers"))
+}
+
 func TestCompactor_ShouldNotCompactBlocksMarkedForDeletion(t *testing.T) {
 	t.Parallel()
 
@@ -1121,6 +1283,49 @@ func TestCompactor_ShouldSkipOutOrOrderBlocks(t *testing.T) {
 		`), "cortex_compactor_blocks_marked_for_no_compaction_total"))
 }
 
+func TestCompactor_ShouldCompactTheShardedBlocksTogether(t *testing.T) {
+	bucketClient, _ := cortex_storage_testutil.PrepareFilesystemBucket(t)
+	bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+	// The blocks split by the ingester in shards, with different shard counts, and the
+	// unsharded block are compacted together.
+	expected := []ulid.ULID{
+		createTSDBBlock(t, bucketClient, "user-1", 10, 20, map[string]string{cortex_tsdb.ShardExternalLabel: "1_of_2"}),
+		createTSDBBlock(t, bucketClient, "user-1", 10, 20, map[string]string{cortex_tsdb.ShardExternalLabel: "2_of_2"}),
+		createTSDBBlock(t, bucketClient, "user-1", 10, 20, map[string]string{cortex_tsdb.ShardExternalLabel: "1_of_4"}),
+		createTSDBBlock(t, bucketClient, "user-1", 10, 20, nil),
+	}
+
+	c, _, tsdbPlanner, _, _ := prepare(t, prepareConfig(), bucketClient, nil)
+
+	var (
+		plannedMtx sync.Mutex
+		planned    [][]ulid.ULID
+	)
+	tsdbPlanner.On("Plan", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		var blocks []ulid.ULID
+		for _, meta := range args.Get(1).([]*metadata.Meta) {
+			blocks = append(blocks, meta.ULID)
+		}
+		plannedMtx.Lock()
+		planned = append(planned, blocks)
+		plannedMtx.Unlock()
+	}).Return([]*metadata.Meta{}, nil)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	defer services.StopAndAwaitTerminated(context.Background(), c) //nolint:errcheck
+
+	// Wait until a run has completed.
+	cortex_testutil.Poll(t, 5*time.Second, 1.0, func() interface{} {
+		return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+	})
+
+	plannedMtx.Lock()
+	defer plannedMtx.Unlock()
+	require.Len(t, planned, 1)
+	assert.ElementsMatch(t, expected, planned[0])
+}
+
 func TestCompactor_ShouldCompactAllUsersOnShardingEnabledButOnlyOneInstanceRunning(t *testing.T) {
 	t.Parallel()
 
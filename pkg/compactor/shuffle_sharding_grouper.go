@@ -20,6 +20,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/compact"
 
 	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 type ShuffleShardingGrouper struct {
@@ -33,6 +34,7 @@ type ShuffleShardingGrouper struct {
 	blocksMarkedForNoCompact    prometheus.Counter
 	garbageCollectedBlocks      prometheus.Counter
 	remainingPlannedCompactions prometheus.Gauge
+	sizeCappedCompactions       *prometheus.CounterVec
 	hashFunc                    metadata.HashFunc
 	compactions                 *prometheus.CounterVec
 	compactionRunsStarted       *prometheus.CounterVec
@@ -68,6 +70,7 @@ func NewShuffleShardingGrouper(
 	blocksMarkedForNoCompact prometheus.Counter,
 	garbageCollectedBlocks prometheus.Counter,
 	remainingPlannedCompactions prometheus.Gauge,
+	sizeCappedCompactions *prometheus.CounterVec,
 	hashFunc metadata.HashFunc,
 	compactorCfg Config,
 	ring ring.ReadRing,
@@ -98,6 +101,7 @@ func NewShuffleShardingGrouper(
 		blocksMarkedForNoCompact:    blocksMarkedForNoCompact,
 		garbageCollectedBlocks:      garbageCollectedBlocks,
 		remainingPlannedCompactions: remainingPlannedCompactions,
+		sizeCappedCompactions:       sizeCappedCompactions,
 		hashFunc:                    hashFunc,
 		// Metrics are copied from Thanos DefaultGrouper constructor
 		compactions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
@@ -177,7 +181,10 @@ func (g *ShuffleShardingGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (re
 	// Ensure groups are sorted by smallest range, oldest min time first. The rationale
 	// is that we want to favor smaller ranges first (ie. to deduplicate samples sooner
 	// than later) and older ones are more likely to be "complete" (no missing block still
-	// to be uploaded).
+	// to be uploaded). Tenants can opt in to compact newest min time first, which only
+	// changes the order of groups with the same range, so smaller ranges are still
+	// compacted before bigger ones.
+	newestFirst := g.limits.CompactorCompactionOrder(g.userID) == validation.CompactionOrderNewestFirst
 	sort.SliceStable(groups, func(i, j int) bool {
 		iGroup := groups[i]
 		jGroup := groups[j]
@@ -192,6 +199,9 @@ func (g *ShuffleShardingGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (re
 			return iLength < jLength
 		}
 		if iMinTime != jMinTime {
+			if newestFirst {
+				return iMinTime > jMinTime
+			}
 			return iMinTime < jMinTime
 		}
 
@@ -227,6 +237,14 @@ mainLoop:
 			continue
 		}
 
+		// The group is capped before its blocks are marked as visited, so that the blocks left
+		// out of the compaction can be compacted by the other compactors in the meantime.
+		if g.compactorCfg.MaxOutputBlockSizeBytes > 0 {
+			if group.blocks = capToMaxOutputBlockSize(g.logger, group.blocks, g.compactorCfg.MaxOutputBlockSizeBytes, g.sizeCappedCompactions); len(group.blocks) < 2 {
+				continue
+			}
+		}
+
 		remainingCompactions++
 		groupKey := createGroupKey(groupHash, group)
 
@@ -115,6 +115,12 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 			},
 		}
 
+	withSize := func(m *metadata.Meta, size int64) *metadata.Meta {
+		sized := *m
+		sized.Thanos.Files = []metadata.File{{RelPath: "chunks/000001", SizeBytes: size}}
+		return &sized
+	}
+
 	testCompactorID := "test-compactor"
 	otherCompactorID := "other-compactor"
 
@@ -127,9 +133,11 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 			compactorID string
 			isExpired   bool
 		}
-		expected        [][]ulid.ULID
-		metrics         string
-		noCompactBlocks map[ulid.ULID]*metadata.NoCompactMark
+		expected                [][]ulid.ULID
+		metrics                 string
+		noCompactBlocks         map[ulid.ULID]*metadata.NoCompactMark
+		compactionOrder         string
+		maxOutputBlockSizeBytes int64
 	}{
 		"test basic grouping": {
 			concurrency: 3,
@@ -167,6 +175,35 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 			metrics: `# HELP cortex_compactor_remaining_planned_compactions Total number of plans that remain to be compacted.
         	          # TYPE cortex_compactor_remaining_planned_compactions gauge
         	          cortex_compactor_remaining_planned_compactions 3
+`,
+		},
+		"test smallest range first with newest-first compaction order": {
+			concurrency:     3,
+			ranges:          []time.Duration{2 * time.Hour, 4 * time.Hour},
+			blocks:          map[ulid.ULID]*metadata.Meta{block1hto2hExt1Ulid: blocks[block1hto2hExt1Ulid], block3hto4hExt1Ulid: blocks[block3hto4hExt1Ulid], block0hto1hExt1Ulid: blocks[block0hto1hExt1Ulid], block2hto3hExt1Ulid: blocks[block2hto3hExt1Ulid], block4hto6hExt2Ulid: blocks[block4hto6hExt2Ulid], block6hto8hExt2Ulid: blocks[block6hto8hExt2Ulid]},
+			compactionOrder: validation.CompactionOrderNewestFirst,
+			expected: [][]ulid.ULID{
+				{block3hto4hExt1Ulid, block2hto3hExt1Ulid},
+				{block1hto2hExt1Ulid, block0hto1hExt1Ulid},
+				{block4hto6hExt2Ulid, block6hto8hExt2Ulid},
+			},
+			metrics: `# HELP cortex_compactor_remaining_planned_compactions Total number of plans that remain to be compacted.
+        	          # TYPE cortex_compactor_remaining_planned_compactions gauge
+        	          cortex_compactor_remaining_planned_compactions 3
+`,
+		},
+		"test newest min time first": {
+			concurrency:     2,
+			ranges:          []time.Duration{2 * time.Hour, 4 * time.Hour},
+			blocks:          map[ulid.ULID]*metadata.Meta{block1hto2hExt1Ulid: blocks[block1hto2hExt1Ulid], block3hto4hExt1Ulid: blocks[block3hto4hExt1Ulid], block0hto1hExt1Ulid: blocks[block0hto1hExt1Ulid], block2hto3hExt1Ulid: blocks[block2hto3hExt1Ulid], block1hto2hExt1UlidCopy: blocks[block1hto2hExt1UlidCopy]},
+			compactionOrder: validation.CompactionOrderNewestFirst,
+			expected: [][]ulid.ULID{
+				{block3hto4hExt1Ulid, block2hto3hExt1Ulid},
+				{block1hto2hExt1Ulid, block0hto1hExt1Ulid, block1hto2hExt1UlidCopy},
+			},
+			metrics: `# HELP cortex_compactor_remaining_planned_compactions Total number of plans that remain to be compacted.
+        	          # TYPE cortex_compactor_remaining_planned_compactions gauge
+        	          cortex_compactor_remaining_planned_compactions 2
 `,
 		},
 		"test oldest min time first": {
@@ -321,15 +358,54 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 `,
 			noCompactBlocks: map[ulid.ULID]*metadata.NoCompactMark{block2hto3hExt1Ulid: {}},
 		},
+		"test should cap the group to the max output block size": {
+			concurrency: 1,
+			ranges:      []time.Duration{4 * time.Hour},
+			blocks: map[ulid.ULID]*metadata.Meta{
+				block0hto1hExt1Ulid: withSize(blocks[block0hto1hExt1Ulid], 10),
+				block1hto2hExt1Ulid: withSize(blocks[block1hto2hExt1Ulid], 10),
+				block2hto3hExt1Ulid: withSize(blocks[block2hto3hExt1Ulid], 10),
+				block3hto4hExt1Ulid: withSize(blocks[block3hto4hExt1Ulid], 10),
+			},
+			maxOutputBlockSizeBytes: 25,
+			expected: [][]ulid.ULID{
+				{block1hto2hExt1Ulid, block0hto1hExt1Ulid},
+			},
+			metrics: `# HELP cortex_compactor_remaining_planned_compactions Total number of plans that remain to be compacted.
+        	          # TYPE cortex_compactor_remaining_planned_compactions gauge
+        	          cortex_compactor_remaining_planned_compactions 1
+        	          # HELP cortex_compactor_size_capped_compactions_total Total number of compactions split or skipped because the estimated output block size exceeded the configured limit.
+        	          # TYPE cortex_compactor_size_capped_compactions_total counter
+        	          cortex_compactor_size_capped_compactions_total{action="split"} 1
+`,
+		},
+		"test should skip the group if a single block fits within the max output block size": {
+			concurrency: 1,
+			ranges:      []time.Duration{4 * time.Hour},
+			blocks: map[ulid.ULID]*metadata.Meta{
+				block0hto1hExt1Ulid: withSize(blocks[block0hto1hExt1Ulid], 20),
+				block1hto2hExt1Ulid: withSize(blocks[block1hto2hExt1Ulid], 10),
+			},
+			maxOutputBlockSizeBytes: 25,
+			expected:                [][]ulid.ULID{},
+			metrics: `# HELP cortex_compactor_remaining_planned_compactions Total number of plans that remain to be compacted.
+        	          # TYPE cortex_compactor_remaining_planned_compactions gauge
+        	          cortex_compactor_remaining_planned_compactions 0
+        	          # HELP cortex_compactor_size_capped_compactions_total Total number of compactions split or skipped because the estimated output block size exceeded the configured limit.
+        	          # TYPE cortex_compactor_size_capped_compactions_total counter
+        	          cortex_compactor_size_capped_compactions_total{action="skip"} 1
+`,
+		},
 	}
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			compactorCfg := &Config{
-				BlockRanges: testData.ranges,
+				BlockRanges:             testData.ranges,
+				MaxOutputBlockSizeBytes: testData.maxOutputBlockSizeBytes,
 			}
 
-			limits := &validation.Limits{}
+			limits := &validation.Limits{CompactorCompactionOrder: testData.compactionOrder}
 			overrides, err := validation.NewOverrides(*limits, nil)
 			require.NoError(t, err)
 
@@ -359,6 +435,7 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 				Name: "cortex_compactor_block_visit_marker_write_failed",
 				Help: "Number of block visit marker file failed to be written.",
 			})
+			sizeCappedCompactions := newSizeCappedCompactionsMetric(registerer)
 
 			bkt := &bucket.ClientMock{}
 			blockVisitMarkerTimeout := 5 * time.Minute
@@ -396,6 +473,7 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 				nil,
 				nil,
 				remainingPlannedCompactions,
+				sizeCappedCompactions,
 				metadata.NoneFunc,
 				*compactorCfg,
 				ring,
@@ -419,7 +497,7 @@ func TestShuffleShardingGrouper_Groups(t *testing.T) {
 				assert.Equal(t, expectedIDs, actual[idx].IDs())
 			}
 
-			err = testutil.GatherAndCompare(registerer, bytes.NewBufferString(testData.metrics), "cortex_compactor_remaining_planned_compactions")
+			err = testutil.GatherAndCompare(registerer, bytes.NewBufferString(testData.metrics), "cortex_compactor_remaining_planned_compactions", "cortex_compactor_size_capped_compactions_total")
 			require.NoError(t, err)
 		})
 	}
@@ -0,0 +1,101 @@
+package compactor
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+)
+
+const (
+	sizeCappedActionSplit = "split"
+	sizeCappedActionSkip  = "skip"
+)
+
+func newSizeCappedCompactionsMetric(reg prometheus.Registerer) *prometheus.CounterVec {
+	return promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_compactor_size_capped_compactions_total",
+		Help: "Total number of compactions split or skipped because the estimated output block size exceeded the configured limit.",
+	}, []string{"action"})
+}
+
+// SizeCappedPlanner wraps a planner to ensure the estimated size of the block
+// resulting from a compaction doesn't exceed a configured limit. The output block
+// size is estimated as the sum of the input blocks size.
+type SizeCappedPlanner struct {
+	planner                 compact.Planner
+	logger                  log.Logger
+	maxOutputBlockSizeBytes int64
+	sizeCappedCompactions   *prometheus.CounterVec
+}
+
+// NewSizeCappedPlanner returns a planner capping the output block size of the input planner.
+func NewSizeCappedPlanner(planner compact.Planner, logger log.Logger, maxOutputBlockSizeBytes int64, sizeCappedCompactions *prometheus.CounterVec) *SizeCappedPlanner {
+	return &SizeCappedPlanner{
+		planner:                 planner,
+		logger:                  logger,
+		maxOutputBlockSizeBytes: maxOutputBlockSizeBytes,
+		sizeCappedCompactions:   sizeCappedCompactions,
+	}
+}
+
+// Plan implements compact.Planner.
+func (p *SizeCappedPlanner) Plan(ctx context.Context, metasByMinTime []*metadata.Meta, errChan chan error, extensions any) ([]*metadata.Meta, error) {
+	toCompact, err := p.planner.Plan(ctx, metasByMinTime, errChan, extensions)
+	if err != nil || p.maxOutputBlockSizeBytes <= 0 {
+		return toCompact, err
+	}
+
+	return capToMaxOutputBlockSize(p.logger, toCompact, p.maxOutputBlockSizeBytes, p.sizeCappedCompactions), nil
+}
+
+// capToMaxOutputBlockSize returns the oldest of the blocks, sorted by min time, whose estimated
+// size fits within the limit, or nil if less than 2 blocks fit.
+func capToMaxOutputBlockSize(logger log.Logger, blocks []*metadata.Meta, maxOutputBlockSizeBytes int64, sizeCappedCompactions *prometheus.CounterVec) []*metadata.Meta {
+	totalSize := int64(0)
+	for _, m := range blocks {
+		totalSize += estimateBlockSize(m)
+	}
+	if totalSize <= maxOutputBlockSizeBytes {
+		return blocks
+	}
+
+	// Split the compaction keeping the oldest blocks whose estimated size
+	// fits within the limit.
+	cappedSize := int64(0)
+	capped := 0
+	for _, m := range blocks {
+		size := estimateBlockSize(m)
+		if cappedSize+size > maxOutputBlockSizeBytes {
+			break
+		}
+		cappedSize += size
+		capped++
+	}
+
+	// Compacting a single block is a no-op, so we skip the compaction.
+	if capped < 2 {
+		level.Info(logger).Log("msg", "skipping compaction because the estimated output block size exceeds the limit", "estimated_size_bytes", totalSize, "limit_bytes", maxOutputBlockSizeBytes, "blocks", len(blocks))
+		sizeCappedCompactions.WithLabelValues(sizeCappedActionSkip).Inc()
+		return nil
+	}
+
+	level.Info(logger).Log("msg", "splitting compaction because the estimated output block size exceeds the limit", "estimated_size_bytes", totalSize, "limit_bytes", maxOutputBlockSizeBytes, "planned_blocks", len(blocks), "compacted_blocks", capped, "capped_size_bytes", cappedSize)
+	sizeCappedCompactions.WithLabelValues(sizeCappedActionSplit).Inc()
+	return blocks[:capped]
+}
+
+// estimateBlockSize returns the size of the block files, as tracked in the meta.json.
+// Blocks whose meta.json doesn't track the files size are estimated as 0.
+func estimateBlockSize(m *metadata.Meta) int64 {
+	size := int64(0)
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+
+	return size
+}
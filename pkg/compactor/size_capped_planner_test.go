@@ -0,0 +1,115 @@
+package compactor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestSizeCappedPlanner_Plan(t *testing.T) {
+	newMeta := func(id uint64, minTime int64, sizes ...int64) *metadata.Meta {
+		m := &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustNew(id, nil),
+				MinTime: minTime,
+				MaxTime: minTime + 10,
+			},
+		}
+		for _, size := range sizes {
+			m.Thanos.Files = append(m.Thanos.Files, metadata.File{RelPath: "chunks/000001", SizeBytes: size})
+		}
+		return m
+	}
+
+	block1 := newMeta(1, 0, 40, 10)
+	block2 := newMeta(2, 10, 50)
+	block3 := newMeta(3, 20, 30)
+	blockWithoutSize := newMeta(4, 30)
+
+	tests := map[string]struct {
+		planned         []*metadata.Meta
+		plannerErr      error
+		maxSize         int64
+		expected        []*metadata.Meta
+		expectedErr     error
+		expectedMetrics string
+	}{
+		"should return the planned blocks if the limit is disabled": {
+			planned:  []*metadata.Meta{block1, block2, block3},
+			maxSize:  0,
+			expected: []*metadata.Meta{block1, block2, block3},
+		},
+		"should return the planned blocks if the estimated size is within the limit": {
+			planned:  []*metadata.Meta{block1, block2, block3},
+			maxSize:  130,
+			expected: []*metadata.Meta{block1, block2, block3},
+		},
+		"should split the compaction if the estimated size exceeds the limit": {
+			planned:  []*metadata.Meta{block1, block2, block3},
+			maxSize:  120,
+			expected: []*metadata.Meta{block1, block2},
+			expectedMetrics: `
+				# HELP cortex_compactor_size_capped_compactions_total Total number of compactions split or skipped because the estimated output block size exceeded the configured limit.
+				# TYPE cortex_compactor_size_capped_compactions_total counter
+				cortex_compactor_size_capped_compactions_total{action="split"} 1
+			`,
+		},
+		"should skip the compaction if less than 2 blocks fit within the limit": {
+			planned:  []*metadata.Meta{block1, block2, block3},
+			maxSize:  60,
+			expected: nil,
+			expectedMetrics: `
+				# HELP cortex_compactor_size_capped_compactions_total Total number of compactions split or skipped because the estimated output block size exceeded the configured limit.
+				# TYPE cortex_compactor_size_capped_compactions_total counter
+				cortex_compactor_size_capped_compactions_total{action="skip"} 1
+			`,
+		},
+		"should estimate blocks without files size as empty": {
+			planned:  []*metadata.Meta{block3, blockWithoutSize},
+			maxSize:  30,
+			expected: []*metadata.Meta{block3, blockWithoutSize},
+		},
+		"should return the error of the wrapped planner": {
+			plannerErr:  errors.New("planner failed"),
+			maxSize:     10,
+			expectedErr: errors.New("planner failed"),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			inner := plannerFunc(func(context.Context, []*metadata.Meta, chan error, any) ([]*metadata.Meta, error) {
+				return testData.planned, testData.plannerErr
+			})
+
+			planner := NewSizeCappedPlanner(inner, log.NewNopLogger(), testData.maxSize, newSizeCappedCompactionsMetric(reg))
+			actual, err := planner.Plan(context.Background(), testData.planned, nil, nil)
+
+			if testData.expectedErr != nil {
+				assert.Equal(t, testData.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, actual)
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics), "cortex_compactor_size_capped_compactions_total"))
+		})
+	}
+}
+
+type plannerFunc func(ctx context.Context, metasByMinTime []*metadata.Meta, errChan chan error, extensions any) ([]*metadata.Meta, error)
+
+func (f plannerFunc) Plan(ctx context.Context, metasByMinTime []*metadata.Meta, errChan chan error, extensions any) ([]*metadata.Meta, error) {
+	return f(ctx, metasByMinTime, errChan, extensions)
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/distributor"
 	"github.com/cortexproject/cortex/pkg/flusher"
 	"github.com/cortexproject/cortex/pkg/frontend"
+	"github.com/cortexproject/cortex/pkg/frontend/transport"
 	frontendv1 "github.com/cortexproject/cortex/pkg/frontend/v1"
 	"github.com/cortexproject/cortex/pkg/ingester"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
@@ -55,6 +56,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/fakeauth"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/grpcencoding/zstd"
 	"github.com/cortexproject/cortex/pkg/util/grpcutil"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 	"github.com/cortexproject/cortex/pkg/util/modules"
@@ -92,6 +94,8 @@ type Config struct {
 	PrintConfig bool                   `yaml:"-"`
 	HTTPPrefix  string                 `yaml:"http_prefix"`
 
+	GRPCDecompressionPoolEnabled bool `yaml:"grpc_decompression_pool_enabled"`
+
 	ExternalQueryable prom_storage.Queryable `yaml:"-"`
 	ExternalPusher    ruler.Pusher           `yaml:"-"`
 
@@ -140,6 +144,7 @@ func (c *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&c.AuthEnabled, "auth.enabled", true, "Set to false to disable auth.")
 	f.BoolVar(&c.PrintConfig, "print.config", false, "Print the config and exit.")
 	f.StringVar(&c.HTTPPrefix, "http.prefix", "/api/prom", "HTTP path prefix for Cortex API.")
+	f.BoolVar(&c.GRPCDecompressionPoolEnabled, "grpc.decompression-pool-enabled", false, "[Experimental] Decompress the zstd compressed gRPC messages with a pool of reusable decompressors, to reduce allocations. The decompressors are shared by all the gRPC clients and servers of the process. Snappy compressed messages are always decompressed with pooled decompressors.")
 
 	c.API.RegisterFlags(f)
 	c.registerServerFlagsWithChangedDefaultValues(f)
@@ -208,6 +213,9 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.Worker.Validate(log); err != nil {
 		return errors.Wrap(err, "invalid frontend_worker config")
 	}
+	if err := c.Frontend.Validate(); err != nil {
+		return errors.Wrap(err, "invalid frontend config")
+	}
 	if err := c.QueryRange.Validate(c.Querier); err != nil {
 		return errors.Wrap(err, "invalid query_range config")
 	}
@@ -309,6 +317,7 @@ type Cortex struct {
 	ExemplarQueryable        prom_storage.ExemplarQueryable
 	QuerierEngine            promql.QueryEngine
 	QueryFrontendTripperware tripperware.Tripperware
+	QueryFrontendAudit       *transport.QueryAuditLogger
 
 	Ruler        *ruler.Ruler
 	RulerStorage rulestore.RuleStore
@@ -321,7 +330,8 @@ type Cortex struct {
 
 	// Queryables that the querier should use to query the long
 	// term storage. It depends on the storage engine used.
-	StoreQueryables []querier.QueryableWithFilter
+	StoreQueryables    []querier.QueryableWithFilter
+	ChunksExportStores []querier.ChunksExportStore
 }
 
 // New makes a new Cortex.
@@ -339,6 +349,12 @@ func New(cfg Config) (*Cortex, error) {
 		tenant.WithDefaultResolver(tenant.NewMultiResolver())
 	}
 
+	// The gRPC compressors are registered for the whole process, so the pooled decompression
+	// can't be enabled per client.
+	if cfg.GRPCDecompressionPoolEnabled {
+		zstd.EnablePooledDecompression()
+	}
+
 	// Don't check auth header on TransferChunks, as we weren't originally
 	// sending it and this could cause transfers to fail on update.
 	cfg.API.HTTPAuthMiddleware = fakeauth.SetupAuthMiddleware(&cfg.Server, cfg.AuthEnabled,
@@ -520,6 +536,14 @@ func (t *Cortex) readyHandler(sm *services.Manager) http.HandlerFunc {
 			}
 		}
 
+		// Compactor reports itself as not ready when it's falling behind the compaction of the tenants it owns.
+		if t.Compactor != nil {
+			if err := t.Compactor.CheckReady(r.Context()); err != nil {
+				http.Error(w, "Compactor not ready: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
 		util.WriteTextResponse(w, "ready")
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -36,6 +38,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ingester"
 	"github.com/cortexproject/cortex/pkg/purger"
 	"github.com/cortexproject/cortex/pkg/querier"
+	"github.com/cortexproject/cortex/pkg/querier/querierpb"
 	"github.com/cortexproject/cortex/pkg/querier/tenantfederation"
 	"github.com/cortexproject/cortex/pkg/querier/tripperware"
 	"github.com/cortexproject/cortex/pkg/querier/tripperware/instantquery"
@@ -73,6 +76,7 @@ const (
 	StoreQueryable           string = "store-queryable"
 	QueryFrontend            string = "query-frontend"
 	QueryFrontendTripperware string = "query-frontend-tripperware"
+	QueryFrontendAudit       string = "query-frontend-audit"
 	RulerStorage             string = "ruler-storage"
 	Ruler                    string = "ruler"
 	Configs                  string = "configs"
@@ -201,6 +205,7 @@ func (t *Cortex) initOverridesExporter() (services.Service, error) {
 func (t *Cortex) initDistributorService() (serv services.Service, err error) {
 	t.Cfg.Distributor.DistributorRing.ListenPort = t.Cfg.Server.GRPCListenPort
 	t.Cfg.Distributor.ShuffleShardingLookbackPeriod = t.Cfg.Querier.ShuffleShardingIngestersLookbackPeriod
+	t.Cfg.Distributor.LabelsFanoutConcurrency = t.Cfg.Querier.IngesterLabelsFanoutConcurrency
 	t.Cfg.IngesterClient.GRPCClientConfig.SignWriteRequestsEnabled = t.Cfg.Distributor.SignWriteRequestsEnabled
 
 	// Check whether the distributor can join the distributors ring, which is
@@ -230,6 +235,10 @@ func (t *Cortex) initQueryable() (serv services.Service, err error) {
 	// Create a querier queryable and PromQL engine
 	t.QuerierQueryable, t.ExemplarQueryable, t.QuerierEngine = querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, querierRegisterer, util_log.Logger)
 
+	// The results of the queries are relabeled, and the invalid values filtered, for the API, while
+	// the ruler evaluates the rules against the stored series.
+	t.QuerierQueryable = querier.NewSampleAndChunkQueryable(querier.NewResultRelabelQueryable(querier.NewInvalidValuesFilterQueryable(t.QuerierQueryable, t.Overrides), t.Overrides))
+
 	// Register the default endpoints that are always enabled for the querier module
 	t.API.RegisterQueryable(t.QuerierQueryable, t.Distributor)
 
@@ -243,11 +252,30 @@ func (t *Cortex) initTenantFederation() (serv services.Service, err error) {
 		// single tenant. This allows for a less impactful enabling of tenant
 		// federation.
 		byPassForSingleQuerier := true
-		t.QuerierQueryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryable(t.QuerierQueryable, byPassForSingleQuerier))
+
+		var resolver *tenantfederation.TenantResolver
+		if cfg := t.Cfg.TenantFederation; cfg.TenantSelectorsEnabled || cfg.MaxTenants > 0 {
+			resolver = tenantfederation.NewTenantResolver(cfg, t.Overrides, tenantfederation.TenantsListerFunc(t.listIngestersTenants))
+		}
+		t.QuerierQueryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryableWithTenantResolver(t.QuerierQueryable, resolver, byPassForSingleQuerier))
 	}
 	return nil, nil
 }
 
+// listIngestersTenants returns the tenants with series in the ingesters.
+func (t *Cortex) listIngestersTenants(ctx context.Context) ([]string, error) {
+	stats, err := t.Distributor.AllUserStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := make([]string, 0, len(stats))
+	for _, s := range stats {
+		tenants = append(tenants, s.UserID)
+	}
+	return tenants, nil
+}
+
 // initQuerier registers an internal HTTP router with a Prometheus API backed by the
 // Cortex Queryable. Then it does one of the following:
 //
@@ -298,6 +326,10 @@ func (t *Cortex) initTenantFederation() (serv services.Service, err error) {
 //	                                          │                  │
 //	                                          └──────────────────┘
 func (t *Cortex) initQuerier() (serv services.Service, err error) {
+	if t.Cfg.Querier.ChunksExportEnabled {
+		querierpb.RegisterQuerierServer(t.Server.GRPC, querier.NewChunksExporter(t.Cfg.Querier, t.Overrides, t.Distributor, t.ChunksExportStores, util_log.Logger))
+	}
+
 	// Create a internal HTTP handler that is configured with the Prometheus API routes and points
 	// to a Prometheus API struct instantiated with the Cortex Queryable.
 	internalQuerierRouter := api.NewQuerierHandler(
@@ -363,6 +395,9 @@ func (t *Cortex) initStoreQueryables() (services.Service, error) {
 		return nil, fmt.Errorf("failed to initialize querier: %v", err)
 	} else {
 		t.StoreQueryables = append(t.StoreQueryables, querier.UseAlwaysQueryable(q))
+		if s, ok := q.(querier.ChunksExportStore); ok {
+			t.ChunksExportStores = append(t.ChunksExportStores, s)
+		}
 		if s, ok := q.(services.Service); ok {
 			servs = append(servs, s)
 		}
@@ -466,9 +501,15 @@ func (t *Cortex) initQueryFrontendTripperware() (serv services.Service, err erro
 		return nil, err
 	}
 
+	// The block sources header restricts the blocks queried by the queriers, so it's always forwarded.
+	forwardHeaders := t.Cfg.QueryRange.ForwardHeaders
+	if !slices.ContainsFunc(forwardHeaders, func(h string) bool { return strings.EqualFold(h, querier.BlockSourcesHeader) }) {
+		forwardHeaders = append([]string{querier.BlockSourcesHeader}, forwardHeaders...)
+	}
+
 	t.QueryFrontendTripperware = tripperware.NewQueryTripperware(util_log.Logger,
 		prometheus.DefaultRegisterer,
-		t.Cfg.QueryRange.ForwardHeaders,
+		forwardHeaders,
 		queryRangeMiddlewares,
 		instantQueryMiddlewares,
 		prometheusCodec,
@@ -480,15 +521,37 @@ func (t *Cortex) initQueryFrontendTripperware() (serv services.Service, err erro
 		t.Cfg.Querier.LookbackDelta,
 	)
 
+	metadataCacheTripperware, metadataCache, err := tripperware.NewMetadataCacheTripperware(t.Cfg.QueryRange.MetadataCache, t.Overrides, util_log.Logger, prometheus.DefaultRegisterer)
+	if err != nil {
+		return nil, err
+	}
+	queryTripperware := t.QueryFrontendTripperware
+	t.QueryFrontendTripperware = func(next http.RoundTripper) http.RoundTripper {
+		return metadataCacheTripperware(queryTripperware(next))
+	}
+
 	return services.NewIdleService(nil, func(_ error) error {
 		if cache != nil {
 			cache.Stop()
 			cache = nil
 		}
+		if metadataCache != nil {
+			metadataCache.Stop()
+			metadataCache = nil
+		}
 		return nil
 	}), nil
 }
 
+// initQueryFrontendAudit instantiates the query audit logger used by the query frontend, if enabled.
+func (t *Cortex) initQueryFrontendAudit() (serv services.Service, err error) {
+	t.QueryFrontendAudit, err = transport.NewQueryAuditLogger(t.Cfg.Frontend.Handler.QueryAudit, util_log.Logger, prometheus.DefaultRegisterer)
+	if err != nil || t.QueryFrontendAudit == nil {
+		return nil, err
+	}
+	return t.QueryFrontendAudit, nil
+}
+
 func (t *Cortex) initQueryFrontend() (serv services.Service, err error) {
 	retry := transport.NewRetry(t.Cfg.QueryRange.MaxRetries, prometheus.DefaultRegisterer)
 	roundTripper, frontendV1, frontendV2, err := frontend.InitFrontend(t.Cfg.Frontend, t.Overrides, t.Cfg.Server.GRPCListenPort, util_log.Logger, prometheus.DefaultRegisterer, retry)
@@ -499,7 +562,7 @@ func (t *Cortex) initQueryFrontend() (serv services.Service, err error) {
 	// Wrap roundtripper into Tripperware.
 	roundTripper = t.QueryFrontendTripperware(roundTripper)
 
-	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, prometheus.DefaultRegisterer)
+	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, t.QueryFrontendAudit, util_log.Logger, prometheus.DefaultRegisterer)
 	t.API.RegisterQueryFrontendHandler(handler)
 
 	if frontendV1 != nil {
@@ -551,6 +614,20 @@ func (t *Cortex) initRuler() (serv services.Service, err error) {
 	t.Cfg.Ruler.Ring.ListenPort = t.Cfg.Server.GRPCListenPort
 	metrics := ruler.NewRuleEvalMetrics(t.Cfg.Ruler, prometheus.DefaultRegisterer)
 
+	var alertsState *ruler.AlertsStateStore
+	if t.Cfg.Ruler.AlertsState.Enabled {
+		if alertsState, err = ruler.NewAlertsStateStore(t.Cfg.Ruler.AlertsState, util_log.Logger, prometheus.DefaultRegisterer); err != nil {
+			return nil, err
+		}
+	}
+
+	var notificationDedup *ruler.NotificationDeduplicator
+	if t.Cfg.Ruler.NotificationDedup.Enabled {
+		if notificationDedup, err = ruler.NewNotificationDeduplicator(t.Cfg.Ruler.NotificationDedup, t.Cfg.Ruler.Ring.InstanceID, util_log.Logger, prometheus.DefaultRegisterer); err != nil {
+			return nil, err
+		}
+	}
+
 	if t.Cfg.ExternalPusher != nil && t.Cfg.ExternalQueryable != nil {
 		rulerRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "ruler"}, prometheus.DefaultRegisterer)
 
@@ -578,14 +655,14 @@ func (t *Cortex) initRuler() (serv services.Service, err error) {
 			queryEngine = promql.NewEngine(opts)
 		}
 
-		managerFactory := ruler.DefaultTenantManagerFactory(t.Cfg.Ruler, t.Cfg.ExternalPusher, t.Cfg.ExternalQueryable, queryEngine, t.Overrides, metrics, prometheus.DefaultRegisterer)
+		managerFactory := ruler.DefaultTenantManagerFactory(t.Cfg.Ruler, t.Cfg.ExternalPusher, t.Cfg.ExternalQueryable, queryEngine, t.Overrides, metrics, alertsState, notificationDedup, prometheus.DefaultRegisterer)
 		manager, err = ruler.NewDefaultMultiTenantManager(t.Cfg.Ruler, managerFactory, metrics, prometheus.DefaultRegisterer, util_log.Logger)
 	} else {
 		rulerRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "ruler"}, prometheus.DefaultRegisterer)
 		// TODO: Consider wrapping logger to differentiate from querier module logger
 		queryable, _, engine := querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, rulerRegisterer, util_log.Logger)
 
-		managerFactory := ruler.DefaultTenantManagerFactory(t.Cfg.Ruler, t.Distributor, queryable, engine, t.Overrides, metrics, prometheus.DefaultRegisterer)
+		managerFactory := ruler.DefaultTenantManagerFactory(t.Cfg.Ruler, t.Distributor, queryable, engine, t.Overrides, metrics, alertsState, notificationDedup, prometheus.DefaultRegisterer)
 		manager, err = ruler.NewDefaultMultiTenantManager(t.Cfg.Ruler, managerFactory, metrics, prometheus.DefaultRegisterer, util_log.Logger)
 	}
 
@@ -607,6 +684,9 @@ func (t *Cortex) initRuler() (serv services.Service, err error) {
 
 	// Expose HTTP/GRPC endpoints for the Ruler service
 	t.API.RegisterRuler(t.Ruler)
+	if metrics.RuleEvaluationTracker != nil {
+		t.API.RegisterRuleEvaluationTracker(metrics.RuleEvaluationTracker)
+	}
 
 	// If the API is enabled, register the Ruler API
 	if t.Cfg.Ruler.EnableAPI {
@@ -650,6 +730,7 @@ func (t *Cortex) initAlertManager() (serv services.Service, err error) {
 
 func (t *Cortex) initCompactor() (serv services.Service, err error) {
 	t.Cfg.Compactor.ShardingRing.ListenPort = t.Cfg.Server.GRPCListenPort
+	t.Cfg.Compactor.RuntimeDisabledTenantsFn = compactorDisabledTenants(t.RuntimeConfig)
 
 	t.Compactor, err = compactor.NewCompactor(t.Cfg.Compactor, t.Cfg.BlocksStorage, util_log.Logger, prometheus.DefaultRegisterer, t.Overrides)
 	if err != nil {
@@ -745,6 +826,7 @@ func (t *Cortex) setupModuleManager() error {
 	mm.RegisterModule(Querier, t.initQuerier)
 	mm.RegisterModule(StoreQueryable, t.initStoreQueryables, modules.UserInvisibleModule)
 	mm.RegisterModule(QueryFrontendTripperware, t.initQueryFrontendTripperware, modules.UserInvisibleModule)
+	mm.RegisterModule(QueryFrontendAudit, t.initQueryFrontendAudit, modules.UserInvisibleModule)
 	mm.RegisterModule(QueryFrontend, t.initQueryFrontend)
 	mm.RegisterModule(RulerStorage, t.initRulerStorage, modules.UserInvisibleModule)
 	mm.RegisterModule(Ruler, t.initRuler)
@@ -775,7 +857,8 @@ func (t *Cortex) setupModuleManager() error {
 		Querier:                  {TenantFederation},
 		StoreQueryable:           {Overrides, Overrides, MemberlistKV},
 		QueryFrontendTripperware: {API, Overrides},
-		QueryFrontend:            {QueryFrontendTripperware},
+		QueryFrontendAudit:       {API},
+		QueryFrontend:            {QueryFrontendTripperware, QueryFrontendAudit},
 		QueryScheduler:           {API, Overrides},
 		Ruler:                    {DistributorService, Overrides, StoreQueryable, RulerStorage},
 		RulerStorage:             {Overrides},
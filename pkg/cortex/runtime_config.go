@@ -29,6 +29,8 @@ type RuntimeConfigValues struct {
 	IngesterChunkStreaming *bool `yaml:"ingester_stream_chunks_when_using_blocks"`
 
 	IngesterLimits *ingester.InstanceLimits `yaml:"ingester_limits"`
+
+	CompactorDisabledTenants []string `yaml:"compactor_disabled_tenants"`
 }
 
 // runtimeConfigTenantLimits provides per-tenant limit overrides based on a runtimeconfig.Manager
@@ -118,6 +120,20 @@ func ingesterInstanceLimits(manager *runtimeconfig.Manager) func() *ingester.Ins
 	}
 }
 
+func compactorDisabledTenants(manager *runtimeconfig.Manager) func() []string {
+	if manager == nil {
+		return nil
+	}
+
+	return func() []string {
+		val := manager.GetConfig()
+		if cfg, ok := val.(*RuntimeConfigValues); ok && cfg != nil {
+			return cfg.CompactorDisabledTenants
+		}
+		return nil
+	}
+}
+
 func runtimeConfigHandler(runtimeCfgManager *runtimeconfig.Manager, defaultLimits validation.Limits) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cfg, ok := runtimeCfgManager.GetConfig().(*RuntimeConfigValues)
@@ -0,0 +1,24 @@
+package cortexpb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cortexproject/cortex/pkg/util/histogram"
+)
+
+func TestHistogramProtoConversion(t *testing.T) {
+	for _, h := range histogram.GenerateTestHistograms(0, 1, 3, 2, 4) {
+		hp := HistogramToHistogramProto(10, h)
+		assert.False(t, hp.IsFloatHistogram())
+		assert.Equal(t, int64(10), hp.TimestampMs)
+		assert.Equal(t, h, HistogramProtoToHistogram(hp))
+
+		fh := h.ToFloat(nil)
+		fhp := FloatHistogramToHistogramProto(20, fh)
+		assert.True(t, fhp.IsFloatHistogram())
+		assert.Equal(t, int64(20), fhp.TimestampMs)
+		assert.Equal(t, fh, FloatHistogramProtoToFloatHistogram(fhp))
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/scrape"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/instrument"
@@ -37,6 +38,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/limiter"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 	util_math "github.com/cortexproject/cortex/pkg/util/math"
+	"github.com/cortexproject/cortex/pkg/util/push"
 	"github.com/cortexproject/cortex/pkg/util/services"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
@@ -90,8 +92,10 @@ type Distributor struct {
 	// For handling HA replicas.
 	HATracker *ha.HATracker
 
-	// Per-user rate limiter.
+	// Per-user rate limiters.
 	ingestionRateLimiter *limiter.RateLimiter
+	exemplarsRateLimiter *limiter.RateLimiter
+	bytesRateLimiter     *limiter.RateLimiter
 
 	// Manager for subservices (HA Tracker, distributor ring and client pool)
 	subservices        *services.Manager
@@ -102,9 +106,19 @@ type Distributor struct {
 	ingestionRate        *util_math.EwmaRate
 	inflightPushRequests atomic.Int64
 
+	// Per-user concurrent push requests limiter.
+	pushConcurrencyLimiter *limiter.ConcurrencyLimiter
+
+	// The number of in-memory series of the users, refreshed from the ingesters while the series
+	// sampling of a user depends on it.
+	seriesSamplingMtx       sync.RWMutex
+	seriesSamplingSeries    map[string]uint64
+	seriesSamplingRequested atomic.Bool
+
 	// Metrics
 	queryDuration                    *instrument.HistogramCollector
 	receivedSamples                  *prometheus.CounterVec
+	collapsedSamples                 *prometheus.CounterVec
 	receivedExemplars                *prometheus.CounterVec
 	receivedMetadata                 *prometheus.CounterVec
 	incomingSamples                  *prometheus.CounterVec
@@ -119,6 +133,9 @@ type Distributor struct {
 	ingesterQueryFailures            *prometheus.CounterVec
 	replicationFactor                prometheus.Gauge
 	latestSeenSampleTimestampPerUser *prometheus.GaugeVec
+	throttledPushRequests            *prometheus.CounterVec
+	sampledOutSeries                 *prometheus.CounterVec
+	labelsFanoutWait                 prometheus.Histogram
 
 	validateMetrics *validation.ValidateMetrics
 }
@@ -138,6 +155,10 @@ type Config struct {
 	ShardByAllLabels         bool   `yaml:"shard_by_all_labels"`
 	ExtendWrites             bool   `yaml:"extend_writes"`
 	SignWriteRequestsEnabled bool   `yaml:"sign_write_requests"`
+	OTLPGRPCEnabled          bool   `yaml:"otlp_grpc_enabled"`
+
+	// Period of the refresh of the number of series of the tenants, for the series sampling.
+	SeriesSamplingRefreshPeriod time.Duration `yaml:"series_sampling_refresh_period"`
 
 	// Distributors ring
 	DistributorRing RingConfig `yaml:"ring"`
@@ -152,6 +173,10 @@ type Config struct {
 	// This config is dynamically injected because defined in the querier config.
 	ShuffleShardingLookbackPeriod time.Duration `yaml:"-"`
 
+	// The maximum number of concurrent label names or values requests sent to ingesters
+	// for a single query. This config is dynamically injected because defined in the querier config.
+	LabelsFanoutConcurrency int `yaml:"-"`
+
 	// ZoneResultsQuorumMetadata enables zone results quorum when querying ingester replication set
 	// with metadata APIs (labels names and values for now). When zone awareness is enabled, only results
 	// from quorum number of zones will be included to reduce data merged and improve performance.
@@ -177,6 +202,8 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.ExtraQueryDelay, "distributor.extra-query-delay", 0, "Time to wait before sending more than the minimum successful query requests.")
 	f.BoolVar(&cfg.ShardByAllLabels, "distributor.shard-by-all-labels", false, "Distribute samples based on all labels, as opposed to solely by user and metric name.")
 	f.BoolVar(&cfg.SignWriteRequestsEnabled, "distributor.sign-write-requests", false, "EXPERIMENTAL: If enabled, sign the write request between distributors and ingesters.")
+	f.DurationVar(&cfg.SeriesSamplingRefreshPeriod, "distributor.series-sampling-refresh-period", time.Minute, "[Experimental] Period of the refresh of the number of series of the tenants from the ingesters, for the tenants with -distributor.series-sampling-min-series set. The ingesters are queried only while such tenants are pushing.")
+	f.BoolVar(&cfg.OTLPGRPCEnabled, "distributor.otlp-grpc-enabled", false, "[Experimental] If enabled, the distributor accepts OTLP metrics over gRPC, with the OTLP MetricsService on the gRPC server, in addition to the OTLP/HTTP endpoint.")
 	f.StringVar(&cfg.ShardingStrategy, "distributor.sharding-strategy", util.ShardingStrategyDefault, fmt.Sprintf("The sharding strategy to use. Supported values are: %s.", strings.Join(supportedShardingStrategies, ", ")))
 	f.BoolVar(&cfg.ExtendWrites, "distributor.extend-writes", true, "Try writing to an additional ingester in the presence of an ingester not in the ACTIVE state. It is useful to disable this along with -ingester.unregister-on-shutdown=false in order to not spread samples to extra ingesters during rolling restarts with consistent naming.")
 	f.BoolVar(&cfg.ZoneResultsQuorumMetadata, "distributor.zone-results-quorum-metadata", false, "Experimental, this flag may change in the future. If zone awareness and this both enabled, when querying metadata APIs (labels names and values for now), only results from quorum number of zones will be included.")
@@ -231,12 +258,14 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 	// Create the configured ingestion rate limit strategy (local or global). In case
 	// it's an internal dependency and can't join the distributors ring, we skip rate
 	// limiting.
-	var ingestionRateStrategy limiter.RateLimiterStrategy
+	var ingestionRateStrategy, exemplarsRateStrategy, bytesRateStrategy limiter.RateLimiterStrategy
 	var distributorsLifeCycler *ring.Lifecycler
 	var distributorsRing *ring.Ring
 
 	if !canJoinDistributorsRing {
 		ingestionRateStrategy = newInfiniteIngestionRateStrategy()
+		exemplarsRateStrategy = newInfiniteIngestionRateStrategy()
+		bytesRateStrategy = newInfiniteIngestionRateStrategy()
 	} else if limits.IngestionRateStrategy() == validation.GlobalIngestionRateStrategy {
 		distributorsLifeCycler, err = ring.NewLifecycler(cfg.DistributorRing.ToLifecyclerConfig(), nil, "distributor", ringKey, true, true, log, prometheus.WrapRegistererWithPrefix("cortex_", reg))
 		if err != nil {
@@ -250,8 +279,12 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		subservices = append(subservices, distributorsLifeCycler, distributorsRing)
 
 		ingestionRateStrategy = newGlobalIngestionRateStrategy(limits, distributorsLifeCycler)
+		exemplarsRateStrategy = newGlobalExemplarsIngestionRateStrategy(limits, distributorsLifeCycler)
+		bytesRateStrategy = newGlobalBytesIngestionRateStrategy(limits, distributorsLifeCycler)
 	} else {
 		ingestionRateStrategy = newLocalIngestionRateStrategy(limits)
+		exemplarsRateStrategy = newLocalExemplarsIngestionRateStrategy(limits)
+		bytesRateStrategy = newLocalBytesIngestionRateStrategy(limits)
 	}
 
 	d := &Distributor{
@@ -263,8 +296,11 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		distributorsRing:       distributorsRing,
 		limits:                 limits,
 		ingestionRateLimiter:   limiter.NewRateLimiter(ingestionRateStrategy, 10*time.Second),
+		exemplarsRateLimiter:   limiter.NewRateLimiter(exemplarsRateStrategy, 10*time.Second),
+		bytesRateLimiter:       limiter.NewRateLimiter(bytesRateStrategy, 10*time.Second),
 		HATracker:              haTracker,
 		ingestionRate:          util_math.NewEWMARate(0.2, instanceIngestionRateTickInterval),
+		pushConcurrencyLimiter: limiter.NewConcurrencyLimiter(),
 
 		queryDuration: instrument.NewHistogramCollector(promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: "cortex",
@@ -277,6 +313,11 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name:      "distributor_received_samples_total",
 			Help:      "The total number of received samples, excluding rejected and deduped samples.",
 		}, []string{"user"}),
+		collapsedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_collapsed_samples_total",
+			Help:      "The total number of received samples collapsed by the ingest-time aggregation, and not forwarded to the ingesters.",
+		}, []string{"user"}),
 		receivedExemplars: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Namespace: "cortex",
 			Name:      "distributor_received_exemplars_total",
@@ -347,6 +388,22 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name: "cortex_distributor_latest_seen_sample_timestamp_seconds",
 			Help: "Unix timestamp of latest received sample per user.",
 		}, []string{"user"}),
+		throttledPushRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_throttled_push_requests_total",
+			Help:      "The total number of push requests rejected because the user reached the limit of concurrent push requests.",
+		}, []string{"user"}),
+		labelsFanoutWait: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Namespace: "cortex",
+			Name:      "distributor_ingester_labels_fanout_wait_seconds",
+			Help:      "Time spent waiting for a free slot before sending a label names or values request to an ingester.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		sampledOutSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_sampled_out_series_total",
+			Help:      "The total number of series dropped by the series sampling, counted once per write request.",
+		}, []string{"user"}),
 
 		validateMetrics: validation.NewValidateMetrics(reg),
 	}
@@ -406,6 +463,13 @@ func (d *Distributor) running(ctx context.Context) error {
 	staleIngesterMetricTicker := time.NewTicker(clearStaleIngesterMetricsInterval)
 	defer staleIngesterMetricTicker.Stop()
 
+	var seriesSamplingRefresh <-chan time.Time
+	if d.cfg.SeriesSamplingRefreshPeriod > 0 {
+		seriesSamplingRefreshTicker := time.NewTicker(d.cfg.SeriesSamplingRefreshPeriod)
+		defer seriesSamplingRefreshTicker.Stop()
+		seriesSamplingRefresh = seriesSamplingRefreshTicker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -417,6 +481,9 @@ func (d *Distributor) running(ctx context.Context) error {
 		case <-staleIngesterMetricTicker.C:
 			d.cleanStaleIngesterMetrics()
 
+		case <-seriesSamplingRefresh:
+			d.refreshSeriesSamplingSeries(ctx)
+
 		case err := <-d.subservicesWatcher.Chan():
 			return errors.Wrap(err, "distributor subservice failed")
 		}
@@ -429,6 +496,7 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.HATracker.CleanupHATrackerMetricsForUser(userID)
 
 	d.receivedSamples.DeleteLabelValues(userID)
+	d.collapsedSamples.DeleteLabelValues(userID)
 	d.receivedExemplars.DeleteLabelValues(userID)
 	d.receivedMetadata.DeleteLabelValues(userID)
 	d.incomingSamples.DeleteLabelValues(userID)
@@ -436,6 +504,8 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.incomingMetadata.DeleteLabelValues(userID)
 	d.nonHASamples.DeleteLabelValues(userID)
 	d.latestSeenSampleTimestampPerUser.DeleteLabelValues(userID)
+	d.throttledPushRequests.DeleteLabelValues(userID)
+	d.sampledOutSeries.DeleteLabelValues(userID)
 
 	if err := util.DeleteMatchingLabels(d.dedupedSamples, map[string]string{"user": userID}); err != nil {
 		level.Warn(d.log).Log("msg", "failed to remove cortex_distributor_deduped_samples_total metric for user", "user", userID, "err", err)
@@ -531,6 +601,21 @@ func (d *Distributor) checkSample(ctx context.Context, userID, cluster, replica
 	return true, nil
 }
 
+// dropExemplars removes the exemplars of the series, and the series left without samples
+// and histograms, along with their keys.
+func dropExemplars(seriesKeys []uint32, series []cortexpb.PreallocTimeseries) ([]uint32, []cortexpb.PreallocTimeseries) {
+	keptKeys, keptSeries := seriesKeys[:0], series[:0]
+	for i, ts := range series {
+		ts.Exemplars = nil
+		if len(ts.Samples) == 0 && len(ts.Histograms) == 0 {
+			continue
+		}
+		keptKeys = append(keptKeys, seriesKeys[i])
+		keptSeries = append(keptSeries, ts)
+	}
+	return keptKeys, keptSeries
+}
+
 // Validates a single series from a write request. Will remove labels if
 // any are configured to be dropped for the user ID.
 // Returns the validated series with it's labels/samples, and any error.
@@ -547,11 +632,20 @@ func (d *Distributor) validateSeries(ts cortexpb.PreallocTimeseries, userID stri
 		// Only alloc when data present
 		samples = make([]cortexpb.Sample, 0, len(ts.Samples))
 		for _, s := range ts.Samples {
+			if limits.StripStaleMarkers && value.IsStaleNaN(s.Value) {
+				d.validateMetrics.DiscardedSamples.WithLabelValues(validation.StaleMarkerStripped, userID).Inc()
+				continue
+			}
 			if err := validation.ValidateSample(d.validateMetrics, limits, userID, ts.Labels, s); err != nil {
 				return emptyPreallocSeries, err
 			}
 			samples = append(samples, s)
 		}
+
+		// Nothing left to ingest if all the series samples were staleness markers.
+		if len(samples) == 0 && len(ts.Exemplars) == 0 && len(ts.Histograms) == 0 {
+			return emptyPreallocSeries, nil
+		}
 	}
 
 	var exemplars []cortexpb.Exemplar
@@ -559,7 +653,7 @@ func (d *Distributor) validateSeries(ts cortexpb.PreallocTimeseries, userID stri
 		// Only alloc when data present
 		exemplars = make([]cortexpb.Exemplar, 0, len(ts.Exemplars))
 		for _, e := range ts.Exemplars {
-			if err := validation.ValidateExemplar(d.validateMetrics, userID, ts.Labels, e); err != nil {
+			if err := validation.ValidateExemplar(d.validateMetrics, limits, userID, ts.Labels, e); err != nil {
 				// An exemplar validation error prevents ingesting samples
 				// in the same series object. However, because the current Prometheus
 				// remote write implementation only populates one or the other,
@@ -574,9 +668,12 @@ func (d *Distributor) validateSeries(ts cortexpb.PreallocTimeseries, userID stri
 	if len(ts.Histograms) > 0 {
 		// Only alloc when data present
 		histograms = make([]cortexpb.Histogram, 0, len(ts.Histograms))
-		// TODO(yeya24): we need to have validations for native histograms
-		// at some point. Skip validations for now.
-		histograms = append(histograms, ts.Histograms...)
+		for _, h := range ts.Histograms {
+			if err := validation.ValidateNativeHistogram(d.validateMetrics, limits, userID, ts.Labels, h); err != nil {
+				return emptyPreallocSeries, err
+			}
+			histograms = append(histograms, h)
+		}
 	}
 
 	return cortexpb.PreallocTimeseries{
@@ -629,12 +726,45 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		}
 	}
 
+	maxConcurrentPushRequests := d.limits.MaxConcurrentPushRequests(userID)
+	release, err := d.pushConcurrencyLimiter.Acquire(ctx, userID, maxConcurrentPushRequests, d.limits.ConcurrentPushRequestsWaitTimeout(userID))
+	if err != nil {
+		if errors.Is(err, limiter.ErrTooManyConcurrentRequests) {
+			d.throttledPushRequests.WithLabelValues(userID).Inc()
+			// Return a 429 here to tell the client to slow down and re-send.
+			return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "too many concurrent push requests for the user (limit: %d)", maxConcurrentPushRequests)
+		}
+		return nil, err
+	}
+	defer release()
+
 	removeReplica := false
 	// Cache user limit with overrides so we spend less CPU doing locking. See issue #4904
 	limits := d.limits.GetOverridesForUser(userID)
+	replicaLabel := limits.HAReplicaLabel
+	// The size of the request is taken before the validation changes it. The size of the requests
+	// received over HTTP is known from their body, otherwise it's computed from the request.
+	requestSize := 0
+	if limits.IngestionRateBytes > 0 {
+		var ok bool
+		if requestSize, ok = push.RequestSizeFromContext(ctx); !ok {
+			requestSize = req.Size()
+		}
+	}
+
+	if !validation.PushAccepted(limits.PushAcceptanceWindows, now) {
+		// Ensure the request slice is reused if the request is outside of the push acceptance windows.
+		cortexpb.ReuseSlice(req.Timeseries)
+
+		d.validateMetrics.DiscardedSamples.WithLabelValues(validation.OutsidePushAcceptanceWindows, userID).Add(float64(numSamples))
+		d.validateMetrics.DiscardedExemplars.WithLabelValues(validation.OutsidePushAcceptanceWindows, userID).Add(float64(numExemplars))
+		d.validateMetrics.DiscardedMetadata.WithLabelValues(validation.OutsidePushAcceptanceWindows, userID).Add(float64(len(req.Metadata)))
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, "push received at %s, outside of the push acceptance windows of the user", now.UTC().Format(time.RFC3339))
+	}
 
 	if limits.AcceptHASamples && len(req.Timeseries) > 0 {
-		cluster, replica := findHALabels(limits.HAReplicaLabel, limits.HAClusterLabel, req.Timeseries[0].Labels)
+		var cluster, replica string
+		cluster, replica, replicaLabel = findUserHALabels(limits, req.Timeseries[0].Labels)
 		removeReplica, err = d.checkSample(ctx, userID, cluster, replica, limits)
 		if err != nil {
 			// Ensure the request slice is reused if the series get deduped.
@@ -660,7 +790,7 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 	}
 
 	// A WriteRequest can only contain series or metadata but not both. This might change in the future.
-	seriesKeys, validatedTimeseries, validatedSamples, validatedExemplars, firstPartialErr, err := d.prepareSeriesKeys(ctx, req, userID, limits, removeReplica)
+	seriesKeys, validatedTimeseries, validatedSamples, validatedExemplars, firstPartialErr, err := d.prepareSeriesKeys(ctx, req, userID, limits, removeReplica, replicaLabel)
 	if err != nil {
 		return nil, err
 	}
@@ -677,6 +807,17 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		return &cortexpb.WriteResponse{}, firstPartialErr
 	}
 
+	if requestSize > 0 && !d.bytesRateLimiter.AllowN(now, userID, requestSize) {
+		// Ensure the request slice is reused if the request is rate limited.
+		cortexpb.ReuseSlice(req.Timeseries)
+
+		d.validateMetrics.DiscardedSamples.WithLabelValues(validation.BytesRateLimited, userID).Add(float64(validatedSamples))
+		d.validateMetrics.DiscardedExemplars.WithLabelValues(validation.BytesRateLimited, userID).Add(float64(validatedExemplars))
+		d.validateMetrics.DiscardedMetadata.WithLabelValues(validation.BytesRateLimited, userID).Add(float64(len(validatedMetadata)))
+		// Return a 429 here to tell the client it is going too fast.
+		return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit (%v bytes/sec) exceeded while adding %d bytes", d.bytesRateLimiter.Limit(now, userID), requestSize)
+	}
+
 	totalN := validatedSamples + validatedExemplars + len(validatedMetadata)
 	if !d.ingestionRateLimiter.AllowN(now, userID, totalN) {
 		// Ensure the request slice is reused if the request is rate limited.
@@ -691,6 +832,23 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit (%v) exceeded while adding %d samples and %d metadata", d.ingestionRateLimiter.Limit(now, userID), validatedSamples, len(validatedMetadata))
 	}
 
+	// The exemplars rate limit is only checked once the request is allowed by the ingestion rate limits,
+	// so that the exemplars of a rejected request don't consume the exemplars rate.
+	if validatedExemplars > 0 && limits.DistributorExemplarsIngestionRate > 0 && !d.exemplarsRateLimiter.AllowN(now, userID, validatedExemplars) {
+		// The exemplars are dropped, while their samples are still ingested.
+		d.validateMetrics.DiscardedExemplars.WithLabelValues(validation.ExemplarsRateLimited, userID).Add(float64(validatedExemplars))
+		seriesKeys, validatedTimeseries = dropExemplars(seriesKeys, validatedTimeseries)
+		totalN -= validatedExemplars
+		validatedExemplars = 0
+
+		if len(seriesKeys) == 0 && len(metadataKeys) == 0 {
+			// Ensure the request slice is reused if there's no series or metadata left.
+			cortexpb.ReuseSlice(req.Timeseries)
+
+			return &cortexpb.WriteResponse{}, firstPartialErr
+		}
+	}
+
 	// totalN included samples and metadata. Ingester follows this pattern when computing its ingestion rate.
 	d.ingestionRate.Add(int64(totalN))
 
@@ -770,7 +928,7 @@ func (d *Distributor) doBatch(ctx context.Context, req *cortexpb.WriteRequest, s
 		op = ring.Write
 	}
 
-	return ring.DoBatch(ctx, op, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
+	return ring.DoBatchWithZoneQuorum(ctx, op, subRing, keys, writeZoneQuorum(d.limits.WriteQuorum(userID)), func(ingester ring.InstanceDesc, indexes []int) error {
 		timeseries := make([]cortexpb.PreallocTimeseries, 0, len(indexes))
 		var metadata []*cortexpb.MetricMetadata
 
@@ -810,7 +968,7 @@ func (d *Distributor) prepareMetadataKeys(req *cortexpb.WriteRequest, limits *va
 	return metadataKeys, validatedMetadata, firstPartialErr
 }
 
-func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.WriteRequest, userID string, limits *validation.Limits, removeReplica bool) ([]uint32, []cortexpb.PreallocTimeseries, int, int, error, error) {
+func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.WriteRequest, userID string, limits *validation.Limits, removeReplica bool, replicaLabel string) ([]uint32, []cortexpb.PreallocTimeseries, int, int, error, error) {
 	pSpan, _ := opentracing.StartSpanFromContext(ctx, "prepareSeriesKeys")
 	defer pSpan.Finish()
 
@@ -831,6 +989,8 @@ func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.Write
 		}
 	}()
 
+	samplingRatio := d.seriesSamplingRatio(userID, limits)
+
 	// For each timeseries, compute a hash to distribute across ingesters;
 	// check each sample and discard if outside limits.
 	skipLabelNameValidation := d.cfg.SkipLabelNameValidation || req.GetSkipLabelNameValidation()
@@ -839,7 +999,9 @@ func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.Write
 		if len(ts.Samples) > 0 {
 			latestSampleTimestampMs = max(latestSampleTimestampMs, ts.Samples[len(ts.Samples)-1].TimestampMs)
 		}
-		// TODO(yeya24): use timestamp of the latest native histogram in the series as well.
+		if len(ts.Histograms) > 0 {
+			latestSampleTimestampMs = max(latestSampleTimestampMs, ts.Histograms[len(ts.Histograms)-1].TimestampMs)
+		}
 
 		if mrc := limits.MetricRelabelConfigs; len(mrc) > 0 {
 			l, _ := relabel.Process(cortexpb.FromLabelAdaptersToLabels(ts.Labels), mrc...)
@@ -848,7 +1010,7 @@ func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.Write
 				d.validateMetrics.DiscardedSamples.WithLabelValues(
 					validation.DroppedByRelabelConfiguration,
 					userID,
-				).Add(float64(len(ts.Samples)))
+				).Add(float64(len(ts.Samples) + len(ts.Histograms)))
 				continue
 			}
 			ts.Labels = cortexpb.FromLabelsToLabelAdapters(l)
@@ -858,7 +1020,7 @@ func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.Write
 		// storing series in Cortex. If we kept the replica label we would end up with another series for the same
 		// series we're trying to dedupe when HA tracking moves over to a different replica.
 		if removeReplica {
-			removeLabel(limits.HAReplicaLabel, &ts.Labels)
+			removeLabel(replicaLabel, &ts.Labels)
 		}
 
 		for _, labelName := range limits.DropLabels {
@@ -881,6 +1043,20 @@ func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.Write
 		// later in the validation phase, we ignore them here.
 		sortLabelsIfNeeded(ts.Labels)
 
+		if samplingRatio > 1 && !keepSampledSeries(ts.Labels, samplingRatio) {
+			d.sampledOutSeries.WithLabelValues(userID).Inc()
+			d.validateMetrics.DiscardedSamples.WithLabelValues(
+				validation.SampledOut,
+				userID,
+			).Add(float64(len(ts.Samples) + len(ts.Histograms)))
+			d.validateMetrics.DiscardedExemplars.WithLabelValues(
+				validation.SampledOut,
+				userID,
+			).Add(float64(len(ts.Exemplars)))
+
+			continue
+		}
+
 		// Generate the sharding token based on the series labels without the HA replica
 		// label and dropped labels (if any)
 		key, err := d.tokenForLabels(userID, ts.Labels)
@@ -902,15 +1078,69 @@ func (d *Distributor) prepareSeriesKeys(ctx context.Context, req *cortexpb.Write
 			continue
 		}
 
+		if interval := time.Duration(limits.IngestAggregationInterval); interval > 0 && len(validatedSeries.Samples) > 1 {
+			numSamples := len(validatedSeries.Samples)
+			validatedSeries.Samples = aggregateSamples(validatedSeries.Samples, interval.Milliseconds(), limits.IngestAggregationFunction)
+			d.collapsedSamples.WithLabelValues(userID).Add(float64(numSamples - len(validatedSeries.Samples)))
+		}
+
 		seriesKeys = append(seriesKeys, key)
 		validatedTimeseries = append(validatedTimeseries, validatedSeries)
-		// TODO(yeya24): add histogram samples as well when supported.
-		validatedSamples += len(ts.Samples)
-		validatedExemplars += len(ts.Exemplars)
+		validatedSamples += len(validatedSeries.Samples) + len(validatedSeries.Histograms)
+		validatedExemplars += len(validatedSeries.Exemplars)
 	}
 	return seriesKeys, validatedTimeseries, validatedSamples, validatedExemplars, firstPartialErr, nil
 }
 
+// seriesSamplingRatio returns the series sampling ratio of the user, or 0 if the user has fewer
+// in-memory series than the min series of the sampling.
+func (d *Distributor) seriesSamplingRatio(userID string, limits *validation.Limits) int {
+	if limits.SeriesSamplingRatio <= 1 || limits.SeriesSamplingMinSeries <= 0 {
+		return limits.SeriesSamplingRatio
+	}
+
+	d.seriesSamplingRequested.Store(true)
+	d.seriesSamplingMtx.RLock()
+	series := d.seriesSamplingSeries[userID]
+	d.seriesSamplingMtx.RUnlock()
+	if series < uint64(limits.SeriesSamplingMinSeries) {
+		return 0
+	}
+	return limits.SeriesSamplingRatio
+}
+
+// refreshSeriesSamplingSeries refreshes the number of in-memory series of the users from the
+// ingesters, if a user with the series sampling min series has pushed since the last refresh.
+func (d *Distributor) refreshSeriesSamplingSeries(ctx context.Context) {
+	if !d.seriesSamplingRequested.CompareAndSwap(true, false) {
+		return
+	}
+
+	stats, err := d.AllUserStats(ctx)
+	if err != nil {
+		level.Warn(d.log).Log("msg", "failed to refresh the number of series of the users for the series sampling", "err", err)
+		return
+	}
+
+	// The series are counted by each ingester they're replicated to.
+	factor := uint64(max(d.ingestersRing.ReplicationFactor(), 1))
+	series := make(map[string]uint64, len(stats))
+	for _, s := range stats {
+		series[s.UserID] = s.NumSeries / factor
+	}
+
+	d.seriesSamplingMtx.Lock()
+	d.seriesSamplingSeries = series
+	d.seriesSamplingMtx.Unlock()
+}
+
+// keepSampledSeries returns whether the series with the given sorted labels is kept when sampling
+// 1 in ratio series. The decision only depends on the labels, so the same series are consistently
+// kept or dropped across requests and distributors.
+func keepSampledSeries(labels []cortexpb.LabelAdapter, ratio int) bool {
+	return cortexpb.FromLabelAdaptersToLabels(labels).Hash()%uint64(ratio) == 0
+}
+
 func sortLabelsIfNeeded(labels []cortexpb.LabelAdapter) {
 	// no need to run sort.Slice, if labels are already sorted, which is most of the time.
 	// we can avoid extra memory allocations (mostly interface-related) this way.
@@ -991,6 +1221,28 @@ func (d *Distributor) ForReplicationSet(ctx context.Context, replicationSet ring
 	})
 }
 
+// forLabelsReplicationSet runs f on the replication set like ForReplicationSet, but sends at most
+// LabelsFanoutConcurrency label names or values requests to the ingesters at the same time.
+func (d *Distributor) forLabelsReplicationSet(ctx context.Context, replicationSet ring.ReplicationSet, f func(context.Context, ingester_client.IngesterClient) (interface{}, error)) ([]interface{}, error) {
+	if d.cfg.LabelsFanoutConcurrency <= 0 {
+		return d.ForReplicationSet(ctx, replicationSet, d.cfg.ZoneResultsQuorumMetadata, f)
+	}
+
+	slots := make(chan struct{}, d.cfg.LabelsFanoutConcurrency)
+	return d.ForReplicationSet(ctx, replicationSet, d.cfg.ZoneResultsQuorumMetadata, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		queuedAt := time.Now()
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() { <-slots }()
+		d.labelsFanoutWait.Observe(time.Since(queuedAt).Seconds())
+
+		return f(ctx, client)
+	})
+}
+
 func (d *Distributor) LabelValuesForLabelNameCommon(ctx context.Context, from, to model.Time, labelName model.LabelName, f func(ctx context.Context, rs ring.ReplicationSet, req *ingester_client.LabelValuesRequest) ([]interface{}, error), matchers ...*labels.Matcher) ([]string, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "Distributor.LabelValues", opentracing.Tags{
 		"name":  labelName,
@@ -1030,7 +1282,7 @@ func (d *Distributor) LabelValuesForLabelNameCommon(ctx context.Context, from, t
 // LabelValuesForLabelName returns all the label values that are associated with a given label name.
 func (d *Distributor) LabelValuesForLabelName(ctx context.Context, from, to model.Time, labelName model.LabelName, matchers ...*labels.Matcher) ([]string, error) {
 	return d.LabelValuesForLabelNameCommon(ctx, from, to, labelName, func(ctx context.Context, rs ring.ReplicationSet, req *ingester_client.LabelValuesRequest) ([]interface{}, error) {
-		return d.ForReplicationSet(ctx, rs, d.cfg.ZoneResultsQuorumMetadata, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return d.forLabelsReplicationSet(ctx, rs, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
 			resp, err := client.LabelValues(ctx, req)
 			if err != nil {
 				return nil, err
@@ -1041,15 +1293,16 @@ func (d *Distributor) LabelValuesForLabelName(ctx context.Context, from, to mode
 }
 
 // LabelValuesForLabelNameStream returns all the label values that are associated with a given label name.
+// The label values streamed by each ingester are merged as they're received.
 func (d *Distributor) LabelValuesForLabelNameStream(ctx context.Context, from, to model.Time, labelName model.LabelName, matchers ...*labels.Matcher) ([]string, error) {
 	return d.LabelValuesForLabelNameCommon(ctx, from, to, labelName, func(ctx context.Context, rs ring.ReplicationSet, req *ingester_client.LabelValuesRequest) ([]interface{}, error) {
-		return d.ForReplicationSet(ctx, rs, d.cfg.ZoneResultsQuorumMetadata, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return d.forLabelsReplicationSet(ctx, rs, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
 			stream, err := client.LabelValuesStream(ctx, req)
 			if err != nil {
 				return nil, err
 			}
 			defer stream.CloseSend() //nolint:errcheck
-			allLabelValues := []string{}
+			allLabelValues := newStringsSet()
 			for {
 				resp, err := stream.Recv()
 
@@ -1058,10 +1311,10 @@ func (d *Distributor) LabelValuesForLabelNameStream(ctx context.Context, from, t
 				} else if err != nil {
 					return nil, err
 				}
-				allLabelValues = append(allLabelValues, resp.LabelValues...)
+				allLabelValues.add(resp.LabelValues)
 			}
 
-			return allLabelValues, nil
+			return allLabelValues.sorted(), nil
 		})
 	}, matchers...)
 }
@@ -1101,15 +1354,17 @@ func (d *Distributor) LabelNamesCommon(ctx context.Context, from, to model.Time,
 	return r, nil
 }
 
+// LabelNamesStream returns all the label names. The label names streamed by each ingester are
+// merged as they're received.
 func (d *Distributor) LabelNamesStream(ctx context.Context, from, to model.Time) ([]string, error) {
 	return d.LabelNamesCommon(ctx, from, to, func(ctx context.Context, rs ring.ReplicationSet, req *ingester_client.LabelNamesRequest) ([]interface{}, error) {
-		return d.ForReplicationSet(ctx, rs, d.cfg.ZoneResultsQuorumMetadata, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return d.forLabelsReplicationSet(ctx, rs, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
 			stream, err := client.LabelNamesStream(ctx, req)
 			if err != nil {
 				return nil, err
 			}
 			defer stream.CloseSend() //nolint:errcheck
-			allLabelNames := []string{}
+			allLabelNames := newStringsSet()
 			for {
 				resp, err := stream.Recv()
 
@@ -1118,18 +1373,45 @@ func (d *Distributor) LabelNamesStream(ctx context.Context, from, to model.Time)
 				} else if err != nil {
 					return nil, err
 				}
-				allLabelNames = append(allLabelNames, resp.LabelNames...)
+				allLabelNames.add(resp.LabelNames)
 			}
 
-			return allLabelNames, nil
+			return allLabelNames.sorted(), nil
 		})
 	})
 }
 
+// stringsSet merges the label names or values streamed by an ingester as they're received, so
+// that each unique string is held once, instead of buffering the whole response of the ingester.
+// The sets of the ingesters are merged once the replication set results are selected, so that
+// the strings of the discarded responses, like the ones of a failed ingester, are not included.
+type stringsSet struct {
+	strings map[string]struct{}
+}
+
+func newStringsSet() *stringsSet {
+	return &stringsSet{strings: map[string]struct{}{}}
+}
+
+func (s *stringsSet) add(values []string) {
+	for _, str := range values {
+		s.strings[str] = struct{}{}
+	}
+}
+
+func (s *stringsSet) sorted() []string {
+	result := make([]string, 0, len(s.strings))
+	for str := range s.strings {
+		result = append(result, str)
+	}
+	sort.Strings(result)
+	return result
+}
+
 // LabelNames returns all the label names.
 func (d *Distributor) LabelNames(ctx context.Context, from, to model.Time) ([]string, error) {
 	return d.LabelNamesCommon(ctx, from, to, func(ctx context.Context, rs ring.ReplicationSet, req *ingester_client.LabelNamesRequest) ([]interface{}, error) {
-		return d.ForReplicationSet(ctx, rs, d.cfg.ZoneResultsQuorumMetadata, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return d.forLabelsReplicationSet(ctx, rs, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
 			resp, err := client.LabelNames(ctx, req)
 			if err != nil {
 				return nil, err
@@ -1391,6 +1673,35 @@ func (d *Distributor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// writeZoneQuorum returns the ring zone quorum of the write quorum limit.
+func writeZoneQuorum(quorum string) ring.ZoneQuorum {
+	switch quorum {
+	case validation.WriteQuorumEachZone:
+		return ring.EachZoneQuorum
+	case validation.WriteQuorumAllButOneZone:
+		return ring.AllButOneZoneQuorum
+	default:
+		return ring.NoZoneQuorum
+	}
+}
+
+// findUserHALabels finds the HA cluster and replica labels of the series, looking for the HA
+// label pairs of the user in order, and returns the name of the replica label of the first pair
+// with both labels in the series. If there is no such pair, the labels of the default pair are
+// returned.
+func findUserHALabels(limits *validation.Limits, labels []cortexpb.LabelAdapter) (cluster, replica, replicaLabel string) {
+	cluster, replica = findHALabels(limits.HAReplicaLabel, limits.HAClusterLabel, labels)
+	if cluster != "" && replica != "" {
+		return cluster, replica, limits.HAReplicaLabel
+	}
+	for _, pair := range limits.HALabelPairs {
+		if pairCluster, pairReplica := findHALabels(pair.ReplicaLabel, pair.ClusterLabel, labels); pairCluster != "" && pairReplica != "" {
+			return pairCluster, pairReplica, pair.ReplicaLabel
+		}
+	}
+	return cluster, replica, limits.HAReplicaLabel
+}
+
 func findHALabels(replicaLabel, clusterLabel string, labels []cortexpb.LabelAdapter) (string, string) {
 	var cluster, replica string
 	var pair cortexpb.LabelAdapter
@@ -22,6 +22,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -31,6 +32,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
 
 	promchunk "github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
@@ -46,6 +48,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/chunkcompat"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/push"
 	"github.com/cortexproject/cortex/pkg/util/services"
 	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/cortexproject/cortex/pkg/util/validation"
@@ -581,6 +584,98 @@ func TestDistributor_PushIngestionRateLimiter(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushIngestionRateLimiterBytes(t *testing.T) {
+	t.Parallel()
+
+	// The requests of the tests all have the same size.
+	requestSize := makeWriteRequest(0, 2, 0).Size()
+
+	tests := map[string]struct {
+		distributors          int
+		ingestionRateStrategy string
+		ingestionRateBytes    float64
+		expectedLimit         int
+		expectedAccepted      int
+	}{
+		"local strategy: limit should be set to each distributor": {
+			distributors:          2,
+			ingestionRateStrategy: validation.LocalIngestionRateStrategy,
+			ingestionRateBytes:    float64(2 * requestSize),
+			expectedLimit:         2 * requestSize,
+			expectedAccepted:      2,
+		},
+		"global strategy: limit should be evenly shared across distributors": {
+			distributors:          2,
+			ingestionRateStrategy: validation.GlobalIngestionRateStrategy,
+			ingestionRateBytes:    float64(4 * requestSize),
+			expectedLimit:         2 * requestSize,
+			expectedAccepted:      2,
+		},
+		"limit disabled": {
+			distributors:          1,
+			ingestionRateStrategy: validation.LocalIngestionRateStrategy,
+			expectedAccepted:      5,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			limits := &validation.Limits{}
+			flagext.DefaultValues(limits)
+			limits.IngestionRateStrategy = testData.ingestionRateStrategy
+			limits.IngestionRateBytes = testData.ingestionRateBytes
+			limits.IngestionBurstSizeBytes = 2 * requestSize
+
+			distributors, _, _, _ := prepare(t, prepConfig{
+				numIngesters:     3,
+				happyIngesters:   3,
+				numDistributors:  testData.distributors,
+				shardByAllLabels: true,
+				limits:           limits,
+			})
+
+			ctx := user.InjectOrgID(context.Background(), "user")
+			for i := 0; i < 5; i++ {
+				response, err := distributors[0].Push(ctx, makeWriteRequest(0, 2, 0))
+				if i < testData.expectedAccepted {
+					require.NoError(t, err)
+					assert.Equal(t, emptyResponse, response)
+					continue
+				}
+				require.Nil(t, response)
+				require.Equal(t, httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit (%v bytes/sec) exceeded while adding %d bytes", testData.expectedLimit, requestSize), err)
+			}
+
+			assert.Equal(t, float64(2*(5-testData.expectedAccepted)), testutil.ToFloat64(distributors[0].validateMetrics.DiscardedSamples.WithLabelValues(validation.BytesRateLimited, "user")))
+		})
+	}
+}
+
+func TestDistributor_PushIngestionRateLimiterBytes_ShouldUseTheRequestSizeFromTheContext(t *testing.T) {
+	t.Parallel()
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.IngestionRateBytes = 100
+	limits.IngestionBurstSizeBytes = 100
+
+	distributors, _, _, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+
+	ctx := push.ContextWithRequestSize(user.InjectOrgID(context.Background(), "user"), 1000)
+	response, err := distributors[0].Push(ctx, makeWriteRequest(0, 2, 0))
+	require.Nil(t, response)
+	require.Equal(t, httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit (%v bytes/sec) exceeded while adding %d bytes", 100, 1000), err)
+}
+
 func TestPush_QuorumError(t *testing.T) {
 	t.Parallel()
 
@@ -692,6 +787,48 @@ func TestPush_QuorumError(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.MaxConcurrentPushRequests = 1
+
+	distributors, _, regs, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+	d := distributors[0]
+
+	_, err := d.Push(ctx, makeWriteRequest(0, 10, 0))
+	require.NoError(t, err)
+
+	// A push request of the user is in flight, so the following one is rejected.
+	release, err := d.pushConcurrencyLimiter.Acquire(ctx, "user", 1, 0)
+	require.NoError(t, err)
+
+	_, err = d.Push(ctx, makeWriteRequest(0, 10, 0))
+	assert.Equal(t, httpgrpc.Errorf(http.StatusTooManyRequests, "too many concurrent push requests for the user (limit: 1)"), err)
+
+	// The push requests of other users are not affected.
+	_, err = d.Push(user.InjectOrgID(context.Background(), "other"), makeWriteRequest(0, 10, 0))
+	require.NoError(t, err)
+
+	release()
+	_, err = d.Push(ctx, makeWriteRequest(0, 10, 0))
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(`
+		# HELP cortex_distributor_throttled_push_requests_total The total number of push requests rejected because the user reached the limit of concurrent push requests.
+		# TYPE cortex_distributor_throttled_push_requests_total counter
+		cortex_distributor_throttled_push_requests_total{user="user"} 1
+	`), "cortex_distributor_throttled_push_requests_total"))
+}
+
 func TestDistributor_PushInstanceLimits(t *testing.T) {
 	t.Parallel()
 
@@ -844,6 +981,112 @@ func TestDistributor_PushInstanceLimits(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushExemplarsRateLimiter(t *testing.T) {
+	t.Parallel()
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.DistributorExemplarsIngestionRate = 1
+	limits.DistributorExemplarsIngestionBurstSize = 3
+
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+	d := ds[0]
+
+	makeRequest := func(withSamples bool, exemplars int) *cortexpb.WriteRequest {
+		ts := makeWriteRequestTimeseries([]cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}}, 1000, 1)
+		if !withSamples {
+			ts.Samples = nil
+		}
+		for i := 0; i < exemplars; i++ {
+			ts.Exemplars = append(ts.Exemplars, cortexpb.Exemplar{
+				Labels:      []cortexpb.LabelAdapter{{Name: "trace_id", Value: strconv.Itoa(i)}},
+				Value:       1,
+				TimestampMs: 1000,
+			})
+		}
+		return &cortexpb.WriteRequest{Timeseries: []cortexpb.PreallocTimeseries{ts}}
+	}
+	countPushes := func() (n int) {
+		for _, ing := range ingesters {
+			n += ing.countCalls("Push")
+		}
+		return n
+	}
+
+	_, err := d.Push(ctx, makeRequest(true, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, testutil.ToFloat64(d.validateMetrics.DiscardedExemplars.WithLabelValues(validation.ExemplarsRateLimited, "user")))
+
+	// The exemplars exceeding the limit are dropped, while their samples are still ingested.
+	pushes := countPushes()
+	_, err = d.Push(ctx, makeRequest(true, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, testutil.ToFloat64(d.validateMetrics.DiscardedExemplars.WithLabelValues(validation.ExemplarsRateLimited, "user")))
+	assert.Greater(t, countPushes(), pushes)
+
+	// The series left with no samples are not pushed to the ingesters.
+	pushes = countPushes()
+	_, err = d.Push(ctx, makeRequest(false, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, testutil.ToFloat64(d.validateMetrics.DiscardedExemplars.WithLabelValues(validation.ExemplarsRateLimited, "user")))
+	assert.Equal(t, pushes, countPushes())
+}
+
+func TestDistributor_PushExemplarsRateLimiter_ShouldNotConsumeTheExemplarsRateOfRejectedRequests(t *testing.T) {
+	t.Parallel()
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.IngestionRate = 1
+	limits.IngestionBurstSize = 2
+	limits.DistributorExemplarsIngestionRate = 1
+	limits.DistributorExemplarsIngestionBurstSize = 3
+
+	ds, _, _, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+	d := ds[0]
+
+	ts := makeWriteRequestTimeseries([]cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}}, 1000, 1)
+	ts.Exemplars = []cortexpb.Exemplar{
+		{Labels: []cortexpb.LabelAdapter{{Name: "trace_id", Value: "1"}}, Value: 1, TimestampMs: 1000},
+		{Labels: []cortexpb.LabelAdapter{{Name: "trace_id", Value: "2"}}, Value: 1, TimestampMs: 1000},
+	}
+
+	// The request exceeds the ingestion rate limit, so its exemplars don't consume the exemplars rate.
+	_, err := d.Push(ctx, &cortexpb.WriteRequest{Timeseries: []cortexpb.PreallocTimeseries{ts}})
+	require.Error(t, err)
+	assert.True(t, d.exemplarsRateLimiter.AllowN(time.Now(), "user", 3))
+}
+
+func TestDropExemplars(t *testing.T) {
+	t.Parallel()
+	series := []cortexpb.PreallocTimeseries{
+		{TimeSeries: &cortexpb.TimeSeries{Samples: []cortexpb.Sample{{Value: 1}}, Exemplars: []cortexpb.Exemplar{{Value: 1}}}},
+		{TimeSeries: &cortexpb.TimeSeries{Exemplars: []cortexpb.Exemplar{{Value: 2}}}},
+		{TimeSeries: &cortexpb.TimeSeries{Histograms: []cortexpb.Histogram{{Sum: 3}}, Exemplars: []cortexpb.Exemplar{{Value: 3}}}},
+	}
+
+	keys, series := dropExemplars([]uint32{1, 2, 3}, series)
+	assert.Equal(t, []uint32{1, 3}, keys)
+	assert.Equal(t, []cortexpb.PreallocTimeseries{
+		{TimeSeries: &cortexpb.TimeSeries{Samples: []cortexpb.Sample{{Value: 1}}}},
+		{TimeSeries: &cortexpb.TimeSeries{Histograms: []cortexpb.Histogram{{Sum: 3}}}},
+	}, series)
+}
+
 func TestDistributor_PushHAInstances(t *testing.T) {
 	t.Parallel()
 	ctx := user.InjectOrgID(context.Background(), "user")
@@ -935,6 +1178,57 @@ func TestDistributor_PushHAInstances(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushHAInstances_HALabelPairs(t *testing.T) {
+	t.Parallel()
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.AcceptHASamples = true
+	limits.HALabelPairs = []validation.HALabelPair{{ClusterLabel: "ruler_cluster", ReplicaLabel: "ruler_replica"}}
+
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           &limits,
+		enableTracker:    true,
+	})
+	d := ds[0]
+	require.NoError(t, d.HATracker.CheckReplica(ctx, "user", "ruler", "ruler-0", time.Now()))
+
+	makeRequest := func(replica string) *cortexpb.WriteRequest {
+		return &cortexpb.WriteRequest{Timeseries: []cortexpb.PreallocTimeseries{
+			makeWriteRequestTimeseries([]cortexpb.LabelAdapter{
+				{Name: model.MetricNameLabel, Value: "foo"},
+				{Name: "ruler_cluster", Value: "ruler"},
+				{Name: "ruler_replica", Value: replica},
+			}, time.Now().UnixMilli(), 1),
+		}}
+	}
+
+	// The samples of the non elected replica are deduped.
+	_, err := d.Push(ctx, makeRequest("ruler-1"))
+	httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusAccepted), httpResp.Code)
+
+	// The replica label of the pair is removed from the samples of the elected replica.
+	response, err := d.Push(ctx, makeRequest("ruler-0"))
+	require.NoError(t, err)
+	assert.Equal(t, emptyResponse, response)
+
+	for i := range ingesters {
+		for _, ts := range ingesters[i].series() {
+			assert.Equal(t, []cortexpb.LabelAdapter{
+				{Name: model.MetricNameLabel, Value: "foo"},
+				{Name: "ruler_cluster", Value: "ruler"},
+			}, ts.Labels)
+		}
+	}
+}
+
 func TestDistributor_PushQuery(t *testing.T) {
 	t.Parallel()
 	const shuffleShardSize = 5
@@ -1716,6 +2010,115 @@ func TestDistributor_Push_ExemplarValidation(t *testing.T) {
 	}
 }
 
+func TestDistributor_LabelNamesAndValuesStream(t *testing.T) {
+	t.Parallel()
+	ctx := user.InjectOrgID(context.Background(), "user")
+	// All the ingesters have the same label names or values, so the result doesn't depend on
+	// the ingesters whose response isn't waited for.
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:            16,
+		happyIngesters:          16,
+		numDistributors:         1,
+		lblValuesPerIngester:    100,
+		lblValuesDuplicateRatio: 1,
+	})
+	expected := ingesters[0].lblsValues
+
+	now := model.Time(time.Now().UnixMilli())
+	values, err := ds[0].LabelValuesForLabelNameStream(ctx, now, now, "__name__")
+	require.NoError(t, err)
+	assert.Equal(t, expected, values)
+	assert.Contains(t, []int{15, 16}, countMockIngestersCalls(ingesters, "LabelValuesStream"))
+
+	names, err := ds[0].LabelNamesStream(ctx, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, expected, names)
+	assert.Contains(t, []int{15, 16}, countMockIngestersCalls(ingesters, "LabelNamesStream"))
+}
+
+func TestDistributor_LabelNamesAndValuesFanoutConcurrency(t *testing.T) {
+	t.Parallel()
+	ctx := user.InjectOrgID(context.Background(), "user")
+	ds, ingesters, regs, _ := prepare(t, prepConfig{
+		numIngesters:            16,
+		happyIngesters:          16,
+		numDistributors:         1,
+		lblValuesPerIngester:    100,
+		lblValuesDuplicateRatio: 1,
+	})
+	ds[0].cfg.LabelsFanoutConcurrency = 2
+	expected := ingesters[0].lblsValues
+
+	now := model.Time(time.Now().UnixMilli())
+	values, err := ds[0].LabelValuesForLabelNameStream(ctx, now, now, "__name__")
+	require.NoError(t, err)
+	assert.Equal(t, expected, values)
+
+	names, err := ds[0].LabelNamesStream(ctx, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, expected, names)
+
+	// Every request sent to an ingester waited for a free slot.
+	calls := countMockIngestersCalls(ingesters, "LabelValuesStream") + countMockIngestersCalls(ingesters, "LabelNamesStream")
+	metrics, err := regs[0].Gather()
+	require.NoError(t, err)
+	var waits uint64
+	for _, m := range metrics {
+		if m.GetName() == "cortex_distributor_ingester_labels_fanout_wait_seconds" {
+			waits = m.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Greater(t, calls, 0)
+	assert.GreaterOrEqual(t, waits, uint64(calls))
+}
+
+func TestDistributor_GetIngesterIDsForQuery(t *testing.T) {
+	t.Parallel()
+	ds, _, _, _ := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 1,
+	})
+
+	ids, err := ds[0].GetIngesterIDsForQuery(user.InjectOrgID(context.Background(), "user"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0", "1", "2"}, ids)
+}
+
+func TestDistributor_LabelNamesAndValuesStream_ShouldNotIncludeTheFailedIngesters(t *testing.T) {
+	t.Parallel()
+	ctx := user.InjectOrgID(context.Background(), "user")
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:            3,
+		happyIngesters:          2,
+		numDistributors:         1,
+		replicationFactor:       3,
+		lblValuesPerIngester:    100,
+		lblValuesDuplicateRatio: 1,
+	})
+	expected := ingesters[0].lblsValues
+
+	now := model.Time(time.Now().UnixMilli())
+	values, err := ds[0].LabelValuesForLabelNameStream(ctx, now, now, "__name__")
+	require.NoError(t, err)
+	assert.Equal(t, expected, values)
+
+	names, err := ds[0].LabelNamesStream(ctx, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, expected, names)
+}
+
+func TestStringsSet(t *testing.T) {
+	t.Parallel()
+	s := newStringsSet()
+	assert.Equal(t, []string{}, s.sorted())
+
+	s.add([]string{"b", "d"})
+	s.add([]string{"a", "b"})
+	s.add([]string{"c"})
+	assert.Equal(t, []string{"a", "b", "c", "d"}, s.sorted())
+}
+
 func BenchmarkDistributor_GetLabelsValues(b *testing.B) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
@@ -2870,6 +3273,34 @@ func (i *mockIngester) LabelValues(_ context.Context, _ *client.LabelValuesReque
 	}, nil
 }
 
+func (i *mockIngester) LabelValuesStream(_ context.Context, _ *client.LabelValuesRequest, _ ...grpc.CallOption) (client.Ingester_LabelValuesStreamClient, error) {
+	i.trackCall("LabelValuesStream")
+	results := []*client.LabelValuesStreamResponse{}
+	for j := 0; j < len(i.lblsValues); j += 10 {
+		results = append(results, &client.LabelValuesStreamResponse{LabelValues: i.lblsValues[j:min(j+10, len(i.lblsValues))]})
+	}
+	if !i.happy.Load() {
+		// The unhappy ingester fails after streaming part of its response.
+		results = append(results, &client.LabelValuesStreamResponse{LabelValues: []string{"failed"}})
+		return &labelValuesStream{results: results, err: errFail}, nil
+	}
+	return &labelValuesStream{results: results}, nil
+}
+
+func (i *mockIngester) LabelNamesStream(_ context.Context, _ *client.LabelNamesRequest, _ ...grpc.CallOption) (client.Ingester_LabelNamesStreamClient, error) {
+	i.trackCall("LabelNamesStream")
+	results := []*client.LabelNamesStreamResponse{}
+	for j := 0; j < len(i.lblsValues); j += 10 {
+		results = append(results, &client.LabelNamesStreamResponse{LabelNames: i.lblsValues[j:min(j+10, len(i.lblsValues))]})
+	}
+	if !i.happy.Load() {
+		// The unhappy ingester fails after streaming part of its response.
+		results = append(results, &client.LabelNamesStreamResponse{LabelNames: []string{"failed"}})
+		return &labelNamesStream{results: results, err: errFail}, nil
+	}
+	return &labelNamesStream{results: results}, nil
+}
+
 func (i *mockIngester) PushPreAlloc(ctx context.Context, in *cortexpb.PreallocWriteRequest, opts ...grpc.CallOption) (*cortexpb.WriteResponse, error) {
 	return i.Push(ctx, &in.WriteRequest, opts...)
 }
@@ -3162,6 +3593,52 @@ func (s *metricsForLabelMatchersStream) Recv() (*client.MetricsForLabelMatchersS
 	return result, nil
 }
 
+type labelValuesStream struct {
+	grpc.ClientStream
+	i       int
+	results []*client.LabelValuesStreamResponse
+	err     error
+}
+
+func (*labelValuesStream) CloseSend() error {
+	return nil
+}
+
+func (s *labelValuesStream) Recv() (*client.LabelValuesStreamResponse, error) {
+	if s.i >= len(s.results) {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	result := s.results[s.i]
+	s.i++
+	return result, nil
+}
+
+type labelNamesStream struct {
+	grpc.ClientStream
+	i       int
+	results []*client.LabelNamesStreamResponse
+	err     error
+}
+
+func (*labelNamesStream) CloseSend() error {
+	return nil
+}
+
+func (s *labelNamesStream) Recv() (*client.LabelNamesStreamResponse, error) {
+	if s.i >= len(s.results) {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	result := s.results[s.i]
+	s.i++
+	return result, nil
+}
+
 func (i *mockIngester) AllUserStats(ctx context.Context, in *client.UserStatsRequest, opts ...grpc.CallOption) (*client.UsersStatsResponse, error) {
 	return &i.stats, nil
 }
@@ -3615,6 +4092,431 @@ func TestDistributor_Push_RelabelDropWillExportMetricOfDroppedSamples(t *testing
 	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(expectedMetrics), metrics...))
 }
 
+func TestDistributor_Push_ShouldRejectPushesOutsideOfTheAcceptanceWindows(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+
+	for name, tc := range map[string]struct {
+		windowStart, windowEnd time.Time
+		expectedErr            bool
+	}{
+		"within the window": {
+			windowStart: now.Add(-time.Hour),
+			windowEnd:   now.Add(time.Hour),
+		},
+		"outside of the window": {
+			windowStart: now.Add(time.Hour),
+			windowEnd:   now.Add(2 * time.Hour),
+			expectedErr: true,
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			const userID = "userDistributorPushAcceptanceWindows"
+
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf("push_acceptance_windows: [{start: \"%s\", end: \"%s\"}]", tc.windowStart.Format("15:04"), tc.windowEnd.Format("15:04"))), &limits))
+
+			ds, ingesters, regs, _ := prepare(t, prepConfig{
+				numIngesters:      1,
+				happyIngesters:    1,
+				numDistributors:   1,
+				shardByAllLabels:  true,
+				replicationFactor: 1,
+				limits:            &limits,
+			})
+
+			ctx := user.InjectOrgID(context.Background(), userID)
+			_, err := ds[0].Push(ctx, makeWriteRequest(0, 3, 2))
+
+			if !tc.expectedErr {
+				require.NoError(t, err)
+				assert.Len(t, ingesters[0].series(), 3)
+				return
+			}
+
+			httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, int32(http.StatusBadRequest), httpResp.Code)
+			assert.Contains(t, string(httpResp.Body), "outside of the push acceptance windows of the user")
+			assert.Empty(t, ingesters[0].series())
+
+			require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(`
+				# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+				# TYPE cortex_discarded_samples_total counter
+				cortex_discarded_samples_total{reason="outside_push_acceptance_windows",user="userDistributorPushAcceptanceWindows"} 3
+				# HELP cortex_discarded_metadata_total The total number of metadata that were discarded.
+				# TYPE cortex_discarded_metadata_total counter
+				cortex_discarded_metadata_total{reason="outside_push_acceptance_windows",user="userDistributorPushAcceptanceWindows"} 2
+			`), "cortex_discarded_samples_total", "cortex_discarded_metadata_total"))
+		})
+	}
+}
+
+func TestDistributor_Push_SeriesSampling(t *testing.T) {
+	t.Parallel()
+	const (
+		userID     = "userDistributorPushSeriesSampling"
+		numSeries  = 100
+		samplingOf = 4
+	)
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.SeriesSamplingRatio = samplingOf
+
+	ds, ingesters, regs, _ := prepare(t, prepConfig{
+		numIngesters:      1,
+		happyIngesters:    1,
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1,
+		limits:            &limits,
+	})
+
+	inputSeries := make([]labels.Labels, 0, numSeries)
+	expectedKept := 0
+	for i := 0; i < numSeries; i++ {
+		lbls := labels.Labels{{Name: "__name__", Value: "foo"}, {Name: "series", Value: strconv.Itoa(i)}}
+		inputSeries = append(inputSeries, lbls)
+		if keepSampledSeries(cortexpb.FromLabelsToLabelAdapters(lbls), samplingOf) {
+			expectedKept++
+		}
+	}
+	require.Greater(t, expectedKept, 0)
+	require.Less(t, expectedKept, numSeries)
+
+	// Push the same series twice, to check the same series are consistently kept.
+	ctx := user.InjectOrgID(context.Background(), userID)
+	for i := 0; i < 2; i++ {
+		_, err := ds[0].Push(ctx, mockWriteRequest(inputSeries, float64(i), int64(i+1)))
+		require.NoError(t, err)
+	}
+
+	timeseries := ingesters[0].series()
+	require.Len(t, timeseries, expectedKept)
+	for _, ts := range timeseries {
+		assert.True(t, keepSampledSeries(ts.Labels, samplingOf))
+		assert.Len(t, ts.Samples, 2)
+	}
+
+	expectedMetrics := fmt.Sprintf(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{reason="sampled_out",user="%s"} %d
+		# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+		# TYPE cortex_distributor_received_samples_total counter
+		cortex_distributor_received_samples_total{user="%s"} %d
+		`, userID, 2*(numSeries-expectedKept), userID, 2*expectedKept)
+	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(expectedMetrics), "cortex_distributor_received_samples_total", "cortex_discarded_samples_total"))
+}
+
+func TestDistributor_Push_SeriesSamplingMinSeries(t *testing.T) {
+	t.Parallel()
+	const (
+		userID     = "userDistributorPushSeriesSamplingMinSeries"
+		numSeries  = 100
+		samplingOf = 4
+	)
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.SeriesSamplingRatio = samplingOf
+	limits.SeriesSamplingMinSeries = numSeries
+
+	ds, ingesters, regs, _ := prepare(t, prepConfig{
+		numIngesters:      1,
+		happyIngesters:    1,
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1,
+		limits:            &limits,
+	})
+
+	inputSeries := make([]labels.Labels, 0, numSeries)
+	expectedKept := 0
+	for i := 0; i < numSeries; i++ {
+		lbls := labels.Labels{{Name: "__name__", Value: "foo"}, {Name: "series", Value: strconv.Itoa(i)}}
+		inputSeries = append(inputSeries, lbls)
+		if keepSampledSeries(cortexpb.FromLabelsToLabelAdapters(lbls), samplingOf) {
+			expectedKept++
+		}
+	}
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	// The user has no series yet, so the series are not sampled.
+	_, err := ds[0].Push(ctx, mockWriteRequest(inputSeries, 1, 1))
+	require.NoError(t, err)
+	require.Len(t, ingesters[0].series(), numSeries)
+
+	// Once the series of the user are refreshed, the user reaches the min series.
+	ingesters[0].stats = client.UsersStatsResponse{Stats: []*client.UserIDStatsResponse{
+		{UserId: userID, Data: &client.UserStatsResponse{NumSeries: numSeries}},
+	}}
+	ds[0].refreshSeriesSamplingSeries(ctx)
+
+	_, err = ds[0].Push(ctx, mockWriteRequest(inputSeries, 2, 2))
+	require.NoError(t, err)
+	for _, ts := range ingesters[0].series() {
+		if keepSampledSeries(ts.Labels, samplingOf) {
+			assert.Len(t, ts.Samples, 2)
+		} else {
+			assert.Len(t, ts.Samples, 1)
+		}
+	}
+
+	// The series are refreshed only if a user with the min series has pushed since the last refresh.
+	ds[0].refreshSeriesSamplingSeries(ctx)
+	ingesters[0].stats = client.UsersStatsResponse{}
+	ds[0].refreshSeriesSamplingSeries(ctx)
+	assert.Equal(t, samplingOf, ds[0].seriesSamplingRatio(userID, &limits))
+
+	expectedMetrics := fmt.Sprintf(`
+		# HELP cortex_distributor_sampled_out_series_total The total number of series dropped by the series sampling, counted once per write request.
+		# TYPE cortex_distributor_sampled_out_series_total counter
+		cortex_distributor_sampled_out_series_total{user="%s"} %d
+		`, userID, numSeries-expectedKept)
+	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(expectedMetrics), "cortex_distributor_sampled_out_series_total"))
+}
+
+func TestDistributor_Push_IngestAggregation(t *testing.T) {
+	t.Parallel()
+	const userID = "userDistributorPushIngestAggregation"
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.IngestAggregationInterval = model.Duration(15 * time.Second)
+	limits.IngestAggregationFunction = validation.IngestAggregationMax
+
+	ds, ingesters, regs, _ := prepare(t, prepConfig{
+		numIngesters:      1,
+		happyIngesters:    1,
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1,
+		limits:            &limits,
+	})
+
+	// Push 1s resolution samples spanning two intervals.
+	series := labels.Labels{{Name: "__name__", Value: "foo"}}
+	samples := make([]cortexpb.Sample, 0, 20)
+	for i := int64(0); i < 20; i++ {
+		samples = append(samples, cortexpb.Sample{TimestampMs: i * 1000, Value: float64(i % 16)})
+	}
+	req := mockWriteRequest([]labels.Labels{series}, 0, 0)
+	req.Timeseries[0].Samples = samples
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	_, err := ds[0].Push(ctx, req)
+	require.NoError(t, err)
+
+	timeseries := ingesters[0].series()
+	require.Len(t, timeseries, 1)
+	for _, ts := range timeseries {
+		assert.Equal(t, []cortexpb.Sample{{TimestampMs: 14000, Value: 14}, {TimestampMs: 19000, Value: 15}}, ts.Samples)
+	}
+
+	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(fmt.Sprintf(`
+		# HELP cortex_distributor_collapsed_samples_total The total number of received samples collapsed by the ingest-time aggregation, and not forwarded to the ingesters.
+		# TYPE cortex_distributor_collapsed_samples_total counter
+		cortex_distributor_collapsed_samples_total{user="%s"} 18
+		# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+		# TYPE cortex_distributor_received_samples_total counter
+		cortex_distributor_received_samples_total{user="%s"} 2
+	`, userID, userID)), "cortex_distributor_collapsed_samples_total", "cortex_distributor_received_samples_total"))
+}
+
+func TestDistributor_Push_StripStaleMarkers(t *testing.T) {
+	t.Parallel()
+	const userID = "userDistributorPushStripStaleMarkers"
+
+	for _, stripStaleMarkers := range []bool{false, true} {
+		stripStaleMarkers := stripStaleMarkers
+
+		t.Run(fmt.Sprintf("strip stale markers: %t", stripStaleMarkers), func(t *testing.T) {
+			t.Parallel()
+
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			limits.StripStaleMarkers = stripStaleMarkers
+
+			ds, ingesters, regs, _ := prepare(t, prepConfig{
+				numIngesters:      1,
+				happyIngesters:    1,
+				numDistributors:   1,
+				shardByAllLabels:  true,
+				replicationFactor: 1,
+				limits:            &limits,
+			})
+
+			inputSeries := []labels.Labels{
+				{{Name: "__name__", Value: "foo"}, {Name: "series", Value: "1"}},
+				{{Name: "__name__", Value: "foo"}, {Name: "series", Value: "2"}},
+			}
+
+			// Push a sample and then a staleness marker for each series.
+			ctx := user.InjectOrgID(context.Background(), userID)
+			_, err := ds[0].Push(ctx, mockWriteRequest(inputSeries, 1, 1))
+			require.NoError(t, err)
+			_, err = ds[0].Push(ctx, mockWriteRequest(inputSeries, math.Float64frombits(value.StaleNaN), 2))
+			require.NoError(t, err)
+
+			expectedSamples := 2
+			expectedMetrics := fmt.Sprintf(`
+				# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+				# TYPE cortex_distributor_received_samples_total counter
+				cortex_distributor_received_samples_total{user="%s"} 4
+				`, userID)
+			if stripStaleMarkers {
+				expectedSamples = 1
+				expectedMetrics = fmt.Sprintf(`
+					# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+					# TYPE cortex_discarded_samples_total counter
+					cortex_discarded_samples_total{reason="stale_marker_stripped",user="%s"} 2
+					# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+					# TYPE cortex_distributor_received_samples_total counter
+					cortex_distributor_received_samples_total{user="%s"} 2
+					`, userID, userID)
+			}
+
+			timeseries := ingesters[0].series()
+			require.Len(t, timeseries, len(inputSeries))
+			for _, ts := range timeseries {
+				require.Len(t, ts.Samples, expectedSamples)
+				assert.Equal(t, 1.0, ts.Samples[0].Value)
+			}
+
+			require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(expectedMetrics), "cortex_distributor_received_samples_total", "cortex_discarded_samples_total"))
+		})
+	}
+}
+
+func TestDistributor_Push_RequiredLabels(t *testing.T) {
+	t.Parallel()
+	const userID = "userDistributorPushRequiredLabels"
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.RequiredLabels = []string{"team"}
+
+	ds, ingesters, regs, _ := prepare(t, prepConfig{
+		numIngesters:      1,
+		happyIngesters:    1,
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1,
+		limits:            &limits,
+	})
+
+	inputSeries := []labels.Labels{
+		{{Name: "__name__", Value: "foo"}, {Name: "team", Value: "a"}},
+		{{Name: "__name__", Value: "foo"}, {Name: "env", Value: "prod"}},
+	}
+
+	// The series missing the required label is rejected, while the other one is ingested.
+	ctx := user.InjectOrgID(context.Background(), userID)
+	_, err := ds[0].Push(ctx, mockWriteRequest(inputSeries, 1, 1))
+	require.Error(t, err)
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+	assert.Contains(t, string(resp.Body), `series missing required label: "team"`)
+
+	timeseries := ingesters[0].series()
+	require.Len(t, timeseries, 1)
+	for _, ts := range timeseries {
+		assert.Equal(t, "a", cortexpb.FromLabelAdaptersToLabels(ts.Labels).Get("team"))
+	}
+
+	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(fmt.Sprintf(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{reason="missing_required_label",user="%s"} 1
+		`, userID)), "cortex_discarded_samples_total"))
+}
+
+func TestDistributor_Push_DisabledValidationChecks(t *testing.T) {
+	t.Parallel()
+	const userID = "userDistributorPushDisabledValidationChecks"
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.DisabledValidationChecks = []string{validation.ValidationCheckLabelNameFormat}
+
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:      1,
+		happyIngesters:    1,
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1,
+		limits:            &limits,
+	})
+
+	// The series with an invalid label name is ingested, since the check is disabled.
+	inputSeries := []labels.Labels{
+		{{Name: "__name__", Value: "foo"}, {Name: "invalid-label", Value: "a"}},
+	}
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	_, err := ds[0].Push(ctx, mockWriteRequest(inputSeries, 1, 1))
+	require.NoError(t, err)
+	require.Len(t, ingesters[0].series(), 1)
+}
+
+func TestDistributor_Push_NativeHistogramValidation(t *testing.T) {
+	t.Parallel()
+	const userID = "userDistributorPushNativeHistogramValidation"
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.RejectOldSamples = true
+	limits.RejectOldSamplesMaxAge = model.Duration(time.Hour)
+	limits.MaxNativeHistogramBuckets = 2
+
+	ds, _, regs, _ := prepare(t, prepConfig{
+		numIngesters:      1,
+		happyIngesters:    1,
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1,
+		limits:            &limits,
+	})
+
+	now := time.Now().UnixMilli()
+	tooOld := time.Now().Add(-2 * time.Hour).UnixMilli()
+	req := &cortexpb.WriteRequest{Timeseries: []cortexpb.PreallocTimeseries{
+		{TimeSeries: &cortexpb.TimeSeries{
+			Labels:     []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "valid"}},
+			Histograms: []cortexpb.Histogram{{TimestampMs: now - 1, PositiveDeltas: []int64{1}}, {TimestampMs: now, PositiveDeltas: []int64{1, 1}}},
+		}},
+		{TimeSeries: &cortexpb.TimeSeries{
+			Labels:     []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "too_old"}},
+			Histograms: []cortexpb.Histogram{{TimestampMs: tooOld}},
+		}},
+		{TimeSeries: &cortexpb.TimeSeries{
+			Labels:     []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "too_many_buckets"}},
+			Histograms: []cortexpb.Histogram{{TimestampMs: now, PositiveDeltas: []int64{1, 1, 1}}},
+		}},
+	}}
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	_, err := ds[0].Push(ctx, req)
+	require.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, `timestamp too old: %d metric: "too_old"`, tooOld), err)
+
+	// The valid histograms are counted as samples, also toward the ingestion rate limit.
+	require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(fmt.Sprintf(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{reason="greater_than_max_sample_age",user="%[1]s"} 1
+		cortex_discarded_samples_total{reason="native_histogram_buckets_exceeded",user="%[1]s"} 1
+		# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+		# TYPE cortex_distributor_received_samples_total counter
+		cortex_distributor_received_samples_total{user="%[1]s"} 2
+		`, userID)), "cortex_discarded_samples_total", "cortex_distributor_received_samples_total"))
+}
+
 func countMockIngestersCalls(ingesters []*mockIngester, name string) int {
 	count := 0
 	for i := 0; i < len(ingesters); i++ {
@@ -3672,3 +4574,42 @@ func TestFindHALabels(t *testing.T) {
 		assert.Equal(t, c.expected.replica, replica)
 	}
 }
+
+func TestFindUserHALabels(t *testing.T) {
+	t.Parallel()
+	limits := &validation.Limits{
+		HAClusterLabel: "cluster",
+		HAReplicaLabel: "replica",
+		HALabelPairs: []validation.HALabelPair{
+			{ClusterLabel: "ruler_cluster", ReplicaLabel: "ruler_replica"},
+			{ClusterLabel: "agent_cluster", ReplicaLabel: "agent_replica"},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		labels          []cortexpb.LabelAdapter
+		expectedCluster string
+		expectedReplica string
+		expectedLabel   string
+	}{
+		"default pair": {
+			labels:          []cortexpb.LabelAdapter{{Name: "cluster", Value: "c"}, {Name: "replica", Value: "r"}, {Name: "ruler_cluster", Value: "rc"}, {Name: "ruler_replica", Value: "rr"}},
+			expectedCluster: "c", expectedReplica: "r", expectedLabel: "replica",
+		},
+		"first complete pair": {
+			labels:          []cortexpb.LabelAdapter{{Name: "cluster", Value: "c"}, {Name: "agent_cluster", Value: "ac"}, {Name: "agent_replica", Value: "ar"}, {Name: "ruler_cluster", Value: "rc"}},
+			expectedCluster: "ac", expectedReplica: "ar", expectedLabel: "agent_replica",
+		},
+		"no complete pair": {
+			labels:          []cortexpb.LabelAdapter{{Name: "cluster", Value: "c"}, {Name: "ruler_replica", Value: "rr"}},
+			expectedCluster: "c", expectedReplica: "", expectedLabel: "replica",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cluster, replica, replicaLabel := findUserHALabels(limits, tc.labels)
+			assert.Equal(t, tc.expectedCluster, cluster)
+			assert.Equal(t, tc.expectedReplica, replica)
+			assert.Equal(t, tc.expectedLabel, replicaLabel)
+		})
+	}
+}
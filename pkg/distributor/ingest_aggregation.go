@@ -0,0 +1,77 @@
+package distributor
+
+import (
+	"math"
+
+	"github.com/prometheus/prometheus/model/value"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// aggregateSamples aggregates the samples of a series into one sample per interval, aligned to
+// the interval, with the given function. The aggregated sample has the timestamp of the last
+// sample of its interval, so the samples of the same interval received in a later request are
+// still accepted by the ingesters. Staleness markers are never aggregated, and the samples are
+// returned unchanged if they're not sorted by timestamp. The samples are aggregated in place.
+func aggregateSamples(samples []cortexpb.Sample, intervalMs int64, function string) []cortexpb.Sample {
+	for i := 1; i < len(samples); i++ {
+		if samples[i].TimestampMs <= samples[i-1].TimestampMs {
+			return samples
+		}
+	}
+
+	var (
+		out     = samples[:0]
+		agg     cortexpb.Sample
+		count   int
+		bucket  int64
+		flushFn = func() {
+			if count == 0 {
+				return
+			}
+			if function == validation.IngestAggregationAvg {
+				agg.Value /= float64(count)
+			}
+			out = append(out, agg)
+			count = 0
+		}
+	)
+
+	for _, s := range samples {
+		if value.IsStaleNaN(s.Value) {
+			flushFn()
+			out = append(out, s)
+			continue
+		}
+
+		if b := floorDiv(s.TimestampMs, intervalMs); count == 0 || b != bucket {
+			flushFn()
+			agg, count, bucket = s, 1, b
+			continue
+		}
+
+		switch function {
+		case validation.IngestAggregationAvg:
+			agg.Value += s.Value
+		case validation.IngestAggregationMax:
+			agg.Value = math.Max(agg.Value, s.Value)
+		default:
+			agg.Value = s.Value
+		}
+		agg.TimestampMs = s.TimestampMs
+		count++
+	}
+	flushFn()
+
+	return out
+}
+
+// floorDiv returns the floor of a divided by b, also for negative timestamps.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b < 0 {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,78 @@
+package distributor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestAggregateSamples(t *testing.T) {
+	staleNaN := math.Float64frombits(value.StaleNaN)
+	input := func() []cortexpb.Sample {
+		return []cortexpb.Sample{
+			{TimestampMs: 1000, Value: 1},
+			{TimestampMs: 5000, Value: 6},
+			{TimestampMs: 14000, Value: 2},
+			{TimestampMs: 15000, Value: 3},
+			{TimestampMs: 16000, Value: 5},
+		}
+	}
+
+	tests := map[string]struct {
+		samples  []cortexpb.Sample
+		function string
+		expected []cortexpb.Sample
+	}{
+		"last": {
+			samples:  input(),
+			function: validation.IngestAggregationLast,
+			expected: []cortexpb.Sample{{TimestampMs: 14000, Value: 2}, {TimestampMs: 16000, Value: 5}},
+		},
+		"avg": {
+			samples:  input(),
+			function: validation.IngestAggregationAvg,
+			expected: []cortexpb.Sample{{TimestampMs: 14000, Value: 3}, {TimestampMs: 16000, Value: 4}},
+		},
+		"max": {
+			samples:  input(),
+			function: validation.IngestAggregationMax,
+			expected: []cortexpb.Sample{{TimestampMs: 14000, Value: 6}, {TimestampMs: 16000, Value: 5}},
+		},
+		"should keep staleness markers": {
+			samples:  []cortexpb.Sample{{TimestampMs: 1000, Value: 1}, {TimestampMs: 2000, Value: staleNaN}, {TimestampMs: 3000, Value: 2}, {TimestampMs: 4000, Value: 3}},
+			function: validation.IngestAggregationLast,
+			expected: []cortexpb.Sample{{TimestampMs: 1000, Value: 1}, {TimestampMs: 2000, Value: staleNaN}, {TimestampMs: 4000, Value: 3}},
+		},
+		"should not aggregate unsorted samples": {
+			samples:  []cortexpb.Sample{{TimestampMs: 2000, Value: 1}, {TimestampMs: 1000, Value: 2}},
+			function: validation.IngestAggregationLast,
+			expected: []cortexpb.Sample{{TimestampMs: 2000, Value: 1}, {TimestampMs: 1000, Value: 2}},
+		},
+		"should align negative timestamps to the interval": {
+			samples:  []cortexpb.Sample{{TimestampMs: -1000, Value: 1}, {TimestampMs: 1000, Value: 2}},
+			function: validation.IngestAggregationLast,
+			expected: []cortexpb.Sample{{TimestampMs: -1000, Value: 1}, {TimestampMs: 1000, Value: 2}},
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := aggregateSamples(testData.samples, 15000, testData.function)
+			require.Len(t, actual, len(testData.expected))
+			for i, expected := range testData.expected {
+				assert.Equal(t, expected.TimestampMs, actual[i].TimestampMs)
+				if value.IsStaleNaN(expected.Value) {
+					assert.True(t, value.IsStaleNaN(actual[i].Value))
+				} else {
+					assert.Equal(t, expected.Value, actual[i].Value)
+				}
+			}
+		})
+	}
+}
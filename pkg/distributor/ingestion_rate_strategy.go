@@ -13,32 +13,66 @@ type ReadLifecycler interface {
 }
 
 type localStrategy struct {
-	limits *validation.Overrides
+	limit func(tenantID string) float64
+	burst func(tenantID string) int
 }
 
 func newLocalIngestionRateStrategy(limits *validation.Overrides) limiter.RateLimiterStrategy {
 	return &localStrategy{
-		limits: limits,
+		limit: limits.IngestionRate,
+		burst: limits.IngestionBurstSize,
+	}
+}
+
+func newLocalExemplarsIngestionRateStrategy(limits *validation.Overrides) limiter.RateLimiterStrategy {
+	return &localStrategy{
+		limit: limits.DistributorExemplarsIngestionRate,
+		burst: limits.DistributorExemplarsIngestionBurstSize,
+	}
+}
+
+func newLocalBytesIngestionRateStrategy(limits *validation.Overrides) limiter.RateLimiterStrategy {
+	return &localStrategy{
+		limit: limits.IngestionRateBytes,
+		burst: limits.IngestionBurstSizeBytes,
 	}
 }
 
 func (s *localStrategy) Limit(tenantID string) float64 {
-	return s.limits.IngestionRate(tenantID)
+	return s.limit(tenantID)
 }
 
 func (s *localStrategy) Burst(tenantID string) int {
-	return s.limits.IngestionBurstSize(tenantID)
+	return s.burst(tenantID)
 }
 
 type globalStrategy struct {
-	limits *validation.Overrides
-	ring   ReadLifecycler
+	limit func(tenantID string) float64
+	burst func(tenantID string) int
+	ring  ReadLifecycler
 }
 
 func newGlobalIngestionRateStrategy(limits *validation.Overrides, ring ReadLifecycler) limiter.RateLimiterStrategy {
 	return &globalStrategy{
-		limits: limits,
-		ring:   ring,
+		limit: limits.IngestionRate,
+		burst: limits.IngestionBurstSize,
+		ring:  ring,
+	}
+}
+
+func newGlobalExemplarsIngestionRateStrategy(limits *validation.Overrides, ring ReadLifecycler) limiter.RateLimiterStrategy {
+	return &globalStrategy{
+		limit: limits.DistributorExemplarsIngestionRate,
+		burst: limits.DistributorExemplarsIngestionBurstSize,
+		ring:  ring,
+	}
+}
+
+func newGlobalBytesIngestionRateStrategy(limits *validation.Overrides, ring ReadLifecycler) limiter.RateLimiterStrategy {
+	return &globalStrategy{
+		limit: limits.IngestionRateBytes,
+		burst: limits.IngestionBurstSizeBytes,
+		ring:  ring,
 	}
 }
 
@@ -46,16 +80,16 @@ func (s *globalStrategy) Limit(tenantID string) float64 {
 	numDistributors := s.ring.HealthyInstancesCount()
 
 	if numDistributors == 0 {
-		return s.limits.IngestionRate(tenantID)
+		return s.limit(tenantID)
 	}
 
-	return s.limits.IngestionRate(tenantID) / float64(numDistributors)
+	return s.limit(tenantID) / float64(numDistributors)
 }
 
 func (s *globalStrategy) Burst(tenantID string) int {
 	// The meaning of burst doesn't change for the global strategy, in order
 	// to keep it easier to understand for users / operators.
-	return s.limits.IngestionBurstSize(tenantID)
+	return s.burst(tenantID)
 }
 
 type infiniteStrategy struct{}
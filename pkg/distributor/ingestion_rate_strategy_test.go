@@ -85,6 +85,25 @@ func TestIngestionRateStrategy(t *testing.T) {
 	}
 }
 
+func TestExemplarsIngestionRateStrategy(t *testing.T) {
+	t.Parallel()
+	overrides, err := validation.NewOverrides(validation.Limits{
+		DistributorExemplarsIngestionRate:      float64(1000),
+		DistributorExemplarsIngestionBurstSize: 100,
+	}, nil)
+	require.NoError(t, err)
+
+	strategy := newLocalExemplarsIngestionRateStrategy(overrides)
+	assert.Equal(t, float64(1000), strategy.Limit("test"))
+	assert.Equal(t, 100, strategy.Burst("test"))
+
+	ring := newReadLifecyclerMock()
+	ring.On("HealthyInstancesCount").Return(4)
+	strategy = newGlobalExemplarsIngestionRateStrategy(overrides, ring)
+	assert.Equal(t, float64(250), strategy.Limit("test"))
+	assert.Equal(t, 100, strategy.Burst("test"))
+}
+
 type readLifecyclerMock struct {
 	mock.Mock
 }
@@ -2,6 +2,7 @@ package distributor
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sort"
 	"time"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	ingester_client "github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/partialresponse"
 	"github.com/cortexproject/cortex/pkg/querier/stats"
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/tenant"
@@ -37,7 +39,12 @@ func (d *Distributor) QueryExemplars(ctx context.Context, from, to model.Time, m
 			return err
 		}
 
-		result, err = d.queryIngestersExemplars(ctx, replicationSet, req)
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return err
+		}
+
+		result, err = d.queryIngestersExemplars(ctx, replicationSet, req, d.limits.MaxExemplarsPerQuery(userID))
 		if err != nil {
 			return err
 		}
@@ -108,6 +115,36 @@ func (d *Distributor) GetIngestersForQuery(ctx context.Context, matchers ...*lab
 	return d.ingestersRing.GetReplicationSetForOperation(ring.Read)
 }
 
+// GetIngesterIDsForQuery returns the IDs of the healthy ingesters that should be queried for the
+// tenant. The unhealthy ingesters are left out, because they're not queried anyway.
+func (d *Distributor) GetIngesterIDsForQuery(ctx context.Context) ([]string, error) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var r ring.ReadRing = d.ingestersRing
+	if d.cfg.ShardingStrategy == util.ShardingStrategyShuffle {
+		shardSize := d.limits.IngestionTenantShardSize(userID)
+		lookbackPeriod := d.cfg.ShuffleShardingLookbackPeriod
+
+		if shardSize > 0 && lookbackPeriod > 0 {
+			r = d.ingestersRing.ShuffleShardWithLookback(userID, shardSize, lookbackPeriod, time.Now())
+		}
+	}
+
+	instances, err := r.GetInstanceDescsForOperation(ring.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // GetIngestersForMetadata returns a replication set including all ingesters that should be queried
 // to fetch metadata (eg. label names/values or series).
 func (d *Distributor) GetIngestersForMetadata(ctx context.Context) (ring.ReplicationSet, error) {
@@ -155,8 +192,9 @@ func mergeExemplarSets(a, b []cortexpb.Exemplar) []cortexpb.Exemplar {
 	return result
 }
 
-// queryIngestersExemplars queries the ingesters for exemplars.
-func (d *Distributor) queryIngestersExemplars(ctx context.Context, replicationSet ring.ReplicationSet, req *ingester_client.ExemplarQueryRequest) (*ingester_client.ExemplarQueryResponse, error) {
+// queryIngestersExemplars queries the ingesters for exemplars, returning at most maxExemplars
+// exemplars if greater than 0.
+func (d *Distributor) queryIngestersExemplars(ctx context.Context, replicationSet ring.ReplicationSet, req *ingester_client.ExemplarQueryRequest, maxExemplars int) (*ingester_client.ExemplarQueryResponse, error) {
 	// Fetch exemplars from multiple ingesters in parallel, using the replicationSet
 	// to deal with consistency.
 	results, err := replicationSet.Do(ctx, d.cfg.ExtraQueryDelay, false, func(ctx context.Context, ing *ring.InstanceDesc) (interface{}, error) {
@@ -178,10 +216,17 @@ func (d *Distributor) queryIngestersExemplars(ctx context.Context, replicationSe
 		return nil, err
 	}
 
-	return mergeExemplarQueryResponses(results), nil
+	result, truncated := mergeExemplarQueryResponses(results, maxExemplars)
+	if truncated {
+		partialresponse.Add(ctx, fmt.Sprintf("the exemplars have been truncated to the limit of %d exemplars per query", maxExemplars))
+	}
+	return result, nil
 }
 
-func mergeExemplarQueryResponses(results []interface{}) *ingester_client.ExemplarQueryResponse {
+// mergeExemplarQueryResponses merges the exemplars of the ingesters. If maxExemplars is greater
+// than 0, the exemplars of the series in label order are returned up to maxExemplars, and
+// whether the exemplars have been truncated is returned.
+func mergeExemplarQueryResponses(results []interface{}, maxExemplars int) (*ingester_client.ExemplarQueryResponse, bool) {
 	var keys []string
 	exemplarResults := make(map[string]cortexpb.TimeSeries)
 	buf := make([]byte, 0, 1024)
@@ -204,12 +249,22 @@ func mergeExemplarQueryResponses(results []interface{}) *ingester_client.Exempla
 	// Query results from each ingester were sorted, but are not necessarily still sorted after merging.
 	sort.Strings(keys)
 
-	result := make([]cortexpb.TimeSeries, len(exemplarResults))
-	for i, k := range keys {
-		result[i] = exemplarResults[k]
+	result := make([]cortexpb.TimeSeries, 0, len(exemplarResults))
+	numExemplars, truncated := 0, false
+	for _, k := range keys {
+		ts := exemplarResults[k]
+		if maxExemplars > 0 && numExemplars+len(ts.Exemplars) > maxExemplars {
+			truncated = true
+			if ts.Exemplars = ts.Exemplars[:maxExemplars-numExemplars]; len(ts.Exemplars) > 0 {
+				result = append(result, ts)
+			}
+			break
+		}
+		numExemplars += len(ts.Exemplars)
+		result = append(result, ts)
 	}
 
-	return &ingester_client.ExemplarQueryResponse{Timeseries: result}
+	return &ingester_client.ExemplarQueryResponse{Timeseries: result}, truncated
 }
 
 // queryIngesterStream queries the ingesters using the new streaming API.
@@ -78,13 +78,61 @@ func TestMergeExemplars(t *testing.T) {
 			t.Parallel()
 			rA := &ingester_client.ExemplarQueryResponse{Timeseries: c.seriesA}
 			rB := &ingester_client.ExemplarQueryResponse{Timeseries: c.seriesB}
-			e := mergeExemplarQueryResponses([]interface{}{rA, rB})
+			e, _ := mergeExemplarQueryResponses([]interface{}{rA, rB}, 0)
 			require.Equal(t, c.expected, e.Timeseries)
 			if !c.nonReversible {
 				// Check the other way round too
-				e = mergeExemplarQueryResponses([]interface{}{rB, rA})
+				e, _ = mergeExemplarQueryResponses([]interface{}{rB, rA}, 0)
 				require.Equal(t, c.expected, e.Timeseries)
 			}
 		})
 	}
 }
+
+func TestMergeExemplars_MaxExemplars(t *testing.T) {
+	t.Parallel()
+	exemplar1 := cortexpb.Exemplar{Labels: cortexpb.FromLabelsToLabelAdapters(labels.FromStrings("traceID", "trace-1")), TimestampMs: 1, Value: 1}
+	exemplar2 := cortexpb.Exemplar{Labels: cortexpb.FromLabelsToLabelAdapters(labels.FromStrings("traceID", "trace-2")), TimestampMs: 2, Value: 2}
+	exemplar3 := cortexpb.Exemplar{Labels: cortexpb.FromLabelsToLabelAdapters(labels.FromStrings("traceID", "trace-3")), TimestampMs: 3, Value: 3}
+	labels1 := []cortexpb.LabelAdapter{{Name: "label1", Value: "foo1"}}
+	labels2 := []cortexpb.LabelAdapter{{Name: "label1", Value: "foo2"}}
+	rA := &ingester_client.ExemplarQueryResponse{Timeseries: []cortexpb.TimeSeries{{Labels: labels2, Exemplars: []cortexpb.Exemplar{exemplar3}}}}
+	rB := &ingester_client.ExemplarQueryResponse{Timeseries: []cortexpb.TimeSeries{{Labels: labels1, Exemplars: []cortexpb.Exemplar{exemplar1, exemplar2}}}}
+
+	for name, c := range map[string]struct {
+		maxExemplars      int
+		expected          []cortexpb.TimeSeries
+		expectedTruncated bool
+	}{
+		"disabled": {
+			maxExemplars: 0,
+			expected: []cortexpb.TimeSeries{
+				{Labels: labels1, Exemplars: []cortexpb.Exemplar{exemplar1, exemplar2}},
+				{Labels: labels2, Exemplars: []cortexpb.Exemplar{exemplar3}}},
+		},
+		"not exceeded": {
+			maxExemplars: 3,
+			expected: []cortexpb.TimeSeries{
+				{Labels: labels1, Exemplars: []cortexpb.Exemplar{exemplar1, exemplar2}},
+				{Labels: labels2, Exemplars: []cortexpb.Exemplar{exemplar3}}},
+		},
+		"exceeded at a series boundary": {
+			maxExemplars:      2,
+			expected:          []cortexpb.TimeSeries{{Labels: labels1, Exemplars: []cortexpb.Exemplar{exemplar1, exemplar2}}},
+			expectedTruncated: true,
+		},
+		"exceeded within a series": {
+			maxExemplars:      1,
+			expected:          []cortexpb.TimeSeries{{Labels: labels1, Exemplars: []cortexpb.Exemplar{exemplar1}}},
+			expectedTruncated: true,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			e, truncated := mergeExemplarQueryResponses([]interface{}{rA, rB}, c.maxExemplars)
+			require.Equal(t, c.expected, e.Timeseries)
+			require.Equal(t, c.expectedTruncated, truncated)
+		})
+	}
+}
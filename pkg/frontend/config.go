@@ -21,6 +21,9 @@ type CombinedFrontendConfig struct {
 	FrontendV2 v2.Config               `yaml:",inline"`
 
 	DownstreamURL string `yaml:"downstream_url"`
+
+	// Experimental. Pools the queries are routed to by their shape.
+	DownstreamPools []DownstreamPool `yaml:"downstream_pools" doc:"nocli|description=[Experimental] List of downstream pools the queries are routed to by their shape, in addition to the default one. A query is routed to the first pool matching it, and to the default pool if none does."`
 }
 
 func (cfg *CombinedFrontendConfig) RegisterFlags(f *flag.FlagSet) {
@@ -31,6 +34,14 @@ func (cfg *CombinedFrontendConfig) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.DownstreamURL, "frontend.downstream-url", "", "URL of downstream Prometheus.")
 }
 
+// Validate validates the config.
+func (cfg *CombinedFrontendConfig) Validate() error {
+	if err := validateDownstreamPools(cfg.DownstreamPools); err != nil {
+		return err
+	}
+	return cfg.Handler.Validate()
+}
+
 // InitFrontend initializes frontend (either V1 -- without scheduler, or V2 -- with scheduler) or no frontend at
 // all if downstream Prometheus URL is used instead.
 //
@@ -38,6 +49,20 @@ func (cfg *CombinedFrontendConfig) RegisterFlags(f *flag.FlagSet) {
 // into HTTP server using the Handler from this package. Returned RoundTripper is always non-nil
 // (if there are no errors), and it uses the returned frontend (if any).
 func InitFrontend(cfg CombinedFrontendConfig, limits v1.Limits, grpcListenPort int, log log.Logger, reg prometheus.Registerer, retry *transport.Retry) (http.RoundTripper, *v1.Frontend, *v2.Frontend, error) {
+	rt, frontendV1, frontendV2, err := initDefaultFrontend(cfg, limits, grpcListenPort, log, reg, retry)
+	if err != nil || len(cfg.DownstreamPools) == 0 {
+		return rt, frontendV1, frontendV2, err
+	}
+
+	// Route the queries to the downstream pools by their shape, falling back to the default frontend.
+	router, err := newQueryRouter(rt, cfg.DownstreamPools, reg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return router, frontendV1, frontendV2, nil
+}
+
+func initDefaultFrontend(cfg CombinedFrontendConfig, limits v1.Limits, grpcListenPort int, log log.Logger, reg prometheus.Registerer, retry *transport.Retry) (http.RoundTripper, *v1.Frontend, *v2.Frontend, error) {
 	switch {
 	case cfg.DownstreamURL != "":
 		// If the user has specified a downstream Prometheus, then we should use that.
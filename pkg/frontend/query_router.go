@@ -0,0 +1,180 @@
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// defaultPoolName is the name of the pool the queries not matching any downstream pool are sent to.
+const defaultPoolName = "default"
+
+var (
+	errDownstreamPoolNameRequired = errors.New("the downstream pool name is required")
+	errDownstreamPoolURLRequired  = errors.New("the downstream pool URL is required")
+)
+
+// DownstreamPool is a pool of queriers the queries matching any of the shapes are routed to.
+type DownstreamPool struct {
+	Name        string       `yaml:"name" doc:"nocli|description=Name of the pool, used in the metrics. Must be unique."`
+	URL         string       `yaml:"url" doc:"nocli|description=URL of the downstream pool the matching queries are sent to."`
+	QueryShapes []QueryShape `yaml:"query_shapes" doc:"nocli|description=List of query shapes routed to the pool. A query matching any of them is routed to the pool."`
+}
+
+// QueryShape describes the queries routed to a downstream pool. A query matches the shape if it
+// matches all the configured conditions.
+type QueryShape struct {
+	Functions    []string       `yaml:"functions" doc:"nocli|description=Functions or aggregation operators, at least one of which the query should use. If empty, it won't be checked."`
+	MinTimeRange model.Duration `yaml:"min_time_range" doc:"nocli|description=Minimum time range of the data selected by the query, including range selectors and modifiers. If set to 0, it won't be checked.|default=0"`
+}
+
+func validateDownstreamPools(pools []DownstreamPool) error {
+	names := map[string]struct{}{defaultPoolName: {}}
+	for _, pool := range pools {
+		if pool.Name == "" {
+			return errDownstreamPoolNameRequired
+		}
+		if _, ok := names[pool.Name]; ok {
+			return fmt.Errorf("the downstream pool name %q is reserved or not unique", pool.Name)
+		}
+		names[pool.Name] = struct{}{}
+
+		if pool.URL == "" {
+			return errDownstreamPoolURLRequired
+		}
+	}
+	return nil
+}
+
+func (s QueryShape) matches(expr parser.Expr, timeRange time.Duration) bool {
+	if s.MinTimeRange > 0 && timeRange < time.Duration(s.MinTimeRange) {
+		return false
+	}
+	if len(s.Functions) == 0 {
+		return true
+	}
+
+	used := queryFunctions(expr)
+	for _, fn := range s.Functions {
+		if _, ok := used[fn]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// queryFunctions returns the names of the functions and aggregation operators used by the query.
+func queryFunctions(expr parser.Expr) map[string]struct{} {
+	used := map[string]struct{}{}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			used[n.Func.Name] = struct{}{}
+		case *parser.AggregateExpr:
+			used[n.Op.String()] = struct{}{}
+		}
+		return nil
+	})
+	return used
+}
+
+type routedPool struct {
+	DownstreamPool
+	next http.RoundTripper
+}
+
+// queryRouter is an http.RoundTripper classifying the queries by their shape, and routing each
+// of them to the first downstream pool with a matching shape. The queries not matching any pool,
+// and the requests which are not queries, are sent to the default pool.
+type queryRouter struct {
+	pools       []routedPool
+	defaultPool http.RoundTripper
+	now         func() time.Time
+
+	routedRequests *prometheus.CounterVec
+}
+
+func newQueryRouter(defaultPool http.RoundTripper, pools []DownstreamPool, reg prometheus.Registerer) (*queryRouter, error) {
+	r := &queryRouter{
+		defaultPool: defaultPool,
+		now:         time.Now,
+		routedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_routed_requests_total",
+			Help: "Total number of requests sent downstream per pool.",
+		}, []string{"pool"}),
+	}
+
+	for _, pool := range pools {
+		rt, err := NewDownstreamRoundTripper(pool.URL, http.DefaultTransport)
+		if err != nil {
+			return nil, errors.Wrapf(err, "downstream pool %s", pool.Name)
+		}
+		r.pools = append(r.pools, routedPool{DownstreamPool: pool, next: rt})
+	}
+	return r, nil
+}
+
+func (r *queryRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	pool, next := defaultPoolName, r.defaultPool
+	if p := r.route(req); p != nil {
+		pool, next = p.Name, p.next
+	}
+
+	r.routedRequests.WithLabelValues(pool).Inc()
+	return next.RoundTrip(req)
+}
+
+// route returns the pool the request should be sent to, or nil for the default pool.
+func (r *queryRouter) route(req *http.Request) *routedPool {
+	form, err := parseRequestForm(req)
+	if err != nil || !form.Form.Has("query") {
+		return nil
+	}
+
+	expr, err := parser.ParseExpr(form.FormValue("query"))
+	if err != nil {
+		// Let the default pool return the error.
+		return nil
+	}
+
+	minTime, maxTime := util.FindMinMaxTime(form, expr, 0, r.now())
+	timeRange := time.Duration(maxTime-minTime) * time.Millisecond
+
+	for i := range r.pools {
+		for _, shape := range r.pools[i].QueryShapes {
+			if shape.matches(expr, timeRange) {
+				return &r.pools[i]
+			}
+		}
+	}
+	return nil
+}
+
+// parseRequestForm returns a copy of the request with the form parsed, leaving the body of the
+// original request untouched so that it can still be sent downstream.
+func parseRequestForm(req *http.Request) (*http.Request, error) {
+	form := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		form.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if err := form.ParseForm(); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
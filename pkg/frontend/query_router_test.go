@@ -0,0 +1,151 @@
+package frontend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryRouter(t *testing.T) {
+	// Each downstream server replies with its name and the query it received.
+	newDownstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, r.ParseForm())
+			_, _ = io.WriteString(w, name+":"+r.Form.Get("query"))
+		}))
+	}
+
+	heavy := newDownstream("heavy")
+	defer heavy.Close()
+	longRange := newDownstream("long-range")
+	defer longRange.Close()
+	general := newDownstream(defaultPoolName)
+	defer general.Close()
+
+	defaultPool, err := NewDownstreamRoundTripper(general.URL, http.DefaultTransport)
+	require.NoError(t, err)
+
+	pools := []DownstreamPool{
+		{Name: "heavy", URL: heavy.URL, QueryShapes: []QueryShape{{Functions: []string{"topk", "quantile_over_time"}}}},
+		{Name: "long-range", URL: longRange.URL, QueryShapes: []QueryShape{{MinTimeRange: model.Duration(24 * time.Hour)}}},
+	}
+	require.NoError(t, validateDownstreamPools(pools))
+
+	reg := prometheus.NewPedanticRegistry()
+	router, err := newQueryRouter(defaultPool, pools, reg)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		path         string
+		params       url.Values
+		post         bool
+		expectedPool string
+	}{
+		"aggregation operator matching a pool": {
+			path:         "/api/v1/query",
+			params:       url.Values{"query": {"topk(5, up)"}, "time": {"1700000000"}},
+			expectedPool: "heavy",
+		},
+		"function matching a pool": {
+			path:         "/api/v1/query_range",
+			params:       url.Values{"query": {"sum(quantile_over_time(0.9, up[5m]))"}, "start": {"1700000000"}, "end": {"1700003600"}, "step": {"60"}},
+			expectedPool: "heavy",
+		},
+		"time range matching a pool": {
+			path:         "/api/v1/query_range",
+			params:       url.Values{"query": {"sum(up)"}, "start": {"1700000000"}, "end": {"1700172800"}, "step": {"60"}},
+			expectedPool: "long-range",
+		},
+		"range selector matching a pool": {
+			path:         "/api/v1/query",
+			params:       url.Values{"query": {"sum(rate(up[7d]))"}, "time": {"1700000000"}},
+			post:         true,
+			expectedPool: "long-range",
+		},
+		"query not matching any pool": {
+			path:         "/api/v1/query",
+			params:       url.Values{"query": {"sum(rate(up[5m]))"}, "time": {"1700000000"}},
+			post:         true,
+			expectedPool: defaultPoolName,
+		},
+		"request which is not a query": {
+			path:         "/api/v1/labels",
+			params:       url.Values{"match[]": {"up"}},
+			expectedPool: defaultPoolName,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			var req *http.Request
+			if testData.post {
+				req = httptest.NewRequest(http.MethodPost, testData.path, strings.NewReader(testData.params.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(http.MethodGet, testData.path+"?"+testData.params.Encode(), nil)
+			}
+			req.RequestURI = ""
+
+			resp, err := router.RoundTrip(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			// The request is received by the pool untouched.
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedPool+":"+testData.params.Get("query"), string(body))
+		})
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(router.routedRequests.WithLabelValues("heavy")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(router.routedRequests.WithLabelValues("long-range")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(router.routedRequests.WithLabelValues(defaultPoolName)))
+}
+
+func TestValidateDownstreamPools(t *testing.T) {
+	tests := map[string]struct {
+		pools       []DownstreamPool
+		expectedErr string
+	}{
+		"valid pools": {
+			pools: []DownstreamPool{{Name: "a", URL: "http://a"}, {Name: "b", URL: "http://b"}},
+		},
+		"missing name": {
+			pools:       []DownstreamPool{{URL: "http://a"}},
+			expectedErr: errDownstreamPoolNameRequired.Error(),
+		},
+		"missing URL": {
+			pools:       []DownstreamPool{{Name: "a"}},
+			expectedErr: errDownstreamPoolURLRequired.Error(),
+		},
+		"duplicated name": {
+			pools:       []DownstreamPool{{Name: "a", URL: "http://a"}, {Name: "a", URL: "http://b"}},
+			expectedErr: `the downstream pool name "a" is reserved or not unique`,
+		},
+		"reserved name": {
+			pools:       []DownstreamPool{{Name: defaultPoolName, URL: "http://a"}},
+			expectedErr: `the downstream pool name "default" is reserved or not unique`,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateDownstreamPools(testData.pools)
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testData.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/services"
+)
+
+const (
+	auditFieldTime         = "time"
+	auditFieldTenant       = "tenant"
+	auditFieldMethod       = "method"
+	auditFieldPath         = "path"
+	auditFieldQuery        = "query"
+	auditFieldStart        = "start"
+	auditFieldEnd          = "end"
+	auditFieldStep         = "step"
+	auditFieldResponseTime = "response_time_seconds"
+	auditFieldStatusCode   = "status_code"
+	auditFieldOutcome      = "outcome"
+	auditFieldError        = "error"
+
+	auditOutcomeSuccess = "success"
+	auditOutcomeError   = "error"
+
+	// QueryAuditSinkFile appends the query audit entries to a dedicated file.
+	QueryAuditSinkFile = "file"
+	// QueryAuditSinkLog writes the query audit entries through the regular logger.
+	QueryAuditSinkLog = "log"
+)
+
+// QueryAuditFields are all the fields which can be included in a query audit entry.
+var QueryAuditFields = []string{
+	auditFieldTime,
+	auditFieldTenant,
+	auditFieldMethod,
+	auditFieldPath,
+	auditFieldQuery,
+	auditFieldStart,
+	auditFieldEnd,
+	auditFieldStep,
+	auditFieldResponseTime,
+	auditFieldStatusCode,
+	auditFieldOutcome,
+	auditFieldError,
+}
+
+// QueryAuditSinks are all the supported query audit sinks.
+var QueryAuditSinks = []string{QueryAuditSinkFile, QueryAuditSinkLog}
+
+var (
+	errQueryAuditInvalidBufferSize = errors.New("the query audit buffer size must be greater than 0")
+	errQueryAuditNoFields          = errors.New("at least one query audit field must be configured")
+)
+
+// QueryAuditConfig configures the query audit log.
+type QueryAuditConfig struct {
+	Sink          string                 `yaml:"sink"`
+	File          string                 `yaml:"file"`
+	Fields        flagext.StringSliceCSV `yaml:"fields"`
+	BufferSize    int                    `yaml:"buffer_size"`
+	BlockWhenFull bool                   `yaml:"block_when_full"`
+}
+
+// RegisterFlagsWithPrefix registers flags with the given prefix.
+func (cfg *QueryAuditConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	cfg.Fields = append(flagext.StringSliceCSV(nil), QueryAuditFields...)
+
+	f.StringVar(&cfg.Sink, prefix+"sink", QueryAuditSinkFile, fmt.Sprintf("[Experimental] Where the query audit entries are written. Supported values: %s. When set to %s, the entries are written through the regular logs and the query audit log is enabled regardless of the file.", strings.Join(QueryAuditSinks, ", "), QueryAuditSinkLog))
+	f.StringVar(&cfg.File, prefix+"file", "", "[Experimental] Path of the file an audit entry is appended to, as a JSON line, for every query received by the query-frontend, when the sink is file. The audit log is independent from the regular logs. Empty to disable the query audit log.")
+	f.Var(&cfg.Fields, prefix+"fields", fmt.Sprintf("[Experimental] Comma separated list of fields to include in each query audit entry. Supported values: %s.", strings.Join(QueryAuditFields, ", ")))
+	f.IntVar(&cfg.BufferSize, prefix+"buffer-size", 1000, "[Experimental] Max number of query audit entries buffered in memory while waiting to be written.")
+	f.BoolVar(&cfg.BlockWhenFull, prefix+"block-when-full", false, "[Experimental] When the query audit buffer is full, hold the query response until the entry can be buffered, instead of dropping the entry.")
+}
+
+// Validate validates the config.
+func (cfg *QueryAuditConfig) Validate() error {
+	if cfg.Sink != QueryAuditSinkFile && cfg.Sink != QueryAuditSinkLog {
+		return fmt.Errorf("unsupported query audit sink %q", cfg.Sink)
+	}
+	if !cfg.enabled() {
+		return nil
+	}
+	if cfg.BufferSize <= 0 {
+		return errQueryAuditInvalidBufferSize
+	}
+	if len(cfg.Fields) == 0 {
+		return errQueryAuditNoFields
+	}
+	for _, field := range cfg.Fields {
+		if !isQueryAuditField(field) {
+			return fmt.Errorf("unsupported query audit field %q", field)
+		}
+	}
+	return nil
+}
+
+// enabled returns whether the query audit log is enabled.
+func (cfg *QueryAuditConfig) enabled() bool {
+	return cfg.Sink == QueryAuditSinkLog || cfg.File != ""
+}
+
+func isQueryAuditField(field string) bool {
+	for _, f := range QueryAuditFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// queryAuditEntry is the audit record of a single query.
+type queryAuditEntry struct {
+	time         time.Time
+	tenant       string
+	method       string
+	path         string
+	params       url.Values
+	responseTime time.Duration
+	statusCode   int
+	err          error
+}
+
+// queryAuditSink is where the query audit records are written.
+type queryAuditSink interface {
+	write(record map[string]interface{}) error
+	close() error
+}
+
+// fileQueryAuditSink writes each record as a JSON line.
+type fileQueryAuditSink struct {
+	writer io.WriteCloser
+}
+
+func (s *fileQueryAuditSink) write(record map[string]interface{}) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileQueryAuditSink) close() error {
+	return s.writer.Close()
+}
+
+// logQueryAuditSink writes each record through the logger, with the fields in the configured order.
+type logQueryAuditSink struct {
+	logger log.Logger
+	fields []string
+}
+
+func (s *logQueryAuditSink) write(record map[string]interface{}) error {
+	keyvals := make([]interface{}, 0, 2+2*len(record))
+	keyvals = append(keyvals, "msg", "query audit")
+	for _, field := range s.fields {
+		if value, ok := record[field]; ok {
+			keyvals = append(keyvals, field, value)
+		}
+	}
+	return level.Info(s.logger).Log(keyvals...)
+}
+
+func (s *logQueryAuditSink) close() error {
+	return nil
+}
+
+// QueryAuditLogger writes an entry for each query to the configured sink. Entries are
+// buffered in memory and written asynchronously, so that slow writes don't delay queries.
+type QueryAuditLogger struct {
+	services.Service
+
+	cfg    QueryAuditConfig
+	logger log.Logger
+	sink   queryAuditSink
+	fields []string
+
+	entries chan queryAuditEntry
+
+	// Metrics.
+	written prometheus.Counter
+	dropped prometheus.Counter
+	failed  prometheus.Counter
+}
+
+// NewQueryAuditLogger creates a new QueryAuditLogger. It returns nil if the query audit log is disabled.
+func NewQueryAuditLogger(cfg QueryAuditConfig, logger log.Logger, reg prometheus.Registerer) (*QueryAuditLogger, error) {
+	if !cfg.enabled() {
+		return nil, nil
+	}
+
+	if cfg.Sink == QueryAuditSinkLog {
+		return newQueryAuditLogger(cfg, &logQueryAuditSink{logger: logger, fields: cfg.Fields}, logger, reg), nil
+	}
+
+	file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open query audit log file")
+	}
+
+	return newQueryAuditLogger(cfg, &fileQueryAuditSink{writer: file}, logger, reg), nil
+}
+
+func newQueryAuditLogger(cfg QueryAuditConfig, sink queryAuditSink, logger log.Logger, reg prometheus.Registerer) *QueryAuditLogger {
+	a := &QueryAuditLogger{
+		cfg:     cfg,
+		logger:  logger,
+		sink:    sink,
+		fields:  cfg.Fields,
+		entries: make(chan queryAuditEntry, cfg.BufferSize),
+		written: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_frontend_query_audit_entries_written_total",
+			Help: "Total number of query audit entries written.",
+		}),
+		dropped: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_frontend_query_audit_entries_dropped_total",
+			Help: "Total number of query audit entries dropped because the buffer was full.",
+		}),
+		failed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_frontend_query_audit_entries_failed_total",
+			Help: "Total number of query audit entries which failed to be written.",
+		}),
+	}
+	a.Service = services.NewBasicService(nil, a.running, a.stopping)
+	return a
+}
+
+// log buffers the entry to be written. If the buffer is full, the entry is dropped, unless
+// the logger is configured to block, in which case it waits until there's room in the buffer
+// or the context is done.
+func (a *QueryAuditLogger) log(ctx context.Context, entry queryAuditEntry) {
+	if a.State() != services.Running {
+		a.dropped.Inc()
+		return
+	}
+
+	if !a.cfg.BlockWhenFull {
+		select {
+		case a.entries <- entry:
+		default:
+			a.dropped.Inc()
+		}
+		return
+	}
+
+	select {
+	case a.entries <- entry:
+	case <-ctx.Done():
+		a.dropped.Inc()
+	}
+}
+
+func (a *QueryAuditLogger) running(ctx context.Context) error {
+	for {
+		select {
+		case entry := <-a.entries:
+			a.write(entry)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (a *QueryAuditLogger) stopping(_ error) error {
+	// Write the entries which have been buffered before stopping.
+	for {
+		select {
+		case entry := <-a.entries:
+			a.write(entry)
+		default:
+			return a.sink.close()
+		}
+	}
+}
+
+func (a *QueryAuditLogger) write(entry queryAuditEntry) {
+	if err := a.sink.write(a.record(entry)); err != nil {
+		a.failed.Inc()
+		level.Warn(a.logger).Log("msg", "failed to write query audit entry", "err", err)
+		return
+	}
+	a.written.Inc()
+}
+
+// record returns the configured fields of the entry. Fields which don't apply to the
+// query, like the time range of an instant query, are omitted.
+func (a *QueryAuditLogger) record(entry queryAuditEntry) map[string]interface{} {
+	record := make(map[string]interface{}, len(a.fields))
+	for _, field := range a.fields {
+		switch field {
+		case auditFieldTime:
+			record[field] = entry.time.UTC().Format(time.RFC3339Nano)
+		case auditFieldTenant:
+			record[field] = entry.tenant
+		case auditFieldMethod:
+			record[field] = entry.method
+		case auditFieldPath:
+			record[field] = entry.path
+		case auditFieldQuery:
+			if query := entry.params.Get("query"); query != "" {
+				record[field] = query
+			} else if matchers := entry.params["match[]"]; len(matchers) > 0 {
+				record[field] = strings.Join(matchers, ",")
+			}
+		case auditFieldStart, auditFieldEnd, auditFieldStep:
+			if value := entry.params.Get(field); value != "" {
+				record[field] = value
+			}
+		case auditFieldResponseTime:
+			record[field] = entry.responseTime.Seconds()
+		case auditFieldStatusCode:
+			record[field] = entry.statusCode
+		case auditFieldOutcome:
+			if entry.err != nil || entry.statusCode/100 != 2 {
+				record[field] = auditOutcomeError
+			} else {
+				record[field] = auditOutcomeSuccess
+			}
+		case auditFieldError:
+			if entry.err != nil {
+				record[field] = entry.err.Error()
+			}
+		}
+	}
+	return record
+}
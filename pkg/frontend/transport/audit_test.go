@@ -0,0 +1,305 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/services"
+)
+
+func TestQueryAuditConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(cfg *QueryAuditConfig)
+		expected string
+	}{
+		"should pass with defaults": {
+			setup: func(cfg *QueryAuditConfig) {},
+		},
+		"should not validate the other options when disabled": {
+			setup: func(cfg *QueryAuditConfig) {
+				cfg.BufferSize = 0
+			},
+		},
+		"should fail on unsupported sink": {
+			setup: func(cfg *QueryAuditConfig) {
+				cfg.Sink = "unknown"
+			},
+			expected: `unsupported query audit sink "unknown"`,
+		},
+		"should validate the other options when the log sink is enabled without a file": {
+			setup: func(cfg *QueryAuditConfig) {
+				cfg.Sink = QueryAuditSinkLog
+				cfg.BufferSize = 0
+			},
+			expected: errQueryAuditInvalidBufferSize.Error(),
+		},
+		"should fail on non-positive buffer size": {
+			setup: func(cfg *QueryAuditConfig) {
+				cfg.File = "audit.log"
+				cfg.BufferSize = 0
+			},
+			expected: errQueryAuditInvalidBufferSize.Error(),
+		},
+		"should fail without fields": {
+			setup: func(cfg *QueryAuditConfig) {
+				cfg.File = "audit.log"
+				cfg.Fields = nil
+			},
+			expected: errQueryAuditNoFields.Error(),
+		},
+		"should fail on unsupported field": {
+			setup: func(cfg *QueryAuditConfig) {
+				cfg.File = "audit.log"
+				cfg.Fields = []string{auditFieldTenant, "unknown"}
+			},
+			expected: `unsupported query audit field "unknown"`,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultQueryAuditConfig()
+			testData.setup(&cfg)
+
+			err := cfg.Validate()
+			if testData.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testData.expected)
+			}
+		})
+	}
+}
+
+func TestHandler_ShouldWriteQueryAuditEntries(t *testing.T) {
+	cfg := defaultQueryAuditConfig()
+
+	writer := &bufferWriteCloser{}
+	auditLogger := newQueryAuditLogger(cfg, &fileQueryAuditSink{writer: writer}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), auditLogger))
+
+	roundTripper := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path == "/api/v1/query" {
+			return nil, httpgrpc.Errorf(http.StatusUnprocessableEntity, "query failed")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	handler := NewHandler(HandlerConfig{}, roundTripper, auditLogger, log.NewNopLogger(), nil)
+
+	for _, target := range []string{
+		"/api/v1/query_range?query=up&start=1&end=2&step=1",
+		"/api/v1/query?query=sum(up)",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Stopping the logger writes all the buffered entries.
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), auditLogger))
+	assert.True(t, writer.closed)
+
+	lines := strings.Split(strings.TrimSpace(writer.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var rangeEntry, instantEntry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rangeEntry))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &instantEntry))
+
+	assert.Equal(t, "user-1", rangeEntry[auditFieldTenant])
+	assert.Equal(t, "/api/v1/query_range", rangeEntry[auditFieldPath])
+	assert.Equal(t, "up", rangeEntry[auditFieldQuery])
+	assert.Equal(t, "1", rangeEntry[auditFieldStart])
+	assert.Equal(t, "2", rangeEntry[auditFieldEnd])
+	assert.Equal(t, "1", rangeEntry[auditFieldStep])
+	assert.Equal(t, float64(http.StatusOK), rangeEntry[auditFieldStatusCode])
+	assert.Equal(t, auditOutcomeSuccess, rangeEntry[auditFieldOutcome])
+	assert.NotContains(t, rangeEntry, auditFieldError)
+
+	assert.Equal(t, "sum(up)", instantEntry[auditFieldQuery])
+	assert.NotContains(t, instantEntry, auditFieldStart)
+	assert.Equal(t, float64(http.StatusUnprocessableEntity), instantEntry[auditFieldStatusCode])
+	assert.Equal(t, auditOutcomeError, instantEntry[auditFieldOutcome])
+	assert.Contains(t, instantEntry[auditFieldError], "query failed")
+
+	assert.Equal(t, 2.0, promtest.ToFloat64(auditLogger.written))
+	assert.Equal(t, 0.0, promtest.ToFloat64(auditLogger.dropped))
+}
+
+func TestHandler_ShouldWriteQueryAuditEntryWhenTheFormCannotBeParsed(t *testing.T) {
+	cfg := defaultQueryAuditConfig()
+
+	writer := &bufferWriteCloser{}
+	auditLogger := newQueryAuditLogger(cfg, &fileQueryAuditSink{writer: writer}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), auditLogger))
+
+	roundTripper := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		t.Fatal("the request should not be forwarded")
+		return nil, nil
+	})
+	handler := NewHandler(HandlerConfig{MaxBodySize: 1}, roundTripper, auditLogger, log.NewNopLogger(), nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query?start=1", strings.NewReader("query=up"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), auditLogger))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(writer.String())), &entry))
+	assert.Equal(t, "user-1", entry[auditFieldTenant])
+	assert.Equal(t, "/api/v1/query", entry[auditFieldPath])
+	assert.Equal(t, "1", entry[auditFieldStart])
+	assert.Equal(t, float64(http.StatusRequestEntityTooLarge), entry[auditFieldStatusCode])
+	assert.Equal(t, auditOutcomeError, entry[auditFieldOutcome])
+	assert.Contains(t, entry, auditFieldError)
+}
+
+func TestQueryAuditLogger_ShouldWriteEntriesThroughTheLogger(t *testing.T) {
+	cfg := defaultQueryAuditConfig()
+	cfg.Sink = QueryAuditSinkLog
+	cfg.Fields = []string{auditFieldTenant, auditFieldQuery, auditFieldStatusCode}
+
+	buf := &bytes.Buffer{}
+	auditLogger, err := NewQueryAuditLogger(cfg, log.NewLogfmtLogger(buf), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	require.NotNil(t, auditLogger)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), auditLogger))
+
+	auditLogger.log(context.Background(), queryAuditEntry{
+		tenant:     "user-1",
+		params:     map[string][]string{"query": {"up"}},
+		statusCode: http.StatusOK,
+	})
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), auditLogger))
+
+	assert.Equal(t, "level=info msg=\"query audit\" tenant=user-1 query=up status_code=200\n", buf.String())
+	assert.Equal(t, 1.0, promtest.ToFloat64(auditLogger.written))
+}
+
+func TestQueryAuditLogger_ShouldOnlyWriteConfiguredFields(t *testing.T) {
+	cfg := defaultQueryAuditConfig()
+	cfg.Fields = []string{auditFieldTenant, auditFieldOutcome}
+
+	auditLogger := newQueryAuditLogger(cfg, &fileQueryAuditSink{writer: &bufferWriteCloser{}}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	record := auditLogger.record(queryAuditEntry{
+		tenant:     "user-1",
+		path:       "/api/v1/query",
+		statusCode: http.StatusOK,
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		auditFieldTenant:  "user-1",
+		auditFieldOutcome: auditOutcomeSuccess,
+	}, record)
+}
+
+func TestQueryAuditLogger_ShouldDropEntriesWhenBufferIsFull(t *testing.T) {
+	cfg := defaultQueryAuditConfig()
+	cfg.BufferSize = 1
+
+	writer := &bufferWriteCloser{block: make(chan struct{})}
+	auditLogger := newQueryAuditLogger(cfg, &fileQueryAuditSink{writer: writer}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), auditLogger))
+
+	// The first entry is being written, the second one is buffered and the third one is dropped.
+	auditLogger.log(context.Background(), queryAuditEntry{})
+	require.Eventually(t, func() bool { return len(auditLogger.entries) == 0 }, time.Second, 10*time.Millisecond)
+	auditLogger.log(context.Background(), queryAuditEntry{})
+	auditLogger.log(context.Background(), queryAuditEntry{})
+	assert.Equal(t, 1.0, promtest.ToFloat64(auditLogger.dropped))
+
+	close(writer.block)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), auditLogger))
+	assert.Equal(t, 2.0, promtest.ToFloat64(auditLogger.written))
+}
+
+func TestQueryAuditLogger_ShouldBlockWhenBufferIsFull(t *testing.T) {
+	cfg := defaultQueryAuditConfig()
+	cfg.BufferSize = 1
+	cfg.BlockWhenFull = true
+
+	writer := &bufferWriteCloser{block: make(chan struct{})}
+	auditLogger := newQueryAuditLogger(cfg, &fileQueryAuditSink{writer: writer}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), auditLogger))
+
+	auditLogger.log(context.Background(), queryAuditEntry{})
+	require.Eventually(t, func() bool { return len(auditLogger.entries) == 0 }, time.Second, 10*time.Millisecond)
+	auditLogger.log(context.Background(), queryAuditEntry{})
+
+	// The buffer is full, so logging waits until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	auditLogger.log(ctx, queryAuditEntry{})
+	assert.Equal(t, 1.0, promtest.ToFloat64(auditLogger.dropped))
+
+	// Once there's room in the buffer, the entry is buffered.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		auditLogger.log(context.Background(), queryAuditEntry{})
+	}()
+	close(writer.block)
+	<-done
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), auditLogger))
+	assert.Equal(t, 3.0, promtest.ToFloat64(auditLogger.written))
+	assert.Equal(t, 1.0, promtest.ToFloat64(auditLogger.dropped))
+}
+
+func defaultQueryAuditConfig() QueryAuditConfig {
+	cfg := QueryAuditConfig{}
+	cfg.RegisterFlagsWithPrefix("", flag.NewFlagSet("", flag.PanicOnError))
+	return cfg
+}
+
+type bufferWriteCloser struct {
+	mtx    sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+
+	// block, if set, blocks writes until closed.
+	block chan struct{}
+}
+
+func (b *bufferWriteCloser) Write(p []byte) (int, error) {
+	if b.block != nil {
+		<-b.block
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *bufferWriteCloser) Close() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *bufferWriteCloser) String() string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.buf.String()
+}
@@ -73,12 +73,20 @@ type HandlerConfig struct {
 	LogQueriesLongerThan time.Duration `yaml:"log_queries_longer_than"`
 	MaxBodySize          int64         `yaml:"max_body_size"`
 	QueryStatsEnabled    bool          `yaml:"query_stats_enabled"`
+
+	QueryAudit QueryAuditConfig `yaml:"query_audit"`
 }
 
 func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.LogQueriesLongerThan, "frontend.log-queries-longer-than", 0, "Log queries that are slower than the specified duration. Set to 0 to disable. Set to < 0 to enable on all queries.")
 	f.Int64Var(&cfg.MaxBodySize, "frontend.max-body-size", 10*1024*1024, "Max body size for downstream prometheus.")
 	f.BoolVar(&cfg.QueryStatsEnabled, "frontend.query-stats-enabled", false, "True to enable query statistics tracking. When enabled, a message with some statistics is logged for every query.")
+	cfg.QueryAudit.RegisterFlagsWithPrefix("frontend.query-audit.", f)
+}
+
+// Validate validates the config.
+func (cfg *HandlerConfig) Validate() error {
+	return cfg.QueryAudit.Validate()
 }
 
 // Handler accepts queries and forwards them to RoundTripper. It can log slow queries,
@@ -87,6 +95,7 @@ type Handler struct {
 	cfg          HandlerConfig
 	log          log.Logger
 	roundTripper http.RoundTripper
+	auditLogger  *QueryAuditLogger
 
 	// Metrics.
 	querySeconds    *prometheus.CounterVec
@@ -97,12 +106,13 @@ type Handler struct {
 	activeUsers     *util.ActiveUsersCleanupService
 }
 
-// NewHandler creates a new frontend handler.
-func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logger, reg prometheus.Registerer) *Handler {
+// NewHandler creates a new frontend handler. The audit logger is optional.
+func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, auditLogger *QueryAuditLogger, log log.Logger, reg prometheus.Registerer) *Handler {
 	h := &Handler{
 		cfg:          cfg,
 		log:          log,
 		roundTripper: roundTripper,
+		auditLogger:  auditLogger,
 	}
 
 	if cfg.QueryStatsEnabled {
@@ -195,6 +205,10 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if f.cfg.QueryStatsEnabled && util.IsRequestBodyTooLarge(err) {
 				f.rejectedQueries.WithLabelValues(reasonRequestBodySizeExceeded, userID).Inc()
 			}
+			if f.auditLogger != nil {
+				// The form couldn't be parsed, so only the URL parameters are audited.
+				f.reportQueryAudit(r, userID, r.URL.Query(), time.Now(), 0, nil, httpgrpc.Errorf(statusCode, err.Error()))
+			}
 			return
 		}
 		r.Body = io.NopCloser(&buf)
@@ -206,7 +220,7 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Check whether we should parse the query string.
 	shouldReportSlowQuery := f.cfg.LogQueriesLongerThan != 0 && queryResponseTime > f.cfg.LogQueriesLongerThan
-	if shouldReportSlowQuery || f.cfg.QueryStatsEnabled {
+	if shouldReportSlowQuery || f.cfg.QueryStatsEnabled || f.auditLogger != nil {
 		queryString = f.parseRequestQueryString(r, buf)
 	}
 
@@ -234,6 +248,10 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		f.reportQueryStats(r, userID, queryString, queryResponseTime, stats, err, statusCode, resp)
 	}
 
+	if f.auditLogger != nil {
+		f.reportQueryAudit(r, userID, queryString, startTime, queryResponseTime, resp, err)
+	}
+
 	hs := w.Header()
 	if f.cfg.QueryStatsEnabled {
 		writeServiceTimingHeader(queryResponseTime, hs, stats)
@@ -419,6 +437,26 @@ func (f *Handler) reportQueryStats(r *http.Request, userID string, queryString u
 	}
 }
 
+// reportQueryAudit buffers the query audit entry of the request.
+func (f *Handler) reportQueryAudit(r *http.Request, userID string, queryString url.Values, startTime time.Time, queryResponseTime time.Duration, resp *http.Response, err error) {
+	entry := queryAuditEntry{
+		time:         startTime,
+		tenant:       userID,
+		method:       r.Method,
+		path:         r.URL.Path,
+		params:       queryString,
+		responseTime: queryResponseTime,
+		err:          err,
+	}
+	if err != nil {
+		entry.statusCode = getStatusCodeFromError(err)
+	} else if resp != nil {
+		entry.statusCode = resp.StatusCode
+	}
+
+	f.auditLogger.log(r.Context(), entry)
+}
+
 func (f *Handler) parseRequestQueryString(r *http.Request, bodyBuf bytes.Buffer) url.Values {
 	// Use previously buffered body.
 	r.Body = io.NopCloser(&bodyBuf)
@@ -33,6 +33,9 @@ type HATrackerLimits interface {
 	// MaxHAReplicaGroups returns max number of replica groups that HA tracker should track for a user.
 	// Samples from additional replicaGroups are rejected.
 	MaxHAReplicaGroups(user string) int
+
+	// HAFailoverTimeout returns the failover timeout of the user, or 0 to use the configured one.
+	HAFailoverTimeout(user string) time.Duration
 }
 
 // ProtoReplicaDescFactory makes new InstanceDescs
@@ -92,13 +95,19 @@ func (cfg *HATrackerConfig) RegisterFlagsWithPrefix(flagPrefix string, kvPrefix
 	cfg.KVStore.RegisterFlagsWithPrefix(finalFlagPrefix+"ha-tracker.", finalKVPrefix+"ha-tracker/", f)
 }
 
+// minFailoverTimeout returns the min failover timeout, which must be greater than the update
+// timeout, including the jitter.
+func (cfg *HATrackerConfig) minFailoverTimeout() time.Duration {
+	return cfg.UpdateTimeout + cfg.UpdateTimeoutJitterMax + time.Second
+}
+
 // Validate config and returns error on failure
 func (cfg *HATrackerConfig) Validate() error {
 	if cfg.UpdateTimeoutJitterMax < 0 {
 		return errNegativeUpdateTimeoutJitterMax
 	}
 
-	minFailureTimeout := cfg.UpdateTimeout + cfg.UpdateTimeoutJitterMax + time.Second
+	minFailureTimeout := cfg.minFailoverTimeout()
 	if cfg.FailoverTimeout < minFailureTimeout {
 		return fmt.Errorf(errInvalidFailoverTimeout, cfg.FailoverTimeout, minFailureTimeout)
 	}
@@ -414,7 +423,7 @@ func (c *HATracker) CheckReplica(ctx context.Context, userID, replicaGroup, repl
 		}
 	}
 
-	err := c.checkKVStore(ctx, key, replica, now)
+	err := c.checkKVStore(ctx, key, replica, c.failoverTimeout(userID), now)
 	c.kvCASCalls.WithLabelValues(userID, replicaGroup).Inc()
 	if err != nil {
 		// The callback within checkKVStore will return a ReplicasNotMatchError if the sample is being deduped,
@@ -426,7 +435,18 @@ func (c *HATracker) CheckReplica(ctx context.Context, userID, replicaGroup, repl
 	return err
 }
 
-func (c *HATracker) checkKVStore(ctx context.Context, key, replica string, now time.Time) error {
+// failoverTimeout returns the failover timeout of the user. The failover timeouts of the users
+// are raised to the min failover timeout if lower.
+func (c *HATracker) failoverTimeout(userID string) time.Duration {
+	if c.limits != nil {
+		if timeout := c.limits.HAFailoverTimeout(userID); timeout > 0 {
+			return max(timeout, c.cfg.minFailoverTimeout())
+		}
+	}
+	return c.cfg.FailoverTimeout
+}
+
+func (c *HATracker) checkKVStore(ctx context.Context, key, replica string, failoverTimeout time.Duration, now time.Time) error {
 	return c.client.CAS(ctx, key, func(in interface{}) (out interface{}, retry bool, err error) {
 		if desc, ok := in.(*ReplicaDesc); ok && desc.DeletedAt == 0 {
 			// We don't need to CAS and update the timestamp in the KV store if the timestamp we've received
@@ -437,7 +457,7 @@ func (c *HATracker) checkKVStore(ctx context.Context, key, replica string, now t
 
 			// We shouldn't failover to accepting a new replica if the timestamp we've received this sample at
 			// is less than failover timeout amount of time since the timestamp in the KV store.
-			if desc.Replica != replica && now.Sub(timestamp.Time(desc.ReceivedAt)) < c.cfg.FailoverTimeout {
+			if desc.Replica != replica && now.Sub(timestamp.Time(desc.ReceivedAt)) < failoverTimeout {
 				return nil, false, ReplicasNotMatchError{replica: replica, elected: desc.Replica}
 			}
 		}
@@ -198,6 +198,42 @@ func TestCheckReplicaOverwriteTimeout(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCheckReplicaPerUserFailoverTimeout(t *testing.T) {
+	t.Parallel()
+	replica1 := "replica1"
+	replica2 := "replica2"
+
+	c, err := NewHATracker(HATrackerConfig{
+		EnableHATracker:        true,
+		KVStore:                kv.Config{Store: "inmemory"},
+		UpdateTimeout:          100 * time.Millisecond,
+		UpdateTimeoutJitterMax: 0,
+		FailoverTimeout:        time.Second,
+	}, trackerLimits{maxReplicaGroups: 100, failoverTimeouts: map[string]time.Duration{
+		"userFailoverTimeoutLong":  5 * time.Second,
+		"userFailoverTimeoutShort": time.Millisecond,
+	}}, haTrackerStatusConfig, nil, "test-ha-tracker", log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	defer services.StopAndAwaitTerminated(context.Background(), c) //nolint:errcheck
+
+	now := time.Now()
+	for _, userID := range []string{"userFailoverTimeout", "userFailoverTimeoutLong", "userFailoverTimeoutShort"} {
+		require.NoError(t, c.CheckReplica(context.Background(), userID, "test", replica1, now))
+	}
+
+	// After the configured failover timeout, only the user with a longer one doesn't failover.
+	// The failover timeout shorter than the min one is raised to it.
+	later := now.Add(1100 * time.Millisecond)
+	assert.NoError(t, c.CheckReplica(context.Background(), "userFailoverTimeout", "test", replica2, later))
+	assert.NoError(t, c.CheckReplica(context.Background(), "userFailoverTimeoutShort", "test", replica2, later))
+	assert.ErrorIs(t, c.CheckReplica(context.Background(), "userFailoverTimeoutLong", "test", replica2, later), ReplicasNotMatchError{})
+
+	// The user with a longer failover timeout fails over after it.
+	later = now.Add(5100 * time.Millisecond)
+	assert.NoError(t, c.CheckReplica(context.Background(), "userFailoverTimeoutLong", "test", replica2, later))
+}
+
 func TestCheckReplicaMultiCluster(t *testing.T) {
 	t.Parallel()
 	replica1 := "replica1"
@@ -613,12 +649,17 @@ func TestReplicasNotMatchError(t *testing.T) {
 
 type trackerLimits struct {
 	maxReplicaGroups int
+	failoverTimeouts map[string]time.Duration
 }
 
 func (l trackerLimits) MaxHAReplicaGroups(_ string) int {
 	return l.maxReplicaGroups
 }
 
+func (l trackerLimits) HAFailoverTimeout(user string) time.Duration {
+	return l.failoverTimeouts[user]
+}
+
 func TestHATracker_MetricsCleanup(t *testing.T) {
 	t.Parallel()
 	reg := prometheus.NewPedanticRegistry()
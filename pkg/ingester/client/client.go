@@ -85,16 +85,21 @@ func (c *closableHealthAndIngesterClient) handlePushRequest(mainFunc func() (*co
 
 // MakeIngesterClient makes a new IngesterClient
 func MakeIngesterClient(addr string, cfg Config) (HealthAndIngesterClient, error) {
-	dialOpts, err := cfg.GRPCClientConfig.DialOption(grpcclient.Instrument(ingesterClientRequestDuration))
+	unaryInterceptors, streamInterceptors := grpcclient.Instrument(ingesterClientRequestDuration)
+	dialOpts, err := cfg.GRPCClientConfig.DialOptionForTarget(addr, unaryInterceptors, streamInterceptors)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := grpc.Dial(addr, dialOpts...)
+	conn, err := grpcclient.DialPool(addr, cfg.ConnectionPoolSize, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
+	var ingesterClient IngesterClient = pooledIngesterClient{pool: conn}
+	if conn.Size() == 1 {
+		ingesterClient = NewIngesterClient(conn.Conn())
+	}
 	return &closableHealthAndIngesterClient{
-		IngesterClient:          NewIngesterClient(conn),
+		IngesterClient:          ingesterClient,
 		HealthClient:            grpc_health_v1.NewHealthClient(conn),
 		conn:                    conn,
 		addr:                    addr,
@@ -103,6 +108,63 @@ func MakeIngesterClient(addr string, cfg Config) (HealthAndIngesterClient, error
 	}, nil
 }
 
+// pooledIngesterClient is an IngesterClient sending each RPC over the next connection of the pool.
+type pooledIngesterClient struct {
+	pool *grpcclient.ConnPool
+}
+
+func (c pooledIngesterClient) next() IngesterClient {
+	return NewIngesterClient(c.pool.Conn())
+}
+
+func (c pooledIngesterClient) Push(ctx context.Context, in *cortexpb.WriteRequest, opts ...grpc.CallOption) (*cortexpb.WriteResponse, error) {
+	return c.next().Push(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) QueryStream(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (Ingester_QueryStreamClient, error) {
+	return c.next().QueryStream(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) QueryExemplars(ctx context.Context, in *ExemplarQueryRequest, opts ...grpc.CallOption) (*ExemplarQueryResponse, error) {
+	return c.next().QueryExemplars(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) LabelValues(ctx context.Context, in *LabelValuesRequest, opts ...grpc.CallOption) (*LabelValuesResponse, error) {
+	return c.next().LabelValues(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) LabelValuesStream(ctx context.Context, in *LabelValuesRequest, opts ...grpc.CallOption) (Ingester_LabelValuesStreamClient, error) {
+	return c.next().LabelValuesStream(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) LabelNames(ctx context.Context, in *LabelNamesRequest, opts ...grpc.CallOption) (*LabelNamesResponse, error) {
+	return c.next().LabelNames(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) LabelNamesStream(ctx context.Context, in *LabelNamesRequest, opts ...grpc.CallOption) (Ingester_LabelNamesStreamClient, error) {
+	return c.next().LabelNamesStream(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) UserStats(ctx context.Context, in *UserStatsRequest, opts ...grpc.CallOption) (*UserStatsResponse, error) {
+	return c.next().UserStats(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) AllUserStats(ctx context.Context, in *UserStatsRequest, opts ...grpc.CallOption) (*UsersStatsResponse, error) {
+	return c.next().AllUserStats(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) MetricsForLabelMatchers(ctx context.Context, in *MetricsForLabelMatchersRequest, opts ...grpc.CallOption) (*MetricsForLabelMatchersResponse, error) {
+	return c.next().MetricsForLabelMatchers(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) MetricsForLabelMatchersStream(ctx context.Context, in *MetricsForLabelMatchersRequest, opts ...grpc.CallOption) (Ingester_MetricsForLabelMatchersStreamClient, error) {
+	return c.next().MetricsForLabelMatchersStream(ctx, in, opts...)
+}
+
+func (c pooledIngesterClient) MetricsMetadata(ctx context.Context, in *MetricsMetadataRequest, opts ...grpc.CallOption) (*MetricsMetadataResponse, error) {
+	return c.next().MetricsMetadata(ctx, in, opts...)
+}
+
 func (c *closableHealthAndIngesterClient) Close() error {
 	c.inflightPushRequests.DeleteLabelValues(c.addr)
 	return c.conn.Close()
@@ -112,14 +174,19 @@ func (c *closableHealthAndIngesterClient) Close() error {
 type Config struct {
 	GRPCClientConfig        grpcclient.Config `yaml:"grpc_client_config"`
 	MaxInflightPushRequests int64             `yaml:"max_inflight_push_requests"`
+	ConnectionPoolSize      int               `yaml:"connection_pool_size"`
 }
 
 // RegisterFlags registers configuration settings used by the ingester client config.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("ingester.client", f)
 	f.Int64Var(&cfg.MaxInflightPushRequests, "ingester.client.max-inflight-push-requests", 0, "Max inflight push requests that this ingester client can handle. This limit is per-ingester-client. Additional requests will be rejected. 0 = unlimited.")
+	f.IntVar(&cfg.ConnectionPoolSize, "ingester.client.connection-pool-size", 1, "[Experimental] Number of gRPC connections to each ingester, the requests being sent over them in round-robin. Multiple connections avoid hitting the max concurrent streams and the TCP throughput limits of a single connection when pushing to large ingesters.")
 }
 
 func (cfg *Config) Validate(log log.Logger) error {
+	if cfg.ConnectionPoolSize < 1 {
+		return errors.Errorf("invalid ingester client connection pool size: %d, it must be at least 1", cfg.ConnectionPoolSize)
+	}
 	return cfg.GRPCClientConfig.Validate(log)
 }
@@ -2,17 +2,26 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http/httptest"
+	"regexp"
 	"strconv"
+	"sync"
 	"testing"
 
+	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"gopkg.in/yaml.v2"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 )
 
 // TestMarshall is useful to try out various optimisation on the unmarshalling code.
@@ -131,3 +140,93 @@ func (m *mockClientConn) Invoke(_ context.Context, _ string, _ any, _ any, _ ...
 func (m *mockClientConn) Close() error {
 	return nil
 }
+
+func TestMakeIngesterClient_ShouldSpreadTheRequestsOverTheConnectionPool(t *testing.T) {
+	t.Parallel()
+
+	server := grpc.NewServer()
+	ingester := &peersIngesterServer{peers: map[string]int{}}
+	RegisterIngesterServer(server, ingester)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	cfg := Config{}
+	flagext.DefaultValues(&cfg)
+	cfg.ConnectionPoolSize = 2
+	require.NoError(t, cfg.Validate(log.NewNopLogger()))
+
+	client, err := MakeIngesterClient(listener.Addr().String(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	for i := 0; i < 2; i++ {
+		_, err = client.Push(ctx, &cortexpb.WriteRequest{})
+		require.NoError(t, err)
+		_, err = client.PushPreAlloc(ctx, &cortexpb.PreallocWriteRequest{})
+		require.NoError(t, err)
+	}
+
+	// Both the generated client and the preallocated push requests are spread over the connections.
+	ingester.mtx.Lock()
+	defer ingester.mtx.Unlock()
+	require.Len(t, ingester.peers, 2)
+	for _, calls := range ingester.peers {
+		assert.Equal(t, 2, calls)
+	}
+}
+
+func TestMakeIngesterClient_ShouldUseTheTargetTLSConfigs(t *testing.T) {
+	t.Parallel()
+
+	server := grpc.NewServer()
+	RegisterIngesterServer(server, &peersIngesterServer{peers: map[string]int{}})
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	// The global TLS config can't be used, since its CA file is missing, while the ingester
+	// is reached in plaintext through the target TLS config matching its address.
+	cfg := Config{}
+	flagext.DefaultValues(&cfg)
+	require.NoError(t, yaml.UnmarshalStrict([]byte(fmt.Sprintf(`
+grpc_client_config:
+  tls_enabled: true
+  tls_ca_path: missing-ca.crt
+  target_tls_configs:
+    - target_regex: %s
+      tls_enabled: false
+`, regexp.QuoteMeta(listener.Addr().String()))), &cfg))
+	require.NoError(t, cfg.Validate(log.NewNopLogger()))
+
+	_, err = MakeIngesterClient("other-ingester:9095", cfg)
+	require.ErrorContains(t, err, "missing-ca.crt")
+
+	client, err := MakeIngesterClient(listener.Addr().String(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	_, err = client.Push(user.InjectOrgID(context.Background(), "user-1"), &cortexpb.WriteRequest{})
+	require.NoError(t, err)
+}
+
+// peersIngesterServer records the client address of the connection of each push request.
+type peersIngesterServer struct {
+	UnimplementedIngesterServer
+
+	mtx   sync.Mutex
+	peers map[string]int
+}
+
+func (s *peersIngesterServer) Push(ctx context.Context, _ *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+	p, _ := peer.FromContext(ctx)
+	s.mtx.Lock()
+	s.peers[p.Addr.String()]++
+	s.mtx.Unlock()
+	return &cortexpb.WriteResponse{}, nil
+}
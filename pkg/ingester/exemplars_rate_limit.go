@@ -0,0 +1,26 @@
+package ingester
+
+import (
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// exemplarsRateStrategy is the strategy of the per-user exemplars ingestion rate limiter. The
+// limit is local to each ingester.
+type exemplarsRateStrategy struct {
+	limits *validation.Overrides
+}
+
+func newExemplarsRateStrategy(limits *validation.Overrides) limiter.RateLimiterStrategy {
+	return &exemplarsRateStrategy{
+		limits: limits,
+	}
+}
+
+func (s *exemplarsRateStrategy) Limit(tenantID string) float64 {
+	return s.limits.MaxExemplarsIngestionRate(tenantID)
+}
+
+func (s *exemplarsRateStrategy) Burst(tenantID string) int {
+	return s.limits.MaxExemplarsIngestionBurstSize(tenantID)
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
@@ -38,6 +39,7 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc/codes"
 
 	"github.com/cortexproject/cortex/pkg/chunk/encoding"
@@ -52,6 +54,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/concurrency"
 	"github.com/cortexproject/cortex/pkg/util/extract"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
 	logutil "github.com/cortexproject/cortex/pkg/util/log"
 	util_math "github.com/cortexproject/cortex/pkg/util/math"
 	"github.com/cortexproject/cortex/pkg/util/services"
@@ -81,17 +84,38 @@ const (
 	// Discarded Metadata metric labels.
 	perUserMetadataLimit   = "per_user_metadata_limit"
 	perMetricMetadataLimit = "per_metric_metadata_limit"
+	metricTypeConflict     = "metric_type_conflict"
 
 	// Period at which to attempt purging metadata from memory.
 	metadataPurgePeriod = 5 * time.Minute
 
 	// Period at which we should reset the max inflight query requests counter.
 	maxInflightRequestResetPeriod = 1 * time.Minute
+
+	// Period at which the heap in use is checked against the memory admission watermarks.
+	memoryAdmissionUpdatePeriod = time.Second
+
+	// Minimum interval between two logged out-of-order recently rejected samples, per user.
+	oooRecentRejectedLogInterval = 10 * time.Second
+
+	// Minimum interval between two logged queries served while replaying the WAL.
+	walReplayQueryLogInterval = 10 * time.Second
+
+	// Policies for the queries received while replaying the WAL.
+	QueriesDuringWALReplayReject  = "reject"
+	QueriesDuringWALReplayPartial = "partial"
 )
 
+// QueriesDuringWALReplayPolicies are the supported policies for the queries received while replaying the WAL.
+var QueriesDuringWALReplayPolicies = []string{QueriesDuringWALReplayReject, QueriesDuringWALReplayPartial}
+
 var (
 	errExemplarRef      = errors.New("exemplars not ingested because series not already present")
 	errIngesterStopping = errors.New("ingester stopping")
+
+	errInvalidQueriesDuringWALReplayPolicy = fmt.Errorf("unsupported policy for queries during WAL replay, supported values are: %s", strings.Join(QueriesDuringWALReplayPolicies, ", "))
+
+	errFlushIngesterNotRunning = errors.New("flush not performed: ingester not running")
 )
 
 // Config for an Ingester.
@@ -132,6 +156,8 @@ type Config struct {
 
 	// For admin contact details
 	AdminLimitMessage string `yaml:"admin_limit_message"`
+
+	QueriesDuringWALReplay string `yaml:"queries_during_wal_replay"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
@@ -151,10 +177,14 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.Int64Var(&cfg.DefaultLimits.MaxInMemoryTenants, "ingester.instance-limits.max-tenants", 0, "Max users that this ingester can hold. Requests from additional users will be rejected. This limit only works when using blocks engine. 0 = unlimited.")
 	f.Int64Var(&cfg.DefaultLimits.MaxInMemorySeries, "ingester.instance-limits.max-series", 0, "Max series that this ingester can hold (across all tenants). Requests to create additional series will be rejected. This limit only works when using blocks engine. 0 = unlimited.")
 	f.Int64Var(&cfg.DefaultLimits.MaxInflightPushRequests, "ingester.instance-limits.max-inflight-push-requests", 0, "Max inflight push requests that this ingester can handle (across all tenants). Additional requests will be rejected. 0 = unlimited.")
+	f.Int64Var(&cfg.DefaultLimits.MaxInflightQueryRequests, "ingester.instance-limits.max-inflight-query-requests", 0, "[Experimental] Max QueryStream, QueryExemplars, label and series requests that this ingester can execute concurrently (across all tenants). Requests waiting for the per-tenant concurrency limit are not counted. Additional requests are shed, so that the queries cannot starve the push path. 0 = unlimited.")
+	f.Int64Var(&cfg.DefaultLimits.MemoryAdmissionHighWatermarkBytes, "ingester.instance-limits.memory-admission-high-watermark-bytes", 0, "[Experimental] Heap in use (bytes) at which the ingester starts rejecting the push requests with a retryable error. The heap in use is checked every second. 0 = disabled.")
+	f.Int64Var(&cfg.DefaultLimits.MemoryAdmissionLowWatermarkBytes, "ingester.instance-limits.memory-admission-low-watermark-bytes", 0, "[Experimental] Heap in use (bytes) below which the ingester resumes accepting the push requests, once rejecting them because of the memory admission high watermark. 0 or greater than the high watermark = same as the high watermark.")
 
 	f.StringVar(&cfg.IgnoreSeriesLimitForMetricNames, "ingester.ignore-series-limit-for-metric-names", "", "Comma-separated list of metric names, for which -ingester.max-series-per-metric and -ingester.max-global-series-per-metric limits will be ignored. Does not affect max-series-per-user or max-global-series-per-metric limits.")
 
 	f.StringVar(&cfg.AdminLimitMessage, "ingester.admin-limit-message", "please contact administrator to raise it", "Customize the message contained in limit errors")
+	f.StringVar(&cfg.QueriesDuringWALReplay, "ingester.queries-during-wal-replay", QueriesDuringWALReplayReject, fmt.Sprintf("[Experimental] How to handle the queries received while the ingester replays the WAL on startup. Supported values are: %s. 'reject' fails the queries, so that the queriers rely on the other ingesters. 'partial' serves the queries with the data of the tenants whose WAL has already been replayed, and logs a warning.", strings.Join(QueriesDuringWALReplayPolicies, ", ")))
 
 }
 
@@ -163,6 +193,10 @@ func (cfg *Config) Validate() error {
 		return err
 	}
 
+	if !util.StringsContain(QueriesDuringWALReplayPolicies, cfg.QueriesDuringWALReplay) {
+		return errInvalidQueriesDuringWALReplayPolicy
+	}
+
 	return nil
 }
 
@@ -204,6 +238,9 @@ type Ingester struct {
 	limiter            *Limiter
 	subservicesWatcher *services.FailureWatcher
 
+	// Per-user exemplars ingestion rate limiter.
+	exemplarsRateLimiter *limiter.RateLimiter
+
 	stoppedMtx sync.RWMutex // protects stopped
 	stopped    bool         // protected by stoppedMtx
 
@@ -218,8 +255,21 @@ type Ingester struct {
 	ingestionRate        *util_math.EwmaRate
 	inflightPushRequests atomic.Int64
 
+	// Rejects the push requests while the heap in use is high.
+	memoryAdmissionGate *memoryAdmissionGate
+
 	inflightQueryRequests    atomic.Int64
 	maxInflightQueryRequests util_math.MaxTracker
+
+	// Number of queries currently executing under the query concurrency limits.
+	executingQueryRequests atomic.Int64
+
+	// Limits the number of concurrent queries of each user.
+	queryConcurrencyLimiter *limiter.ConcurrencyLimiter
+
+	// Whether the WAL is being replayed on startup.
+	walReplaying             atomic.Bool
+	walReplayQueryLogLimiter *rate.Limiter
 }
 
 // Shipper interface is used to have an easy way to mock it in tests.
@@ -246,6 +296,7 @@ const (
 	tsdbNotIdle                 tsdbCloseCheckResult = "not_idle"
 	tsdbNotCompacted            tsdbCloseCheckResult = "not_compacted"
 	tsdbNotShipped              tsdbCloseCheckResult = "not_shipped"
+	tsdbRecentlyShipped         tsdbCloseCheckResult = "recently_shipped"
 	tsdbCheckFailed             tsdbCloseCheckResult = "check_failed"
 	tsdbCloseFailed             tsdbCloseCheckResult = "close_failed"
 	tsdbNotActive               tsdbCloseCheckResult = "not_active"
@@ -273,6 +324,10 @@ type userTSDB struct {
 	state          tsdbState
 	pushesInFlight sync.WaitGroup // Increased with stateMtx read lock held, only if state == active or activeShipping.
 
+	// Held for reading by the pushes, and for writing while a head snapshot starts, so that the
+	// snapshot doesn't miss the samples appended to the WAL before its WAL position.
+	snapshotMtx sync.RWMutex
+
 	// Used to detect idle TSDBs.
 	lastUpdate atomic.Int64
 
@@ -291,9 +346,15 @@ type userTSDB struct {
 	ingestedAPISamples  *util_math.EwmaRate
 	ingestedRuleSamples *util_math.EwmaRate
 
-	// Cached shipped blocks.
+	// Cached shipped blocks, with the time each block has been first seen shipped.
 	shippedBlocksMtx sync.Mutex
-	shippedBlocks    map[ulid.ULID]struct{}
+	shippedBlocks    map[ulid.ULID]time.Time
+
+	// Minimum time the blocks are kept after they've been shipped. May be nil.
+	flushedBlocksRetention func() time.Duration
+
+	// Used to rate limit the logging of out-of-order recently rejected samples.
+	oooRecentRejectedLogLimiter *rate.Limiter
 }
 
 // Explicitly wrapping the tsdb.DB functions that we use.
@@ -451,16 +512,49 @@ func (u *userTSDB) blocksToDelete(blocks []*tsdb.Block) map[ulid.ULID]struct{} {
 	}
 
 	shippedBlocks := u.getCachedShippedBlocks()
+	retention := u.getFlushedBlocksRetention()
+	now := time.Now()
 
 	result := map[ulid.ULID]struct{}{}
-	for shippedID := range shippedBlocks {
-		if _, ok := deletable[shippedID]; ok {
-			result[shippedID] = struct{}{}
+	for shippedID, shippedAt := range shippedBlocks {
+		if _, ok := deletable[shippedID]; !ok {
+			continue
 		}
+		// Keep the recently shipped blocks until the store-gateways can serve them.
+		if now.Sub(shippedAt) < retention {
+			continue
+		}
+		result[shippedID] = struct{}{}
 	}
 	return result
 }
 
+func (u *userTSDB) getFlushedBlocksRetention() time.Duration {
+	if u.flushedBlocksRetention == nil {
+		return 0
+	}
+	return u.flushedBlocksRetention()
+}
+
+// getRetainedFlushedBlocksBytes returns the size of the blocks shipped within the flushed blocks
+// retention, and whether there are any.
+func (u *userTSDB) getRetainedFlushedBlocksBytes(now time.Time) (int64, bool) {
+	retention := u.getFlushedBlocksRetention()
+	if retention <= 0 {
+		return 0, false
+	}
+
+	shippedBlocks := u.getCachedShippedBlocks()
+	size, found := int64(0), false
+	for _, b := range u.Blocks() {
+		if shippedAt, ok := shippedBlocks[b.Meta().ULID]; ok && now.Sub(shippedAt) < retention {
+			size += b.Size()
+			found = true
+		}
+	}
+	return size, found
+}
+
 // updateCachedShippedBlocks reads the shipper meta file and updates the cached shipped blocks.
 func (u *userTSDB) updateCachedShippedBlocks() error {
 	shipperMeta, err := shipper.ReadMetaFile(u.shipperMetadataFilePath)
@@ -471,10 +565,17 @@ func (u *userTSDB) updateCachedShippedBlocks() error {
 		return err
 	}
 
-	// Build a map.
-	shippedBlocks := make(map[ulid.ULID]struct{}, len(shipperMeta.Uploaded))
+	// Build a map, keeping the time the blocks already cached have been first seen shipped.
+	previous := u.getCachedShippedBlocks()
+	now := time.Now()
+
+	shippedBlocks := make(map[ulid.ULID]time.Time, len(shipperMeta.Uploaded))
 	for _, blockID := range shipperMeta.Uploaded {
-		shippedBlocks[blockID] = struct{}{}
+		if shippedAt, ok := previous[blockID]; ok {
+			shippedBlocks[blockID] = shippedAt
+		} else {
+			shippedBlocks[blockID] = now
+		}
 	}
 
 	// Cache it.
@@ -486,7 +587,7 @@ func (u *userTSDB) updateCachedShippedBlocks() error {
 }
 
 // getCachedShippedBlocks returns the cached shipped blocks.
-func (u *userTSDB) getCachedShippedBlocks() map[ulid.ULID]struct{} {
+func (u *userTSDB) getCachedShippedBlocks() map[ulid.ULID]time.Time {
 	u.shippedBlocksMtx.Lock()
 	defer u.shippedBlocksMtx.Unlock()
 
@@ -543,6 +644,11 @@ func (u *userTSDB) shouldCloseTSDB(idleTimeout time.Duration) tsdbCloseCheckResu
 		return tsdbNotShipped
 	}
 
+	// Keep the recently shipped blocks until the store-gateways can serve them.
+	if _, found := u.getRetainedFlushedBlocksBytes(time.Now()); found {
+		return tsdbRecentlyShipped
+	}
+
 	return tsdbIdle
 }
 
@@ -570,6 +676,8 @@ type TSDBState struct {
 	// Head compactions metrics.
 	compactionsTriggered   prometheus.Counter
 	compactionsFailed      prometheus.Counter
+	memorySnapshots        prometheus.Counter
+	memorySnapshotsFailed  prometheus.Counter
 	walReplayTime          prometheus.Histogram
 	appenderAddDuration    prometheus.Histogram
 	appenderCommitDuration prometheus.Histogram
@@ -578,7 +686,7 @@ type TSDBState struct {
 
 type requestWithUsersAndCallback struct {
 	users    *util.AllowedTenants // if nil, all tenants are allowed.
-	callback chan<- struct{}      // when compaction/shipping is finished, this channel is closed
+	callback chan<- error         // when compaction/shipping is finished, its result is sent to this channel
 }
 
 func newTSDBState(bucketClient objstore.Bucket, registerer prometheus.Registerer) TSDBState {
@@ -591,6 +699,7 @@ func newTSDBState(bucketClient objstore.Bucket, registerer prometheus.Registerer
 	idleTsdbChecks.WithLabelValues(string(tsdbNotIdle))
 	idleTsdbChecks.WithLabelValues(string(tsdbNotCompacted))
 	idleTsdbChecks.WithLabelValues(string(tsdbNotShipped))
+	idleTsdbChecks.WithLabelValues(string(tsdbRecentlyShipped))
 	idleTsdbChecks.WithLabelValues(string(tsdbCheckFailed))
 	idleTsdbChecks.WithLabelValues(string(tsdbCloseFailed))
 	idleTsdbChecks.WithLabelValues(string(tsdbNotActive))
@@ -614,6 +723,14 @@ func newTSDBState(bucketClient objstore.Bucket, registerer prometheus.Registerer
 			Name: "cortex_ingester_tsdb_compactions_failed_total",
 			Help: "Total number of compactions that failed.",
 		}),
+		memorySnapshots: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_tsdb_memory_snapshots_total",
+			Help: "Total number of periodic snapshots of the in-memory TSDB data.",
+		}),
+		memorySnapshotsFailed: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_tsdb_memory_snapshots_failed_total",
+			Help: "Total number of periodic snapshots of the in-memory TSDB data that failed.",
+		}),
 		walReplayTime: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
 			Name:    "cortex_ingester_tsdb_wal_replay_duration_seconds",
 			Help:    "The total time it takes to open and replay a TSDB WAL.",
@@ -653,6 +770,10 @@ func New(cfg Config, limits *validation.Overrides, registerer prometheus.Registe
 		TSDBState:     newTSDBState(bucketClient, registerer),
 		logger:        logger,
 		ingestionRate: util_math.NewEWMARate(0.2, instanceIngestionRateTickInterval),
+
+		walReplayQueryLogLimiter: rate.NewLimiter(rate.Every(walReplayQueryLogInterval), 1),
+		exemplarsRateLimiter:     limiter.NewRateLimiter(newExemplarsRateStrategy(limits), 10*time.Second),
+		queryConcurrencyLimiter:  limiter.NewConcurrencyLimiter(),
 	}
 	i.metrics = newIngesterMetrics(registerer,
 		false,
@@ -662,6 +783,7 @@ func New(cfg Config, limits *validation.Overrides, registerer prometheus.Registe
 		&i.inflightPushRequests,
 		&i.maxInflightQueryRequests)
 	i.validateMetrics = validation.NewValidateMetrics(registerer)
+	i.memoryAdmissionGate = newMemoryAdmissionGate(i.getInstanceLimits, logger, registerer)
 
 	// Replace specific metrics which we can't directly track but we need to read
 	// them from the underlying system (ie. TSDB).
@@ -773,7 +895,10 @@ func (i *Ingester) starting(ctx context.Context) error {
 		return errors.Wrap(err, "failed to start lifecycler")
 	}
 
-	if err := i.openExistingTSDB(ctx); err != nil {
+	i.walReplaying.Store(true)
+	err := i.openExistingTSDB(ctx)
+	i.walReplaying.Store(false)
+	if err != nil {
 		// Try to rollback and close opened TSDBs before halting the ingester.
 		i.closeAllTSDB()
 
@@ -793,6 +918,11 @@ func (i *Ingester) starting(ctx context.Context) error {
 		servs = append(servs, shippingService)
 	}
 
+	if interval := i.cfg.BlocksStorageConfig.TSDB.MemorySnapshotInterval; interval > 0 {
+		snapshotService := services.NewTimerService(util.DurationWithJitter(interval, 0.1), nil, i.snapshotHeads, nil)
+		servs = append(servs, snapshotService)
+	}
+
 	if i.cfg.BlocksStorageConfig.TSDB.CloseIdleTSDBTimeout > 0 {
 		interval := i.cfg.BlocksStorageConfig.TSDB.CloseIdleTSDBInterval
 		if interval == 0 {
@@ -802,7 +932,6 @@ func (i *Ingester) starting(ctx context.Context) error {
 		servs = append(servs, closeIdleService)
 	}
 
-	var err error
 	i.TSDBState.subservices, err = services.NewManager(servs...)
 	if err == nil {
 		err = services.StartManagerAndAwaitHealthy(ctx, i.TSDBState.subservices)
@@ -868,6 +997,9 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 	maxInflightRequestResetTicker := time.NewTicker(maxInflightRequestResetPeriod)
 	defer maxInflightRequestResetTicker.Stop()
 
+	memoryAdmissionTicker := time.NewTicker(memoryAdmissionUpdatePeriod)
+	defer memoryAdmissionTicker.Stop()
+
 	for {
 		select {
 		case <-metadataPurgeTicker.C:
@@ -886,6 +1018,8 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 			i.updateActiveSeries(ctx)
 		case <-maxInflightRequestResetTicker.C:
 			i.maxInflightQueryRequests.Tick()
+		case <-memoryAdmissionTicker.C:
+			i.memoryAdmissionGate.update()
 		case <-userTSDBConfigTicker.C:
 			i.updateUserTSDBConfigs()
 		case <-ctx.Done():
@@ -922,6 +1056,15 @@ func (i *Ingester) updateUserTSDBConfigs() {
 	}
 }
 
+// allowExemplars returns whether the user's exemplars ingestion rate limit, if any, allows
+// ingesting n exemplars.
+func (i *Ingester) allowExemplars(userID string, n int) bool {
+	if i.exemplarsRateLimiter == nil || i.limits.MaxExemplarsIngestionRate(userID) <= 0 {
+		return true
+	}
+	return i.exemplarsRateLimiter.AllowN(time.Now(), userID, n)
+}
+
 // getMaxExemplars returns the maxExemplars value set in limits config.
 // If limits value is set to zero, it falls back to old configuration
 // in block storage config.
@@ -993,6 +1136,27 @@ func (i *Ingester) checkRunning() error {
 	return status.Error(codes.Unavailable, s.String())
 }
 
+// checkQueryable checks whether the ingester can serve queries. While the WAL is replayed on
+// startup, queries are either rejected or served with the data replayed so far, depending on
+// the configured policy.
+func (i *Ingester) checkQueryable() error {
+	err := i.checkRunning()
+	if err == nil || !i.walReplaying.Load() {
+		return err
+	}
+
+	if i.cfg.QueriesDuringWALReplay != QueriesDuringWALReplayPartial {
+		i.metrics.queriesDuringWALReplay.WithLabelValues(QueriesDuringWALReplayReject).Inc()
+		return status.Error(codes.Unavailable, "ingester is replaying the WAL")
+	}
+
+	i.metrics.queriesDuringWALReplay.WithLabelValues(QueriesDuringWALReplayPartial).Inc()
+	if i.walReplayQueryLogLimiter.Allow() {
+		level.Warn(i.logger).Log("msg", "serving query while replaying the WAL, the query results may be partial")
+	}
+	return nil
+}
+
 // GetRef() is an extra method added to TSDB to let Cortex check before calling Add()
 type extendedAppender interface {
 	storage.Appender
@@ -1019,6 +1183,10 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 		}
 	}
 
+	if err := i.memoryAdmissionGate.admit(); err != nil {
+		return nil, err
+	}
+
 	var firstPartialErr error
 
 	// NOTE: because we use `unsafe` in deserialisation, we must not
@@ -1070,11 +1238,14 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 		sampleOutOfBoundsCount      = 0
 		sampleOutOfOrderCount       = 0
 		sampleTooOldCount           = 0
+		oooRecentRejectedCount      = 0
 		newValueForTimestampCount   = 0
 		perUserSeriesLimitCount     = 0
 		perLabelSetSeriesLimitCount = 0
 		perMetricSeriesLimitCount   = 0
 		nativeHistogramCount        = 0
+		invalidNativeHistogramCount = 0
+		exemplarsRateLimitedCount   = 0
 
 		updateFirstPartial = func(errFn func() error) {
 			if firstPartialErr == nil {
@@ -1083,6 +1254,81 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 		}
 	)
 
+	// Samples rejected for being too old, but older than the out-of-order time window by less than
+	// the recent rejected window, are tracked separately to help diagnosing clock skew.
+	oooTimeWindow := time.Duration(i.limits.OutOfOrderTimeWindow(userID)).Milliseconds()
+	oooRecentRejectedWindow := time.Duration(i.limits.OutOfOrderRecentRejectedWindow(userID)).Milliseconds()
+
+	// handleAppendFailure tracks the soft errors the push can proceed on, returning false for the
+	// other errors.
+	handleAppendFailure := func(err error, timestampMs int64, lbls []cortexpb.LabelAdapter, tsLabels, copiedLabels labels.Labels) bool {
+		// Check if the error is a soft error we can proceed on. If so, we keep track
+		// of it, so that we can return it back to the distributor, which will return a
+		// 400 error to the client. The client (Prometheus) will not retry on 400, and
+		// we actually ingested all samples which haven't failed.
+		switch cause := errors.Cause(err); {
+		case errors.Is(cause, storage.ErrOutOfBounds):
+			sampleOutOfBoundsCount++
+			updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(timestampMs), lbls) })
+			return true
+
+		case errors.Is(cause, storage.ErrOutOfOrderSample):
+			sampleOutOfOrderCount++
+			updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(timestampMs), lbls) })
+			return true
+
+		case errors.Is(cause, storage.ErrDuplicateSampleForTimestamp):
+			newValueForTimestampCount++
+			updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(timestampMs), lbls) })
+			return true
+
+		case errors.Is(cause, storage.ErrTooOldSample):
+			sampleTooOldCount++
+			if oooRecentRejectedWindow > 0 {
+				headMaxTime := db.db.Head().MaxTime()
+				if timestampMs >= headMaxTime-oooTimeWindow-oooRecentRejectedWindow {
+					oooRecentRejectedCount++
+					if db.oooRecentRejectedLogLimiter.Allow() {
+						level.Warn(logutil.WithContext(ctx, i.logger)).Log("msg", "sample rejected for being older than the out-of-order time window by less than the recent rejected window, this may be caused by clock skew",
+							"user", userID, "series", tsLabels.String(), "timestamp", model.Time(timestampMs).Time(), "head_max_time", model.Time(headMaxTime).Time(), "out_of_order_time_window", time.Duration(oooTimeWindow)*time.Millisecond)
+					}
+				}
+			}
+			updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(timestampMs), lbls) })
+			return true
+
+		case errors.Is(cause, errMaxSeriesPerUserLimitExceeded):
+			perUserSeriesLimitCount++
+			updateFirstPartial(func() error { return makeLimitError(perUserSeriesLimit, i.limiter.FormatError(userID, cause)) })
+			return true
+
+		case errors.Is(cause, errMaxSeriesPerMetricLimitExceeded):
+			perMetricSeriesLimitCount++
+			updateFirstPartial(func() error {
+				return makeMetricLimitError(perMetricSeriesLimit, copiedLabels, i.limiter.FormatError(userID, cause))
+			})
+			return true
+		case errors.As(cause, &errMaxSeriesPerLabelSetLimitExceeded{}):
+			perLabelSetSeriesLimitCount++
+			updateFirstPartial(func() error {
+				return makeMetricLimitError(perLabelsetSeriesLimit, copiedLabels, i.limiter.FormatError(userID, cause))
+			})
+			return true
+		case errors.Is(cause, histogram.ErrHistogramCountMismatch),
+			errors.Is(cause, histogram.ErrHistogramCountNotBigEnough),
+			errors.Is(cause, histogram.ErrHistogramNegativeBucketCount),
+			errors.Is(cause, histogram.ErrHistogramSpanNegativeOffset),
+			errors.Is(cause, histogram.ErrHistogramSpansBucketsMismatch):
+			invalidNativeHistogramCount++
+			updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(timestampMs), lbls) })
+			return true
+		}
+		return false
+	}
+
+	// The native histograms are discarded unless enabled for the user.
+	enableNativeHistograms := i.limits.EnableNativeHistograms(userID)
+
 	// Walk the samples, appending them to the users database
 	app := db.Appender(ctx).(extendedAppender)
 	for _, ts := range req.Timeseries {
@@ -1097,8 +1343,6 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 		// To find out if any sample was added to this series, we keep old value.
 		oldSucceededSamplesCount := succeededSamplesCount
 
-		nativeHistogramCount += len(ts.Histograms)
-
 		for _, s := range ts.Samples {
 			var err error
 
@@ -1121,48 +1365,7 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 			}
 
 			failedSamplesCount++
-
-			// Check if the error is a soft error we can proceed on. If so, we keep track
-			// of it, so that we can return it back to the distributor, which will return a
-			// 400 error to the client. The client (Prometheus) will not retry on 400, and
-			// we actually ingested all samples which haven't failed.
-			switch cause := errors.Cause(err); {
-			case errors.Is(cause, storage.ErrOutOfBounds):
-				sampleOutOfBoundsCount++
-				updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(s.TimestampMs), ts.Labels) })
-				continue
-
-			case errors.Is(cause, storage.ErrOutOfOrderSample):
-				sampleOutOfOrderCount++
-				updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(s.TimestampMs), ts.Labels) })
-				continue
-
-			case errors.Is(cause, storage.ErrDuplicateSampleForTimestamp):
-				newValueForTimestampCount++
-				updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(s.TimestampMs), ts.Labels) })
-				continue
-
-			case errors.Is(cause, storage.ErrTooOldSample):
-				sampleTooOldCount++
-				updateFirstPartial(func() error { return wrappedTSDBIngestErr(err, model.Time(s.TimestampMs), ts.Labels) })
-				continue
-
-			case errors.Is(cause, errMaxSeriesPerUserLimitExceeded):
-				perUserSeriesLimitCount++
-				updateFirstPartial(func() error { return makeLimitError(perUserSeriesLimit, i.limiter.FormatError(userID, cause)) })
-				continue
-
-			case errors.Is(cause, errMaxSeriesPerMetricLimitExceeded):
-				perMetricSeriesLimitCount++
-				updateFirstPartial(func() error {
-					return makeMetricLimitError(perMetricSeriesLimit, copiedLabels, i.limiter.FormatError(userID, cause))
-				})
-				continue
-			case errors.As(cause, &errMaxSeriesPerLabelSetLimitExceeded{}):
-				perLabelSetSeriesLimitCount++
-				updateFirstPartial(func() error {
-					return makeMetricLimitError(perLabelsetSeriesLimit, copiedLabels, i.limiter.FormatError(userID, cause))
-				})
+			if handleAppendFailure(err, s.TimestampMs, ts.Labels, tsLabels, copiedLabels) {
 				continue
 			}
 
@@ -1174,6 +1377,52 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 			return nil, wrapWithUser(err, userID)
 		}
 
+		if !enableNativeHistograms {
+			nativeHistogramCount += len(ts.Histograms)
+		} else {
+			for _, hp := range ts.Histograms {
+				var (
+					err error
+					h   *histogram.Histogram
+					fh  *histogram.FloatHistogram
+				)
+				if hp.IsFloatHistogram() {
+					fh = cortexpb.FloatHistogramProtoToFloatHistogram(hp)
+				} else {
+					h = cortexpb.HistogramProtoToHistogram(hp)
+				}
+
+				// If the cached reference exists, we try to use it.
+				if ref != 0 {
+					if _, err = app.AppendHistogram(ref, copiedLabels, hp.TimestampMs, h, fh); err == nil {
+						succeededSamplesCount++
+						continue
+					}
+				} else {
+					// Copy the label set because both TSDB and the active series tracker may retain it.
+					copiedLabels = cortexpb.FromLabelAdaptersToLabelsWithCopy(ts.Labels)
+
+					// Retain the reference in case there are multiple histograms for the series.
+					if ref, err = app.AppendHistogram(0, copiedLabels, hp.TimestampMs, h, fh); err == nil {
+						succeededSamplesCount++
+						continue
+					}
+				}
+
+				failedSamplesCount++
+				if handleAppendFailure(err, hp.TimestampMs, ts.Labels, tsLabels, copiedLabels) {
+					continue
+				}
+
+				// The error looks an issue on our side, so we should rollback
+				if rollbackErr := app.Rollback(); rollbackErr != nil {
+					level.Warn(logutil.WithContext(ctx, i.logger)).Log("msg", "failed to rollback on error", "user", userID, "err", rollbackErr)
+				}
+
+				return nil, wrapWithUser(err, userID)
+			}
+		}
+
 		if i.cfg.ActiveSeriesMetricsEnabled && succeededSamplesCount > oldSucceededSamplesCount {
 			db.activeSeries.UpdateSeries(tsLabels, tsLabelsHash, startAppend, func(l labels.Labels) labels.Labels {
 				// we must already have copied the labels if succeededSamplesCount has been incremented.
@@ -1191,6 +1440,10 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 						model.Time(ts.Exemplars[0].TimestampMs), ts.Labels, ts.Exemplars[0].Labels)
 				})
 				failedExemplarsCount += len(ts.Exemplars)
+			} else if len(ts.Exemplars) > 0 && !i.allowExemplars(userID, len(ts.Exemplars)) {
+				// The exemplars exceeding the rate limit are dropped, while the samples are kept.
+				exemplarsRateLimitedCount += len(ts.Exemplars)
+				failedExemplarsCount += len(ts.Exemplars)
 			} else { // Note that else is explicit, rather than a continue in the above if, in case of additional logic post exemplar processing.
 				for _, ex := range ts.Exemplars {
 					e := exemplar.Exemplar{
@@ -1246,6 +1499,9 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 	if sampleTooOldCount > 0 {
 		i.validateMetrics.DiscardedSamples.WithLabelValues(sampleTooOld, userID).Add(float64(sampleTooOldCount))
 	}
+	if oooRecentRejectedCount > 0 {
+		i.metrics.oooRecentRejectedSamples.WithLabelValues(userID).Add(float64(oooRecentRejectedCount))
+	}
 	if newValueForTimestampCount > 0 {
 		i.validateMetrics.DiscardedSamples.WithLabelValues(newValueForTimestamp, userID).Add(float64(newValueForTimestampCount))
 	}
@@ -1262,6 +1518,12 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 	if nativeHistogramCount > 0 {
 		i.validateMetrics.DiscardedSamples.WithLabelValues(nativeHistogramSample, userID).Add(float64(nativeHistogramCount))
 	}
+	if invalidNativeHistogramCount > 0 {
+		i.validateMetrics.DiscardedSamples.WithLabelValues(invalidNativeHistogram, userID).Add(float64(invalidNativeHistogramCount))
+	}
+	if exemplarsRateLimitedCount > 0 {
+		i.validateMetrics.DiscardedExemplars.WithLabelValues(perUserExemplarsRateLimit, userID).Add(float64(exemplarsRateLimitedCount))
+	}
 
 	// Distributor counts both samples and metadata, so for consistency ingester does the same.
 	i.ingestionRate.Add(int64(succeededSamplesCount + ingestedMetadata))
@@ -1289,19 +1551,27 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 }
 
 func (u *userTSDB) acquireAppendLock() error {
+	// Wait for the in-progress head snapshot, if any.
+	u.snapshotMtx.RLock()
+
 	u.stateMtx.RLock()
 	defer u.stateMtx.RUnlock()
 
+	var err error
 	switch u.state {
 	case active:
 	case activeShipping:
 		// Pushes are allowed.
 	case forceCompacting:
-		return errors.New("forced compaction in progress")
+		err = errors.New("forced compaction in progress")
 	case closing:
-		return errors.New("TSDB is closing")
+		err = errors.New("TSDB is closing")
 	default:
-		return errors.New("TSDB is not active")
+		err = errors.New("TSDB is not active")
+	}
+	if err != nil {
+		u.snapshotMtx.RUnlock()
+		return err
 	}
 
 	u.pushesInFlight.Add(1)
@@ -1310,11 +1580,34 @@ func (u *userTSDB) acquireAppendLock() error {
 
 func (u *userTSDB) releaseAppendLock() {
 	u.pushesInFlight.Done()
+	u.snapshotMtx.RUnlock()
+}
+
+// snapshotHead snapshots the in-memory data of the head on disk. The pushes are blocked for the
+// whole snapshot: the in-flight pushes are waited for, so that the WAL position covered by the
+// snapshot matches the in-memory data, and the following pushes are replayed from the WAL.
+func (u *userTSDB) snapshotHead() error {
+	u.snapshotMtx.Lock()
+	defer u.snapshotMtx.Unlock()
+
+	// Count the snapshot as an in-flight push, so that the TSDB isn't closed or force compacted
+	// in the meantime, without holding the state lock for the whole snapshot.
+	u.stateMtx.RLock()
+	if u.state != active && u.state != activeShipping {
+		u.stateMtx.RUnlock()
+		return nil
+	}
+	u.pushesInFlight.Add(1)
+	u.stateMtx.RUnlock()
+	defer u.pushesInFlight.Done()
+
+	_, err := u.db.Head().ChunkSnapshot()
+	return err
 }
 
 // QueryExemplars implements service.IngesterServer
 func (i *Ingester) QueryExemplars(ctx context.Context, req *client.ExemplarQueryRequest) (*client.ExemplarQueryResponse, error) {
-	if err := i.checkRunning(); err != nil {
+	if err := i.checkQueryable(); err != nil {
 		return nil, err
 	}
 
@@ -1326,6 +1619,12 @@ func (i *Ingester) QueryExemplars(ctx context.Context, req *client.ExemplarQuery
 		return nil, err
 	}
 
+	release, err := i.limitQueryConcurrency(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	from, through, matchers, err := client.FromExemplarQueryRequest(req)
 	if err != nil {
 		return nil, err
@@ -1409,7 +1708,7 @@ func (i *Ingester) LabelValuesStream(req *client.LabelValuesRequest, stream clie
 // the cleanup function should be called in order to close the querier
 func (i *Ingester) labelsValuesCommon(ctx context.Context, req *client.LabelValuesRequest) (*client.LabelValuesResponse, func(), error) {
 	cleanup := func() {}
-	if err := i.checkRunning(); err != nil {
+	if err := i.checkQueryable(); err != nil {
 		return nil, cleanup, err
 	}
 
@@ -1423,6 +1722,12 @@ func (i *Ingester) labelsValuesCommon(ctx context.Context, req *client.LabelValu
 		return nil, cleanup, err
 	}
 
+	release, err := i.limitQueryConcurrency(ctx, userID)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	cleanup = release
+
 	db := i.getTSDB(userID)
 	if db == nil {
 		return &client.LabelValuesResponse{}, cleanup, nil
@@ -1440,6 +1745,7 @@ func (i *Ingester) labelsValuesCommon(ctx context.Context, req *client.LabelValu
 
 	cleanup = func() {
 		q.Close()
+		release()
 	}
 
 	vals, _, err := q.LabelValues(ctx, labelName, matchers...)
@@ -1494,7 +1800,7 @@ func (i *Ingester) LabelNamesStream(req *client.LabelNamesRequest, stream client
 // the cleanup function should be called in order to close the querier
 func (i *Ingester) labelNamesCommon(ctx context.Context, req *client.LabelNamesRequest) (*client.LabelNamesResponse, func(), error) {
 	cleanup := func() {}
-	if err := i.checkRunning(); err != nil {
+	if err := i.checkQueryable(); err != nil {
 		return nil, cleanup, err
 	}
 
@@ -1503,6 +1809,12 @@ func (i *Ingester) labelNamesCommon(ctx context.Context, req *client.LabelNamesR
 		return nil, cleanup, err
 	}
 
+	release, err := i.limitQueryConcurrency(ctx, userID)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	cleanup = release
+
 	db := i.getTSDB(userID)
 	if db == nil {
 		return &client.LabelNamesResponse{}, cleanup, nil
@@ -1520,6 +1832,7 @@ func (i *Ingester) labelNamesCommon(ctx context.Context, req *client.LabelNamesR
 
 	cleanup = func() {
 		q.Close()
+		release()
 	}
 
 	names, _, err := q.LabelNames(ctx)
@@ -1568,7 +1881,7 @@ func (i *Ingester) MetricsForLabelMatchersStream(req *client.MetricsForLabelMatc
 // the cleanup function should be called in order to close the querier
 func (i *Ingester) metricsForLabelMatchersCommon(ctx context.Context, req *client.MetricsForLabelMatchersRequest) (*client.MetricsForLabelMatchersResponse, func(), error) {
 	cleanup := func() {}
-	if err := i.checkRunning(); err != nil {
+	if err := i.checkQueryable(); err != nil {
 		return nil, cleanup, err
 	}
 
@@ -1577,6 +1890,12 @@ func (i *Ingester) metricsForLabelMatchersCommon(ctx context.Context, req *clien
 		return nil, cleanup, err
 	}
 
+	release, err := i.limitQueryConcurrency(ctx, userID)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	cleanup = release
+
 	db := i.getTSDB(userID)
 	if db == nil {
 		return &client.MetricsForLabelMatchersResponse{}, cleanup, nil
@@ -1600,6 +1919,7 @@ func (i *Ingester) metricsForLabelMatchersCommon(ctx context.Context, req *clien
 
 	cleanup = func() {
 		q.Close()
+		release()
 	}
 
 	// Run a query for each matchers set and collect all the results.
@@ -1744,7 +2064,7 @@ const queryStreamBatchMessageSize = 1 * 1024 * 1024
 // QueryStream implements service.IngesterServer
 // Streams metrics from a TSDB. This implements the client.IngesterServer interface
 func (i *Ingester) QueryStream(req *client.QueryRequest, stream client.Ingester_QueryStreamServer) error {
-	if err := i.checkRunning(); err != nil {
+	if err := i.checkQueryable(); err != nil {
 		return err
 	}
 
@@ -1759,6 +2079,12 @@ func (i *Ingester) QueryStream(req *client.QueryRequest, stream client.Ingester_
 		return err
 	}
 
+	release, err := i.limitQueryConcurrency(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	from, through, matchers, err := client.FromQueryRequest(req)
 	if err != nil {
 		return err
@@ -1796,6 +2122,42 @@ func (i *Ingester) QueryStream(req *client.QueryRequest, stream client.Ingester_
 	return nil
 }
 
+// limitQueryConcurrency waits for the user to be below its concurrent queries limit, and sheds the
+// query if the ingester already executes too many queries across all the users. Only the queries
+// holding a slot are accounted to the instance limit, not the ones waiting for it. On success, the
+// returned function must be called to release the slot once the query is handled.
+func (i *Ingester) limitQueryConcurrency(ctx context.Context, userID string) (func(), error) {
+	gl := i.getInstanceLimits()
+	overInstanceLimit := func(executing int64) bool {
+		return gl != nil && gl.MaxInflightQueryRequests > 0 && executing > gl.MaxInflightQueryRequests
+	}
+
+	// Shed early, without waiting for a slot, if the ingester is already saturated.
+	if overInstanceLimit(i.executingQueryRequests.Load() + 1) {
+		return nil, httpgrpc.Errorf(http.StatusServiceUnavailable, "%s", errTooManyInflightQueryRequests.Error())
+	}
+
+	maxConcurrentQueries := i.limits.MaxConcurrentIngesterQueries(userID)
+	release, err := i.queryConcurrencyLimiter.Acquire(ctx, userID, maxConcurrentQueries, i.limits.ConcurrentIngesterQueriesWaitTimeout(userID))
+	if err != nil {
+		if errors.Is(err, limiter.ErrTooManyConcurrentRequests) {
+			i.metrics.throttledQueries.WithLabelValues(userID).Inc()
+			return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "%s", wrapWithUser(fmt.Errorf("too many concurrent queries in the ingester (limit: %d)", maxConcurrentQueries), userID).Error())
+		}
+		return nil, err
+	}
+
+	if overInstanceLimit(i.executingQueryRequests.Inc()) {
+		i.executingQueryRequests.Dec()
+		release()
+		return nil, httpgrpc.Errorf(http.StatusServiceUnavailable, "%s", errTooManyInflightQueryRequests.Error())
+	}
+	return func() {
+		i.executingQueryRequests.Dec()
+		release()
+	}, nil
+}
+
 func (i *Ingester) trackInflightQueryRequest() func() {
 	i.maxInflightQueryRequests.Track(i.inflightQueryRequests.Inc())
 	return func() {
@@ -1852,6 +2214,10 @@ func (i *Ingester) queryStreamChunks(ctx context.Context, db *userTSDB, from, th
 			switch meta.Chunk.Encoding() {
 			case chunkenc.EncXOR:
 				ch.Encoding = int32(encoding.PrometheusXorChunk)
+			case chunkenc.EncHistogram:
+				ch.Encoding = int32(encoding.PrometheusHistogramChunk)
+			case chunkenc.EncFloatHistogram:
+				ch.Encoding = int32(encoding.PrometheusFloatHistogramChunk)
 			default:
 				return 0, 0, 0, errors.Errorf("unknown chunk encoding from TSDB chunk querier: %v", meta.Chunk.Encoding())
 			}
@@ -1984,6 +2350,10 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 
 		instanceLimitsFn:    i.getInstanceLimits,
 		instanceSeriesCount: &i.TSDBState.seriesCount,
+
+		oooRecentRejectedLogLimiter: rate.NewLimiter(rate.Every(oooRecentRejectedLogInterval), 1),
+
+		flushedBlocksRetention: func() time.Duration { return i.limits.FlushedBlocksRetention(userID) },
 	}
 
 	enableExemplars := false
@@ -2016,6 +2386,7 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 		EnableMemorySnapshotOnShutdown: i.cfg.BlocksStorageConfig.TSDB.MemorySnapshotOnShutdown,
 		OutOfOrderTimeWindow:           time.Duration(oooTimeWindow).Milliseconds(),
 		OutOfOrderCapMax:               i.cfg.BlocksStorageConfig.TSDB.OutOfOrderCapMax,
+		EnableNativeHistograms:         true,  // The native histograms are discarded on push unless enabled for the user.
 		EnableOverlappingCompaction:    false, // Always let compactors handle overlapped blocks, e.g. OOO blocks.
 	}, nil)
 	if err != nil {
@@ -2061,19 +2432,34 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 
 	// Create a new shipper for this database
 	if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
-		userDB.shipper = shipper.New(
+		userBucket := bucket.NewUserBucketClient(userID, i.TSDBState.bucket, i.limits)
+		uploadCompacted := func() bool {
+			return i.cfg.UploadCompactedBlocksEnabled
+		}
+
+		// The blocks are split in shards before being shipped, if enabled for the user.
+		userDB.shipper = newShardedShipper(
+			shipper.New(
+				userLogger,
+				tsdbPromReg,
+				udir,
+				userBucket,
+				func() labels.Labels { return l },
+				metadata.ReceiveSource,
+				uploadCompacted,
+				true, // Allow out of order uploads. It's fine in Cortex's context.
+				metadata.NoneFunc,
+				"",
+			),
 			userLogger,
-			tsdbPromReg,
 			udir,
-			bucket.NewUserBucketClient(userID, i.TSDBState.bucket, i.limits),
+			userBucket,
 			func() labels.Labels { return l },
-			metadata.ReceiveSource,
-			func() bool {
-				return i.cfg.UploadCompactedBlocksEnabled
-			},
-			true, // Allow out of order uploads. It's fine in Cortex's context.
-			metadata.NoneFunc,
-			"",
+			func() int { return i.limits.ShippedBlockShards(userID) },
+			uploadCompacted,
+			blockRanges,
+			i.metrics.shipperShardUploads,
+			i.metrics.shipperShardUploadFailures,
 		)
 		userDB.shipperMetadataFilePath = filepath.Join(userDB.db.Dir(), filepath.Clean(shipper.DefaultMetaFilename))
 
@@ -2266,11 +2652,11 @@ func (i *Ingester) shipBlocksLoop(ctx context.Context) error {
 	for {
 		select {
 		case <-shipTicker.C:
-			i.shipBlocks(ctx, nil)
+			// The failures are already logged per user.
+			_ = i.shipBlocks(ctx, nil)
 
 		case req := <-i.TSDBState.shipTrigger:
-			i.shipBlocks(ctx, req.users)
-			close(req.callback) // Notify back.
+			req.callback <- i.shipBlocks(ctx, req.users) // Notify back.
 
 		case <-ctx.Done():
 			return nil
@@ -2278,8 +2664,8 @@ func (i *Ingester) shipBlocksLoop(ctx context.Context) error {
 	}
 }
 
-// shipBlocks runs shipping for all users.
-func (i *Ingester) shipBlocks(ctx context.Context, allowed *util.AllowedTenants) {
+// shipBlocks runs shipping for all users. It returns an error if shipping failed for any of the users.
+func (i *Ingester) shipBlocks(ctx context.Context, allowed *util.AllowedTenants) error {
 	// Do not ship blocks if the ingester is PENDING or JOINING. It's
 	// particularly important for the JOINING state because there could
 	// be a blocks transfer in progress (from another ingester) and if we
@@ -2287,13 +2673,13 @@ func (i *Ingester) shipBlocks(ctx context.Context, allowed *util.AllowedTenants)
 	if i.lifecycler != nil {
 		if ingesterState := i.lifecycler.GetState(); ingesterState == ring.PENDING || ingesterState == ring.JOINING {
 			level.Info(logutil.WithContext(ctx, i.logger)).Log("msg", "TSDB blocks shipping has been skipped because of the current ingester state", "state", ingesterState)
-			return
+			return nil
 		}
 	}
 
 	// Number of concurrent workers is limited in order to avoid to concurrently sync a lot
 	// of tenants in a large cluster.
-	_ = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.ShipConcurrency, func(ctx context.Context, userID string) error {
+	return concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.ShipConcurrency, func(ctx context.Context, userID string) error {
 		if !allowed.IsAllowed(userID) {
 			return nil
 		}
@@ -2359,7 +2745,10 @@ func (i *Ingester) shipBlocks(ctx context.Context, allowed *util.AllowedTenants)
 			}
 		}
 
-		return nil
+		retainedBytes, _ := userDB.getRetainedFlushedBlocksBytes(time.Now())
+		i.metrics.retainedFlushedBlocksBytes.WithLabelValues(userID).Set(float64(retainedBytes))
+
+		return errors.Wrapf(err, "shipping TSDB blocks for user %s", userID)
 	})
 }
 
@@ -2382,11 +2771,11 @@ func (i *Ingester) compactionLoop(ctx context.Context) error {
 	for ctx.Err() == nil {
 		select {
 		case <-ticker.C:
-			i.compactBlocks(ctx, false, nil)
+			// The failures are already logged per user.
+			_ = i.compactBlocks(ctx, false, nil)
 
 		case req := <-i.TSDBState.forceCompactTrigger:
-			i.compactBlocks(ctx, true, req.users)
-			close(req.callback) // Notify back.
+			req.callback <- i.compactBlocks(ctx, true, req.users) // Notify back.
 
 		case <-ctx.Done():
 			return nil
@@ -2396,17 +2785,18 @@ func (i *Ingester) compactionLoop(ctx context.Context) error {
 }
 
 // Compacts all compactable blocks. Force flag will force compaction even if head is not compactable yet.
-func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.AllowedTenants) {
+// It returns an error if compaction failed for any of the users.
+func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.AllowedTenants) error {
 	// Don't compact TSDB blocks while JOINING as there may be ongoing blocks transfers.
 	// Compaction loop is not running in LEAVING state, so if we get here in LEAVING state, we're flushing blocks.
 	if i.lifecycler != nil {
 		if ingesterState := i.lifecycler.GetState(); ingesterState == ring.JOINING {
 			level.Info(logutil.WithContext(ctx, i.logger)).Log("msg", "TSDB blocks compaction has been skipped because of the current ingester state", "state", ingesterState)
-			return
+			return nil
 		}
 	}
 
-	_ = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.HeadCompactionConcurrency, func(ctx context.Context, userID string) error {
+	return concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.HeadCompactionConcurrency, func(ctx context.Context, userID string) error {
 		if !allowed.IsAllowed(userID) {
 			return nil
 		}
@@ -2424,21 +2814,26 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 
 		var err error
 
-		i.TSDBState.compactionsTriggered.Inc()
-
 		reason := ""
 		switch {
 		case force:
 			reason = "forced"
+			i.TSDBState.compactionsTriggered.Inc()
 			err = userDB.compactHead(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
 
 		case i.TSDBState.compactionIdleTimeout > 0 && userDB.isIdle(time.Now(), i.TSDBState.compactionIdleTimeout):
 			reason = "idle"
 			level.Info(logutil.WithContext(ctx, i.logger)).Log("msg", "TSDB is idle, forcing compaction", "user", userID)
+			i.TSDBState.compactionsTriggered.Inc()
 			err = userDB.compactHead(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
 
+		case i.isHeadCompactionPostponed(userID, h):
+			// The regular compaction is postponed by the stagger offset of the user.
+			return nil
+
 		default:
 			reason = "regular"
+			i.TSDBState.compactionsTriggered.Inc()
 			err = userDB.Compact(ctx)
 		}
 
@@ -2449,8 +2844,43 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 			level.Debug(logutil.WithContext(ctx, i.logger)).Log("msg", "TSDB blocks compaction completed successfully", "user", userID, "compactReason", reason)
 		}
 
+		return errors.Wrapf(err, "compacting TSDB head for user %s", userID)
+	})
+}
+
+// snapshotHeads snapshots the in-memory data of the heads of all the users on disk, so that the
+// ingester replays only the WAL written since the snapshots on startup.
+func (i *Ingester) snapshotHeads(ctx context.Context) error {
+	_ = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.HeadCompactionConcurrency, func(ctx context.Context, userID string) error {
+		userDB := i.getTSDB(userID)
+		if userDB == nil || userDB.Head().NumSeries() == 0 {
+			return nil
+		}
+
+		i.TSDBState.memorySnapshots.Inc()
+		if err := userDB.snapshotHead(); err != nil {
+			i.TSDBState.memorySnapshotsFailed.Inc()
+			level.Warn(logutil.WithContext(ctx, i.logger)).Log("msg", "TSDB memory snapshot for user has failed", "user", userID, "err", err)
+		}
 		return nil
 	})
+
+	// Never fail the timer service, the snapshots are retried at the next interval.
+	return nil
+}
+
+// isHeadCompactionPostponed returns whether the regular compaction of the head of the user is
+// postponed by its stagger offset. The head is compactable once it spans 1.5 times the smallest
+// block range, and the stagger offset of the user is added to it.
+func (i *Ingester) isHeadCompactionPostponed(userID string, h *tsdb.Head) bool {
+	period := i.cfg.BlocksStorageConfig.TSDB.HeadCompactionStaggerPeriod.Milliseconds()
+	if period <= 0 {
+		return false
+	}
+
+	blockRange := i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds()
+	offset := int64(client.HashAdd32(client.HashNew32(), userID)) % period
+	return h.MaxTime()-h.MinTime() <= blockRange/2*3+offset
 }
 
 func (i *Ingester) closeAndDeleteIdleUserTSDBs(ctx context.Context) error {
@@ -2668,9 +3098,9 @@ func (i *Ingester) lifecyclerFlush() {
 
 	ctx := context.Background()
 
-	i.compactBlocks(ctx, true, nil)
+	_ = i.compactBlocks(ctx, true, nil)
 	if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
-		i.shipBlocks(ctx, nil)
+		_ = i.shipBlocks(ctx, nil)
 	}
 
 	level.Info(i.logger).Log("msg", "finished flushing and shipping TSDB blocks")
@@ -2682,6 +3112,7 @@ const (
 )
 
 // Blocks version of Flush handler. It force-compacts blocks, and triggers shipping.
+// When called with wait=true, the response status code reflects the result of the flush.
 func (i *Ingester) flushHandler(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -2693,14 +3124,15 @@ func (i *Ingester) flushHandler(w http.ResponseWriter, r *http.Request) {
 	tenants := r.Form[tenantParam]
 
 	allowedUsers := util.NewAllowedTenants(tenants, nil)
-	run := func() {
+	run := func() (int, error) {
 		ingCtx := i.BasicService.ServiceContext()
 		if ingCtx == nil || ingCtx.Err() != nil {
 			level.Info(logutil.WithContext(r.Context(), i.logger)).Log("msg", "flushing TSDB blocks: ingester not running, ignoring flush request")
-			return
+			return http.StatusServiceUnavailable, errFlushIngesterNotRunning
 		}
 
-		compactionCallbackCh := make(chan struct{})
+		// Buffered, so that the compaction and shipping loops never block notifying back.
+		compactionCallbackCh := make(chan error, 1)
 
 		level.Info(logutil.WithContext(r.Context(), i.logger)).Log("msg", "flushing TSDB blocks: triggering compaction")
 		select {
@@ -2708,20 +3140,23 @@ func (i *Ingester) flushHandler(w http.ResponseWriter, r *http.Request) {
 			// Compacting now.
 		case <-ingCtx.Done():
 			level.Warn(logutil.WithContext(r.Context(), i.logger)).Log("msg", "failed to compact TSDB blocks, ingester not running anymore")
-			return
+			return http.StatusServiceUnavailable, errFlushIngesterNotRunning
 		}
 
-		// Wait until notified about compaction being finished.
+		// Wait until notified about compaction being finished. The failures are already logged per user.
 		select {
-		case <-compactionCallbackCh:
+		case err := <-compactionCallbackCh:
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
 			level.Info(logutil.WithContext(r.Context(), i.logger)).Log("msg", "finished compacting TSDB blocks")
 		case <-ingCtx.Done():
 			level.Warn(logutil.WithContext(r.Context(), i.logger)).Log("msg", "failed to compact TSDB blocks, ingester not running anymore")
-			return
+			return http.StatusServiceUnavailable, errFlushIngesterNotRunning
 		}
 
 		if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
-			shippingCallbackCh := make(chan struct{}) // must be new channel, as compactionCallbackCh is closed now.
+			shippingCallbackCh := make(chan error, 1)
 
 			level.Info(logutil.WithContext(r.Context(), i.logger)).Log("msg", "flushing TSDB blocks: triggering shipping")
 
@@ -2730,27 +3165,34 @@ func (i *Ingester) flushHandler(w http.ResponseWriter, r *http.Request) {
 				// shipping now
 			case <-ingCtx.Done():
 				level.Warn(logutil.WithContext(r.Context(), i.logger)).Log("msg", "failed to ship TSDB blocks, ingester not running anymore")
-				return
+				return http.StatusServiceUnavailable, errFlushIngesterNotRunning
 			}
 
 			// Wait until shipping finished.
 			select {
-			case <-shippingCallbackCh:
+			case err := <-shippingCallbackCh:
+				if err != nil {
+					return http.StatusInternalServerError, err
+				}
 				level.Info(logutil.WithContext(r.Context(), i.logger)).Log("msg", "shipping of TSDB blocks finished")
 			case <-ingCtx.Done():
 				level.Warn(logutil.WithContext(r.Context(), i.logger)).Log("msg", "failed to ship TSDB blocks, ingester not running anymore")
-				return
+				return http.StatusServiceUnavailable, errFlushIngesterNotRunning
 			}
 		}
 
 		level.Info(logutil.WithContext(r.Context(), i.logger)).Log("msg", "flushing TSDB blocks: finished")
+		return http.StatusNoContent, nil
 	}
 
 	if len(r.Form[waitParam]) > 0 && r.Form[waitParam][0] == "true" {
-		// Run synchronously. This simplifies and speeds up tests.
-		run()
+		// Run synchronously, and report the result of the flush.
+		if status, err := run(); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
 	} else {
-		go run()
+		go func() { _, _ = run() }()
 	}
 
 	w.WriteHeader(http.StatusNoContent)
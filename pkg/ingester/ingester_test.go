@@ -39,8 +39,11 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 
@@ -54,6 +57,7 @@ import (
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/chunkcompat"
+	histogram_util "github.com/cortexproject/cortex/pkg/util/histogram"
 	"github.com/cortexproject/cortex/pkg/util/services"
 	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/cortexproject/cortex/pkg/util/validation"
@@ -466,6 +470,49 @@ func benchmarkData(nSeries int) (allLabels []labels.Labels, allSamples []cortexp
 	return
 }
 
+func TestIngester_RejectMetricTypeConflicts(t *testing.T) {
+	for _, rejectConflicts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reject conflicts: %t", rejectConflicts), func(t *testing.T) {
+			limits := defaultLimitsTestConfig()
+			limits.RejectMetricTypeConflicts = rejectConflicts
+
+			registry := prometheus.NewRegistry()
+			ing, err := prepareIngesterWithBlocksStorageAndLimits(t, defaultIngesterTestConfig(t), limits, nil, t.TempDir(), registry)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+			defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+			test.Poll(t, time.Second, ring.ACTIVE, func() interface{} {
+				return ing.lifecycler.GetState()
+			})
+
+			counter := &cortexpb.MetricMetadata{MetricFamilyName: "testmetric", Help: "a counter", Type: cortexpb.COUNTER}
+			gauge := &cortexpb.MetricMetadata{MetricFamilyName: "testmetric", Help: "a gauge", Type: cortexpb.GAUGE}
+			unknown := &cortexpb.MetricMetadata{MetricFamilyName: "testmetric", Help: "an untyped metric", Type: cortexpb.UNKNOWN}
+
+			// Metadata is a best effort approach, so the conflicting metadata is dropped without failing the request.
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+			_, err = ing.Push(ctx, cortexpb.ToWriteRequest(nil, nil, []*cortexpb.MetricMetadata{counter, gauge, unknown}, nil, cortexpb.API))
+			require.NoError(t, err)
+
+			res, err := ing.MetricsMetadata(ctx, nil)
+			require.NoError(t, err)
+
+			if !rejectConflicts {
+				assert.ElementsMatch(t, []*cortexpb.MetricMetadata{counter, gauge, unknown}, res.Metadata)
+				return
+			}
+
+			assert.ElementsMatch(t, []*cortexpb.MetricMetadata{counter, unknown}, res.Metadata)
+			assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+				# HELP cortex_discarded_metadata_total The total number of metadata that were discarded.
+				# TYPE cortex_discarded_metadata_total counter
+				cortex_discarded_metadata_total{reason="metric_type_conflict",user="user-1"} 1
+			`), "cortex_discarded_metadata_total"))
+		})
+	}
+}
+
 func TestIngesterMetricLimitExceeded(t *testing.T) {
 	limits := defaultLimitsTestConfig()
 	limits.MaxLocalSeriesPerMetric = 1
@@ -611,6 +658,7 @@ func TestIngester_Push(t *testing.T) {
 		disableActiveSeries       bool
 		maxExemplars              int
 		oooTimeWindow             time.Duration
+		oooRecentRejectedWindow   time.Duration
 	}{
 		"should record native histogram": {
 			reqs: []*cortexpb.WriteRequest{
@@ -1017,6 +1065,107 @@ func TestIngester_Push(t *testing.T) {
 				cortex_ingester_active_series{user="test"} 1
 			`,
 		},
+		"ooo enabled, should track sample too old within the recent rejected window": {
+			reqs: []*cortexpb.WriteRequest{
+				cortexpb.ToWriteRequest(
+					[]labels.Labels{metricLabels},
+					[]cortexpb.Sample{{Value: 2, TimestampMs: 1575043969}},
+					nil,
+					nil,
+					cortexpb.API),
+				cortexpb.ToWriteRequest(
+					[]labels.Labels{metricLabels},
+					[]cortexpb.Sample{{Value: 1, TimestampMs: 1575043969 - (600 * 1000)}},
+					nil,
+					nil,
+					cortexpb.API),
+			},
+			oooTimeWindow:           5 * time.Minute,
+			oooRecentRejectedWindow: 10 * time.Minute,
+			additionalMetrics:       []string{"cortex_ingester_out_of_order_recent_rejected_samples_total"},
+			expectedErr:             httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(wrappedTSDBIngestErr(storage.ErrTooOldSample, model.Time(1575043969-(600*1000)), cortexpb.FromLabelsToLabelAdapters(metricLabels)), userID).Error()),
+			expectedIngested: []cortexpb.TimeSeries{
+				{Labels: metricLabelAdapters, Samples: []cortexpb.Sample{{Value: 2, TimestampMs: 1575043969}}},
+			},
+			expectedMetrics: `
+				# HELP cortex_ingester_ingested_samples_total The total number of samples ingested.
+				# TYPE cortex_ingester_ingested_samples_total counter
+				cortex_ingester_ingested_samples_total 1
+				# HELP cortex_ingester_ingested_samples_failures_total The total number of samples that errored on ingestion.
+				# TYPE cortex_ingester_ingested_samples_failures_total counter
+				cortex_ingester_ingested_samples_failures_total 1
+				# HELP cortex_ingester_memory_users The current number of users in memory.
+				# TYPE cortex_ingester_memory_users gauge
+				cortex_ingester_memory_users 1
+				# HELP cortex_ingester_memory_series The current number of series in memory.
+				# TYPE cortex_ingester_memory_series gauge
+				cortex_ingester_memory_series 1
+				# HELP cortex_ingester_memory_series_created_total The total number of series that were created per user.
+				# TYPE cortex_ingester_memory_series_created_total counter
+				cortex_ingester_memory_series_created_total{user="test"} 1
+				# HELP cortex_ingester_memory_series_removed_total The total number of series that were removed per user.
+				# TYPE cortex_ingester_memory_series_removed_total counter
+				cortex_ingester_memory_series_removed_total{user="test"} 0
+				# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+				# TYPE cortex_discarded_samples_total counter
+				cortex_discarded_samples_total{reason="sample-too-old",user="test"} 1
+				# HELP cortex_ingester_out_of_order_recent_rejected_samples_total The total number of samples rejected for being older than the out-of-order time window by less than the out-of-order recent rejected window, per user.
+				# TYPE cortex_ingester_out_of_order_recent_rejected_samples_total counter
+				cortex_ingester_out_of_order_recent_rejected_samples_total{user="test"} 1
+				# HELP cortex_ingester_active_series Number of currently active series per user.
+				# TYPE cortex_ingester_active_series gauge
+				cortex_ingester_active_series{user="test"} 1
+			`,
+		},
+		"ooo enabled, should not track sample too old beyond the recent rejected window": {
+			reqs: []*cortexpb.WriteRequest{
+				cortexpb.ToWriteRequest(
+					[]labels.Labels{metricLabels},
+					[]cortexpb.Sample{{Value: 2, TimestampMs: 1575043969}},
+					nil,
+					nil,
+					cortexpb.API),
+				cortexpb.ToWriteRequest(
+					[]labels.Labels{metricLabels},
+					[]cortexpb.Sample{{Value: 1, TimestampMs: 1575043969 - (600 * 1000)}},
+					nil,
+					nil,
+					cortexpb.API),
+			},
+			oooTimeWindow:           5 * time.Minute,
+			oooRecentRejectedWindow: time.Minute,
+			additionalMetrics:       []string{"cortex_ingester_out_of_order_recent_rejected_samples_total"},
+			expectedErr:             httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(wrappedTSDBIngestErr(storage.ErrTooOldSample, model.Time(1575043969-(600*1000)), cortexpb.FromLabelsToLabelAdapters(metricLabels)), userID).Error()),
+			expectedIngested: []cortexpb.TimeSeries{
+				{Labels: metricLabelAdapters, Samples: []cortexpb.Sample{{Value: 2, TimestampMs: 1575043969}}},
+			},
+			expectedMetrics: `
+				# HELP cortex_ingester_ingested_samples_total The total number of samples ingested.
+				# TYPE cortex_ingester_ingested_samples_total counter
+				cortex_ingester_ingested_samples_total 1
+				# HELP cortex_ingester_ingested_samples_failures_total The total number of samples that errored on ingestion.
+				# TYPE cortex_ingester_ingested_samples_failures_total counter
+				cortex_ingester_ingested_samples_failures_total 1
+				# HELP cortex_ingester_memory_users The current number of users in memory.
+				# TYPE cortex_ingester_memory_users gauge
+				cortex_ingester_memory_users 1
+				# HELP cortex_ingester_memory_series The current number of series in memory.
+				# TYPE cortex_ingester_memory_series gauge
+				cortex_ingester_memory_series 1
+				# HELP cortex_ingester_memory_series_created_total The total number of series that were created per user.
+				# TYPE cortex_ingester_memory_series_created_total counter
+				cortex_ingester_memory_series_created_total{user="test"} 1
+				# HELP cortex_ingester_memory_series_removed_total The total number of series that were removed per user.
+				# TYPE cortex_ingester_memory_series_removed_total counter
+				cortex_ingester_memory_series_removed_total{user="test"} 0
+				# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+				# TYPE cortex_discarded_samples_total counter
+				cortex_discarded_samples_total{reason="sample-too-old",user="test"} 1
+				# HELP cortex_ingester_active_series Number of currently active series per user.
+				# TYPE cortex_ingester_active_series gauge
+				cortex_ingester_active_series{user="test"} 1
+			`,
+		},
 		"ooo enabled, should succeed": {
 			reqs: []*cortexpb.WriteRequest{
 				cortexpb.ToWriteRequest(
@@ -1196,6 +1345,7 @@ func TestIngester_Push(t *testing.T) {
 			limits := defaultLimitsTestConfig()
 			limits.MaxExemplars = testData.maxExemplars
 			limits.OutOfOrderTimeWindow = model.Duration(testData.oooTimeWindow)
+			limits.OutOfOrderRecentRejectedWindow = model.Duration(testData.oooRecentRejectedWindow)
 			i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, nil, "", registry)
 			require.NoError(t, err)
 			require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
@@ -2507,6 +2657,94 @@ func TestIngester_QueryStream(t *testing.T) {
 	t.Run("chunks", chunksTest)
 }
 
+func TestIngester_PushAndQueryStreamNativeHistograms(t *testing.T) {
+	limits := defaultLimitsTestConfig()
+	limits.EnableNativeHistograms = true
+
+	registry := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, defaultIngesterTestConfig(t), limits, nil, "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE.
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	histograms := histogram_util.GenerateTestHistograms(0, 1, 3, 2, 4)
+	intLabels := labels.FromStrings(labels.MetricName, "foo", "type", "int")
+	floatLabels := labels.FromStrings(labels.MetricName, "foo", "type", "float")
+	invalidLabels := labels.FromStrings(labels.MetricName, "foo", "type", "invalid")
+
+	intSeries := cortexpb.TimeSeries{Labels: cortexpb.FromLabelsToLabelAdapters(intLabels)}
+	floatSeries := cortexpb.TimeSeries{Labels: cortexpb.FromLabelsToLabelAdapters(floatLabels)}
+	for j, h := range histograms {
+		intSeries.Histograms = append(intSeries.Histograms, cortexpb.HistogramToHistogramProto(int64(j+1)*1000, h))
+		floatSeries.Histograms = append(floatSeries.Histograms, cortexpb.FloatHistogramToHistogramProto(int64(j+1)*1000, h.ToFloat(nil)))
+	}
+	// The count of the invalid histogram doesn't match its buckets.
+	invalid := histograms[0].Copy()
+	invalid.Count++
+	invalidSeries := cortexpb.TimeSeries{
+		Labels:     cortexpb.FromLabelsToLabelAdapters(invalidLabels),
+		Histograms: []cortexpb.Histogram{cortexpb.HistogramToHistogramProto(1000, invalid)},
+	}
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	_, err = i.Push(ctx, &cortexpb.WriteRequest{
+		Source: cortexpb.API,
+		Timeseries: []cortexpb.PreallocTimeseries{
+			{TimeSeries: &intSeries},
+			{TimeSeries: &floatSeries},
+			{TimeSeries: &invalidSeries},
+		},
+	})
+	httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok)
+	require.Equal(t, int32(http.StatusBadRequest), httpResp.Code)
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{reason="invalid-native-histogram",user="1"} 1
+	`), "cortex_discarded_samples_total"))
+
+	// Query back the histograms through the chunks of the ingester.
+	req, err := client.ToQueryRequest(model.Earliest, model.Latest, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "foo")})
+	require.NoError(t, err)
+	s := &mockQueryStreamServer{ctx: ctx}
+	require.NoError(t, i.QueryStream(req, s))
+
+	set, err := seriesSetFromResponseStream(s)
+	require.NoError(t, err)
+
+	var seriesLabels []labels.Labels
+	for set.Next() {
+		series := set.At()
+		seriesLabels = append(seriesLabels, series.Labels())
+
+		it := series.Iterator(nil)
+		for j := 0; it.Next() != chunkenc.ValNone; j++ {
+			require.Less(t, j, len(histograms))
+			if series.Labels().Get("type") == "float" {
+				ts, fh := it.AtFloatHistogram(nil)
+				require.Equal(t, int64(j+1)*1000, ts)
+				require.Equal(t, histograms[j].ToFloat(nil), fh)
+			} else {
+				ts, h := it.AtHistogram(nil)
+				require.Equal(t, int64(j+1)*1000, ts)
+				require.Equal(t, histograms[j], h)
+			}
+		}
+		require.NoError(t, it.Err())
+	}
+	require.NoError(t, set.Err())
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings(labels.MetricName, "foo", "type", "float"),
+		labels.FromStrings(labels.MetricName, "foo", "type", "int"),
+	}, seriesLabels)
+}
+
 func TestIngester_QueryStreamManySamplesChunks(t *testing.T) {
 	// Create ingester.
 	cfg := defaultIngesterTestConfig(t)
@@ -2910,6 +3148,118 @@ func TestIngester_OpenExistingTSDBOnStartup(t *testing.T) {
 	}
 }
 
+func TestIngester_QueriesDuringWALReplay(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range QueriesDuringWALReplayPolicies {
+		policy := policy
+
+		t.Run(policy, func(t *testing.T) {
+			t.Parallel()
+
+			dataDir := t.TempDir()
+			cfg := defaultIngesterTestConfig(t)
+			cfg.QueriesDuringWALReplay = policy
+			ctx := user.InjectOrgID(context.Background(), userID)
+
+			// Push a sample, so that there's a WAL to replay.
+			i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, defaultLimitsTestConfig(), nil, dataDir, prometheus.NewRegistry())
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+			test.Poll(t, time.Second, ring.ACTIVE, func() interface{} {
+				return i.lifecycler.GetState()
+			})
+			req, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 1, 10)
+			_, err = i.Push(ctx, req)
+			require.NoError(t, err)
+			require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+
+			// Open the TSDB like the ingester does while starting, without completing the startup.
+			reg := prometheus.NewPedanticRegistry()
+			i, err = prepareIngesterWithBlocksStorageAndLimits(t, cfg, defaultLimitsTestConfig(), nil, dataDir, reg)
+			require.NoError(t, err)
+			require.NoError(t, i.openExistingTSDB(context.Background()))
+			defer i.closeAllTSDB()
+			i.walReplaying.Store(true)
+
+			res, err := i.LabelNames(ctx, &client.LabelNamesRequest{StartTimestampMs: 0, EndTimestampMs: 20})
+			if policy == QueriesDuringWALReplayReject {
+				assert.Equal(t, codes.Unavailable, status.Code(err))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, []string{labels.MetricName}, res.LabelNames)
+			}
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+				# HELP cortex_ingester_queries_during_wal_replay_total The total number of queries received while replaying the WAL, by the policy applied to them.
+				# TYPE cortex_ingester_queries_during_wal_replay_total counter
+				cortex_ingester_queries_during_wal_replay_total{policy="%s"} 1
+			`, policy)), "cortex_ingester_queries_during_wal_replay_total"))
+
+			// Once the WAL has been replayed, queries are rejected until the ingester is running.
+			i.walReplaying.Store(false)
+			_, err = i.LabelNames(ctx, &client.LabelNamesRequest{StartTimestampMs: 0, EndTimestampMs: 20})
+			assert.Equal(t, codes.Unavailable, status.Code(err))
+		})
+	}
+}
+
+func TestIngester_snapshotHeads(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.MemorySnapshotInterval = time.Hour
+	cfg.BlocksStorageConfig.TSDB.MemorySnapshotOnShutdown = true
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	reg := prometheus.NewPedanticRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, defaultLimitsTestConfig(), nil, dataDir, reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	test.Poll(t, time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	lbls := labels.Labels{{Name: labels.MetricName, Value: "test"}}
+	req, _ := mockWriteRequest(t, lbls, 1, 10)
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+
+	// Snapshot the head, and push another sample to the WAL after the snapshot.
+	require.NoError(t, i.snapshotHeads(context.Background()))
+	snapshots, err := filepath.Glob(filepath.Join(i.getTSDB(userID).db.Dir(), "chunk_snapshot.*"))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ingester_tsdb_memory_snapshots_total Total number of periodic snapshots of the in-memory TSDB data.
+		# TYPE cortex_ingester_tsdb_memory_snapshots_total counter
+		cortex_ingester_tsdb_memory_snapshots_total 1
+		# HELP cortex_ingester_tsdb_memory_snapshots_failed_total Total number of periodic snapshots of the in-memory TSDB data that failed.
+		# TYPE cortex_ingester_tsdb_memory_snapshots_failed_total counter
+		cortex_ingester_tsdb_memory_snapshots_failed_total 0
+	`), "cortex_ingester_tsdb_memory_snapshots_total", "cortex_ingester_tsdb_memory_snapshots_failed_total"))
+
+	req, _ = mockWriteRequest(t, lbls, 2, 20)
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+
+	// The restarted ingester loads the snapshot, and replays the WAL written since then.
+	i, err = prepareIngesterWithBlocksStorageAndLimits(t, cfg, defaultLimitsTestConfig(), nil, dataDir, prometheus.NewRegistry())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+	test.Poll(t, time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	res, _, err := runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "test")
+	require.NoError(t, err)
+	require.Equal(t, model.Matrix{{
+		Metric: model.Metric{labels.MetricName: "test"},
+		Values: []model.SamplePair{{Timestamp: 10, Value: 1}, {Timestamp: 20, Value: 2}},
+	}}, res)
+}
+
 func TestIngester_shipBlocks(t *testing.T) {
 	testCases := map[string]struct {
 		ss                   bucketindex.Status
@@ -3363,7 +3713,9 @@ func TestIngester_flushing(t *testing.T) {
 				`), "cortex_ingester_shipper_uploads_total"))
 
 				// Using wait=true makes this a synchronous call.
-				i.FlushHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/flush?wait=true", nil))
+				resp := httptest.NewRecorder()
+				i.FlushHandler(resp, httptest.NewRequest("POST", "/flush?wait=true", nil))
+				require.Equal(t, http.StatusNoContent, resp.Code)
 
 				verifyCompactedHead(t, i, true)
 				require.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
@@ -3501,6 +3853,24 @@ func TestIngester_flushing(t *testing.T) {
 	}
 }
 
+func TestIngester_FlushHandler_ShouldReturnErrorWhenIngesterIsNotRunning(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	// The ingester has not been started.
+	resp := httptest.NewRecorder()
+	i.FlushHandler(resp, httptest.NewRequest("POST", "/flush?wait=true&tenant=user-1", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Contains(t, resp.Body.String(), errFlushIngesterNotRunning.Error())
+
+	// Without waiting, the result of the flush is not reported.
+	resp = httptest.NewRecorder()
+	i.FlushHandler(resp, httptest.NewRequest("POST", "/flush?tenant=user-1", nil))
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+}
+
 func TestIngester_ForFlush(t *testing.T) {
 	cfg := defaultIngesterTestConfig(t)
 	cfg.LifecyclerConfig.JoinAfter = 0
@@ -3679,6 +4049,44 @@ func Test_Ingester_AllUserStats(t *testing.T) {
 	assert.ElementsMatch(t, expect, res.Stats)
 }
 
+func TestIngester_compactBlocksWithStaggerPeriod(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.HeadCompactionInterval = 1 * time.Hour // Long enough to not be reached during the test.
+	cfg.BlocksStorageConfig.TSDB.HeadCompactionIdleTimeout = 0
+	cfg.BlocksStorageConfig.TSDB.HeadCompactionStaggerPeriod = 30 * time.Minute
+
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, prometheus.NewRegistry())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	push := func(timestampMs int64) {
+		req, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 1, timestampMs)
+		_, err := i.Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	// The head would be compactable without the stagger offset of the user.
+	offset := int64(client.HashAdd32(client.HashNew32(), userID)) % cfg.BlocksStorageConfig.TSDB.HeadCompactionStaggerPeriod.Milliseconds()
+	compactableSpan := cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds() / 2 * 3
+	push(0)
+	push(compactableSpan + offset)
+
+	require.NoError(t, i.compactBlocks(context.Background(), false, nil))
+	require.Empty(t, i.getTSDB(userID).db.Blocks())
+
+	// The head is compactable once it spans more than the stagger offset too.
+	push(compactableSpan + offset + 1)
+
+	require.NoError(t, i.compactBlocks(context.Background(), false, nil))
+	require.NotEmpty(t, i.getTSDB(userID).db.Blocks())
+}
+
 func TestIngesterCompactIdleBlock(t *testing.T) {
 	cfg := defaultIngesterTestConfig(t)
 	cfg.LifecyclerConfig.JoinAfter = 0
@@ -4114,6 +4522,130 @@ func TestIngesterNotDeleteUnshippedBlocks(t *testing.T) {
 	`, newBlocks2[0].Meta().ULID.Time()/1000)), "cortex_ingester_oldest_unshipped_block_timestamp_seconds"))
 }
 
+func TestIngesterNotDeleteRecentlyShippedBlocks(t *testing.T) {
+	chunkRange := 2 * time.Hour
+	chunkRangeMilliSec := chunkRange.Milliseconds()
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.BlockRanges = []time.Duration{chunkRange}
+	cfg.BlocksStorageConfig.TSDB.Retention = time.Millisecond // Which means delete all but first block.
+	cfg.BlocksStorageConfig.TSDB.CloseIdleTSDBTimeout = 0     // Will not run the loop, but will allow us to close any TSDB fast.
+	cfg.LifecyclerConfig.JoinAfter = 0
+
+	limits := defaultLimitsTestConfig()
+	limits.FlushedBlocksRetention = model.Duration(time.Hour)
+
+	// Create ingester
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, nil, "", prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// Wait until it's ACTIVE
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	// Push some data to create 3 blocks.
+	ctx := user.InjectOrgID(context.Background(), userID)
+	for j := int64(0); j < 5; j++ {
+		req, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 0, j*chunkRangeMilliSec)
+		_, err := i.Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	db := i.getTSDB(userID)
+	require.NotNil(t, db)
+	require.Nil(t, db.Compact(ctx))
+
+	oldBlocks := db.Blocks()
+	require.Equal(t, 3, len(oldBlocks))
+
+	// Saying that we have just shipped the second block, which is kept because of the retention.
+	require.Nil(t, shipper.WriteMetaFile(nil, db.shipperMetadataFilePath, &shipper.Meta{
+		Version:  shipper.MetaVersion1,
+		Uploaded: []ulid.ULID{oldBlocks[1].Meta().ULID},
+	}))
+	require.NoError(t, db.updateCachedShippedBlocks())
+
+	retainedBytes, found := db.getRetainedFlushedBlocksBytes(time.Now())
+	assert.True(t, found)
+	assert.Equal(t, oldBlocks[1].Size(), retainedBytes)
+
+	req, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 0, 5*chunkRangeMilliSec)
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+	require.Nil(t, db.Compact(ctx))
+
+	newBlocks := db.Blocks()
+	require.Equal(t, 4, len(newBlocks))
+	require.Equal(t, oldBlocks[1].Meta().ULID, newBlocks[1].Meta().ULID)
+
+	// Once the retention has elapsed since the block has been shipped, it's deleted.
+	db.shippedBlocksMtx.Lock()
+	db.shippedBlocks[oldBlocks[1].Meta().ULID] = time.Now().Add(-2 * time.Hour)
+	db.shippedBlocksMtx.Unlock()
+
+	_, found = db.getRetainedFlushedBlocksBytes(time.Now())
+	assert.False(t, found)
+
+	req, _ = mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 0, 6*chunkRangeMilliSec)
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+	require.Nil(t, db.Compact(ctx))
+
+	for _, b := range db.Blocks() {
+		require.NotEqual(t, oldBlocks[1].Meta().ULID, b.Meta().ULID)
+	}
+}
+
+func TestIngester_closeAndDeleteUserTSDBIfIdle_shouldNotCloseTSDBWithRecentlyShippedBlocks(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.CloseIdleTSDBTimeout = 0 // Will not run the loop, but will allow us to close any TSDB fast.
+
+	limits := defaultLimitsTestConfig()
+	limits.FlushedBlocksRetention = model.Duration(time.Hour)
+
+	// Create ingester
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, nil, "", prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// Wait until it's ACTIVE
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	// Push some data, then compact and ship the head.
+	ctx := user.InjectOrgID(context.Background(), userID)
+	req, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 0, util.TimeToMillis(time.Now()))
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+
+	i.compactBlocks(ctx, true, nil)
+	require.NoError(t, i.shipBlocks(ctx, nil))
+
+	db := i.getTSDB(userID)
+	require.NotNil(t, db)
+	require.Equal(t, 1, len(db.Blocks()))
+	require.Equal(t, tsdbRecentlyShipped, i.closeAndDeleteUserTSDBIfIdle(userID))
+
+	// Once the retention has elapsed since the block has been shipped, the TSDB is closed.
+	db.shippedBlocksMtx.Lock()
+	for id := range db.shippedBlocks {
+		db.shippedBlocks[id] = time.Now().Add(-2 * time.Hour)
+	}
+	db.shippedBlocksMtx.Unlock()
+
+	require.Equal(t, tsdbIdleClosed, i.closeAndDeleteUserTSDBIfIdle(userID))
+}
+
 func TestIngesterPushErrorDuringForcedCompaction(t *testing.T) {
 	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(t), prometheus.NewRegistry())
 	require.NoError(t, err)
@@ -4385,6 +4917,7 @@ func TestIngester_instanceLimitsMetrics(t *testing.T) {
 		# HELP cortex_ingester_instance_limits Instance limits used by this ingester.
 		# TYPE cortex_ingester_instance_limits gauge
 		cortex_ingester_instance_limits{limit="max_inflight_push_requests"} 0
+		cortex_ingester_instance_limits{limit="max_inflight_query_requests"} 0
 		cortex_ingester_instance_limits{limit="max_ingestion_rate"} 10
 		cortex_ingester_instance_limits{limit="max_series"} 30
 		cortex_ingester_instance_limits{limit="max_tenants"} 20
@@ -4397,6 +4930,7 @@ func TestIngester_instanceLimitsMetrics(t *testing.T) {
 		# HELP cortex_ingester_instance_limits Instance limits used by this ingester.
 		# TYPE cortex_ingester_instance_limits gauge
 		cortex_ingester_instance_limits{limit="max_inflight_push_requests"} 0
+		cortex_ingester_instance_limits{limit="max_inflight_query_requests"} 0
 		cortex_ingester_instance_limits{limit="max_ingestion_rate"} 10
 		cortex_ingester_instance_limits{limit="max_series"} 2000
 		cortex_ingester_instance_limits{limit="max_tenants"} 1000
@@ -4455,6 +4989,116 @@ func TestIngester_inflightPushRequests(t *testing.T) {
 	require.NoError(t, g.Wait())
 }
 
+func TestIngester_QueryConcurrencyLimits(t *testing.T) {
+	instanceLimits := atomic.NewPointer(&InstanceLimits{})
+	limits := defaultLimitsTestConfig()
+	limits.MaxConcurrentIngesterQueries = 1
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.InstanceLimitsFn = instanceLimits.Load
+	cfg.LifecyclerConfig.JoinAfter = 0
+
+	registry := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, nil, "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until the ingester is ACTIVE
+	test.Poll(t, 100*time.Millisecond, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	req := &client.ExemplarQueryRequest{
+		StartTimestampMs: math.MinInt64,
+		EndTimestampMs:   math.MaxInt64,
+		Matchers: []*client.LabelMatchers{
+			{Matchers: []*client.LabelMatcher{{Type: client.REGEX_MATCH, Name: labels.MetricName, Value: ".*"}}},
+		},
+	}
+
+	_, err = i.QueryExemplars(ctx, req)
+	require.NoError(t, err)
+
+	// A query of the user is in flight, so the following one is shed.
+	release, err := i.queryConcurrencyLimiter.Acquire(ctx, "test", 1, 0)
+	require.NoError(t, err)
+
+	_, err = i.QueryExemplars(ctx, req)
+	assert.Equal(t, httpgrpc.Errorf(http.StatusTooManyRequests, "user=test: too many concurrent queries in the ingester (limit: 1)"), err)
+
+	// The label and series APIs are limited too.
+	_, err = i.LabelNames(ctx, &client.LabelNamesRequest{StartTimestampMs: math.MinInt64, EndTimestampMs: math.MaxInt64})
+	assert.Equal(t, httpgrpc.Errorf(http.StatusTooManyRequests, "user=test: too many concurrent queries in the ingester (limit: 1)"), err)
+
+	// The queries of other users are not affected.
+	_, err = i.QueryExemplars(user.InjectOrgID(context.Background(), "other"), req)
+	require.NoError(t, err)
+
+	release()
+	_, err = i.QueryExemplars(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_ingester_throttled_queries_total The total number of query requests rejected because the user reached the limit of concurrent queries in the ingester.
+		# TYPE cortex_ingester_throttled_queries_total counter
+		cortex_ingester_throttled_queries_total{user="test"} 2
+	`), "cortex_ingester_throttled_queries_total"))
+
+	// Queries above the instance limit are shed, whatever the user.
+	instanceLimits.Store(&InstanceLimits{MaxInflightQueryRequests: 1})
+	i.executingQueryRequests.Inc()
+	_, err = i.QueryExemplars(user.InjectOrgID(context.Background(), "other"), req)
+	assert.Equal(t, httpgrpc.Errorf(http.StatusServiceUnavailable, "%s", errTooManyInflightQueryRequests.Error()), err)
+
+	// The requests which are not executing under the limits are not accounted.
+	i.executingQueryRequests.Dec()
+	i.inflightQueryRequests.Add(10)
+	defer i.inflightQueryRequests.Sub(10)
+	_, err = i.QueryExemplars(user.InjectOrgID(context.Background(), "other"), req)
+	require.NoError(t, err)
+}
+
+func TestIngester_ShouldRejectPushesAboveTheMemoryAdmissionHighWatermark(t *testing.T) {
+	limits := atomic.NewPointer(&InstanceLimits{MemoryAdmissionHighWatermarkBytes: 1})
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.InstanceLimitsFn = limits.Load
+	cfg.LifecyclerConfig.JoinAfter = 0
+
+	registry := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until the ingester is ACTIVE
+	test.Poll(t, 100*time.Millisecond, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	req := generateSamplesForLabel(labels.FromStrings(labels.MetricName, "testcase"), 10)
+
+	// The heap in use is always above the high watermark of 1 byte.
+	i.memoryAdmissionGate.update()
+	_, err = i.Push(ctx, req)
+	require.Equal(t, errMemoryAdmissionRejected, err)
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_ingester_memory_admission_rejected_push_requests_total The total number of push requests rejected because the heap in use of the ingester is above the memory admission watermarks.
+		# TYPE cortex_ingester_memory_admission_rejected_push_requests_total counter
+		cortex_ingester_memory_admission_rejected_push_requests_total 1
+	`), "cortex_ingester_memory_admission_rejected_push_requests_total"))
+
+	// The push requests are accepted again once the memory admission control is disabled.
+	limits.Store(&InstanceLimits{})
+	i.memoryAdmissionGate.update()
+	_, err = i.Push(ctx, generateSamplesForLabel(labels.FromStrings(labels.MetricName, "testcase"), 10))
+	require.NoError(t, err)
+}
+
 func TestIngester_MaxExemplarsFallBack(t *testing.T) {
 	// Create ingester.
 	cfg := defaultIngesterTestConfig(t)
@@ -4479,6 +5123,65 @@ func TestIngester_MaxExemplarsFallBack(t *testing.T) {
 	require.Equal(t, maxExemplars, int64(5))
 }
 
+func TestIngester_ShouldDropExemplarsAboveTheIngestionRateLimit(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.LifecyclerConfig.JoinAfter = 0
+
+	limits := defaultLimitsTestConfig()
+	limits.MaxExemplars = 100
+	limits.MaxExemplarsIngestionRate = 0.001
+	limits.MaxExemplarsIngestionBurstSize = 2
+
+	registry := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, nil, "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until the ingester is ACTIVE
+	test.Poll(t, 100*time.Millisecond, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	push := func(ts int64, numExemplars int) {
+		exemplars := make([]cortexpb.Exemplar, 0, numExemplars)
+		for e := 0; e < numExemplars; e++ {
+			exemplars = append(exemplars, cortexpb.Exemplar{
+				Labels:      []cortexpb.LabelAdapter{{Name: "traceID", Value: strconv.Itoa(e)}},
+				TimestampMs: ts + int64(e),
+				Value:       float64(e),
+			})
+		}
+		_, err := i.Push(ctx, &cortexpb.WriteRequest{Timeseries: []cortexpb.PreallocTimeseries{{TimeSeries: &cortexpb.TimeSeries{
+			Labels:    []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "test"}},
+			Samples:   []cortexpb.Sample{{Value: 1, TimestampMs: ts}},
+			Exemplars: exemplars,
+		}}}})
+		require.NoError(t, err)
+	}
+
+	// The exemplars within the burst are ingested, the following ones are dropped while their
+	// samples are still ingested.
+	push(1000, 2)
+	push(2000, 1)
+	push(3000, 3)
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_discarded_exemplars_total The total number of exemplars that were discarded.
+		# TYPE cortex_discarded_exemplars_total counter
+		cortex_discarded_exemplars_total{reason="per_user_exemplars_rate_limit",user="test"} 4
+
+		# HELP cortex_ingester_ingested_samples_total The total number of samples ingested.
+		# TYPE cortex_ingester_ingested_samples_total counter
+		cortex_ingester_ingested_samples_total 3
+
+		# HELP cortex_ingester_ingested_exemplars_total The total number of exemplars ingested.
+		# TYPE cortex_ingester_ingested_exemplars_total counter
+		cortex_ingester_ingested_exemplars_total 2
+	`), "cortex_discarded_exemplars_total", "cortex_ingester_ingested_samples_total", "cortex_ingester_ingested_exemplars_total"))
+}
+
 func generateSamplesForLabel(l labels.Labels, count int) *cortexpb.WriteRequest {
 	var lbls = make([]labels.Labels, 0, count)
 	var samples = make([]cortexpb.Sample, 0, count)
@@ -0,0 +1,91 @@
+package ingester
+
+import (
+	"runtime"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+)
+
+// memoryAdmissionGate rejects the push requests while the heap in use is high. It starts
+// rejecting them once the heap in use reaches the high watermark, and keeps rejecting them
+// until the heap in use drops below the low watermark, so that the ingester doesn't flap
+// between accepting and rejecting the push requests around a single threshold.
+type memoryAdmissionGate struct {
+	limitsFn  func() *InstanceLimits
+	readHeap  func() uint64
+	logger    log.Logger
+	rejecting atomic.Bool
+
+	rejectedPushRequests prometheus.Counter
+}
+
+func newMemoryAdmissionGate(limitsFn func() *InstanceLimits, logger log.Logger, reg prometheus.Registerer) *memoryAdmissionGate {
+	return &memoryAdmissionGate{
+		limitsFn: limitsFn,
+		readHeap: readHeapInuse,
+		logger:   logger,
+		rejectedPushRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_memory_admission_rejected_push_requests_total",
+			Help: "The total number of push requests rejected because the heap in use of the ingester is above the memory admission watermarks.",
+		}),
+	}
+}
+
+// watermarks returns the high and low watermarks of the heap in use. The high watermark is
+// 0 if the memory admission control is disabled.
+func (g *memoryAdmissionGate) watermarks() (uint64, uint64) {
+	l := g.limitsFn()
+	if l == nil || l.MemoryAdmissionHighWatermarkBytes <= 0 {
+		return 0, 0
+	}
+
+	high, low := uint64(l.MemoryAdmissionHighWatermarkBytes), uint64(l.MemoryAdmissionLowWatermarkBytes)
+	if low <= 0 || low > high {
+		low = high
+	}
+	return high, low
+}
+
+// update reads the heap in use and starts or stops rejecting the push requests accordingly.
+func (g *memoryAdmissionGate) update() {
+	high, low := g.watermarks()
+	if high == 0 {
+		g.rejecting.Store(false)
+		return
+	}
+
+	heap := g.readHeap()
+	switch {
+	case !g.rejecting.Load() && heap >= high:
+		g.rejecting.Store(true)
+		level.Warn(g.logger).Log("msg", "heap in use reached the memory admission high watermark, rejecting the push requests", "heap_inuse_bytes", heap, "high_watermark_bytes", high)
+	case g.rejecting.Load() && heap < low:
+		g.rejecting.Store(false)
+		level.Info(g.logger).Log("msg", "heap in use dropped below the memory admission low watermark, accepting the push requests", "heap_inuse_bytes", heap, "low_watermark_bytes", low)
+	}
+}
+
+// admit returns an error if the push requests are currently rejected.
+func (g *memoryAdmissionGate) admit() error {
+	if !g.rejecting.Load() {
+		return nil
+	}
+
+	// The memory admission control may have been disabled since the last update.
+	if high, _ := g.watermarks(); high == 0 {
+		return nil
+	}
+
+	g.rejectedPushRequests.Inc()
+	return errMemoryAdmissionRejected
+}
+
+func readHeapInuse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
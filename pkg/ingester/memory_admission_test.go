@@ -0,0 +1,72 @@
+package ingester
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryAdmissionGate(t *testing.T) {
+	limits := InstanceLimits{MemoryAdmissionHighWatermarkBytes: 1000, MemoryAdmissionLowWatermarkBytes: 800}
+	heap := uint64(0)
+
+	g := newMemoryAdmissionGate(func() *InstanceLimits { return &limits }, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	g.readHeap = func() uint64 { return heap }
+
+	// The push requests are accepted below the high watermark.
+	heap = 999
+	g.update()
+	assert.NoError(t, g.admit())
+
+	// The push requests are rejected once the heap in use reaches the high watermark.
+	heap = 1000
+	g.update()
+	assert.Equal(t, errMemoryAdmissionRejected, g.admit())
+
+	// The push requests keep being rejected until the heap in use drops below the low watermark.
+	heap = 800
+	g.update()
+	assert.Equal(t, errMemoryAdmissionRejected, g.admit())
+
+	heap = 799
+	g.update()
+	assert.NoError(t, g.admit())
+
+	// The push requests keep being accepted until the heap in use reaches the high watermark again.
+	heap = 900
+	g.update()
+	assert.NoError(t, g.admit())
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(g.rejectedPushRequests))
+
+	// The push requests are accepted straight away once the memory admission control is disabled.
+	heap = 2000
+	g.update()
+	assert.Equal(t, errMemoryAdmissionRejected, g.admit())
+	limits.MemoryAdmissionHighWatermarkBytes = 0
+	assert.NoError(t, g.admit())
+	g.update()
+	assert.NoError(t, g.admit())
+}
+
+func TestMemoryAdmissionGate_ShouldUseTheHighWatermarkAsLowWatermarkIfInvalid(t *testing.T) {
+	for name, lowWatermark := range map[string]int64{"disabled": 0, "greater than the high watermark": 2000} {
+		t.Run(name, func(t *testing.T) {
+			limits := InstanceLimits{MemoryAdmissionHighWatermarkBytes: 1000, MemoryAdmissionLowWatermarkBytes: lowWatermark}
+			heap := uint64(1000)
+
+			g := newMemoryAdmissionGate(func() *InstanceLimits { return &limits }, log.NewNopLogger(), nil)
+			g.readHeap = func() uint64 { return heap }
+
+			g.update()
+			assert.Equal(t, errMemoryAdmissionRejected, g.admit())
+
+			heap = 999
+			g.update()
+			assert.NoError(t, g.admit())
+		})
+	}
+}
@@ -37,17 +37,29 @@ type ingesterMetrics struct {
 	memSeriesRemovedTotal   *prometheus.CounterVec
 	memMetadataRemovedTotal *prometheus.CounterVec
 
+	oooRecentRejectedSamples *prometheus.CounterVec
+
+	throttledQueries *prometheus.CounterVec
+
+	queriesDuringWALReplay *prometheus.CounterVec
+
+	shipperShardUploads        prometheus.Counter
+	shipperShardUploadFailures prometheus.Counter
+
 	activeSeriesPerUser     *prometheus.GaugeVec
 	activeSeriesPerLabelSet *prometheus.GaugeVec
 
+	retainedFlushedBlocksBytes *prometheus.GaugeVec
+
 	// Global limit metrics
-	maxUsersGauge           prometheus.GaugeFunc
-	maxSeriesGauge          prometheus.GaugeFunc
-	maxIngestionRate        prometheus.GaugeFunc
-	ingestionRate           prometheus.GaugeFunc
-	maxInflightPushRequests prometheus.GaugeFunc
-	inflightRequests        prometheus.GaugeFunc
-	inflightQueryRequests   prometheus.GaugeFunc
+	maxUsersGauge            prometheus.GaugeFunc
+	maxSeriesGauge           prometheus.GaugeFunc
+	maxIngestionRate         prometheus.GaugeFunc
+	ingestionRate            prometheus.GaugeFunc
+	maxInflightPushRequests  prometheus.GaugeFunc
+	maxInflightQueryRequests prometheus.GaugeFunc
+	inflightRequests         prometheus.GaugeFunc
+	inflightQueryRequests    prometheus.GaugeFunc
 }
 
 func newIngesterMetrics(r prometheus.Registerer,
@@ -137,6 +149,26 @@ func newIngesterMetrics(r prometheus.Registerer,
 			Name: "cortex_ingester_memory_metadata_removed_total",
 			Help: "The total number of metadata that were removed per user.",
 		}, []string{"user"}),
+		oooRecentRejectedSamples: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_out_of_order_recent_rejected_samples_total",
+			Help: "The total number of samples rejected for being older than the out-of-order time window by less than the out-of-order recent rejected window, per user.",
+		}, []string{"user"}),
+		throttledQueries: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_throttled_queries_total",
+			Help: "The total number of query requests rejected because the user reached the limit of concurrent queries in the ingester.",
+		}, []string{"user"}),
+		queriesDuringWALReplay: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_queries_during_wal_replay_total",
+			Help: "The total number of queries received while replaying the WAL, by the policy applied to them.",
+		}, []string{"policy"}),
+		shipperShardUploads: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_shipper_shard_uploads_total",
+			Help: "The total number of shards uploaded, for the users whose blocks are split in shards before being shipped.",
+		}),
+		shipperShardUploadFailures: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_shipper_shard_upload_failures_total",
+			Help: "The total number of shards failed to be uploaded, for the users whose blocks are split in shards before being shipped.",
+		}),
 
 		maxUsersGauge: promauto.With(r).NewGaugeFunc(prometheus.GaugeOpts{
 			Name:        instanceLimits,
@@ -182,6 +214,17 @@ func newIngesterMetrics(r prometheus.Registerer,
 			return 0
 		}),
 
+		maxInflightQueryRequests: promauto.With(r).NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        instanceLimits,
+			Help:        instanceLimitsHelp,
+			ConstLabels: map[string]string{limitLabel: "max_inflight_query_requests"},
+		}, func() float64 {
+			if g := instanceLimitsFn(); g != nil {
+				return float64(g.MaxInflightQueryRequests)
+			}
+			return 0
+		}),
+
 		ingestionRate: promauto.With(r).NewGaugeFunc(prometheus.GaugeOpts{
 			Name: "cortex_ingester_ingestion_rate_samples_per_second",
 			Help: "Current ingestion rate in samples/sec that ingester is using to limit access.",
@@ -217,6 +260,11 @@ func newIngesterMetrics(r prometheus.Registerer,
 			Help: "Number of currently active series per user and labelset.",
 		}, []string{"user", "labelset"}),
 
+		retainedFlushedBlocksBytes: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ingester_retained_flushed_blocks_bytes",
+			Help: "Size of the blocks already shipped to the storage which the ingester keeps queryable because of the per-user flushed blocks retention.",
+		}, []string{"user"}),
+
 		// Not registered automatically, but only if activeSeriesEnabled is true.
 		activeSeriesPerUser: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "cortex_ingester_active_series",
@@ -246,7 +294,10 @@ func newIngesterMetrics(r prometheus.Registerer,
 func (m *ingesterMetrics) deletePerUserMetrics(userID string) {
 	m.memMetadataCreatedTotal.DeleteLabelValues(userID)
 	m.memMetadataRemovedTotal.DeleteLabelValues(userID)
+	m.oooRecentRejectedSamples.DeleteLabelValues(userID)
+	m.throttledQueries.DeleteLabelValues(userID)
 	m.activeSeriesPerUser.DeleteLabelValues(userID)
+	m.retainedFlushedBlocksBytes.DeleteLabelValues(userID)
 
 	if m.memSeriesCreatedTotal != nil {
 		m.memSeriesCreatedTotal.DeleteLabelValues(userID)
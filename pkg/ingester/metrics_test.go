@@ -26,10 +26,11 @@ func TestIngesterMetrics(t *testing.T) {
 		true,
 		func() *InstanceLimits {
 			return &InstanceLimits{
-				MaxIngestionRate:        12,
-				MaxInMemoryTenants:      1,
-				MaxInMemorySeries:       11,
-				MaxInflightPushRequests: 6,
+				MaxIngestionRate:         12,
+				MaxInMemoryTenants:       1,
+				MaxInMemorySeries:        11,
+				MaxInflightPushRequests:  6,
+				MaxInflightQueryRequests: 7,
 			}
 		},
 		ingestionRate,
@@ -69,6 +70,7 @@ func TestIngesterMetrics(t *testing.T) {
 			# HELP cortex_ingester_instance_limits Instance limits used by this ingester.
 			# TYPE cortex_ingester_instance_limits gauge
 			cortex_ingester_instance_limits{limit="max_inflight_push_requests"} 6
+			cortex_ingester_instance_limits{limit="max_inflight_query_requests"} 7
 			cortex_ingester_instance_limits{limit="max_ingestion_rate"} 12
 			cortex_ingester_instance_limits{limit="max_series"} 11
 			cortex_ingester_instance_limits{limit="max_tenants"} 1
@@ -130,6 +132,12 @@ func TestIngesterMetrics(t *testing.T) {
 			# HELP cortex_ingester_queries_total The total number of queries the ingester has handled.
 			# TYPE cortex_ingester_queries_total counter
 			cortex_ingester_queries_total 0
+			# HELP cortex_ingester_shipper_shard_upload_failures_total The total number of shards failed to be uploaded, for the users whose blocks are split in shards before being shipped.
+			# TYPE cortex_ingester_shipper_shard_upload_failures_total counter
+			cortex_ingester_shipper_shard_upload_failures_total 0
+			# HELP cortex_ingester_shipper_shard_uploads_total The total number of shards uploaded, for the users whose blocks are split in shards before being shipped.
+			# TYPE cortex_ingester_shipper_shard_uploads_total counter
+			cortex_ingester_shipper_shard_uploads_total 0
 	`))
 	require.NoError(t, err)
 
@@ -1,9 +1,10 @@
 package ingester
 
 const (
-	sampleOutOfOrder      = "sample-out-of-order"
-	newValueForTimestamp  = "new-value-for-timestamp"
-	sampleOutOfBounds     = "sample-out-of-bounds"
-	sampleTooOld          = "sample-too-old"
-	nativeHistogramSample = "native-histogram-sample"
+	sampleOutOfOrder       = "sample-out-of-order"
+	newValueForTimestamp   = "new-value-for-timestamp"
+	sampleOutOfBounds      = "sample-out-of-bounds"
+	sampleTooOld           = "sample-too-old"
+	nativeHistogramSample  = "native-histogram-sample"
+	invalidNativeHistogram = "invalid-native-histogram"
 )
@@ -0,0 +1,254 @@
+package ingester
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/shipper"
+
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/util/concurrency"
+)
+
+// shardedShipper is a Shipper splitting each block in a number of smaller blocks by series hash,
+// and uploading them in parallel to the storage. Each block has the shard external label set to its
+// shard. When the number of shards configured for the tenant is lower than 2, the blocks are shipped
+// as they are by the upstream shipper.
+//
+// The split blocks are tracked as uploaded in the same meta file of the upstream shipper, so that
+// the ingester can delete them once shipped regardless of the shipper in use.
+type shardedShipper struct {
+	upstream           Shipper
+	logger             log.Logger
+	dir                string
+	bucket             objstore.Bucket
+	labels             func() labels.Labels
+	shards             func() int
+	uploadCompacted    func() bool
+	blockRanges        []int64
+	uploadedShards     prometheus.Counter
+	uploadShardsFailed prometheus.Counter
+}
+
+func newShardedShipper(upstream Shipper, logger log.Logger, dir string, bucket objstore.Bucket, lbls func() labels.Labels, shards func() int, uploadCompacted func() bool, blockRanges []int64, uploadedShards, uploadShardsFailed prometheus.Counter) *shardedShipper {
+	return &shardedShipper{
+		upstream:           upstream,
+		logger:             logger,
+		dir:                dir,
+		bucket:             bucket,
+		labels:             lbls,
+		shards:             shards,
+		uploadCompacted:    uploadCompacted,
+		blockRanges:        blockRanges,
+		uploadedShards:     uploadedShards,
+		uploadShardsFailed: uploadShardsFailed,
+	}
+}
+
+// Sync implements Shipper.
+func (s *shardedShipper) Sync(ctx context.Context) (uploaded int, err error) {
+	shards := s.shards()
+	if shards <= 1 {
+		return s.upstream.Sync(ctx)
+	}
+
+	metaFilePath := filepath.Join(s.dir, shipper.DefaultMetaFilename)
+	meta, err := shipper.ReadMetaFile(metaFilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(s.logger).Log("msg", "reading shipper meta file failed, will override it", "err", err)
+		}
+		meta = &shipper.Meta{Version: shipper.MetaVersion1}
+	}
+
+	hasUploaded := make(map[ulid.ULID]struct{}, len(meta.Uploaded))
+	for _, id := range meta.Uploaded {
+		hasUploaded[id] = struct{}{}
+	}
+
+	// Rebuild the uploaded blocks only with the blocks that still exist locally, like the upstream shipper.
+	meta.Uploaded = nil
+
+	metas, err := s.blockMetasFromOldest()
+	if err != nil {
+		return 0, err
+	}
+
+	uploadCompacted := s.uploadCompacted()
+	failed := 0
+
+	for _, m := range metas {
+		if _, ok := hasUploaded[m.ULID]; ok {
+			meta.Uploaded = append(meta.Uploaded, m.ULID)
+			continue
+		}
+		if m.Stats.NumSamples == 0 || (m.Compaction.Level > 1 && !uploadCompacted) {
+			continue
+		}
+
+		// A block failing to be uploaded is retried at the next sync, splitting it again. The shards
+		// already uploaded get uploaded twice, and the duplicated series are merged by the compactor.
+		if err := s.uploadSharded(ctx, m, shards); err != nil {
+			level.Error(s.logger).Log("msg", "shipping sharded block failed", "block", m.ULID, "shards", shards, "err", err)
+			failed++
+			continue
+		}
+		meta.Uploaded = append(meta.Uploaded, m.ULID)
+		uploaded++
+	}
+
+	if err := shipper.WriteMetaFile(s.logger, metaFilePath, meta); err != nil {
+		level.Warn(s.logger).Log("msg", "updating shipper meta file failed", "err", err)
+	}
+
+	if failed > 0 {
+		return uploaded, errors.Errorf("failed to sync %v blocks", failed)
+	}
+	return uploaded, nil
+}
+
+// uploadSharded splits the block in the given number of shards and uploads them in parallel.
+func (s *shardedShipper) uploadSharded(ctx context.Context, m *metadata.Meta, shards int) error {
+	level.Info(s.logger).Log("msg", "upload new block split in shards", "id", m.ULID, "shards", shards)
+
+	b, err := tsdb.OpenBlock(s.logger, filepath.Join(s.dir, m.ULID.String()), chunkenc.NewPool())
+	if err != nil {
+		return errors.Wrap(err, "open block")
+	}
+	defer b.Close()
+
+	// The shards are written in a temporary directory, so that they're not mistaken for TSDB blocks.
+	updir := filepath.Join(s.dir, "thanos", "upload", m.ULID.String()+"-shards")
+	if err := os.RemoveAll(updir); err != nil {
+		return errors.Wrap(err, "clean upload directory")
+	}
+	if err := os.MkdirAll(updir, 0750); err != nil {
+		return errors.Wrap(err, "create upload directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(updir); err != nil {
+			level.Error(s.logger).Log("msg", "failed to clean upload directory", "err", err)
+		}
+	}()
+
+	jobs := make([]interface{}, 0, shards)
+	for i := 0; i < shards; i++ {
+		jobs = append(jobs, i)
+	}
+
+	return concurrency.ForEach(ctx, jobs, shards, func(ctx context.Context, job interface{}) error {
+		shardIndex := job.(int)
+		shardID := fmt.Sprintf("%d_of_%d", shardIndex+1, shards)
+
+		compactor, err := tsdb.NewLeveledCompactor(ctx, nil, s.logger, s.blockRanges, chunkenc.NewPool(), nil)
+		if err != nil {
+			return errors.Wrap(err, "create compactor")
+		}
+
+		reader := &shardBlockReader{BlockReader: b, shardIndex: uint64(shardIndex), shardCount: uint64(shards)}
+		id, err := compactor.Write(updir, reader, m.MinTime, m.MaxTime, &m.BlockMeta)
+		if err != nil {
+			return errors.Wrapf(err, "write shard %s", shardID)
+		}
+		if id == (ulid.ULID{}) {
+			// No series belong to the shard.
+			return nil
+		}
+
+		if err := s.uploadShard(ctx, filepath.Join(updir, id.String()), shardID); err != nil {
+			s.uploadShardsFailed.Inc()
+			return errors.Wrapf(err, "upload shard %s", shardID)
+		}
+		s.uploadedShards.Inc()
+		return nil
+	})
+}
+
+func (s *shardedShipper) uploadShard(ctx context.Context, dir, shardID string) error {
+	thanosMeta := metadata.Thanos{
+		Labels:       map[string]string{cortex_tsdb.ShardExternalLabel: shardID},
+		Source:       metadata.ReceiveSource,
+		SegmentFiles: block.GetSegmentFiles(dir),
+	}
+	s.labels().Range(func(l labels.Label) {
+		thanosMeta.Labels[l.Name] = l.Value
+	})
+
+	// Each shard keeps its own ULID as compaction source, with the original block as parent, otherwise
+	// the compactor would filter out the shards as duplicates of each other.
+	if _, err := metadata.InjectThanos(s.logger, dir, thanosMeta, nil); err != nil {
+		return err
+	}
+
+	return block.Upload(ctx, s.logger, s.bucket, dir, metadata.NoneFunc)
+}
+
+// blockMetasFromOldest returns the meta of each block found in the TSDB directory, sorted by min time.
+func (s *shardedShipper) blockMetasFromOldest() ([]*metadata.Meta, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read dir")
+	}
+
+	var metas []*metadata.Meta
+	for _, entry := range entries {
+		if _, ok := block.IsBlockDir(entry.Name()); !ok || !entry.IsDir() {
+			continue
+		}
+
+		m, err := metadata.ReadFromDir(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "read metadata for block %v", entry.Name())
+		}
+		metas = append(metas, m)
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].MinTime < metas[j].MinTime
+	})
+	return metas, nil
+}
+
+// shardBlockReader is a tsdb.BlockReader exposing only the series of a block belonging to a shard.
+type shardBlockReader struct {
+	tsdb.BlockReader
+
+	shardIndex, shardCount uint64
+}
+
+func (r *shardBlockReader) Index() (tsdb.IndexReader, error) {
+	ir, err := r.BlockReader.Index()
+	if err != nil {
+		return nil, err
+	}
+	return &shardIndexReader{IndexReader: ir, shardIndex: r.shardIndex, shardCount: r.shardCount}, nil
+}
+
+type shardIndexReader struct {
+	tsdb.IndexReader
+
+	shardIndex, shardCount uint64
+}
+
+func (r *shardIndexReader) Postings(ctx context.Context, name string, values ...string) (index.Postings, error) {
+	p, err := r.IndexReader.Postings(ctx, name, values...)
+	if err != nil {
+		return nil, err
+	}
+	return r.IndexReader.ShardedPostings(p, r.shardIndex, r.shardCount), nil
+}
@@ -0,0 +1,112 @@
+package ingester
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/shipper"
+
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+)
+
+func TestShardedShipper_Sync(t *testing.T) {
+	const numSeries = 30
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	blockRange := 2 * time.Hour.Milliseconds()
+
+	// Create a block with some series in the TSDB directory.
+	w, err := tsdb.NewBlockWriter(log.NewNopLogger(), dir, blockRange)
+	require.NoError(t, err)
+	app := w.Appender(ctx)
+	for i := 0; i < numSeries; i++ {
+		_, err := app.Append(0, labels.FromStrings(labels.MetricName, "series", "i", fmt.Sprint(i)), 1000, float64(i))
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+	blockID, err := w.Flush(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	upstream := &shipperMock{}
+	upstream.On("Sync", mock.Anything).Return(0, nil)
+
+	shards := 1
+	bkt := objstore.NewInMemBucket()
+	uploads := prometheus.NewCounter(prometheus.CounterOpts{})
+	failures := prometheus.NewCounter(prometheus.CounterOpts{})
+	lbls := labels.FromStrings(cortex_tsdb.TenantIDExternalLabel, "user-1")
+
+	s := newShardedShipper(upstream, log.NewNopLogger(), dir, bkt, func() labels.Labels { return lbls }, func() int { return shards }, func() bool { return false }, []int64{blockRange}, uploads, failures)
+
+	// The blocks are shipped by the upstream shipper if sharding is disabled.
+	uploaded, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, uploaded)
+	upstream.AssertNumberOfCalls(t, "Sync", 1)
+	assert.Empty(t, bkt.Objects())
+
+	shards = 3
+	uploaded, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, uploaded)
+	upstream.AssertNumberOfCalls(t, "Sync", 1)
+	assert.Equal(t, float64(3), testutil.ToFloat64(uploads))
+	assert.Equal(t, float64(0), testutil.ToFloat64(failures))
+
+	// Each shard is uploaded as a block with the shard external label, and the series are split across them.
+	var metas []*metadata.Meta
+	require.NoError(t, bkt.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		require.True(t, ok)
+		m, err := block.DownloadMeta(ctx, log.NewNopLogger(), bkt, id)
+		require.NoError(t, err)
+		metas = append(metas, &m)
+		return nil
+	}))
+	require.Len(t, metas, 3)
+
+	totalSeries := uint64(0)
+	shardIDs := map[string]struct{}{}
+	for _, m := range metas {
+		assert.NotEqual(t, blockID, m.ULID)
+		assert.Equal(t, "user-1", m.Thanos.Labels[cortex_tsdb.TenantIDExternalLabel])
+		assert.Equal(t, metadata.ReceiveSource, m.Thanos.Source)
+		assert.Equal(t, 1, m.Compaction.Level)
+		assert.Equal(t, []ulid.ULID{m.ULID}, m.Compaction.Sources)
+		require.Len(t, m.Compaction.Parents, 1)
+		assert.Equal(t, blockID, m.Compaction.Parents[0].ULID)
+
+		shardIDs[m.Thanos.Labels[cortex_tsdb.ShardExternalLabel]] = struct{}{}
+		assert.Greater(t, m.Stats.NumSeries, uint64(0))
+		totalSeries += m.Stats.NumSeries
+	}
+	assert.Equal(t, map[string]struct{}{"1_of_3": {}, "2_of_3": {}, "3_of_3": {}}, shardIDs)
+	assert.Equal(t, uint64(numSeries), totalSeries)
+
+	// The original block is tracked as shipped, and is not shipped again.
+	shipperMeta, err := shipper.ReadMetaFile(filepath.Join(dir, shipper.DefaultMetaFilename))
+	require.NoError(t, err)
+	assert.Equal(t, []ulid.ULID{blockID}, shipperMeta.Uploaded)
+
+	uploaded, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, uploaded)
+	assert.Equal(t, float64(3), testutil.ToFloat64(uploads))
+}
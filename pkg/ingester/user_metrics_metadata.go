@@ -1,6 +1,7 @@
 package ingester
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
+const errMetricTypeConflict = "metadata of type %s conflicts with the metadata of type %s already ingested"
+
 // userMetricsMetadata allows metric metadata of a tenant to be held by the ingester.
 // Metadata is kept as a set as it can come from multiple targets that Prometheus scrapes
 // with the same metric name.
@@ -51,6 +54,13 @@ func (mm *userMetricsMetadata) add(metric string, metadata *cortexpb.MetricMetad
 		mm.metricToMetadata[metric] = set
 	}
 
+	if ok && mm.limiter.limits.RejectMetricTypeConflicts(mm.userID) {
+		if conflicting, found := set.conflictingType(metadata.Type); found {
+			mm.validateMetrics.DiscardedMetadata.WithLabelValues(metricTypeConflict, mm.userID).Inc()
+			return makeMetricLimitError(metricTypeConflict, labels.FromStrings(labels.MetricName, metric), fmt.Errorf(errMetricTypeConflict, metadata.Type, conflicting))
+		}
+	}
+
 	if err := mm.limiter.AssertMaxMetadataPerMetric(mm.userID, len(set)); err != nil {
 		mm.validateMetrics.DiscardedMetadata.WithLabelValues(mm.userID, perMetricMetadataLimit).Inc()
 		return makeMetricLimitError(perMetricMetadataLimit, labels.FromStrings(labels.MetricName, metric), mm.limiter.FormatError(mm.userID, err))
@@ -90,6 +100,7 @@ func (mm *userMetricsMetadata) toClientMetadata() []*cortexpb.MetricMetadata {
 	r := make([]*cortexpb.MetricMetadata, 0, len(mm.metricToMetadata))
 	for _, set := range mm.metricToMetadata {
 		for m := range set {
+			m := m
 			r = append(r, &m)
 		}
 	}
@@ -98,6 +109,20 @@ func (mm *userMetricsMetadata) toClientMetadata() []*cortexpb.MetricMetadata {
 
 type metricMetadataSet map[cortexpb.MetricMetadata]time.Time
 
+// conflictingType returns the type of a metadata in the set conflicting with the input type, if any.
+// The unknown type doesn't conflict with any other type.
+func (mms metricMetadataSet) conflictingType(metricType cortexpb.MetricMetadata_MetricType) (cortexpb.MetricMetadata_MetricType, bool) {
+	if metricType == cortexpb.UNKNOWN {
+		return cortexpb.UNKNOWN, false
+	}
+	for metadata := range mms {
+		if metadata.Type != cortexpb.UNKNOWN && metadata.Type != metricType {
+			return metadata.Type, true
+		}
+	}
+	return cortexpb.UNKNOWN, false
+}
+
 // If deadline is zero time, all metrics are purged.
 func (mms metricMetadataSet) purge(deadline time.Time) int {
 	var deleted int
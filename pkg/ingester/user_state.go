@@ -21,6 +21,11 @@ const (
 	perLabelsetSeriesLimit = "per_labelset_series_limit"
 )
 
+// DiscardedExemplars metric labels
+const (
+	perUserExemplarsRateLimit = "per_user_exemplars_rate_limit"
+)
+
 const numMetricCounterShards = 128
 
 type metricCounterShard struct {
@@ -0,0 +1,73 @@
+package querier
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+)
+
+// BlockSourcesHeader is the HTTP header used to restrict the blocks queried from the
+// long-term storage to the ones whose source external label matches one of the
+// comma-separated values.
+const BlockSourcesHeader = "X-Cortex-Block-Sources"
+
+type blockSourcesCtxKey struct{}
+
+var blockSourcesKey = &blockSourcesCtxKey{}
+
+// InjectBlockSources returns a derived context restricting the blocks queried from the
+// long-term storage to the ones tagged with one of the given sources.
+func InjectBlockSources(ctx context.Context, sources []string) context.Context {
+	return context.WithValue(ctx, blockSourcesKey, sources)
+}
+
+// BlockSourcesFromContext returns the block sources injected in the context, if any.
+func BlockSourcesFromContext(ctx context.Context) []string {
+	sources, _ := ctx.Value(blockSourcesKey).([]string)
+	return sources
+}
+
+// BlockSourcesMiddleware injects the block sources read from the BlockSourcesHeader,
+// if any, into the request context.
+func BlockSourcesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sources := parseBlockSources(r.Header.Get(BlockSourcesHeader)); len(sources) > 0 {
+			r = r.WithContext(InjectBlockSources(r.Context(), sources))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parseBlockSources(value string) []string {
+	var sources []string
+	for _, source := range strings.Split(value, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+
+	return sources
+}
+
+// filterBlocksBySource returns the blocks whose source is one of the given ones. Blocks
+// without a source are filtered out. If no source is given, the input blocks are returned.
+func filterBlocksBySource(blocks bucketindex.Blocks, sources []string) bucketindex.Blocks {
+	if len(sources) == 0 {
+		return blocks
+	}
+
+	filtered := make(bucketindex.Blocks, 0, len(blocks))
+	for _, b := range blocks {
+		for _, source := range sources {
+			if b.Source == source {
+				filtered = append(filtered, b)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,92 @@
+package querier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+)
+
+func TestBlockSourcesMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		header   string
+		expected []string
+	}{
+		"no header": {
+			header:   "",
+			expected: nil,
+		},
+		"single source": {
+			header:   "backfill",
+			expected: []string{"backfill"},
+		},
+		"multiple sources with spaces and empty values": {
+			header:   " ingester, ,backfill ",
+			expected: []string{"ingester", "backfill"},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var actual []string
+			handler := BlockSourcesMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				actual = BlockSourcesFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			if testData.header != "" {
+				req.Header.Set(BlockSourcesHeader, testData.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+func TestBlockSourcesFromContext(t *testing.T) {
+	assert.Nil(t, BlockSourcesFromContext(context.Background()))
+	assert.Equal(t, []string{"ingester"}, BlockSourcesFromContext(InjectBlockSources(context.Background(), []string{"ingester"})))
+}
+
+func TestFilterBlocksBySource(t *testing.T) {
+	var (
+		ingesterBlock = &bucketindex.Block{ID: ulid.MustNew(1, nil), Source: "ingester"}
+		backfillBlock = &bucketindex.Block{ID: ulid.MustNew(2, nil), Source: "backfill"}
+		unknownBlock  = &bucketindex.Block{ID: ulid.MustNew(3, nil)}
+		allBlocks     = bucketindex.Blocks{ingesterBlock, backfillBlock, unknownBlock}
+	)
+
+	tests := map[string]struct {
+		sources  []string
+		expected bucketindex.Blocks
+	}{
+		"no sources": {
+			sources:  nil,
+			expected: allBlocks,
+		},
+		"single source": {
+			sources:  []string{"backfill"},
+			expected: bucketindex.Blocks{backfillBlock},
+		},
+		"multiple sources": {
+			sources:  []string{"ingester", "backfill"},
+			expected: bucketindex.Blocks{ingesterBlock, backfillBlock},
+		},
+		"no matching source": {
+			sources:  []string{"downsampled"},
+			expected: bucketindex.Blocks{},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, filterBlocksBySource(allBlocks, testData.sources))
+		})
+	}
+}
@@ -65,6 +65,7 @@ const (
 var (
 	errNoStoreGatewayAddress  = errors.New("no store-gateway address configured")
 	errMaxChunksPerQueryLimit = "the query hit the max number of chunks limit while fetching chunks from store-gateways for %s (limit: %d)"
+	errMaxStreamedBytesLimit  = "the query hit the max number of bytes streamed by the store-gateways for %s (limit: %d bytes)"
 	defaultAggrs              = []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}
 )
 
@@ -102,12 +103,14 @@ type BlocksStoreLimits interface {
 	bucket.TenantConfigProvider
 
 	MaxChunksPerQueryFromStore(userID string) int
+	MaxStoreGatewayStreamedBytesPerQuery(userID string) int
 	StoreGatewayTenantShardSize(userID string) float64
 }
 
 type blocksStoreQueryableMetrics struct {
-	storesHit prometheus.Histogram
-	refetches prometheus.Histogram
+	storesHit        prometheus.Histogram
+	refetches        prometheus.Histogram
+	labelsFanoutWait prometheus.Histogram
 }
 
 func newBlocksStoreQueryableMetrics(reg prometheus.Registerer) *blocksStoreQueryableMetrics {
@@ -124,6 +127,12 @@ func newBlocksStoreQueryableMetrics(reg prometheus.Registerer) *blocksStoreQuery
 			Help:      "Number of re-fetches attempted while querying store-gateway instances due to missing blocks.",
 			Buckets:   []float64{0, 1, 2},
 		}),
+		labelsFanoutWait: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Namespace: "cortex",
+			Name:      "querier_storegateway_labels_fanout_wait_seconds",
+			Help:      "Time spent waiting for a free slot before sending a label names or values request to a store-gateway instance.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
 	}
 }
 
@@ -142,6 +151,10 @@ type BlocksStoreQueryable struct {
 
 	storeGatewayQueryStatsEnabled bool
 
+	// The maximum number of concurrent label names or values requests sent
+	// to store-gateways for a single query (0 means unlimited).
+	labelsFanoutConcurrency int
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -154,6 +167,7 @@ func NewBlocksStoreQueryable(
 	limits BlocksStoreLimits,
 	queryStoreAfter time.Duration,
 	storeGatewayQueryStatsEnabled bool,
+	labelsFanoutConcurrency int,
 	logger log.Logger,
 	reg prometheus.Registerer,
 ) (*BlocksStoreQueryable, error) {
@@ -173,6 +187,7 @@ func NewBlocksStoreQueryable(
 		metrics:                       newBlocksStoreQueryableMetrics(reg),
 		limits:                        limits,
 		storeGatewayQueryStatsEnabled: storeGatewayQueryStatsEnabled,
+		labelsFanoutConcurrency:       labelsFanoutConcurrency,
 	}
 
 	q.Service = services.NewBasicService(q.starting, q.running, q.stopping)
@@ -263,7 +278,7 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 		reg,
 	)
 
-	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, querierCfg.StoreGatewayQueryStatsEnabled, logger, reg)
+	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, querierCfg.StoreGatewayQueryStatsEnabled, querierCfg.StoreGatewayLabelsFanoutConcurrency, logger, reg)
 }
 
 func (q *BlocksStoreQueryable) starting(ctx context.Context) error {
@@ -308,9 +323,48 @@ func (q *BlocksStoreQueryable) Querier(mint, maxt int64) (storage.Querier, error
 		logger:                        q.logger,
 		queryStoreAfter:               q.queryStoreAfter,
 		storeGatewayQueryStatsEnabled: q.storeGatewayQueryStatsEnabled,
+		labelsFanoutConcurrency:       q.labelsFanoutConcurrency,
 	}, nil
 }
 
+// BlocksCoverUntil implements blocksCoverageChecker. The data of an ingester is covered once a block
+// shipped by the ingester reaches maxT, because the ingesters ship their blocks in order. The blocks
+// without ingester ID, like the compacted ones, don't tell which ingesters' data they hold, so they're
+// ignored. The blocks uploaded within the upload grace period are ignored too, because the
+// store-gateways may not have loaded them yet.
+func (q *BlocksStoreQueryable) BlocksCoverUntil(ctx context.Context, userID string, minT, maxT int64, ingesterIDs []string) (bool, error) {
+	if len(ingesterIDs) == 0 {
+		return false, nil
+	}
+
+	blocks, _, err := q.finder.GetBlocks(ctx, userID, minT, maxT)
+	if err != nil {
+		return false, err
+	}
+
+	covered := make(map[string]bool, len(ingesterIDs))
+	for _, b := range blocks {
+		// The block MaxTime is exclusive.
+		if b.MaxTime <= maxT {
+			continue
+		}
+		if q.consistency.uploadGracePeriod > 0 && time.Since(b.GetUploadedAt()) < q.consistency.uploadGracePeriod {
+			continue
+		}
+		if b.IngesterID == "" {
+			continue
+		}
+		covered[b.IngesterID] = true
+	}
+
+	for _, id := range ingesterIDs {
+		if !covered[id] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 type blocksStoreQuerier struct {
 	minT, maxT  int64
 	finder      BlocksFinder
@@ -327,6 +381,14 @@ type blocksStoreQuerier struct {
 	// If enabled, query stats of store gateway requests will be logged
 	// using `info` level.
 	storeGatewayQueryStatsEnabled bool
+
+	// The maximum number of concurrent label names or values requests sent
+	// to store-gateways (0 means unlimited).
+	labelsFanoutConcurrency int
+
+	// The number of bytes streamed by the store-gateways, shared by all the
+	// Series requests of the query, including the retries.
+	streamedBytes atomic.Int64
 }
 
 // Select implements storage.Querier interface.
@@ -435,21 +497,25 @@ func (q *blocksStoreQuerier) selectSorted(ctx context.Context, sp *storage.Selec
 		resSeriesSets = []storage.SeriesSet(nil)
 		resWarnings   = annotations.Annotations(nil)
 
-		maxChunksLimit  = q.limits.MaxChunksPerQueryFromStore(userID)
-		leftChunksLimit = maxChunksLimit
+		maxChunksLimit   = q.limits.MaxChunksPerQueryFromStore(userID)
+		leftChunksLimit  = maxChunksLimit
+		maxStreamedBytes = q.limits.MaxStoreGatewayStreamedBytesPerQuery(userID)
 
 		resultMtx sync.Mutex
 	)
 
 	queryFunc := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error, error) {
-		seriesSets, queriedBlocks, warnings, numChunks, err, retryableError := q.fetchSeriesFromStores(spanCtx, sp, userID, clients, minT, maxT, matchers, maxChunksLimit, leftChunksLimit)
+		storesSeries, queriedBlocks, warnings, numChunks, err, retryableError := q.fetchSeriesFromStores(spanCtx, sp, userID, clients, minT, maxT, matchers, maxChunksLimit, leftChunksLimit, maxStreamedBytes)
 		if err != nil {
 			return nil, err, retryableError
 		}
 
 		resultMtx.Lock()
 
-		resSeriesSets = append(resSeriesSets, seriesSets...)
+		for _, storeSeries := range storesSeries {
+			// TODO: change other aggregations when downsampling is enabled.
+			resSeriesSets = append(resSeriesSets, thanosquery.NewPromSeriesSet(newStoreSeriesSet(storeSeries), minT, maxT, defaultAggrs, nil))
+		}
 		resWarnings.Merge(warnings)
 
 		// Given a single block is guaranteed to not be queried twice, we can safely decrease the number of
@@ -503,6 +569,12 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 		return err
 	}
 
+	// Only query blocks from the requested sources, if any.
+	if sources := BlockSourcesFromContext(ctx); len(sources) > 0 {
+		knownBlocks = filterBlocksBySource(knownBlocks, sources)
+		level.Debug(logger).Log("msg", "filtered blocks by source", "sources", strings.Join(sources, ","), "remaining", len(knownBlocks))
+	}
+
 	if len(knownBlocks) == 0 {
 		q.metrics.storesHit.Observe(0)
 		level.Debug(logger).Log("msg", "no blocks found")
@@ -595,12 +667,13 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 	matchers []*labels.Matcher,
 	maxChunksLimit int,
 	leftChunksLimit int,
-) ([]storage.SeriesSet, []ulid.ULID, annotations.Annotations, int, error, error) {
+	maxStreamedBytes int,
+) ([][]*storepb.Series, []ulid.ULID, annotations.Annotations, int, error, error) {
 	var (
 		reqCtx        = grpc_metadata.AppendToOutgoingContext(ctx, cortex_tsdb.TenantIDExternalLabel, userID)
 		g, gCtx       = errgroup.WithContext(reqCtx)
 		mtx           = sync.Mutex{}
-		seriesSets    = []storage.SeriesSet(nil)
+		storesSeries  = [][]*storepb.Series(nil)
 		warnings      = annotations.Annotations(nil)
 		queriedBlocks = []ulid.ULID(nil)
 		numChunks     = atomic.NewInt32(0)
@@ -694,6 +767,11 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 					return errors.Wrapf(err, "failed to receive series from %s", c.RemoteAddress())
 				}
 
+				// Ensure the max number of bytes streamed by the store-gateways hasn't been reached (max == 0 means disabled).
+				if maxStreamedBytes > 0 && q.streamedBytes.Add(int64(resp.Size())) > int64(maxStreamedBytes) {
+					return validation.LimitError(fmt.Sprintf(errMaxStreamedBytesLimit, util.LabelMatchersToString(matchers), maxStreamedBytes))
+				}
+
 				// Response may either contain series, warning or hints.
 				if s := resp.GetSeries(); s != nil {
 					mySeries = append(mySeries, s)
@@ -800,8 +878,7 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 
 			// Store the result.
 			mtx.Lock()
-			// TODO: change other aggregations when downsampling is enabled.
-			seriesSets = append(seriesSets, thanosquery.NewPromSeriesSet(newStoreSeriesSet(mySeries), minT, maxT, defaultAggrs, nil))
+			storesSeries = append(storesSeries, mySeries)
 			warnings.Merge(myWarnings)
 			queriedBlocks = append(queriedBlocks, myQueriedBlocks...)
 			mtx.Unlock()
@@ -815,7 +892,7 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 		return nil, nil, nil, 0, err, merr.Err()
 	}
 
-	return seriesSets, queriedBlocks, warnings, int(numChunks.Load()), nil, merr.Err()
+	return storesSeries, queriedBlocks, warnings, int(numChunks.Load()), nil, merr.Err()
 }
 
 func (q *blocksStoreQuerier) fetchLabelNamesFromStore(
@@ -838,13 +915,20 @@ func (q *blocksStoreQuerier) fetchLabelNamesFromStore(
 		merr          = multierror.MultiError{}
 	)
 
-	// Concurrently fetch series from all clients.
+	if q.labelsFanoutConcurrency > 0 {
+		g.SetLimit(q.labelsFanoutConcurrency)
+	}
+
+	// Concurrently fetch label names from all clients, up to the configured concurrency.
 	for c, blockIDs := range clients {
 		// Change variables scope since it will be used in a goroutine.
 		c := c
 		blockIDs := blockIDs
+		queuedAt := time.Now()
 
 		g.Go(func() error {
+			q.metrics.labelsFanoutWait.Observe(time.Since(queuedAt).Seconds())
+
 			req, err := createLabelNamesRequest(minT, maxT, blockIDs, matchers)
 			if err != nil {
 				return errors.Wrapf(err, "failed to create label names request")
@@ -898,6 +982,10 @@ func (q *blocksStoreQuerier) fetchLabelNamesFromStore(
 				"requested blocks", strings.Join(convertULIDsToString(blockIDs), " "),
 				"queried blocks", strings.Join(convertULIDsToString(myQueriedBlocks), " "))
 
+			// Names are expected to be sorted, but we enforce it because the merge
+			// relies on it to deduplicate names returned by multiple store-gateways.
+			sort.Strings(namesResp.Names)
+
 			// Store the result.
 			mtx.Lock()
 			nameSets = append(nameSets, namesResp.Names)
@@ -940,13 +1028,20 @@ func (q *blocksStoreQuerier) fetchLabelValuesFromStore(
 		merr          = multierror.MultiError{}
 	)
 
-	// Concurrently fetch series from all clients.
+	if q.labelsFanoutConcurrency > 0 {
+		g.SetLimit(q.labelsFanoutConcurrency)
+	}
+
+	// Concurrently fetch label values from all clients, up to the configured concurrency.
 	for c, blockIDs := range clients {
 		// Change variables scope since it will be used in a goroutine.
 		c := c
 		blockIDs := blockIDs
+		queuedAt := time.Now()
 
 		g.Go(func() error {
+			q.metrics.labelsFanoutWait.Observe(time.Since(queuedAt).Seconds())
+
 			req, err := createLabelValuesRequest(minT, maxT, name, blockIDs, matchers...)
 			if err != nil {
 				return errors.Wrapf(err, "failed to create label values request")
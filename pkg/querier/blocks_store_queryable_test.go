@@ -61,6 +61,9 @@ func TestBlocksStoreQuerier_Select(t *testing.T) {
 		series1Label     = labels.Label{Name: "series", Value: "1"}
 		series2Label     = labels.Label{Name: "series", Value: "2"}
 		noOpQueryLimiter = limiter.NewQueryLimiter(0, 0, 0, 0)
+
+		// The size of the responses streamed by a store-gateway returning a single series and block.
+		singleSeriesStreamedBytes = mockSeriesResponse(labels.Labels{metricNameLabel, series1Label}, cortexpb.Sample{Value: 1, TimestampMs: minT}).Size() + mockHintsResponse(block1).Size()
 	)
 
 	type valueResult struct {
@@ -472,6 +475,28 @@ func TestBlocksStoreQuerier_Select(t *testing.T) {
 			queryLimiter: limiter.NewQueryLimiter(0, 0, 1, 0),
 			expectedErr:  validation.LimitError(fmt.Sprintf(limiter.ErrMaxChunksPerQueryLimit, 1)),
 		},
+		"max streamed bytes per query limit hit while fetching series from multiple store-gateways": {
+			finderResult: bucketindex.Blocks{
+				&bucketindex.Block{ID: block1},
+				&bucketindex.Block{ID: block2},
+			},
+			storeSetResponses: []interface{}{
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+						mockSeriesResponse(labels.Labels{metricNameLabel, series1Label}, cortexpb.Sample{Value: 1, TimestampMs: minT}),
+						mockHintsResponse(block1),
+					}}: {block1},
+					&storeGatewayClientMock{remoteAddr: "2.2.2.2", mockedSeriesResponses: []*storepb.SeriesResponse{
+						mockSeriesResponse(labels.Labels{metricNameLabel, series2Label}, cortexpb.Sample{Value: 2, TimestampMs: minT}),
+						mockHintsResponse(block2),
+					}}: {block2},
+				},
+			},
+			// The limit fits the responses of a single store-gateway.
+			limits:       &blocksStoreLimitsMock{maxStreamedBytesPerQuery: singleSeriesStreamedBytes},
+			queryLimiter: noOpQueryLimiter,
+			expectedErr:  validation.LimitError(fmt.Sprintf(errMaxStreamedBytesLimit, fmt.Sprintf("{__name__=%q}", metricName), singleSeriesStreamedBytes)),
+		},
 		"max chunks per query limit hit while fetching chunks during subsequent attempts": {
 			finderResult: bucketindex.Blocks{
 				&bucketindex.Block{ID: block1},
@@ -875,7 +900,7 @@ func TestBlocksStoreQuerier_Select(t *testing.T) {
 
 			// Assert on metrics (optional, only for test cases defining it).
 			if testData.expectedMetrics != "" {
-				assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics)))
+				assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics), "cortex_querier_storegateway_instances_hit_per_query", "cortex_querier_storegateway_refetches_per_query"))
 			}
 		})
 	}
@@ -1362,7 +1387,7 @@ func TestBlocksStoreQuerier_Labels(t *testing.T) {
 
 					// Assert on metrics (optional, only for test cases defining it).
 					if testData.expectedMetrics != "" {
-						assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics)))
+						assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics), "cortex_querier_storegateway_instances_hit_per_query", "cortex_querier_storegateway_refetches_per_query"))
 					}
 				}
 
@@ -1379,14 +1404,165 @@ func TestBlocksStoreQuerier_Labels(t *testing.T) {
 
 					// Assert on metrics (optional, only for test cases defining it).
 					if testData.expectedMetrics != "" {
-						assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics)))
+						assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics), "cortex_querier_storegateway_instances_hit_per_query", "cortex_querier_storegateway_refetches_per_query"))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBlocksStoreQuerier_LabelsFanoutConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const (
+		minT = int64(10)
+		maxT = int64(20)
+	)
+
+	var (
+		block1  = ulid.MustNew(1, nil)
+		block2  = ulid.MustNew(2, nil)
+		block3  = ulid.MustNew(3, nil)
+		series1 = labels.FromStrings(labels.MetricName, "metric_1", "series1", "1")
+		series2 = labels.FromStrings(labels.MetricName, "metric_2", "series2", "1")
+		series3 = labels.FromStrings(labels.MetricName, "metric_3", "series1", "2")
+	)
+
+	// Each store-gateway returns overlapping and unsorted results, to ensure
+	// the merged result is deduplicated and sorted regardless of the fan-out.
+	newClient := func(addr string, blockID ulid.ULID, series ...labels.Labels) BlocksStoreClient {
+		names := namesFromSeries(series...)
+		values := valuesFromSeries(labels.MetricName, series...)
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+		sort.Sort(sort.Reverse(sort.StringSlice(values)))
+
+		return &storeGatewayClientMock{
+			remoteAddr: addr,
+			mockedLabelNamesResponse: &storepb.LabelNamesResponse{
+				Names: names,
+				Hints: mockNamesHints(blockID),
+			},
+			mockedLabelValuesResponse: &storepb.LabelValuesResponse{
+				Values: values,
+				Hints:  mockValuesHints(blockID),
+			},
+		}
+	}
+
+	for _, concurrency := range []int{0, 1, 2} {
+		concurrency := concurrency
+
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			t.Parallel()
+
+			for _, testFunc := range []string{"LabelNames", "LabelValues"} {
+				ctx := user.InjectOrgID(context.Background(), "user-1")
+				reg := prometheus.NewPedanticRegistry()
+				stores := &blocksStoreSetMock{mockedResponses: []interface{}{
+					map[BlocksStoreClient][]ulid.ULID{
+						newClient("1.1.1.1", block1, series1, series2): {block1},
+						newClient("2.2.2.2", block2, series2, series3): {block2},
+						newClient("3.3.3.3", block3, series1, series3): {block3},
+					},
+				}}
+				finder := &blocksFinderMock{}
+				finder.On("GetBlocks", mock.Anything, "user-1", minT, maxT).Return(bucketindex.Blocks{
+					&bucketindex.Block{ID: block1},
+					&bucketindex.Block{ID: block2},
+					&bucketindex.Block{ID: block3},
+				}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+				q := &blocksStoreQuerier{
+					minT:                    minT,
+					maxT:                    maxT,
+					finder:                  finder,
+					stores:                  stores,
+					consistency:             NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+					logger:                  log.NewNopLogger(),
+					metrics:                 newBlocksStoreQueryableMetrics(reg),
+					limits:                  &blocksStoreLimitsMock{},
+					labelsFanoutConcurrency: concurrency,
+				}
+
+				switch testFunc {
+				case "LabelNames":
+					names, _, err := q.LabelNames(ctx)
+					require.NoError(t, err)
+					require.Equal(t, namesFromSeries(series1, series2, series3), names)
+				case "LabelValues":
+					values, _, err := q.LabelValues(ctx, labels.MetricName)
+					require.NoError(t, err)
+					require.Equal(t, valuesFromSeries(labels.MetricName, series1, series2, series3), values)
+				}
+
+				// The wait time should have been tracked once for each store-gateway request.
+				metrics, err := reg.Gather()
+				require.NoError(t, err)
+				found := false
+				for _, m := range metrics {
+					if m.GetName() == "cortex_querier_storegateway_labels_fanout_wait_seconds" {
+						found = true
+						assert.Equal(t, uint64(3), m.GetMetric()[0].GetHistogram().GetSampleCount())
 					}
 				}
+				assert.True(t, found)
 			}
 		})
 	}
 }
 
+func TestBlocksStoreQuerier_ShouldFilterBlocksBySource(t *testing.T) {
+	t.Parallel()
+
+	const (
+		minT = int64(10)
+		maxT = int64(20)
+	)
+
+	var (
+		ingesterBlock = ulid.MustNew(1, nil)
+		backfillBlock = ulid.MustNew(2, nil)
+		series1       = labels.FromStrings(labels.MetricName, "metric_1")
+	)
+
+	finder := &blocksFinderMock{}
+	finder.On("GetBlocks", mock.Anything, "user-1", minT, maxT).Return(bucketindex.Blocks{
+		&bucketindex.Block{ID: ingesterBlock, Source: "ingester"},
+		&bucketindex.Block{ID: backfillBlock, Source: "backfill"},
+	}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+	// The store-gateway only returns the backfill block, so the consistency check
+	// succeeds only if the ingester block has been filtered out.
+	stores := &blocksStoreSetMock{mockedResponses: []interface{}{
+		map[BlocksStoreClient][]ulid.ULID{
+			&storeGatewayClientMock{
+				remoteAddr: "1.1.1.1",
+				mockedLabelNamesResponse: &storepb.LabelNamesResponse{
+					Names: namesFromSeries(series1),
+					Hints: mockNamesHints(backfillBlock),
+				},
+			}: {backfillBlock},
+		},
+	}}
+
+	q := &blocksStoreQuerier{
+		minT:        minT,
+		maxT:        maxT,
+		finder:      finder,
+		stores:      stores,
+		consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+		logger:      log.NewNopLogger(),
+		metrics:     newBlocksStoreQueryableMetrics(nil),
+		limits:      &blocksStoreLimitsMock{},
+	}
+
+	ctx := InjectBlockSources(user.InjectOrgID(context.Background(), "user-1"), []string{"backfill"})
+	names, _, err := q.LabelNames(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, namesFromSeries(series1), names)
+}
+
 func TestBlocksStoreQuerier_SelectSortedShouldHonorQueryStoreAfter(t *testing.T) {
 
 	now := time.Now()
@@ -1577,7 +1753,7 @@ func TestBlocksStoreQuerier_PromQLExecution(t *testing.T) {
 			}
 
 			// Instance the querier that will be executed to run the query.
-			queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, false, logger, nil)
+			queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, false, 0, logger, nil)
 			require.NoError(t, err)
 			require.NoError(t, services.StartAndAwaitRunning(context.Background(), queryable))
 			defer services.StopAndAwaitTerminated(context.Background(), queryable) // nolint:errcheck
@@ -1603,6 +1779,76 @@ func TestBlocksStoreQuerier_PromQLExecution(t *testing.T) {
 	}
 }
 
+func TestBlocksStoreQueryable_BlocksCoverUntil(t *testing.T) {
+	const minT, maxT = 10, 20
+
+	tests := map[string]struct {
+		blocks   bucketindex.Blocks
+		err      error
+		expected bool
+	}{
+		"should return false if there are no blocks": {
+			blocks:   bucketindex.Blocks{},
+			expected: false,
+		},
+		"should return false if the most recent block doesn't reach max time": {
+			blocks:   bucketindex.Blocks{{ID: ulid.MustNew(1, nil), MinTime: 5, MaxTime: 20, IngesterID: "ingester-1"}},
+			expected: false,
+		},
+		"should return false if the blocks of some ingesters don't reach max time": {
+			blocks: bucketindex.Blocks{
+				{ID: ulid.MustNew(3, nil), MinTime: 15, MaxTime: 25, IngesterID: "ingester-1"},
+				{ID: ulid.MustNew(2, nil), MinTime: 5, MaxTime: 15, IngesterID: "ingester-2"},
+			},
+			expected: false,
+		},
+		"should return false if the blocks reaching max time have been uploaded within the grace period": {
+			blocks: bucketindex.Blocks{
+				{ID: ulid.MustNew(3, nil), MinTime: 15, MaxTime: 25, IngesterID: "ingester-1"},
+				{ID: ulid.MustNew(2, nil), MinTime: 15, MaxTime: 25, IngesterID: "ingester-2", UploadedAt: time.Now().Unix()},
+			},
+			expected: false,
+		},
+		"should return true if the blocks of all the ingesters reach max time": {
+			blocks: bucketindex.Blocks{
+				{ID: ulid.MustNew(3, nil), MinTime: 15, MaxTime: 25, IngesterID: "ingester-1"},
+				{ID: ulid.MustNew(2, nil), MinTime: 15, MaxTime: 25, IngesterID: "ingester-2"},
+				{ID: ulid.MustNew(1, nil), MinTime: 5, MaxTime: 15, IngesterID: "ingester-2"},
+			},
+			expected: true,
+		},
+		"should return false if only a block without ingester ID reaches max time": {
+			blocks: bucketindex.Blocks{
+				{ID: ulid.MustNew(2, nil), MinTime: 5, MaxTime: 25},
+				{ID: ulid.MustNew(1, nil), MinTime: 5, MaxTime: 15, IngesterID: "ingester-1"},
+			},
+			expected: false,
+		},
+		"should return the error if finding blocks fails": {
+			blocks: bucketindex.Blocks{},
+			err:    errors.New("failed to read bucket index"),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			finder := &blocksFinderMock{Service: services.NewIdleService(nil, nil)}
+			finder.On("GetBlocks", mock.Anything, "user-1", int64(minT), int64(maxT)).Return(testData.blocks, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), testData.err)
+
+			queryable, err := NewBlocksStoreQueryable(&blocksStoreSetMock{Service: services.NewIdleService(nil, nil)}, finder, NewBlocksConsistencyChecker(time.Hour, 0, log.NewNopLogger(), nil), &blocksStoreLimitsMock{}, 0, false, 0, log.NewNopLogger(), nil)
+			require.NoError(t, err)
+
+			covered, err := queryable.BlocksCoverUntil(context.Background(), "user-1", minT, maxT, []string{"ingester-1", "ingester-2"})
+			if testData.err != nil {
+				require.Equal(t, testData.err, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, covered)
+		})
+	}
+}
+
 type blocksStoreSetMock struct {
 	services.Service
 
@@ -1691,6 +1937,7 @@ func (m *storeGatewaySeriesClientMock) Recv() (*storepb.SeriesResponse, error) {
 
 type blocksStoreLimitsMock struct {
 	maxChunksPerQuery           int
+	maxStreamedBytesPerQuery    int
 	storeGatewayTenantShardSize float64
 }
 
@@ -1698,6 +1945,10 @@ func (m *blocksStoreLimitsMock) MaxChunksPerQueryFromStore(_ string) int {
 	return m.maxChunksPerQuery
 }
 
+func (m *blocksStoreLimitsMock) MaxStoreGatewayStreamedBytesPerQuery(_ string) int {
+	return m.maxStreamedBytesPerQuery
+}
+
 func (m *blocksStoreLimitsMock) StoreGatewayTenantShardSize(_ string) float64 {
 	return m.storeGatewayTenantShardSize
 }
@@ -0,0 +1,427 @@
+package querier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/querierpb"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// exportChunksBatchSize is the max number of series sent in a single ExportChunks response.
+const exportChunksBatchSize = 128
+
+// ChunksExportStore is a store whose series can be exported as encoded chunks.
+type ChunksExportStore interface {
+	// ExportChunks returns the encoded chunks of the series matching the matchers, overlapping
+	// the time range minT and maxT (milliseconds, both included).
+	ExportChunks(ctx context.Context, minT, maxT int64, matchers ...*labels.Matcher) ([]querierpb.ChunkSeries, error)
+}
+
+// ChunksExporter implements querierpb.QuerierServer, exporting the encoded chunks of the series from
+// the ingesters and the stores, so that they can be re-ingested elsewhere. Like for the queries, the
+// chunks of each series are merged across the ingesters and the stores before being streamed.
+type ChunksExporter struct {
+	cfg         Config
+	limits      *validation.Overrides
+	distributor Distributor
+	stores      []ChunksExportStore
+	logger      log.Logger
+}
+
+// NewChunksExporter makes a new ChunksExporter.
+func NewChunksExporter(cfg Config, limits *validation.Overrides, distributor Distributor, stores []ChunksExportStore, logger log.Logger) *ChunksExporter {
+	return &ChunksExporter{
+		cfg:         cfg,
+		limits:      limits,
+		distributor: distributor,
+		stores:      stores,
+		logger:      logger,
+	}
+}
+
+// ExportChunks implements querierpb.QuerierServer.
+func (e *ChunksExporter) ExportChunks(req *querierpb.ExportChunksRequest, stream querierpb.Querier_ExportChunksServer) error {
+	ctx := stream.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	minT, maxT := req.StartTimestampMs, req.EndTimestampMs
+	if maxT < minT {
+		return status.Error(codes.InvalidArgument, errEmptyTimeRange.Error())
+	}
+
+	matchers, err := client.FromLabelMatchers(req.Matchers)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	level.Debug(e.logger).Log("msg", "exporting chunks", "user", userID, "matchers", util.LabelMatchersToString(matchers), "start", minT, "end", maxT)
+
+	// The chunks are fetched from the ingesters and the stores under the limits of the queries.
+	ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(e.limits.MaxFetchedSeriesPerQuery(userID), e.limits.MaxFetchedChunkBytesPerQuery(userID), e.limits.MaxChunksPerQuery(userID), e.limits.MaxFetchedDataBytesPerQuery(userID)))
+
+	var (
+		g, gCtx = errgroup.WithContext(ctx)
+		series  []querierpb.ChunkSeries
+		mtx     sync.Mutex
+	)
+	add := func(s []querierpb.ChunkSeries) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		series = append(series, s...)
+	}
+
+	if ingestersMinT, ok := e.ingestersTimeRange(minT, maxT); ok {
+		g.Go(func() error {
+			resp, err := e.distributor.QueryStream(gCtx, model.Time(ingestersMinT), model.Time(maxT), matchers...)
+			if err != nil {
+				return err
+			}
+			add(ingesterSeriesToChunkSeries(resp.Chunkseries))
+			return nil
+		})
+	}
+
+	for _, s := range e.stores {
+		s := s
+		g.Go(func() error {
+			storeSeries, err := s.ExportChunks(gCtx, minT, maxT, matchers...)
+			if err != nil {
+				return err
+			}
+			add(storeSeries)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	// The chunks of the same series received from the ingesters and the stores may overlap,
+	// like the chunks of the blocks not yet compacted, or the ones not yet deleted from the ingesters.
+	merged, err := mergeChunkSeries(minT, maxT, series)
+	if err != nil {
+		return err
+	}
+
+	for len(merged) > 0 {
+		batch := merged[:min(len(merged), exportChunksBatchSize)]
+		if err := stream.Send(&querierpb.ExportChunksResponse{Series: batch}); err != nil {
+			return err
+		}
+		merged = merged[len(batch):]
+	}
+	return nil
+}
+
+// ingestersTimeRange returns the min time of the time range to query from the ingesters, and
+// whether the ingesters have to be queried at all, honoring the query ingesters within setting.
+func (e *ChunksExporter) ingestersTimeRange(minT, maxT int64) (int64, bool) {
+	if e.cfg.QueryIngestersWithin == 0 {
+		return minT, true
+	}
+
+	lookbackT := util.TimeToMillis(time.Now().Add(-e.cfg.QueryIngestersWithin))
+	return max(minT, lookbackT), maxT >= lookbackT
+}
+
+// ExportChunks implements ChunksExportStore.
+func (q *BlocksStoreQueryable) ExportChunks(ctx context.Context, minT, maxT int64, matchers ...*labels.Matcher) ([]querierpb.ChunkSeries, error) {
+	querier, err := q.Querier(minT, maxT)
+	if err != nil {
+		return nil, err
+	}
+	return querier.(*blocksStoreQuerier).exportChunks(ctx, matchers...)
+}
+
+func (q *blocksStoreQuerier) exportChunks(ctx context.Context, matchers ...*labels.Matcher) ([]querierpb.ChunkSeries, error) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spanLog, spanCtx := spanlogger.New(ctx, "blocksStoreQuerier.exportChunks")
+	defer spanLog.Span.Finish()
+
+	var (
+		result    []querierpb.ChunkSeries
+		resultErr error
+
+		maxChunksLimit   = q.limits.MaxChunksPerQueryFromStore(userID)
+		leftChunksLimit  = maxChunksLimit
+		maxStreamedBytes = q.limits.MaxStoreGatewayStreamedBytesPerQuery(userID)
+
+		resultMtx sync.Mutex
+	)
+
+	queryFunc := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error, error) {
+		storesSeries, queriedBlocks, _, numChunks, err, retryableError := q.fetchSeriesFromStores(spanCtx, nil, userID, clients, minT, maxT, matchers, maxChunksLimit, leftChunksLimit, maxStreamedBytes)
+		if err != nil {
+			return nil, err, retryableError
+		}
+
+		resultMtx.Lock()
+		defer resultMtx.Unlock()
+
+		for _, storeSeries := range storesSeries {
+			for _, s := range storeSeries {
+				series, err := storeSeriesToChunkSeries(s)
+				if err != nil {
+					resultErr = err
+					continue
+				}
+				result = append(result, series)
+			}
+		}
+
+		if maxChunksLimit > 0 {
+			leftChunksLimit -= numChunks
+		}
+
+		return queriedBlocks, nil, retryableError
+	}
+
+	if err := q.queryWithConsistencyCheck(spanCtx, spanLog, q.minT, q.maxT, userID, queryFunc); err != nil {
+		return nil, err
+	}
+	if resultErr != nil {
+		return nil, resultErr
+	}
+
+	return result, nil
+}
+
+func ingesterSeriesToChunkSeries(chunkseries []client.TimeSeriesChunk) []querierpb.ChunkSeries {
+	result := make([]querierpb.ChunkSeries, 0, len(chunkseries))
+	for _, s := range chunkseries {
+		result = append(result, querierpb.ChunkSeries{Labels: s.Labels, Chunks: s.Chunks})
+	}
+	return result
+}
+
+// storeSeriesToChunkSeries converts the raw chunks of a series received from a store-gateway to
+// the chunks encoding of the ingesters, keeping the chunks data untouched.
+func storeSeriesToChunkSeries(s *storepb.Series) (querierpb.ChunkSeries, error) {
+	series := querierpb.ChunkSeries{
+		Labels: cortexpb.FromLabelsToLabelAdapters(s.PromLabels()),
+		Chunks: make([]client.Chunk, 0, len(s.Chunks)),
+	}
+
+	for _, c := range s.Chunks {
+		// The blocks are not downsampled, so the chunks are always raw.
+		if c.Raw == nil {
+			continue
+		}
+
+		var enc encoding.Encoding
+		switch c.Raw.Type {
+		case storepb.Chunk_XOR:
+			enc = encoding.PrometheusXorChunk
+		case storepb.Chunk_HISTOGRAM:
+			enc = encoding.PrometheusHistogramChunk
+		case storepb.Chunk_FLOAT_HISTOGRAM:
+			enc = encoding.PrometheusFloatHistogramChunk
+		default:
+			return querierpb.ChunkSeries{}, fmt.Errorf("unsupported chunk encoding %s of series %s", c.Raw.Type, s.PromLabels())
+		}
+
+		series.Chunks = append(series.Chunks, client.Chunk{
+			StartTimestampMs: c.MinTime,
+			EndTimestampMs:   c.MaxTime,
+			Encoding:         int32(enc),
+			Data:             c.Raw.Data,
+		})
+	}
+
+	return series, nil
+}
+
+// mergeChunkSeries merges the series with the same labels, like the series received from multiple
+// replicas of the same store. The overlapping chunks, and the chunks not fully within the time range
+// minT and maxT (both included), are re-encoded into non-overlapping chunks within the time range,
+// while the other chunks are kept untouched. The series are sorted by labels, and their chunks by time.
+func mergeChunkSeries(minT, maxT int64, series []querierpb.ChunkSeries) ([]querierpb.ChunkSeries, error) {
+	byLabels := map[string]*querierpb.ChunkSeries{}
+	for _, s := range series {
+		key := client.LabelsToKeyString(cortexpb.FromLabelAdaptersToLabels(s.Labels))
+		existing, ok := byLabels[key]
+		if !ok {
+			existing = &querierpb.ChunkSeries{Labels: s.Labels}
+			byLabels[key] = existing
+		}
+		existing.Chunks = append(existing.Chunks, s.Chunks...)
+	}
+
+	result := make([]querierpb.ChunkSeries, 0, len(byLabels))
+	for _, s := range byLabels {
+		chunks, err := mergeChunks(minT, maxT, s.Chunks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "merging the chunks of series %s", cortexpb.FromLabelAdaptersToLabels(s.Labels))
+		}
+		if len(chunks) == 0 {
+			continue
+		}
+		s.Chunks = chunks
+		result = append(result, *s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return labels.Compare(cortexpb.FromLabelAdaptersToLabels(result[i].Labels), cortexpb.FromLabelAdaptersToLabels(result[j].Labels)) < 0
+	})
+	return result, nil
+}
+
+// mergeChunks returns the non-overlapping chunks within minT and maxT, sorted by time.
+func mergeChunks(minT, maxT int64, chunks []client.Chunk) ([]client.Chunk, error) {
+	chunks = dedupeChunks(chunks)
+
+	var result []client.Chunk
+	for len(chunks) > 0 {
+		// Group the chunks overlapping with each other.
+		size, groupMaxT := 1, chunks[0].EndTimestampMs
+		for ; size < len(chunks) && chunks[size].StartTimestampMs <= groupMaxT; size++ {
+			groupMaxT = max(groupMaxT, chunks[size].EndTimestampMs)
+		}
+		group := chunks[:size]
+		chunks = chunks[size:]
+
+		if len(group) == 1 && group[0].StartTimestampMs >= minT && group[0].EndTimestampMs <= maxT {
+			result = append(result, group[0])
+			continue
+		}
+
+		reencoded, err := reencodeChunks(minT, maxT, group)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, reencoded...)
+	}
+	return result, nil
+}
+
+// reencodeChunks merges the samples of the chunks within minT and maxT into new chunks. The samples
+// with the same timestamp in multiple chunks are deduplicated.
+func reencodeChunks(minT, maxT int64, chunks []client.Chunk) ([]client.Chunk, error) {
+	iterators := make([]chunkenc.Iterator, 0, len(chunks))
+	for _, c := range chunks {
+		chk, err := chunkenc.FromData(encoding.Encoding(c.Encoding).PromChunkEncoding(), c.Data)
+		if err != nil {
+			return nil, err
+		}
+		iterators = append(iterators, chk.Iterator(nil))
+	}
+
+	series := &storage.SeriesEntry{
+		SampleIteratorFn: func(chunkenc.Iterator) chunkenc.Iterator {
+			return &timeRangeIterator{Iterator: storage.ChainSampleIteratorFromIterators(nil, iterators), minT: minT, maxT: maxT}
+		},
+	}
+
+	var result []client.Chunk
+	it := storage.NewSeriesToChunkEncoder(series).Iterator(nil)
+	for it.Next() {
+		meta := it.At()
+		enc, err := encoding.FromPromChunkEncoding(meta.Chunk.Encoding())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, client.Chunk{
+			StartTimestampMs: meta.MinTime,
+			EndTimestampMs:   meta.MaxTime,
+			Encoding:         int32(enc),
+			Data:             meta.Chunk.Bytes(),
+		})
+	}
+	return result, it.Err()
+}
+
+// timeRangeIterator iterates the samples of the wrapped iterator within minT and maxT (both included).
+type timeRangeIterator struct {
+	chunkenc.Iterator
+
+	minT, maxT int64
+	started    bool
+}
+
+func (it *timeRangeIterator) Next() chunkenc.ValueType {
+	if !it.started {
+		return it.Seek(it.minT)
+	}
+	return it.withinMaxT(it.Iterator.Next())
+}
+
+func (it *timeRangeIterator) Seek(t int64) chunkenc.ValueType {
+	it.started = true
+	return it.withinMaxT(it.Iterator.Seek(max(t, it.minT)))
+}
+
+func (it *timeRangeIterator) withinMaxT(valType chunkenc.ValueType) chunkenc.ValueType {
+	if valType != chunkenc.ValNone && it.Iterator.AtT() > it.maxT {
+		return chunkenc.ValNone
+	}
+	return valType
+}
+
+// dedupeChunks sorts the chunks by time and removes the identical ones.
+func dedupeChunks(chunks []client.Chunk) []client.Chunk {
+	sort.Slice(chunks, func(i, j int) bool {
+		return compareChunks(chunks[i], chunks[j]) < 0
+	})
+
+	deduped := chunks[:0]
+	for i, c := range chunks {
+		if i > 0 && compareChunks(c, deduped[len(deduped)-1]) == 0 {
+			continue
+		}
+		deduped = append(deduped, c)
+	}
+	return deduped
+}
+
+func compareChunks(a, b client.Chunk) int {
+	switch {
+	case a.StartTimestampMs != b.StartTimestampMs:
+		return compareInt64(a.StartTimestampMs, b.StartTimestampMs)
+	case a.EndTimestampMs != b.EndTimestampMs:
+		return compareInt64(a.EndTimestampMs, b.EndTimestampMs)
+	case a.Encoding != b.Encoding:
+		return compareInt64(int64(a.Encoding), int64(b.Encoding))
+	default:
+		return bytes.Compare(a.Data, b.Data)
+	}
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	return 1
+}
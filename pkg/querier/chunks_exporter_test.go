@@ -0,0 +1,412 @@
+package querier
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/weaveworks/common/user"
+	"google.golang.org/grpc"
+
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/querierpb"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestMergeChunkSeries(t *testing.T) {
+	series1 := cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, "series_1"))
+	series2 := cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, "series_2"))
+
+	chunk1 := newXORChunk(t, 0, 5, 10)
+	// The same samples cut into a different chunk by another replica.
+	chunk1Overlapping := newXORChunk(t, 0, 5, 10, 15)
+	chunk2 := newXORChunk(t, 20, 25, 30)
+	chunk3 := newXORChunk(t, 40, 45)
+
+	tests := map[string]struct {
+		minT, maxT     int64
+		series         []querierpb.ChunkSeries
+		expectedValues map[string][]float64
+		expectedChunks map[string][]client.Chunk
+	}{
+		"should keep the non-overlapping chunks within the time range untouched": {
+			minT: 0,
+			maxT: 100,
+			series: []querierpb.ChunkSeries{
+				{Labels: series2, Chunks: []client.Chunk{chunk3, chunk2}},
+				{Labels: series1, Chunks: []client.Chunk{chunk2, chunk1}},
+			},
+			expectedChunks: map[string][]client.Chunk{
+				"series_1": {chunk1, chunk2},
+				"series_2": {chunk2, chunk3},
+			},
+		},
+		"should remove the identical chunks received from multiple replicas": {
+			minT: 0,
+			maxT: 100,
+			series: []querierpb.ChunkSeries{
+				{Labels: series1, Chunks: []client.Chunk{chunk2, chunk1}},
+				{Labels: series1, Chunks: []client.Chunk{chunk1, chunk2}},
+			},
+			expectedChunks: map[string][]client.Chunk{
+				"series_1": {chunk1, chunk2},
+			},
+		},
+		"should merge the overlapping chunks received from multiple replicas": {
+			minT: 0,
+			maxT: 100,
+			series: []querierpb.ChunkSeries{
+				{Labels: series1, Chunks: []client.Chunk{chunk1, chunk2}},
+				{Labels: series1, Chunks: []client.Chunk{chunk1Overlapping, chunk2}},
+			},
+			expectedValues: map[string][]float64{
+				"series_1": {0, 5, 10, 15, 20, 25, 30},
+			},
+		},
+		"should trim the chunks to the time range": {
+			minT: 5,
+			maxT: 25,
+			series: []querierpb.ChunkSeries{
+				{Labels: series1, Chunks: []client.Chunk{chunk1, chunk2}},
+				{Labels: series2, Chunks: []client.Chunk{chunk3}},
+			},
+			expectedValues: map[string][]float64{
+				"series_1": {5, 10, 20, 25},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			merged, err := mergeChunkSeries(testData.minT, testData.maxT, testData.series)
+			require.NoError(t, err)
+
+			actualValues := map[string][]float64{}
+			actualChunks := map[string][]client.Chunk{}
+			for i, s := range merged {
+				if i > 0 {
+					assert.Less(t, labels.Compare(cortexpb.FromLabelAdaptersToLabels(merged[i-1].Labels), cortexpb.FromLabelAdaptersToLabels(s.Labels)), 0)
+				}
+				for j := 1; j < len(s.Chunks); j++ {
+					assert.Less(t, s.Chunks[j-1].EndTimestampMs, s.Chunks[j].StartTimestampMs)
+				}
+
+				name := cortexpb.FromLabelAdaptersToLabels(s.Labels).Get(labels.MetricName)
+				actualValues[name] = decodeChunkValues(t, s.Chunks)
+				actualChunks[name] = s.Chunks
+			}
+
+			if testData.expectedChunks != nil {
+				assert.Equal(t, testData.expectedChunks, actualChunks)
+			}
+			if testData.expectedValues != nil {
+				assert.Equal(t, testData.expectedValues, actualValues)
+			}
+		})
+	}
+}
+
+func TestStoreSeriesToChunkSeries(t *testing.T) {
+	lbls := labels.FromStrings(labels.MetricName, "series_1")
+
+	series, err := storeSeriesToChunkSeries(&storepb.Series{
+		Labels: labelpb.ZLabelsFromPromLabels(lbls),
+		Chunks: []storepb.AggrChunk{
+			{MinTime: 0, MaxTime: 10, Raw: &storepb.Chunk{Type: storepb.Chunk_XOR, Data: []byte{1}}},
+			{MinTime: 10, MaxTime: 20, Raw: &storepb.Chunk{Type: storepb.Chunk_HISTOGRAM, Data: []byte{2}}},
+			{MinTime: 20, MaxTime: 30, Raw: &storepb.Chunk{Type: storepb.Chunk_FLOAT_HISTOGRAM, Data: []byte{3}}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, querierpb.ChunkSeries{
+		Labels: cortexpb.FromLabelsToLabelAdapters(lbls),
+		Chunks: []client.Chunk{
+			{StartTimestampMs: 0, EndTimestampMs: 10, Encoding: int32(encoding.PrometheusXorChunk), Data: []byte{1}},
+			{StartTimestampMs: 10, EndTimestampMs: 20, Encoding: int32(encoding.PrometheusHistogramChunk), Data: []byte{2}},
+			{StartTimestampMs: 20, EndTimestampMs: 30, Encoding: int32(encoding.PrometheusFloatHistogramChunk), Data: []byte{3}},
+		},
+	}, series)
+}
+
+func TestChunksExporter_ExportChunks(t *testing.T) {
+	now := time.Now()
+	series1 := cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, "series_1"))
+	series2 := cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, "series_2"))
+
+	storeChunk := newXORChunk(t, util.TimeToMillis(now.Add(-90*time.Minute)))
+	ingesterChunk := newXORChunk(t, util.TimeToMillis(now.Add(-10*time.Minute)))
+
+	store := chunksExportStoreFunc(func(_ context.Context, _, _ int64, _ ...*labels.Matcher) ([]querierpb.ChunkSeries, error) {
+		return []querierpb.ChunkSeries{
+			{Labels: series1, Chunks: []client.Chunk{storeChunk}},
+			// The same chunk is received from the ingesters, not yet deleted once shipped.
+			{Labels: series2, Chunks: []client.Chunk{ingesterChunk}},
+		}, nil
+	})
+
+	tests := map[string]struct {
+		queryIngestersWithin time.Duration
+		startTime, endTime   time.Time
+		expectedIngesterMinT time.Time
+		expectedSeries       []querierpb.ChunkSeries
+	}{
+		"should stream the chunks from the ingesters and the stores merged by series": {
+			startTime:            now.Add(-2 * time.Hour),
+			endTime:              now,
+			expectedIngesterMinT: now.Add(-2 * time.Hour),
+			expectedSeries: []querierpb.ChunkSeries{
+				{Labels: series1, Chunks: []client.Chunk{storeChunk, ingesterChunk}},
+				{Labels: series2, Chunks: []client.Chunk{ingesterChunk}},
+			},
+		},
+		"should query the ingesters within the query ingesters within setting": {
+			queryIngestersWithin: 30 * time.Minute,
+			startTime:            now.Add(-2 * time.Hour),
+			endTime:              now,
+			expectedIngesterMinT: now.Add(-30 * time.Minute),
+			expectedSeries: []querierpb.ChunkSeries{
+				{Labels: series1, Chunks: []client.Chunk{storeChunk, ingesterChunk}},
+				{Labels: series2, Chunks: []client.Chunk{ingesterChunk}},
+			},
+		},
+		"should not query the ingesters before the query ingesters within setting": {
+			queryIngestersWithin: 30 * time.Minute,
+			startTime:            now.Add(-2 * time.Hour),
+			endTime:              now.Add(-time.Hour),
+			expectedSeries: []querierpb.ChunkSeries{
+				{Labels: series1, Chunks: []client.Chunk{storeChunk}},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			distributor := &MockDistributor{}
+			distributor.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&client.QueryStreamResponse{
+				Chunkseries: []client.TimeSeriesChunk{
+					// The same chunk is received from multiple ingesters.
+					{Labels: series1, Chunks: []client.Chunk{ingesterChunk, ingesterChunk}},
+					{Labels: series2, Chunks: []client.Chunk{ingesterChunk}},
+				},
+			}, nil)
+
+			cfg := Config{QueryIngestersWithin: testData.queryIngestersWithin}
+			exporter := NewChunksExporter(cfg, newChunksExporterOverrides(t, 0), distributor, []ChunksExportStore{store}, log.NewNopLogger())
+
+			matchers, err := client.ToQueryRequest(0, 0, []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "series_.*")})
+			require.NoError(t, err)
+
+			stream := &exportChunksServerMock{ctx: user.InjectOrgID(context.Background(), "user-1")}
+			require.NoError(t, exporter.ExportChunks(&querierpb.ExportChunksRequest{
+				StartTimestampMs: util.TimeToMillis(testData.startTime),
+				EndTimestampMs:   util.TimeToMillis(testData.endTime),
+				Matchers:         matchers.Matchers,
+			}, stream))
+
+			var actualSeries []querierpb.ChunkSeries
+			for _, resp := range stream.responses {
+				actualSeries = append(actualSeries, resp.Series...)
+			}
+			assert.Equal(t, testData.expectedSeries, actualSeries)
+
+			if testData.expectedIngesterMinT.IsZero() {
+				distributor.AssertNotCalled(t, "QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			require.Len(t, distributor.Calls, 1)
+			assert.InDelta(t, util.TimeToMillis(testData.expectedIngesterMinT), int64(distributor.Calls[0].Arguments.Get(1).(model.Time)), float64(5*time.Second.Milliseconds()))
+		})
+	}
+}
+
+func TestChunksExporter_ExportChunksShouldApplyTheQueryLimits(t *testing.T) {
+	// The ingesters and the stores enforce the limits through the query limiter in the context.
+	fetchChunks := func(ctx context.Context) error {
+		return limiter.QueryLimiterFromContextWithFallback(ctx).AddChunks(2)
+	}
+
+	var distributorErr error
+	distributor := &MockDistributor{}
+	distributor.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		distributorErr = fetchChunks(args.Get(0).(context.Context))
+	}).Return(&client.QueryStreamResponse{}, nil)
+	store := chunksExportStoreFunc(func(ctx context.Context, _, _ int64, _ ...*labels.Matcher) ([]querierpb.ChunkSeries, error) {
+		return nil, fetchChunks(ctx)
+	})
+
+	exporter := NewChunksExporter(Config{}, newChunksExporterOverrides(t, 1), distributor, []ChunksExportStore{store}, log.NewNopLogger())
+	stream := &exportChunksServerMock{ctx: user.InjectOrgID(context.Background(), "user-1")}
+	err := exporter.ExportChunks(&querierpb.ExportChunksRequest{StartTimestampMs: 0, EndTimestampMs: 10}, stream)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the query hit the max number of chunks limit")
+	require.Error(t, distributorErr)
+	assert.Contains(t, distributorErr.Error(), "the query hit the max number of chunks limit")
+}
+
+func TestChunksExporter_ExportChunksShouldSendTheSeriesInBatches(t *testing.T) {
+	var storeSeries []querierpb.ChunkSeries
+	for i := 0; i < exportChunksBatchSize+1; i++ {
+		storeSeries = append(storeSeries, querierpb.ChunkSeries{
+			Labels: cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, "series", "index", strconv.Itoa(i))),
+			Chunks: []client.Chunk{newXORChunk(t, 5)},
+		})
+	}
+
+	store := chunksExportStoreFunc(func(_ context.Context, _, _ int64, _ ...*labels.Matcher) ([]querierpb.ChunkSeries, error) {
+		return storeSeries, nil
+	})
+
+	distributor := &MockDistributor{}
+	distributor.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&client.QueryStreamResponse{}, nil)
+
+	exporter := NewChunksExporter(Config{}, newChunksExporterOverrides(t, 0), distributor, []ChunksExportStore{store}, log.NewNopLogger())
+	stream := &exportChunksServerMock{ctx: user.InjectOrgID(context.Background(), "user-1")}
+	require.NoError(t, exporter.ExportChunks(&querierpb.ExportChunksRequest{StartTimestampMs: 0, EndTimestampMs: 10}, stream))
+
+	require.Len(t, stream.responses, 2)
+	assert.Len(t, stream.responses[0].Series, exportChunksBatchSize)
+	assert.Len(t, stream.responses[1].Series, 1)
+}
+
+func TestBlocksStoreQuerier_ExportChunks(t *testing.T) {
+	const (
+		metricName = "test_metric"
+		minT       = int64(10)
+		maxT       = int64(20)
+	)
+
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	series1 := labels.FromStrings(labels.MetricName, metricName, "series", "1")
+	series2 := labels.FromStrings(labels.MetricName, metricName, "series", "2")
+
+	// The same series are received from multiple store-gateways, because of the blocks replication.
+	stores := &blocksStoreSetMock{mockedResponses: []interface{}{
+		map[BlocksStoreClient][]ulid.ULID{
+			&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+				mockSeriesResponse(series1, cortexpb.Sample{Value: 1, TimestampMs: minT}),
+				mockSeriesResponse(series2, cortexpb.Sample{Value: 2, TimestampMs: minT}),
+				mockHintsResponse(block1),
+			}}: {block1},
+			&storeGatewayClientMock{remoteAddr: "2.2.2.2", mockedSeriesResponses: []*storepb.SeriesResponse{
+				mockSeriesResponse(series1, cortexpb.Sample{Value: 1, TimestampMs: minT}, cortexpb.Sample{Value: 3, TimestampMs: maxT}),
+				mockHintsResponse(block2),
+			}}: {block2},
+		},
+	}}
+
+	finder := &blocksFinderMock{}
+	finder.On("GetBlocks", mock.Anything, "user-1", minT, maxT).Return(bucketindex.Blocks{
+		&bucketindex.Block{ID: block1},
+		&bucketindex.Block{ID: block2},
+	}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+	q := &blocksStoreQuerier{
+		minT:        minT,
+		maxT:        maxT,
+		finder:      finder,
+		stores:      stores,
+		consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+		logger:      log.NewNopLogger(),
+		metrics:     newBlocksStoreQueryableMetrics(nil),
+		limits:      &blocksStoreLimitsMock{},
+	}
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	series, err := q.exportChunks(ctx, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metricName))
+	require.NoError(t, err)
+
+	merged, err := mergeChunkSeries(minT, maxT, series)
+	require.NoError(t, err)
+	require.Len(t, merged, 2)
+	assert.Equal(t, series1, cortexpb.FromLabelAdaptersToLabels(merged[0].Labels))
+	assert.Equal(t, []float64{1, 3}, decodeChunkValues(t, merged[0].Chunks))
+	assert.Equal(t, series2, cortexpb.FromLabelAdaptersToLabels(merged[1].Labels))
+	assert.Equal(t, []float64{2}, decodeChunkValues(t, merged[1].Chunks))
+}
+
+func newXORChunk(t *testing.T, timestamps ...int64) client.Chunk {
+	chk := chunkenc.NewXORChunk()
+	app, err := chk.Appender()
+	require.NoError(t, err)
+	for _, ts := range timestamps {
+		app.Append(ts, float64(ts))
+	}
+
+	return client.Chunk{
+		StartTimestampMs: timestamps[0],
+		EndTimestampMs:   timestamps[len(timestamps)-1],
+		Encoding:         int32(encoding.PrometheusXorChunk),
+		Data:             chk.Bytes(),
+	}
+}
+
+func newChunksExporterOverrides(t *testing.T, maxChunksPerQuery int) *validation.Overrides {
+	limits := DefaultLimitsConfig()
+	limits.MaxChunksPerQuery = maxChunksPerQuery
+
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+	return overrides
+}
+
+func decodeChunkValues(t *testing.T, chunks []client.Chunk) []float64 {
+	var values []float64
+	for _, c := range chunks {
+		require.Equal(t, int32(encoding.PrometheusXorChunk), c.Encoding)
+
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+		require.NoError(t, err)
+
+		it := chk.Iterator(nil)
+		for it.Next() != chunkenc.ValNone {
+			_, v := it.At()
+			values = append(values, v)
+		}
+		require.NoError(t, it.Err())
+	}
+	return values
+}
+
+type chunksExportStoreFunc func(ctx context.Context, minT, maxT int64, matchers ...*labels.Matcher) ([]querierpb.ChunkSeries, error)
+
+func (f chunksExportStoreFunc) ExportChunks(ctx context.Context, minT, maxT int64, matchers ...*labels.Matcher) ([]querierpb.ChunkSeries, error) {
+	return f(ctx, minT, maxT, matchers...)
+}
+
+type exportChunksServerMock struct {
+	grpc.ServerStream
+
+	ctx       context.Context
+	responses []*querierpb.ExportChunksResponse
+}
+
+func (m *exportChunksServerMock) Send(resp *querierpb.ExportChunksResponse) error {
+	m.responses = append(m.responses, resp)
+	return nil
+}
+
+func (m *exportChunksServerMock) Context() context.Context {
+	return m.ctx
+}
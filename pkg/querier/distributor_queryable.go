@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
@@ -17,6 +18,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/chunkcompat"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
@@ -36,12 +38,39 @@ type Distributor interface {
 	MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error)
 }
 
-func newDistributorQueryable(distributor Distributor, streamingMetdata bool, iteratorFn chunkIteratorFunc, queryIngestersWithin time.Duration) QueryableWithFilter {
+// blocksCoverageChecker checks whether the blocks storage has the data of a tenant.
+type blocksCoverageChecker interface {
+	// BlocksCoverUntil returns whether the storage has blocks for the user, overlapping the time range
+	// minT and maxT (milliseconds, both included), whose data reaches maxT for all the given ingesters,
+	// and which the store-gateways are expected to have loaded.
+	BlocksCoverUntil(ctx context.Context, userID string, minT, maxT int64, ingesterIDs []string) (bool, error)
+}
+
+// ingesterIDsGetter returns the IDs of the ingesters queried for a tenant.
+type ingesterIDsGetter interface {
+	GetIngesterIDsForQuery(ctx context.Context) ([]string, error)
+}
+
+// storeGatewayPreference configures the ingesters to not be queried for the time range
+// covered by both the ingesters and the store-gateways, as long as the storage has the
+// blocks covering it.
+type storeGatewayPreference struct {
+	queryStoreAfter time.Duration
+	coverage        blocksCoverageChecker
+	ingesters       ingesterIDsGetter
+
+	// Counts the queries sent to the ingesters for the overlapping time range because the
+	// storage doesn't have the blocks covering it.
+	fallbacks prometheus.Counter
+}
+
+func newDistributorQueryable(distributor Distributor, streamingMetdata bool, iteratorFn chunkIteratorFunc, queryIngestersWithin time.Duration, preference *storeGatewayPreference) QueryableWithFilter {
 	return distributorQueryable{
 		distributor:          distributor,
 		streamingMetdata:     streamingMetdata,
 		iteratorFn:           iteratorFn,
 		queryIngestersWithin: queryIngestersWithin,
+		preference:           preference,
 	}
 }
 
@@ -50,6 +79,7 @@ type distributorQueryable struct {
 	streamingMetdata     bool
 	iteratorFn           chunkIteratorFunc
 	queryIngestersWithin time.Duration
+	preference           *storeGatewayPreference
 }
 
 func (d distributorQueryable) Querier(mint, maxt int64) (storage.Querier, error) {
@@ -60,6 +90,7 @@ func (d distributorQueryable) Querier(mint, maxt int64) (storage.Querier, error)
 		streamingMetadata:    d.streamingMetdata,
 		chunkIterFn:          d.iteratorFn,
 		queryIngestersWithin: d.queryIngestersWithin,
+		preference:           d.preference,
 	}, nil
 }
 
@@ -74,6 +105,7 @@ type distributorQuerier struct {
 	streamingMetadata    bool
 	chunkIterFn          chunkIteratorFunc
 	queryIngestersWithin time.Duration
+	preference           *storeGatewayPreference
 }
 
 // Select implements storage.Querier interface.
@@ -106,6 +138,14 @@ func (q *distributorQuerier) Select(ctx context.Context, sortSeries bool, sp *st
 		}
 	}
 
+	if q.preference != nil {
+		minT = q.preferStoreGateway(ctx, log, minT, maxT)
+		if minT > maxT {
+			level.Debug(log).Log("msg", "empty query time range after preferring the store-gateways")
+			return storage.EmptySeriesSet()
+		}
+	}
+
 	// In the recent versions of Prometheus, we pass in the hint but with Func set to "series".
 	// See: https://github.com/prometheus/prometheus/pull/8050
 	if sp != nil && sp.Func == "series" {
@@ -129,6 +169,39 @@ func (q *distributorQuerier) Select(ctx context.Context, sortSeries bool, sp *st
 	return q.streamingSelect(ctx, sortSeries, minT, maxT, matchers)
 }
 
+// preferStoreGateway returns the min time of the query to ingesters, manipulated to not query the
+// time range which is also queried from the store-gateways, if the storage has the blocks covering it.
+// Otherwise the ingesters are queried for the whole time range, as a safety fallback.
+func (q *distributorQuerier) preferStoreGateway(ctx context.Context, log *spanlogger.SpanLogger, minT, maxT int64) int64 {
+	storeMaxT := util.TimeToMillis(time.Now().Add(-q.preference.queryStoreAfter))
+	if minT > storeMaxT {
+		// The query doesn't overlap with the time range queried from the store-gateways.
+		return minT
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return minT
+	}
+
+	// The ingesters must have all shipped the blocks covering the time range, otherwise
+	// the data not shipped yet by some of them would be missing from the query results.
+	ingesterIDs, err := q.preference.ingesters.GetIngesterIDsForQuery(ctx)
+	covered := false
+	if err == nil {
+		covered, err = q.preference.coverage.BlocksCoverUntil(ctx, userID, minT, storeMaxT, ingesterIDs)
+	}
+	if err != nil || !covered {
+		q.preference.fallbacks.Inc()
+		level.Debug(log).Log("msg", "querying ingesters for the time range overlapping with the store-gateways, because the storage doesn't have the blocks covering it", "err", err)
+		return minT
+	}
+
+	// The store-gateways are queried up until storeMaxT included.
+	level.Debug(log).Log("msg", "the min time of the query to ingesters has been manipulated to prefer the store-gateways", "original", minT, "updated", storeMaxT+1)
+	return storeMaxT + 1
+}
+
 func (q *distributorQuerier) streamingSelect(ctx context.Context, sortSeries bool, minT, maxT int64, matchers []*labels.Matcher) storage.SeriesSet {
 	results, err := q.distributor.QueryStream(ctx, model.Time(minT), model.Time(maxT), matchers...)
 	if err != nil {
@@ -2,10 +2,13 @@ package querier
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
@@ -90,7 +93,7 @@ func TestDistributorQuerier_SelectShouldHonorQueryIngestersWithin(t *testing.T)
 				distributor.On("MetricsForLabelMatchersStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]model.Metric{}, nil)
 
 				ctx := user.InjectOrgID(context.Background(), "test")
-				queryable := newDistributorQueryable(distributor, streamingMetadataEnabled, nil, testData.queryIngestersWithin)
+				queryable := newDistributorQueryable(distributor, streamingMetadataEnabled, nil, testData.queryIngestersWithin, nil)
 				querier, err := queryable.Querier(testData.queryMinT, testData.queryMaxT)
 				require.NoError(t, err)
 
@@ -125,11 +128,109 @@ func TestDistributorQuerier_SelectShouldHonorQueryIngestersWithin(t *testing.T)
 	}
 }
 
+func TestDistributorQuerier_SelectShouldPreferStoreGatewayForOverlappingData(t *testing.T) {
+	now := time.Now()
+
+	tests := map[string]struct {
+		queryMinT         int64
+		queryMaxT         int64
+		blocksCovered     bool
+		blocksCoverageErr error
+		ingesterIDsErr    error
+		expectedMinT      int64
+		expectedFallbacks float64
+	}{
+		"should not manipulate query time range if the query doesn't overlap with the store-gateways": {
+			queryMinT:     util.TimeToMillis(now.Add(-5 * time.Minute)),
+			queryMaxT:     util.TimeToMillis(now),
+			blocksCovered: true,
+			expectedMinT:  util.TimeToMillis(now.Add(-5 * time.Minute)),
+		},
+		"should manipulate query time range if the storage has the blocks covering the overlapping time range": {
+			queryMinT:     util.TimeToMillis(now.Add(-50 * time.Minute)),
+			queryMaxT:     util.TimeToMillis(now),
+			blocksCovered: true,
+			expectedMinT:  util.TimeToMillis(now.Add(-10 * time.Minute)),
+		},
+		"should fallback to query the whole time range if the storage doesn't have the blocks covering the overlapping time range": {
+			queryMinT:         util.TimeToMillis(now.Add(-50 * time.Minute)),
+			queryMaxT:         util.TimeToMillis(now),
+			blocksCovered:     false,
+			expectedMinT:      util.TimeToMillis(now.Add(-50 * time.Minute)),
+			expectedFallbacks: 1,
+		},
+		"should fallback to query the whole time range if the ingesters can't be listed": {
+			queryMinT:         util.TimeToMillis(now.Add(-50 * time.Minute)),
+			queryMaxT:         util.TimeToMillis(now),
+			blocksCovered:     true,
+			ingesterIDsErr:    errors.New("empty ring"),
+			expectedMinT:      util.TimeToMillis(now.Add(-50 * time.Minute)),
+			expectedFallbacks: 1,
+		},
+		"should fallback to query the whole time range if the blocks coverage check fails": {
+			queryMinT:         util.TimeToMillis(now.Add(-50 * time.Minute)),
+			queryMaxT:         util.TimeToMillis(now),
+			blocksCoverageErr: errors.New("failed to read bucket index"),
+			expectedMinT:      util.TimeToMillis(now.Add(-50 * time.Minute)),
+			expectedFallbacks: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			distributor := &MockDistributor{}
+			distributor.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&client.QueryStreamResponse{}, nil)
+
+			fallbacks := prometheus.NewCounter(prometheus.CounterOpts{})
+			preference := &storeGatewayPreference{
+				queryStoreAfter: 10 * time.Minute,
+				coverage:        &mockBlocksCoverageChecker{covered: testData.blocksCovered, err: testData.blocksCoverageErr},
+				ingesters:       &mockIngesterIDsGetter{ids: []string{"ingester-1", "ingester-2"}, err: testData.ingesterIDsErr},
+				fallbacks:       fallbacks,
+			}
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			queryable := newDistributorQueryable(distributor, false, nil, time.Hour, preference)
+			querier, err := queryable.Querier(testData.queryMinT, testData.queryMaxT)
+			require.NoError(t, err)
+
+			seriesSet := querier.Select(ctx, true, nil)
+			require.NoError(t, seriesSet.Err())
+
+			require.Len(t, distributor.Calls, 1)
+			assert.InDelta(t, testData.expectedMinT, int64(distributor.Calls[0].Arguments.Get(1).(model.Time)), float64(5*time.Second.Milliseconds()))
+			assert.Equal(t, testData.queryMaxT, int64(distributor.Calls[0].Arguments.Get(2).(model.Time)))
+			assert.Equal(t, testData.expectedFallbacks, testutil.ToFloat64(fallbacks))
+		})
+	}
+}
+
+type mockBlocksCoverageChecker struct {
+	covered bool
+	err     error
+}
+
+func (m *mockBlocksCoverageChecker) BlocksCoverUntil(_ context.Context, _ string, _, _ int64, _ []string) (bool, error) {
+	return m.covered, m.err
+}
+
+type mockIngesterIDsGetter struct {
+	ids []string
+	err error
+}
+
+func (m *mockIngesterIDsGetter) GetIngesterIDsForQuery(_ context.Context) ([]string, error) {
+	return m.ids, m.err
+}
+
 func TestDistributorQueryableFilter(t *testing.T) {
 	t.Parallel()
 
 	d := &MockDistributor{}
-	dq := newDistributorQueryable(d, false, nil, 1*time.Hour)
+	dq := newDistributorQueryable(d, false, nil, 1*time.Hour, nil)
 
 	now := time.Now()
 
@@ -179,7 +280,7 @@ func TestIngesterStreaming(t *testing.T) {
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, true, batch.NewChunkMergeIterator, 0)
+	queryable := newDistributorQueryable(d, true, batch.NewChunkMergeIterator, 0, nil)
 	querier, err := queryable.Querier(mint, maxt)
 	require.NoError(t, err)
 
@@ -220,7 +321,7 @@ func TestDistributorQuerier_LabelNames(t *testing.T) {
 			d.On("MetricsForLabelMatchersStream", mock.Anything, model.Time(mint), model.Time(maxt), someMatchers).
 				Return(metrics, nil)
 
-			queryable := newDistributorQueryable(d, streamingEnabled, nil, 0)
+			queryable := newDistributorQueryable(d, streamingEnabled, nil, 0, nil)
 			querier, err := queryable.Querier(mint, maxt)
 			require.NoError(t, err)
 
@@ -0,0 +1,119 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// NewInvalidValuesFilterQueryable returns a queryable filtering the Inf and NaN samples from the
+// series selected for the PromQL functions configured for the tenant. The function is the one
+// the PromQL engine applies directly to the selected series, as set in the select hints.
+func NewInvalidValuesFilterQueryable(q storage.Queryable, limits *validation.Overrides) storage.Queryable {
+	return invalidValuesFilterQueryable{Queryable: q, limits: limits}
+}
+
+type invalidValuesFilterQueryable struct {
+	storage.Queryable
+	limits *validation.Overrides
+}
+
+func (q invalidValuesFilterQueryable) Querier(mint, maxt int64) (storage.Querier, error) {
+	querier, err := q.Queryable.Querier(mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return invalidValuesFilterQuerier{Querier: querier, limits: q.limits}, nil
+}
+
+type invalidValuesFilterQuerier struct {
+	storage.Querier
+	limits *validation.Overrides
+}
+
+// Select implements storage.Querier.
+func (q invalidValuesFilterQuerier) Select(ctx context.Context, sortSeries bool, sp *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	set := q.Querier.Select(ctx, sortSeries, sp, matchers...)
+	if sp == nil || sp.Func == "" {
+		return set
+	}
+
+	// The wrapped querier fails on its own if the tenant is missing.
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return set
+	}
+	if !slices.Contains(q.limits.QueryInvalidValuesFilteredFunctions(userID), sp.Func) {
+		return set
+	}
+	return filterInvalidValues(set, sp.Func)
+}
+
+// filterInvalidValues returns the series of the set without their Inf and NaN float samples, with
+// a warning if any sample has been filtered. The series are loaded in memory, so that the warning
+// is known before the series are iterated. The series with native histogram samples are kept as
+// they are.
+func filterInvalidValues(set storage.SeriesSet, function string) storage.SeriesSet {
+	var (
+		result   []storage.Series
+		filtered int
+	)
+	for set.Next() {
+		s := set.At()
+		samples, n, ok := filterSeriesInvalidValues(s)
+		if !ok || n == 0 {
+			result = append(result, s)
+			continue
+		}
+		result = append(result, series.NewConcreteSeries(s.Labels(), samples))
+		filtered += n
+	}
+	if err := set.Err(); err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	warnings := set.Warnings()
+	if filtered > 0 {
+		warnings = warnings.Add(fmt.Errorf("%d Inf or NaN samples have been filtered from the input of %s", filtered, function))
+	}
+
+	return series.NewSeriesSetWithWarnings(series.NewConcreteSeriesSet(false, result), warnings)
+}
+
+// filterSeriesInvalidValues returns the float samples of the series which aren't Inf or NaN, and
+// the number of samples filtered. It returns false if the series has native histogram samples.
+func filterSeriesInvalidValues(s storage.Series) ([]model.SamplePair, int, bool) {
+	var (
+		samples  []model.SamplePair
+		filtered int
+	)
+	it := s.Iterator(nil)
+	for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+		if vt != chunkenc.ValFloat {
+			return nil, 0, false
+		}
+		t, v := it.At()
+		// The staleness markers are NaN, but they're not values.
+		if math.IsInf(v, 0) || (math.IsNaN(v) && !value.IsStaleNaN(v)) {
+			filtered++
+			continue
+		}
+		samples = append(samples, model.SamplePair{Timestamp: model.Time(t), Value: model.SampleValue(v)})
+	}
+	if it.Err() != nil {
+		// Let the engine get the error from the series.
+		return nil, 0, false
+	}
+	return samples, filtered, true
+}
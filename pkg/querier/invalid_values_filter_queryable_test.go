@@ -0,0 +1,97 @@
+package querier
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestInvalidValuesFilterQueryable(t *testing.T) {
+	matrix := model.Matrix{
+		{
+			Metric: model.Metric{"__name__": "latency", "instance": "a"},
+			Values: []model.SamplePair{{Timestamp: 0, Value: 1}, {Timestamp: 60000, Value: model.SampleValue(math.Inf(1))}},
+		},
+		{
+			Metric: model.Metric{"__name__": "latency", "instance": "b"},
+			Values: []model.SamplePair{{Timestamp: 0, Value: 2}, {Timestamp: 60000, Value: model.SampleValue(math.NaN())}},
+		},
+		{
+			Metric: model.Metric{"__name__": "latency", "instance": "c"},
+			Values: []model.SamplePair{{Timestamp: 0, Value: 3}, {Timestamp: 60000, Value: 4}},
+		},
+		{
+			Metric: model.Metric{"__name__": "latency", "instance": "d"},
+			Values: []model.SamplePair{{Timestamp: 0, Value: 5}, {Timestamp: 60000, Value: model.SampleValue(math.Float64frombits(value.StaleNaN))}},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		functions        []string
+		query            string
+		expected         float64
+		expectedWarnings []string
+	}{
+		"no filtered functions": {
+			query:    "sum(max_over_time(latency[5m]))",
+			expected: math.Inf(1),
+		},
+		"filtered aggregation": {
+			functions:        []string{"sum"},
+			query:            "sum(latency)",
+			expected:         1 + 2 + 4,
+			expectedWarnings: []string{"2 Inf or NaN samples have been filtered from the input of sum"},
+		},
+		"filtered function": {
+			functions:        []string{"max_over_time"},
+			query:            "sum(max_over_time(latency[5m]))",
+			expected:         1 + 2 + 4 + 5,
+			expectedWarnings: []string{"2 Inf or NaN samples have been filtered from the input of max_over_time"},
+		},
+		"only the function applied to the series is filtered": {
+			functions: []string{"sum"},
+			query:     "sum(max_over_time(latency[5m]))",
+			expected:  math.Inf(1),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			limits := DefaultLimitsConfig()
+			limits.QueryInvalidValuesFilteredFunctions = tc.functions
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			queryable := NewInvalidValuesFilterQueryable(storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
+				return mockQuerier{matrix: matrix}, nil
+			}), overrides)
+
+			engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1000, Timeout: time.Minute, LookbackDelta: 5 * time.Minute})
+			query, err := engine.NewInstantQuery(context.Background(), queryable, nil, tc.query, time.Unix(60, 0))
+			require.NoError(t, err)
+
+			res := query.Exec(user.InjectOrgID(context.Background(), "user-1"))
+			require.NoError(t, res.Err)
+
+			vector, err := res.Vector()
+			require.NoError(t, err)
+			require.Len(t, vector, 1)
+			assert.Equal(t, tc.expected, vector[0].F)
+
+			var warnings []string
+			for _, w := range res.Warnings {
+				warnings = append(warnings, w.Error())
+			}
+			assert.Equal(t, tc.expectedWarnings, warnings)
+		})
+	}
+}
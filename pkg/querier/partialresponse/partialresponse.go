@@ -0,0 +1,93 @@
+package partialresponse
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Header is the header of the responses truncated by a limit, holding the reasons of the
+// truncation.
+const Header = "X-Cortex-Partial-Response"
+
+type contextKey int
+
+var ctxKey = contextKey(0)
+
+// Tracker tracks the reasons why the response of a request is partial.
+type Tracker struct {
+	mtx     sync.Mutex
+	reasons []string
+}
+
+// ContextWithTracker returns a context with an empty Tracker.
+func ContextWithTracker(ctx context.Context) (*Tracker, context.Context) {
+	t := &Tracker{}
+	return t, context.WithValue(ctx, ctxKey, t)
+}
+
+// FromContext gets the Tracker out of the context. Returns nil if there is none.
+func FromContext(ctx context.Context) *Tracker {
+	t, _ := ctx.Value(ctxKey).(*Tracker)
+	return t
+}
+
+// Add marks the response of the request as partial, for the reason. It's a no-op if the
+// context has no Tracker.
+func Add(ctx context.Context, reason string) {
+	t := FromContext(ctx)
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.reasons = append(t.reasons, reason)
+}
+
+// Reasons returns the reasons why the response is partial, empty if it isn't.
+func (t *Tracker) Reasons() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return append([]string(nil), t.reasons...)
+}
+
+// Middleware sets the Header of the partial responses.
+type Middleware struct{}
+
+// NewMiddleware makes a new Middleware.
+func NewMiddleware() Middleware {
+	return Middleware{}
+}
+
+// Wrap implements middleware.Interface.
+func (m Middleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ctx := ContextWithTracker(r.Context())
+		next.ServeHTTP(&responseWriter{ResponseWriter: w, tracker: t}, r.WithContext(ctx))
+	})
+}
+
+// responseWriter sets the Header before the headers are written.
+type responseWriter struct {
+	http.ResponseWriter
+	tracker     *Tracker
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if reasons := w.tracker.Reasons(); len(reasons) > 0 {
+			w.Header().Set(Header, strings.Join(reasons, "; "))
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,73 @@
+package partialresponse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdd(t *testing.T) {
+	// It's a no-op without a tracker in the context.
+	Add(context.Background(), "ignored")
+
+	tracker, ctx := ContextWithTracker(context.Background())
+	assert.Empty(t, tracker.Reasons())
+
+	Add(ctx, "first")
+	Add(ctx, "second")
+	assert.Equal(t, []string{"first", "second"}, tracker.Reasons())
+	assert.Same(t, tracker, FromContext(ctx))
+}
+
+func TestMiddleware(t *testing.T) {
+	for name, tc := range map[string]struct {
+		handler        http.HandlerFunc
+		expectedHeader string
+		expectedStatus int
+	}{
+		"complete response": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		"partial response": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				Add(r.Context(), "first")
+				Add(r.Context(), "second")
+				_, _ = w.Write([]byte("ok"))
+			},
+			expectedHeader: "first; second",
+			expectedStatus: http.StatusOK,
+		},
+		"partial response with explicit status code": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				Add(r.Context(), "first")
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expectedHeader: "first",
+			expectedStatus: http.StatusAccepted,
+		},
+		"reason added after the headers are written": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				Add(r.Context(), "ignored")
+			},
+			expectedStatus: http.StatusOK,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/query_exemplars", nil)
+			require.NoError(t, err)
+
+			NewMiddleware().Wrap(tc.handler).ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			assert.Equal(t, tc.expectedHeader, rec.Header().Get(Header))
+		})
+	}
+}
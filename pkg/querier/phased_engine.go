@@ -0,0 +1,292 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	queryPhasePlanning = "planning"
+	queryPhaseFanOut   = "fan-out"
+	queryPhaseMerge    = "merge"
+)
+
+type queryPhasesContextKey int
+
+const queryPhasesKey queryPhasesContextKey = 0
+
+// phaseTimeoutError returns the error of a query exceeding the time budget of a phase. It's a
+// promql.ErrQueryTimeout, so that it's handled like any other query timeout by the API.
+func phaseTimeoutError(phase string, budget time.Duration) error {
+	return promql.ErrQueryTimeout(fmt.Sprintf("%s phase (time budget: %s)", phase, budget))
+}
+
+type queryPhaseMetrics struct {
+	duration *prometheus.HistogramVec
+	timeouts *prometheus.CounterVec
+}
+
+func newQueryPhaseMetrics(reg prometheus.Registerer) *queryPhaseMetrics {
+	return &queryPhaseMetrics{
+		duration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cortex_querier_query_phase_duration_seconds",
+			Help:    "Time spent by the queries in each phase of their execution.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"phase"}),
+		timeouts: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_query_phase_timeouts_total",
+			Help: "Total number of queries failed because a phase of their execution exceeded its time budget.",
+		}, []string{"phase"}),
+	}
+}
+
+// phasedEngine is a promql.QueryEngine bounding the time spent by each query in the planning,
+// fan-out and merge phases to a slice of the query timeout, so that a slow phase can't eat the
+// budget of the other ones. A budget of 0 leaves the phase unbounded.
+//
+// The fan-out phase is the time spent fetching the series from the storage, while the merge phase
+// is the time spent evaluating the query once all the series have been fetched.
+type phasedEngine struct {
+	promql.QueryEngine
+
+	planningBudget time.Duration
+	fanOutBudget   time.Duration
+	mergeBudget    time.Duration
+	metrics        *queryPhaseMetrics
+}
+
+func newPhasedEngine(engine promql.QueryEngine, cfg Config, reg prometheus.Registerer) *phasedEngine {
+	budget := func(ratio float64) time.Duration {
+		return time.Duration(ratio * float64(cfg.Timeout))
+	}
+
+	return &phasedEngine{
+		QueryEngine:    engine,
+		planningBudget: budget(cfg.PlanningTimeoutRatio),
+		fanOutBudget:   budget(cfg.FanOutTimeoutRatio),
+		mergeBudget:    budget(cfg.MergeTimeoutRatio),
+		metrics:        newQueryPhaseMetrics(reg),
+	}
+}
+
+// NewInstantQuery implements promql.QueryEngine.
+func (e *phasedEngine) NewInstantQuery(ctx context.Context, q storage.Queryable, opts promql.QueryOpts, qs string, ts time.Time) (promql.Query, error) {
+	return e.plan(func() (promql.Query, error) {
+		return e.QueryEngine.NewInstantQuery(ctx, q, opts, qs, ts)
+	})
+}
+
+// NewRangeQuery implements promql.QueryEngine.
+func (e *phasedEngine) NewRangeQuery(ctx context.Context, q storage.Queryable, opts promql.QueryOpts, qs string, start, end time.Time, interval time.Duration) (promql.Query, error) {
+	return e.plan(func() (promql.Query, error) {
+		return e.QueryEngine.NewRangeQuery(ctx, q, opts, qs, start, end, interval)
+	})
+}
+
+func (e *phasedEngine) plan(create func() (promql.Query, error)) (promql.Query, error) {
+	start := time.Now()
+	qry, err := create()
+	elapsed := time.Since(start)
+	e.metrics.duration.WithLabelValues(queryPhasePlanning).Observe(elapsed.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	// The query parsing can't be interrupted, so the planning budget is checked once it's done.
+	if e.planningBudget > 0 && elapsed > e.planningBudget {
+		qry.Close()
+		e.metrics.timeouts.WithLabelValues(queryPhasePlanning).Inc()
+		return nil, phaseTimeoutError(queryPhasePlanning, e.planningBudget)
+	}
+	return &phasedQuery{Query: qry, engine: e}, nil
+}
+
+type phasedQuery struct {
+	promql.Query
+
+	engine *phasedEngine
+}
+
+// Exec implements promql.Query.
+func (q *phasedQuery) Exec(ctx context.Context) *promql.Result {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	phases := newQueryPhases(q.engine.fanOutBudget, q.engine.mergeBudget, cancel)
+	res := q.Query.Exec(context.WithValue(ctx, queryPhasesKey, phases))
+	fanOut, merge, exceeded := phases.finish()
+
+	q.engine.metrics.duration.WithLabelValues(queryPhaseFanOut).Observe(fanOut.Seconds())
+	q.engine.metrics.duration.WithLabelValues(queryPhaseMerge).Observe(merge.Seconds())
+
+	if res.Err != nil && exceeded != "" {
+		q.engine.metrics.timeouts.WithLabelValues(exceeded).Inc()
+		budget := q.engine.fanOutBudget
+		if exceeded == queryPhaseMerge {
+			budget = q.engine.mergeBudget
+		}
+		res.Err = phaseTimeoutError(exceeded, budget)
+	}
+	return res
+}
+
+// queryPhases tracks the phases of a query execution. The series are fetched by the Select calls,
+// which the engine may run concurrently: the fan-out phase lasts until the last one is done, and
+// the merge phase lasts from then to the end of the execution.
+type queryPhases struct {
+	start        time.Time
+	fanOutBudget time.Duration
+	mergeBudget  time.Duration
+	cancel       context.CancelFunc
+
+	mtx        sync.Mutex
+	inflight   int
+	fanOutEnd  time.Time
+	mergeTimer *time.Timer
+	finished   bool
+	exceeded   string
+}
+
+func newQueryPhases(fanOutBudget, mergeBudget time.Duration, cancel context.CancelFunc) *queryPhases {
+	p := &queryPhases{
+		start:        time.Now(),
+		fanOutBudget: fanOutBudget,
+		mergeBudget:  mergeBudget,
+		cancel:       cancel,
+	}
+
+	// The evaluation of a query not fetching any series is accounted as merge.
+	p.mtx.Lock()
+	p.startMergeLocked()
+	p.mtx.Unlock()
+	return p
+}
+
+func queryPhasesFromContext(ctx context.Context) *queryPhases {
+	p, _ := ctx.Value(queryPhasesKey).(*queryPhases)
+	return p
+}
+
+// fanOutDeadline returns the time by which the series must have been fetched, if bounded.
+func (p *queryPhases) fanOutDeadline() (time.Time, bool) {
+	return p.start.Add(p.fanOutBudget), p.fanOutBudget > 0
+}
+
+func (p *queryPhases) startFanOut() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.inflight++
+	if p.mergeTimer != nil {
+		p.mergeTimer.Stop()
+		p.mergeTimer = nil
+	}
+}
+
+func (p *queryPhases) finishFanOut() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.inflight--
+	p.fanOutEnd = time.Now()
+	if p.inflight == 0 {
+		p.startMergeLocked()
+	}
+}
+
+// exceed records the phase which exceeded its budget, if no other phase did before.
+func (p *queryPhases) exceed(phase string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.exceeded == "" && !p.finished {
+		p.exceeded = phase
+	}
+}
+
+// startMergeLocked bounds the merge phase to its budget, canceling the query execution once
+// exceeded. Must be called with the lock held.
+func (p *queryPhases) startMergeLocked() {
+	if p.mergeBudget <= 0 || p.finished {
+		return
+	}
+
+	p.mergeTimer = time.AfterFunc(p.mergeBudget, func() {
+		p.exceed(queryPhaseMerge)
+		p.cancel()
+	})
+}
+
+// finish ends the tracking of the phases, returning the time spent in the fan-out and merge
+// phases, and the phase which exceeded its budget, if any.
+func (p *queryPhases) finish() (fanOut, merge time.Duration, exceeded string) {
+	end := time.Now()
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.finished = true
+	if p.mergeTimer != nil {
+		p.mergeTimer.Stop()
+		p.mergeTimer = nil
+	}
+
+	fanOutEnd := p.fanOutEnd
+	if fanOutEnd.IsZero() {
+		fanOutEnd = p.start
+	}
+	return fanOutEnd.Sub(p.start), end.Sub(fanOutEnd), p.exceeded
+}
+
+// phasedQueryable is a storage.Queryable bounding the Select calls to the fan-out phase budget
+// of the query, when executed by the phasedEngine.
+type phasedQueryable struct {
+	storage.Queryable
+}
+
+func (q phasedQueryable) Querier(mint, maxt int64) (storage.Querier, error) {
+	querier, err := q.Queryable.Querier(mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return phasedQuerier{Querier: querier}, nil
+}
+
+type phasedQuerier struct {
+	storage.Querier
+}
+
+// Select implements storage.Querier.
+func (q phasedQuerier) Select(ctx context.Context, sortSeries bool, sp *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	phases := queryPhasesFromContext(ctx)
+	if phases == nil {
+		return q.Querier.Select(ctx, sortSeries, sp, matchers...)
+	}
+
+	phases.startFanOut()
+	defer phases.finishFanOut()
+
+	deadline, ok := phases.fanOutDeadline()
+	if !ok {
+		return q.Querier.Select(ctx, sortSeries, sp, matchers...)
+	}
+
+	// The series are fetched by the Select call, so the context can be canceled once it returns.
+	fanOutCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	set := q.Querier.Select(fanOutCtx, sortSeries, sp, matchers...)
+	if ctx.Err() == nil && fanOutCtx.Err() == context.DeadlineExceeded {
+		phases.exceed(queryPhaseFanOut)
+		return storage.ErrSeriesSet(phaseTimeoutError(queryPhaseFanOut, phases.fanOutBudget))
+	}
+	return set
+}
@@ -0,0 +1,150 @@
+package querier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhasedEngine(t *testing.T) {
+	cfg := Config{Timeout: time.Second, PlanningTimeoutRatio: 0.1, FanOutTimeoutRatio: 0.2, MergeTimeoutRatio: 0.3}
+	require.NoError(t, cfg.Validate())
+
+	// The series are fetched within the fan-out budget, then the merge phase waits to be canceled.
+	fetchThenWait := func(ctx context.Context, q storage.Queryable) *promql.Result {
+		querier, err := q.Querier(0, 1)
+		require.NoError(t, err)
+		if set := querier.Select(ctx, false, nil); set.Err() != nil {
+			return &promql.Result{Err: set.Err()}
+		}
+		<-ctx.Done()
+		return &promql.Result{Err: ctx.Err()}
+	}
+
+	tests := map[string]struct {
+		planningDelay time.Duration
+		selectDelay   time.Duration
+		exec          func(ctx context.Context, q storage.Queryable) *promql.Result
+		expectedErr   error
+		expectedPhase string
+	}{
+		"should succeed if every phase is within its budget": {
+			exec: func(ctx context.Context, q storage.Queryable) *promql.Result {
+				querier, err := q.Querier(0, 1)
+				require.NoError(t, err)
+				return &promql.Result{Err: querier.Select(ctx, false, nil).Err()}
+			},
+		},
+		"should fail the planning phase exceeding its budget": {
+			planningDelay: 200 * time.Millisecond,
+			expectedErr:   promql.ErrQueryTimeout("planning phase (time budget: 100ms)"),
+			expectedPhase: queryPhasePlanning,
+		},
+		"should fail the fan-out phase exceeding its budget": {
+			selectDelay:   time.Minute,
+			exec:          fetchThenWait,
+			expectedErr:   promql.ErrQueryTimeout("fan-out phase (time budget: 200ms)"),
+			expectedPhase: queryPhaseFanOut,
+		},
+		"should fail the merge phase exceeding its budget": {
+			selectDelay:   100 * time.Millisecond,
+			exec:          fetchThenWait,
+			expectedErr:   promql.ErrQueryTimeout("merge phase (time budget: 300ms)"),
+			expectedPhase: queryPhaseMerge,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			reg := prometheus.NewPedanticRegistry()
+			engine := newPhasedEngine(&mockQueryEngine{delay: testData.planningDelay, exec: testData.exec}, cfg, reg)
+			queryable := phasedQueryable{Queryable: &delayedQueryable{delay: testData.selectDelay}}
+
+			qry, err := engine.NewInstantQuery(context.Background(), queryable, nil, "up", time.Now())
+			if err == nil {
+				err = qry.Exec(context.Background()).Err
+			}
+			assert.Equal(t, testData.expectedErr, err)
+
+			for _, phase := range []string{queryPhasePlanning, queryPhaseFanOut, queryPhaseMerge} {
+				expected := 0
+				if testData.expectedPhase == phase {
+					expected = 1
+				}
+				assert.Equal(t, float64(expected), testutil.ToFloat64(engine.metrics.timeouts.WithLabelValues(phase)), phase)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidatePhaseTimeoutRatios(t *testing.T) {
+	for _, cfg := range []Config{
+		{PlanningTimeoutRatio: -0.1},
+		{FanOutTimeoutRatio: 1.5},
+		{PlanningTimeoutRatio: 0.2, FanOutTimeoutRatio: 0.5, MergeTimeoutRatio: 0.5},
+	} {
+		assert.Equal(t, errInvalidPhaseTimeoutRatios, cfg.Validate())
+	}
+}
+
+type mockQueryEngine struct {
+	delay time.Duration
+	exec  func(ctx context.Context, q storage.Queryable) *promql.Result
+}
+
+func (e *mockQueryEngine) NewInstantQuery(_ context.Context, q storage.Queryable, _ promql.QueryOpts, _ string, _ time.Time) (promql.Query, error) {
+	time.Sleep(e.delay)
+	return &mockQuery{queryable: q, exec: e.exec}, nil
+}
+
+func (e *mockQueryEngine) NewRangeQuery(ctx context.Context, q storage.Queryable, opts promql.QueryOpts, qs string, start, _ time.Time, _ time.Duration) (promql.Query, error) {
+	return e.NewInstantQuery(ctx, q, opts, qs, start)
+}
+
+type mockQuery struct {
+	promql.Query
+
+	queryable storage.Queryable
+	exec      func(ctx context.Context, q storage.Queryable) *promql.Result
+}
+
+func (q *mockQuery) Exec(ctx context.Context) *promql.Result {
+	return q.exec(ctx, q.queryable)
+}
+
+func (q *mockQuery) Close() {}
+
+// delayedQueryable returns a querier taking the given delay to select the series.
+type delayedQueryable struct {
+	delay time.Duration
+}
+
+func (q *delayedQueryable) Querier(int64, int64) (storage.Querier, error) {
+	return &delayedQuerier{Querier: storage.NoopQuerier(), delay: q.delay}, nil
+}
+
+type delayedQuerier struct {
+	storage.Querier
+
+	delay time.Duration
+}
+
+func (q *delayedQuerier) Select(ctx context.Context, _ bool, _ *storage.SelectHints, _ ...*labels.Matcher) storage.SeriesSet {
+	select {
+	case <-time.After(q.delay):
+		return storage.EmptySeriesSet()
+	case <-ctx.Done():
+		return storage.ErrSeriesSet(ctx.Err())
+	}
+}
@@ -54,6 +54,9 @@ type Config struct {
 	QueryStoreAfter    time.Duration `yaml:"query_store_after"`
 	MaxQueryIntoFuture time.Duration `yaml:"max_query_into_future"`
 
+	// Experimental. Don't query ingesters for the time range also queried from the store-gateways.
+	PreferStoreGatewayForOverlappingData bool `yaml:"prefer_store_gateway_for_overlapping_data"`
+
 	// The default evaluation interval for the promql engine.
 	// Needs to be configured for subqueries to work as it is the default
 	// step if not specified.
@@ -76,6 +79,14 @@ type Config struct {
 	StoreGatewayClient            ClientConfig `yaml:"store_gateway_client"`
 	StoreGatewayQueryStatsEnabled bool         `yaml:"store_gateway_query_stats"`
 
+	// The maximum number of concurrent label names or values requests sent to
+	// store-gateways for a single query.
+	StoreGatewayLabelsFanoutConcurrency int `yaml:"store_gateway_labels_fanout_concurrency"`
+
+	// The maximum number of concurrent label names or values requests sent to
+	// ingesters for a single query.
+	IngesterLabelsFanoutConcurrency int `yaml:"ingester_labels_fanout_concurrency"`
+
 	ShuffleShardingIngestersLookbackPeriod time.Duration `yaml:"shuffle_sharding_ingesters_lookback_period"`
 
 	// Experimental. Use https://github.com/thanos-io/promql-engine rather than
@@ -84,12 +95,24 @@ type Config struct {
 
 	// Ignore max query length check at Querier.
 	IgnoreMaxQueryLength bool `yaml:"ignore_max_query_length"`
+
+	// Experimental. Slices of the query timeout allocated to each phase of the query execution.
+	PlanningTimeoutRatio float64 `yaml:"planning_timeout_ratio"`
+	FanOutTimeoutRatio   float64 `yaml:"fan_out_timeout_ratio"`
+	MergeTimeoutRatio    float64 `yaml:"merge_timeout_ratio"`
+
+	// Experimental. Serve the ExportChunks gRPC method.
+	ChunksExportEnabled bool `yaml:"chunks_export_enabled"`
 }
 
 var (
 	errBadLookbackConfigs                             = errors.New("bad settings, query_store_after >= query_ingesters_within which can result in queries not being sent")
 	errShuffleShardingLookbackLessThanQueryStoreAfter = errors.New("the shuffle-sharding lookback period should be greater or equal than the configured 'query store after'")
 	errEmptyTimeRange                                 = errors.New("empty time range")
+	errNegativeLabelsFanoutConcurrency                = errors.New("the store-gateway labels fan-out concurrency must be greater than or equal to 0")
+	errNegativeIngesterLabelsFanoutConcurrency        = errors.New("the ingester labels fan-out concurrency must be greater than or equal to 0")
+	errPreferStoreGatewayWithoutQueryStoreAfter       = errors.New("preferring the store-gateways for overlapping data requires 'query store after' to be configured")
+	errInvalidPhaseTimeoutRatios                      = errors.New("the query phases timeout ratios must be between 0 and 1, and their sum must not exceed 1")
 )
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -115,14 +138,21 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.MaxQueryIntoFuture, "querier.max-query-into-future", 10*time.Minute, "Maximum duration into the future you can query. 0 to disable.")
 	f.DurationVar(&cfg.DefaultEvaluationInterval, "querier.default-evaluation-interval", time.Minute, "The default evaluation interval or step size for subqueries.")
 	f.DurationVar(&cfg.QueryStoreAfter, "querier.query-store-after", 0, "The time after which a metric should be queried from storage and not just ingesters. 0 means all queries are sent to store. When running the blocks storage, if this option is enabled, the time range of the query sent to the store will be manipulated to ensure the query end is not more recent than 'now - query-store-after'.")
+	f.BoolVar(&cfg.PreferStoreGatewayForOverlappingData, "querier.prefer-store-gateway-for-overlapping-data", false, "[Experimental] If enabled, ingesters are not queried for the time range which is also queried from the store-gateways, between 'now - query-ingesters-within' and 'now - query-store-after', as long as every ingester queried for the tenant has shipped the blocks covering it, and the store-gateways have had the time to load them (consistency delay + 3 times the bucket store sync interval since the upload). Otherwise, ingesters are queried for the whole time range as a safety fallback. Requires -querier.query-store-after to be configured.")
 	f.StringVar(&cfg.ActiveQueryTrackerDir, "querier.active-query-tracker-dir", "./active-query-tracker", "Active query tracker monitors active queries, and writes them to the file in given directory. If Cortex discovers any queries in this log during startup, it will log them to the log file. Setting to empty value disables active query tracker, which also disables -querier.max-concurrent option.")
 	f.StringVar(&cfg.StoreGatewayAddresses, "querier.store-gateway-addresses", "", "Comma separated list of store-gateway addresses in DNS Service Discovery format. This option should be set when using the blocks storage and the store-gateway sharding is disabled (when enabled, the store-gateway instances form a ring and addresses are picked from the ring).")
 	f.BoolVar(&cfg.StoreGatewayQueryStatsEnabled, "querier.store-gateway-query-stats-enabled", true, "If enabled, store gateway query stats will be logged using `info` log level.")
+	f.IntVar(&cfg.StoreGatewayLabelsFanoutConcurrency, "querier.store-gateway-labels-fanout-concurrency", 0, "The maximum number of concurrent label names or values requests sent to store-gateways for a single query. Results are merged and deduplicated once all requests complete. 0 means unlimited.")
+	f.IntVar(&cfg.IngesterLabelsFanoutConcurrency, "querier.ingester-labels-fanout-concurrency", 0, "The maximum number of concurrent label names or values requests sent to ingesters for a single query. Results are merged and deduplicated once all requests complete. 0 means unlimited.")
 	f.DurationVar(&cfg.LookbackDelta, "querier.lookback-delta", 5*time.Minute, "Time since the last sample after which a time series is considered stale and ignored by expression evaluations.")
 	f.DurationVar(&cfg.ShuffleShardingIngestersLookbackPeriod, "querier.shuffle-sharding-ingesters-lookback-period", 0, "When distributor's sharding strategy is shuffle-sharding and this setting is > 0, queriers fetch in-memory series from the minimum set of required ingesters, selecting only ingesters which may have received series since 'now - lookback period'. The lookback period should be greater or equal than the configured 'query store after' and 'query ingesters within'. If this setting is 0, queriers always query all ingesters (ingesters shuffle sharding on read path is disabled).")
 	f.BoolVar(&cfg.ThanosEngine, "querier.thanos-engine", false, "Experimental. Use Thanos promql engine https://github.com/thanos-io/promql-engine rather than the Prometheus promql engine.")
 	f.Int64Var(&cfg.MaxSubQuerySteps, "querier.max-subquery-steps", 0, "Max number of steps allowed for every subquery expression in query. Number of steps is calculated using subquery range / step. A value > 0 enables it.")
 	f.BoolVar(&cfg.IgnoreMaxQueryLength, "querier.ignore-max-query-length", false, "If enabled, ignore max query length check at Querier select method. Users can choose to ignore it since the validation can be done before Querier evaluation like at Query Frontend or Ruler.")
+	f.Float64Var(&cfg.PlanningTimeoutRatio, "querier.planning-timeout-ratio", 0, "[Experimental] Fraction of the query timeout allocated to the planning phase of a query, during which the query is parsed and prepared. A query exceeding it fails with a timeout error. 0 to disable.")
+	f.Float64Var(&cfg.FanOutTimeoutRatio, "querier.fan-out-timeout-ratio", 0, "[Experimental] Fraction of the query timeout allocated to the fan-out phase of a query, during which the series are fetched from ingesters and store-gateways. A query exceeding it fails with a timeout error. 0 to disable.")
+	f.Float64Var(&cfg.MergeTimeoutRatio, "querier.merge-timeout-ratio", 0, "[Experimental] Fraction of the query timeout allocated to the merge phase of a query, during which the fetched series are evaluated, starting once they have all been fetched. A query exceeding it fails with a timeout error. 0 to disable.")
+	f.BoolVar(&cfg.ChunksExportEnabled, "querier.chunks-export-enabled", false, "[Experimental] If enabled, the querier serves the ExportChunks gRPC method, streaming the encoded chunks of the series matching the label matchers and time range, so that they can be re-ingested elsewhere. The chunks of each series are merged across the ingesters, the stores and their replicas, and trimmed to the time range. The query limits apply.")
 }
 
 // Validate the config
@@ -140,9 +170,38 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.StoreGatewayLabelsFanoutConcurrency < 0 {
+		return errNegativeLabelsFanoutConcurrency
+	}
+
+	if cfg.IngesterLabelsFanoutConcurrency < 0 {
+		return errNegativeIngesterLabelsFanoutConcurrency
+	}
+
+	if cfg.PreferStoreGatewayForOverlappingData && cfg.QueryStoreAfter == 0 {
+		return errPreferStoreGatewayWithoutQueryStoreAfter
+	}
+
+	ratios := []float64{cfg.PlanningTimeoutRatio, cfg.FanOutTimeoutRatio, cfg.MergeTimeoutRatio}
+	sum := 0.0
+	for _, ratio := range ratios {
+		if ratio < 0 || ratio > 1 {
+			return errInvalidPhaseTimeoutRatios
+		}
+		sum += ratio
+	}
+	if sum > 1 {
+		return errInvalidPhaseTimeoutRatios
+	}
+
 	return nil
 }
 
+// phaseTimeoutsEnabled returns whether the time spent by the queries in any phase is bounded.
+func (cfg *Config) phaseTimeoutsEnabled() bool {
+	return cfg.PlanningTimeoutRatio > 0 || cfg.FanOutTimeoutRatio > 0 || cfg.MergeTimeoutRatio > 0
+}
+
 func (cfg *Config) GetStoreGatewayAddresses() []string {
 	if cfg.StoreGatewayAddresses == "" {
 		return nil
@@ -159,7 +218,24 @@ func getChunksIteratorFunction(_ Config) chunkIteratorFunc {
 func New(cfg Config, limits *validation.Overrides, distributor Distributor, stores []QueryableWithFilter, reg prometheus.Registerer, logger log.Logger) (storage.SampleAndChunkQueryable, storage.ExemplarQueryable, promql.QueryEngine) {
 	iteratorFunc := getChunksIteratorFunction(cfg)
 
-	distributorQueryable := newDistributorQueryable(distributor, cfg.IngesterMetadataStreaming, iteratorFunc, cfg.QueryIngestersWithin)
+	var preference *storeGatewayPreference
+	if cfg.PreferStoreGatewayForOverlappingData {
+		coverage := findBlocksCoverageChecker(stores)
+		ingesters, ok := distributor.(ingesterIDsGetter)
+		if coverage != nil && ok {
+			preference = &storeGatewayPreference{
+				queryStoreAfter: cfg.QueryStoreAfter,
+				coverage:        coverage,
+				ingesters:       ingesters,
+				fallbacks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+					Name: "cortex_querier_store_gateway_preference_fallbacks_total",
+					Help: "Total number of queries sent to ingesters for the time range overlapping with the store-gateways, because the storage didn't have the blocks covering it.",
+				}),
+			}
+		}
+	}
+
+	distributorQueryable := newDistributorQueryable(distributor, cfg.IngesterMetadataStreaming, iteratorFunc, cfg.QueryIngestersWithin, preference)
 
 	ns := make([]QueryableWithFilter, len(stores))
 	for ix, s := range stores {
@@ -169,6 +245,9 @@ func New(cfg Config, limits *validation.Overrides, distributor Distributor, stor
 		}
 	}
 	queryable := NewQueryable(distributorQueryable, ns, iteratorFunc, cfg, limits)
+	if cfg.phaseTimeoutsEnabled() {
+		queryable = phasedQueryable{Queryable: queryable}
+	}
 	exemplarQueryable := newDistributorExemplarQueryable(distributor)
 
 	lazyQueryable := storage.QueryableFunc(func(mint int64, maxt int64) (storage.Querier, error) {
@@ -210,6 +289,9 @@ func New(cfg Config, limits *validation.Overrides, distributor Distributor, stor
 	} else {
 		queryEngine = promql.NewEngine(opts)
 	}
+	if cfg.phaseTimeoutsEnabled() {
+		queryEngine = newPhasedEngine(queryEngine, cfg, reg)
+	}
 	return NewSampleAndChunkQueryable(lazyQueryable), exemplarQueryable, queryEngine
 }
 
@@ -538,6 +620,24 @@ func (s storeQueryable) UseQueryable(now time.Time, queryMinT, queryMaxT int64)
 	return s.QueryableWithFilter.UseQueryable(now, queryMinT, queryMaxT)
 }
 
+// findBlocksCoverageChecker returns the first of the stores able to check the blocks coverage, if any.
+func findBlocksCoverageChecker(stores []QueryableWithFilter) blocksCoverageChecker {
+	for _, s := range stores {
+		var q storage.Queryable = s
+		switch w := s.(type) {
+		case alwaysTrueFilterQueryable:
+			q = w.Queryable
+		case useBeforeTimestampQueryable:
+			q = w.Queryable
+		}
+
+		if c, ok := q.(blocksCoverageChecker); ok {
+			return c
+		}
+	}
+	return nil
+}
+
 type alwaysTrueFilterQueryable struct {
 	storage.Queryable
 }
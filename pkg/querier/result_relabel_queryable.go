@@ -0,0 +1,167 @@
+package querier
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/annotations"
+
+	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// NewResultRelabelQueryable returns a queryable relabeling the series returned by the wrapped
+// queryable with the query result relabel configs of the tenant, if any. The series ending up
+// with the same labels are merged. The label names and values are the ones of the relabeled
+// series too.
+func NewResultRelabelQueryable(q storage.Queryable, limits *validation.Overrides) storage.Queryable {
+	return resultRelabelQueryable{Queryable: q, limits: limits}
+}
+
+type resultRelabelQueryable struct {
+	storage.Queryable
+	limits *validation.Overrides
+}
+
+func (q resultRelabelQueryable) Querier(mint, maxt int64) (storage.Querier, error) {
+	querier, err := q.Queryable.Querier(mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return resultRelabelQuerier{Querier: querier, limits: q.limits, mint: mint, maxt: maxt}, nil
+}
+
+type resultRelabelQuerier struct {
+	storage.Querier
+	limits     *validation.Overrides
+	mint, maxt int64
+}
+
+// Select implements storage.Querier.
+func (q resultRelabelQuerier) Select(ctx context.Context, sortSeries bool, sp *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	set := q.Querier.Select(ctx, sortSeries, sp, matchers...)
+
+	cfgs := q.relabelConfigs(ctx)
+	if len(cfgs) == 0 {
+		return set
+	}
+	return relabelSeriesSet(set, cfgs)
+}
+
+// LabelValues implements storage.Querier.
+func (q resultRelabelQuerier) LabelValues(ctx context.Context, name string, matchers ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	cfgs := q.relabelConfigs(ctx)
+	if len(cfgs) == 0 {
+		return q.Querier.LabelValues(ctx, name, matchers...)
+	}
+
+	// The relabeled label may not exist in the stored series, so the values are
+	// taken from the relabeled series.
+	values := map[string]struct{}{}
+	warnings, err := q.forEachRelabeledSeries(ctx, cfgs, matchers, func(lbls labels.Labels) {
+		if value := lbls.Get(name); value != "" {
+			values[value] = struct{}{}
+		}
+	})
+	return sortedKeys(values), warnings, err
+}
+
+// LabelNames implements storage.Querier.
+func (q resultRelabelQuerier) LabelNames(ctx context.Context, matchers ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	cfgs := q.relabelConfigs(ctx)
+	if len(cfgs) == 0 {
+		return q.Querier.LabelNames(ctx, matchers...)
+	}
+
+	names := map[string]struct{}{}
+	warnings, err := q.forEachRelabeledSeries(ctx, cfgs, matchers, func(lbls labels.Labels) {
+		lbls.Range(func(l labels.Label) {
+			names[l.Name] = struct{}{}
+		})
+	})
+	return sortedKeys(names), warnings, err
+}
+
+// relabelConfigs returns the query result relabel configs of the tenant.
+func (q resultRelabelQuerier) relabelConfigs(ctx context.Context) []*relabel.Config {
+	// The wrapped querier fails on its own if the tenant is missing.
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil
+	}
+	return q.limits.QueryResultRelabelConfigs(userID)
+}
+
+// forEachRelabeledSeries calls f with the relabeled labels of each series matching the matchers,
+// or of all the series if there are no matchers.
+func (q resultRelabelQuerier) forEachRelabeledSeries(ctx context.Context, cfgs []*relabel.Config, matchers []*labels.Matcher, f func(labels.Labels)) (annotations.Annotations, error) {
+	if len(matchers) == 0 {
+		matchers = []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+")}
+	}
+
+	set := q.Querier.Select(ctx, false, &storage.SelectHints{Start: q.mint, End: q.maxt, Func: "series"}, matchers...)
+	for set.Next() {
+		// The supported relabel actions never drop the series.
+		lbls, _ := relabel.Process(set.At().Labels(), cfgs...)
+		f(lbls)
+	}
+	return set.Warnings(), set.Err()
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// relabelSeriesSet relabels all the series of the set, returning them sorted. The series with
+// the same labels once relabeled are merged.
+func relabelSeriesSet(set storage.SeriesSet, cfgs []*relabel.Config) storage.SeriesSet {
+	var result []storage.Series
+	for set.Next() {
+		s := set.At()
+		// The supported relabel actions never drop the series.
+		lbls, _ := relabel.Process(s.Labels(), cfgs...)
+		result = append(result, relabeledSeries{Series: s, labels: lbls})
+	}
+	if err := set.Err(); err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return labels.Compare(result[i].Labels(), result[j].Labels()) < 0
+	})
+
+	merged := make([]storage.Series, 0, len(result))
+	for i := 0; i < len(result); {
+		j := i + 1
+		for j < len(result) && labels.Equal(result[i].Labels(), result[j].Labels()) {
+			j++
+		}
+		if j-i == 1 {
+			merged = append(merged, result[i])
+		} else {
+			merged = append(merged, storage.ChainedSeriesMerge(result[i:j]...))
+		}
+		i = j
+	}
+
+	return series.NewSeriesSetWithWarnings(series.NewConcreteSeriesSet(false, merged), set.Warnings())
+}
+
+// relabeledSeries is a series with its labels replaced.
+type relabeledSeries struct {
+	storage.Series
+	labels labels.Labels
+}
+
+func (s relabeledSeries) Labels() labels.Labels {
+	return s.labels
+}
@@ -0,0 +1,146 @@
+package querier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestResultRelabelQueryable(t *testing.T) {
+	matrix := model.Matrix{
+		{
+			Metric: model.Metric{"__name__": "up", "instance": "a", "job": "node"},
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 1}},
+		},
+		{
+			Metric: model.Metric{"__name__": "up", "instance": "b", "job": "node"},
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 2}},
+		},
+		{
+			Metric: model.Metric{"__name__": "up", "instance": "b", "job": "other"},
+			Values: []model.SamplePair{{Timestamp: 2000, Value: 3}},
+		},
+	}
+
+	renameInstance := []*relabel.Config{
+		{SourceLabels: model.LabelNames{"instance"}, Regex: relabel.MustNewRegexp("(.*)"), Separator: ";", Replacement: "$1", TargetLabel: "host", Action: relabel.Replace},
+		{Regex: relabel.MustNewRegexp("instance"), Action: relabel.LabelDrop},
+	}
+	dropJob := []*relabel.Config{
+		{Regex: relabel.MustNewRegexp("job"), Action: relabel.LabelDrop},
+	}
+
+	for name, tc := range map[string]struct {
+		relabelConfigs []*relabel.Config
+		expected       map[string][]float64
+	}{
+		"no relabel configs": {
+			expected: map[string][]float64{
+				`{__name__="up", instance="a", job="node"}`:  {1},
+				`{__name__="up", instance="b", job="node"}`:  {2},
+				`{__name__="up", instance="b", job="other"}`: {3},
+			},
+		},
+		"rename a label": {
+			relabelConfigs: renameInstance,
+			expected: map[string][]float64{
+				`{__name__="up", host="a", job="node"}`:  {1},
+				`{__name__="up", host="b", job="node"}`:  {2},
+				`{__name__="up", host="b", job="other"}`: {3},
+			},
+		},
+		"the series ending up with the same labels are merged": {
+			relabelConfigs: dropJob,
+			expected: map[string][]float64{
+				`{__name__="up", instance="a"}`: {1},
+				`{__name__="up", instance="b"}`: {2, 3},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			limits := DefaultLimitsConfig()
+			limits.QueryResultRelabelConfigs = tc.relabelConfigs
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			queryable := NewResultRelabelQueryable(storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
+				return mockQuerier{matrix: matrix}, nil
+			}), overrides)
+
+			q, err := queryable.Querier(0, 3000)
+			require.NoError(t, err)
+
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+			set := q.Select(ctx, true, &storage.SelectHints{Start: 0, End: 3000})
+
+			actual := map[string][]float64{}
+			var lastLabels labels.Labels
+			for set.Next() {
+				s := set.At()
+				// The series are sorted.
+				assert.Less(t, labels.Compare(lastLabels, s.Labels()), 0)
+				lastLabels = s.Labels()
+
+				it := s.Iterator(nil)
+				for it.Next() != 0 {
+					_, v := it.At()
+					actual[s.Labels().String()] = append(actual[s.Labels().String()], v)
+				}
+				require.NoError(t, it.Err())
+			}
+			require.NoError(t, set.Err())
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestResultRelabelQueryable_LabelNamesAndValues(t *testing.T) {
+	matrix := model.Matrix{
+		{
+			Metric: model.Metric{"__name__": "up", "instance": "a", "job": "node"},
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 1}},
+		},
+		{
+			Metric: model.Metric{"__name__": "up", "instance": "b", "job": "node"},
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 2}},
+		},
+	}
+
+	limits := DefaultLimitsConfig()
+	limits.QueryResultRelabelConfigs = []*relabel.Config{
+		{SourceLabels: model.LabelNames{"instance"}, Regex: relabel.MustNewRegexp("(.*)"), Separator: ";", Replacement: "$1", TargetLabel: "host", Action: relabel.Replace},
+		{Regex: relabel.MustNewRegexp("instance"), Action: relabel.LabelDrop},
+	}
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	queryable := NewResultRelabelQueryable(storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{matrix: matrix}, nil
+	}), overrides)
+
+	q, err := queryable.Querier(0, 3000)
+	require.NoError(t, err)
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	names, _, err := q.LabelNames(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"__name__", "host", "job"}, names)
+
+	values, _, err := q.LabelValues(ctx, "host")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, values)
+
+	values, _, err = q.LabelValues(ctx, "instance")
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
@@ -32,7 +32,8 @@ func newStoreGatewayClientFactory(clientCfg grpcclient.Config, reg prometheus.Re
 }
 
 func dialStoreGatewayClient(clientCfg grpcclient.Config, addr string, requestDuration *prometheus.HistogramVec) (*storeGatewayClient, error) {
-	opts, err := clientCfg.DialOption(grpcclient.Instrument(requestDuration))
+	unaryInterceptors, streamInterceptors := grpcclient.Instrument(requestDuration)
+	opts, err := clientCfg.DialOptionForTarget(addr, unaryInterceptors, streamInterceptors)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +79,7 @@ func newStoreGatewayClientPool(discovery client.PoolServiceDiscovery, clientConf
 		BackoffOnRatelimits: false,
 		TLSEnabled:          clientConfig.TLSEnabled,
 		TLS:                 clientConfig.TLS,
+		TargetTLSConfigs:    clientConfig.TargetTLSConfigs,
 	}
 	poolCfg := client.PoolConfig{
 		CheckInterval:      time.Minute,
@@ -99,6 +101,8 @@ type ClientConfig struct {
 	TLSEnabled      bool             `yaml:"tls_enabled"`
 	TLS             tls.ClientConfig `yaml:",inline"`
 	GRPCCompression string           `yaml:"grpc_compression"`
+
+	TargetTLSConfigs grpcclient.TargetMatcherTLSProvider `yaml:"target_tls_configs" doc:"nocli|description=[Experimental] List of TLS configs used to connect to the store-gateways whose address matches their regex, the first matching one being used. The global TLS config is used for the store-gateways not matched by any of them."`
 }
 
 func (cfg *ClientConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
@@ -37,16 +37,29 @@ const (
 // by the tenant ID and the previous value is exposed through a new label
 // prefixed with "original_". This behaviour is not implemented recursively.
 func NewQueryable(upstream storage.Queryable, byPassWithSingleQuerier bool) storage.Queryable {
-	return NewMergeQueryable(defaultTenantLabel, tenantQuerierCallback(upstream), byPassWithSingleQuerier)
+	return NewQueryableWithTenantResolver(upstream, nil, byPassWithSingleQuerier)
 }
 
-func tenantQuerierCallback(queryable storage.Queryable) MergeQuerierCallback {
+// NewQueryableWithTenantResolver is like NewQueryable, but the tenant IDs of the
+// request are resolved by the resolver, if not nil, before querying them.
+func NewQueryableWithTenantResolver(upstream storage.Queryable, resolver *TenantResolver, byPassWithSingleQuerier bool) storage.Queryable {
+	return NewMergeQueryable(defaultTenantLabel, tenantQuerierCallback(upstream, resolver), byPassWithSingleQuerier)
+}
+
+func tenantQuerierCallback(queryable storage.Queryable, resolver *TenantResolver) MergeQuerierCallback {
 	return func(ctx context.Context, mint int64, maxt int64) ([]string, []storage.Querier, error) {
 		tenantIDs, err := tenant.TenantIDs(ctx)
 		if err != nil {
 			return nil, nil, err
 		}
 
+		if resolver != nil {
+			tenantIDs, err = resolver.Resolve(ctx, tenantIDs)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		var queriers = make([]storage.Querier, len(tenantIDs))
 		for pos := range tenantIDs {
 			q, err := queryable.Querier(
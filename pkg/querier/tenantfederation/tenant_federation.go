@@ -2,13 +2,23 @@ package tenantfederation
 
 import (
 	"flag"
+	"time"
 )
 
 type Config struct {
 	// Enabled switches on support for multi tenant query federation
 	Enabled bool `yaml:"enabled"`
+	// TenantSelectorsEnabled switches on the resolution of the tenant selectors
+	TenantSelectorsEnabled bool `yaml:"tenant_selectors_enabled"`
+	// KnownTenantsRefreshInterval is how frequently the known tenants are refreshed
+	KnownTenantsRefreshInterval time.Duration `yaml:"known_tenants_refresh_interval"`
+	// MaxTenants is the max number of tenants a query can be federated across
+	MaxTenants int `yaml:"max_tenants"`
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.Enabled, "tenant-federation.enabled", false, "If enabled on all Cortex services, queries can be federated across multiple tenants. The tenant IDs involved need to be specified separated by a `|` character in the `X-Scope-OrgID` header (experimental).")
+	f.BoolVar(&cfg.TenantSelectorsEnabled, "tenant-federation.tenant-selectors-enabled", false, "[Experimental] If enabled, the tenant IDs in the `X-Scope-OrgID` header of a query having `tenant_federation_selectors` configured in the limits are resolved by the querier to the known tenants matching those selectors. The tenant IDs of the header are never expanded as patterns. The known tenants are the tenants with series in the ingesters.")
+	f.DurationVar(&cfg.KnownTenantsRefreshInterval, "tenant-federation.known-tenants-refresh-interval", time.Minute, "[Experimental] How frequently the querier refreshes the known tenants the tenant selectors are resolved against.")
+	f.IntVar(&cfg.MaxTenants, "tenant-federation.max-tenants", 0, "[Experimental] The maximum number of tenants a single query can be federated across, after resolving the tenant selectors. 0 to disable.")
 }
@@ -0,0 +1,129 @@
+package tenantfederation
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+const (
+	errTooManyTenants = "the query is federated across too many tenants (tenants: %d, limit: %d)"
+)
+
+// Limits provides the per-tenant tenant selectors.
+type Limits interface {
+	// TenantFederationSelectors returns the tenant selectors a federated query for the
+	// given tenant ID is resolved to.
+	TenantFederationSelectors(userID string) []string
+}
+
+// TenantsLister lists the tenants known by the cluster.
+type TenantsLister interface {
+	ListTenants(ctx context.Context) ([]string, error)
+}
+
+// TenantsListerFunc is a function implementing TenantsLister.
+type TenantsListerFunc func(ctx context.Context) ([]string, error)
+
+// ListTenants implements TenantsLister.
+func (f TenantsListerFunc) ListTenants(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// TenantResolver resolves the tenant selectors of a query to the known tenants matching
+// them, and enforces the max number of tenants a query can be federated across.
+type TenantResolver struct {
+	cfg    Config
+	limits Limits
+	lister TenantsLister
+
+	knownMtx     sync.Mutex
+	known        []string
+	knownUpdated time.Time
+}
+
+// NewTenantResolver returns a TenantResolver resolving the tenant selectors configured in
+// the limits against the tenants returned by the lister, which is only called if the tenant
+// selectors are enabled.
+func NewTenantResolver(cfg Config, limits Limits, lister TenantsLister) *TenantResolver {
+	return &TenantResolver{
+		cfg:    cfg,
+		limits: limits,
+		lister: lister,
+	}
+}
+
+// Resolve returns the normalized list of tenant IDs the query is federated across. The
+// tenant IDs of the request are literal: a tenant ID is only replaced by the tenants matching
+// the selectors configured for it in the limits, never expanded as a pattern itself.
+func (r *TenantResolver) Resolve(ctx context.Context, tenantIDs []string) ([]string, error) {
+	if r.cfg.TenantSelectorsEnabled && r.hasTenantSelectors(tenantIDs) {
+		known, err := r.knownTenants(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := make([]string, 0, len(tenantIDs))
+		for _, id := range tenantIDs {
+			selectors := r.limits.TenantFederationSelectors(id)
+			if len(selectors) == 0 {
+				resolved = append(resolved, id)
+				continue
+			}
+			for _, knownID := range known {
+				if matchesAny(selectors, knownID) {
+					resolved = append(resolved, knownID)
+				}
+			}
+		}
+		tenantIDs = tenant.NormalizeTenantIDs(resolved)
+	}
+
+	if r.cfg.MaxTenants > 0 && len(tenantIDs) > r.cfg.MaxTenants {
+		return nil, validation.LimitError(fmt.Sprintf(errTooManyTenants, len(tenantIDs), r.cfg.MaxTenants))
+	}
+
+	return tenantIDs, nil
+}
+
+// knownTenants returns the known tenants, refreshing them if older than the refresh interval.
+func (r *TenantResolver) knownTenants(ctx context.Context) ([]string, error) {
+	r.knownMtx.Lock()
+	defer r.knownMtx.Unlock()
+
+	if r.known != nil && time.Since(r.knownUpdated) < r.cfg.KnownTenantsRefreshInterval {
+		return r.known, nil
+	}
+
+	known, err := r.lister.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.known, r.knownUpdated = known, time.Now()
+	return known, nil
+}
+
+func (r *TenantResolver) hasTenantSelectors(tenantIDs []string) bool {
+	for _, id := range tenantIDs {
+		if len(r.limits.TenantFederationSelectors(id)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny returns whether the tenant ID matches any of the selectors. The tenant IDs
+// can't contain a path separator, so the * wildcard matches any sequence of characters.
+func matchesAny(selectors []string, tenantID string) bool {
+	for _, selector := range selectors {
+		if matched, _ := path.Match(selector, tenantID); matched {
+			return true
+		}
+	}
+	return false
+}
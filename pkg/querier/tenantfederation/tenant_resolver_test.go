@@ -0,0 +1,133 @@
+package tenantfederation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+)
+
+type mockTenantSelectorsLimits map[string][]string
+
+func (m mockTenantSelectorsLimits) TenantFederationSelectors(userID string) []string {
+	return m[userID]
+}
+
+func TestTenantResolver_Resolve(t *testing.T) {
+	known := []string{"team-a", "team-b", "team-c", "other"}
+	limits := mockTenantSelectorsLimits{
+		"teams":     {"team-?"},
+		"a-and-b":   {"*-a", "team-b"},
+		"unmatched": {"unknown-*"},
+	}
+
+	tests := map[string]struct {
+		cfg       Config
+		tenantIDs []string
+		expected  []string
+		err       string
+	}{
+		"should keep the tenant IDs if the selectors are disabled": {
+			cfg:       Config{},
+			tenantIDs: []string{"other", "teams"},
+			expected:  []string{"other", "teams"},
+		},
+		"should resolve the tenant IDs with selectors to the matching known tenants": {
+			cfg:       Config{TenantSelectorsEnabled: true},
+			tenantIDs: []string{"other", "teams"},
+			expected:  []string{"other", "team-a", "team-b", "team-c"},
+		},
+		"should never expand the tenant IDs of the request as patterns": {
+			cfg:       Config{TenantSelectorsEnabled: true},
+			tenantIDs: []string{"other", "team-*"},
+			expected:  []string{"other", "team-*"},
+		},
+		"should de-duplicate the tenants matched by multiple selectors": {
+			cfg:       Config{TenantSelectorsEnabled: true},
+			tenantIDs: []string{"a-and-b", "teams"},
+			expected:  []string{"team-a", "team-b", "team-c"},
+		},
+		"should resolve to no tenant if the selectors match no known tenant": {
+			cfg:       Config{TenantSelectorsEnabled: true},
+			tenantIDs: []string{"new", "unmatched"},
+			expected:  []string{"new"},
+		},
+		"should fail if the resolved tenants exceed the limit": {
+			cfg:       Config{TenantSelectorsEnabled: true, MaxTenants: 2},
+			tenantIDs: []string{"teams"},
+			err:       "the query is federated across too many tenants (tenants: 3, limit: 2)",
+		},
+		"should enforce the limit also without selectors": {
+			cfg:       Config{MaxTenants: 1},
+			tenantIDs: []string{"team-a", "team-b"},
+			err:       "the query is federated across too many tenants (tenants: 2, limit: 1)",
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			testData.cfg.KnownTenantsRefreshInterval = time.Minute
+			resolver := NewTenantResolver(testData.cfg, limits, TenantsListerFunc(func(context.Context) ([]string, error) {
+				return known, nil
+			}))
+
+			actual, err := resolver.Resolve(context.Background(), testData.tenantIDs)
+			if testData.err != "" {
+				assert.EqualError(t, err, testData.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+func TestTenantResolver_ShouldCacheTheKnownTenants(t *testing.T) {
+	calls := 0
+	var listErr error
+	lister := TenantsListerFunc(func(context.Context) ([]string, error) {
+		calls++
+		return []string{"team-a"}, listErr
+	})
+
+	limits := mockTenantSelectorsLimits{"teams": {"team-*"}}
+	resolver := NewTenantResolver(Config{TenantSelectorsEnabled: true, KnownTenantsRefreshInterval: time.Hour}, limits, lister)
+	for i := 0; i < 3; i++ {
+		actual, err := resolver.Resolve(context.Background(), []string{"teams"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team-a"}, actual)
+	}
+	assert.Equal(t, 1, calls)
+
+	// The tenants are listed again once the refresh interval elapsed, and listing errors are returned.
+	resolver.knownUpdated = time.Now().Add(-2 * time.Hour)
+	listErr = errors.New("ingesters unavailable")
+	_, err := resolver.Resolve(context.Background(), []string{"teams"})
+	assert.EqualError(t, err, "ingesters unavailable")
+	assert.Equal(t, 2, calls)
+}
+
+func TestQueryableWithTenantResolver(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+
+	upstream := &mockTenantQueryableWithFilter{}
+	limits := mockTenantSelectorsLimits{"teams": {"team-*"}}
+	resolver := NewTenantResolver(Config{TenantSelectorsEnabled: true, KnownTenantsRefreshInterval: time.Minute}, limits, TenantsListerFunc(func(context.Context) ([]string, error) {
+		return []string{"team-a", "team-b", "other"}, nil
+	}))
+
+	q, err := NewQueryableWithTenantResolver(upstream, resolver, false).Querier(mint, maxt)
+	require.NoError(t, err)
+
+	ctx := user.InjectOrgID(context.Background(), "teams")
+	values, _, err := q.LabelValues(ctx, defaultTenantLabel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b"}, values)
+}
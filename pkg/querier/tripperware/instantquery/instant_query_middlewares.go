@@ -17,6 +17,7 @@ func Middlewares(
 ) ([]tripperware.Middleware, error) {
 	m := []tripperware.Middleware{
 		NewLimitsMiddleware(limits, lookbackDelta),
+		NewSortMiddleware(limits),
 		tripperware.ShardByMiddleware(log, limits, InstantQueryCodec, queryAnalyzer),
 	}
 	return m, nil
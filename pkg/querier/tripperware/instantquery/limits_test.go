@@ -100,12 +100,21 @@ func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 type mockLimits struct {
 	validation.Overrides
 	maxQueryLength time.Duration
+	sortResults    bool
 }
 
 func (m mockLimits) MaxQueryLength(string) time.Duration {
 	return m.maxQueryLength
 }
 
+func (m mockLimits) QueryPartialResults(string) bool {
+	return false
+}
+
+func (m mockLimits) SortInstantQueryResults(string) bool {
+	return m.sortResults
+}
+
 type mockHandler struct {
 	mock.Mock
 }
@@ -0,0 +1,79 @@
+package instantquery
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/tripperware"
+	"github.com/cortexproject/cortex/pkg/tenant"
+)
+
+type sortMiddleware struct {
+	tripperware.Limits
+	next tripperware.Handler
+}
+
+// NewSortMiddleware creates a new Middleware that sorts the series of instant vector results
+// by their labels, for the tenants which have it enabled.
+func NewSortMiddleware(l tripperware.Limits) tripperware.Middleware {
+	return tripperware.MiddlewareFunc(func(next tripperware.Handler) tripperware.Handler {
+		return sortMiddleware{
+			next:   next,
+			Limits: l,
+		}
+	})
+}
+
+func (s sortMiddleware) Do(ctx context.Context, r tripperware.Request) (tripperware.Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	resp, err := s.next.Do(ctx, r)
+	if err != nil || !s.sortEnabled(tenantIDs) {
+		return resp, err
+	}
+
+	promResp, ok := resp.(*PrometheusInstantQueryResponse)
+	if !ok {
+		return resp, nil
+	}
+	vector := promResp.Data.Result.GetVector()
+	if vector == nil {
+		return resp, nil
+	}
+
+	// Don't change the order of results whose order is defined by the query itself.
+	plan, err := sortPlanForQuery(r.GetQuery())
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+	if plan != sortByLabels {
+		return resp, nil
+	}
+
+	sortSamplesByLabels(vector.Samples)
+	return resp, nil
+}
+
+// sortEnabled returns true if sorting is enabled for any of the tenants.
+func (s sortMiddleware) sortEnabled(tenantIDs []string) bool {
+	for _, tenantID := range tenantIDs {
+		if s.SortInstantQueryResults(tenantID) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortSamplesByLabels(samples []*Sample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return labels.Compare(cortexpb.FromLabelAdaptersToLabels(samples[i].Labels), cortexpb.FromLabelAdaptersToLabels(samples[j].Labels)) < 0
+	})
+}
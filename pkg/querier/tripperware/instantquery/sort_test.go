@@ -0,0 +1,127 @@
+package instantquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+func TestSortMiddleware(t *testing.T) {
+	t.Parallel()
+
+	for testName, testData := range map[string]struct {
+		query         string
+		sortResults   bool
+		inputOrder    []string
+		expectedOrder []string
+	}{
+		"should not sort if disabled": {
+			query:         `up`,
+			inputOrder:    []string{"c", "a", "b"},
+			expectedOrder: []string{"c", "a", "b"},
+		},
+		"should sort by labels if enabled": {
+			query:         `up`,
+			sortResults:   true,
+			inputOrder:    []string{"c", "a", "b"},
+			expectedOrder: []string{"a", "b", "c"},
+		},
+		"should not sort topk results": {
+			query:         `topk(3, up)`,
+			sortResults:   true,
+			inputOrder:    []string{"c", "a", "b"},
+			expectedOrder: []string{"c", "a", "b"},
+		},
+		"should not sort sort_desc results": {
+			query:         `sort_desc(up)`,
+			sortResults:   true,
+			inputOrder:    []string{"c", "a", "b"},
+			expectedOrder: []string{"c", "a", "b"},
+		},
+	} {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			samples := make([]*Sample, 0, len(testData.inputOrder))
+			for _, instance := range testData.inputOrder {
+				samples = append(samples, &Sample{
+					Labels: []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "instance", Value: instance}},
+					Sample: cortexpb.Sample{Value: 1, TimestampMs: 1000},
+				})
+			}
+			innerRes := vectorResponse(samples)
+
+			inner := &mockHandler{}
+			inner.On("Do", mock.Anything, mock.Anything).Return(innerRes, nil)
+			outer := NewSortMiddleware(&mockLimits{sortResults: testData.sortResults}).Wrap(inner)
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			res, err := outer.Do(ctx, &PrometheusRequest{Query: testData.query})
+			require.NoError(t, err)
+
+			actualOrder := make([]string, 0, len(testData.expectedOrder))
+			for _, s := range res.(*PrometheusInstantQueryResponse).Data.Result.GetVector().Samples {
+				actualOrder = append(actualOrder, cortexpb.FromLabelAdaptersToLabels(s.Labels).Get("instance"))
+			}
+			assert.Equal(t, testData.expectedOrder, actualOrder)
+		})
+	}
+}
+
+func TestSortMiddleware_ShouldReturnStableOrder(t *testing.T) {
+	t.Parallel()
+
+	permutations := [][]string{{"a", "b", "c"}, {"c", "b", "a"}, {"b", "a", "c"}}
+
+	var expected []cortexpb.LabelAdapter
+	for _, order := range permutations {
+		samples := make([]*Sample, 0, len(order))
+		for _, job := range order {
+			samples = append(samples, &Sample{
+				// Series sharing the same prefix but differing in the number of labels.
+				Labels: []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "job", Value: job}},
+				Sample: cortexpb.Sample{Value: 1, TimestampMs: 1000},
+			}, &Sample{
+				Labels: []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "job", Value: job}, {Name: "zone", Value: "z"}},
+				Sample: cortexpb.Sample{Value: 1, TimestampMs: 1000},
+			})
+		}
+
+		inner := &mockHandler{}
+		inner.On("Do", mock.Anything, mock.Anything).Return(vectorResponse(samples), nil)
+		outer := NewSortMiddleware(&mockLimits{sortResults: true}).Wrap(inner)
+
+		res, err := outer.Do(user.InjectOrgID(context.Background(), "test"), &PrometheusRequest{Query: `up`})
+		require.NoError(t, err)
+
+		var actual []cortexpb.LabelAdapter
+		for _, s := range res.(*PrometheusInstantQueryResponse).Data.Result.GetVector().Samples {
+			actual = append(actual, s.Labels...)
+		}
+		if expected == nil {
+			expected = actual
+			continue
+		}
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func vectorResponse(samples []*Sample) *PrometheusInstantQueryResponse {
+	return &PrometheusInstantQueryResponse{
+		Status: "success",
+		Data: PrometheusInstantQueryData{
+			ResultType: model.ValVector.String(),
+			Result: PrometheusInstantQueryResult{
+				Result: &PrometheusInstantQueryResult_Vector{Vector: &Vector{Samples: samples}},
+			},
+		},
+	}
+}
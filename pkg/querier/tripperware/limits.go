@@ -26,6 +26,27 @@ type Limits interface {
 	// QueryVerticalShardSize returns the maximum number of queriers that can handle requests for this user.
 	QueryVerticalShardSize(userID string) int
 
+	// MaxSamplesPerQueryResponse returns the limit to the number of samples a range query response can contain.
+	MaxSamplesPerQueryResponse(string) int
+
+	// MinQueryStep returns the minimum step of range queries.
+	MinQueryStep(string) time.Duration
+
+	// MinQueryStepPolicy returns how to handle range queries with a step smaller than the minimum.
+	MinQueryStepPolicy(string) string
+
+	// QueryPartialResults returns whether partial results are returned when some of the split range queries fail.
+	QueryPartialResults(string) bool
+
+	// SplitQueriesMinRange returns the minimum time range of the range queries split by interval.
+	SplitQueriesMinRange(string) time.Duration
+
+	// MaxSplitQueries returns the maximum number of queries a single range query can be split into by interval.
+	MaxSplitQueries(string) int
+
+	// SortInstantQueryResults returns whether the series of instant vector query results should be sorted by labels.
+	SortInstantQueryResults(string) bool
+
 	// QueryPriority returns the query priority config for the tenant, including different priorities and their attributes.
 	QueryPriority(userID string) validation.QueryPriority
 }
@@ -0,0 +1,218 @@
+package tripperware
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/querier"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+const (
+	metadataOpSeries      = "series"
+	metadataOpLabels      = "labels"
+	metadataOpLabelValues = "label_values"
+)
+
+// MetadataCacheConfig configures the caching of series, labels and label values query results.
+type MetadataCacheConfig struct {
+	CacheResults bool         `yaml:"cache_results"`
+	CacheConfig  cache.Config `yaml:"cache"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *MetadataCacheConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.CacheResults, "frontend.metadata-cache-results", false, "[Experimental] Cache series, labels and label values query results. Only requests with an explicit start and end, where the end is older than the max cache freshness, are cached. The time entries are cached for is configured by -frontend.metadata-cache.default-validity.")
+	cfg.CacheConfig.RegisterFlagsWithPrefix("frontend.metadata-cache.", "", f)
+}
+
+// Validate validates the config.
+func (cfg *MetadataCacheConfig) Validate() error {
+	if !cfg.CacheResults {
+		return nil
+	}
+	return cfg.CacheConfig.Validate()
+}
+
+type metadataCache struct {
+	logger log.Logger
+	next   http.RoundTripper
+	cache  cache.Cache
+	limits Limits
+
+	requests *prometheus.CounterVec
+}
+
+// NewMetadataCacheTripperware returns a Tripperware caching the results of series, labels and label values
+// requests, keyed by tenant, path and request parameters. Other requests are passed through. If caching
+// is disabled, the returned Tripperware passes all requests through and the returned cache is nil.
+func NewMetadataCacheTripperware(cfg MetadataCacheConfig, limits Limits, logger log.Logger, reg prometheus.Registerer) (Tripperware, cache.Cache, error) {
+	if !cfg.CacheResults {
+		return func(next http.RoundTripper) http.RoundTripper { return next }, nil, nil
+	}
+
+	c, err := cache.New(cfg.CacheConfig, reg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_metadata_cache_requests_total",
+		Help: "Total number of cacheable series, labels and label values requests, by whether they've been served from the metadata results cache (hit) or not (miss).",
+	}, []string{"op", "result"})
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &metadataCache{
+			logger:   logger,
+			next:     next,
+			cache:    c,
+			limits:   limits,
+			requests: requests,
+		}
+	}, c, nil
+}
+
+func (m *metadataCache) RoundTrip(r *http.Request) (*http.Response, error) {
+	op := metadataOpFromPath(r.URL.Path)
+	if op == "" {
+		return m.next.RoundTrip(r)
+	}
+
+	tenantIDs, err := tenant.TenantIDs(r.Context())
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	key, ok := m.cacheKey(tenantIDs, r)
+	if !ok {
+		return m.next.RoundTrip(r)
+	}
+
+	if resp, ok := m.fetch(r, key); ok {
+		m.requests.WithLabelValues(op, "hit").Inc()
+		return resp, nil
+	}
+	m.requests.WithLabelValues(op, "miss").Inc()
+
+	resp, err := m.next.RoundTrip(r)
+	// Compressed responses are not cached, to not serve them to clients which don't support the compression.
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return resp, err
+	}
+
+	body, err := BodyBuffer(resp, m.logger)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	m.store(r, key, resp, body)
+	return resp, nil
+}
+
+// cacheKey returns the cache key of the request, and false if the request results can't be cached.
+func (m *metadataCache) cacheKey(tenantIDs []string, r *http.Request) (string, bool) {
+	// Without an explicit time range, results depend on the time the request is run at.
+	if r.Form.Get("start") == "" || r.Form.Get("end") == "" {
+		return "", false
+	}
+	end, err := util.ParseTime(r.Form.Get("end"))
+	if err != nil {
+		return "", false
+	}
+
+	// Recent results may still change, like the results cache we don't cache them.
+	maxCacheFreshness := validation.MaxDurationPerTenant(tenantIDs, m.limits.MaxCacheFreshness)
+	if end > util.TimeToMillis(time.Now().Add(-maxCacheFreshness)) {
+		return "", false
+	}
+
+	// The order of matchers doesn't affect the results, so they're sorted to share the cache entry.
+	params := make(url.Values, len(r.Form))
+	for name, values := range r.Form {
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		params[name] = sorted
+	}
+
+	key := fmt.Sprintf("metadata:%s:%s:%s", tenant.JoinTenantIDs(tenantIDs), r.URL.Path, params.Encode())
+
+	// The queried blocks are restricted by the block sources, so their results are cached separately.
+	if sources := r.Header.Get(querier.BlockSourcesHeader); sources != "" {
+		key = fmt.Sprintf("%s:%s", key, sources)
+	}
+	return key, true
+}
+
+func (m *metadataCache) fetch(r *http.Request, key string) (*http.Response, bool) {
+	found, bufs, _ := m.cache.Fetch(r.Context(), []string{cache.HashKey(key)})
+	if len(found) != 1 {
+		return nil, false
+	}
+
+	var cached httpgrpc.HTTPResponse
+	if err := cached.Unmarshal(bufs[0]); err != nil {
+		level.Error(util_log.WithContext(r.Context(), m.logger)).Log("msg", "error unmarshalling cached metadata response", "err", err)
+		return nil, false
+	}
+
+	resp := &http.Response{
+		StatusCode:    int(cached.Code),
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+	}
+	for _, h := range cached.Headers {
+		resp.Header[h.Key] = h.Values
+	}
+	return resp, true
+}
+
+func (m *metadataCache) store(r *http.Request, key string, resp *http.Response, body []byte) {
+	cached := httpgrpc.HTTPResponse{
+		Code: int32(resp.StatusCode),
+		Body: body,
+	}
+	for k, v := range resp.Header {
+		cached.Headers = append(cached.Headers, &httpgrpc.Header{Key: k, Values: v})
+	}
+
+	buf, err := cached.Marshal()
+	if err != nil {
+		level.Error(util_log.WithContext(r.Context(), m.logger)).Log("msg", "error marshalling metadata response", "err", err)
+		return
+	}
+	m.cache.Store(r.Context(), []string{cache.HashKey(key)}, [][]byte{buf})
+}
+
+func metadataOpFromPath(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/series"):
+		return metadataOpSeries
+	case strings.HasSuffix(path, "/labels"):
+		return metadataOpLabels
+	case strings.Contains(path, "/label/") && strings.HasSuffix(path, "/values"):
+		return metadataOpLabelValues
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package tripperware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/querier"
+)
+
+func TestMetadataCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	past := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	older := strconv.FormatInt(now.Add(-2*time.Hour).Unix(), 10)
+	recent := strconv.FormatInt(now.Unix(), 10)
+
+	for testName, testData := range map[string]struct {
+		paths             []string
+		statusCode        int
+		expectedDownCalls int
+		expectedMetrics   string
+	}{
+		"should cache series requests with a time range in the past": {
+			paths:             []string{"/api/v1/series?match[]=up&start=" + older + "&end=" + past, "/api/v1/series?match[]=up&start=" + older + "&end=" + past},
+			expectedDownCalls: 1,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_metadata_cache_requests_total Total number of cacheable series, labels and label values requests, by whether they've been served from the metadata results cache (hit) or not (miss).
+				# TYPE cortex_query_frontend_metadata_cache_requests_total counter
+				cortex_query_frontend_metadata_cache_requests_total{op="series",result="hit"} 1
+				cortex_query_frontend_metadata_cache_requests_total{op="series",result="miss"} 1
+			`,
+		},
+		"should share the cache entry regardless of the matchers order": {
+			paths:             []string{"/api/v1/labels?match[]=up&match[]=down&start=" + older + "&end=" + past, "/api/v1/labels?match[]=down&match[]=up&start=" + older + "&end=" + past},
+			expectedDownCalls: 1,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_metadata_cache_requests_total Total number of cacheable series, labels and label values requests, by whether they've been served from the metadata results cache (hit) or not (miss).
+				# TYPE cortex_query_frontend_metadata_cache_requests_total counter
+				cortex_query_frontend_metadata_cache_requests_total{op="labels",result="hit"} 1
+				cortex_query_frontend_metadata_cache_requests_total{op="labels",result="miss"} 1
+			`,
+		},
+		"should not share the cache entry between different time ranges": {
+			paths:             []string{"/api/v1/label/job/values?start=" + older + "&end=" + past, "/api/v1/label/job/values?start=" + older + "&end=" + older},
+			expectedDownCalls: 2,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_metadata_cache_requests_total Total number of cacheable series, labels and label values requests, by whether they've been served from the metadata results cache (hit) or not (miss).
+				# TYPE cortex_query_frontend_metadata_cache_requests_total counter
+				cortex_query_frontend_metadata_cache_requests_total{op="label_values",result="miss"} 2
+			`,
+		},
+		"should not cache requests ending within the max cache freshness": {
+			paths:             []string{"/api/v1/series?match[]=up&start=" + older + "&end=" + recent, "/api/v1/series?match[]=up&start=" + older + "&end=" + recent},
+			expectedDownCalls: 2,
+		},
+		"should not cache requests without an explicit time range": {
+			paths:             []string{"/api/v1/labels", "/api/v1/labels"},
+			expectedDownCalls: 2,
+		},
+		"should not cache failed requests": {
+			paths:             []string{"/api/v1/series?match[]=up&start=" + older + "&end=" + past, "/api/v1/series?match[]=up&start=" + older + "&end=" + past},
+			statusCode:        http.StatusInternalServerError,
+			expectedDownCalls: 2,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_metadata_cache_requests_total Total number of cacheable series, labels and label values requests, by whether they've been served from the metadata results cache (hit) or not (miss).
+				# TYPE cortex_query_frontend_metadata_cache_requests_total counter
+				cortex_query_frontend_metadata_cache_requests_total{op="series",result="miss"} 2
+			`,
+		},
+		"should pass through non metadata requests": {
+			paths:             []string{"/api/v1/query?query=up&time=" + past, "/api/v1/query?query=up&time=" + past},
+			expectedDownCalls: 2,
+		},
+	} {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			statusCode := testData.statusCode
+			if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+
+			downCalls := 0
+			downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				downCalls++
+				return &http.Response{
+					StatusCode: statusCode,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":["up"]}`)),
+				}, nil
+			})
+
+			reg := prometheus.NewPedanticRegistry()
+			cfg := MetadataCacheConfig{CacheResults: true, CacheConfig: cache.Config{Cache: cache.NewMockCache()}}
+			tw, _, err := NewMetadataCacheTripperware(cfg, mockLimits{maxCacheFreshness: 10 * time.Minute}, log.NewNopLogger(), reg)
+			require.NoError(t, err)
+			rt := tw(downstream)
+
+			for _, path := range testData.paths {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req = req.WithContext(user.InjectOrgID(context.Background(), "user-1"))
+
+				resp, err := rt.RoundTrip(req)
+				require.NoError(t, err)
+				assert.Equal(t, statusCode, resp.StatusCode)
+				assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, `{"status":"success","data":["up"]}`, string(body))
+			}
+
+			assert.Equal(t, testData.expectedDownCalls, downCalls)
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics), "cortex_query_frontend_metadata_cache_requests_total"))
+		})
+	}
+}
+
+func TestMetadataCache_ShouldNotShareCacheEntriesBetweenTenants(t *testing.T) {
+	t.Parallel()
+
+	downCalls := 0
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		downCalls++
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	})
+
+	cfg := MetadataCacheConfig{CacheResults: true, CacheConfig: cache.Config{Cache: cache.NewMockCache()}}
+	tw, _, err := NewMetadataCacheTripperware(cfg, mockLimits{}, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	rt := tw(downstream)
+
+	end := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	for _, userID := range []string{"user-1", "user-2", "user-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/series?match[]=up&start=0&end="+end, nil)
+		_, err := rt.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), userID)))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, downCalls)
+}
+
+func TestMetadataCache_ShouldNotShareCacheEntriesBetweenBlockSources(t *testing.T) {
+	t.Parallel()
+
+	downCalls := 0
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		downCalls++
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	})
+
+	cfg := MetadataCacheConfig{CacheResults: true, CacheConfig: cache.Config{Cache: cache.NewMockCache()}}
+	tw, _, err := NewMetadataCacheTripperware(cfg, mockLimits{}, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	rt := tw(downstream)
+
+	end := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	for _, sources := range []string{"", "source-1", "source-2", "source-1", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/series?match[]=up&start=0&end="+end, nil)
+		if sources != "" {
+			req.Header.Set(querier.BlockSourcesHeader, sources)
+		}
+		_, err := rt.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), "user-1")))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, downCalls)
+}
@@ -0,0 +1,412 @@
+package queryrange
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/cortexproject/cortex/pkg/querier/tripperware"
+)
+
+// arrowStreamContentType is the content type of the Apache Arrow IPC streaming format.
+const arrowStreamContentType = "application/vnd.apache.arrow.stream"
+
+// Column names of the timestamp and value of the samples in the Arrow encoded matrices.
+const (
+	arrowTimestampColumn = "timestamp"
+	arrowValueColumn     = "value"
+)
+
+// Constants of the Arrow IPC format, as defined by the Arrow flatbuffers schemas
+// (https://github.com/apache/arrow/tree/main/format).
+const (
+	arrowMetadataV5 = 4
+
+	arrowMessageHeaderSchema      = 1
+	arrowMessageHeaderRecordBatch = 3
+
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeTimestamp     = 10
+
+	arrowPrecisionDouble     = 2
+	arrowTimeUnitMillisecond = 1
+
+	arrowEndiannessLittle = 0
+)
+
+// arrowContinuation prefixes each encapsulated message of the Arrow IPC streaming format.
+const arrowContinuation = 0xFFFFFFFF
+
+// encodeArrowMatrix encodes the matrix of the response in the Arrow IPC streaming format, with a row
+// for each sample. The timestamp and value of the samples are in the timestamp (millisecond precision)
+// and value columns, and each label of the series in a string column named after the label, null for
+// the series without the label. The warnings of the response, if any, are in the "warnings" metadata
+// of the schema, as a JSON array. It returns false if the response can't be encoded, like if it's not
+// a matrix or carries the query stats, in which case it must be encoded in JSON.
+func encodeArrowMatrix(resp *PrometheusResponse) ([]byte, bool) {
+	if resp.Status != StatusSuccess || resp.Data.ResultType != matrix || resp.Data.Stats != nil {
+		return nil, false
+	}
+
+	labelNames := map[string]struct{}{}
+	rows := 0
+	for _, s := range resp.Data.Result {
+		for _, l := range s.Labels {
+			labelNames[l.Name] = struct{}{}
+		}
+		rows += len(s.Samples)
+	}
+	// The labels named like the sample columns can't be represented.
+	if _, ok := labelNames[arrowTimestampColumn]; ok {
+		return nil, false
+	}
+	if _, ok := labelNames[arrowValueColumn]; ok {
+		return nil, false
+	}
+	names := make([]string, 0, len(labelNames))
+	for name := range labelNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var metadata [][2]string
+	if len(resp.Warnings) > 0 {
+		warnings, err := json.Marshal(resp.Warnings)
+		if err != nil {
+			return nil, false
+		}
+		metadata = append(metadata, [2]string{"warnings", string(warnings)})
+	}
+
+	var out []byte
+	out = appendArrowMessage(out, arrowSchemaMessage(names, metadata), nil)
+
+	if rows > 0 {
+		body := &arrowBody{}
+		nodes := make([][2]int64, 0, len(names)+2)
+		for _, name := range names {
+			nullCount, ok := body.addLabelColumn(resp.Data.Result, rows, name)
+			if !ok {
+				return nil, false
+			}
+			nodes = append(nodes, [2]int64{int64(rows), int64(nullCount)})
+		}
+		body.addSampleColumns(resp.Data.Result, rows)
+		nodes = append(nodes, [2]int64{int64(rows), 0}, [2]int64{int64(rows), 0})
+
+		out = appendArrowMessage(out, arrowRecordBatchMessage(int64(rows), nodes, body.buffers, int64(len(body.buf))), body.buf)
+	}
+
+	// End of stream.
+	out = binary.LittleEndian.AppendUint32(out, arrowContinuation)
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	return out, true
+}
+
+// appendArrowMessage appends the encapsulated message, made of its flatbuffers metadata and its body.
+func appendArrowMessage(out, metadata, body []byte) []byte {
+	out = binary.LittleEndian.AppendUint32(out, arrowContinuation)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(metadata)))
+	out = append(out, metadata...)
+	return append(out, body...)
+}
+
+func arrowSchemaMessage(labelNames []string, metadata [][2]string) []byte {
+	b := &flatbuffersBuilder{}
+
+	fields := make([]int, 0, len(labelNames)+2)
+	for _, name := range labelNames {
+		fields = append(fields, b.arrowField(name, true, arrowTypeUtf8, b.arrowUtf8Type()))
+	}
+	fields = append(fields,
+		b.arrowField(arrowTimestampColumn, false, arrowTypeTimestamp, b.arrowTimestampType()),
+		b.arrowField(arrowValueColumn, false, arrowTypeFloatingPoint, b.arrowFloat64Type()),
+	)
+	fieldsVector := b.createOffsetVector(fields)
+
+	metadataVector := 0
+	if len(metadata) > 0 {
+		keyValues := make([]int, 0, len(metadata))
+		for _, kv := range metadata {
+			key, value := b.createString(kv[0]), b.createString(kv[1])
+			b.startTable(2)
+			b.addOffset(0, key)
+			b.addOffset(1, value)
+			keyValues = append(keyValues, b.endTable())
+		}
+		metadataVector = b.createOffsetVector(keyValues)
+	}
+
+	b.startTable(4)
+	b.addOffset(1, fieldsVector)
+	if metadataVector != 0 {
+		b.addOffset(2, metadataVector)
+	}
+	b.addInt16(0, arrowEndiannessLittle)
+	schema := b.endTable()
+
+	return b.arrowMessage(arrowMessageHeaderSchema, schema, 0)
+}
+
+func arrowRecordBatchMessage(length int64, nodes, buffers [][2]int64, bodyLength int64) []byte {
+	b := &flatbuffersBuilder{}
+
+	nodesVector := b.createStructVector(nodes)
+	buffersVector := b.createStructVector(buffers)
+
+	b.startTable(3)
+	b.addInt64(0, length)
+	b.addOffset(1, nodesVector)
+	b.addOffset(2, buffersVector)
+	recordBatch := b.endTable()
+
+	return b.arrowMessage(arrowMessageHeaderRecordBatch, recordBatch, bodyLength)
+}
+
+func (b *flatbuffersBuilder) arrowMessage(headerType uint8, header int, bodyLength int64) []byte {
+	b.startTable(4)
+	b.addInt64(3, bodyLength)
+	b.addOffset(2, header)
+	b.addInt16(0, arrowMetadataV5)
+	b.addUint8(1, headerType)
+	return b.finish(b.endTable())
+}
+
+func (b *flatbuffersBuilder) arrowField(name string, nullable bool, typeType uint8, typ int) int {
+	nameOffset := b.createString(name)
+	// The readers require the children, even if there's none.
+	children := b.createOffsetVector(nil)
+
+	b.startTable(7)
+	b.addOffset(0, nameOffset)
+	b.addOffset(3, typ)
+	b.addOffset(5, children)
+	if nullable {
+		b.addUint8(1, 1)
+	}
+	b.addUint8(2, typeType)
+	return b.endTable()
+}
+
+func (b *flatbuffersBuilder) arrowUtf8Type() int {
+	b.startTable(0)
+	return b.endTable()
+}
+
+func (b *flatbuffersBuilder) arrowTimestampType() int {
+	timezone := b.createString("UTC")
+	b.startTable(2)
+	b.addOffset(1, timezone)
+	b.addInt16(0, arrowTimeUnitMillisecond)
+	return b.endTable()
+}
+
+func (b *flatbuffersBuilder) arrowFloat64Type() int {
+	b.startTable(1)
+	b.addInt16(0, arrowPrecisionDouble)
+	return b.endTable()
+}
+
+// arrowBody is the body of a record batch, made of the buffers of its columns.
+type arrowBody struct {
+	buf []byte
+	// buffers are the offset and length of each buffer in the body.
+	buffers [][2]int64
+}
+
+// addBuffer appends the buffer, padded to 8 bytes as required by the format.
+func (b *arrowBody) addBuffer(data []byte) {
+	offset := len(b.buf)
+	b.buf = append(b.buf, data...)
+	for len(b.buf)%8 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	b.buffers = append(b.buffers, [2]int64{int64(offset), int64(len(data))})
+}
+
+// addLabelColumn adds the validity, offsets and data buffers of the string column of the label.
+// It returns the number of null values, and false if the values are too big for the 32-bit offsets.
+func (b *arrowBody) addLabelColumn(series []tripperware.SampleStream, rows int, name string) (int, bool) {
+	validity := make([]byte, (rows+7)/8)
+	offsets := make([]byte, 0, 4*(rows+1))
+	offsets = binary.LittleEndian.AppendUint32(offsets, 0)
+	var data []byte
+
+	row, nullCount := 0, 0
+	for _, s := range series {
+		value, found := "", false
+		for _, l := range s.Labels {
+			if l.Name == name {
+				value, found = l.Value, true
+				break
+			}
+		}
+		for range s.Samples {
+			if found {
+				validity[row/8] |= 1 << (row % 8)
+				data = append(data, value...)
+				if len(data) > math.MaxInt32 {
+					return 0, false
+				}
+			} else {
+				nullCount++
+			}
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+			row++
+		}
+	}
+
+	b.addBuffer(validity)
+	b.addBuffer(offsets)
+	b.addBuffer(data)
+	return nullCount, true
+}
+
+// addSampleColumns adds the buffers of the timestamp and value columns, which have no nulls
+// and so no validity buffer.
+func (b *arrowBody) addSampleColumns(series []tripperware.SampleStream, rows int) {
+	timestamps := make([]byte, 0, 8*rows)
+	values := make([]byte, 0, 8*rows)
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			timestamps = binary.LittleEndian.AppendUint64(timestamps, uint64(sample.TimestampMs))
+			values = binary.LittleEndian.AppendUint64(values, math.Float64bits(sample.Value))
+		}
+	}
+
+	b.addBuffer(nil)
+	b.addBuffer(timestamps)
+	b.addBuffer(nil)
+	b.addBuffer(values)
+}
+
+// flatbuffersBuilder builds the flatbuffers encoded Arrow metadata. Like the flatbuffers library, it
+// builds the buffer back to front, so that the objects are referenced by the ones built after them
+// with forward offsets. The offsets of the objects are the distance from their start to the end of
+// the buffer.
+type flatbuffersBuilder struct {
+	buf []byte
+
+	// slots are the offsets of the fields of the table being built, 0 for the fields not set.
+	slots    []int
+	tableEnd int
+}
+
+func (b *flatbuffersBuilder) prepend(data ...byte) {
+	buf := make([]byte, 0, len(data)+len(b.buf))
+	b.buf = append(append(buf, data...), b.buf...)
+}
+
+// align pads the buffer so that it's aligned to the alignment once the given number of bytes are prepended.
+func (b *flatbuffersBuilder) align(alignment, additional int) {
+	if pad := (alignment - (len(b.buf)+additional)%alignment) % alignment; pad > 0 {
+		b.prepend(make([]byte, pad)...)
+	}
+}
+
+func (b *flatbuffersBuilder) prependUint16(v uint16) {
+	b.align(2, 0)
+	b.prepend(binary.LittleEndian.AppendUint16(nil, v)...)
+}
+
+func (b *flatbuffersBuilder) prependUint32(v uint32) {
+	b.align(4, 0)
+	b.prepend(binary.LittleEndian.AppendUint32(nil, v)...)
+}
+
+func (b *flatbuffersBuilder) prependUint64(v uint64) {
+	b.align(8, 0)
+	b.prepend(binary.LittleEndian.AppendUint64(nil, v)...)
+}
+
+// prependOffset prepends the offset to the object, relative to the position of the offset itself.
+func (b *flatbuffersBuilder) prependOffset(object int) {
+	b.align(4, 0)
+	b.prependUint32(uint32(len(b.buf) + 4 - object))
+}
+
+func (b *flatbuffersBuilder) createString(s string) int {
+	b.align(4, len(s)+1)
+	b.prepend(0)
+	b.prepend([]byte(s)...)
+	b.prependUint32(uint32(len(s)))
+	return len(b.buf)
+}
+
+func (b *flatbuffersBuilder) createOffsetVector(objects []int) int {
+	b.align(4, 4*len(objects))
+	for i := len(objects) - 1; i >= 0; i-- {
+		b.prependOffset(objects[i])
+	}
+	b.prependUint32(uint32(len(objects)))
+	return len(b.buf)
+}
+
+// createStructVector creates a vector of structs made of two 64-bit integers, like the Arrow
+// FieldNode and Buffer structs.
+func (b *flatbuffersBuilder) createStructVector(structs [][2]int64) int {
+	b.align(4, 16*len(structs))
+	b.align(8, 16*len(structs))
+	for i := len(structs) - 1; i >= 0; i-- {
+		b.prependUint64(uint64(structs[i][1]))
+		b.prependUint64(uint64(structs[i][0]))
+	}
+	b.prependUint32(uint32(len(structs)))
+	return len(b.buf)
+}
+
+func (b *flatbuffersBuilder) startTable(numSlots int) {
+	b.slots = make([]int, numSlots)
+	b.tableEnd = len(b.buf)
+}
+
+func (b *flatbuffersBuilder) addUint8(slot int, v uint8) {
+	b.prepend(v)
+	b.slots[slot] = len(b.buf)
+}
+
+func (b *flatbuffersBuilder) addInt16(slot int, v int16) {
+	b.prependUint16(uint16(v))
+	b.slots[slot] = len(b.buf)
+}
+
+func (b *flatbuffersBuilder) addInt64(slot int, v int64) {
+	b.prependUint64(uint64(v))
+	b.slots[slot] = len(b.buf)
+}
+
+func (b *flatbuffersBuilder) addOffset(slot int, object int) {
+	b.prependOffset(object)
+	b.slots[slot] = len(b.buf)
+}
+
+// endTable writes the table, starting with the offset to its vtable, and its vtable.
+func (b *flatbuffersBuilder) endTable() int {
+	b.prependUint32(0)
+	table := len(b.buf)
+
+	for i := len(b.slots) - 1; i >= 0; i-- {
+		fieldOffset := 0
+		if b.slots[i] != 0 {
+			fieldOffset = table - b.slots[i]
+		}
+		b.prependUint16(uint16(fieldOffset))
+	}
+	b.prependUint16(uint16(table - b.tableEnd))
+	b.prependUint16(uint16(4 + 2*len(b.slots)))
+	vtable := len(b.buf)
+
+	// The table references its vtable with a signed offset, the vtable being before the table.
+	binary.LittleEndian.PutUint32(b.buf[len(b.buf)-table:], uint32(int32(vtable-table)))
+	b.slots = nil
+	return table
+}
+
+// finish writes the offset to the root table, padding the buffer to 8 bytes, as required by
+// the Arrow encapsulated messages.
+func (b *flatbuffersBuilder) finish(root int) []byte {
+	b.align(8, 4)
+	b.prependOffset(root)
+	return b.buf
+}
@@ -0,0 +1,391 @@
+package queryrange
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/tripperware"
+)
+
+func TestEncodeArrowMatrix(t *testing.T) {
+	t.Parallel()
+	resp := &PrometheusResponse{
+		Status: StatusSuccess,
+		Data: PrometheusData{
+			ResultType: matrix,
+			Result: []tripperware.SampleStream{
+				{
+					Labels: []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "job", Value: "ingester"}},
+					Samples: []cortexpb.Sample{
+						{TimestampMs: 1000, Value: 1},
+						{TimestampMs: 2000, Value: 0},
+					},
+				},
+				{
+					Labels: []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "zone", Value: "zone-a"}},
+					Samples: []cortexpb.Sample{
+						{TimestampMs: 1000, Value: math.Inf(1)},
+					},
+				},
+				{
+					Labels: []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}},
+				},
+			},
+		},
+		Warnings: []string{"some warning"},
+	}
+
+	b, ok := encodeArrowMatrix(resp)
+	require.True(t, ok)
+
+	schema, rows := readArrowStream(t, b)
+	assert.Equal(t, []arrowTestField{
+		{name: "__name__", nullable: true, typeType: arrowTypeUtf8},
+		{name: "job", nullable: true, typeType: arrowTypeUtf8},
+		{name: "zone", nullable: true, typeType: arrowTypeUtf8},
+		{name: "timestamp", typeType: arrowTypeTimestamp, timeUnit: arrowTimeUnitMillisecond, timezone: "UTC"},
+		{name: "value", typeType: arrowTypeFloatingPoint, precision: arrowPrecisionDouble},
+	}, schema.fields)
+	assert.Equal(t, map[string]string{"warnings": `["some warning"]`}, schema.metadata)
+	assert.Equal(t, []arrowTestRow{
+		{labels: map[string]string{"__name__": "up", "job": "ingester"}, timestamp: 1000, value: 1},
+		{labels: map[string]string{"__name__": "up", "job": "ingester"}, timestamp: 2000, value: 0},
+		{labels: map[string]string{"__name__": "up", "zone": "zone-a"}, timestamp: 1000, value: math.Inf(1)},
+	}, rows)
+}
+
+func TestEncodeArrowMatrix_EmptyMatrix(t *testing.T) {
+	t.Parallel()
+	b, ok := encodeArrowMatrix(&PrometheusResponse{
+		Status: StatusSuccess,
+		Data:   PrometheusData{ResultType: matrix},
+	})
+	require.True(t, ok)
+
+	schema, rows := readArrowStream(t, b)
+	assert.Equal(t, []arrowTestField{
+		{name: "timestamp", typeType: arrowTypeTimestamp, timeUnit: arrowTimeUnitMillisecond, timezone: "UTC"},
+		{name: "value", typeType: arrowTypeFloatingPoint, precision: arrowPrecisionDouble},
+	}, schema.fields)
+	assert.Empty(t, schema.metadata)
+	assert.Empty(t, rows)
+}
+
+func TestEncodeResponse_ShouldNegotiateTheArrowEncoding(t *testing.T) {
+	t.Parallel()
+	matrixResponse := func(labels ...cortexpb.LabelAdapter) *PrometheusResponse {
+		return &PrometheusResponse{
+			Status: StatusSuccess,
+			Data: PrometheusData{
+				ResultType: matrix,
+				Result: []tripperware.SampleStream{
+					{Labels: labels, Samples: []cortexpb.Sample{{TimestampMs: 1000, Value: 1}}},
+				},
+			},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		accept              string
+		response            *PrometheusResponse
+		expectedContentType string
+	}{
+		"no Accept header": {
+			response:            matrixResponse(cortexpb.LabelAdapter{Name: "foo", Value: "bar"}),
+			expectedContentType: "application/json",
+		},
+		"JSON accepted": {
+			accept:              "application/json",
+			response:            matrixResponse(cortexpb.LabelAdapter{Name: "foo", Value: "bar"}),
+			expectedContentType: "application/json",
+		},
+		"Arrow accepted": {
+			accept:              "application/json;q=0.9, application/vnd.apache.arrow.stream",
+			response:            matrixResponse(cortexpb.LabelAdapter{Name: "foo", Value: "bar"}),
+			expectedContentType: arrowStreamContentType,
+		},
+		"Arrow refused with a zero quality": {
+			accept:              "application/json, application/vnd.apache.arrow.stream;q=0",
+			response:            matrixResponse(cortexpb.LabelAdapter{Name: "foo", Value: "bar"}),
+			expectedContentType: "application/json",
+		},
+		"Arrow accepted but a label collides with the value column": {
+			accept:              arrowStreamContentType,
+			response:            matrixResponse(cortexpb.LabelAdapter{Name: "value", Value: "bar"}),
+			expectedContentType: "application/json",
+		},
+		"Arrow accepted but the response carries the stats": {
+			accept: arrowStreamContentType,
+			response: &PrometheusResponse{
+				Status: StatusSuccess,
+				Data: PrometheusData{
+					ResultType: matrix,
+					Stats:      &tripperware.PrometheusResponseStats{Samples: &tripperware.PrometheusResponseSamplesStats{TotalQueryableSamples: 1}},
+				},
+			},
+			expectedContentType: "application/json",
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := tripperware.ContextWithAcceptHeader(context.Background(), tc.accept)
+			resp, err := PrometheusCodec.EncodeResponse(ctx, tc.response)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedContentType, resp.Header.Get("Content-Type"))
+
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(b)), resp.ContentLength)
+			if tc.expectedContentType == arrowStreamContentType {
+				_, rows := readArrowStream(t, b)
+				assert.Len(t, rows, 1)
+			}
+		})
+	}
+}
+
+type arrowTestField struct {
+	name      string
+	nullable  bool
+	typeType  uint8
+	timeUnit  int16
+	timezone  string
+	precision int16
+}
+
+type arrowTestSchema struct {
+	fields   []arrowTestField
+	metadata map[string]string
+}
+
+type arrowTestRow struct {
+	labels    map[string]string
+	timestamp int64
+	value     float64
+}
+
+// readArrowStream decodes the Arrow IPC stream, expected to contain the schema and at most
+// one record batch of the columns written by encodeArrowMatrix.
+func readArrowStream(t *testing.T, b []byte) (arrowTestSchema, []arrowTestRow) {
+	var (
+		schema arrowTestSchema
+		rows   []arrowTestRow
+	)
+	for i := 0; ; i++ {
+		require.GreaterOrEqual(t, len(b), 8)
+		require.Equal(t, uint32(arrowContinuation), binary.LittleEndian.Uint32(b))
+		metadataLength := int(binary.LittleEndian.Uint32(b[4:]))
+		b = b[8:]
+		if metadataLength == 0 {
+			require.Empty(t, b, "unexpected data after the end of the stream")
+			return schema, rows
+		}
+		require.Zero(t, metadataLength%8, "the metadata must be padded to 8 bytes")
+
+		message := readFlatbuffersRoot(t, b[:metadataLength])
+		assert.Equal(t, int16(arrowMetadataV5), message.int16(0))
+		bodyLength := int(message.int64(3))
+		body := b[metadataLength : metadataLength+bodyLength]
+		b = b[metadataLength+bodyLength:]
+
+		switch i {
+		case 0:
+			require.Equal(t, uint8(arrowMessageHeaderSchema), message.uint8(1))
+			schema = readArrowSchema(message.table(2))
+		case 1:
+			require.Equal(t, uint8(arrowMessageHeaderRecordBatch), message.uint8(1))
+			rows = readArrowRecordBatch(t, schema, message.table(2), body)
+		default:
+			require.Fail(t, "unexpected message")
+		}
+	}
+}
+
+func readArrowSchema(schema flatbuffersTable) arrowTestSchema {
+	var s arrowTestSchema
+	for _, field := range schema.tables(1) {
+		f := arrowTestField{
+			name:     field.string(0),
+			nullable: field.uint8(1) == 1,
+			typeType: field.uint8(2),
+		}
+		switch typ := field.table(3); f.typeType {
+		case arrowTypeTimestamp:
+			f.timeUnit = typ.int16(0)
+			f.timezone = typ.string(1)
+		case arrowTypeFloatingPoint:
+			f.precision = typ.int16(0)
+		}
+		s.fields = append(s.fields, f)
+	}
+	for _, kv := range schema.tables(2) {
+		if s.metadata == nil {
+			s.metadata = map[string]string{}
+		}
+		s.metadata[kv.string(0)] = kv.string(1)
+	}
+	return s
+}
+
+func readArrowRecordBatch(t *testing.T, schema arrowTestSchema, recordBatch flatbuffersTable, body []byte) []arrowTestRow {
+	length := int(recordBatch.int64(0))
+	nodes := recordBatch.structs(1)
+	buffers := recordBatch.structs(2)
+	require.Len(t, nodes, len(schema.fields))
+
+	rows := make([]arrowTestRow, length)
+	buffer := func() []byte {
+		require.NotEmpty(t, buffers)
+		offset, bufferLength := buffers[0][0], buffers[0][1]
+		buffers = buffers[1:]
+		require.Zero(t, offset%8, "the buffers must be aligned to 8 bytes")
+		return body[offset : offset+bufferLength]
+	}
+	for i, field := range schema.fields {
+		require.Equal(t, int64(length), nodes[i][0])
+		validity := buffer()
+		switch field.typeType {
+		case arrowTypeUtf8:
+			offsets, data := buffer(), buffer()
+			nullCount := 0
+			for row := 0; row < length; row++ {
+				if validity[row/8]&(1<<(row%8)) == 0 {
+					nullCount++
+					continue
+				}
+				if rows[row].labels == nil {
+					rows[row].labels = map[string]string{}
+				}
+				start, end := binary.LittleEndian.Uint32(offsets[4*row:]), binary.LittleEndian.Uint32(offsets[4*row+4:])
+				rows[row].labels[field.name] = string(data[start:end])
+			}
+			assert.Equal(t, int64(nullCount), nodes[i][1])
+		case arrowTypeTimestamp:
+			assert.Empty(t, validity)
+			values := buffer()
+			for row := 0; row < length; row++ {
+				rows[row].timestamp = int64(binary.LittleEndian.Uint64(values[8*row:]))
+			}
+		case arrowTypeFloatingPoint:
+			assert.Empty(t, validity)
+			values := buffer()
+			for row := 0; row < length; row++ {
+				rows[row].value = math.Float64frombits(binary.LittleEndian.Uint64(values[8*row:]))
+			}
+		}
+	}
+	assert.Empty(t, buffers)
+	return rows
+}
+
+// flatbuffersTable is a table of a flatbuffers encoded buffer, whose fields are looked up by slot.
+type flatbuffersTable struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func readFlatbuffersRoot(t *testing.T, buf []byte) flatbuffersTable {
+	return flatbuffersTable{t: t, buf: buf, pos: int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of the field in the slot, or 0 if the field is not set.
+func (tb flatbuffersTable) field(slot int) int {
+	vtable := tb.pos - int(int32(binary.LittleEndian.Uint32(tb.buf[tb.pos:])))
+	if 4+2*slot >= int(binary.LittleEndian.Uint16(tb.buf[vtable:])) {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(tb.buf[vtable+4+2*slot:]))
+	if offset == 0 {
+		return 0
+	}
+	return tb.pos + offset
+}
+
+func (tb flatbuffersTable) uint8(slot int) uint8 {
+	if pos := tb.field(slot); pos != 0 {
+		return tb.buf[pos]
+	}
+	return 0
+}
+
+func (tb flatbuffersTable) int16(slot int) int16 {
+	if pos := tb.field(slot); pos != 0 {
+		require.Zero(tb.t, pos%2)
+		return int16(binary.LittleEndian.Uint16(tb.buf[pos:]))
+	}
+	return 0
+}
+
+func (tb flatbuffersTable) int64(slot int) int64 {
+	if pos := tb.field(slot); pos != 0 {
+		require.Zero(tb.t, pos%8, "the 64-bit fields must be aligned to 8 bytes")
+		return int64(binary.LittleEndian.Uint64(tb.buf[pos:]))
+	}
+	return 0
+}
+
+// deref returns the position of the object referenced by the offset at the position.
+func (tb flatbuffersTable) deref(pos int) int {
+	require.Zero(tb.t, pos%4)
+	return pos + int(binary.LittleEndian.Uint32(tb.buf[pos:]))
+}
+
+func (tb flatbuffersTable) table(slot int) flatbuffersTable {
+	pos := tb.field(slot)
+	require.NotZero(tb.t, pos)
+	return flatbuffersTable{t: tb.t, buf: tb.buf, pos: tb.deref(pos)}
+}
+
+func (tb flatbuffersTable) string(slot int) string {
+	pos := tb.field(slot)
+	if pos == 0 {
+		return ""
+	}
+	s := tb.deref(pos)
+	length := int(binary.LittleEndian.Uint32(tb.buf[s:]))
+	require.Equal(tb.t, byte(0), tb.buf[s+4+length], "the strings must be null terminated")
+	return string(tb.buf[s+4 : s+4+length])
+}
+
+// vector returns the position of the first element of the vector and its length.
+func (tb flatbuffersTable) vector(slot int) (int, int) {
+	pos := tb.field(slot)
+	if pos == 0 {
+		return 0, 0
+	}
+	v := tb.deref(pos)
+	return v + 4, int(binary.LittleEndian.Uint32(tb.buf[v:]))
+}
+
+func (tb flatbuffersTable) tables(slot int) []flatbuffersTable {
+	start, length := tb.vector(slot)
+	var tables []flatbuffersTable
+	for i := 0; i < length; i++ {
+		tables = append(tables, flatbuffersTable{t: tb.t, buf: tb.buf, pos: tb.deref(start + 4*i)})
+	}
+	return tables
+}
+
+// structs returns the vector of structs made of two 64-bit integers.
+func (tb flatbuffersTable) structs(slot int) [][2]int64 {
+	start, length := tb.vector(slot)
+	require.Zero(tb.t, start%8, "the structs must be aligned to 8 bytes")
+	structs := make([][2]int64, 0, length)
+	for i := 0; i < length; i++ {
+		pos := start + 16*i
+		structs = append(structs, [2]int64{
+			int64(binary.LittleEndian.Uint64(tb.buf[pos:])),
+			int64(binary.LittleEndian.Uint64(tb.buf[pos+8:])),
+		})
+	}
+	return structs
+}
@@ -74,6 +74,27 @@ func (l limitsMiddleware) Do(ctx context.Context, r tripperware.Request) (trippe
 		}
 	}
 
+	// Enforce the min query step.
+	if minStep := validation.MaxDurationPerTenant(tenantIDs, l.MinQueryStep); minStep > 0 {
+		step := time.Duration(r.GetStep()) * time.Millisecond
+		if step < minStep {
+			if !l.clampStep(tenantIDs) {
+				return nil, httpgrpc.Errorf(http.StatusBadRequest, validation.ErrQueryStepTooSmall, step, minStep)
+			}
+
+			if promReq, ok := r.(*PrometheusRequest); ok {
+				level.Debug(log).Log(
+					"msg", "the step of the query has been increased because of the 'min query step' setting",
+					"original", step,
+					"updated", minStep)
+
+				clamped := *promReq
+				clamped.Step = minStep.Milliseconds()
+				r = &clamped
+			}
+		}
+	}
+
 	// Enforce the max query length.
 	maxQueryLength := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxQueryLength)
 	if maxQueryLength > 0 {
@@ -95,5 +116,44 @@ func (l limitsMiddleware) Do(ctx context.Context, r tripperware.Request) (trippe
 		}
 	}
 
-	return l.next.Do(ctx, r)
+	resp, err := l.next.Do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enforce the max number of samples in the response. This catches queries running
+	// with a too small step over a large time range, so we suggest a larger step.
+	if maxSamples := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, l.MaxSamplesPerQueryResponse); maxSamples > 0 {
+		if numSamples := countResponseSamples(resp); numSamples > maxSamples {
+			step := time.Duration(r.GetStep()) * time.Millisecond
+			return nil, httpgrpc.Errorf(http.StatusUnprocessableEntity, validation.ErrTooManySamplesInResponse, numSamples, maxSamples, step)
+		}
+	}
+
+	return resp, nil
+}
+
+// clampStep returns whether the query step should be increased to the min query step, instead of
+// rejecting the query. The query is rejected if any of the tenants rejects it.
+func (l limitsMiddleware) clampStep(tenantIDs []string) bool {
+	for _, tenantID := range tenantIDs {
+		if l.MinQueryStepPolicy(tenantID) != validation.MinQueryStepPolicyClamp {
+			return false
+		}
+	}
+	return true
+}
+
+// countResponseSamples returns the number of samples across all series in the response.
+func countResponseSamples(resp tripperware.Response) int {
+	promResp, ok := resp.(*PrometheusResponse)
+	if !ok {
+		return 0
+	}
+
+	count := 0
+	for _, stream := range promResp.Data.Result {
+		count += len(stream.Samples)
+	}
+	return count
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -13,6 +14,7 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
 
+	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/querier/tripperware"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/validation"
@@ -226,10 +228,173 @@ func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 	}
 }
 
+func TestLimitsMiddleware_MinQueryStep(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		minStep       time.Duration
+		minStepPolicy string
+		reqStep       time.Duration
+		expectedStep  time.Duration
+		expectedErr   string
+	}{
+		"should skip validation if min step is disabled": {
+			reqStep:      time.Second,
+			expectedStep: time.Second,
+		},
+		"should succeed on a query with step equal to the min step": {
+			minStep:       time.Minute,
+			minStepPolicy: validation.MinQueryStepPolicyReject,
+			reqStep:       time.Minute,
+			expectedStep:  time.Minute,
+		},
+		"should fail on a query with step smaller than the min step": {
+			minStep:       time.Minute,
+			minStepPolicy: validation.MinQueryStepPolicyReject,
+			reqStep:       time.Second,
+			expectedErr:   "the query step (1s) is smaller than the minimum query step (1m0s), consider increasing the query step",
+		},
+		"should increase the step of a query with step smaller than the min step": {
+			minStep:       time.Minute,
+			minStepPolicy: validation.MinQueryStepPolicyClamp,
+			reqStep:       time.Second,
+			expectedStep:  time.Minute,
+		},
+		"should not change the step of a query with step larger than the min step": {
+			minStep:       time.Minute,
+			minStepPolicy: validation.MinQueryStepPolicyClamp,
+			reqStep:       time.Hour,
+			expectedStep:  time.Hour,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Now()
+			req := &PrometheusRequest{
+				Query: "up",
+				Start: util.TimeToMillis(now.Add(-time.Hour)),
+				End:   util.TimeToMillis(now),
+				Step:  testData.reqStep.Milliseconds(),
+			}
+
+			limits := mockLimits{minStep: testData.minStep, minStepPolicy: testData.minStepPolicy}
+			middleware := NewLimitsMiddleware(limits, 5*time.Minute)
+
+			innerRes := NewEmptyPrometheusResponse()
+			inner := &mockHandler{}
+			inner.On("Do", mock.Anything, mock.Anything).Return(innerRes, nil)
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			outer := middleware.Wrap(inner)
+			res, err := outer.Do(ctx, req)
+
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				assert.Nil(t, res)
+				assert.Len(t, inner.Calls, 0)
+			} else {
+				require.NoError(t, err)
+				assert.Same(t, innerRes, res)
+
+				require.Len(t, inner.Calls, 1)
+				assert.Equal(t, testData.expectedStep.Milliseconds(), inner.Calls[0].Arguments.Get(1).(tripperware.Request).GetStep())
+				// The original request is not modified.
+				assert.Equal(t, testData.reqStep.Milliseconds(), req.Step)
+			}
+		})
+	}
+}
+
+func TestLimitsMiddleware_MaxSamplesPerQueryResponse(t *testing.T) {
+	t.Parallel()
+
+	// Two series with 3 samples each.
+	innerRes := &PrometheusResponse{
+		Status: StatusSuccess,
+		Data: PrometheusData{
+			ResultType: model.ValMatrix.String(),
+			Result: []tripperware.SampleStream{
+				{
+					Labels:  []cortexpb.LabelAdapter{{Name: "a", Value: "1"}},
+					Samples: []cortexpb.Sample{{TimestampMs: 0, Value: 1}, {TimestampMs: 1000, Value: 2}, {TimestampMs: 2000, Value: 3}},
+				},
+				{
+					Labels:  []cortexpb.LabelAdapter{{Name: "a", Value: "2"}},
+					Samples: []cortexpb.Sample{{TimestampMs: 0, Value: 1}, {TimestampMs: 1000, Value: 2}, {TimestampMs: 2000, Value: 3}},
+				},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		maxSamples  int
+		expectedErr string
+	}{
+		"should succeed if the limit is disabled": {
+			maxSamples: 0,
+		},
+		"should succeed if the response has less samples than the limit": {
+			maxSamples: 10,
+		},
+		"should succeed if the response has exactly the limit of samples": {
+			maxSamples: 6,
+		},
+		"should fail if the response has more samples than the limit": {
+			maxSamples:  5,
+			expectedErr: httpgrpc.Errorf(http.StatusUnprocessableEntity, validation.ErrTooManySamplesInResponse, 6, 5, time.Second).Error(),
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			req := &PrometheusRequest{
+				Query: "up",
+				Start: 0,
+				End:   2000,
+				Step:  1000,
+			}
+
+			limits := mockLimits{maxSamples: testData.maxSamples}
+			middleware := NewLimitsMiddleware(limits, 5*time.Minute)
+
+			inner := &mockHandler{}
+			inner.On("Do", mock.Anything, mock.Anything).Return(innerRes, nil)
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			outer := middleware.Wrap(inner)
+			res, err := outer.Do(ctx, req)
+
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, testData.expectedErr, err.Error())
+				assert.Contains(t, err.Error(), "consider increasing the query step")
+				assert.Nil(t, res)
+			} else {
+				require.NoError(t, err)
+				assert.Same(t, innerRes, res)
+			}
+			require.Len(t, inner.Calls, 1)
+		})
+	}
+}
+
 type mockLimits struct {
 	maxQueryLookback  time.Duration
 	maxQueryLength    time.Duration
 	maxCacheFreshness time.Duration
+	maxSamples        int
+	minStep           time.Duration
+	minStepPolicy     string
+	partialResults    bool
+	splitMinRange     time.Duration
+	maxSplitQueries   int
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -248,10 +413,38 @@ func (m mockLimits) MaxCacheFreshness(string) time.Duration {
 	return m.maxCacheFreshness
 }
 
+func (m mockLimits) MaxSamplesPerQueryResponse(string) int {
+	return m.maxSamples
+}
+
+func (m mockLimits) MinQueryStep(string) time.Duration {
+	return m.minStep
+}
+
+func (m mockLimits) MinQueryStepPolicy(string) string {
+	return m.minStepPolicy
+}
+
 func (m mockLimits) QueryVerticalShardSize(userID string) int {
 	return 0
 }
 
+func (m mockLimits) QueryPartialResults(string) bool {
+	return m.partialResults
+}
+
+func (m mockLimits) SplitQueriesMinRange(string) time.Duration {
+	return m.splitMinRange
+}
+
+func (m mockLimits) MaxSplitQueries(string) int {
+	return m.maxSplitQueries
+}
+
+func (m mockLimits) SortInstantQueryResults(string) bool {
+	return false
+}
+
 func (m mockLimits) QueryPriority(userID string) validation.QueryPriority {
 	return validation.QueryPriority{}
 }
@@ -0,0 +1,79 @@
+package queryrange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weaveworks/common/httpgrpc"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/querier/tripperware"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// partialResultWarningPrefix prefixes the warnings of the responses missing some results.
+const partialResultWarningPrefix = "partial result: "
+
+// allowPartialResults returns whether partial results can be returned for the query,
+// which is the case only if all the tenants allow them.
+func allowPartialResults(tenantIDs []string, limits tripperware.Limits) bool {
+	for _, tenantID := range tenantIDs {
+		if !limits.QueryPartialResults(tenantID) {
+			return false
+		}
+	}
+	return len(tenantIDs) > 0
+}
+
+// partialResultsHandler turns the server errors of the downstream range queries into
+// empty responses with a warning, so that the results of the other split queries are
+// returned. The client errors, like an invalid query or a limit hit, still fail the query.
+type partialResultsHandler struct {
+	next tripperware.Handler
+
+	// Whether any of the downstream queries succeeded, and the last server error otherwise,
+	// so that the query fails if it has no result at all.
+	succeeded atomic.Bool
+	lastErr   atomic.Error
+}
+
+func (h *partialResultsHandler) Do(ctx context.Context, r tripperware.Request) (tripperware.Response, error) {
+	resp, err := h.next.Do(ctx, r)
+	if err == nil {
+		h.succeeded.Store(true)
+	}
+	if err == nil || ctx.Err() != nil || !isServerError(err) {
+		return resp, err
+	}
+	h.lastErr.Store(err)
+
+	resp = NewEmptyPrometheusResponse()
+	resp.(*PrometheusResponse).Warnings = []string{fmt.Sprintf("%sthe query for the time range %s to %s failed: %s",
+		partialResultWarningPrefix,
+		util.TimeFromMillis(r.GetStart()).UTC().Format(time.RFC3339),
+		util.TimeFromMillis(r.GetEnd()).UTC().Format(time.RFC3339),
+		err)}
+	return resp, nil
+}
+
+// err returns the error of the downstream queries if none of them succeeded, nil otherwise.
+func (h *partialResultsHandler) err() error {
+	if h.succeeded.Load() {
+		return nil
+	}
+	return h.lastErr.Load()
+}
+
+// isServerError returns whether the error is not caused by the request, so that the
+// query may succeed if retried.
+func isServerError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if resp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+		return resp.Code/100 == 5
+	}
+	return true
+}
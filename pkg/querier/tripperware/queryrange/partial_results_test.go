@@ -0,0 +1,80 @@
+package queryrange
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/tripperware"
+)
+
+func TestSplitByInterval_PartialResults(t *testing.T) {
+	t.Parallel()
+
+	sample := tripperware.SampleStream{
+		Labels:  []cortexpb.LabelAdapter{{Name: "__name__", Value: "foo"}},
+		Samples: []cortexpb.Sample{{TimestampMs: 0, Value: 1}},
+	}
+
+	// The split query of the second day fails.
+	downstreamErr := httpgrpc.Errorf(http.StatusInternalServerError, "store-gateway unavailable")
+	next := tripperware.HandlerFunc(func(_ context.Context, r tripperware.Request) (tripperware.Response, error) {
+		if r.GetStart() >= 24*3600*seconds {
+			return nil, downstreamErr
+		}
+		resp := NewEmptyPrometheusResponse()
+		resp.Data.Result = []tripperware.SampleStream{sample}
+		return resp, nil
+	})
+
+	req := &PrometheusRequest{Start: 0, End: 2*24*3600*seconds - 15*seconds, Step: 15 * seconds, Query: "foo"}
+	interval := func(_ tripperware.Request) time.Duration { return 24 * time.Hour }
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	t.Run("should fail the query if partial results are disabled", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := SplitByIntervalMiddleware(interval, mockLimits{}, PrometheusCodec, nil).Wrap(next).Do(ctx, req)
+		assert.Equal(t, downstreamErr, err)
+	})
+
+	t.Run("should return the successful results with a warning if partial results are enabled", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := SplitByIntervalMiddleware(interval, mockLimits{partialResults: true}, PrometheusCodec, nil).Wrap(next).Do(ctx, req)
+		require.NoError(t, err)
+
+		promResp := resp.(*PrometheusResponse)
+		assert.Equal(t, []tripperware.SampleStream{sample}, promResp.Data.Result)
+		assert.Equal(t, []string{"partial result: the query for the time range 1970-01-02T00:00:00Z to 1970-01-02T23:59:45Z failed: rpc error: code = Code(500) desc = store-gateway unavailable"}, promResp.Warnings)
+	})
+
+	t.Run("should fail the query on client errors even if partial results are enabled", func(t *testing.T) {
+		t.Parallel()
+
+		clientErr := httpgrpc.Errorf(http.StatusUnprocessableEntity, "query limit hit")
+		failing := tripperware.HandlerFunc(func(context.Context, tripperware.Request) (tripperware.Response, error) {
+			return nil, clientErr
+		})
+		_, err := SplitByIntervalMiddleware(interval, mockLimits{partialResults: true}, PrometheusCodec, nil).Wrap(failing).Do(ctx, req)
+		assert.Equal(t, clientErr, err)
+	})
+
+	t.Run("should fail the query if all the split queries failed even if partial results are enabled", func(t *testing.T) {
+		t.Parallel()
+
+		failing := tripperware.HandlerFunc(func(context.Context, tripperware.Request) (tripperware.Response, error) {
+			return nil, downstreamErr
+		})
+		_, err := SplitByIntervalMiddleware(interval, mockLimits{partialResults: true}, PrometheusCodec, nil).Wrap(failing).Do(ctx, req)
+		assert.Equal(t, downstreamErr, err)
+	})
+
+}
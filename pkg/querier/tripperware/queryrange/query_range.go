@@ -298,6 +298,22 @@ func (prometheusCodec) EncodeResponse(ctx context.Context, res tripperware.Respo
 
 	sp.LogFields(otlog.Int("series", len(a.Data.Result)))
 
+	// Encode the matrices as Arrow IPC streams for the clients accepting them, falling back to JSON
+	// for the responses that can't be encoded this way.
+	if tripperware.AcceptsContentType(ctx, arrowStreamContentType) {
+		if b, ok := encodeArrowMatrix(a); ok {
+			sp.LogFields(otlog.Int("bytes", len(b)))
+			return &http.Response{
+				Header: http.Header{
+					"Content-Type": []string{arrowStreamContentType},
+				},
+				Body:          io.NopCloser(bytes.NewBuffer(b)),
+				StatusCode:    http.StatusOK,
+				ContentLength: int64(len(b)),
+			}, nil
+		}
+	}
+
 	b, err := json.Marshal(a)
 	if err != nil {
 		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "error encoding response: %v", err)
@@ -139,7 +139,28 @@ type constSplitter time.Duration
 // GenerateCacheKey generates a cache key based on the userID, Request and interval.
 func (t constSplitter) GenerateCacheKey(userID string, r tripperware.Request) string {
 	currentInterval := r.GetStart() / int64(time.Duration(t)/time.Millisecond)
-	return fmt.Sprintf("%s:%s:%d:%d", userID, r.GetQuery(), r.GetStep(), currentInterval)
+	key := fmt.Sprintf("%s:%s:%d:%d", userID, r.GetQuery(), r.GetStep(), currentInterval)
+
+	// The queried blocks are restricted by the block sources, so their results are cached separately.
+	if sources := requestBlockSources(r); sources != "" {
+		key = fmt.Sprintf("%s:%s", key, sources)
+	}
+	return key
+}
+
+// requestBlockSources returns the value of the block sources header of the request, if any.
+func requestBlockSources(r tripperware.Request) string {
+	promReq, ok := r.(*PrometheusRequest)
+	if !ok {
+		return ""
+	}
+
+	for _, header := range promReq.Headers {
+		if strings.EqualFold(header.Name, querier.BlockSourcesHeader) {
+			return strings.Join(header.Values, ",")
+		}
+	}
+	return ""
 }
 
 // ShouldCacheFn checks whether the current request should go to cache
@@ -1004,6 +1004,60 @@ func TestResultsCache(t *testing.T) {
 	require.Equal(t, 2, calls)
 }
 
+func TestResultsCache_RollingRangeReusesAlignedBuckets(t *testing.T) {
+	t.Parallel()
+	cfg := ResultsCacheConfig{
+		CacheConfig: cache.Config{
+			Cache: cache.NewMockCache(),
+		},
+	}
+	rcm, _, err := NewResultsCacheMiddleware(
+		log.NewNopLogger(),
+		cfg,
+		constSplitter(day),
+		mockLimits{},
+		PrometheusCodec,
+		PrometheusResponseExtractor{},
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+
+	var downstream []tripperware.Request
+	staticIntervalFn := func(_ tripperware.Request) time.Duration { return day }
+	rc := tripperware.MergeMiddlewares(
+		SplitByIntervalMiddleware(staticIntervalFn, mockLimits{}, PrometheusCodec, nil),
+		rcm,
+	).Wrap(tripperware.HandlerFunc(func(_ context.Context, req tripperware.Request) (tripperware.Response, error) {
+		downstream = append(downstream, req)
+		return mkAPIResponse(req.GetStart(), req.GetEnd(), req.GetStep()), nil
+	}))
+	ctx := user.InjectOrgID(context.Background(), "1")
+
+	// A 3 days range query starting in the middle of a day, as issued by a dashboard.
+	const step = int64(time.Minute / time.Millisecond)
+	start := int64(10*day/time.Millisecond) + 17*step
+	end := start + int64(3*day/time.Millisecond)
+	req := &PrometheusRequest{Path: "/api/v1/query_range", Start: start, End: end, Step: step, Query: "sum(rate(foo[1m]))"}
+
+	resp, err := rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, downstream, 4)
+	require.Equal(t, mkAPIResponse(start, end, step), resp)
+
+	// The same range shifted by one hour, as "now" moves forward. The split queries are aligned
+	// to the day buckets since epoch, so the historical buckets are served from the cache and only
+	// the newly covered hour is queried.
+	downstream = nil
+	shift := int64(time.Hour / time.Millisecond)
+	resp, err = rc.Do(ctx, req.WithStartEnd(start+shift, end+shift))
+	require.NoError(t, err)
+	require.Len(t, downstream, 1)
+	require.Greater(t, downstream[0].GetStart(), end-step)
+	require.Equal(t, end+shift, downstream[0].GetEnd())
+	require.Equal(t, mkAPIResponse(start+shift, end+shift, step), resp)
+}
+
 func TestResultsCacheRecent(t *testing.T) {
 	t.Parallel()
 	var cfg ResultsCacheConfig
@@ -1169,6 +1223,9 @@ func TestConstSplitter_generateCacheKey(t *testing.T) {
 		{"<1d", &PrometheusRequest{Start: toMs(22 * time.Hour), Step: 10, Query: "foo{}"}, 24 * time.Hour, "fake:foo{}:10:0"},
 		{"4d", &PrometheusRequest{Start: toMs(4 * 24 * time.Hour), Step: 10, Query: "foo{}"}, 24 * time.Hour, "fake:foo{}:10:4"},
 		{"3d5h", &PrometheusRequest{Start: toMs(77 * time.Hour), Step: 10, Query: "foo{}"}, 24 * time.Hour, "fake:foo{}:10:3"},
+		{"block sources", &PrometheusRequest{Start: 0, Step: 10, Query: "foo{}", Headers: []*tripperware.PrometheusRequestHeader{
+			{Name: "X-Cortex-Block-Sources", Values: []string{"ingester,backfill"}},
+		}}, 30 * time.Minute, "fake:foo{}:10:0:ingester,backfill"},
 	}
 	for _, tt := range tests {
 		tt := tt
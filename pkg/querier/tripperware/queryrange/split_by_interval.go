@@ -11,6 +11,8 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 
 	"github.com/cortexproject/cortex/pkg/querier/tripperware"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 type IntervalFn func(r tripperware.Request) time.Duration
@@ -28,6 +30,11 @@ func SplitByIntervalMiddleware(interval IntervalFn, limits tripperware.Limits, m
 				Name:      "frontend_split_queries_total",
 				Help:      "Total number of underlying query requests after the split by interval is applied",
 			}),
+			splitSkippedCounter: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+				Namespace: "cortex",
+				Name:      "frontend_split_skipped_queries_total",
+				Help:      "Total number of queries not split by interval because their time range is shorter than the split queries min range",
+			}),
 		}
 	})
 }
@@ -39,22 +46,55 @@ type splitByInterval struct {
 	interval IntervalFn
 
 	// Metrics.
-	splitByCounter prometheus.Counter
+	splitByCounter      prometheus.Counter
+	splitSkippedCounter prometheus.Counter
 }
 
 func (s splitByInterval) Do(ctx context.Context, r tripperware.Request) (tripperware.Response, error) {
-	// First we're going to build new requests, one for each day, taking care
-	// to line up the boundaries with step.
-	reqs, err := splitQuery(r, s.interval(r))
+	tenantIDs, err := tenant.TenantIDs(ctx)
 	if err != nil {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
 	}
+
+	var reqs []tripperware.Request
+	if minRange := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, s.limits.SplitQueriesMinRange); minRange > 0 && time.Duration(r.GetEnd()-r.GetStart())*time.Millisecond < minRange {
+		// The query is too short to benefit from the split.
+		reqs = []tripperware.Request{r}
+		s.splitSkippedCounter.Inc()
+	} else {
+		// First we're going to build new requests, one for each day, taking care
+		// to line up the boundaries with step.
+		reqs, err = splitQuery(r, s.interval(r))
+		if err != nil {
+			return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+		}
+
+		// The split queries are checked before any of them is executed.
+		if maxSplitQueries := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.MaxSplitQueries); maxSplitQueries > 0 && len(reqs) > maxSplitQueries {
+			return nil, httpgrpc.Errorf(http.StatusBadRequest, validation.ErrTooManySplitQueries, len(reqs), maxSplitQueries)
+		}
+	}
 	s.splitByCounter.Add(float64(len(reqs)))
 
-	reqResps, err := tripperware.DoRequests(ctx, s.next, reqs, s.limits)
+	partialResults := allowPartialResults(tenantIDs, s.limits)
+
+	next := s.next
+	var partialResultsNext *partialResultsHandler
+	if partialResults {
+		partialResultsNext = &partialResultsHandler{next: next}
+		next = partialResultsNext
+	}
+
+	reqResps, err := tripperware.DoRequests(ctx, next, reqs, s.limits)
 	if err != nil {
 		return nil, err
 	}
+	if partialResults {
+		// There is no result to return if all the split queries failed.
+		if err := partialResultsNext.err(); err != nil {
+			return nil, err
+		}
+	}
 
 	resps := make([]tripperware.Response, 0, len(reqResps))
 	for _, reqResp := range reqResps {
@@ -282,11 +282,24 @@ func TestSplitByDay(t *testing.T) {
 	mergedHTTPResponseBody, err := io.ReadAll(mergedHTTPResponse.Body)
 	require.NoError(t, err)
 
+	singleResponse, err := PrometheusCodec.MergeResponse(context.Background(), nil, parsedResponse)
+	require.NoError(t, err)
+
+	singleHTTPResponse, err := PrometheusCodec.EncodeResponse(context.Background(), singleResponse)
+	require.NoError(t, err)
+
+	singleHTTPResponseBody, err := io.ReadAll(singleHTTPResponse.Body)
+	require.NoError(t, err)
+
 	for i, tc := range []struct {
 		path, expectedBody string
 		expectedQueryCount int32
+		splitMinRange      time.Duration
 	}{
-		{query, string(mergedHTTPResponseBody), 2},
+		{query, string(mergedHTTPResponseBody), 2, 0},
+		{query, string(mergedHTTPResponseBody), 2, 6 * time.Hour},
+		// The query time range is shorter than the split queries min range, so it's not split.
+		{query, string(singleHTTPResponseBody), 1, 24 * time.Hour},
 	} {
 		tc := tc
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
@@ -309,7 +322,7 @@ func TestSplitByDay(t *testing.T) {
 			roundtripper := tripperware.NewRoundTripper(singleHostRoundTripper{
 				host: u.Host,
 				next: http.DefaultTransport,
-			}, PrometheusCodec, nil, NewLimitsMiddleware(mockLimits{}, 5*time.Minute), SplitByIntervalMiddleware(interval, mockLimits{}, PrometheusCodec, nil))
+			}, PrometheusCodec, nil, NewLimitsMiddleware(mockLimits{}, 5*time.Minute), SplitByIntervalMiddleware(interval, mockLimits{splitMinRange: tc.splitMinRange}, PrometheusCodec, nil))
 
 			req, err := http.NewRequest("GET", tc.path, http.NoBody)
 			require.NoError(t, err)
@@ -329,6 +342,32 @@ func TestSplitByDay(t *testing.T) {
 	}
 }
 
+func TestSplitByInterval_MaxSplitQueries(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	next := tripperware.HandlerFunc(func(context.Context, tripperware.Request) (tripperware.Response, error) {
+		calls.Inc()
+		return NewEmptyPrometheusResponse(), nil
+	})
+
+	// The query is split into 3 queries, one per day.
+	req := &PrometheusRequest{Start: 0, End: 3*24*3600*seconds - 15*seconds, Step: 15 * seconds, Query: "foo"}
+	interval := func(_ tripperware.Request) time.Duration { return 24 * time.Hour }
+	ctx := user.InjectOrgID(context.Background(), "1")
+
+	for _, maxSplitQueries := range []int{0, 3} {
+		_, err := SplitByIntervalMiddleware(interval, mockLimits{maxSplitQueries: maxSplitQueries}, PrometheusCodec, nil).Wrap(next).Do(ctx, req)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(6), calls.Load())
+
+	// None of the split queries is executed if they exceed the limit.
+	_, err := SplitByIntervalMiddleware(interval, mockLimits{maxSplitQueries: 2}, PrometheusCodec, nil).Wrap(next).Do(ctx, req)
+	require.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, "the query would be split into 3 queries, exceeding the limit of 2 split queries, consider increasing the query step, reducing the query time range or increasing the split interval"), err)
+	require.Equal(t, int32(6), calls.Load())
+}
+
 func Test_evaluateAtModifier(t *testing.T) {
 	t.Parallel()
 	const (
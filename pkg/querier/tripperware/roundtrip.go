@@ -19,6 +19,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -216,7 +217,41 @@ func (q roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
-	return q.codec.EncodeResponse(r.Context(), response)
+	// The codec negotiates the encoding of the response with the Accept header of the request.
+	return q.codec.EncodeResponse(ContextWithAcceptHeader(r.Context(), r.Header.Get("Accept")), response)
+}
+
+type acceptHeaderContextKey int
+
+const acceptHeaderKey acceptHeaderContextKey = 0
+
+// ContextWithAcceptHeader returns a context carrying the Accept header of the request whose
+// response is encoded.
+func ContextWithAcceptHeader(ctx context.Context, accept string) context.Context {
+	return context.WithValue(ctx, acceptHeaderKey, accept)
+}
+
+// AcceptsContentType returns whether the Accept header carried by the context, if any, lists
+// the content type with a non-zero quality.
+func AcceptsContentType(ctx context.Context, contentType string) bool {
+	accept, _ := ctx.Value(acceptHeaderKey).(string)
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), contentType) {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(name) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if accepted {
+			return true
+		}
+	}
+	return false
 }
 
 // Do implements Handler.
@@ -476,8 +476,12 @@ type mockLimits struct {
 	maxQueryLookback  time.Duration
 	maxQueryLength    time.Duration
 	maxCacheFreshness time.Duration
+	maxSamples        int
+	minStep           time.Duration
+	minStepPolicy     string
 	shardSize         int
 	queryPriority     validation.QueryPriority
+	sortResults       bool
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -496,10 +500,38 @@ func (m mockLimits) MaxCacheFreshness(string) time.Duration {
 	return m.maxCacheFreshness
 }
 
+func (m mockLimits) MaxSamplesPerQueryResponse(string) int {
+	return m.maxSamples
+}
+
+func (m mockLimits) MinQueryStep(string) time.Duration {
+	return m.minStep
+}
+
+func (m mockLimits) MinQueryStepPolicy(string) string {
+	return m.minStepPolicy
+}
+
 func (m mockLimits) QueryVerticalShardSize(userID string) int {
 	return m.shardSize
 }
 
+func (m mockLimits) QueryPartialResults(string) bool {
+	return false
+}
+
+func (m mockLimits) SplitQueriesMinRange(string) time.Duration {
+	return 0
+}
+
+func (m mockLimits) MaxSplitQueries(string) int {
+	return 0
+}
+
+func (m mockLimits) SortInstantQueryResults(string) bool {
+	return m.sortResults
+}
+
 func (m mockLimits) QueryPriority(userID string) validation.QueryPriority {
 	return m.queryPriority
 }
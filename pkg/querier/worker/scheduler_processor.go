@@ -221,7 +221,7 @@ func (sp *schedulerProcessor) runRequest(ctx context.Context, logger log.Logger,
 }
 
 func (sp *schedulerProcessor) createFrontendClient(addr string) (client.PoolClient, error) {
-	opts, err := sp.grpcConfig.DialOption([]grpc.UnaryClientInterceptor{
+	opts, err := sp.grpcConfig.DialOptionForTarget(addr, []grpc.UnaryClientInterceptor{
 		otgrpc.OpenTracingClientInterceptor(opentracing.GlobalTracer()),
 		middleware.ClientUserHeaderInterceptor,
 		cortexmiddleware.PrometheusGRPCUnaryInstrumentation(sp.frontendClientRequestDuration),
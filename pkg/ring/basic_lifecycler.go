@@ -91,9 +91,15 @@ type BasicLifecycler struct {
 
 // NewBasicLifecycler makes a new BasicLifecycler.
 func NewBasicLifecycler(cfg BasicLifecyclerConfig, ringName, ringKey string, store kv.Client, delegate BasicLifecyclerDelegate, logger log.Logger, reg prometheus.Registerer) (*BasicLifecycler, error) {
-	tg := NewRandomTokenGenerator()
-	if strings.EqualFold(cfg.TokensGeneratorStrategy, minimizeSpreadTokenStrategy) {
-		tg = NewMinimizeSpreadTokenGenerator()
+	// The spread-minimizing token generator needs all the zones of the ring to compute distinct
+	// tokens for each zone, which the basic lifecycler isn't configured with.
+	if strings.EqualFold(cfg.TokensGeneratorStrategy, spreadMinimizingTokenStrategy) {
+		return nil, errSpreadMinimizingUnsupported
+	}
+
+	tg, err := newTokenGenerator(cfg.TokensGeneratorStrategy, cfg.ID, cfg.Zone, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	l := &BasicLifecycler{
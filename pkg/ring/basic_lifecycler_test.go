@@ -432,6 +432,14 @@ func TestBasicLifecycler_updateInstance_ShouldAddInstanceToTheRingIfDoesNotExist
 	assert.Equal(t, expectedRegisteredAt.Unix(), desc.GetRegisteredAt().Unix())
 }
 
+func TestBasicLifecycler_ShouldRejectTheSpreadMinimizingTokenGeneratorStrategy(t *testing.T) {
+	cfg := prepareBasicLifecyclerConfig()
+	cfg.TokensGeneratorStrategy = spreadMinimizingTokenStrategy
+
+	_, _, _, err := prepareBasicLifecycler(t, cfg)
+	assert.Equal(t, errSpreadMinimizingUnsupported, err)
+}
+
 func prepareBasicLifecyclerConfig() BasicLifecyclerConfig {
 	return BasicLifecyclerConfig{
 		ID:                  testInstanceID,
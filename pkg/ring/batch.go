@@ -2,6 +2,7 @@ package ring
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/httpgrpcutil"
 )
 
+var errZoneQuorumUnreachable = errors.New("zone quorum not reached: not enough healthy instances in the zones")
+
 type batchTracker struct {
 	rpcsPending atomic.Int32
 	rpcsFailed  atomic.Int32
@@ -24,6 +27,20 @@ type instance struct {
 	indexes      []int
 }
 
+// ZoneQuorum is the quorum of the zones of the replicas a batch of items is written to.
+type ZoneQuorum int
+
+const (
+	// NoZoneQuorum requires the items to be written to a quorum of their replicas, regardless
+	// of their zones.
+	NoZoneQuorum ZoneQuorum = iota
+	// EachZoneQuorum requires the items to be written to at least one replica in each zone.
+	EachZoneQuorum
+	// AllButOneZoneQuorum requires the items to be written to all the replicas, except the
+	// ones of at most one zone.
+	AllButOneZoneQuorum
+)
+
 type itemTracker struct {
 	minSuccess  int
 	maxFailures int
@@ -33,6 +50,121 @@ type itemTracker struct {
 	remaining   atomic.Int32
 	err4xx      atomic.Error
 	err5xx      atomic.Error
+
+	// zones tracks the zone quorum of the item, if any.
+	zones *zoneTracker
+}
+
+// zoneTracker tracks the writes of an item to the replicas of each zone.
+type zoneTracker struct {
+	quorum ZoneQuorum
+
+	mtx     sync.Mutex
+	zones   []zoneReplicas
+	decided bool
+}
+
+type zoneReplicas struct {
+	zone                          string
+	replicas, succeeded, failures int
+}
+
+// newZoneTracker returns the zoneTracker of an item written to the healthy instances of its replica
+// set, or nil if the replica set doesn't span multiple zones. The zones of the replica set and their
+// number of replicas are the ones of the ring, as filled in bufZones by ReadRing.Get(), so that the
+// zones without healthy instances are accounted as failed.
+func newZoneTracker(quorum ZoneQuorum, bufZones map[string]int, instances []InstanceDesc) *zoneTracker {
+	t := &zoneTracker{quorum: quorum}
+	for zone, replicas := range bufZones {
+		if replicas > 0 {
+			t.zone(zone).replicas = replicas
+		}
+	}
+
+	healthy := make(map[string]int, len(t.zones))
+	for _, instance := range instances {
+		healthy[instance.Zone]++
+	}
+	for zone, replicas := range healthy {
+		if z := t.zone(zone); z.replicas < replicas {
+			z.replicas = replicas
+		}
+	}
+	if len(t.zones) < 2 {
+		return nil
+	}
+
+	// The replicas which are not healthy will never be written.
+	for i := range t.zones {
+		t.zones[i].failures = t.zones[i].replicas - healthy[t.zones[i].zone]
+	}
+	return t
+}
+
+func (t *zoneTracker) zone(zone string) *zoneReplicas {
+	for i := range t.zones {
+		if t.zones[i].zone == zone {
+			return &t.zones[i]
+		}
+	}
+	t.zones = append(t.zones, zoneReplicas{zone: zone})
+	return &t.zones[len(t.zones)-1]
+}
+
+// record records the write of the item to a replica in the zone, and returns whether the
+// zone quorum has just been reached, or has just become unreachable.
+func (t *zoneTracker) record(zone string, succeeded bool) (reached, unreachable bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.decided {
+		return false, false
+	}
+
+	if z := t.zone(zone); succeeded {
+		z.succeeded++
+	} else {
+		z.failures++
+	}
+	return t.decide()
+}
+
+// unreachable returns whether the zone quorum can't be reached, before writing the item.
+func (t *zoneTracker) unreachable() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	_, unreachable := t.decide()
+	return unreachable
+}
+
+// decide returns whether the zone quorum has been reached, or has become unreachable.
+// It must be called with the lock held.
+func (t *zoneTracker) decide() (reached, unreachable bool) {
+	maxFailedZones, succeededZones, failedZones := 0, 0, 0
+	if t.quorum == AllButOneZoneQuorum {
+		maxFailedZones = 1
+	}
+	for _, z := range t.zones {
+		switch {
+		case t.quorum == EachZoneQuorum && z.succeeded > 0:
+			succeededZones++
+		case t.quorum == EachZoneQuorum && z.failures == z.replicas:
+			failedZones++
+		case t.quorum == AllButOneZoneQuorum && z.failures > 0:
+			failedZones++
+		case t.quorum == AllButOneZoneQuorum && z.succeeded == z.replicas:
+			succeededZones++
+		}
+	}
+
+	switch {
+	case failedZones > maxFailedZones:
+		t.decided = true
+		return false, true
+	case succeededZones >= len(t.zones)-maxFailedZones:
+		t.decided = true
+		return true, false
+	}
+	return false, false
 }
 
 func (i *itemTracker) recordError(err error) int32 {
@@ -67,6 +199,13 @@ func (i *itemTracker) getError() error {
 //
 // Not implemented as a method on Ring so we can test separately.
 func DoBatch(ctx context.Context, op Operation, r ReadRing, keys []uint32, callback func(InstanceDesc, []int) error, cleanup func()) error {
+	return DoBatchWithZoneQuorum(ctx, op, r, keys, NoZoneQuorum, callback, cleanup)
+}
+
+// DoBatchWithZoneQuorum is like DoBatch, but the items are written according to the zone
+// quorum. The items whose replicas don't span multiple zones are written to a quorum of
+// their replicas.
+func DoBatchWithZoneQuorum(ctx context.Context, op Operation, r ReadRing, keys []uint32, zoneQuorum ZoneQuorum, callback func(InstanceDesc, []int) error, cleanup func()) error {
 	if r.InstancesCount() <= 0 {
 		cleanup()
 		return fmt.Errorf("DoBatch: InstancesCount <= 0")
@@ -90,6 +229,13 @@ func DoBatch(ctx context.Context, op Operation, r ReadRing, keys []uint32, callb
 		itemTrackers[i].minSuccess = len(replicationSet.Instances) - replicationSet.MaxErrors
 		itemTrackers[i].maxFailures = replicationSet.MaxErrors
 		itemTrackers[i].remaining.Store(int32(len(replicationSet.Instances)))
+		if zoneQuorum != NoZoneQuorum {
+			itemTrackers[i].zones = newZoneTracker(zoneQuorum, bufZones, replicationSet.Instances)
+			if itemTrackers[i].zones != nil && itemTrackers[i].zones.unreachable() {
+				cleanup()
+				return errZoneQuorumUnreachable
+			}
+		}
 
 		for _, desc := range replicationSet.Instances {
 			curr, found := instances[desc.Addr]
@@ -160,12 +306,30 @@ func (b *batchTracker) record(instance instance, err error) {
 			// Ex: 2xx, 5xx, 4xx -> return 4xx
 			// Ex: 4xx, 4xx, _ -> return 4xx
 			// Ex: 5xx, _, 5xx -> return 5xx
-			if errCount > int32(sampleTrackers[i].maxFailures) {
+			// The items with a zone quorum are only failed by the zone tracker, since their replicas
+			// failing in the same zone may not prevent the zone quorum from being reached.
+			if sampleTrackers[i].zones == nil && errCount > int32(sampleTrackers[i].maxFailures) {
 				if b.rpcsFailed.Inc() == 1 {
 					b.err <- httpgrpcutil.WrapHTTPGrpcError(sampleTrackers[i].getError(), "maxFailure (quorum) on a given error family")
 				}
 				continue
 			}
+		}
+
+		// The items with a zone quorum succeed once the quorum is reached, and fail with the error
+		// of the most frequent error family once it becomes unreachable.
+		if zones := sampleTrackers[i].zones; zones != nil {
+			reached, unreachable := zones.record(instance.desc.Zone, err == nil)
+			if reached && b.rpcsPending.Dec() == 0 {
+				b.done <- struct{}{}
+			}
+			if unreachable && b.rpcsFailed.Inc() == 1 {
+				b.err <- httpgrpcutil.WrapHTTPGrpcError(sampleTrackers[i].getError(), "zone quorum not reached")
+			}
+			continue
+		}
+
+		if err != nil {
 			if sampleTrackers[i].remaining.Dec() == 0 {
 				if b.rpcsFailed.Inc() == 1 {
 					b.err <- httpgrpcutil.WrapHTTPGrpcError(sampleTrackers[i].getError(), "not enough remaining instances to try")
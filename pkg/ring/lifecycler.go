@@ -25,6 +25,8 @@ import (
 
 var (
 	errInvalidTokensGeneratorStrategy = errors.New("invalid token generator strategy")
+	errSpreadMinimizingZonesRequired  = errors.New("the spread minimizing zones must be configured to use the spread-minimizing token generator strategy with zone awareness enabled")
+	errSpreadMinimizingUnsupported    = errors.New("the spread-minimizing token generator strategy is only supported by the ingesters")
 )
 
 // LifecyclerConfig is the config to build a Lifecycler.
@@ -32,18 +34,19 @@ type LifecyclerConfig struct {
 	RingConfig Config `yaml:"ring"`
 
 	// Config for the ingester lifecycle control
-	NumTokens                int           `yaml:"num_tokens"`
-	TokensGeneratorStrategy  string        `yaml:"tokens_generator_strategy"`
-	HeartbeatPeriod          time.Duration `yaml:"heartbeat_period"`
-	ObservePeriod            time.Duration `yaml:"observe_period"`
-	JoinAfter                time.Duration `yaml:"join_after"`
-	MinReadyDuration         time.Duration `yaml:"min_ready_duration"`
-	InfNames                 []string      `yaml:"interface_names"`
-	FinalSleep               time.Duration `yaml:"final_sleep"`
-	TokensFilePath           string        `yaml:"tokens_file_path"`
-	Zone                     string        `yaml:"availability_zone"`
-	UnregisterOnShutdown     bool          `yaml:"unregister_on_shutdown"`
-	ReadinessCheckRingHealth bool          `yaml:"readiness_check_ring_health"`
+	NumTokens                int                    `yaml:"num_tokens"`
+	TokensGeneratorStrategy  string                 `yaml:"tokens_generator_strategy"`
+	SpreadMinimizingZones    flagext.StringSliceCSV `yaml:"spread_minimizing_zones"`
+	HeartbeatPeriod          time.Duration          `yaml:"heartbeat_period"`
+	ObservePeriod            time.Duration          `yaml:"observe_period"`
+	JoinAfter                time.Duration          `yaml:"join_after"`
+	MinReadyDuration         time.Duration          `yaml:"min_ready_duration"`
+	InfNames                 []string               `yaml:"interface_names"`
+	FinalSleep               time.Duration          `yaml:"final_sleep"`
+	TokensFilePath           string                 `yaml:"tokens_file_path"`
+	Zone                     string                 `yaml:"availability_zone"`
+	UnregisterOnShutdown     bool                   `yaml:"unregister_on_shutdown"`
+	ReadinessCheckRingHealth bool                   `yaml:"readiness_check_ring_health"`
 
 	// For testing, you can override the address and ID of this ingester
 	Addr string `yaml:"address" doc:"hidden"`
@@ -70,7 +73,8 @@ func (cfg *LifecyclerConfig) RegisterFlagsWithPrefix(prefix string, f *flag.Flag
 	}
 
 	f.IntVar(&cfg.NumTokens, prefix+"num-tokens", 128, "Number of tokens for each ingester.")
-	f.StringVar(&cfg.TokensGeneratorStrategy, prefix+"tokens-generator-strategy", randomTokenStrategy, fmt.Sprintf("EXPERIMENTAL: Algorithm used to generate new ring tokens. Supported Values: %s", strings.Join(supportedTokenStrategy, ",")))
+	f.StringVar(&cfg.TokensGeneratorStrategy, prefix+"tokens-generator-strategy", randomTokenStrategy, fmt.Sprintf("EXPERIMENTAL: Algorithm used to generate new ring tokens. Supported Values: %s. The minimize-spread strategy picks each new token in the largest range between the tokens already registered in the ring, so the tokens depend on the order the instances join. The spread-minimizing strategy computes the tokens from the sequential number ending the instance ID and from its zone, without looking at the ring, so the instances must be numbered sequentially within each zone.", strings.Join(supportedTokenStrategy, ",")))
+	f.Var(&cfg.SpreadMinimizingZones, prefix+"spread-minimizing-zones", "EXPERIMENTAL: Comma-separated list of all the zones of the ring, used by the spread-minimizing token generator strategy to compute distinct tokens for each zone. Required when zone awareness is enabled, leave empty otherwise.")
 	f.DurationVar(&cfg.HeartbeatPeriod, prefix+"heartbeat-period", 5*time.Second, "Period at which to heartbeat to consul. 0 = disabled.")
 	f.DurationVar(&cfg.JoinAfter, prefix+"join-after", 0*time.Second, "Period to wait for a claim from another member; will join automatically after this.")
 	f.DurationVar(&cfg.ObservePeriod, prefix+"observe-period", 0*time.Second, "Observe tokens after generating to resolve collisions. Useful when using gossiping ring.")
@@ -98,6 +102,11 @@ func (cfg *LifecyclerConfig) Validate() error {
 		return errInvalidTokensGeneratorStrategy
 	}
 
+	// Without the list of zones, the instances with the same sequential number would get the same tokens in every zone.
+	if strings.EqualFold(cfg.TokensGeneratorStrategy, spreadMinimizingTokenStrategy) && cfg.RingConfig.ZoneAwarenessEnabled && len(cfg.SpreadMinimizingZones) == 0 {
+		return errSpreadMinimizingZonesRequired
+	}
+
 	return nil
 }
 
@@ -184,10 +193,9 @@ func NewLifecycler(
 		flushTransferer = NewNoopFlushTransferer()
 	}
 
-	tg := NewRandomTokenGenerator()
-
-	if strings.EqualFold(cfg.TokensGeneratorStrategy, minimizeSpreadTokenStrategy) {
-		tg = NewMinimizeSpreadTokenGenerator()
+	tg, err := newTokenGenerator(cfg.TokensGeneratorStrategy, cfg.ID, zone, cfg.SpreadMinimizingZones)
+	if err != nil {
+		return nil, err
 	}
 
 	l := &Lifecycler{
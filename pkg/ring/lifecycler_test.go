@@ -47,6 +47,49 @@ func checkNormalised(d interface{}, id string) bool {
 		len(desc.Ingesters[id].Tokens) == 1
 }
 
+func TestLifecyclerConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		strategy      string
+		zoneAwareness bool
+		zones         []string
+		expected      error
+	}{
+		"random strategy": {
+			strategy:      randomTokenStrategy,
+			zoneAwareness: true,
+		},
+		"invalid strategy": {
+			strategy: "unknown",
+			expected: errInvalidTokensGeneratorStrategy,
+		},
+		"spread-minimizing strategy without zone awareness": {
+			strategy: spreadMinimizingTokenStrategy,
+		},
+		"spread-minimizing strategy with zone awareness and zones": {
+			strategy:      spreadMinimizingTokenStrategy,
+			zoneAwareness: true,
+			zones:         []string{"zone-a", "zone-b"},
+		},
+		"spread-minimizing strategy with zone awareness and no zones": {
+			strategy:      spreadMinimizingTokenStrategy,
+			zoneAwareness: true,
+			expected:      errSpreadMinimizingZonesRequired,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			cfg := testLifecyclerConfig(Config{ZoneAwarenessEnabled: testData.zoneAwareness}, "ingester-0")
+			cfg.TokensGeneratorStrategy = testData.strategy
+			cfg.SpreadMinimizingZones = testData.zones
+
+			assert.Equal(t, testData.expected, cfg.Validate())
+		})
+	}
+}
+
 func TestLifecycler_JoinShouldNotBlock(t *testing.T) {
 	ringStore, closer := consul.NewInMemoryClient(GetCodec(), log.NewNopLogger(), nil)
 	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
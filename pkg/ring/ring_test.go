@@ -3,9 +3,11 @@ package ring
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -170,6 +172,247 @@ func TestDoBatchZeroInstances(t *testing.T) {
 	require.Error(t, DoBatch(ctx, Write, &r, keys, callback, cleanup))
 }
 
+func TestZoneTracker(t *testing.T) {
+	type write struct {
+		zone      string
+		succeeded bool
+	}
+
+	instances := []InstanceDesc{
+		{Addr: "127.0.0.1", Zone: "zone-a"},
+		{Addr: "127.0.0.2", Zone: "zone-a"},
+		{Addr: "127.0.0.3", Zone: "zone-b"},
+		{Addr: "127.0.0.4", Zone: "zone-c"},
+	}
+
+	tests := map[string]struct {
+		quorum              ZoneQuorum
+		writes              []write
+		expectedReached     bool
+		expectedUnreachable bool
+	}{
+		"each zone: should be reached once each zone has a successful write": {
+			quorum:          EachZoneQuorum,
+			writes:          []write{{"zone-a", false}, {"zone-a", true}, {"zone-b", true}, {"zone-c", true}},
+			expectedReached: true,
+		},
+		"each zone: should be unreachable once all the writes to a zone failed": {
+			quorum:              EachZoneQuorum,
+			writes:              []write{{"zone-b", true}, {"zone-a", false}, {"zone-a", false}},
+			expectedUnreachable: true,
+		},
+		"each zone: should be pending while a zone has no successful write": {
+			quorum: EachZoneQuorum,
+			writes: []write{{"zone-a", false}, {"zone-b", true}, {"zone-c", true}},
+		},
+		"all but one zone: should be reached once all the writes but the ones to a zone succeeded": {
+			quorum:          AllButOneZoneQuorum,
+			writes:          []write{{"zone-a", false}, {"zone-b", true}, {"zone-c", true}},
+			expectedReached: true,
+		},
+		"all but one zone: should be unreachable once writes to two zones failed": {
+			quorum:              AllButOneZoneQuorum,
+			writes:              []write{{"zone-a", true}, {"zone-b", false}, {"zone-a", false}},
+			expectedUnreachable: true,
+		},
+		"all but one zone: should be pending while a zone has pending writes": {
+			quorum: AllButOneZoneQuorum,
+			writes: []write{{"zone-a", true}, {"zone-b", true}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			tracker := newZoneTracker(testData.quorum, nil, instances)
+			require.NotNil(t, tracker)
+
+			reached, unreachable := false, false
+			for _, w := range testData.writes {
+				r, u := tracker.record(w.zone, w.succeeded)
+				require.False(t, (r || u) && (reached || unreachable), "the zone quorum has been decided more than once")
+				reached, unreachable = reached || r, unreachable || u
+			}
+			assert.Equal(t, testData.expectedReached, reached)
+			assert.Equal(t, testData.expectedUnreachable, unreachable)
+		})
+	}
+
+	t.Run("should not track the writes to a single zone", func(t *testing.T) {
+		assert.Nil(t, newZoneTracker(EachZoneQuorum, nil, []InstanceDesc{{Zone: "zone-a"}, {Zone: "zone-a"}}))
+	})
+
+	t.Run("should account the zones of the ring without healthy instances as failed", func(t *testing.T) {
+		bufZones := map[string]int{"zone-a": 2, "zone-b": 1, "zone-c": 1}
+
+		// The zone-c has no healthy instances.
+		tracker := newZoneTracker(EachZoneQuorum, bufZones, instances[:3])
+		require.NotNil(t, tracker)
+		assert.True(t, tracker.unreachable())
+
+		tracker = newZoneTracker(AllButOneZoneQuorum, bufZones, instances[:3])
+		require.NotNil(t, tracker)
+		assert.False(t, tracker.unreachable())
+		reached, _ := tracker.record("zone-a", true)
+		assert.False(t, reached)
+		reached, _ = tracker.record("zone-a", true)
+		assert.False(t, reached)
+		reached, _ = tracker.record("zone-b", true)
+		assert.True(t, reached)
+
+		// The zone-a has a single healthy instance out of two replicas.
+		tracker = newZoneTracker(AllButOneZoneQuorum, bufZones, instances[1:])
+		require.NotNil(t, tracker)
+		assert.False(t, tracker.unreachable())
+		_, unreachable := tracker.record("zone-b", false)
+		assert.True(t, unreachable)
+	})
+}
+
+func TestDoBatchWithZoneQuorum(t *testing.T) {
+	tests := map[string]struct {
+		quorum         ZoneQuorum
+		failingZones   []string
+		unhealthyZones []string
+		expectedError  bool
+	}{
+		"no zone quorum should tolerate a failing zone": {
+			quorum:       NoZoneQuorum,
+			failingZones: []string{"zone-a"},
+		},
+		"each zone quorum should succeed if all the zones succeed": {
+			quorum: EachZoneQuorum,
+		},
+		"each zone quorum should fail on a failing zone": {
+			quorum:        EachZoneQuorum,
+			failingZones:  []string{"zone-a"},
+			expectedError: true,
+		},
+		"all but one zone quorum should tolerate a failing zone": {
+			quorum:       AllButOneZoneQuorum,
+			failingZones: []string{"zone-b"},
+		},
+		"all but one zone quorum should fail on two failing zones": {
+			quorum:        AllButOneZoneQuorum,
+			failingZones:  []string{"zone-b", "zone-c"},
+			expectedError: true,
+		},
+		"no zone quorum should tolerate an unhealthy zone": {
+			quorum:         NoZoneQuorum,
+			unhealthyZones: []string{"zone-a"},
+		},
+		"each zone quorum should fail on an unhealthy zone": {
+			quorum:         EachZoneQuorum,
+			unhealthyZones: []string{"zone-a"},
+			expectedError:  true,
+		},
+		"all but one zone quorum should tolerate an unhealthy zone": {
+			quorum:         AllButOneZoneQuorum,
+			unhealthyZones: []string{"zone-a"},
+		},
+		"all but one zone quorum should fail on an unhealthy zone and a failing zone": {
+			quorum:         AllButOneZoneQuorum,
+			unhealthyZones: []string{"zone-a"},
+			failingZones:   []string{"zone-b"},
+			expectedError:  true,
+		},
+	}
+
+	keys := make([]uint32, 100)
+	generateKeys(rand.New(rand.NewSource(time.Now().UnixNano())), len(keys), keys)
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			g := NewRandomTokenGenerator()
+			desc := NewDesc()
+			for id, instance := range map[string]InstanceDesc{
+				"instance-1": {Addr: "127.0.0.1", Zone: "zone-a"},
+				"instance-2": {Addr: "127.0.0.2", Zone: "zone-b"},
+				"instance-3": {Addr: "127.0.0.3", Zone: "zone-c"},
+			} {
+				instance = desc.AddIngester(id, instance.Addr, instance.Zone, g.GenerateTokens(desc, id, instance.Zone, 128, true), ACTIVE, time.Now())
+				if slices.Contains(testData.unhealthyZones, instance.Zone) {
+					instance.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+					desc.Ingesters[id] = instance
+				}
+			}
+			r := Ring{
+				cfg: Config{
+					HeartbeatTimeout:     time.Hour,
+					ReplicationFactor:    3,
+					ZoneAwarenessEnabled: true,
+				},
+				ringDesc:            desc,
+				ringTokens:          desc.GetTokens(),
+				ringTokensByZone:    desc.getTokensByZone(),
+				ringInstanceByToken: desc.getTokensInfo(),
+				ringZones:           getZones(desc.getTokensByZone()),
+				strategy:            NewDefaultReplicationStrategy(),
+				KVClient:            &MockClient{},
+			}
+
+			callback := func(instance InstanceDesc, _ []int) error {
+				for _, zone := range testData.failingZones {
+					if instance.Zone == zone {
+						return errors.New("write failed")
+					}
+				}
+				return nil
+			}
+
+			err := DoBatchWithZoneQuorum(context.Background(), Write, &r, keys, testData.quorum, callback, func() {})
+			if testData.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDoBatchWithZoneQuorum_ShouldNotFailOnErrorsWithinTheZonesWhenReplicationFactorIsGreaterThanZones(t *testing.T) {
+	g := NewRandomTokenGenerator()
+	desc := NewDesc()
+	for id, instance := range map[string]InstanceDesc{
+		"instance-1": {Addr: "127.0.0.1", Zone: "zone-a"},
+		"instance-2": {Addr: "127.0.0.2", Zone: "zone-a"},
+		"instance-3": {Addr: "127.0.0.3", Zone: "zone-b"},
+		"instance-4": {Addr: "127.0.0.4", Zone: "zone-b"},
+	} {
+		desc.AddIngester(id, instance.Addr, instance.Zone, g.GenerateTokens(desc, id, instance.Zone, 128, true), ACTIVE, time.Now())
+	}
+	r := Ring{
+		cfg: Config{
+			HeartbeatTimeout:  time.Hour,
+			ReplicationFactor: 4,
+		},
+		ringDesc:            desc,
+		ringTokens:          desc.GetTokens(),
+		ringTokensByZone:    desc.getTokensByZone(),
+		ringInstanceByToken: desc.getTokensInfo(),
+		ringZones:           getZones(desc.getTokensByZone()),
+		strategy:            NewDefaultReplicationStrategy(),
+		KVClient:            &MockClient{},
+	}
+
+	keys := make([]uint32, 100)
+	generateKeys(rand.New(rand.NewSource(time.Now().UnixNano())), len(keys), keys)
+
+	// A replica fails in each zone, which exceeds the max failures of the quorum of the replicas,
+	// while each zone still has a successful write.
+	callback := func(instance InstanceDesc, _ []int) error {
+		if instance.Addr == "127.0.0.1" || instance.Addr == "127.0.0.3" {
+			return errors.New("write failed")
+		}
+		return nil
+	}
+
+	require.Error(t, DoBatchWithZoneQuorum(context.Background(), Write, &r, keys, NoZoneQuorum, callback, func() {}))
+	require.NoError(t, DoBatchWithZoneQuorum(context.Background(), Write, &r, keys, EachZoneQuorum, callback, func() {}))
+	require.Error(t, DoBatchWithZoneQuorum(context.Background(), Write, &r, keys, AllButOneZoneQuorum, callback, func() {}))
+}
+
 func TestAddIngester(t *testing.T) {
 	r := NewDesc()
 
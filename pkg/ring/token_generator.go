@@ -2,9 +2,13 @@ package ring
 
 import (
 	"container/heap"
+	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,12 +16,16 @@ import (
 const (
 	maxTokenValue = math.MaxUint32
 
-	minimizeSpreadTokenStrategy = "minimize-spread"
-	randomTokenStrategy         = "random"
+	minimizeSpreadTokenStrategy   = "minimize-spread"
+	spreadMinimizingTokenStrategy = "spread-minimizing"
+	randomTokenStrategy           = "random"
 )
 
 var (
-	supportedTokenStrategy = []string{strings.ToLower(randomTokenStrategy), strings.ToLower(minimizeSpreadTokenStrategy)}
+	supportedTokenStrategy = []string{strings.ToLower(randomTokenStrategy), strings.ToLower(minimizeSpreadTokenStrategy), strings.ToLower(spreadMinimizingTokenStrategy)}
+
+	// instanceIDRegex matches instance IDs ending with a sequential number, e.g. "ingester-zone-a-7".
+	instanceIDRegex = regexp.MustCompile(`^(.*-)?(\d+)$`)
 )
 
 type TokenGenerator interface {
@@ -278,3 +286,214 @@ func findFirst(n int, f func(int) bool) int {
 	}
 	return n
 }
+
+// newTokenGenerator returns the TokenGenerator for the given strategy. An empty or unknown
+// strategy falls back to the random token generator.
+func newTokenGenerator(strategy, id, zone string, zones []string) (TokenGenerator, error) {
+	switch {
+	case strings.EqualFold(strategy, minimizeSpreadTokenStrategy):
+		return NewMinimizeSpreadTokenGenerator(), nil
+	case strings.EqualFold(strategy, spreadMinimizingTokenStrategy):
+		return NewSpreadMinimizingTokenGenerator(id, zone, zones)
+	default:
+		return NewRandomTokenGenerator(), nil
+	}
+}
+
+// SpreadMinimizingTokenGenerator deterministically computes the tokens of an instance
+// from its sequential number (the trailing number of its ID) and its zone, without
+// looking at the tokens already registered in the ring. The tokens of the first instance
+// of a zone are evenly spread; each following instance takes its share of the ring by
+// splitting the largest ranges of the instances owning the most, which keeps the ownership
+// of all the instances of a zone balanced as long as they are numbered sequentially.
+type SpreadMinimizingTokenGenerator struct {
+	instanceIdx    int
+	zoneIdx        int
+	innerGenerator TokenGenerator
+}
+
+// NewSpreadMinimizingTokenGenerator returns a SpreadMinimizingTokenGenerator for the instance
+// with the given ID and zone. The zone must be one of zones, unless zones is empty.
+func NewSpreadMinimizingTokenGenerator(id, zone string, zones []string) (TokenGenerator, error) {
+	match := instanceIDRegex.FindStringSubmatch(id)
+	if match == nil {
+		return nil, fmt.Errorf("instance ID %q must end with a sequential number to use the %s token generator strategy", id, spreadMinimizingTokenStrategy)
+	}
+	instanceIdx, err := strconv.Atoi(match[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid sequential number in instance ID %q: %w", id, err)
+	}
+
+	zoneIdx := 0
+	if len(zones) > 0 {
+		sorted := slices.Clone(zones)
+		slices.Sort(sorted)
+		zoneIdx = slices.Index(sorted, zone)
+		if zoneIdx < 0 {
+			return nil, fmt.Errorf("zone %q is not one of the configured spread minimizing zones %v", zone, zones)
+		}
+	}
+
+	return &SpreadMinimizingTokenGenerator{
+		instanceIdx:    instanceIdx,
+		zoneIdx:        zoneIdx,
+		innerGenerator: NewRandomTokenGenerator(),
+	}, nil
+}
+
+// GenerateTokens returns the tokens of the instance. Tokens already owned by another instance
+// are skipped and, if force is set, replaced by random ones.
+func (g *SpreadMinimizingTokenGenerator) GenerateTokens(ring *Desc, id, zone string, numTokens int, force bool) []uint32 {
+	if numTokens <= 0 {
+		return []uint32{}
+	}
+
+	usedTokens := map[uint32]bool{}
+	for instanceID, instance := range ring.GetIngesters() {
+		if instanceID == id {
+			continue
+		}
+		for _, token := range instance.Tokens {
+			usedTokens[token] = true
+		}
+	}
+
+	r := make([]uint32, 0, numTokens)
+	for _, token := range spreadMinimizingTokens(g.instanceIdx, numTokens) {
+		// Tokens of different zones are shifted by the zone index so that they never clash.
+		token += uint32(g.zoneIdx)
+		if usedTokens[token] {
+			continue
+		}
+		r = append(r, token)
+	}
+
+	if len(r) < numTokens && force {
+		r = append(r, g.innerGenerator.GenerateTokens(ring, id, zone, numTokens-len(r), true)...)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i] < r[j]
+	})
+
+	return r
+}
+
+// spreadMinimizingTokens computes the tokens of the instance with the given sequential number,
+// by computing the tokens of all the instances preceding it.
+func spreadMinimizingTokens(instanceIdx, numTokens int) []uint32 {
+	tokenSpan := (int64(maxTokenValue) + 1) / int64(numTokens)
+
+	first := &tokenRangesPerInstance{}
+	for i := 0; i < numTokens; i++ {
+		token := uint32(int64(i+1) * tokenSpan % (int64(maxTokenValue) + 1))
+		first.ranges = append(first.ranges, &tokenDistanceEntry{token: token, prev: uint32(int64(i) * tokenSpan), distance: tokenSpan})
+		first.totalDistance += tokenSpan
+	}
+	heap.Init(&first.ranges)
+
+	instances := &tokenRangesHeap{first}
+	current := first
+
+	for idx := 1; idx <= instanceIdx; idx++ {
+		current = &tokenRangesPerInstance{idx: idx}
+		expectedDistanceStep := (int64(maxTokenValue) + 1) / int64(idx+1) / int64(numTokens)
+
+		for i := 0; i < numTokens; i++ {
+			m := heap.Pop(instances).(*tokenRangesPerInstance)
+			rangeToSplit := m.ranges[0]
+
+			step := expectedDistanceStep
+			if rangeToSplit.distance <= step {
+				step = rangeToSplit.distance - 1
+			}
+			newToken := uint32((int64(rangeToSplit.prev) + step) % (int64(maxTokenValue) + 1))
+
+			current.ranges = append(current.ranges, &tokenDistanceEntry{token: newToken, prev: rangeToSplit.prev, distance: step})
+			current.totalDistance += step
+
+			rangeToSplit.prev = newToken
+			rangeToSplit.distance -= step
+			heap.Fix(&m.ranges, 0)
+			m.totalDistance -= step
+			heap.Push(instances, m)
+		}
+
+		heap.Init(&current.ranges)
+		heap.Push(instances, current)
+	}
+
+	tokens := make([]uint32, 0, numTokens)
+	for _, r := range current.ranges {
+		tokens = append(tokens, r.token)
+	}
+	return tokens
+}
+
+type tokenRangesPerInstance struct {
+	idx           int
+	ranges        tokenRangesByDistance
+	totalDistance int64
+}
+
+// tokenRangesHeap is a max-heap of instances by owned distance. Ties are broken by the
+// instance sequential number to keep the computation deterministic.
+type tokenRangesHeap []*tokenRangesPerInstance
+
+func (t tokenRangesHeap) Len() int {
+	return len(t)
+}
+
+func (t tokenRangesHeap) Less(i, j int) bool {
+	if t[i].totalDistance != t[j].totalDistance {
+		return t[i].totalDistance > t[j].totalDistance
+	}
+	return t[i].idx < t[j].idx
+}
+
+func (t tokenRangesHeap) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
+
+func (t *tokenRangesHeap) Push(x any) {
+	*t = append(*t, x.(*tokenRangesPerInstance))
+}
+
+func (t *tokenRangesHeap) Pop() any {
+	old := *t
+	n := len(old)
+	x := old[n-1]
+	*t = old[0 : n-1]
+	return x
+}
+
+// tokenRangesByDistance is a max-heap of token ranges by distance. Ties are broken by the
+// token to keep the computation deterministic.
+type tokenRangesByDistance []*tokenDistanceEntry
+
+func (t tokenRangesByDistance) Len() int {
+	return len(t)
+}
+
+func (t tokenRangesByDistance) Less(i, j int) bool {
+	if t[i].distance != t[j].distance {
+		return t[i].distance > t[j].distance
+	}
+	return t[i].token < t[j].token
+}
+
+func (t tokenRangesByDistance) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
+
+func (t *tokenRangesByDistance) Push(x any) {
+	*t = append(*t, x.(*tokenDistanceEntry))
+}
+
+func (t *tokenRangesByDistance) Pop() any {
+	old := *t
+	n := len(old)
+	x := old[n-1]
+	*t = old[0 : n-1]
+	return x
+}
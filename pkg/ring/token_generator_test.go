@@ -21,6 +21,9 @@ func TestGenerateTokens(t *testing.T) {
 		"minimizeSpread": {
 			tg: NewMinimizeSpreadTokenGenerator(),
 		},
+		"spreadMinimizing": {
+			tg: mustNewSpreadMinimizingTokenGenerator(t, "ingester-0", "", nil),
+		},
 	}
 
 	for name, tc := range testCase {
@@ -124,6 +127,58 @@ func TestMinimizeSpreadTokenGenerator(t *testing.T) {
 	require.Len(t, tokens, 512)
 }
 
+func TestSpreadMinimizingTokenGenerator(t *testing.T) {
+	ringDesc := NewDesc()
+	zones := []string{"zone-c", "zone-a", "zone-b"}
+	dups := map[uint32]bool{}
+
+	for i := 0; i < 30; i++ {
+		for _, zone := range zones {
+			id := fmt.Sprintf("ingester-%s-%d", zone, i)
+			tokens := mustNewSpreadMinimizingTokenGenerator(t, id, zone, zones).GenerateTokens(ringDesc, id, zone, 512, false)
+			require.Len(t, tokens, 512)
+			for _, token := range tokens {
+				if dups[token] {
+					t.Fatal("GenerateTokens returned duplicated tokens")
+				}
+				dups[token] = true
+			}
+
+			// Tokens are deterministic, regardless of the ring state.
+			require.Equal(t, tokens, mustNewSpreadMinimizingTokenGenerator(t, id, zone, zones).GenerateTokens(NewDesc(), id, zone, 512, false))
+
+			ringDesc.AddIngester(id, id, zone, tokens, ACTIVE, time.Now())
+		}
+		assertDistancePerIngester(t, ringDesc, 0.01)
+	}
+
+	// Tokens owned by other instances are skipped, and replaced only when forced.
+	tg := mustNewSpreadMinimizingTokenGenerator(t, "other-ingester-0", zones[0], zones)
+	require.Empty(t, tg.GenerateTokens(ringDesc, "other-ingester-0", zones[0], 512, false))
+	tokens := tg.GenerateTokens(ringDesc, "other-ingester-0", zones[0], 512, true)
+	require.Len(t, tokens, 512)
+	for _, token := range tokens {
+		require.False(t, dups[token])
+	}
+}
+
+func TestNewSpreadMinimizingTokenGenerator(t *testing.T) {
+	_, err := NewSpreadMinimizingTokenGenerator("ingester", "", nil)
+	require.Error(t, err)
+
+	_, err = NewSpreadMinimizingTokenGenerator("ingester-1", "zone-d", []string{"zone-a", "zone-b"})
+	require.Error(t, err)
+
+	_, err = NewSpreadMinimizingTokenGenerator("7", "zone-a", []string{"zone-a", "zone-b"})
+	require.NoError(t, err)
+}
+
+func mustNewSpreadMinimizingTokenGenerator(t testing.TB, id, zone string, zones []string) TokenGenerator {
+	tg, err := NewSpreadMinimizingTokenGenerator(id, zone, zones)
+	require.NoError(t, err)
+	return tg
+}
+
 func generateTokensForIngesters(t *testing.T, rindDesc *Desc, prefix string, zones []string, minimizeTokenGenerator *MinimizeSpreadTokenGenerator, dups map[uint32]bool) {
 	for _, zone := range zones {
 		id := fmt.Sprintf("%v-%v", prefix, zone)
@@ -0,0 +1,382 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// alertForStateMetricName is the name of the series holding the time the alerts became active.
+	alertForStateMetricName = "ALERTS_FOR_STATE"
+
+	alertsStateCodecID = "ruler.alertsState"
+)
+
+var (
+	// KV stores not supported to share the alerts state: the dynamodb and memberlist ones only
+	// support the ring codec, and the inmemory one is not shared across the ruler replicas.
+	unsupportedAlertsStateKVStores = []string{"dynamodb", "inmemory", "memberlist"}
+
+	errInvalidAlertsStateKVStore = errors.New("the dynamodb, inmemory and memberlist KV stores are not supported to share the alerts state")
+)
+
+// AlertsStateConfig configures the sharing of the alerts state across the ruler replicas.
+type AlertsStateConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	KVStore       kv.Config     `yaml:"kvstore"`
+	WriteInterval time.Duration `yaml:"write_interval"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *AlertsStateConfig) RegisterFlags(f *flag.FlagSet) {
+	cfg.KVStore.RegisterFlagsWithPrefix("ruler.alerts-state.", "ruler-alerts-state/", f)
+
+	f.BoolVar(&cfg.Enabled, "ruler.alerts-state.enabled", false, "[Experimental] Share the time the alerts became active across the ruler replicas through the KV store, so that a ruler taking over a rule group after a failover restores the 'for' state of its alerts from the KV store. The dynamodb, inmemory and memberlist KV stores are not supported.")
+	f.DurationVar(&cfg.WriteInterval, "ruler.alerts-state.write-interval", time.Minute, "[Experimental] Minimum interval between two writes of the state of the alerts of an alerting rule to the KV store. The state is also written at this interval while the alerts are active, to keep it fresh.")
+}
+
+// Validate the config.
+func (cfg *AlertsStateConfig) Validate() error {
+	if cfg.Enabled && util.StringsContain(unsupportedAlertsStateKVStores, cfg.KVStore.Store) {
+		return errInvalidAlertsStateKVStore
+	}
+	return nil
+}
+
+// alertsState is the state of the active alerts of an alerting rule, as stored in the KV store.
+type alertsState struct {
+	// Timestamp of the evaluation which recorded the state, in milliseconds.
+	Timestamp int64        `json:"timestamp"`
+	Alerts    []alertState `json:"alerts"`
+}
+
+type alertState struct {
+	// Labels of the ALERTS_FOR_STATE series of the alert.
+	Labels labels.Labels `json:"labels"`
+	// Unix time in seconds the alert became active.
+	ActiveAt float64 `json:"active_at"`
+}
+
+// alertsStateCodec is the JSON codec of the alerts state stored in the KV store.
+type alertsStateCodec struct{}
+
+func (alertsStateCodec) CodecID() string { return alertsStateCodecID }
+
+func (alertsStateCodec) Decode(b []byte) (interface{}, error) {
+	s := &alertsState{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (alertsStateCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (alertsStateCodec) DecodeMultiKey(map[string][]byte) (interface{}, error) {
+	return nil, errors.New("multi-key decoding is not supported")
+}
+
+func (alertsStateCodec) EncodeMultiKey(interface{}) (map[string][]byte, error) {
+	return nil, errors.New("multi-key encoding is not supported")
+}
+
+// recordedAlertsState is the state of the alerts of an alerting rule recorded by this ruler.
+type recordedAlertsState struct {
+	alerts    map[string]alertState // Keyed by the series labels.
+	timestamp int64
+	changed   bool
+	lastWrite time.Time
+}
+
+// AlertsStateStore shares the time the alerts became active across the ruler replicas, through
+// the KV store. The state is recorded from the ALERTS_FOR_STATE series written by the rule
+// evaluations, and read back when Prometheus restores the 'for' state of the alerts of a rule
+// group loaded by the ruler, for example after a failover. The state is stored with a key per
+// tenant, rule group and alert name, and written at most once per write interval.
+type AlertsStateStore struct {
+	cfg    AlertsStateConfig
+	kv     kv.Client
+	logger log.Logger
+
+	mtx sync.Mutex
+	// Keyed by the tenant and rule group key, and then by the alert name.
+	recorded map[string]map[string]*recordedAlertsState
+
+	writes        prometheus.Counter
+	writeFailures prometheus.Counter
+	restored      prometheus.Counter
+
+	now func() time.Time
+}
+
+// NewAlertsStateStore makes a new AlertsStateStore.
+func NewAlertsStateStore(cfg AlertsStateConfig, logger log.Logger, reg prometheus.Registerer) (*AlertsStateStore, error) {
+	client, err := kv.NewClient(cfg.KVStore, alertsStateCodec{}, kv.RegistererWithKVName(prometheus.WrapRegistererWithPrefix("cortex_", reg), "ruler-alerts-state"), logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "create KV store client")
+	}
+
+	return &AlertsStateStore{
+		cfg:      cfg,
+		kv:       client,
+		logger:   logger,
+		recorded: map[string]map[string]*recordedAlertsState{},
+		writes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_alerts_state_writes_total",
+			Help: "Total number of writes of the alerts state to the KV store.",
+		}),
+		writeFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_alerts_state_write_failures_total",
+			Help: "Total number of failed writes of the alerts state to the KV store.",
+		}),
+		restored: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_alerts_state_restored_series_total",
+			Help: "Total number of ALERTS_FOR_STATE series read from the KV store to restore the 'for' state of the alerts.",
+		}),
+		now: time.Now,
+	}, nil
+}
+
+// alertsStateKey returns the KV store key of the state of the alerts of the given tenant, rule group and alert.
+func alertsStateKey(userID, groupFile, groupName, alertName string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", userID, url.PathEscape(groupFile), url.PathEscape(groupName), url.PathEscape(alertName))
+}
+
+// ruleGroupFromContext returns the file and name of the rule group being evaluated.
+func ruleGroupFromContext(ctx context.Context) (file, name string, ok bool) {
+	origin, _ := ctx.Value(promql.QueryOrigin{}).(map[string]interface{})
+	group, ok := origin["ruleGroup"].(map[string]string)
+	if !ok {
+		return "", "", false
+	}
+	return group["file"], group["name"], true
+}
+
+// record records the state of the alerts from the series written by a rule group evaluation,
+// and writes the state of the group alerts not written for at least the write interval.
+func (s *AlertsStateStore) record(ctx context.Context, userID string, series []labels.Labels, samples []cortexpb.Sample) {
+	groupFile, groupName, ok := ruleGroupFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	groupKey := alertsStateKey(userID, groupFile, groupName, "")
+	now := s.now()
+
+	s.mtx.Lock()
+	groupAlerts := s.recorded[groupKey]
+	if groupAlerts == nil {
+		groupAlerts = map[string]*recordedAlertsState{}
+		s.recorded[groupKey] = groupAlerts
+	}
+
+	for i, lbls := range series {
+		if lbls.Get(labels.MetricName) != alertForStateMetricName {
+			continue
+		}
+
+		alertName := lbls.Get(labels.AlertName)
+		rec := groupAlerts[alertName]
+		if rec == nil {
+			rec = &recordedAlertsState{alerts: map[string]alertState{}}
+			groupAlerts[alertName] = rec
+		}
+
+		key, sample := lbls.String(), samples[i]
+		if value.IsStaleNaN(sample.Value) {
+			if _, ok := rec.alerts[key]; ok {
+				delete(rec.alerts, key)
+				rec.changed = true
+			}
+		} else if prev, ok := rec.alerts[key]; !ok || prev.ActiveAt != sample.Value {
+			rec.alerts[key] = alertState{Labels: lbls, ActiveAt: sample.Value}
+			rec.changed = true
+		}
+		if sample.TimestampMs > rec.timestamp {
+			rec.timestamp = sample.TimestampMs
+		}
+	}
+
+	// Collect the states to write, including the ones recorded by previous evaluations
+	// which were not written because of the write interval.
+	toWrite := map[string]*alertsState{}
+	for alertName, rec := range groupAlerts {
+		if !rec.changed && len(rec.alerts) == 0 {
+			delete(groupAlerts, alertName)
+			continue
+		}
+		if now.Sub(rec.lastWrite) < s.cfg.WriteInterval {
+			continue
+		}
+
+		key := alertsStateKey(userID, groupFile, groupName, alertName)
+		if len(rec.alerts) == 0 {
+			// A nil state deletes the key.
+			toWrite[key] = nil
+			delete(groupAlerts, alertName)
+		} else {
+			state := &alertsState{Timestamp: rec.timestamp, Alerts: make([]alertState, 0, len(rec.alerts))}
+			for _, alert := range rec.alerts {
+				state.Alerts = append(state.Alerts, alert)
+			}
+			toWrite[key] = state
+		}
+		rec.changed = false
+		rec.lastWrite = now
+	}
+
+	if len(groupAlerts) == 0 {
+		delete(s.recorded, groupKey)
+	}
+	s.mtx.Unlock()
+
+	for key, state := range toWrite {
+		s.write(ctx, key, state)
+	}
+}
+
+func (s *AlertsStateStore) write(ctx context.Context, key string, state *alertsState) {
+	s.writes.Inc()
+
+	var err error
+	if state == nil {
+		err = s.kv.Delete(ctx, key)
+	} else {
+		err = s.kv.CAS(ctx, key, func(interface{}) (interface{}, bool, error) {
+			return state, true, nil
+		})
+	}
+
+	if err != nil {
+		s.writeFailures.Inc()
+		level.Warn(s.logger).Log("msg", "failed to write the alerts state to the KV store", "key", key, "err", err)
+	}
+}
+
+// read returns the ALERTS_FOR_STATE series of the given tenant matching the matchers, stored in
+// the KV store with a timestamp between mint and maxt. The series are looked up across all the
+// rule groups of the tenant, like the ALERTS_FOR_STATE series written to the storage.
+func (s *AlertsStateStore) read(ctx context.Context, userID, alertName string, mint, maxt int64, matchers []*labels.Matcher) ([]storage.Series, error) {
+	keys, err := s.kv.List(ctx, userID+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []storage.Series
+	for _, key := range keys {
+		if !strings.HasSuffix(key, "/"+url.PathEscape(alertName)) {
+			continue
+		}
+
+		v, err := s.kv.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		state, ok := v.(*alertsState)
+		if !ok || state.Timestamp < mint || state.Timestamp > maxt {
+			continue
+		}
+
+		for _, alert := range state.Alerts {
+			if !matchAll(alert.Labels, matchers) {
+				continue
+			}
+			result = append(result, series.NewConcreteSeries(alert.Labels, []model.SamplePair{{
+				Timestamp: model.Time(state.Timestamp),
+				Value:     model.SampleValue(alert.ActiveAt),
+			}}))
+		}
+	}
+
+	s.restored.Add(float64(len(result)))
+	return result, nil
+}
+
+func matchAll(lbls labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lbls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Queryable returns a queryable serving the ALERTS_FOR_STATE series from the KV store, and
+// all the other series, or the ALERTS_FOR_STATE series not found in the KV store, from the
+// upstream queryable.
+func (s *AlertsStateStore) Queryable(upstream storage.Queryable) storage.Queryable {
+	return storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
+		q, err := upstream.Querier(mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+		return &alertsStateQuerier{Querier: q, store: s, mint: mint, maxt: maxt}, nil
+	})
+}
+
+type alertsStateQuerier struct {
+	storage.Querier
+
+	store      *AlertsStateStore
+	mint, maxt int64
+}
+
+// Select implements storage.Querier.
+func (q *alertsStateQuerier) Select(ctx context.Context, sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	var metricName, alertName string
+	for _, m := range matchers {
+		if m.Type != labels.MatchEqual {
+			continue
+		}
+		switch m.Name {
+		case labels.MetricName:
+			metricName = m.Value
+		case labels.AlertName:
+			alertName = m.Value
+		}
+	}
+
+	if metricName != alertForStateMetricName || alertName == "" {
+		return q.Querier.Select(ctx, sortSeries, hints, matchers...)
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	result, err := q.store.read(ctx, userID, alertName, q.mint, q.maxt, matchers)
+	if err != nil {
+		level.Warn(q.store.logger).Log("msg", "failed to read the alerts state from the KV store", "user", userID, "alert", alertName, "err", err)
+	}
+	if len(result) == 0 {
+		return q.Querier.Select(ctx, sortSeries, hints, matchers...)
+	}
+
+	return series.NewConcreteSeriesSet(sortSeries, result)
+}
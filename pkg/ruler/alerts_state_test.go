@@ -0,0 +1,252 @@
+package ruler
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func newTestAlertsStateStore(t *testing.T, writeInterval time.Duration) *AlertsStateStore {
+	kvClient, closer := consul.NewInMemoryClient(alertsStateCodec{}, log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	cfg := AlertsStateConfig{Enabled: true, WriteInterval: writeInterval}
+	cfg.KVStore.Mock = kvClient
+
+	store, err := NewAlertsStateStore(cfg, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	return store
+}
+
+func ruleGroupContext(ctx context.Context, file, name string) context.Context {
+	return promql.NewOriginContext(ctx, map[string]interface{}{
+		"ruleGroup": map[string]string{"file": file, "name": name},
+	})
+}
+
+func TestAlertsStateStore_ShouldBoundTheWriteFrequency(t *testing.T) {
+	store := newTestAlertsStateStore(t, time.Minute)
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+
+	ctx := ruleGroupContext(context.Background(), "namespace", "group")
+	key := alertsStateKey("user-1", "namespace", "group", "HighLatency")
+	series := []labels.Labels{labels.FromStrings(labels.MetricName, alertForStateMetricName, labels.AlertName, "HighLatency", "instance", "a")}
+
+	readState := func() *alertsState {
+		v, err := store.kv.Get(context.Background(), key)
+		require.NoError(t, err)
+		state, _ := v.(*alertsState)
+		return state
+	}
+
+	// The first state is written straight away.
+	store.record(ctx, "user-1", series, []cortexpb.Sample{{TimestampMs: 1000000, Value: 900}})
+	require.NotNil(t, readState())
+	assert.Equal(t, int64(1000000), readState().Timestamp)
+	assert.Equal(t, float64(900), readState().Alerts[0].ActiveAt)
+
+	// The following states are not written within the write interval.
+	now = now.Add(30 * time.Second)
+	store.record(ctx, "user-1", series, []cortexpb.Sample{{TimestampMs: 1030000, Value: 900}})
+	assert.Equal(t, int64(1000000), readState().Timestamp)
+
+	// The state is written again once the write interval elapsed, even if the alert is unchanged.
+	now = now.Add(30 * time.Second)
+	store.record(ctx, "user-1", series, []cortexpb.Sample{{TimestampMs: 1060000, Value: 900}})
+	assert.Equal(t, int64(1060000), readState().Timestamp)
+
+	// The resolved alert is removed once the write interval elapsed, even if the rule
+	// doesn't write any ALERTS_FOR_STATE series anymore.
+	now = now.Add(30 * time.Second)
+	store.record(ctx, "user-1", series, []cortexpb.Sample{{TimestampMs: 1090000, Value: math.Float64frombits(value.StaleNaN)}})
+	assert.NotNil(t, readState())
+
+	now = now.Add(30 * time.Second)
+	store.record(ctx, "user-1", nil, nil)
+	assert.Nil(t, readState())
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(store.writes))
+	assert.Equal(t, float64(0), testutil.ToFloat64(store.writeFailures))
+}
+
+func TestAlertsStateStore_ShouldPreserveTheForStateOnFailover(t *testing.T) {
+	const (
+		userID    = "user-1"
+		groupFile = "namespace"
+		groupName = "group"
+	)
+
+	expr, err := parser.ParseExpr("up == 0")
+	require.NoError(t, err)
+
+	pusher := newPusherMock()
+	pusher.MockPush(&cortexpb.WriteResponse{}, nil)
+
+	queryFunc := func(context.Context, string, time.Time) (promql.Vector, error) {
+		return promql.Vector{{Metric: labels.FromStrings("instance", "a"), F: 1}}, nil
+	}
+	noopQueryable := storage.QueryableFunc(func(int64, int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})
+
+	store := newTestAlertsStateStore(t, 0)
+
+	// Creates the rule group of a ruler replica, with a single alerting rule pending for 10m.
+	newGroup := func(queryable storage.Queryable) *promRules.Group {
+		appendable := NewPusherAppendable(pusher, userID, ruleLimits{}, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+		appendable.alertsState = store
+
+		rule := promRules.NewAlertingRule("InstanceDown", expr, 10*time.Minute, 0, labels.EmptyLabels(), labels.EmptyLabels(), labels.EmptyLabels(), "", false, log.NewNopLogger())
+		return promRules.NewGroup(promRules.GroupOptions{
+			Name:          groupName,
+			File:          groupFile,
+			Interval:      time.Minute,
+			Rules:         []promRules.Rule{rule},
+			ShouldRestore: true,
+			Opts: &promRules.ManagerOptions{
+				Appendable:      appendable,
+				Queryable:       queryable,
+				QueryFunc:       queryFunc,
+				Context:         user.InjectOrgID(context.Background(), userID),
+				Logger:          log.NewNopLogger(),
+				NotifyFunc:      func(context.Context, string, ...*promRules.Alert) {},
+				OutageTolerance: time.Hour,
+				ForGracePeriod:  time.Minute,
+			},
+		})
+	}
+
+	activeAt := func(g *promRules.Group) time.Time {
+		alerts := g.AlertingRules()[0].ActiveAlerts()
+		require.Len(t, alerts, 1)
+		return alerts[0].ActiveAt.UTC()
+	}
+
+	ctx := ruleGroupContext(user.InjectOrgID(context.Background(), userID), groupFile, groupName)
+	start := time.Unix(1700000000, 0).UTC()
+
+	// Like the rules manager, the 'for' state is restored after the first evaluation of a group.
+	evalFirst := func(g *promRules.Group, ts time.Time) {
+		g.Eval(ctx, ts)
+		g.RestoreForState(ts)
+	}
+
+	// The first replica evaluates the group for 3 minutes.
+	first := newGroup(store.Queryable(noopQueryable))
+	evalFirst(first, start)
+	first.Eval(ctx, start.Add(time.Minute))
+	first.Eval(ctx, start.Add(2*time.Minute))
+	require.Equal(t, start, activeAt(first))
+
+	// The second replica takes over the group one evaluation later, and restores the alert state
+	// from the KV store. Only the missed evaluation is not accounted as pending time.
+	failoverAt := start.Add(3 * time.Minute)
+	second := newGroup(store.Queryable(noopQueryable))
+	evalFirst(second, failoverAt)
+	assert.Equal(t, start.Add(time.Minute), activeAt(second))
+	assert.Equal(t, float64(1), testutil.ToFloat64(store.restored))
+
+	// Without the state shared, the 'for' countdown restarts on failover.
+	unshared := newGroup(noopQueryable)
+	evalFirst(unshared, failoverAt)
+	assert.Equal(t, failoverAt, activeAt(unshared))
+}
+
+func TestAlertsStateStore_ShouldRestoreTheForStateOfGroupsAssignedToAnExistingManager(t *testing.T) {
+	const userID = "user-1"
+
+	store := newTestAlertsStateStore(t, 0)
+	pusher := newPusherMock()
+	pusher.MockPush(&cortexpb.WriteResponse{}, nil)
+
+	// The alert was pending for 10m on the ruler which evaluated the group before the failover.
+	now := time.Now()
+	activeAt := now.Add(-10 * time.Minute).Truncate(time.Second)
+	require.NoError(t, store.kv.CAS(context.Background(), alertsStateKey(userID, "namespace", "failover", "InstanceDown"), func(interface{}) (interface{}, bool, error) {
+		return &alertsState{
+			Timestamp: now.UnixMilli(),
+			Alerts: []alertState{{
+				Labels:   labels.FromStrings(labels.MetricName, alertForStateMetricName, labels.AlertName, "InstanceDown", "instance", "a"),
+				ActiveAt: float64(activeAt.Unix()),
+			}},
+		}, true, nil
+	}))
+
+	var rulesManager *promRules.Manager
+	factory := func(ctx context.Context, userID string, _ *notifier.Manager, logger log.Logger, reg prometheus.Registerer) RulesManager {
+		appendable := NewPusherAppendable(pusher, userID, ruleLimits{}, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+		appendable.alertsState = store
+
+		rulesManager = promRules.NewManager(&promRules.ManagerOptions{
+			Appendable: appendable,
+			Queryable: store.Queryable(storage.QueryableFunc(func(int64, int64) (storage.Querier, error) {
+				return storage.NoopQuerier(), nil
+			})),
+			QueryFunc: func(context.Context, string, time.Time) (promql.Vector, error) {
+				return promql.Vector{{Metric: labels.FromStrings("instance", "a"), F: 1}}, nil
+			},
+			Context:         user.InjectOrgID(ctx, userID),
+			Logger:          logger,
+			Registerer:      reg,
+			NotifyFunc:      func(context.Context, string, ...*promRules.Alert) {},
+			OutageTolerance: time.Hour,
+			ForGracePeriod:  time.Minute,
+		})
+		return rulesManager
+	}
+
+	m, err := NewDefaultMultiTenantManager(Config{RulePath: t.TempDir()}, factory, nil, prometheus.NewRegistry(), log.NewNopLogger())
+	require.NoError(t, err)
+	t.Cleanup(m.Stop)
+
+	newGroup := func(name string) *rulespb.RuleGroupDesc {
+		return &rulespb.RuleGroupDesc{
+			Name:      name,
+			Namespace: "namespace",
+			Interval:  100 * time.Millisecond,
+			User:      userID,
+			Rules:     []*rulespb.RuleDesc{{Alert: "InstanceDown", Expr: "up == 0", For: time.Hour}},
+		}
+	}
+
+	// The tenant manager is created by the first sync, and reused once the group is assigned to this ruler.
+	m.SyncRuleGroups(context.Background(), map[string]rulespb.RuleGroupList{userID: {newGroup("existing")}})
+	m.SyncRuleGroups(context.Background(), map[string]rulespb.RuleGroupList{userID: {newGroup("existing"), newGroup("failover")}})
+
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		for _, g := range rulesManager.RuleGroups() {
+			if g.Name() != "failover" {
+				continue
+			}
+			for _, rule := range g.AlertingRules() {
+				alerts := rule.ActiveAlerts()
+				if rule.Restored() && len(alerts) == 1 {
+					// The restored pending time only excludes the time elapsed since the state was written.
+					return alerts[0].ActiveAt.Before(now.Add(-9 * time.Minute))
+				}
+			}
+		}
+		return false
+	})
+}
@@ -65,6 +65,10 @@ type RuleGroup struct {
 	LastEvaluation time.Time `json:"lastEvaluation"`
 	EvaluationTime float64   `json:"evaluationTime"`
 	Limit          int64     `json:"limit"`
+	FeatureFlag    string    `json:"featureFlag,omitempty"`
+	// Skipped is true when the rule group is not evaluated because the tenant
+	// doesn't have its feature flag.
+	Skipped bool `json:"skipped,omitempty"`
 }
 
 type rule interface{}
@@ -161,6 +165,8 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 			LastEvaluation: g.GetEvaluationTimestamp(),
 			EvaluationTime: g.GetEvaluationDuration().Seconds(),
 			Limit:          g.Group.Limit,
+			FeatureFlag:    g.Group.FeatureFlag,
+			Skipped:        g.Skipped,
 		}
 
 		for i, rl := range g.ActiveRules {
@@ -426,7 +432,7 @@ func (a *API) ListRules(w http.ResponseWriter, req *http.Request) {
 
 	level.Debug(logger).Log("msg", "retrieved rule groups from rule store", "userID", userID, "num_namespaces", len(rgs))
 
-	formatted := rgs.Formatted()
+	formatted := rgs.FormattedWithFeatureFlags()
 	marshalAndSend(formatted, w, logger)
 }
 
@@ -448,7 +454,7 @@ func (a *API) GetRuleGroup(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	formatted := rulespb.FromProto(rg)
+	formatted := rulespb.RuleGroup{RuleGroup: rulespb.FromProto(rg), FeatureFlag: rg.FeatureFlag}
 	marshalAndSend(formatted, w, logger)
 }
 
@@ -469,7 +475,7 @@ func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
 
 	level.Debug(logger).Log("msg", "attempting to unmarshal rulegroup", "userID", userID, "group", string(payload))
 
-	rg := rulefmt.RuleGroup{}
+	rg := rulespb.RuleGroup{}
 	err = yaml.Unmarshal(payload, &rg)
 	if err != nil {
 		level.Error(logger).Log("msg", "unable to unmarshal rule group payload", "err", err.Error())
@@ -477,7 +483,7 @@ func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	errs := a.ruler.manager.ValidateRuleGroup(rg)
+	errs := a.ruler.manager.ValidateRuleGroup(rg.RuleGroup)
 	if len(errs) > 0 {
 		e := []string{}
 		for _, err := range errs {
@@ -510,7 +516,8 @@ func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	rgProto := rulespb.ToProto(userID, namespace, rg)
+	rgProto := rulespb.ToProto(userID, namespace, rg.RuleGroup)
+	rgProto.FeatureFlag = rg.FeatureFlag
 	loadedRg := rulespb.FromProto(rgProto)
 	rgYaml, err := yaml.Marshal(loadedRg)
 	if err == nil {
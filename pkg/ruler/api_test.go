@@ -281,6 +281,19 @@ rules:
 `,
 			output: "name: test\ninterval: 15s\nrules:\n    - record: up_rule\n      expr: up{}\n    - alert: up_alert\n      expr: sum(up{}) > 1\n      for: 30s\n      labels:\n        test: test\n      annotations:\n        test: test\n",
 		},
+		{
+			name:   "with a feature flag",
+			status: 202,
+			input: `
+name: test
+interval: 15s
+feature_flag: beta
+rules:
+- record: up_rule
+  expr: up{}
+`,
+			output: "name: test\ninterval: 15s\nrules:\n    - record: up_rule\n      expr: up{}\nfeature_flag: beta\n",
+		},
 	}
 
 	for _, tt := range tc {
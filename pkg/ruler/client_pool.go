@@ -65,7 +65,8 @@ func newRulerClientFactory(clientCfg grpcclient.Config, reg prometheus.Registere
 }
 
 func dialRulerClient(clientCfg grpcclient.Config, addr string, requestDuration *prometheus.HistogramVec) (*rulerExtendedClient, error) {
-	opts, err := clientCfg.DialOption(grpcclient.Instrument(requestDuration))
+	unaryInterceptors, streamInterceptors := grpcclient.Instrument(requestDuration)
+	opts, err := clientCfg.DialOptionForTarget(addr, unaryInterceptors, streamInterceptors)
 	if err != nil {
 		return nil, err
 	}
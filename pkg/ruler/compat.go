@@ -36,8 +36,9 @@ type Pusher interface {
 }
 
 type PusherAppender struct {
-	failedWrites prometheus.Counter
-	totalWrites  prometheus.Counter
+	failedWrites  prometheus.Counter
+	totalWrites   prometheus.Counter
+	skippedWrites prometheus.Counter
 
 	ctx             context.Context
 	pusher          Pusher
@@ -45,6 +46,13 @@ type PusherAppender struct {
 	samples         []cortexpb.Sample
 	userID          string
 	evaluationDelay time.Duration
+
+	// Skip the writes of results unchanged since the previous evaluation, up to the max interval.
+	unchangedResults             *unchangedResultsCache
+	skipUnchangedResultsInterval time.Duration
+
+	// Records the alerts state shared across the ruler replicas. Nil if disabled.
+	alertsState *AlertsStateStore
 }
 
 func (a *PusherAppender) AppendHistogram(storage.SeriesRef, labels.Labels, int64, *histogram.Histogram, *histogram.FloatHistogram) (storage.SeriesRef, error) {
@@ -83,6 +91,23 @@ func (a *PusherAppender) AppendExemplar(_ storage.SeriesRef, _ labels.Labels, _
 }
 
 func (a *PusherAppender) Commit() error {
+	// The alerts state is recorded even if the write is skipped, so that it's kept fresh.
+	if a.alertsState != nil {
+		a.alertsState.record(a.ctx, a.userID, a.labels, a.samples)
+	}
+
+	var seriesHash, valuesHash uint64
+	if a.skipUnchangedResultsInterval > 0 {
+		now := time.Now()
+		seriesHash, valuesHash = hashResults(a.labels, a.samples)
+		if a.unchangedResults.shouldSkip(seriesHash, valuesHash, now, a.skipUnchangedResultsInterval) {
+			a.skippedWrites.Inc()
+			a.labels = nil
+			a.samples = nil
+			return nil
+		}
+	}
+
 	a.totalWrites.Inc()
 
 	// Since a.pusher is distributor, client.ReuseSlice will be called in a.pusher.Push.
@@ -94,6 +119,8 @@ func (a *PusherAppender) Commit() error {
 		if resp, ok := httpgrpc.HTTPResponseFromError(err); !ok || resp.Code/100 != 4 {
 			a.failedWrites.Inc()
 		}
+	} else if a.skipUnchangedResultsInterval > 0 {
+		a.unchangedResults.written(seriesHash, valuesHash, time.Now(), a.skipUnchangedResultsInterval)
 	}
 
 	a.labels = nil
@@ -117,30 +144,40 @@ type PusherAppendable struct {
 	userID      string
 	rulesLimits RulesLimits
 
-	totalWrites  prometheus.Counter
-	failedWrites prometheus.Counter
+	totalWrites   prometheus.Counter
+	failedWrites  prometheus.Counter
+	skippedWrites prometheus.Counter
+
+	unchangedResults *unchangedResultsCache
+	alertsState      *AlertsStateStore
 }
 
-func NewPusherAppendable(pusher Pusher, userID string, limits RulesLimits, totalWrites, failedWrites prometheus.Counter) *PusherAppendable {
+func NewPusherAppendable(pusher Pusher, userID string, limits RulesLimits, totalWrites, failedWrites, skippedWrites prometheus.Counter) *PusherAppendable {
 	return &PusherAppendable{
-		pusher:       pusher,
-		userID:       userID,
-		rulesLimits:  limits,
-		totalWrites:  totalWrites,
-		failedWrites: failedWrites,
+		pusher:           pusher,
+		userID:           userID,
+		rulesLimits:      limits,
+		totalWrites:      totalWrites,
+		failedWrites:     failedWrites,
+		skippedWrites:    skippedWrites,
+		unchangedResults: newUnchangedResultsCache(),
 	}
 }
 
 // Appender returns a storage.Appender
 func (t *PusherAppendable) Appender(ctx context.Context) storage.Appender {
 	return &PusherAppender{
-		failedWrites: t.failedWrites,
-		totalWrites:  t.totalWrites,
-
-		ctx:             ctx,
-		pusher:          t.pusher,
-		userID:          t.userID,
-		evaluationDelay: t.rulesLimits.EvaluationDelay(t.userID),
+		failedWrites:  t.failedWrites,
+		totalWrites:   t.totalWrites,
+		skippedWrites: t.skippedWrites,
+
+		ctx:                          ctx,
+		pusher:                       t.pusher,
+		userID:                       t.userID,
+		evaluationDelay:              t.rulesLimits.EvaluationDelay(t.userID),
+		unchangedResults:             t.unchangedResults,
+		skipUnchangedResultsInterval: t.rulesLimits.RulerSkipUnchangedResultsMaxInterval(t.userID),
+		alertsState:                  t.alertsState,
 	}
 }
 
@@ -152,6 +189,11 @@ type RulesLimits interface {
 	RulerMaxRuleGroupsPerTenant(userID string) int
 	RulerMaxRulesPerRuleGroup(userID string) int
 	DisabledRuleGroups(userID string) validation.DisabledRuleGroups
+	RulerFeatureFlags(userID string) []string
+	RulerMaxConcurrentGroupEvaluations(userID string) int
+	RulerSkipUnchangedResultsMaxInterval(userID string) time.Duration
+	RulerReloadQuietPeriod(userID string) time.Duration
+	RulerNotificationDeduplication(userID string) bool
 }
 
 // EngineQueryFunc returns a new engine query function by passing an altered timestamp.
@@ -298,7 +340,11 @@ type RulesManager interface {
 // ManagerFactory is a function that creates new RulesManager for given user and notifier.Manager.
 type ManagerFactory func(ctx context.Context, userID string, notifier *notifier.Manager, logger log.Logger, reg prometheus.Registerer) RulesManager
 
-func DefaultTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, engine promql.QueryEngine, overrides RulesLimits, evalMetrics *RuleEvalMetrics, reg prometheus.Registerer) ManagerFactory {
+// DefaultTenantManagerFactory returns a ManagerFactory creating the rules manager of a tenant. The
+// alertsState store is optional, and shares the alerts state across the ruler replicas if set.
+// The notificationDedup deduplicator is optional too, and deduplicates the alert notifications
+// across the ruler replicas if set.
+func DefaultTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, engine promql.QueryEngine, overrides RulesLimits, evalMetrics *RuleEvalMetrics, alertsState *AlertsStateStore, notificationDedup *NotificationDeduplicator, reg prometheus.Registerer) ManagerFactory {
 	// Wrap errors returned by Queryable to our wrapper, so that we can distinguish between those errors
 	// and errors returned by PromQL engine. Errors from Queryable can be either caused by user (limits) or internal errors.
 	// Errors from PromQL are always "user" errors.
@@ -314,17 +360,32 @@ func DefaultTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, engi
 		totalQueries := evalMetrics.TotalQueriesVec.WithLabelValues(userID)
 		totalWrites := evalMetrics.TotalWritesVec.WithLabelValues(userID)
 		failedWrites := evalMetrics.FailedWritesVec.WithLabelValues(userID)
+		skippedWrites := evalMetrics.SkippedWritesVec.WithLabelValues(userID)
 
 		engineQueryFunc := EngineQueryFunc(engine, q, overrides, userID, cfg.LookbackDelta)
 		metricsQueryFunc := MetricsQueryFunc(engineQueryFunc, totalQueries, failedQueries)
+		trackedQueryFunc := evalMetrics.RuleEvaluationTracker.QueryFunc(userID, metricsQueryFunc)
+
+		// The queryable is only used by the manager to restore the 'for' state of the alerts.
+		appendable := NewPusherAppendable(p, userID, overrides, totalWrites, failedWrites, skippedWrites)
+		restoreQueryable := q
+		if alertsState != nil {
+			appendable.alertsState = alertsState
+			restoreQueryable = alertsState.Queryable(q)
+		}
 
-		return rules.NewManager(&rules.ManagerOptions{
-			Appendable:             NewPusherAppendable(p, userID, overrides, totalWrites, failedWrites),
-			Queryable:              q,
-			QueryFunc:              RecordAndReportRuleQueryMetrics(metricsQueryFunc, queryTime, logger),
+		notifyFunc := SendAlerts(notifier, cfg.ExternalURL.URL.String())
+		if notificationDedup != nil {
+			notifyFunc = notificationDedup.NotifyFunc(userID, overrides, notifyFunc)
+		}
+
+		manager := rules.NewManager(&rules.ManagerOptions{
+			Appendable:             appendable,
+			Queryable:              restoreQueryable,
+			QueryFunc:              RecordAndReportRuleQueryMetrics(trackedQueryFunc, queryTime, logger),
 			Context:                user.InjectOrgID(ctx, userID),
 			ExternalURL:            cfg.ExternalURL.URL,
-			NotifyFunc:             SendAlerts(notifier, cfg.ExternalURL.URL.String()),
+			NotifyFunc:             notifyFunc,
 			Logger:                 log.With(logger, "user", userID),
 			Registerer:             reg,
 			OutageTolerance:        cfg.OutageTolerance,
@@ -333,6 +394,13 @@ func DefaultTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, engi
 			ConcurrentEvalsEnabled: cfg.ConcurrentEvalsEnabled,
 			MaxConcurrentEvals:     cfg.MaxConcurrentEvals,
 		})
+
+		limiter := newGroupEvaluationLimiter(userID, overrides, evalMetrics.GroupEvaluationWaitSeconds.WithLabelValues(userID))
+		var rulesManager RulesManager = newConcurrencyLimitedRulesManager(manager, limiter)
+		if notificationDedup != nil {
+			rulesManager = newNotificationLeasesRulesManager(rulesManager, userID, notificationDedup)
+		}
+		return rulesManager
 	}
 }
 
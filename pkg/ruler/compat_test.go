@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -13,9 +14,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/httpgrpc"
 
@@ -36,7 +39,7 @@ func (p *fakePusher) Push(ctx context.Context, r *cortexpb.WriteRequest) (*corte
 
 func TestPusherAppendable(t *testing.T) {
 	pusher := &fakePusher{}
-	pa := NewPusherAppendable(pusher, "user-1", nil, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	pa := NewPusherAppendable(pusher, "user-1", nil, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
 
 	for _, tc := range []struct {
 		name       string
@@ -156,7 +159,7 @@ func TestPusherErrors(t *testing.T) {
 			writes := prometheus.NewCounter(prometheus.CounterOpts{})
 			failures := prometheus.NewCounter(prometheus.CounterOpts{})
 
-			pa := NewPusherAppendable(pusher, "user-1", ruleLimits{evalDelay: 10 * time.Second}, writes, failures)
+			pa := NewPusherAppendable(pusher, "user-1", ruleLimits{evalDelay: 10 * time.Second}, writes, failures, prometheus.NewCounter(prometheus.CounterOpts{}))
 
 			lbls, err := parser.ParseMetric("foo_bar")
 			require.NoError(t, err)
@@ -173,6 +176,58 @@ func TestPusherErrors(t *testing.T) {
 	}
 }
 
+func TestPusherAppendable_ShouldSkipWritingUnchangedResults(t *testing.T) {
+	ctx := context.Background()
+	pusher := &fakePusher{response: &cortexpb.WriteResponse{}}
+
+	writes := prometheus.NewCounter(prometheus.CounterOpts{})
+	skipped := prometheus.NewCounter(prometheus.CounterOpts{})
+	pa := NewPusherAppendable(pusher, "user-1", ruleLimits{skipUnchangedResults: time.Hour}, writes, prometheus.NewCounter(prometheus.CounterOpts{}), skipped)
+
+	push := func(values ...float64) {
+		a := pa.Appender(ctx)
+		for i, v := range values {
+			_, err := a.Append(0, labels.FromStrings(labels.MetricName, "foo_bar", "series", strconv.Itoa(i)), int64(model.Now()), v)
+			require.NoError(t, err)
+		}
+		require.NoError(t, a.Commit())
+	}
+
+	push(1, 2)
+	push(1, 2)
+	assert.Equal(t, 1.0, testutil.ToFloat64(writes))
+	assert.Equal(t, 1.0, testutil.ToFloat64(skipped))
+
+	// Changing a value, or the result series, writes the results.
+	push(1, 3)
+	push(1)
+	assert.Equal(t, 3.0, testutil.ToFloat64(writes))
+	assert.Equal(t, 1.0, testutil.ToFloat64(skipped))
+
+	// Stale markers are written.
+	push(math.Float64frombits(value.StaleNaN))
+	assert.Equal(t, 4.0, testutil.ToFloat64(writes))
+}
+
+func TestUnchangedResultsCache(t *testing.T) {
+	c := newUnchangedResultsCache()
+	now := time.Now()
+
+	assert.False(t, c.shouldSkip(1, 1, now, time.Minute))
+
+	c.written(1, 1, now, time.Minute)
+	assert.True(t, c.shouldSkip(1, 1, now.Add(30*time.Second), time.Minute))
+	assert.False(t, c.shouldSkip(1, 2, now.Add(30*time.Second), time.Minute))
+	assert.False(t, c.shouldSkip(2, 1, now.Add(30*time.Second), time.Minute))
+
+	// The results are written again once the max interval has elapsed.
+	assert.False(t, c.shouldSkip(1, 1, now.Add(time.Minute), time.Minute))
+
+	// Expired entries are purged.
+	c.written(2, 1, now.Add(2*time.Minute), time.Minute)
+	assert.Len(t, c.entries, 1)
+}
+
 func TestMetricsQueryFuncErrors(t *testing.T) {
 	for name, tc := range map[string]struct {
 		returnedError          error
@@ -0,0 +1,117 @@
+package ruler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	promRules "github.com/prometheus/prometheus/rules"
+)
+
+type groupEvaluationLimits interface {
+	// RulerMaxConcurrentGroupEvaluations returns the maximum number of concurrent group evaluations. 0 = no limit.
+	RulerMaxConcurrentGroupEvaluations(userID string) int
+}
+
+// groupEvaluationLimiter limits the number of rule groups of a tenant evaluated concurrently.
+// Evaluations exceeding the limit wait until a running one completes.
+type groupEvaluationLimiter struct {
+	userID string
+	limits groupEvaluationLimits
+
+	waitSeconds prometheus.Counter
+
+	mtx      sync.Mutex
+	inFlight int
+	// released is closed, and replaced, every time a slot is released.
+	released chan struct{}
+}
+
+func newGroupEvaluationLimiter(userID string, limits groupEvaluationLimits, waitSeconds prometheus.Counter) *groupEvaluationLimiter {
+	return &groupEvaluationLimiter{
+		userID:      userID,
+		limits:      limits,
+		waitSeconds: waitSeconds,
+		released:    make(chan struct{}),
+	}
+}
+
+// acquire blocks until the group can be evaluated without exceeding the limit, or the context is done.
+func (l *groupEvaluationLimiter) acquire(ctx context.Context) error {
+	var waitStart time.Time
+	defer func() {
+		if !waitStart.IsZero() {
+			l.waitSeconds.Add(time.Since(waitStart).Seconds())
+		}
+	}()
+
+	for {
+		l.mtx.Lock()
+		// The limit is read at every attempt, so that runtime changes are honored.
+		if limit := l.limits.RulerMaxConcurrentGroupEvaluations(l.userID); limit <= 0 || l.inFlight < limit {
+			l.inFlight++
+			l.mtx.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mtx.Unlock()
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *groupEvaluationLimiter) release() {
+	l.mtx.Lock()
+	l.inFlight--
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mtx.Unlock()
+}
+
+// wrap returns a GroupEvalIterationFunc which runs the given one within the limit.
+func (l *groupEvaluationLimiter) wrap(iterationFunc promRules.GroupEvalIterationFunc) promRules.GroupEvalIterationFunc {
+	if iterationFunc == nil {
+		iterationFunc = promRules.DefaultEvalIterationFunc
+	}
+
+	return func(ctx context.Context, g *promRules.Group, evalTimestamp time.Time) {
+		// The iteration is skipped if the context is done while waiting, like Prometheus
+		// does when the group is stopped.
+		if err := l.acquire(ctx); err != nil {
+			return
+		}
+		defer l.release()
+
+		iterationFunc(ctx, g, evalTimestamp)
+	}
+}
+
+// concurrencyLimitedRulesManager is a RulesManager evaluating the rule groups within
+// the tenant limit of concurrent group evaluations.
+type concurrencyLimitedRulesManager struct {
+	RulesManager
+
+	limiter *groupEvaluationLimiter
+}
+
+func newConcurrencyLimitedRulesManager(manager RulesManager, limiter *groupEvaluationLimiter) *concurrencyLimitedRulesManager {
+	return &concurrencyLimitedRulesManager{
+		RulesManager: manager,
+		limiter:      limiter,
+	}
+}
+
+// Update implements RulesManager.
+func (m *concurrencyLimitedRulesManager) Update(interval time.Duration, files []string, externalLabels labels.Labels, externalURL string, ruleGroupPostProcessFunc promRules.GroupEvalIterationFunc) error {
+	return m.RulesManager.Update(interval, files, externalLabels, externalURL, m.limiter.wrap(ruleGroupPostProcessFunc))
+}
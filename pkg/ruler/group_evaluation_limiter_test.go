@@ -0,0 +1,89 @@
+package ruler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestGroupEvaluationLimiter(t *testing.T) {
+	limits := ruleLimits{maxConcurrentGroups: 1}
+	waitSeconds := prometheus.NewCounter(prometheus.CounterOpts{Name: "wait_seconds"})
+	limiter := newGroupEvaluationLimiter("user-1", limits, waitSeconds)
+
+	require.NoError(t, limiter.acquire(context.Background()))
+
+	// The second evaluation waits until the first one completes.
+	acquired := atomic.NewBool(false)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, limiter.acquire(context.Background()))
+		acquired.Store(true)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, acquired.Load())
+
+	limiter.release()
+	<-done
+	assert.True(t, acquired.Load())
+	assert.Greater(t, testutil.ToFloat64(waitSeconds), 0.0)
+	limiter.release()
+}
+
+func TestGroupEvaluationLimiter_ShouldStopWaitingOnContextCancellation(t *testing.T) {
+	limits := ruleLimits{maxConcurrentGroups: 1}
+	limiter := newGroupEvaluationLimiter("user-1", limits, prometheus.NewCounter(prometheus.CounterOpts{Name: "wait_seconds"}))
+
+	require.NoError(t, limiter.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.acquire(ctx), context.DeadlineExceeded)
+}
+
+func TestGroupEvaluationLimiter_ShouldNotLimitWhenDisabled(t *testing.T) {
+	limiter := newGroupEvaluationLimiter("user-1", ruleLimits{}, prometheus.NewCounter(prometheus.CounterOpts{Name: "wait_seconds"}))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, limiter.acquire(context.Background()))
+	}
+	assert.Equal(t, 10, limiter.inFlight)
+}
+
+func TestConcurrencyLimitedRulesManager_ShouldWrapIterationFunc(t *testing.T) {
+	limits := ruleLimits{maxConcurrentGroups: 1}
+	limiter := newGroupEvaluationLimiter("user-1", limits, prometheus.NewCounter(prometheus.CounterOpts{Name: "wait_seconds"}))
+
+	upstream := &iterationFuncCapturingManager{}
+	manager := newConcurrencyLimitedRulesManager(upstream, limiter)
+
+	inFlight := 0
+	require.NoError(t, manager.Update(time.Minute, nil, labels.EmptyLabels(), "", func(ctx context.Context, g *promRules.Group, evalTimestamp time.Time) {
+		inFlight = limiter.inFlight
+	}))
+
+	upstream.iterationFunc(context.Background(), nil, time.Now())
+	assert.Equal(t, 1, inFlight)
+	assert.Equal(t, 0, limiter.inFlight)
+}
+
+type iterationFuncCapturingManager struct {
+	mockRulesManager
+
+	iterationFunc promRules.GroupEvalIterationFunc
+}
+
+func (m *iterationFuncCapturingManager) Update(_ time.Duration, _ []string, _ labels.Labels, _ string, iterationFunc promRules.GroupEvalIterationFunc) error {
+	m.iterationFunc = iterationFunc
+	return nil
+}
@@ -200,10 +200,14 @@ func (r *DefaultMultiTenantManager) syncRulesToManager(ctx context.Context, user
 	if !existing || update {
 		level.Debug(r.logger).Log("msg", "updating rules", "user", user)
 		r.configUpdatesTotal.WithLabelValues(user).Inc()
+		iterationFunc := promRules.GroupEvalIterationFunc(ruleGroupIterationFunc)
 		if update && existing {
-			r.updateRuleCache(user, manager.RuleGroups())
+			previous := manager.RuleGroups()
+			r.updateRuleCache(user, previous)
+			// The manager only restores the 'for' state of the groups loaded by its first update.
+			iterationFunc = forStateRestoringIterationFunc(previous)
 		}
-		err = manager.Update(r.cfg.EvaluationInterval, files, r.cfg.ExternalLabels, r.cfg.ExternalURL.String(), ruleGroupIterationFunc)
+		err = manager.Update(r.cfg.EvaluationInterval, files, r.cfg.ExternalLabels, r.cfg.ExternalURL.String(), iterationFunc)
 		r.deleteRuleCache(user)
 		if err != nil {
 			r.lastReloadSuccessful.WithLabelValues(user).Set(0)
@@ -255,6 +259,46 @@ func ruleGroupIterationFunc(ctx context.Context, g *promRules.Group, evalTimesta
 	promRules.DefaultEvalIterationFunc(ctx, g, evalTimestamp)
 }
 
+// forStateRestoringIterationFunc returns an iteration function restoring the 'for' state of the alerts
+// of the groups not found in the previous groups, for example the groups assigned to this ruler on
+// failover, like the Prometheus rules manager does for the groups loaded by its first update: the
+// ALERTS_FOR_STATE series aren't written until the state is restored after the second evaluation.
+func forStateRestoringIterationFunc(previous []*promRules.Group) promRules.GroupEvalIterationFunc {
+	previousKeys := make(map[string]struct{}, len(previous))
+	for _, g := range previous {
+		previousKeys[promRules.GroupKey(g.File(), g.Name())] = struct{}{}
+	}
+
+	var mtx sync.Mutex
+	// Number of evaluations of the new groups, keyed by the group key, up to the one restoring the state.
+	evaluations := map[string]int{}
+
+	return func(ctx context.Context, g *promRules.Group, evalTimestamp time.Time) {
+		key := promRules.GroupKey(g.File(), g.Name())
+
+		evaluation := -1
+		if _, ok := previousKeys[key]; !ok {
+			mtx.Lock()
+			if evaluation = evaluations[key]; evaluation <= 1 {
+				evaluations[key] = evaluation + 1
+			}
+			mtx.Unlock()
+		}
+
+		if evaluation == 0 {
+			for _, rule := range g.AlertingRules() {
+				rule.SetRestored(false)
+			}
+		}
+
+		ruleGroupIterationFunc(ctx, g, evalTimestamp)
+
+		if evaluation == 1 {
+			g.RestoreForState(time.Now())
+		}
+	}
+}
+
 // newManager creates a prometheus rule manager wrapped with a user id
 // configured storage, appendable, notifier, and instrumentation
 func (r *DefaultMultiTenantManager) newManager(ctx context.Context, userID string) (RulesManager, error) {
@@ -227,9 +227,15 @@ func (m *ManagerMetrics) Collect(out chan<- prometheus.Metric) {
 type RuleEvalMetrics struct {
 	TotalWritesVec    *prometheus.CounterVec
 	FailedWritesVec   *prometheus.CounterVec
+	SkippedWritesVec  *prometheus.CounterVec
 	TotalQueriesVec   *prometheus.CounterVec
 	FailedQueriesVec  *prometheus.CounterVec
 	RulerQuerySeconds *prometheus.CounterVec
+
+	GroupEvaluationWaitSeconds *prometheus.CounterVec
+
+	// Tracks the slowest and most failing rules. Nil if disabled.
+	RuleEvaluationTracker *RuleEvaluationTracker
 }
 
 func NewRuleEvalMetrics(cfg Config, reg prometheus.Registerer) *RuleEvalMetrics {
@@ -242,6 +248,10 @@ func NewRuleEvalMetrics(cfg Config, reg prometheus.Registerer) *RuleEvalMetrics
 			Name: "cortex_ruler_write_requests_failed_total",
 			Help: "Number of failed write requests to ingesters.",
 		}, []string{"user"}),
+		SkippedWritesVec: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ruler_write_requests_skipped_total",
+			Help: "Number of write requests to ingesters skipped because the rule evaluation results were unchanged since the previous evaluation.",
+		}, []string{"user"}),
 		TotalQueriesVec: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_ruler_queries_total",
 			Help: "Number of queries executed by ruler.",
@@ -250,6 +260,10 @@ func NewRuleEvalMetrics(cfg Config, reg prometheus.Registerer) *RuleEvalMetrics
 			Name: "cortex_ruler_queries_failed_total",
 			Help: "Number of failed queries by ruler.",
 		}, []string{"user"}),
+		GroupEvaluationWaitSeconds: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ruler_group_evaluation_wait_seconds_total",
+			Help: "Total amount of time rule group evaluations spent waiting for the number of concurrent evaluations of the tenant to go below the limit.",
+		}, []string{"user"}),
 	}
 	if cfg.EnableQueryStats {
 		m.RulerQuerySeconds = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
@@ -257,6 +271,9 @@ func NewRuleEvalMetrics(cfg Config, reg prometheus.Registerer) *RuleEvalMetrics
 			Help: "Total amount of wall clock time spent processing queries by the ruler.",
 		}, []string{"user"})
 	}
+	if cfg.RuleEvaluationTrackerTopN > 0 {
+		m.RuleEvaluationTracker = NewRuleEvaluationTracker(cfg.RuleEvaluationTrackerTopN, cfg.RulePath, reg)
+	}
 
 	return m
 }
@@ -264,10 +281,13 @@ func NewRuleEvalMetrics(cfg Config, reg prometheus.Registerer) *RuleEvalMetrics
 func (m *RuleEvalMetrics) deletePerUserMetrics(userID string) {
 	m.TotalWritesVec.DeleteLabelValues(userID)
 	m.FailedWritesVec.DeleteLabelValues(userID)
+	m.SkippedWritesVec.DeleteLabelValues(userID)
 	m.TotalQueriesVec.DeleteLabelValues(userID)
 	m.FailedQueriesVec.DeleteLabelValues(userID)
+	m.GroupEvaluationWaitSeconds.DeleteLabelValues(userID)
 
 	if m.RulerQuerySeconds != nil {
 		m.RulerQuerySeconds.DeleteLabelValues(userID)
 	}
+	m.RuleEvaluationTracker.deleteUser(userID)
 }
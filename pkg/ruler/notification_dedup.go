@@ -0,0 +1,402 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	promRules "github.com/prometheus/prometheus/rules"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const notificationLeaseCodecID = "ruler.notificationLease"
+
+var (
+	errInvalidNotificationDedupKVStore       = errors.New("the dynamodb, inmemory and memberlist KV stores are not supported to deduplicate the notifications")
+	errInvalidNotificationDedupLeaseDuration = errors.New("the notification deduplication lease duration must be greater than 0")
+)
+
+// NotificationDedupConfig configures the deduplication of the alert notifications across the
+// ruler replicas.
+type NotificationDedupConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	KVStore       kv.Config     `yaml:"kvstore"`
+	LeaseDuration time.Duration `yaml:"lease_duration"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *NotificationDedupConfig) RegisterFlags(f *flag.FlagSet) {
+	cfg.KVStore.RegisterFlagsWithPrefix("ruler.notification-dedup.", "ruler-notification-dedup/", f)
+
+	f.BoolVar(&cfg.Enabled, "ruler.notification-dedup.enabled", false, "[Experimental] Deduplicate the alert notifications across the ruler replicas evaluating the same rule group, for example while a failover overlaps, through the KV store: only the replica holding the lease of the rule group sends its notifications. The deduplication is enabled per tenant with the ruler_notification_deduplication limit. The dynamodb, inmemory and memberlist KV stores are not supported.")
+	f.DurationVar(&cfg.LeaseDuration, "ruler.notification-dedup.lease-duration", 2*time.Minute, "[Experimental] Duration of the lease of a rule group notifications, renewed by the replica holding it while it evaluates the rule group. Another replica takes over the lease once expired. It must be greater than the rule groups evaluation interval.")
+}
+
+// Validate the config.
+func (cfg *NotificationDedupConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if util.StringsContain(unsupportedAlertsStateKVStores, cfg.KVStore.Store) {
+		return errInvalidNotificationDedupKVStore
+	}
+	if cfg.LeaseDuration <= 0 {
+		return errInvalidNotificationDedupLeaseDuration
+	}
+	return nil
+}
+
+// notificationLeases are the leases of the notifications of the rule groups of a tenant, as stored
+// in the KV store. The leases of a tenant are stored together, so that the replica evaluating many
+// rule groups of the tenant renews them with a single KV store update.
+type notificationLeases struct {
+	// Leases keyed by rule group, see notificationLeaseGroup().
+	Leases map[string]notificationLease `json:"leases"`
+}
+
+// notificationLease is the lease of the notifications of a rule group.
+type notificationLease struct {
+	Replica string `json:"replica"`
+	// Unix time in milliseconds the lease expires at.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// notificationLeaseGroup returns the key of the lease of the given rule group in the leases of the tenant.
+func notificationLeaseGroup(groupFile, groupName string) string {
+	return fmt.Sprintf("%s/%s", url.PathEscape(groupFile), url.PathEscape(groupName))
+}
+
+// notificationLeaseCodec is the JSON codec of the notification leases stored in the KV store.
+type notificationLeaseCodec struct{}
+
+func (notificationLeaseCodec) CodecID() string { return notificationLeaseCodecID }
+
+func (notificationLeaseCodec) Decode(b []byte) (interface{}, error) {
+	l := &notificationLeases{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (notificationLeaseCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (notificationLeaseCodec) DecodeMultiKey(map[string][]byte) (interface{}, error) {
+	return nil, errors.New("multi-key decoding is not supported")
+}
+
+func (notificationLeaseCodec) EncodeMultiKey(interface{}) (map[string][]byte, error) {
+	return nil, errors.New("multi-key encoding is not supported")
+}
+
+// NotificationDeduplicator deduplicates the alert notifications across the ruler replicas. The
+// replicas evaluating the same rule group compete for the lease of the rule group in the KV
+// store, and only the one holding it sends the notifications. The leases of the rule groups of a
+// tenant are renewed together by their holder while it evaluates them, taken over by another
+// replica once expired, and released when the holder stops evaluating the rule group.
+type NotificationDeduplicator struct {
+	cfg     NotificationDedupConfig
+	kv      kv.Client
+	replica string
+	logger  log.Logger
+
+	mtx     sync.Mutex
+	tenants map[string]*tenantNotificationLeases
+
+	deduplicated    prometheus.Counter
+	leaseTakeovers  prometheus.Counter
+	leaseKVFailures prometheus.Counter
+
+	now func() time.Time
+}
+
+// tenantNotificationLeases are the leases of the rule groups of a tenant evaluated by this replica.
+type tenantNotificationLeases struct {
+	// Serializes the updates of the tenant leases in the KV store.
+	kvMtx sync.Mutex
+
+	// Last known lease of each rule group evaluated by this replica, to not hit the KV store on
+	// every evaluation. Guarded by the deduplicator mutex.
+	leases map[string]notificationLease
+}
+
+// NewNotificationDeduplicator makes a new NotificationDeduplicator. The replica identifies the
+// ruler in the leases.
+func NewNotificationDeduplicator(cfg NotificationDedupConfig, replica string, logger log.Logger, reg prometheus.Registerer) (*NotificationDeduplicator, error) {
+	client, err := kv.NewClient(cfg.KVStore, notificationLeaseCodec{}, kv.RegistererWithKVName(prometheus.WrapRegistererWithPrefix("cortex_", reg), "ruler-notification-dedup"), logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "create KV store client")
+	}
+
+	return &NotificationDeduplicator{
+		cfg:     cfg,
+		kv:      client,
+		replica: replica,
+		logger:  logger,
+		tenants: map[string]*tenantNotificationLeases{},
+		deduplicated: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_notifications_deduplicated_total",
+			Help: "Total number of alert notifications not sent because another ruler replica holds the lease of the rule group.",
+		}),
+		leaseTakeovers: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_notification_lease_takeovers_total",
+			Help: "Total number of rule group notification leases acquired by the ruler.",
+		}),
+		leaseKVFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_notification_lease_failures_total",
+			Help: "Total number of failures to acquire or renew a rule group notification lease in the KV store. The notifications are sent anyway.",
+		}),
+		now: time.Now,
+	}, nil
+}
+
+// NotifyFunc wraps the notify function of the rules manager of a tenant, only sending the
+// notifications of the rule groups whose lease is held by this replica, if the deduplication
+// is enabled for the tenant.
+func (d *NotificationDeduplicator) NotifyFunc(userID string, limits RulesLimits, next promRules.NotifyFunc) promRules.NotifyFunc {
+	return func(ctx context.Context, expr string, alerts ...*promRules.Alert) {
+		if !limits.RulerNotificationDeduplication(userID) {
+			next(ctx, expr, alerts...)
+			return
+		}
+
+		groupFile, groupName, ok := ruleGroupFromContext(ctx)
+		if !ok {
+			next(ctx, expr, alerts...)
+			return
+		}
+
+		// The lease is renewed even if there are no alerts to send, so that it's kept while the
+		// replica evaluates the rule group.
+		if !d.holdsLease(ctx, userID, notificationLeaseGroup(groupFile, groupName)) {
+			d.deduplicated.Add(float64(len(alerts)))
+			return
+		}
+		next(ctx, expr, alerts...)
+	}
+}
+
+// holdsLease returns whether this replica holds the lease of the rule group, acquiring or renewing
+// the leases of the tenant in the KV store if needed. The KV store is only hit when the lease known
+// by this replica expires in less than half of its duration: the holder renews it, while the other
+// replicas check whether it has been renewed, or released by its holder.
+func (d *NotificationDeduplicator) holdsLease(ctx context.Context, userID, group string) bool {
+	now := d.now().UnixMilli()
+
+	d.mtx.Lock()
+	tenant, ok := d.tenants[userID]
+	if !ok {
+		tenant = &tenantNotificationLeases{leases: map[string]notificationLease{}}
+		d.tenants[userID] = tenant
+	}
+	// A rule group evaluated for the first time has no lease yet, and is acquired on the next update.
+	known := tenant.leases[group]
+	tenant.leases[group] = known
+	d.mtx.Unlock()
+
+	if !d.needsUpdate(known, now) {
+		return known.Replica == d.replica
+	}
+
+	tenant.kvMtx.Lock()
+	defer tenant.kvMtx.Unlock()
+
+	// The leases may have been updated for another rule group of the tenant in the meanwhile.
+	d.mtx.Lock()
+	known = tenant.leases[group]
+	d.mtx.Unlock()
+	if !d.needsUpdate(known, now) {
+		return known.Replica == d.replica
+	}
+
+	if err := d.updateLeases(ctx, userID, tenant, now); err != nil {
+		// Sending duplicated notifications is better than not sending them.
+		d.leaseKVFailures.Inc()
+		level.Warn(d.logger).Log("msg", "failed to acquire the rule group notification lease, sending the notifications anyway", "user", userID, "group", group, "err", err)
+		return true
+	}
+
+	d.mtx.Lock()
+	known = tenant.leases[group]
+	d.mtx.Unlock()
+	return known.Replica == d.replica
+}
+
+// needsUpdate returns whether the lease known by this replica must be renewed or checked again.
+func (d *NotificationDeduplicator) needsUpdate(known notificationLease, now int64) bool {
+	return now >= known.ExpiresAt-d.cfg.LeaseDuration.Milliseconds()/2
+}
+
+// updateLeases acquires or renews the leases of all the rule groups of the tenant evaluated by
+// this replica, with a single KV store update. The expired leases of the rule groups not evaluated
+// by any replica anymore are removed. Must be called with the tenant KV store mutex held.
+func (d *NotificationDeduplicator) updateLeases(ctx context.Context, userID string, tenant *tenantNotificationLeases, now int64) error {
+	d.mtx.Lock()
+	groups := make([]string, 0, len(tenant.leases))
+	for group := range tenant.leases {
+		groups = append(groups, group)
+	}
+	d.mtx.Unlock()
+
+	var (
+		leases    map[string]notificationLease
+		takeovers int
+	)
+	err := d.kv.CAS(ctx, userID, func(in interface{}) (interface{}, bool, error) {
+		current, _ := in.(*notificationLeases)
+		if current == nil {
+			current = &notificationLeases{}
+		}
+
+		changed := false
+		updated := &notificationLeases{Leases: make(map[string]notificationLease, len(current.Leases)+len(groups))}
+		for group, lease := range current.Leases {
+			if now < lease.ExpiresAt {
+				updated.Leases[group] = lease
+			} else {
+				changed = true
+			}
+		}
+
+		takeovers = 0
+		for _, group := range groups {
+			if lease, ok := updated.Leases[group]; ok && lease.Replica != d.replica {
+				continue
+			}
+			if previous, ok := current.Leases[group]; !ok || previous.Replica != d.replica {
+				takeovers++
+			}
+			updated.Leases[group] = notificationLease{Replica: d.replica, ExpiresAt: now + d.cfg.LeaseDuration.Milliseconds()}
+			changed = true
+		}
+
+		leases = updated.Leases
+		// The KV store isn't written if all the leases are held by other replicas.
+		if !changed {
+			return nil, false, nil
+		}
+		return updated, true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.leaseTakeovers.Add(float64(takeovers))
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, group := range groups {
+		if _, ok := tenant.leases[group]; ok {
+			tenant.leases[group] = leases[group]
+		}
+	}
+	return nil
+}
+
+// releaseLeases releases the leases held by this replica of the rule groups of the tenant not in
+// the keep set, because this replica stopped evaluating them, so that the replica evaluating them
+// next takes over without waiting for the leases to expire. The KV store key of the tenant is
+// deleted once it has no leases anymore.
+func (d *NotificationDeduplicator) releaseLeases(userID string, keep map[string]struct{}) {
+	d.mtx.Lock()
+	tenant, ok := d.tenants[userID]
+	d.mtx.Unlock()
+	if !ok {
+		return
+	}
+
+	tenant.kvMtx.Lock()
+	defer tenant.kvMtx.Unlock()
+
+	released := map[string]struct{}{}
+	d.mtx.Lock()
+	for group := range tenant.leases {
+		if _, ok := keep[group]; !ok {
+			released[group] = struct{}{}
+			delete(tenant.leases, group)
+		}
+	}
+	if len(tenant.leases) == 0 && d.tenants[userID] == tenant {
+		delete(d.tenants, userID)
+	}
+	d.mtx.Unlock()
+
+	if len(released) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.LeaseDuration)
+	defer cancel()
+
+	empty := false
+	err := d.kv.CAS(ctx, userID, func(in interface{}) (interface{}, bool, error) {
+		current, _ := in.(*notificationLeases)
+		if current == nil {
+			return nil, false, nil
+		}
+
+		updated := &notificationLeases{Leases: make(map[string]notificationLease, len(current.Leases))}
+		for group, lease := range current.Leases {
+			if _, ok := released[group]; !ok || lease.Replica != d.replica {
+				updated.Leases[group] = lease
+			}
+		}
+		empty = len(updated.Leases) == 0
+		return updated, true, nil
+	})
+	if err == nil && empty {
+		err = d.kv.Delete(ctx, userID)
+	}
+	if err != nil {
+		level.Warn(d.logger).Log("msg", "failed to release the rule group notification leases, they will be taken over once expired", "user", userID, "err", err)
+	}
+}
+
+// notificationLeasesRulesManager is a RulesManager releasing the notification leases of the rule
+// groups it stops evaluating, for example because they are moved to another ruler.
+type notificationLeasesRulesManager struct {
+	RulesManager
+
+	userID string
+	dedup  *NotificationDeduplicator
+}
+
+func newNotificationLeasesRulesManager(manager RulesManager, userID string, dedup *NotificationDeduplicator) *notificationLeasesRulesManager {
+	return &notificationLeasesRulesManager{
+		RulesManager: manager,
+		userID:       userID,
+		dedup:        dedup,
+	}
+}
+
+// Update implements RulesManager.
+func (m *notificationLeasesRulesManager) Update(interval time.Duration, files []string, externalLabels labels.Labels, externalURL string, ruleGroupPostProcessFunc promRules.GroupEvalIterationFunc) error {
+	err := m.RulesManager.Update(interval, files, externalLabels, externalURL, ruleGroupPostProcessFunc)
+
+	keep := map[string]struct{}{}
+	for _, g := range m.RuleGroups() {
+		keep[notificationLeaseGroup(g.File(), g.Name())] = struct{}{}
+	}
+	m.dedup.releaseLeases(m.userID, keep)
+	return err
+}
+
+// Stop implements RulesManager.
+func (m *notificationLeasesRulesManager) Stop() {
+	m.RulesManager.Stop()
+	m.dedup.releaseLeases(m.userID, nil)
+}
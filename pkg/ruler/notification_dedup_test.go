@@ -0,0 +1,293 @@
+package ruler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+)
+
+func TestNotificationDedupConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		cfg      NotificationDedupConfig
+		expected error
+	}{
+		"disabled": {
+			cfg: NotificationDedupConfig{KVStore: kv.Config{Store: "memberlist"}},
+		},
+		"supported KV store": {
+			cfg: NotificationDedupConfig{Enabled: true, KVStore: kv.Config{Store: "consul"}, LeaseDuration: time.Minute},
+		},
+		"unsupported KV store": {
+			cfg:      NotificationDedupConfig{Enabled: true, KVStore: kv.Config{Store: "memberlist"}, LeaseDuration: time.Minute},
+			expected: errInvalidNotificationDedupKVStore,
+		},
+		"no lease duration": {
+			cfg:      NotificationDedupConfig{Enabled: true, KVStore: kv.Config{Store: "consul"}},
+			expected: errInvalidNotificationDedupLeaseDuration,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.cfg.Validate())
+		})
+	}
+}
+
+// testNotifier counts the alerts notified by a ruler replica.
+type testNotifier struct {
+	mtx    sync.Mutex
+	alerts int
+}
+
+func (n *testNotifier) notify(_ context.Context, _ string, alerts ...*promRules.Alert) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.alerts += len(alerts)
+}
+
+func (n *testNotifier) count() int {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.alerts
+}
+
+func newTestNotificationDeduplicators(t *testing.T, leaseDuration time.Duration, replicas ...string) ([]*NotificationDeduplicator, []*prometheus.Registry) {
+	kvClient, closer := consul.NewInMemoryClient(notificationLeaseCodec{}, log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	var (
+		dedups []*NotificationDeduplicator
+		regs   []*prometheus.Registry
+	)
+	for _, replica := range replicas {
+		cfg := NotificationDedupConfig{Enabled: true, LeaseDuration: leaseDuration}
+		cfg.KVStore.Mock = kvClient
+
+		reg := prometheus.NewPedanticRegistry()
+		d, err := NewNotificationDeduplicator(cfg, replica, log.NewNopLogger(), reg)
+		require.NoError(t, err)
+		dedups = append(dedups, d)
+		regs = append(regs, reg)
+	}
+	return dedups, regs
+}
+
+func TestNotificationDeduplicator_ShouldNotifyFromASingleReplicaWhileTheyOverlap(t *testing.T) {
+	dedups, regs := newTestNotificationDeduplicators(t, time.Minute, "ruler-1", "ruler-2")
+	now := time.Unix(1000, 0)
+	for _, d := range dedups {
+		d.now = func() time.Time { return now }
+	}
+
+	limits := ruleLimits{notificationDedup: true}
+	notifiers := []*testNotifier{{}, {}}
+	notifyFuncs := []promRules.NotifyFunc{
+		dedups[0].NotifyFunc("user-1", limits, notifiers[0].notify),
+		dedups[1].NotifyFunc("user-1", limits, notifiers[1].notify),
+	}
+
+	ctx := ruleGroupContext(context.Background(), "namespace", "group")
+	alert := &promRules.Alert{}
+
+	// Both replicas evaluate the rule group concurrently: only one of them notifies.
+	evaluate := func(replicas ...int) {
+		wg := sync.WaitGroup{}
+		for _, r := range replicas {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				notifyFuncs[r](ctx, "up == 0", alert)
+			}(r)
+		}
+		wg.Wait()
+	}
+
+	evaluate(0, 1)
+	require.Equal(t, 1, notifiers[0].count()+notifiers[1].count())
+	owner, other := 0, 1
+	if notifiers[1].count() == 1 {
+		owner, other = 1, 0
+	}
+
+	// The owner keeps notifying, renewing the lease, while the other replica overlaps.
+	for i := 0; i < 4; i++ {
+		now = now.Add(20 * time.Second)
+		evaluate(0, 1)
+	}
+	assert.Equal(t, 5, notifiers[owner].count())
+	assert.Equal(t, 0, notifiers[other].count())
+
+	assert.NoError(t, testutil.GatherAndCompare(regs[other], strings.NewReader(`
+		# HELP cortex_ruler_notifications_deduplicated_total Total number of alert notifications not sent because another ruler replica holds the lease of the rule group.
+		# TYPE cortex_ruler_notifications_deduplicated_total counter
+		cortex_ruler_notifications_deduplicated_total 5
+	`), "cortex_ruler_notifications_deduplicated_total"))
+
+	// The owner stops evaluating the rule group, for example because it's failing over: the other
+	// replica takes over once the lease expired.
+	now = now.Add(30 * time.Second)
+	evaluate(other)
+	assert.Equal(t, 0, notifiers[other].count())
+
+	now = now.Add(31 * time.Second)
+	evaluate(other)
+	assert.Equal(t, 1, notifiers[other].count())
+
+	// The previous owner comes back while the new owner still evaluates the rule group.
+	now = now.Add(20 * time.Second)
+	evaluate(0, 1)
+	assert.Equal(t, 5, notifiers[owner].count())
+	assert.Equal(t, 2, notifiers[other].count())
+}
+
+func TestNotificationDeduplicator_ShouldDeduplicateEachRuleGroupSeparately(t *testing.T) {
+	dedups, _ := newTestNotificationDeduplicators(t, time.Minute, "ruler-1", "ruler-2")
+	limits := ruleLimits{notificationDedup: true}
+	notifiers := []*testNotifier{{}, {}}
+
+	dedups[0].NotifyFunc("user-1", limits, notifiers[0].notify)(ruleGroupContext(context.Background(), "namespace", "group-1"), "up == 0", &promRules.Alert{})
+	dedups[1].NotifyFunc("user-1", limits, notifiers[1].notify)(ruleGroupContext(context.Background(), "namespace", "group-2"), "up == 0", &promRules.Alert{})
+	dedups[1].NotifyFunc("user-2", limits, notifiers[1].notify)(ruleGroupContext(context.Background(), "namespace", "group-1"), "up == 0", &promRules.Alert{})
+
+	assert.Equal(t, 1, notifiers[0].count())
+	assert.Equal(t, 2, notifiers[1].count())
+}
+
+func TestNotificationDeduplicator_ShouldNotDeduplicateIfDisabledForTheTenant(t *testing.T) {
+	dedups, _ := newTestNotificationDeduplicators(t, time.Minute, "ruler-1", "ruler-2")
+	notifiers := []*testNotifier{{}, {}}
+
+	ctx := ruleGroupContext(context.Background(), "namespace", "group")
+	for i, d := range dedups {
+		d.NotifyFunc("user-1", ruleLimits{}, notifiers[i].notify)(ctx, "up == 0", &promRules.Alert{})
+	}
+
+	assert.Equal(t, 1, notifiers[0].count())
+	assert.Equal(t, 1, notifiers[1].count())
+}
+
+func TestNotificationDeduplicator_ShouldRenewTheLeasesOfATenantTogether(t *testing.T) {
+	dedups, _ := newTestNotificationDeduplicators(t, time.Minute, "ruler-1", "ruler-2")
+	now := time.Unix(1000, 0)
+	for _, d := range dedups {
+		d.now = func() time.Time { return now }
+	}
+
+	limits := ruleLimits{notificationDedup: true}
+	notify := dedups[0].NotifyFunc("user-1", limits, (&testNotifier{}).notify)
+	notify(ruleGroupContext(context.Background(), "namespace", "group-1"), "up == 0")
+	now = now.Add(10 * time.Second)
+	notify(ruleGroupContext(context.Background(), "namespace", "group-2"), "up == 0")
+
+	// The renewal of the lease of a rule group renews the leases of all the rule groups of the tenant.
+	now = now.Add(35 * time.Second)
+	notify(ruleGroupContext(context.Background(), "namespace", "group-1"), "up == 0")
+
+	leases := getNotificationLeases(t, dedups[0], "user-1")
+	expected := notificationLease{Replica: "ruler-1", ExpiresAt: now.Add(time.Minute).UnixMilli()}
+	assert.Equal(t, map[string]notificationLease{"namespace/group-1": expected, "namespace/group-2": expected}, leases.Leases)
+
+	// The expired leases of the rule groups not evaluated anymore are cleaned up.
+	now = now.Add(2 * time.Minute)
+	dedups[1].NotifyFunc("user-1", limits, (&testNotifier{}).notify)(ruleGroupContext(context.Background(), "namespace", "group-3"), "up == 0")
+
+	leases = getNotificationLeases(t, dedups[1], "user-1")
+	assert.Equal(t, map[string]notificationLease{"namespace/group-3": {Replica: "ruler-2", ExpiresAt: now.Add(time.Minute).UnixMilli()}}, leases.Leases)
+}
+
+func TestNotificationDeduplicator_ShouldReleaseTheLeasesOfTheRuleGroupsNotEvaluatedAnymore(t *testing.T) {
+	dedups, _ := newTestNotificationDeduplicators(t, time.Minute, "ruler-1", "ruler-2", "ruler-3")
+	now := time.Unix(1000, 0)
+	for _, d := range dedups {
+		d.now = func() time.Time { return now }
+	}
+
+	limits := ruleLimits{notificationDedup: true}
+	notifiers := []*testNotifier{{}, {}, {}}
+
+	for _, group := range []string{"group-1", "group-2"} {
+		dedups[0].NotifyFunc("user-1", limits, notifiers[0].notify)(ruleGroupContext(context.Background(), "namespace", group), "up == 0", &promRules.Alert{})
+		dedups[1].NotifyFunc("user-1", limits, notifiers[1].notify)(ruleGroupContext(context.Background(), "namespace", group), "up == 0", &promRules.Alert{})
+	}
+	assert.Equal(t, 2, notifiers[0].count())
+	assert.Equal(t, 0, notifiers[1].count())
+
+	// The first replica stops evaluating the first rule group, which is taken over by the second
+	// replica as soon as it checks the lease again, before the lease expires. A replica evaluating
+	// the rule group for the first time takes it over immediately.
+	dedups[0].releaseLeases("user-1", map[string]struct{}{"namespace/group-2": {}})
+	now = now.Add(30 * time.Second)
+	for _, group := range []string{"group-1", "group-2"} {
+		dedups[1].NotifyFunc("user-1", limits, notifiers[1].notify)(ruleGroupContext(context.Background(), "namespace", group), "up == 0", &promRules.Alert{})
+	}
+	assert.Equal(t, 1, notifiers[1].count())
+
+	dedups[1].releaseLeases("user-1", map[string]struct{}{"namespace/group-2": {}})
+	dedups[2].NotifyFunc("user-1", limits, notifiers[2].notify)(ruleGroupContext(context.Background(), "namespace", "group-1"), "up == 0", &promRules.Alert{})
+	assert.Equal(t, 1, notifiers[2].count())
+
+	// The KV store key of the tenant is deleted once all the leases are released.
+	dedups[0].releaseLeases("user-1", nil)
+	dedups[1].releaseLeases("user-1", nil)
+	dedups[2].releaseLeases("user-1", nil)
+	value, err := dedups[0].kv.Get(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Nil(t, value)
+	for _, d := range dedups {
+		assert.Empty(t, d.tenants)
+	}
+}
+
+func getNotificationLeases(t *testing.T, d *NotificationDeduplicator, userID string) *notificationLeases {
+	value, err := d.kv.Get(context.Background(), userID)
+	require.NoError(t, err)
+	require.IsType(t, &notificationLeases{}, value)
+	return value.(*notificationLeases)
+}
+
+func TestNotificationLeasesRulesManager_ShouldReleaseTheLeasesOfTheRemovedRuleGroups(t *testing.T) {
+	dedups, _ := newTestNotificationDeduplicators(t, time.Minute, "ruler-1")
+	limits := ruleLimits{notificationDedup: true}
+
+	newGroup := func(name string) *promRules.Group {
+		return promRules.NewGroup(promRules.GroupOptions{Name: name, File: "namespace", Interval: time.Minute, Opts: &promRules.ManagerOptions{}})
+	}
+	manager := newNotificationLeasesRulesManager(&mockRulesManager{
+		done:           make(chan struct{}),
+		groupsToReturn: [][]*promRules.Group{{newGroup("group-1"), newGroup("group-2")}, {newGroup("group-2")}},
+		waitDurations:  []time.Duration{time.Millisecond, time.Millisecond},
+		iteration:      -1,
+	}, "user-1", dedups[0])
+
+	require.NoError(t, manager.Update(time.Minute, nil, labels.EmptyLabels(), "", nil))
+	for _, group := range []string{"group-1", "group-2"} {
+		dedups[0].NotifyFunc("user-1", limits, (&testNotifier{}).notify)(ruleGroupContext(context.Background(), "namespace", group), "up == 0")
+	}
+	assert.Len(t, getNotificationLeases(t, dedups[0], "user-1").Leases, 2)
+
+	// The lease of the rule group removed from the manager is released.
+	require.NoError(t, manager.Update(time.Minute, nil, labels.EmptyLabels(), "", nil))
+	leases := getNotificationLeases(t, dedups[0], "user-1").Leases
+	assert.Len(t, leases, 1)
+	assert.Contains(t, leases, "namespace/group-2")
+
+	// All the leases are released when the manager is stopped.
+	manager.Stop()
+	value, err := dedups[0].kv.Get(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Nil(t, value)
+}
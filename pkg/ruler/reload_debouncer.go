@@ -0,0 +1,149 @@
+package ruler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+// reloadDebouncer delays the reload of the changed rule groups of a tenant until they have not
+// changed for the tenant's quiet period, so that rapid successive updates of the rule groups coalesce
+// into a single reload. Until then, the rule groups previously applied keep being evaluated. Only the
+// changes to the content of the rule groups are delayed: the rule groups newly owned by the ruler, for
+// example after a ruler failure, are loaded straight away, and the ones not owned anymore are unloaded
+// straight away.
+type reloadDebouncer struct {
+	limits RulesLimits
+	now    func() time.Time
+
+	mtx     sync.Mutex
+	tenants map[string]map[debouncedGroupKey]*debouncedGroup
+
+	// reloads is notified when the quiet period of a pending change has elapsed.
+	reloads chan struct{}
+
+	coalescedReloads *prometheus.CounterVec
+}
+
+type debouncedGroupKey struct {
+	namespace string
+	name      string
+}
+
+type debouncedGroup struct {
+	// Rule group applied to the manager.
+	applied *rulespb.RuleGroupDesc
+
+	// Latest rule group waiting for the quiet period to elapse, if any.
+	pending      *rulespb.RuleGroupDesc
+	pendingSince time.Time
+	pendingTimer *time.Timer
+}
+
+func newReloadDebouncer(limits RulesLimits, reg prometheus.Registerer) *reloadDebouncer {
+	return &reloadDebouncer{
+		limits:  limits,
+		now:     time.Now,
+		tenants: map[string]map[debouncedGroupKey]*debouncedGroup{},
+		reloads: make(chan struct{}, 1),
+		coalescedReloads: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ruler_coalesced_reloads_total",
+			Help: "Total number of rule groups reloads coalesced with a later change of the rule groups, because the rule groups changed again within the quiet period.",
+		}, []string{"user"}),
+	}
+}
+
+// debounce returns the rule groups to apply for each tenant, replacing the rule groups changed
+// within the quiet period with the rule groups previously applied.
+func (d *reloadDebouncer) debounce(configs map[string]rulespb.RuleGroupList) map[string]rulespb.RuleGroupList {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := d.now()
+	debounced := make(map[string]rulespb.RuleGroupList, len(configs))
+
+	for userID, groups := range configs {
+		tenant, ok := d.tenants[userID]
+		if !ok {
+			tenant = map[debouncedGroupKey]*debouncedGroup{}
+			d.tenants[userID] = tenant
+		}
+		quietPeriod := d.limits.RulerReloadQuietPeriod(userID)
+
+		owned := make(map[debouncedGroupKey]struct{}, len(groups))
+		applied := make(rulespb.RuleGroupList, 0, len(groups))
+
+		for _, group := range groups {
+			key := debouncedGroupKey{namespace: group.Namespace, name: group.Name}
+			owned[key] = struct{}{}
+
+			g, ok := tenant[key]
+			switch {
+			case !ok:
+				// The rule groups newly owned are loaded straight away.
+				g = &debouncedGroup{applied: group}
+				tenant[key] = g
+			case quietPeriod <= 0 || group.Equal(g.applied):
+				g.apply(group)
+			case g.pending != nil && group.Equal(g.pending):
+				if now.Sub(g.pendingSince) >= quietPeriod {
+					g.apply(group)
+				}
+			default:
+				if g.pending != nil {
+					d.coalescedReloads.WithLabelValues(userID).Inc()
+					g.pendingTimer.Stop()
+				}
+				g.pending = group
+				g.pendingSince = now
+				g.pendingTimer = time.AfterFunc(quietPeriod, d.notifyReload)
+			}
+
+			applied = append(applied, g.applied)
+		}
+
+		// Forget the rule groups not owned anymore, which are unloaded straight away.
+		for key, g := range tenant {
+			if _, ok := owned[key]; !ok {
+				g.apply(nil)
+				delete(tenant, key)
+			}
+		}
+
+		debounced[userID] = applied
+	}
+
+	// Forget the tenants not owned anymore.
+	for userID, tenant := range d.tenants {
+		if _, ok := configs[userID]; !ok {
+			for _, g := range tenant {
+				g.apply(nil)
+			}
+			delete(d.tenants, userID)
+			d.coalescedReloads.DeleteLabelValues(userID)
+		}
+	}
+
+	return debounced
+}
+
+func (d *reloadDebouncer) notifyReload() {
+	select {
+	case d.reloads <- struct{}{}:
+	default:
+	}
+}
+
+// apply sets the rule group applied, discarding the pending change, if any.
+func (g *debouncedGroup) apply(group *rulespb.RuleGroupDesc) {
+	if g.pendingTimer != nil {
+		g.pendingTimer.Stop()
+	}
+	g.applied = group
+	g.pending = nil
+	g.pendingTimer = nil
+}
@@ -0,0 +1,95 @@
+package ruler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+func TestReloadDebouncer(t *testing.T) {
+	const quietPeriod = time.Minute
+
+	groupsV1 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Rules: []*rulespb.RuleDesc{{Record: "v1", Expr: "up"}}}}
+	groupsV2 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Rules: []*rulespb.RuleDesc{{Record: "v2", Expr: "up"}}}}
+	groupsV3 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Rules: []*rulespb.RuleDesc{{Record: "v3", Expr: "up"}}}}
+
+	now := time.Now()
+	d := newReloadDebouncer(ruleLimits{reloadQuietPeriod: quietPeriod}, prometheus.NewPedanticRegistry())
+	d.now = func() time.Time { return now }
+
+	// The rule groups of a new tenant are loaded straight away.
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV1}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV1}))
+
+	// The changes are delayed until the rule groups haven't changed for the quiet period.
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV1}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV2}))
+	now = now.Add(quietPeriod / 2)
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV1}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV3}))
+	now = now.Add(quietPeriod / 2)
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV1}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV3}))
+	now = now.Add(quietPeriod / 2)
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV3}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV3}))
+	assert.Equal(t, float64(1), testutil.ToFloat64(d.coalescedReloads.WithLabelValues("user-1")))
+
+	// A change reverted within the quiet period doesn't trigger any reload.
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV3}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV1}))
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV3}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV3}))
+	now = now.Add(quietPeriod)
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV3}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV3}))
+
+	// The tenants not owned anymore are forgotten, so their rule groups are loaded straight away once owned again.
+	assert.Empty(t, d.debounce(map[string]rulespb.RuleGroupList{}))
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV2}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV2}))
+}
+
+func TestReloadDebouncer_ShouldReloadStraightAwayWithoutQuietPeriod(t *testing.T) {
+	groupsV1 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Interval: time.Minute}}
+	groupsV2 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Interval: time.Hour}}
+
+	d := newReloadDebouncer(ruleLimits{}, nil)
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV1}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV1}))
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV2}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV2}))
+}
+
+func TestReloadDebouncer_ShouldNotifyReloadOnceTheQuietPeriodHasElapsed(t *testing.T) {
+	const quietPeriod = 100 * time.Millisecond
+
+	groupsV1 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Interval: time.Minute}}
+	groupsV2 := rulespb.RuleGroupList{{Name: "group", Namespace: "ns", User: "user-1", Interval: time.Hour}}
+
+	d := newReloadDebouncer(ruleLimits{reloadQuietPeriod: quietPeriod}, nil)
+	d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV1})
+	start := time.Now()
+	d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV2})
+
+	select {
+	case <-d.reloads:
+		require.GreaterOrEqual(t, time.Since(start), quietPeriod)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the reload has not been notified")
+	}
+
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": groupsV2}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": groupsV2}))
+}
+
+func TestReloadDebouncer_ShouldApplyTheOwnershipChangesStraightAway(t *testing.T) {
+	const quietPeriod = time.Minute
+
+	group1V1 := &rulespb.RuleGroupDesc{Name: "group-1", Namespace: "ns", User: "user-1", Rules: []*rulespb.RuleDesc{{Record: "v1", Expr: "up"}}}
+	group1V2 := &rulespb.RuleGroupDesc{Name: "group-1", Namespace: "ns", User: "user-1", Rules: []*rulespb.RuleDesc{{Record: "v2", Expr: "up"}}}
+	group2 := &rulespb.RuleGroupDesc{Name: "group-2", Namespace: "ns", User: "user-1", Rules: []*rulespb.RuleDesc{{Record: "v1", Expr: "up"}}}
+
+	d := newReloadDebouncer(ruleLimits{reloadQuietPeriod: quietPeriod}, nil)
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": {group1V1}}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": {group1V1}}))
+
+	// A rule group newly owned by the ruler is loaded straight away, while the change of the other one is delayed.
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": {group1V1, group2}}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": {group1V2, group2}}))
+
+	// A rule group not owned anymore by the ruler is unloaded straight away.
+	assert.Equal(t, map[string]rulespb.RuleGroupList{"user-1": {group1V1}}, d.debounce(map[string]rulespb.RuleGroupList{"user-1": {group1V2}}))
+}
@@ -0,0 +1,238 @@
+package ruler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// ruleEvaluationStalePeriod is the period after which a rule not evaluated anymore, like a rule
+// deleted from its rule group, is no longer tracked.
+const ruleEvaluationStalePeriod = 24 * time.Hour
+
+// RuleEvaluationStats holds the evaluations stats of a rule. The rules with the same name in
+// the same rule group are tracked together.
+type RuleEvaluationStats struct {
+	User      string `json:"user"`
+	Namespace string `json:"namespace"`
+	Group     string `json:"group"`
+	Rule      string `json:"rule"`
+	Kind      string `json:"kind"`
+
+	Evaluations         int64     `json:"evaluations"`
+	Failures            int64     `json:"failures"`
+	AvgDurationSeconds  float64   `json:"avg_duration_seconds"`
+	LastDurationSeconds float64   `json:"last_duration_seconds"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastEvaluation      time.Time `json:"last_evaluation"`
+
+	totalDuration time.Duration
+}
+
+type ruleEvaluationKey struct {
+	user, namespace, group, rule string
+}
+
+// RuleEvaluationsResponse is the response of the rule evaluations endpoint.
+type RuleEvaluationsResponse struct {
+	Slowest []RuleEvaluationStats `json:"slowest"`
+	Failing []RuleEvaluationStats `json:"failing"`
+}
+
+// RuleEvaluationTracker tracks the duration and failures of the evaluations of each rule, and
+// exposes the top N slowest and most failing rules, across all tenants, so that the problem
+// rules can be identified without exposing a metric per rule.
+type RuleEvaluationTracker struct {
+	topN     int
+	rulePath string
+	now      func() time.Time
+
+	mtx   sync.Mutex
+	rules map[ruleEvaluationKey]*RuleEvaluationStats
+
+	slowestDesc *prometheus.Desc
+	failingDesc *prometheus.Desc
+}
+
+// NewRuleEvaluationTracker makes a new RuleEvaluationTracker tracking the top N rules. The rule
+// path is the directory where the ruler maps the rule groups, see -ruler.rule-path.
+func NewRuleEvaluationTracker(topN int, rulePath string, reg prometheus.Registerer) *RuleEvaluationTracker {
+	labels := []string{"user", "namespace", "rule_group", "rule"}
+
+	t := &RuleEvaluationTracker{
+		topN:     topN,
+		rulePath: rulePath,
+		now:      time.Now,
+		rules:    map[ruleEvaluationKey]*RuleEvaluationStats{},
+		slowestDesc: prometheus.NewDesc(
+			"cortex_ruler_top_slowest_rule_evaluation_duration_seconds",
+			"Average evaluation duration of the slowest rules, across all tenants.",
+			labels, nil),
+		failingDesc: prometheus.NewDesc(
+			"cortex_ruler_top_failing_rule_evaluation_failures",
+			"Number of failed evaluations of the most failing rules, across all tenants.",
+			labels, nil),
+	}
+
+	if reg != nil {
+		reg.MustRegister(t)
+	}
+	return t
+}
+
+// QueryFunc wraps the query function of the rules of the user, tracking the rules evaluations.
+func (t *RuleEvaluationTracker) QueryFunc(userID string, qf rules.QueryFunc) rules.QueryFunc {
+	if t == nil {
+		return qf
+	}
+
+	return func(ctx context.Context, qs string, ts time.Time) (promql.Vector, error) {
+		start := t.now()
+		result, err := qf(ctx, qs, ts)
+		t.observe(ctx, userID, t.now().Sub(start), err)
+		return result, err
+	}
+}
+
+func (t *RuleEvaluationTracker) observe(ctx context.Context, userID string, d time.Duration, err error) {
+	ruleDetail := rules.FromOriginContext(ctx)
+	key := ruleEvaluationKey{user: userID, rule: ruleDetail.Name}
+	if origin, ok := ctx.Value(promql.QueryOrigin{}).(map[string]interface{}); ok {
+		if rg, ok := origin["ruleGroup"].(map[string]string); ok {
+			key.namespace, key.group = t.namespace(userID, rg["file"]), rg["name"]
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	s, ok := t.rules[key]
+	if !ok {
+		s = &RuleEvaluationStats{User: key.user, Namespace: key.namespace, Group: key.group, Rule: key.rule, Kind: ruleDetail.Kind}
+		t.rules[key] = s
+	}
+
+	s.Evaluations++
+	s.totalDuration += d
+	s.AvgDurationSeconds = (s.totalDuration / time.Duration(s.Evaluations)).Seconds()
+	s.LastDurationSeconds = d.Seconds()
+	s.LastEvaluation = t.now()
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+	}
+}
+
+// namespace returns the namespace of the rule group file, which is the url path escaped namespace
+// in the rule path directory of the user, see mapper.
+func (t *RuleEvaluationTracker) namespace(userID, file string) string {
+	namespace := strings.TrimPrefix(file, filepath.Join(t.rulePath, userID)+"/")
+	if decoded, err := url.PathUnescape(namespace); err == nil {
+		return decoded
+	}
+	return namespace
+}
+
+// deleteUser stops tracking the rules of the user.
+func (t *RuleEvaluationTracker) deleteUser(userID string) {
+	if t == nil {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for key := range t.rules {
+		if key.user == userID {
+			delete(t.rules, key)
+		}
+	}
+}
+
+// Top returns the top N slowest rules, by average evaluation duration, and the top N most
+// failing rules, by number of failed evaluations.
+func (t *RuleEvaluationTracker) Top() RuleEvaluationsResponse {
+	t.mtx.Lock()
+	all := make([]RuleEvaluationStats, 0, len(t.rules))
+	for key, s := range t.rules {
+		if t.now().Sub(s.LastEvaluation) > ruleEvaluationStalePeriod {
+			delete(t.rules, key)
+			continue
+		}
+		all = append(all, *s)
+	}
+	t.mtx.Unlock()
+
+	slowest := make([]RuleEvaluationStats, len(all))
+	copy(slowest, all)
+	sort.Slice(slowest, func(i, j int) bool {
+		if slowest[i].AvgDurationSeconds != slowest[j].AvgDurationSeconds {
+			return slowest[i].AvgDurationSeconds > slowest[j].AvgDurationSeconds
+		}
+		return lessRuleEvaluationStats(slowest[i], slowest[j])
+	})
+
+	failing := make([]RuleEvaluationStats, 0, len(all))
+	for _, s := range all {
+		if s.Failures > 0 {
+			failing = append(failing, s)
+		}
+	}
+	sort.Slice(failing, func(i, j int) bool {
+		if failing[i].Failures != failing[j].Failures {
+			return failing[i].Failures > failing[j].Failures
+		}
+		return lessRuleEvaluationStats(failing[i], failing[j])
+	})
+
+	return RuleEvaluationsResponse{
+		Slowest: slowest[:min(len(slowest), t.topN)],
+		Failing: failing[:min(len(failing), t.topN)],
+	}
+}
+
+func lessRuleEvaluationStats(a, b RuleEvaluationStats) bool {
+	switch {
+	case a.User != b.User:
+		return a.User < b.User
+	case a.Namespace != b.Namespace:
+		return a.Namespace < b.Namespace
+	case a.Group != b.Group:
+		return a.Group < b.Group
+	default:
+		return a.Rule < b.Rule
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *RuleEvaluationTracker) Describe(out chan<- *prometheus.Desc) {
+	out <- t.slowestDesc
+	out <- t.failingDesc
+}
+
+// Collect implements prometheus.Collector.
+func (t *RuleEvaluationTracker) Collect(out chan<- prometheus.Metric) {
+	top := t.Top()
+	for _, s := range top.Slowest {
+		out <- prometheus.MustNewConstMetric(t.slowestDesc, prometheus.GaugeValue, s.AvgDurationSeconds, s.User, s.Namespace, s.Group, s.Rule)
+	}
+	for _, s := range top.Failing {
+		out <- prometheus.MustNewConstMetric(t.failingDesc, prometheus.GaugeValue, float64(s.Failures), s.User, s.Namespace, s.Group, s.Rule)
+	}
+}
+
+// ServeHTTP serves the top N slowest and most failing rules.
+func (t *RuleEvaluationTracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	util.WriteJSONResponse(w, t.Top())
+}
@@ -0,0 +1,129 @@
+package ruler
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleEvaluationTracker(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	tracker := NewRuleEvaluationTracker(2, "/rules", reg)
+
+	now := time.Unix(1000, 0)
+	tracker.now = func() time.Time { return now }
+
+	// Each evaluation takes the duration returned by the rule query, and fails if the rule is failing.
+	evaluate := func(userID, group, rule string, d time.Duration, failing bool) {
+		expr, err := parser.ParseExpr("up")
+		require.NoError(t, err)
+
+		ctx := promql.NewOriginContext(context.Background(), map[string]interface{}{
+			// The ruler maps the rule groups to the url path escaped namespace files in the rule path.
+			"ruleGroup": map[string]string{"file": "/rules/" + userID + "/" + url.PathEscape("team/namespace"), "name": group},
+		})
+		ctx = rules.NewOriginContext(ctx, rules.NewRuleDetail(rules.NewRecordingRule(rule, expr, labels.EmptyLabels())))
+
+		qf := tracker.QueryFunc(userID, func(context.Context, string, time.Time) (promql.Vector, error) {
+			now = now.Add(d)
+			if failing {
+				return nil, errors.New("query failed")
+			}
+			return nil, nil
+		})
+		_, _ = qf(ctx, "up", now)
+	}
+
+	evaluate("user-1", "group-1", "fast", time.Second, false)
+	evaluate("user-1", "group-1", "slow", 4*time.Second, true)
+	evaluate("user-1", "group-1", "slow", 2*time.Second, false)
+	evaluate("user-1", "group-2", "slowest", 5*time.Second, true)
+	evaluate("user-2", "group-1", "failing", time.Second, true)
+	evaluate("user-2", "group-1", "failing", time.Second, true)
+	evaluate("user-2", "group-1", "failing", time.Second, true)
+
+	top := tracker.Top()
+	require.Len(t, top.Slowest, 2)
+	assert.Equal(t, RuleEvaluationStats{
+		User:                "user-1",
+		Namespace:           "team/namespace",
+		Group:               "group-2",
+		Rule:                "slowest",
+		Kind:                rules.KindRecording,
+		Evaluations:         1,
+		Failures:            1,
+		AvgDurationSeconds:  5,
+		LastDurationSeconds: 5,
+		LastError:           "query failed",
+		LastEvaluation:      now.Add(-3 * time.Second),
+		totalDuration:       5 * time.Second,
+	}, top.Slowest[0])
+	assert.Equal(t, "slow", top.Slowest[1].Rule)
+	assert.Equal(t, float64(3), top.Slowest[1].AvgDurationSeconds)
+	assert.Equal(t, "query failed", top.Slowest[1].LastError)
+
+	require.Len(t, top.Failing, 2)
+	assert.Equal(t, "failing", top.Failing[0].Rule)
+	assert.Equal(t, int64(3), top.Failing[0].Failures)
+	assert.Equal(t, "slow", top.Failing[1].Rule)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_top_slowest_rule_evaluation_duration_seconds Average evaluation duration of the slowest rules, across all tenants.
+		# TYPE cortex_ruler_top_slowest_rule_evaluation_duration_seconds gauge
+		cortex_ruler_top_slowest_rule_evaluation_duration_seconds{namespace="team/namespace",rule="slowest",rule_group="group-2",user="user-1"} 5
+		cortex_ruler_top_slowest_rule_evaluation_duration_seconds{namespace="team/namespace",rule="slow",rule_group="group-1",user="user-1"} 3
+
+		# HELP cortex_ruler_top_failing_rule_evaluation_failures Number of failed evaluations of the most failing rules, across all tenants.
+		# TYPE cortex_ruler_top_failing_rule_evaluation_failures gauge
+		cortex_ruler_top_failing_rule_evaluation_failures{namespace="team/namespace",rule="failing",rule_group="group-1",user="user-2"} 3
+		cortex_ruler_top_failing_rule_evaluation_failures{namespace="team/namespace",rule="slow",rule_group="group-1",user="user-1"} 1
+	`)))
+
+	// The rules of a deleted user are no longer tracked.
+	tracker.deleteUser("user-1")
+	top = tracker.Top()
+	require.Len(t, top.Slowest, 1)
+	assert.Equal(t, "failing", top.Slowest[0].Rule)
+
+	// The rules not evaluated anymore are no longer tracked.
+	now = now.Add(ruleEvaluationStalePeriod + time.Second)
+	assert.Equal(t, RuleEvaluationsResponse{Slowest: []RuleEvaluationStats{}, Failing: []RuleEvaluationStats{}}, tracker.Top())
+}
+
+func TestRuleEvaluationTracker_ServeHTTP(t *testing.T) {
+	tracker := NewRuleEvaluationTracker(10, "/rules", nil)
+	tracker.now = func() time.Time { return time.Unix(1000, 0).UTC() }
+
+	ctx := promql.NewOriginContext(context.Background(), map[string]interface{}{
+		"ruleGroup": map[string]string{"file": "/rules/user-1/namespace", "name": "group"},
+	})
+	tracker.observe(ctx, "user-1", time.Second, errors.New("query failed"))
+
+	rec := httptest.NewRecorder()
+	tracker.ServeHTTP(rec, httptest.NewRequest("GET", "/ruler/rule_evaluations", nil))
+	assert.JSONEq(t, `{
+		"slowest": [{"user": "user-1", "namespace": "namespace", "group": "group", "rule": "", "kind": "", "evaluations": 1, "failures": 1, "avg_duration_seconds": 1, "last_duration_seconds": 1, "last_error": "query failed", "last_evaluation": "1970-01-01T00:16:40Z"}],
+		"failing": [{"user": "user-1", "namespace": "namespace", "group": "group", "rule": "", "kind": "", "evaluations": 1, "failures": 1, "avg_duration_seconds": 1, "last_duration_seconds": 1, "last_error": "query failed", "last_evaluation": "1970-01-01T00:16:40Z"}]
+	}`, rec.Body.String())
+}
+
+func TestRuleEvaluationTracker_ShouldPassThroughIfDisabled(t *testing.T) {
+	var tracker *RuleEvaluationTracker
+
+	qf := func(context.Context, string, time.Time) (promql.Vector, error) { return nil, nil }
+	assert.NotNil(t, tracker.QueryFunc("user-1", qf))
+	tracker.deleteUser("user-1")
+}
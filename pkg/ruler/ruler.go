@@ -63,6 +63,7 @@ const (
 	rulerSyncReasonInitial    = "initial"
 	rulerSyncReasonPeriodic   = "periodic"
 	rulerSyncReasonRingChange = "ring-change"
+	rulerSyncReasonReload     = "reload"
 
 	// Limit errors
 	errMaxRuleGroupsPerUserLimitExceeded        = "per-user rule groups limit (limit: %d actual: %d) exceeded"
@@ -119,6 +120,10 @@ type Config struct {
 	ForGracePeriod time.Duration `yaml:"for_grace_period"`
 	// Minimum amount of time to wait before resending an alert to Alertmanager.
 	ResendDelay time.Duration `yaml:"resend_delay"`
+	// Sharing of the alerts state across the ruler replicas.
+	AlertsState AlertsStateConfig `yaml:"alerts_state"`
+	// Deduplication of the alert notifications across the ruler replicas.
+	NotificationDedup NotificationDedupConfig `yaml:"notification_dedup"`
 
 	ConcurrentEvalsEnabled bool  `yaml:"concurrent_evals_enabled"`
 	MaxConcurrentEvals     int64 `yaml:"max_concurrent_evals"`
@@ -143,6 +148,9 @@ type Config struct {
 
 	EnableQueryStats      bool `yaml:"query_stats_enabled"`
 	DisableRuleGroupLabel bool `yaml:"disable_rule_group_label"`
+
+	// Number of slowest and most failing rules tracked.
+	RuleEvaluationTrackerTopN int `yaml:"rule_evaluation_tracker_top_n"`
 }
 
 // Validate config and returns error on failure
@@ -162,6 +170,14 @@ func (cfg *Config) Validate(limits validation.Limits, log log.Logger) error {
 	if cfg.ConcurrentEvalsEnabled && cfg.MaxConcurrentEvals <= 0 {
 		return errInvalidMaxConcurrentEvals
 	}
+
+	if err := cfg.AlertsState.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ruler alerts state config")
+	}
+
+	if err := cfg.NotificationDedup.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ruler notification deduplication config")
+	}
 	return nil
 }
 
@@ -170,6 +186,8 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.ClientTLSConfig.RegisterFlagsWithPrefix("ruler.client", f)
 	cfg.Ring.RegisterFlags(f)
 	cfg.Notifier.RegisterFlags(f)
+	cfg.AlertsState.RegisterFlags(f)
+	cfg.NotificationDedup.RegisterFlags(f)
 
 	// Deprecated Flags that will be maintained to avoid user disruption
 
@@ -211,6 +229,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 
 	f.BoolVar(&cfg.EnableQueryStats, "ruler.query-stats-enabled", false, "Report the wall time for ruler queries to complete as a per user metric and as an info level log message.")
 	f.BoolVar(&cfg.DisableRuleGroupLabel, "ruler.disable-rule-group-label", false, "Disable the rule_group label on exported metrics")
+	f.IntVar(&cfg.RuleEvaluationTrackerTopN, "ruler.rule-evaluation-tracker-top-n", 0, "[Experimental] Number of slowest and most failing rules, across all tenants, exposed by the cortex_ruler_top_* metrics and the /ruler/rule_evaluations endpoint. The rules are ranked by their average evaluation duration and their number of failed evaluations. 0 to disable.")
 
 	cfg.RingCheckPeriod = 5 * time.Second
 }
@@ -289,6 +308,14 @@ type Ruler struct {
 
 	allowedTenants *util.AllowedTenants
 
+	// Rule groups owned by this ruler which are not evaluated because the
+	// tenant doesn't have their feature flag, by user.
+	skippedRuleGroupsMtx sync.RWMutex
+	skippedRuleGroups    map[string]rulespb.RuleGroupList
+
+	// Debounces the reloads of the rule groups of the tenants updating them frequently.
+	reloadDebouncer *reloadDebouncer
+
 	registry prometheus.Registerer
 	logger   log.Logger
 }
@@ -333,6 +360,8 @@ func newRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer,
 			Name: "cortex_ruler_get_rules_failure_total",
 			Help: "The total number of failed rules request sent to rulers in getShardedRules.",
 		}, []string{"ruler"}),
+
+		reloadDebouncer: newReloadDebouncer(limits, reg),
 	}
 
 	if len(cfg.EnabledTenants) > 0 {
@@ -421,6 +450,17 @@ func (r *Ruler) stopping(_ error) error {
 	return nil
 }
 
+const (
+	// AlertGroupingHintAnnotation is the alerting rule annotation used to suggest how the rule
+	// alerts should be grouped by the Alertmanager. Its value is a comma-separated list of label names.
+	AlertGroupingHintAnnotation = "grouping_hint"
+
+	// AlertGroupingHintLabel is the label added to the alerts sent to the Alertmanager for the
+	// rules with the AlertGroupingHintAnnotation. Its value is made of the hinted labels of the
+	// alert, in the {name="value", ...} form, so Alertmanager routes can group by it.
+	AlertGroupingHintLabel = "alert_grouping_hint"
+)
+
 type sender interface {
 	Send(alerts ...*notifier.Alert)
 }
@@ -436,7 +476,7 @@ func SendAlerts(n sender, externalURL string) promRules.NotifyFunc {
 		for _, alert := range alerts {
 			a := &notifier.Alert{
 				StartsAt:     alert.FiredAt,
-				Labels:       alert.Labels,
+				Labels:       alertLabelsWithGroupingHint(alert.Labels, alert.Annotations),
 				Annotations:  alert.Annotations,
 				GeneratorURL: externalURL + strutil.TableLinkForExpression(expr),
 			}
@@ -454,6 +494,32 @@ func SendAlerts(n sender, externalURL string) promRules.NotifyFunc {
 	}
 }
 
+// alertLabelsWithGroupingHint returns the alert labels with the AlertGroupingHintLabel added,
+// if the alert has the AlertGroupingHintAnnotation.
+func alertLabelsWithGroupingHint(lbls, annotations labels.Labels) labels.Labels {
+	hint := annotations.Get(AlertGroupingHintAnnotation)
+	if hint == "" {
+		return lbls
+	}
+
+	hinted := labels.NewScratchBuilder(0)
+	seen := map[string]struct{}{}
+	for _, name := range strings.Split(hint, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		if value := lbls.Get(name); value != "" {
+			hinted.Add(name, value)
+		}
+	}
+	hinted.Sort()
+
+	return labels.NewBuilder(lbls).Set(AlertGroupingHintLabel, hinted.Labels().String()).Labels()
+}
+
 func ruleGroupDisabled(ruleGroup *rulespb.RuleGroupDesc, disabledRuleGroupsForUser validation.DisabledRuleGroups) bool {
 	for _, disabledRuleGroupForUser := range disabledRuleGroupsForUser {
 		if ruleGroup.Namespace == disabledRuleGroupForUser.Namespace &&
@@ -465,6 +531,46 @@ func ruleGroupDisabled(ruleGroup *rulespb.RuleGroupDesc, disabledRuleGroupsForUs
 	return false
 }
 
+// ruleGroupFeatureFlagEnabled returns whether the rule group has no feature flag or
+// its feature flag is one of the given ones.
+func ruleGroupFeatureFlagEnabled(ruleGroup *rulespb.RuleGroupDesc, featureFlags []string) bool {
+	if ruleGroup.FeatureFlag == "" {
+		return true
+	}
+	for _, featureFlag := range featureFlags {
+		if ruleGroup.FeatureFlag == featureFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRuleGroupsByFeatureFlags splits the input rule groups between the ones to evaluate and
+// the ones skipped because tagged with a feature flag the tenant doesn't have. Users whose
+// rule groups are all skipped are not included in the rule groups to evaluate.
+func filterRuleGroupsByFeatureFlags(ruleGroups map[string]rulespb.RuleGroupList, limits RulesLimits, logger log.Logger) (map[string]rulespb.RuleGroupList, map[string]rulespb.RuleGroupList) {
+	filtered := make(map[string]rulespb.RuleGroupList, len(ruleGroups))
+	skipped := make(map[string]rulespb.RuleGroupList)
+
+	for userID, groups := range ruleGroups {
+		featureFlags := limits.RulerFeatureFlags(userID)
+		filteredGroupsForUser := make(rulespb.RuleGroupList, 0, len(groups))
+		for _, group := range groups {
+			if ruleGroupFeatureFlagEnabled(group, featureFlags) {
+				filteredGroupsForUser = append(filteredGroupsForUser, group)
+			} else {
+				level.Debug(logger).Log("msg", "rule group skipped because the tenant doesn't have its feature flag", "user", userID, "namespace", group.Namespace, "name", group.Name, "feature_flag", group.FeatureFlag)
+				skipped[userID] = append(skipped[userID], group)
+			}
+		}
+		if len(filteredGroupsForUser) > 0 {
+			filtered[userID] = filteredGroupsForUser
+		}
+	}
+
+	return filtered, skipped
+}
+
 var sep = []byte("/")
 
 func tokenForGroup(g *rulespb.RuleGroupDesc) uint32 {
@@ -562,6 +668,8 @@ func (r *Ruler) run(ctx context.Context) error {
 				ringLastState = currRingState
 				r.syncRules(ctx, rulerSyncReasonRingChange)
 			}
+		case <-r.reloadDebouncer.reloads:
+			r.syncRules(ctx, rulerSyncReasonReload)
 		case err := <-r.subservicesWatcher.Chan():
 			return errors.Wrap(err, "ruler subservice failed")
 		}
@@ -583,6 +691,16 @@ func (r *Ruler) syncRules(ctx context.Context, reason string) {
 		return
 	}
 
+	// The rule groups feature flag is only known once the rule groups have been loaded.
+	loadedConfigs, skippedConfigs := filterRuleGroupsByFeatureFlags(loadedConfigs, r.limits, r.logger)
+	r.setSkippedRuleGroups(skippedConfigs)
+	if r.cfg.RulesBackupEnabled() {
+		backupConfigs, _ = filterRuleGroupsByFeatureFlags(backupConfigs, r.limits, r.logger)
+	}
+
+	// The rule groups changed within the tenant's quiet period are reloaded once it has elapsed.
+	loadedConfigs = r.reloadDebouncer.debounce(loadedConfigs)
+
 	// This will also delete local group files for users that are no longer in 'configs' map.
 	r.manager.SyncRuleGroups(ctx, loadedConfigs)
 
@@ -591,6 +709,18 @@ func (r *Ruler) syncRules(ctx context.Context, reason string) {
 	}
 }
 
+func (r *Ruler) setSkippedRuleGroups(skipped map[string]rulespb.RuleGroupList) {
+	r.skippedRuleGroupsMtx.Lock()
+	defer r.skippedRuleGroupsMtx.Unlock()
+	r.skippedRuleGroups = skipped
+}
+
+func (r *Ruler) getSkippedRuleGroups(userID string) rulespb.RuleGroupList {
+	r.skippedRuleGroupsMtx.RLock()
+	defer r.skippedRuleGroupsMtx.RUnlock()
+	return r.skippedRuleGroups[userID]
+}
+
 func (r *Ruler) loadRuleGroups(ctx context.Context) (map[string]rulespb.RuleGroupList, map[string]rulespb.RuleGroupList, error) {
 	timer := prometheus.NewTimer(nil)
 
@@ -982,18 +1112,30 @@ func (r *Ruler) getLocalRules(userID string, rulesRequest RulesRequest, includeB
 		}
 	}
 
-	if !includeBackups {
-		return groupDescs, nil
-	}
-
-	backupGroups := r.manager.GetBackupRules(userID)
-	backupGroupDescs, err := r.ruleGroupListToGroupStateDesc(userID, backupGroups, groupListFilter{
+	filters := groupListFilter{
 		ruleNameSet,
 		ruleGroupNameSet,
 		fileSet,
 		returnAlerts,
 		returnRecording,
-	})
+	}
+
+	// Report the rule groups not evaluated because the tenant doesn't have their feature flag.
+	skippedGroupDescs, err := r.ruleGroupListToGroupStateDesc(userID, r.getSkippedRuleGroups(userID), filters)
+	if err != nil {
+		return nil, err
+	}
+	for _, groupDesc := range skippedGroupDescs {
+		groupDesc.Skipped = true
+	}
+	groupDescs = append(groupDescs, skippedGroupDescs...)
+
+	if !includeBackups {
+		return groupDescs, nil
+	}
+
+	backupGroups := r.manager.GetBackupRules(userID)
+	backupGroupDescs, err := r.ruleGroupListToGroupStateDesc(userID, backupGroups, filters)
 	if err != nil {
 		return nil, err
 	}
@@ -1011,9 +1153,9 @@ type groupListFilter struct {
 
 // ruleGroupListToGroupStateDesc converts rulespb.RuleGroupList to []*GroupStateDesc while accepting filters to control what goes to the
 // resulting []*GroupStateDesc
-func (r *Ruler) ruleGroupListToGroupStateDesc(userID string, backupGroups rulespb.RuleGroupList, filters groupListFilter) ([]*GroupStateDesc, error) {
-	groupDescs := make([]*GroupStateDesc, 0, len(backupGroups))
-	for _, group := range backupGroups {
+func (r *Ruler) ruleGroupListToGroupStateDesc(userID string, ruleGroups rulespb.RuleGroupList, filters groupListFilter) ([]*GroupStateDesc, error) {
+	groupDescs := make([]*GroupStateDesc, 0, len(ruleGroups))
+	for _, group := range ruleGroups {
 		if len(filters.fileSet) > 0 {
 			if _, OK := filters.fileSet[group.GetNamespace()]; !OK {
 				continue
@@ -1032,11 +1174,12 @@ func (r *Ruler) ruleGroupListToGroupStateDesc(userID string, backupGroups rulesp
 
 		groupDesc := &GroupStateDesc{
 			Group: &rulespb.RuleGroupDesc{
-				Name:      group.GetName(),
-				Namespace: group.GetNamespace(),
-				Interval:  interval,
-				User:      userID,
-				Limit:     group.Limit,
+				Name:        group.GetName(),
+				Namespace:   group.GetNamespace(),
+				Interval:    interval,
+				User:        userID,
+				Limit:       group.Limit,
+				FeatureFlag: group.FeatureFlag,
 			},
 			// We are keeping default value for EvaluationTimestamp and EvaluationDuration since the backup is not evaluating
 		}
@@ -1281,7 +1424,7 @@ func (r *Ruler) ListAllRules(w http.ResponseWriter, req *http.Request) {
 		if userRules, err = r.store.LoadRuleGroups(ctx, userRules); err != nil {
 			return errors.Wrapf(err, "failed to load ruler config for user %s", userID)
 		}
-		data := map[string]map[string][]rulefmt.RuleGroup{userID: userRules[userID].Formatted()}
+		data := map[string]map[string][]rulespb.RuleGroup{userID: userRules[userID].FormattedWithFeatureFlags()}
 
 		select {
 		case iter <- data:
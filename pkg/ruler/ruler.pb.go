@@ -154,6 +154,9 @@ type GroupStateDesc struct {
 	ActiveRules         []*RuleStateDesc       `protobuf:"bytes,2,rep,name=active_rules,json=activeRules,proto3" json:"active_rules,omitempty"`
 	EvaluationTimestamp time.Time              `protobuf:"bytes,3,opt,name=evaluationTimestamp,proto3,stdtime" json:"evaluationTimestamp"`
 	EvaluationDuration  time.Duration          `protobuf:"bytes,4,opt,name=evaluationDuration,proto3,stdduration" json:"evaluationDuration"`
+	// Whether the rule group is not evaluated because the tenant doesn't have
+	// the rule group feature flag.
+	Skipped bool `protobuf:"varint,5,opt,name=skipped,proto3" json:"skipped,omitempty"`
 }
 
 func (m *GroupStateDesc) Reset()      { *m = GroupStateDesc{} }
@@ -216,6 +219,13 @@ func (m *GroupStateDesc) GetEvaluationDuration() time.Duration {
 	return 0
 }
 
+func (m *GroupStateDesc) GetSkipped() bool {
+	if m != nil {
+		return m.Skipped
+	}
+	return false
+}
+
 // RuleStateDesc is a proto representation of a Prometheus Rule
 type RuleStateDesc struct {
 	Rule                *rulespb.RuleDesc `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
@@ -420,54 +430,55 @@ func init() {
 func init() { proto.RegisterFile("ruler.proto", fileDescriptor_9ecbec0a4cfddea6) }
 
 var fileDescriptor_9ecbec0a4cfddea6 = []byte{
-	// 750 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x55, 0x4f, 0x6b, 0x13, 0x4f,
-	0x18, 0xde, 0x49, 0x9b, 0x34, 0x99, 0xf4, 0xd7, 0xf2, 0x9b, 0x46, 0x59, 0x83, 0x4c, 0x4a, 0x04,
-	0x29, 0x82, 0x1b, 0x88, 0x05, 0xf1, 0x50, 0x25, 0xa5, 0xad, 0x17, 0x91, 0xb2, 0x51, 0xaf, 0x61,
-	0x92, 0x4c, 0xb6, 0x6b, 0x37, 0x3b, 0xeb, 0xcc, 0x6c, 0xa8, 0x17, 0xf1, 0x23, 0xf4, 0xe8, 0xd9,
-	0x93, 0x1f, 0xa5, 0xc7, 0xe2, 0xa9, 0x88, 0x54, 0x9b, 0x5e, 0x3c, 0xf6, 0x23, 0xc8, 0xcc, 0xec,
-	0x9a, 0xa4, 0x56, 0x70, 0x91, 0x5e, 0x92, 0x79, 0xff, 0x3c, 0xcf, 0x3b, 0xef, 0xfb, 0xcc, 0xcc,
-	0xc2, 0x32, 0x8f, 0x03, 0xca, 0x9d, 0x88, 0x33, 0xc9, 0x50, 0x5e, 0x1b, 0xd5, 0x8a, 0xc7, 0x3c,
-	0xa6, 0x3d, 0x0d, 0xb5, 0x32, 0xc1, 0x2a, 0xf6, 0x18, 0xf3, 0x02, 0xda, 0xd0, 0x56, 0x37, 0x1e,
-	0x34, 0xfa, 0x31, 0x27, 0xd2, 0x67, 0x61, 0x12, 0xaf, 0x5d, 0x8e, 0x4b, 0x7f, 0x48, 0x85, 0x24,
-	0xc3, 0x28, 0x49, 0x78, 0xe4, 0xf9, 0x72, 0x2f, 0xee, 0x3a, 0x3d, 0x36, 0x6c, 0xf4, 0x18, 0x97,
-	0xf4, 0x20, 0xe2, 0xec, 0x35, 0xed, 0xc9, 0xc4, 0x6a, 0x44, 0xfb, 0x5e, 0x1a, 0xe8, 0x26, 0x8b,
-	0x04, 0xba, 0xf1, 0x37, 0x50, 0xbd, 0x79, 0xfd, 0x2b, 0xa2, 0xae, 0xf9, 0x37, 0xf0, 0xfa, 0x3b,
-	0xb8, 0xe8, 0x2a, 0xd3, 0xa5, 0x6f, 0x62, 0x2a, 0x24, 0xba, 0x0d, 0x4b, 0x2a, 0xfc, 0x9c, 0x0c,
-	0xa9, 0xb0, 0xc1, 0xea, 0xdc, 0x5a, 0xc9, 0x9d, 0x38, 0xd0, 0x5d, 0xb8, 0xa4, 0x8c, 0xa7, 0x9c,
-	0xc5, 0x91, 0x49, 0xc9, 0xe9, 0x94, 0x4b, 0x5e, 0x54, 0x81, 0xf9, 0x81, 0x1f, 0x50, 0x61, 0xcf,
-	0xe9, 0xb0, 0x31, 0x10, 0x82, 0xf3, 0xf2, 0x6d, 0x44, 0xed, 0xf9, 0x55, 0xb0, 0x56, 0x72, 0xf5,
-	0xba, 0xfe, 0x18, 0xfe, 0x97, 0xd4, 0x17, 0x11, 0x0b, 0x05, 0x45, 0xf7, 0x61, 0xc1, 0x53, 0x44,
-	0xa6, 0x7a, 0xb9, 0x79, 0xc3, 0x31, 0x32, 0x68, 0xf6, 0xb6, 0x24, 0x92, 0x6e, 0x51, 0xd1, 0x73,
-	0x93, 0xa4, 0xfa, 0xc7, 0x1c, 0x5c, 0x9a, 0x0d, 0xa1, 0x7b, 0x30, 0xaf, 0x83, 0x36, 0x58, 0x05,
-	0x6b, 0xe5, 0x66, 0xc5, 0x31, 0xfd, 0xba, 0xe9, 0x16, 0x35, 0xde, 0xa4, 0xa0, 0x87, 0x70, 0x91,
-	0xf4, 0xa4, 0x3f, 0xa2, 0x1d, 0x9d, 0xa4, 0xdb, 0x49, 0x21, 0x5c, 0x43, 0x26, 0x25, 0xcb, 0x26,
-	0x53, 0x6f, 0x17, 0xbd, 0x82, 0x2b, 0x74, 0x44, 0x82, 0x58, 0xcb, 0xfc, 0x22, 0x95, 0xd3, 0x9e,
-	0xd3, 0x25, 0xab, 0x8e, 0x11, 0xdc, 0x49, 0x05, 0x77, 0x7e, 0x65, 0x6c, 0x16, 0x8f, 0x4e, 0x6b,
-	0xd6, 0xe1, 0xb7, 0x1a, 0x70, 0xaf, 0x22, 0x40, 0x6d, 0x88, 0x26, 0xee, 0xad, 0xe4, 0x18, 0xe9,
-	0x89, 0x95, 0x9b, 0xb7, 0x7e, 0xa3, 0x4d, 0x13, 0x0c, 0xeb, 0x07, 0xc5, 0x7a, 0x05, 0xbc, 0xfe,
-	0x35, 0x67, 0xa6, 0x3c, 0x99, 0xd1, 0x1d, 0x38, 0xaf, 0x5a, 0x4c, 0x46, 0xb4, 0x3c, 0x35, 0x22,
-	0xdd, 0xaa, 0x0e, 0x2a, 0x15, 0x85, 0x42, 0xd8, 0x39, 0x2d, 0x98, 0x31, 0xd0, 0x4d, 0x58, 0xd8,
-	0xa3, 0x24, 0x90, 0x7b, 0xba, 0xd9, 0x92, 0x9b, 0x58, 0xea, 0xe4, 0x04, 0x44, 0xc8, 0x6d, 0xce,
-	0x19, 0x4f, 0x24, 0x9e, 0x38, 0x94, 0xac, 0x24, 0xa0, 0x5c, 0x0a, 0x3b, 0x3f, 0x23, 0x6b, 0x4b,
-	0x39, 0xa7, 0x64, 0x35, 0x49, 0x7f, 0x1a, 0x6f, 0xe1, 0x7a, 0xc6, 0xbb, 0xf0, 0x6f, 0xe3, 0xfd,
-	0x9c, 0x87, 0x4b, 0xb3, 0x7d, 0x4c, 0x46, 0x07, 0xa6, 0x47, 0x17, 0xc2, 0x42, 0x40, 0xba, 0x34,
-	0x48, 0xcf, 0xd9, 0x8a, 0x93, 0xde, 0x69, 0xe7, 0x99, 0xf2, 0xef, 0x12, 0x9f, 0x6f, 0xb6, 0x54,
-	0xad, 0x2f, 0xa7, 0xb5, 0x4c, 0x6f, 0x82, 0xc1, 0xb7, 0xfa, 0x24, 0x92, 0x94, 0xbb, 0x49, 0x15,
-	0x74, 0x00, 0xcb, 0x24, 0x0c, 0x99, 0xd4, 0xdb, 0x34, 0x97, 0xf1, 0xfa, 0x8a, 0x4e, 0x97, 0x52,
-	0xfd, 0xab, 0x39, 0x99, 0xbb, 0x0e, 0x5c, 0x63, 0xa0, 0x16, 0x2c, 0x25, 0xb7, 0x8d, 0x48, 0x3b,
-	0x9f, 0x41, 0xcb, 0xa2, 0x81, 0xb5, 0x24, 0x7a, 0x02, 0x8b, 0x03, 0x9f, 0xd3, 0xbe, 0x62, 0xc8,
-	0x72, 0x1a, 0x16, 0x34, 0xaa, 0x25, 0xd1, 0x36, 0x2c, 0x73, 0x2a, 0x58, 0x30, 0x32, 0x1c, 0x0b,
-	0x19, 0x38, 0x60, 0x0a, 0x6c, 0x49, 0xb4, 0x03, 0x17, 0xd5, 0xe1, 0xee, 0x08, 0x1a, 0x4a, 0xc5,
-	0x53, 0xcc, 0xc2, 0xa3, 0x90, 0x6d, 0x1a, 0x4a, 0xb3, 0x9d, 0x11, 0x09, 0xfc, 0x7e, 0x27, 0x0e,
-	0xa5, 0x1f, 0xd8, 0xa5, 0x2c, 0x34, 0x1a, 0xf8, 0x52, 0xe1, 0xd0, 0x2e, 0xfc, 0x7f, 0x9f, 0xd2,
-	0xa8, 0x33, 0xf0, 0xb9, 0x1f, 0x7a, 0x1d, 0xe1, 0x87, 0x3d, 0x6a, 0xc3, 0x0c, 0x64, 0xcb, 0x0a,
-	0xbe, 0xa3, 0xd1, 0x6d, 0x05, 0x6e, 0x6e, 0xc0, 0xbc, 0x7a, 0x0e, 0x38, 0x5a, 0x37, 0x0b, 0x81,
-	0x56, 0xa6, 0x5e, 0xc5, 0xf4, 0x7b, 0x51, 0xad, 0xcc, 0x3a, 0xcd, 0x23, 0x5e, 0xb7, 0x36, 0xd7,
-	0x8f, 0xcf, 0xb0, 0x75, 0x72, 0x86, 0xad, 0x8b, 0x33, 0x0c, 0xde, 0x8f, 0x31, 0xf8, 0x34, 0xc6,
-	0xe0, 0x68, 0x8c, 0xc1, 0xf1, 0x18, 0x83, 0xef, 0x63, 0x0c, 0x7e, 0x8c, 0xb1, 0x75, 0x31, 0xc6,
-	0xe0, 0xf0, 0x1c, 0x5b, 0xc7, 0xe7, 0xd8, 0x3a, 0x39, 0xc7, 0x56, 0xb7, 0xa0, 0xf7, 0xf8, 0xe0,
-	0x67, 0x00, 0x00, 0x00, 0xff, 0xff, 0x77, 0xf3, 0x36, 0x0c, 0x7b, 0x07, 0x00, 0x00,
+	// 766 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x55, 0xcf, 0x6a, 0x13, 0x41,
+	0x1c, 0xde, 0x49, 0x9b, 0x7f, 0x93, 0xda, 0xe2, 0x34, 0xca, 0x1a, 0x64, 0x13, 0x22, 0x48, 0x10,
+	0xdc, 0x40, 0x2c, 0x88, 0x87, 0x2a, 0x29, 0x6d, 0xbd, 0x88, 0x94, 0x8d, 0x7a, 0x0d, 0x93, 0x64,
+	0xb2, 0x5d, 0xbb, 0xd9, 0x59, 0x67, 0x66, 0x43, 0xbd, 0x88, 0x8f, 0xd0, 0xa3, 0x8f, 0xe0, 0x43,
+	0xf8, 0x00, 0x3d, 0x16, 0x4f, 0x45, 0xa4, 0xda, 0xed, 0xc5, 0x63, 0x1f, 0x41, 0x66, 0x66, 0xd7,
+	0x24, 0xb5, 0x42, 0x83, 0xf4, 0xd2, 0xce, 0xef, 0xcf, 0xf7, 0xfd, 0x66, 0xbe, 0x6f, 0x76, 0x02,
+	0x4b, 0x2c, 0xf2, 0x09, 0xb3, 0x43, 0x46, 0x05, 0x45, 0x59, 0x15, 0x54, 0xca, 0x2e, 0x75, 0xa9,
+	0xca, 0x34, 0xe5, 0x4a, 0x17, 0x2b, 0x96, 0x4b, 0xa9, 0xeb, 0x93, 0xa6, 0x8a, 0x7a, 0xd1, 0xb0,
+	0x39, 0x88, 0x18, 0x16, 0x1e, 0x0d, 0x92, 0x7a, 0xf5, 0x62, 0x5d, 0x78, 0x23, 0xc2, 0x05, 0x1e,
+	0x85, 0x49, 0xc3, 0x13, 0xd7, 0x13, 0xbb, 0x51, 0xcf, 0xee, 0xd3, 0x51, 0xb3, 0x4f, 0x99, 0x20,
+	0xfb, 0x21, 0xa3, 0x6f, 0x49, 0x5f, 0x24, 0x51, 0x33, 0xdc, 0x73, 0xd3, 0x42, 0x2f, 0x59, 0x24,
+	0xd0, 0xf5, 0xab, 0x40, 0xd5, 0xe6, 0xd5, 0x5f, 0x1e, 0xf6, 0xf4, 0x7f, 0x0d, 0xaf, 0x7f, 0x80,
+	0x4b, 0x8e, 0x0c, 0x1d, 0xf2, 0x2e, 0x22, 0x5c, 0xa0, 0xbb, 0xb0, 0x28, 0xcb, 0x2f, 0xf1, 0x88,
+	0x70, 0x13, 0xd4, 0x16, 0x1a, 0x45, 0x67, 0x92, 0x40, 0xf7, 0xe1, 0xb2, 0x0c, 0x9e, 0x33, 0x1a,
+	0x85, 0xba, 0x25, 0xa3, 0x5a, 0x2e, 0x64, 0x51, 0x19, 0x66, 0x87, 0x9e, 0x4f, 0xb8, 0xb9, 0xa0,
+	0xca, 0x3a, 0x40, 0x08, 0x2e, 0x8a, 0xf7, 0x21, 0x31, 0x17, 0x6b, 0xa0, 0x51, 0x74, 0xd4, 0xba,
+	0xfe, 0x14, 0xde, 0x48, 0xe6, 0xf3, 0x90, 0x06, 0x9c, 0xa0, 0x87, 0x30, 0xe7, 0x4a, 0x22, 0x3d,
+	0xbd, 0xd4, 0xba, 0x65, 0x6b, 0x1b, 0x14, 0x7b, 0x47, 0x60, 0x41, 0x36, 0x09, 0xef, 0x3b, 0x49,
+	0x53, 0xfd, 0x4b, 0x06, 0x2e, 0xcf, 0x96, 0xd0, 0x03, 0x98, 0x55, 0x45, 0x13, 0xd4, 0x40, 0xa3,
+	0xd4, 0x2a, 0xdb, 0xfa, 0xbc, 0x4e, 0xba, 0x45, 0x85, 0xd7, 0x2d, 0xe8, 0x31, 0x5c, 0xc2, 0x7d,
+	0xe1, 0x8d, 0x49, 0x57, 0x35, 0xa9, 0xe3, 0xa4, 0x10, 0xa6, 0x20, 0x93, 0x91, 0x25, 0xdd, 0xa9,
+	0xb6, 0x8b, 0xde, 0xc0, 0x55, 0x32, 0xc6, 0x7e, 0xa4, 0x6c, 0x7e, 0x95, 0xda, 0x69, 0x2e, 0xa8,
+	0x91, 0x15, 0x5b, 0x1b, 0x6e, 0xa7, 0x86, 0xdb, 0x7f, 0x3a, 0x36, 0x0a, 0x87, 0x27, 0x55, 0xe3,
+	0xe0, 0x47, 0x15, 0x38, 0x97, 0x11, 0xa0, 0x0e, 0x44, 0x93, 0xf4, 0x66, 0x72, 0x8d, 0x94, 0x62,
+	0xa5, 0xd6, 0x9d, 0xbf, 0x68, 0xd3, 0x06, 0xcd, 0xfa, 0x49, 0xb2, 0x5e, 0x02, 0x47, 0x26, 0xcc,
+	0xf3, 0x3d, 0x2f, 0x0c, 0xc9, 0xc0, 0xcc, 0xd6, 0x40, 0xa3, 0xe0, 0xa4, 0x61, 0xfd, 0x7b, 0x46,
+	0xeb, 0x3f, 0x51, 0xef, 0x1e, 0x5c, 0x94, 0x87, 0x4f, 0xc4, 0x5b, 0x99, 0x12, 0x4f, 0x89, 0xa0,
+	0x8a, 0xd2, 0x5f, 0x2e, 0x11, 0x66, 0x46, 0x59, 0xa9, 0x03, 0x74, 0x1b, 0xe6, 0x76, 0x09, 0xf6,
+	0xc5, 0xae, 0x92, 0xa1, 0xe8, 0x24, 0x91, 0xbc, 0x53, 0x3e, 0xe6, 0x62, 0x8b, 0x31, 0xca, 0x12,
+	0xf3, 0x27, 0x09, 0x69, 0x38, 0xf6, 0x09, 0x13, 0xdc, 0xcc, 0xce, 0x18, 0xde, 0x96, 0xc9, 0x29,
+	0xc3, 0x75, 0xd3, 0xbf, 0x84, 0xcf, 0x5d, 0x8f, 0xf0, 0xf9, 0xff, 0x12, 0xbe, 0xfe, 0x35, 0x0b,
+	0x97, 0x67, 0xcf, 0x31, 0x91, 0x0e, 0x4c, 0x4b, 0x17, 0xc0, 0x9c, 0x8f, 0x7b, 0xc4, 0x4f, 0x6f,
+	0xe0, 0xaa, 0x9d, 0x7e, 0xed, 0xf6, 0x0b, 0x99, 0xdf, 0xc1, 0x1e, 0xdb, 0x68, 0xcb, 0x59, 0xdf,
+	0x4e, 0xaa, 0x73, 0xbd, 0x16, 0x1a, 0xdf, 0x1e, 0xe0, 0x50, 0x10, 0xe6, 0x24, 0x53, 0xd0, 0x3e,
+	0x2c, 0xe1, 0x20, 0xa0, 0x42, 0x6d, 0x53, 0x7f, 0xa6, 0xd7, 0x37, 0x74, 0x7a, 0x94, 0x3c, 0xbf,
+	0xd4, 0x49, 0xbf, 0x02, 0xc0, 0xd1, 0x01, 0x6a, 0xc3, 0x62, 0xf2, 0x1d, 0x62, 0xa1, 0xee, 0xe8,
+	0x55, 0xbd, 0x2c, 0x68, 0x58, 0x5b, 0xa0, 0x67, 0xb0, 0x30, 0xf4, 0x18, 0x19, 0x48, 0x86, 0x79,
+	0x6e, 0x43, 0x5e, 0xa1, 0xda, 0x02, 0x6d, 0xc1, 0x12, 0x23, 0x9c, 0xfa, 0x63, 0xcd, 0x91, 0x9f,
+	0x83, 0x03, 0xa6, 0xc0, 0xb6, 0x40, 0xdb, 0x70, 0x49, 0x5e, 0xee, 0x2e, 0x27, 0x81, 0x90, 0x3c,
+	0x85, 0x79, 0x78, 0x24, 0xb2, 0x43, 0x02, 0xa1, 0xb7, 0x33, 0xc6, 0xbe, 0x37, 0xe8, 0x46, 0x81,
+	0xf0, 0x7c, 0xb3, 0x38, 0x0f, 0x8d, 0x02, 0xbe, 0x96, 0x38, 0xb4, 0x03, 0x6f, 0xee, 0x11, 0x12,
+	0x76, 0x87, 0x1e, 0xf3, 0x02, 0xb7, 0xcb, 0xbd, 0xa0, 0x4f, 0x4c, 0x38, 0x07, 0xd9, 0x8a, 0x84,
+	0x6f, 0x2b, 0x74, 0x47, 0x82, 0x5b, 0xeb, 0x30, 0x2b, 0x9f, 0x03, 0x86, 0xd6, 0xf4, 0x82, 0xa3,
+	0xd5, 0xa9, 0xf7, 0x32, 0xfd, 0x25, 0xa9, 0x94, 0x67, 0x93, 0xfa, 0x79, 0xaf, 0x1b, 0x1b, 0x6b,
+	0x47, 0xa7, 0x96, 0x71, 0x7c, 0x6a, 0x19, 0xe7, 0xa7, 0x16, 0xf8, 0x18, 0x5b, 0xe0, 0x73, 0x6c,
+	0x81, 0xc3, 0xd8, 0x02, 0x47, 0xb1, 0x05, 0x7e, 0xc6, 0x16, 0xf8, 0x15, 0x5b, 0xc6, 0x79, 0x6c,
+	0x81, 0x83, 0x33, 0xcb, 0x38, 0x3a, 0xb3, 0x8c, 0xe3, 0x33, 0xcb, 0xe8, 0xe5, 0xd4, 0x1e, 0x1f,
+	0xfd, 0x0e, 0x00, 0x00, 0xff, 0xff, 0xaf, 0x64, 0x36, 0x8c, 0x95, 0x07, 0x00, 0x00,
 }
 
 func (this *RulesRequest) Equal(that interface{}) bool {
@@ -583,6 +594,9 @@ func (this *GroupStateDesc) Equal(that interface{}) bool {
 	if this.EvaluationDuration != that1.EvaluationDuration {
 		return false
 	}
+	if this.Skipped != that1.Skipped {
+		return false
+	}
 	return true
 }
 func (this *RuleStateDesc) Equal(that interface{}) bool {
@@ -722,7 +736,7 @@ func (this *GroupStateDesc) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 8)
+	s := make([]string, 0, 9)
 	s = append(s, "&ruler.GroupStateDesc{")
 	if this.Group != nil {
 		s = append(s, "Group: "+fmt.Sprintf("%#v", this.Group)+",\n")
@@ -732,6 +746,7 @@ func (this *GroupStateDesc) GoString() string {
 	}
 	s = append(s, "EvaluationTimestamp: "+fmt.Sprintf("%#v", this.EvaluationTimestamp)+",\n")
 	s = append(s, "EvaluationDuration: "+fmt.Sprintf("%#v", this.EvaluationDuration)+",\n")
+	s = append(s, "Skipped: "+fmt.Sprintf("%#v", this.Skipped)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -977,6 +992,16 @@ func (m *GroupStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Skipped {
+		i--
+		if m.Skipped {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x28
+	}
 	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
 	if err1 != nil {
 		return 0, err1
@@ -1297,6 +1322,9 @@ func (m *GroupStateDesc) Size() (n int) {
 	n += 1 + l + sovRuler(uint64(l))
 	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration)
 	n += 1 + l + sovRuler(uint64(l))
+	if m.Skipped {
+		n += 2
+	}
 	return n
 }
 
@@ -1423,6 +1451,7 @@ func (this *GroupStateDesc) String() string {
 		`ActiveRules:` + repeatedStringForActiveRules + `,`,
 		`EvaluationTimestamp:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.EvaluationTimestamp), "Timestamp", "timestamp.Timestamp", 1), `&`, ``, 1) + `,`,
 		`EvaluationDuration:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.EvaluationDuration), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`Skipped:` + fmt.Sprintf("%v", this.Skipped) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1908,6 +1937,26 @@ func (m *GroupStateDesc) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Skipped", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Skipped = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRuler(dAtA[iNdEx:])
@@ -88,6 +88,11 @@ type ruleLimits struct {
 	maxRuleGroups        int
 	disabledRuleGroups   validation.DisabledRuleGroups
 	maxQueryLength       time.Duration
+	featureFlags         []string
+	maxConcurrentGroups  int
+	skipUnchangedResults time.Duration
+	reloadQuietPeriod    time.Duration
+	notificationDedup    bool
 }
 
 func (r ruleLimits) EvaluationDelay(_ string) time.Duration {
@@ -112,6 +117,22 @@ func (r ruleLimits) DisabledRuleGroups(userID string) validation.DisabledRuleGro
 
 func (r ruleLimits) MaxQueryLength(_ string) time.Duration { return r.maxQueryLength }
 
+func (r ruleLimits) RulerFeatureFlags(_ string) []string { return r.featureFlags }
+
+func (r ruleLimits) RulerMaxConcurrentGroupEvaluations(_ string) int { return r.maxConcurrentGroups }
+
+func (r ruleLimits) RulerSkipUnchangedResultsMaxInterval(_ string) time.Duration {
+	return r.skipUnchangedResults
+}
+
+func (r ruleLimits) RulerReloadQuietPeriod(_ string) time.Duration {
+	return r.reloadQuietPeriod
+}
+
+func (r ruleLimits) RulerNotificationDeduplication(_ string) bool {
+	return r.notificationDedup
+}
+
 func newEmptyQueryable() storage.Queryable {
 	return storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
 		return emptyQuerier{}, nil
@@ -179,7 +200,7 @@ func testSetup(t *testing.T, querierTestConfig *querier.TestConfig) (*promql.Eng
 func newManager(t *testing.T, cfg Config) *DefaultMultiTenantManager {
 	engine, queryable, pusher, logger, overrides, reg := testSetup(t, nil)
 	metrics := NewRuleEvalMetrics(cfg, nil)
-	managerFactory := DefaultTenantManagerFactory(cfg, pusher, queryable, engine, overrides, metrics, nil)
+	managerFactory := DefaultTenantManagerFactory(cfg, pusher, queryable, engine, overrides, metrics, nil, nil, nil)
 	manager, err := NewDefaultMultiTenantManager(cfg, managerFactory, metrics, reg, logger)
 	require.NoError(t, err)
 
@@ -227,7 +248,7 @@ func newMockClientsPool(cfg Config, logger log.Logger, reg prometheus.Registerer
 func buildRuler(t *testing.T, rulerConfig Config, querierTestConfig *querier.TestConfig, store rulestore.RuleStore, rulerAddrMap map[string]*Ruler) (*Ruler, *DefaultMultiTenantManager) {
 	engine, queryable, pusher, logger, overrides, reg := testSetup(t, querierTestConfig)
 	metrics := NewRuleEvalMetrics(rulerConfig, reg)
-	managerFactory := DefaultTenantManagerFactory(rulerConfig, pusher, queryable, engine, overrides, metrics, reg)
+	managerFactory := DefaultTenantManagerFactory(rulerConfig, pusher, queryable, engine, overrides, metrics, nil, nil, reg)
 	manager, err := NewDefaultMultiTenantManager(rulerConfig, managerFactory, metrics, reg, log.NewNopLogger())
 	require.NoError(t, err)
 
@@ -324,6 +345,77 @@ func TestRuler_Rules(t *testing.T) {
 	compareRuleGroupDescToStateDesc(t, expectedRg, rg)
 }
 
+func TestRuler_RulesSkipsRuleGroupsWithoutFeatureFlag(t *testing.T) {
+	ruleGroup := func(user, name, featureFlag string) *rulespb.RuleGroupDesc {
+		return &rulespb.RuleGroupDesc{
+			Name:        name,
+			Namespace:   "namespace1",
+			User:        user,
+			Rules:       []*rulespb.RuleDesc{{Record: "UP_RULE", Expr: "up"}},
+			Interval:    interval,
+			FeatureFlag: featureFlag,
+		}
+	}
+
+	rules := map[string]rulespb.RuleGroupList{
+		"user1": {ruleGroup("user1", "group1", ""), ruleGroup("user1", "group2", "beta")},
+		"user2": {ruleGroup("user2", "group1", "beta")},
+	}
+
+	tests := map[string]struct {
+		featureFlags    []string
+		expectedActive  map[string][]string
+		expectedSkipped map[string][]string
+	}{
+		"should skip the rule groups tagged with a feature flag if the tenant has no feature flags": {
+			expectedActive:  map[string][]string{"user1": {"group1"}},
+			expectedSkipped: map[string][]string{"user1": {"group2"}, "user2": {"group1"}},
+		},
+		"should skip the rule groups tagged with a feature flag the tenant doesn't have": {
+			featureFlags:    []string{"alpha"},
+			expectedActive:  map[string][]string{"user1": {"group1"}},
+			expectedSkipped: map[string][]string{"user1": {"group2"}, "user2": {"group1"}},
+		},
+		"should evaluate the rule groups tagged with a feature flag the tenant has": {
+			featureFlags:   []string{"alpha", "beta"},
+			expectedActive: map[string][]string{"user1": {"group1", "group2"}, "user2": {"group1"}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			r, manager := buildRuler(t, defaultRulerConfig(t), nil, newMockRuleStore(rules, nil), nil)
+			r.limits = ruleLimits{featureFlags: testData.featureFlags}
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+			defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+			r.syncRules(context.Background(), rulerSyncReasonInitial)
+
+			for _, userID := range []string{"user1", "user2"} {
+				var evaluated []string
+				for _, g := range manager.GetRules(userID) {
+					evaluated = append(evaluated, g.Name())
+				}
+				assert.ElementsMatch(t, testData.expectedActive[userID], evaluated)
+
+				rls, err := r.Rules(user.InjectOrgID(context.Background(), userID), &RulesRequest{})
+				require.NoError(t, err)
+
+				var active, skipped []string
+				for _, g := range rls.Groups {
+					if g.Skipped {
+						assert.Equal(t, "beta", g.Group.FeatureFlag)
+						skipped = append(skipped, g.Group.Name)
+					} else {
+						active = append(active, g.Group.Name)
+					}
+				}
+				assert.ElementsMatch(t, testData.expectedActive[userID], active)
+				assert.ElementsMatch(t, testData.expectedSkipped[userID], skipped)
+			}
+		})
+	}
+}
+
 func compareRuleGroupDescToStateDesc(t *testing.T, expected *rulespb.RuleGroupDesc, got *GroupStateDesc) {
 	require.Equal(t, got.Group.Name, expected.Name)
 	require.Equal(t, got.Group.Namespace, expected.Namespace)
@@ -1974,6 +2066,26 @@ func TestSendAlerts(t *testing.T) {
 				},
 			},
 		},
+		{
+			in: []*promRules.Alert{
+				{
+					Labels:      labels.FromStrings("l1", "v1", "l2", "v2", "l3", "v3"),
+					Annotations: labels.FromStrings(AlertGroupingHintAnnotation, "l2, l1,l1,missing"),
+					ActiveAt:    time.Unix(1, 0),
+					FiredAt:     time.Unix(2, 0),
+					ValidUntil:  time.Unix(3, 0),
+				},
+			},
+			exp: []*notifier.Alert{
+				{
+					Labels:       labels.FromStrings("l1", "v1", "l2", "v2", "l3", "v3", AlertGroupingHintLabel, `{l1="v1", l2="v2"}`),
+					Annotations:  labels.FromStrings(AlertGroupingHintAnnotation, "l2, l1,l1,missing"),
+					StartsAt:     time.Unix(2, 0),
+					EndsAt:       time.Unix(3, 0),
+					GeneratorURL: "http://localhost:9090/graph?g0.expr=up&g0.tab=1",
+				},
+			},
+		},
 		{
 			in: []*promRules.Alert{},
 		},
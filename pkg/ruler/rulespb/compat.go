@@ -11,6 +11,15 @@ import (
 	"github.com/cortexproject/cortex/pkg/cortexpb" //lint:ignore faillint allowed to import other protobuf
 )
 
+// RuleGroup is a formatted prometheus rulegroup extended with the Cortex specific
+// rule group fields.
+type RuleGroup struct {
+	rulefmt.RuleGroup `yaml:",inline"`
+
+	// FeatureFlag is the feature flag a tenant must have to get the rule group evaluated.
+	FeatureFlag string `yaml:"feature_flag,omitempty"`
+}
+
 // ToProto transforms a formatted prometheus rulegroup to a rule group protobuf
 func ToProto(user string, namespace string, rl rulefmt.RuleGroup) *RuleGroupDesc {
 	rg := RuleGroupDesc{
@@ -19,3 +19,13 @@ func (l RuleGroupList) Formatted() map[string][]rulefmt.RuleGroup {
 	}
 	return ruleMap
 }
+
+// FormattedWithFeatureFlags returns the rule group list as a set of formatted rule groups,
+// including their feature flag, mapped by namespace.
+func (l RuleGroupList) FormattedWithFeatureFlags() map[string][]RuleGroup {
+	ruleMap := map[string][]RuleGroup{}
+	for _, g := range l {
+		ruleMap[g.Namespace] = append(ruleMap[g.Namespace], RuleGroup{RuleGroup: FromProto(g), FeatureFlag: g.FeatureFlag})
+	}
+	return ruleMap
+}
@@ -45,6 +45,9 @@ type RuleGroupDesc struct {
 	// to the Prometheus Manager.
 	Options []*types.Any `protobuf:"bytes,9,rep,name=options,proto3" json:"options,omitempty"`
 	Limit   int64        `protobuf:"varint,10,opt,name=limit,proto3" json:"limit,omitempty"`
+	// The feature flag a tenant must have to get the rule group evaluated. Rule
+	// groups without a feature flag are evaluated for every tenant.
+	FeatureFlag string `protobuf:"bytes,11,opt,name=feature_flag,json=featureFlag,proto3" json:"feature_flag,omitempty"`
 }
 
 func (m *RuleGroupDesc) Reset()      { *m = RuleGroupDesc{} }
@@ -128,6 +131,13 @@ func (m *RuleGroupDesc) GetLimit() int64 {
 	return 0
 }
 
+func (m *RuleGroupDesc) GetFeatureFlag() string {
+	if m != nil {
+		return m.FeatureFlag
+	}
+	return ""
+}
+
 // RuleDesc is a proto representation of a Prometheus Rule
 type RuleDesc struct {
 	Expr          string                                                      `protobuf:"bytes,1,opt,name=expr,proto3" json:"expr,omitempty"`
@@ -214,40 +224,42 @@ func init() {
 func init() { proto.RegisterFile("rules.proto", fileDescriptor_8e722d3e922f0937) }
 
 var fileDescriptor_8e722d3e922f0937 = []byte{
-	// 524 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x52, 0x4f, 0x6f, 0xd3, 0x30,
-	0x1c, 0x8d, 0xd7, 0x34, 0x4b, 0x5d, 0x55, 0xab, 0x4c, 0x85, 0xbc, 0x81, 0xdc, 0x6a, 0x12, 0x52,
-	0x4f, 0x89, 0x34, 0xc4, 0x81, 0x03, 0x42, 0xad, 0xa6, 0x21, 0x55, 0x1c, 0x50, 0x8e, 0x08, 0x69,
-	0x72, 0x52, 0x37, 0x84, 0xa5, 0x71, 0xe4, 0x38, 0x68, 0xbb, 0xf1, 0x11, 0xb8, 0x20, 0xf1, 0x11,
-	0xf8, 0x28, 0x3b, 0x96, 0xdb, 0xc4, 0xa1, 0xd0, 0xf4, 0x82, 0x38, 0xed, 0x23, 0x20, 0xdb, 0x09,
-	0x7f, 0x0f, 0xc0, 0x81, 0x53, 0x7e, 0xcf, 0x2f, 0xcf, 0xef, 0xf9, 0xd9, 0xb0, 0x2b, 0xca, 0x94,
-	0x15, 0x5e, 0x2e, 0xb8, 0xe4, 0xa8, 0xad, 0xc1, 0xc1, 0x20, 0xe6, 0x31, 0xd7, 0x2b, 0xbe, 0x9a,
-	0x0c, 0x79, 0x40, 0x62, 0xce, 0xe3, 0x94, 0xf9, 0x1a, 0x85, 0xe5, 0xc2, 0x9f, 0x97, 0x82, 0xca,
-	0x84, 0x67, 0x35, 0xbf, 0xff, 0x2b, 0x4f, 0xb3, 0x8b, 0x9a, 0xba, 0x1f, 0x27, 0xf2, 0x79, 0x19,
-	0x7a, 0x11, 0x5f, 0xfa, 0x11, 0x17, 0x92, 0x9d, 0xe7, 0x82, 0xbf, 0x60, 0x91, 0xac, 0x91, 0x9f,
-	0x9f, 0xc5, 0x0d, 0x11, 0xd6, 0x83, 0x91, 0x1e, 0xbe, 0xd9, 0x81, 0xbd, 0xa0, 0x4c, 0xd9, 0x23,
-	0xc1, 0xcb, 0xfc, 0x98, 0x15, 0x11, 0x42, 0xd0, 0xce, 0xe8, 0x92, 0x61, 0x30, 0x02, 0xe3, 0x4e,
-	0xa0, 0x67, 0x74, 0x1b, 0x76, 0xd4, 0xb7, 0xc8, 0x69, 0xc4, 0xf0, 0x8e, 0x26, 0xbe, 0x2f, 0xa0,
-	0x87, 0xd0, 0x4d, 0x32, 0xc9, 0xc4, 0x4b, 0x9a, 0xe2, 0xd6, 0x08, 0x8c, 0xbb, 0x47, 0xfb, 0x9e,
-	0x09, 0xeb, 0x35, 0x61, 0xbd, 0xe3, 0xfa, 0x30, 0x53, 0xf7, 0x72, 0x3d, 0xb4, 0xde, 0x7e, 0x1c,
-	0x82, 0xe0, 0x9b, 0x08, 0xdd, 0x81, 0xa6, 0x19, 0x6c, 0x8f, 0x5a, 0xe3, 0xee, 0xd1, 0x9e, 0x67,
-	0x4a, 0x53, 0xb9, 0x54, 0xa4, 0xc0, 0xb0, 0x2a, 0x59, 0x59, 0x30, 0x81, 0x1d, 0x93, 0x4c, 0xcd,
-	0xc8, 0x83, 0xbb, 0x3c, 0x57, 0x1b, 0x17, 0xb8, 0xa3, 0xc5, 0x83, 0xdf, 0xac, 0x27, 0xd9, 0x45,
-	0xd0, 0xfc, 0x84, 0x06, 0xb0, 0x9d, 0x26, 0xcb, 0x44, 0x62, 0x38, 0x02, 0xe3, 0x56, 0x60, 0xc0,
-	0xcc, 0x76, 0xdb, 0x7d, 0x67, 0x66, 0xbb, 0xbb, 0x7d, 0x77, 0x66, 0xbb, 0x6e, 0xbf, 0x73, 0xf8,
-	0xbe, 0x05, 0xdd, 0xc6, 0x5f, 0x19, 0xab, 0x4a, 0x9b, 0x4a, 0xd4, 0x8c, 0x6e, 0x42, 0x47, 0xb0,
-	0x88, 0x8b, 0x79, 0xdd, 0x47, 0x8d, 0x94, 0x01, 0x4d, 0x99, 0x90, 0xba, 0x89, 0x4e, 0x60, 0x00,
-	0xba, 0x07, 0x5b, 0x0b, 0x2e, 0xb0, 0xfd, 0xf7, 0xed, 0xa8, 0xff, 0x51, 0x06, 0x9d, 0x94, 0x86,
-	0x2c, 0x2d, 0x70, 0x5b, 0x1f, 0xee, 0x86, 0xd7, 0xdc, 0xa2, 0xf7, 0x58, 0xad, 0x3f, 0xa1, 0x89,
-	0x98, 0x4e, 0x94, 0xe6, 0xc3, 0x7a, 0xf8, 0x4f, 0xaf, 0xc0, 0xe8, 0x27, 0x73, 0x9a, 0x4b, 0x26,
-	0x82, 0xda, 0x05, 0x9d, 0xc3, 0x2e, 0xcd, 0x32, 0x2e, 0xa9, 0x69, 0xd4, 0xf9, 0xaf, 0xa6, 0x3f,
-	0x5a, 0xa1, 0x67, 0xb0, 0x77, 0xc6, 0x58, 0x7e, 0x92, 0x88, 0x24, 0x8b, 0x4f, 0xb8, 0xc0, 0xbd,
-	0x3f, 0x55, 0x75, 0x4b, 0x25, 0xf8, 0xb2, 0x1e, 0xee, 0x29, 0xdd, 0xe9, 0x42, 0x0b, 0x4f, 0x17,
-	0x5c, 0xe8, 0xf6, 0x7e, 0xde, 0x4c, 0xdf, 0x6c, 0x6f, 0xfa, 0x60, 0xb5, 0x21, 0xd6, 0xd5, 0x86,
-	0x58, 0xd7, 0x1b, 0x02, 0x5e, 0x55, 0x04, 0xbc, 0xab, 0x08, 0xb8, 0xac, 0x08, 0x58, 0x55, 0x04,
-	0x7c, 0xaa, 0x08, 0xf8, 0x5c, 0x11, 0xeb, 0xba, 0x22, 0xe0, 0xf5, 0x96, 0x58, 0xab, 0x2d, 0xb1,
-	0xae, 0xb6, 0xc4, 0x7a, 0xba, 0xab, 0x1f, 0x5f, 0x1e, 0x86, 0x8e, 0xce, 0x70, 0xf7, 0x6b, 0x00,
-	0x00, 0x00, 0xff, 0xff, 0x77, 0x8c, 0xa0, 0x4e, 0xd3, 0x03, 0x00, 0x00,
+	// 546 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x52, 0xbf, 0x8e, 0xd3, 0x30,
+	0x1c, 0x8e, 0xaf, 0x69, 0x2e, 0x75, 0xa8, 0xee, 0x64, 0x2a, 0x94, 0x3b, 0x90, 0x5b, 0x4e, 0x42,
+	0xea, 0x94, 0x4a, 0x87, 0x18, 0x18, 0x10, 0x6a, 0x75, 0x2a, 0x52, 0xc5, 0x80, 0x32, 0x22, 0xa4,
+	0xca, 0x49, 0x9d, 0x10, 0x2e, 0x8d, 0x23, 0xc7, 0x41, 0x77, 0x1b, 0x8f, 0xc0, 0xc8, 0x23, 0xf0,
+	0x08, 0x3c, 0xc2, 0x8d, 0x65, 0x3b, 0x31, 0x14, 0x9a, 0x2e, 0x88, 0xe9, 0x1e, 0x01, 0xd9, 0x4e,
+	0xf8, 0x3b, 0x00, 0x03, 0x93, 0x7f, 0xdf, 0xef, 0xf3, 0xe7, 0xdf, 0xe7, 0xcf, 0x86, 0x0e, 0x2f,
+	0x53, 0x5a, 0x78, 0x39, 0x67, 0x82, 0xa1, 0xb6, 0x02, 0x87, 0xbd, 0x98, 0xc5, 0x4c, 0x75, 0x46,
+	0xb2, 0xd2, 0xe4, 0x21, 0x8e, 0x19, 0x8b, 0x53, 0x3a, 0x52, 0x28, 0x28, 0xa3, 0xd1, 0xa2, 0xe4,
+	0x44, 0x24, 0x2c, 0xab, 0xf9, 0x83, 0x5f, 0x79, 0x92, 0x9d, 0xd7, 0xd4, 0xfd, 0x38, 0x11, 0xcf,
+	0xcb, 0xc0, 0x0b, 0xd9, 0x72, 0x14, 0x32, 0x2e, 0xe8, 0x59, 0xce, 0xd9, 0x0b, 0x1a, 0x8a, 0x1a,
+	0x8d, 0xf2, 0xd3, 0xb8, 0x21, 0x82, 0xba, 0xd0, 0xd2, 0xa3, 0x77, 0x3b, 0xb0, 0xeb, 0x97, 0x29,
+	0x7d, 0xc4, 0x59, 0x99, 0x9f, 0xd0, 0x22, 0x44, 0x08, 0x9a, 0x19, 0x59, 0x52, 0x17, 0x0c, 0xc0,
+	0xb0, 0xe3, 0xab, 0x1a, 0xdd, 0x82, 0x1d, 0xb9, 0x16, 0x39, 0x09, 0xa9, 0xbb, 0xa3, 0x88, 0xef,
+	0x0d, 0xf4, 0x10, 0xda, 0x49, 0x26, 0x28, 0x7f, 0x49, 0x52, 0xb7, 0x35, 0x00, 0x43, 0xe7, 0xf8,
+	0xc0, 0xd3, 0x66, 0xbd, 0xc6, 0xac, 0x77, 0x52, 0x5f, 0x66, 0x62, 0x5f, 0xac, 0xfb, 0xc6, 0x9b,
+	0x8f, 0x7d, 0xe0, 0x7f, 0x13, 0xa1, 0x3b, 0x50, 0x27, 0xe3, 0x9a, 0x83, 0xd6, 0xd0, 0x39, 0xde,
+	0xf3, 0x74, 0x68, 0xd2, 0x97, 0xb4, 0xe4, 0x6b, 0x56, 0x3a, 0x2b, 0x0b, 0xca, 0x5d, 0x4b, 0x3b,
+	0x93, 0x35, 0xf2, 0xe0, 0x2e, 0xcb, 0xe5, 0xc1, 0x85, 0xdb, 0x51, 0xe2, 0xde, 0x6f, 0xa3, 0xc7,
+	0xd9, 0xb9, 0xdf, 0x6c, 0x42, 0x3d, 0xd8, 0x4e, 0x93, 0x65, 0x22, 0x5c, 0x38, 0x00, 0xc3, 0x96,
+	0xaf, 0x01, 0xba, 0x0d, 0xaf, 0x45, 0x94, 0x88, 0x92, 0xd3, 0x79, 0x94, 0x92, 0xd8, 0x75, 0xd4,
+	0x04, 0xa7, 0xee, 0x4d, 0x53, 0x12, 0xcf, 0x4c, 0xbb, 0xbd, 0x6f, 0xcd, 0x4c, 0x7b, 0x77, 0xdf,
+	0x9e, 0x99, 0xb6, 0xbd, 0xdf, 0x39, 0x7a, 0xdf, 0x82, 0x76, 0x63, 0x51, 0x7a, 0x93, 0xa9, 0x37,
+	0xa9, 0xc9, 0x1a, 0xdd, 0x80, 0x16, 0xa7, 0x21, 0xe3, 0x8b, 0x3a, 0xb2, 0x1a, 0x49, 0x0f, 0x24,
+	0xa5, 0x5c, 0xa8, 0xb0, 0x3a, 0xbe, 0x06, 0xe8, 0x1e, 0x6c, 0x45, 0x8c, 0xbb, 0xe6, 0xdf, 0x07,
+	0x28, 0xf7, 0xa3, 0x0c, 0x5a, 0x29, 0x09, 0x68, 0x5a, 0xb8, 0x6d, 0x75, 0xff, 0xeb, 0x5e, 0xf3,
+	0xd0, 0xde, 0x63, 0xd9, 0x7f, 0x42, 0x12, 0x3e, 0x19, 0x4b, 0xcd, 0x87, 0x75, 0xff, 0x9f, 0x3e,
+	0x8a, 0xd6, 0x8f, 0x17, 0x24, 0x17, 0x94, 0xfb, 0xf5, 0x14, 0x74, 0x06, 0x1d, 0x92, 0x65, 0x4c,
+	0x10, 0x1d, 0xba, 0xf5, 0x5f, 0x87, 0xfe, 0x38, 0x0a, 0x3d, 0x83, 0xdd, 0x53, 0x4a, 0xf3, 0x69,
+	0xc2, 0x93, 0x2c, 0x9e, 0x32, 0xee, 0x76, 0xff, 0x14, 0xd5, 0x4d, 0xe9, 0xe0, 0xcb, 0xba, 0xbf,
+	0x27, 0x75, 0xf3, 0x48, 0x09, 0xe7, 0x11, 0xe3, 0x2a, 0xbd, 0x9f, 0x0f, 0x53, 0x2f, 0xdb, 0x9d,
+	0x3c, 0x58, 0x6d, 0xb0, 0x71, 0xb9, 0xc1, 0xc6, 0xd5, 0x06, 0x83, 0x57, 0x15, 0x06, 0x6f, 0x2b,
+	0x0c, 0x2e, 0x2a, 0x0c, 0x56, 0x15, 0x06, 0x9f, 0x2a, 0x0c, 0x3e, 0x57, 0xd8, 0xb8, 0xaa, 0x30,
+	0x78, 0xbd, 0xc5, 0xc6, 0x6a, 0x8b, 0x8d, 0xcb, 0x2d, 0x36, 0x9e, 0xee, 0xaa, 0xff, 0x99, 0x07,
+	0x81, 0xa5, 0x3c, 0xdc, 0xfd, 0x1a, 0x00, 0x00, 0xff, 0xff, 0x3f, 0xd7, 0xaf, 0x87, 0xf6, 0x03,
+	0x00, 0x00,
 }
 
 func (this *RuleGroupDesc) Equal(that interface{}) bool {
@@ -300,6 +312,9 @@ func (this *RuleGroupDesc) Equal(that interface{}) bool {
 	if this.Limit != that1.Limit {
 		return false
 	}
+	if this.FeatureFlag != that1.FeatureFlag {
+		return false
+	}
 	return true
 }
 func (this *RuleDesc) Equal(that interface{}) bool {
@@ -358,7 +373,7 @@ func (this *RuleGroupDesc) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 11)
+	s := make([]string, 0, 12)
 	s = append(s, "&rulespb.RuleGroupDesc{")
 	s = append(s, "Name: "+fmt.Sprintf("%#v", this.Name)+",\n")
 	s = append(s, "Namespace: "+fmt.Sprintf("%#v", this.Namespace)+",\n")
@@ -371,6 +386,7 @@ func (this *RuleGroupDesc) GoString() string {
 		s = append(s, "Options: "+fmt.Sprintf("%#v", this.Options)+",\n")
 	}
 	s = append(s, "Limit: "+fmt.Sprintf("%#v", this.Limit)+",\n")
+	s = append(s, "FeatureFlag: "+fmt.Sprintf("%#v", this.FeatureFlag)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -418,6 +434,13 @@ func (m *RuleGroupDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.FeatureFlag) > 0 {
+		i -= len(m.FeatureFlag)
+		copy(dAtA[i:], m.FeatureFlag)
+		i = encodeVarintRules(dAtA, i, uint64(len(m.FeatureFlag)))
+		i--
+		dAtA[i] = 0x5a
+	}
 	if m.Limit != 0 {
 		i = encodeVarintRules(dAtA, i, uint64(m.Limit))
 		i--
@@ -617,6 +640,10 @@ func (m *RuleGroupDesc) Size() (n int) {
 	if m.Limit != 0 {
 		n += 1 + sovRules(uint64(m.Limit))
 	}
+	l = len(m.FeatureFlag)
+	if l > 0 {
+		n += 1 + l + sovRules(uint64(l))
+	}
 	return n
 }
 
@@ -685,6 +712,7 @@ func (this *RuleGroupDesc) String() string {
 		`User:` + fmt.Sprintf("%v", this.User) + `,`,
 		`Options:` + repeatedStringForOptions + `,`,
 		`Limit:` + fmt.Sprintf("%v", this.Limit) + `,`,
+		`FeatureFlag:` + fmt.Sprintf("%v", this.FeatureFlag) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -958,6 +986,38 @@ func (m *RuleGroupDesc) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FeatureFlag", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRules
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRules
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRules
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.FeatureFlag = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRules(dAtA[iNdEx:])
@@ -0,0 +1,84 @@
+package ruler
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+// unchangedResultsCache keeps the hash of the results last written by the rule evaluations of
+// a tenant, to skip writing the results which didn't change since the previous evaluation.
+// The results are identified by their series, so the cache doesn't need to know the rule
+// which produced them.
+type unchangedResultsCache struct {
+	mtx       sync.Mutex
+	entries   map[uint64]unchangedResultsEntry // Keyed by the hash of the result series.
+	lastPurge time.Time
+}
+
+type unchangedResultsEntry struct {
+	valuesHash uint64
+	lastWrite  time.Time
+}
+
+func newUnchangedResultsCache() *unchangedResultsCache {
+	return &unchangedResultsCache{
+		entries: map[uint64]unchangedResultsEntry{},
+	}
+}
+
+// shouldSkip returns whether the results are identical to the last written ones, and
+// were written less than maxInterval ago.
+func (c *unchangedResultsCache) shouldSkip(seriesHash, valuesHash uint64, now time.Time, maxInterval time.Duration) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[seriesHash]
+	return ok && entry.valuesHash == valuesHash && now.Sub(entry.lastWrite) < maxInterval
+}
+
+// written records the results have been written.
+func (c *unchangedResultsCache) written(seriesHash, valuesHash uint64, now time.Time, maxInterval time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.entries[seriesHash] = unchangedResultsEntry{valuesHash: valuesHash, lastWrite: now}
+
+	// The entries older than maxInterval can't skip any write, so they're periodically
+	// purged to not keep the results of rules which have been removed or changed.
+	if now.Sub(c.lastPurge) < maxInterval {
+		return
+	}
+	for key, entry := range c.entries {
+		if now.Sub(entry.lastWrite) >= maxInterval {
+			delete(c.entries, key)
+		}
+	}
+	c.lastPurge = now
+}
+
+// hashResults returns the hash of the result series and the hash of their values. The
+// timestamps are not hashed, since they change at every evaluation.
+func hashResults(series []labels.Labels, samples []cortexpb.Sample) (seriesHash, valuesHash uint64) {
+	var (
+		seriesDigest = xxhash.New()
+		valuesDigest = xxhash.New()
+		buf          = make([]byte, 8)
+	)
+
+	for i, s := range series {
+		binary.LittleEndian.PutUint64(buf, s.Hash())
+		_, _ = seriesDigest.Write(buf)
+
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(samples[i].Value))
+		_, _ = valuesDigest.Write(buf)
+	}
+
+	return seriesDigest.Sum64(), valuesDigest.Sum64()
+}
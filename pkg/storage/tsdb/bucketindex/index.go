@@ -87,6 +87,13 @@ type Block struct {
 	// UploadedAt is a unix timestamp (seconds precision) of when the block has been completed to be uploaded
 	// to the storage.
 	UploadedAt int64 `json:"uploaded_at"`
+
+	// Source is the value of the block source external label, if any.
+	Source string `json:"source,omitempty"`
+
+	// IngesterID is the value of the ingester ID external label, set on the blocks
+	// shipped by the ingesters and removed once the blocks have been compacted.
+	IngesterID string `json:"ingester_id,omitempty"`
 }
 
 // Within returns whether the block contains samples within the provided range.
@@ -112,10 +119,8 @@ func (m *Block) ThanosMeta(userID string) *metadata.Meta {
 			Version: metadata.TSDBVersion1,
 		},
 		Thanos: metadata.Thanos{
-			Version: metadata.ThanosVersion1,
-			Labels: map[string]string{
-				cortex_tsdb.TenantIDExternalLabel: userID,
-			},
+			Version:      metadata.ThanosVersion1,
+			Labels:       m.thanosMetaLabels(userID),
 			SegmentFiles: m.thanosMetaSegmentFiles(),
 			IndexStats: metadata.IndexStats{
 				SeriesMaxSize: m.SeriesMaxSize,
@@ -125,6 +130,17 @@ func (m *Block) ThanosMeta(userID string) *metadata.Meta {
 	}
 }
 
+func (m *Block) thanosMetaLabels(userID string) map[string]string {
+	lbls := map[string]string{
+		cortex_tsdb.TenantIDExternalLabel: userID,
+	}
+	if m.Source != "" {
+		lbls[cortex_tsdb.BlockSourceExternalLabel] = m.Source
+	}
+
+	return lbls
+}
+
 func (m *Block) thanosMetaSegmentFiles() (files []string) {
 	if m.SegmentsFormat == SegmentsFormat1Based6Digits {
 		for i := 1; i <= m.SegmentsNum; i++ {
@@ -153,6 +169,8 @@ func BlockFromThanosMeta(meta metadata.Meta) *Block {
 		SegmentsNum:    segmentsNum,
 		SeriesMaxSize:  meta.Thanos.IndexStats.SeriesMaxSize,
 		ChunkMaxSize:   meta.Thanos.IndexStats.ChunkMaxSize,
+		Source:         meta.Thanos.Labels[cortex_tsdb.BlockSourceExternalLabel],
+		IngesterID:     meta.Thanos.Labels[cortex_tsdb.IngesterIDExternalLabel],
 	}
 }
 
@@ -26,6 +26,14 @@ const (
 	// set when shipping blocks to the storage.
 	IngesterIDExternalLabel = "__ingester_id__"
 
+	// BlockSourceExternalLabel is the external label containing the source of
+	// a block (ie. ingester, backfill), used to filter blocks at query time.
+	BlockSourceExternalLabel = "__block_source__"
+
+	// ShardExternalLabel is the external label containing the shard of a block (ie. 1_of_4),
+	// set when the ingester splits the blocks by series hash before shipping them to the storage.
+	ShardExternalLabel = "__shard__"
+
 	// How often are open TSDBs checked for being idle and closed.
 	DefaultCloseIdleTSDBInterval = 5 * time.Minute
 
@@ -41,17 +49,21 @@ const (
 
 // Validation errors
 var (
-	errInvalidShipConcurrency       = errors.New("invalid TSDB ship concurrency")
-	errInvalidOpeningConcurrency    = errors.New("invalid TSDB opening concurrency")
-	errInvalidCompactionInterval    = errors.New("invalid TSDB compaction interval")
-	errInvalidCompactionConcurrency = errors.New("invalid TSDB compaction concurrency")
-	errInvalidWALSegmentSizeBytes   = errors.New("invalid TSDB WAL segment size bytes")
-	errInvalidStripeSize            = errors.New("invalid TSDB stripe size")
-	errInvalidOutOfOrderCapMax      = errors.New("invalid TSDB OOO chunks capacity (in samples)")
-	errEmptyBlockranges             = errors.New("empty block ranges for TSDB")
+	errInvalidShipConcurrency        = errors.New("invalid TSDB ship concurrency")
+	errInvalidOpeningConcurrency     = errors.New("invalid TSDB opening concurrency")
+	errInvalidCompactionInterval     = errors.New("invalid TSDB compaction interval")
+	errInvalidCompactionConcurrency  = errors.New("invalid TSDB compaction concurrency")
+	errInvalidCompactionStagger      = errors.New("invalid TSDB compaction stagger period, it must be lower than half of the smallest block range")
+	errInvalidWALSegmentSizeBytes    = errors.New("invalid TSDB WAL segment size bytes")
+	errInvalidStripeSize             = errors.New("invalid TSDB stripe size")
+	errInvalidOutOfOrderCapMax       = errors.New("invalid TSDB OOO chunks capacity (in samples)")
+	errInvalidMemorySnapshotInterval = errors.New("invalid TSDB memory snapshot interval")
+	errMemorySnapshotNotLoaded       = errors.New("the TSDB memory snapshot interval requires the memory snapshot on shutdown to be enabled, since the snapshot is only loaded on startup when it's enabled")
+	errEmptyBlockranges              = errors.New("empty block ranges for TSDB")
 
 	ErrInvalidBucketIndexBlockDiscoveryStrategy = errors.New("bucket index block discovery strategy can only be enabled when bucket index is enabled")
 	ErrBlockDiscoveryStrategy                   = errors.New("invalid block discovery strategy")
+	errInvalidRecentBlocksLoadingStages         = errors.New("recent blocks loading stages must be greater than 0 and in increasing order")
 )
 
 // BlocksStorageConfig holds the config information for the blocks storage.
@@ -124,20 +136,21 @@ func (cfg *BlocksStorageConfig) Validate() error {
 //
 //nolint:revive
 type TSDBConfig struct {
-	Dir                       string        `yaml:"dir"`
-	BlockRanges               DurationList  `yaml:"block_ranges_period"`
-	Retention                 time.Duration `yaml:"retention_period"`
-	ShipInterval              time.Duration `yaml:"ship_interval"`
-	ShipConcurrency           int           `yaml:"ship_concurrency"`
-	HeadCompactionInterval    time.Duration `yaml:"head_compaction_interval"`
-	HeadCompactionConcurrency int           `yaml:"head_compaction_concurrency"`
-	HeadCompactionIdleTimeout time.Duration `yaml:"head_compaction_idle_timeout"`
-	HeadChunksWriteBufferSize int           `yaml:"head_chunks_write_buffer_size_bytes"`
-	StripeSize                int           `yaml:"stripe_size"`
-	WALCompressionEnabled     bool          `yaml:"wal_compression_enabled"`
-	WALSegmentSizeBytes       int           `yaml:"wal_segment_size_bytes"`
-	FlushBlocksOnShutdown     bool          `yaml:"flush_blocks_on_shutdown"`
-	CloseIdleTSDBTimeout      time.Duration `yaml:"close_idle_tsdb_timeout"`
+	Dir                         string        `yaml:"dir"`
+	BlockRanges                 DurationList  `yaml:"block_ranges_period"`
+	Retention                   time.Duration `yaml:"retention_period"`
+	ShipInterval                time.Duration `yaml:"ship_interval"`
+	ShipConcurrency             int           `yaml:"ship_concurrency"`
+	HeadCompactionInterval      time.Duration `yaml:"head_compaction_interval"`
+	HeadCompactionConcurrency   int           `yaml:"head_compaction_concurrency"`
+	HeadCompactionIdleTimeout   time.Duration `yaml:"head_compaction_idle_timeout"`
+	HeadCompactionStaggerPeriod time.Duration `yaml:"head_compaction_stagger_period"`
+	HeadChunksWriteBufferSize   int           `yaml:"head_chunks_write_buffer_size_bytes"`
+	StripeSize                  int           `yaml:"stripe_size"`
+	WALCompressionEnabled       bool          `yaml:"wal_compression_enabled"`
+	WALSegmentSizeBytes         int           `yaml:"wal_segment_size_bytes"`
+	FlushBlocksOnShutdown       bool          `yaml:"flush_blocks_on_shutdown"`
+	CloseIdleTSDBTimeout        time.Duration `yaml:"close_idle_tsdb_timeout"`
 	// The size of the in-memory queue used before flushing chunks to the disk.
 	HeadChunksWriteQueueSize int `yaml:"head_chunks_write_queue_size"`
 
@@ -157,6 +170,9 @@ type TSDBConfig struct {
 	// Enable snapshotting of in-memory TSDB data on disk when shutting down.
 	MemorySnapshotOnShutdown bool `yaml:"memory_snapshot_on_shutdown"`
 
+	// How frequently the in-memory TSDB data is snapshotted on disk. 0 to disable.
+	MemorySnapshotInterval time.Duration `yaml:"memory_snapshot_interval"`
+
 	// OutOfOrderCapMax is maximum capacity for OOO chunks (in samples).
 	OutOfOrderCapMax int64 `yaml:"out_of_order_cap_max"`
 }
@@ -176,6 +192,7 @@ func (cfg *TSDBConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.HeadCompactionInterval, "blocks-storage.tsdb.head-compaction-interval", 1*time.Minute, "How frequently does Cortex try to compact TSDB head. Block is only created if data covers smallest block range. Must be greater than 0 and max 30 minutes. Note that up to 50% jitter is added to the value for the first compaction to avoid ingesters compacting concurrently.")
 	f.IntVar(&cfg.HeadCompactionConcurrency, "blocks-storage.tsdb.head-compaction-concurrency", 5, "Maximum number of tenants concurrently compacting TSDB head into a new block")
 	f.DurationVar(&cfg.HeadCompactionIdleTimeout, "blocks-storage.tsdb.head-compaction-idle-timeout", 1*time.Hour, "If TSDB head is idle for this duration, it is compacted. Note that up to 25% jitter is added to the value to avoid ingesters compacting concurrently. 0 means disabled.")
+	f.DurationVar(&cfg.HeadCompactionStaggerPeriod, "blocks-storage.tsdb.head-compaction-stagger-period", 0, "[Experimental] If positive, the regular head compaction of each tenant is postponed by a per-tenant offset between 0 and this period, based on the time of the samples in the head, to spread the compactions of the tenants instead of compacting all of them at once. The forced and idle compactions aren't postponed. Must be lower than half of the smallest block range. 0 means disabled.")
 	f.IntVar(&cfg.HeadChunksWriteBufferSize, "blocks-storage.tsdb.head-chunks-write-buffer-size-bytes", chunks.DefaultWriteBufferSize, "The write buffer size used by the head chunks mapper. Lower values reduce memory utilisation on clusters with a large number of tenants at the cost of increased disk I/O operations.")
 	f.IntVar(&cfg.StripeSize, "blocks-storage.tsdb.stripe-size", 16384, "The number of shards of series to use in TSDB (must be a power of 2). Reducing this will decrease memory footprint, but can negatively impact performance.")
 	f.BoolVar(&cfg.WALCompressionEnabled, "blocks-storage.tsdb.wal-compression-enabled", false, "True to enable TSDB WAL compression.")
@@ -185,6 +202,7 @@ func (cfg *TSDBConfig) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.HeadChunksWriteQueueSize, "blocks-storage.tsdb.head-chunks-write-queue-size", chunks.DefaultWriteQueueSize, "The size of the in-memory queue used before flushing chunks to the disk.")
 	f.IntVar(&cfg.MaxExemplars, "blocks-storage.tsdb.max-exemplars", 0, "Deprecated, use maxExemplars in limits instead. If the MaxExemplars value in limits is set to zero, cortex will fallback on this value. This setting enables support for exemplars in TSDB and sets the maximum number that will be stored. 0 or less means disabled.")
 	f.BoolVar(&cfg.MemorySnapshotOnShutdown, "blocks-storage.tsdb.memory-snapshot-on-shutdown", false, "True to enable snapshotting of in-memory TSDB data on disk when shutting down.")
+	f.DurationVar(&cfg.MemorySnapshotInterval, "blocks-storage.tsdb.memory-snapshot-interval", 0, "[Experimental] How frequently the in-memory TSDB data is snapshotted on disk, so that on startup the ingester loads the last snapshot and replays only the WAL written since then, instead of the whole WAL. The pushes to a TSDB wait for its snapshot to complete. Requires -blocks-storage.tsdb.memory-snapshot-on-shutdown to be enabled, since the snapshot is only loaded on startup when it is. 0 to disable.")
 	f.Int64Var(&cfg.OutOfOrderCapMax, "blocks-storage.tsdb.out-of-order-cap-max", tsdb.DefaultOutOfOrderCapMax, "[EXPERIMENTAL] Configures the maximum number of samples per chunk that can be out-of-order.")
 }
 
@@ -226,6 +244,18 @@ func (cfg *TSDBConfig) Validate() error {
 		return errInvalidOutOfOrderCapMax
 	}
 
+	if cfg.HeadCompactionStaggerPeriod < 0 || cfg.HeadCompactionStaggerPeriod >= cfg.BlockRanges[0]/2 {
+		return errInvalidCompactionStagger
+	}
+
+	if cfg.MemorySnapshotInterval < 0 {
+		return errInvalidMemorySnapshotInterval
+	}
+
+	if cfg.MemorySnapshotInterval > 0 && !cfg.MemorySnapshotOnShutdown {
+		return errMemorySnapshotNotLoaded
+	}
+
 	return nil
 }
 
@@ -242,21 +272,25 @@ func (cfg *TSDBConfig) IsBlocksShippingEnabled() bool {
 
 // BucketStoreConfig holds the config information for Bucket Stores used by the querier and store-gateway.
 type BucketStoreConfig struct {
-	SyncDir                  string              `yaml:"sync_dir"`
-	SyncInterval             time.Duration       `yaml:"sync_interval"`
-	MaxConcurrent            int                 `yaml:"max_concurrent"`
-	MaxInflightRequests      int                 `yaml:"max_inflight_requests"`
-	TenantSyncConcurrency    int                 `yaml:"tenant_sync_concurrency"`
-	BlockSyncConcurrency     int                 `yaml:"block_sync_concurrency"`
-	MetaSyncConcurrency      int                 `yaml:"meta_sync_concurrency"`
-	ConsistencyDelay         time.Duration       `yaml:"consistency_delay"`
-	IndexCache               IndexCacheConfig    `yaml:"index_cache"`
-	ChunksCache              ChunksCacheConfig   `yaml:"chunks_cache"`
-	MetadataCache            MetadataCacheConfig `yaml:"metadata_cache"`
-	IgnoreDeletionMarksDelay time.Duration       `yaml:"ignore_deletion_mark_delay"`
-	IgnoreBlocksWithin       time.Duration       `yaml:"ignore_blocks_within"`
-	BucketIndex              BucketIndexConfig   `yaml:"bucket_index"`
-	BlockDiscoveryStrategy   string              `yaml:"block_discovery_strategy"`
+	SyncDir                    string              `yaml:"sync_dir"`
+	SyncInterval               time.Duration       `yaml:"sync_interval"`
+	MaxConcurrent              int                 `yaml:"max_concurrent"`
+	MaxInflightRequests        int                 `yaml:"max_inflight_requests"`
+	TenantSyncConcurrency      int                 `yaml:"tenant_sync_concurrency"`
+	BlockSyncConcurrency       int                 `yaml:"block_sync_concurrency"`
+	IndexHeaderLoadConcurrency int                 `yaml:"index_header_load_concurrency"`
+	MetaSyncConcurrency        int                 `yaml:"meta_sync_concurrency"`
+	ConsistencyDelay           time.Duration       `yaml:"consistency_delay"`
+	IndexCache                 IndexCacheConfig    `yaml:"index_cache"`
+	ChunksCache                ChunksCacheConfig   `yaml:"chunks_cache"`
+	MetadataCache              MetadataCacheConfig `yaml:"metadata_cache"`
+	IgnoreDeletionMarksDelay   time.Duration       `yaml:"ignore_deletion_mark_delay"`
+	IgnoreBlocksWithin         time.Duration       `yaml:"ignore_blocks_within"`
+	BucketIndex                BucketIndexConfig   `yaml:"bucket_index"`
+	BlockDiscoveryStrategy     string              `yaml:"block_discovery_strategy"`
+
+	// Controls the order blocks are loaded in, from the most recent to the oldest ones.
+	RecentBlocksLoadingStages DurationList `yaml:"recent_blocks_loading_stages"`
 
 	// Chunk pool.
 	MaxChunkPoolBytes           uint64 `yaml:"max_chunk_pool_bytes"`
@@ -267,6 +301,9 @@ type BucketStoreConfig struct {
 	IndexHeaderLazyLoadingEnabled     bool          `yaml:"index_header_lazy_loading_enabled"`
 	IndexHeaderLazyLoadingIdleTimeout time.Duration `yaml:"index_header_lazy_loading_idle_timeout"`
 
+	// Controls the eviction of the least recently queried tenants' bucket stores under memory pressure.
+	MemoryPressureEvictionThresholdBytes uint64 `yaml:"memory_pressure_eviction_threshold_bytes"`
+
 	// Controls whether lazy expanded posting optimization is enabled or not.
 	LazyExpandedPostingsEnabled bool `yaml:"lazy_expanded_postings_enabled"`
 
@@ -306,6 +343,7 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxInflightRequests, "blocks-storage.bucket-store.max-inflight-requests", 0, "Max number of inflight queries to execute against the long-term storage. The limit is shared across all tenants. 0 to disable.")
 	f.IntVar(&cfg.TenantSyncConcurrency, "blocks-storage.bucket-store.tenant-sync-concurrency", 10, "Maximum number of concurrent tenants syncing blocks.")
 	f.IntVar(&cfg.BlockSyncConcurrency, "blocks-storage.bucket-store.block-sync-concurrency", 20, "Maximum number of concurrent blocks syncing per tenant.")
+	f.IntVar(&cfg.IndexHeaderLoadConcurrency, "blocks-storage.bucket-store.index-header-load-concurrency", 0, "[Experimental] Maximum number of concurrent index-header loads while syncing blocks. The limit is shared across all tenants, and bounds the index-headers concurrently built from the blocks index in the long-term storage. The index-headers already on the local disk are not limited. 0 to disable the limit.")
 	f.IntVar(&cfg.MetaSyncConcurrency, "blocks-storage.bucket-store.meta-sync-concurrency", 20, "Number of Go routines to use when syncing block meta files from object storage per tenant.")
 	f.DurationVar(&cfg.ConsistencyDelay, "blocks-storage.bucket-store.consistency-delay", 0, "Minimum age of a block before it's being read. Set it to safe value (e.g 30m) if your object storage is eventually consistent. GCS and S3 are (roughly) strongly consistent.")
 	f.DurationVar(&cfg.IgnoreDeletionMarksDelay, "blocks-storage.bucket-store.ignore-deletion-marks-delay", time.Hour*6, "Duration after which the blocks marked for deletion will be filtered out while fetching blocks. "+
@@ -315,12 +353,14 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.PostingOffsetsInMemSampling, "blocks-storage.bucket-store.posting-offsets-in-mem-sampling", store.DefaultPostingOffsetInMemorySampling, "Controls what is the ratio of postings offsets that the store will hold in memory.")
 	f.BoolVar(&cfg.IndexHeaderLazyLoadingEnabled, "blocks-storage.bucket-store.index-header-lazy-loading-enabled", false, "If enabled, store-gateway will lazily memory-map an index-header only once required by a query.")
 	f.DurationVar(&cfg.IndexHeaderLazyLoadingIdleTimeout, "blocks-storage.bucket-store.index-header-lazy-loading-idle-timeout", 20*time.Minute, "If index-header lazy loading is enabled and this setting is > 0, the store-gateway will release memory-mapped index-headers after 'idle timeout' inactivity.")
+	f.Uint64Var(&cfg.MemoryPressureEvictionThresholdBytes, "blocks-storage.bucket-store.memory-pressure-eviction-threshold-bytes", 0, "[Experimental] If the in-use Go heap of the store-gateway exceeds this threshold, the store-gateway periodically unloads the index-headers of the tenant least recently queried, until the heap is below the threshold. The index-headers of an evicted tenant are loaded again from the local disk on its next query. 0 to disable.")
 	f.Uint64Var(&cfg.PartitionerMaxGapBytes, "blocks-storage.bucket-store.partitioner-max-gap-bytes", store.PartitionerMaxGapSize, "Max size - in bytes - of a gap for which the partitioner aggregates together two bucket GET object requests.")
 	f.Uint64Var(&cfg.EstimatedMaxSeriesSizeBytes, "blocks-storage.bucket-store.estimated-max-series-size-bytes", store.EstimatedMaxSeriesSize, "Estimated max series size in bytes. Setting a large value might result in over fetching data while a small value might result in data refetch. Default value is 64KB.")
 	f.Uint64Var(&cfg.EstimatedMaxChunkSizeBytes, "blocks-storage.bucket-store.estimated-max-chunk-size-bytes", store.EstimatedMaxChunkSize, "Estimated max chunk size in bytes. Setting a large value might result in over fetching data while a small value might result in data refetch. Default value is 16KiB.")
 	f.BoolVar(&cfg.LazyExpandedPostingsEnabled, "blocks-storage.bucket-store.lazy-expanded-postings-enabled", false, "If true, Store Gateway will estimate postings size and try to lazily expand postings if it downloads less data than expanding all postings.")
 	f.IntVar(&cfg.SeriesBatchSize, "blocks-storage.bucket-store.series-batch-size", store.SeriesBatchSize, "Controls how many series to fetch per batch in Store Gateway. Default value is 10000.")
 	f.StringVar(&cfg.BlockDiscoveryStrategy, "blocks-storage.bucket-store.block-discovery-strategy", string(ConcurrentDiscovery), "One of "+strings.Join(supportedBlockDiscoveryStrategies, ", ")+". When set to concurrent, stores will concurrently issue one call per directory to discover active blocks in the bucket. The recursive strategy iterates through all objects in the bucket, recursively traversing into each directory. This avoids N+1 calls at the expense of having slower bucket iterations. bucket_index strategy can be used in Compactor only and utilizes the existing bucket index to fetch block IDs to sync. This avoids iterating the bucket but can be impacted by delays of cleaner creating bucket index.")
+	f.Var(&cfg.RecentBlocksLoadingStages, "blocks-storage.bucket-store.recent-blocks-loading-stages", "[Experimental] Comma separated list of increasing block ages (e.g. 12h,48h,168h). When set, the store-gateway syncs blocks in stages, from the most recent to the oldest ones: each stage loads the blocks with data more recent than the stage age, and a final stage loads all remaining blocks. This lets queries on recent data recover faster after resharding, at the cost of fetching the blocks metadata once per stage on each sync. The initial sync on startup always loads all blocks at once. Empty to load all blocks at once.")
 }
 
 // Validate the config.
@@ -340,6 +380,11 @@ func (cfg *BucketStoreConfig) Validate() error {
 	if !util.StringsContain(supportedBlockDiscoveryStrategies, cfg.BlockDiscoveryStrategy) {
 		return ErrInvalidBucketIndexBlockDiscoveryStrategy
 	}
+	for i, stage := range cfg.RecentBlocksLoadingStages {
+		if stage <= 0 || (i > 0 && stage <= cfg.RecentBlocksLoadingStages[i-1]) {
+			return errInvalidRecentBlocksLoadingStages
+		}
+	}
 	return nil
 }
 
@@ -121,6 +121,54 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errInvalidOutOfOrderCapMax,
 		},
+		"should pass on compaction stagger period lower than half of the block range": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.HeadCompactionStaggerPeriod = 30 * time.Minute
+			},
+			expectedErr: nil,
+		},
+		"should fail on compaction stagger period greater than half of the block range": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.HeadCompactionStaggerPeriod = time.Hour
+			},
+			expectedErr: errInvalidCompactionStagger,
+		},
+		"should fail on negative memory snapshot interval": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.MemorySnapshotInterval = -time.Minute
+			},
+			expectedErr: errInvalidMemorySnapshotInterval,
+		},
+		"should fail on memory snapshot interval without the memory snapshot on shutdown": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.MemorySnapshotInterval = time.Minute
+			},
+			expectedErr: errMemorySnapshotNotLoaded,
+		},
+		"should pass on memory snapshot interval with the memory snapshot on shutdown": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.MemorySnapshotInterval = time.Minute
+				cfg.TSDB.MemorySnapshotOnShutdown = true
+			},
+		},
+		"should pass on increasing recent blocks loading stages": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.RecentBlocksLoadingStages = DurationList{12 * time.Hour, 48 * time.Hour}
+			},
+			expectedErr: nil,
+		},
+		"should fail on non increasing recent blocks loading stages": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.RecentBlocksLoadingStages = DurationList{48 * time.Hour, 12 * time.Hour}
+			},
+			expectedErr: errInvalidRecentBlocksLoadingStages,
+		},
+		"should fail on zero recent blocks loading stage": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.RecentBlocksLoadingStages = DurationList{0}
+			},
+			expectedErr: errInvalidRecentBlocksLoadingStages,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -53,6 +53,8 @@ type IndexCacheConfig struct {
 	Memcached  MemcachedIndexCacheConfig  `yaml:"memcached"`
 	Redis      RedisIndexCacheConfig      `yaml:"redis"`
 	MultiLevel MultiLevelIndexCacheConfig `yaml:"multilevel"`
+
+	TiersReservedSizeBytes IndexCacheTierSizes `yaml:"tiers_reserved_size_bytes"`
 }
 
 func (cfg *IndexCacheConfig) RegisterFlags(f *flag.FlagSet) {
@@ -69,6 +71,9 @@ func (cfg *IndexCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix str
 	cfg.Memcached.RegisterFlagsWithPrefix(f, prefix+"memcached.")
 	cfg.Redis.RegisterFlagsWithPrefix(f, prefix+"redis.")
 	cfg.MultiLevel.RegisterFlagsWithPrefix(f, prefix+"multilevel.")
+
+	cfg.TiersReservedSizeBytes = IndexCacheTierSizes{}
+	f.Var(&cfg.TiersReservedSizeBytes, prefix+"tiers-reserved-size-bytes", "[Experimental] Index cache capacity in bytes reserved to each tenant tier, as a JSON map from the tier name to the size. The tenants are assigned to a tier with the store_gateway_index_cache_tier limit. Each tier gets a dedicated in-memory partition, in front of the configured index cache backends, which can't be evicted by tenants of other tiers. Tenants without a tier, or with a tier not listed here, only use the configured index cache backends.")
 }
 
 // Validate the config.
@@ -155,20 +160,25 @@ func (cfg *InMemoryIndexCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, pr
 }
 
 type MemcachedIndexCacheConfig struct {
-	ClientConfig MemcachedClientConfig `yaml:",inline"`
-	EnabledItems []string              `yaml:"enabled_items"`
+	ClientConfig MemcachedClientConfig    `yaml:",inline"`
+	EnabledItems []string                 `yaml:"enabled_items"`
+	Fallback     IndexCacheFallbackConfig `yaml:"fallback"`
 }
 
 func (cfg *MemcachedIndexCacheConfig) Validate() error {
 	if err := cfg.ClientConfig.Validate(); err != nil {
 		return err
 	}
+	if err := cfg.Fallback.Validate(); err != nil {
+		return err
+	}
 	return storecache.ValidateEnabledItems(cfg.EnabledItems)
 }
 
 func (cfg *MemcachedIndexCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
 	cfg.ClientConfig.RegisterFlagsWithPrefix(f, prefix)
 	f.Var((*flagext.StringSlice)(&cfg.EnabledItems), prefix+"enabled-items", "Selectively cache index item types. Supported values are Postings, ExpandedPostings and Series")
+	cfg.Fallback.RegisterFlagsWithPrefix(f, prefix)
 }
 
 type RedisIndexCacheConfig struct {
@@ -217,6 +227,9 @@ func NewIndexCache(cfg IndexCacheConfig, logger log.Logger, registerer prometheu
 			if err != nil {
 				return nil, err
 			}
+			if cfg.Memcached.Fallback.Enabled {
+				c = newFallbackCacheClient(c, cfg.Memcached.Fallback, logger, iReg)
+			}
 			// TODO(yeya24): expose TTL
 			cache, err := storecache.NewRemoteIndexCache(logger, c, nil, iReg, defaultTTL)
 			if err != nil {
@@ -0,0 +1,162 @@
+package tsdb
+
+import (
+	"context"
+	"flag"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/thanos/pkg/cacheutil"
+	"golang.org/x/time/rate"
+)
+
+var (
+	errInvalidFallbackConsecutiveFailures = errors.New("invalid index cache fallback consecutive_failures, must greater than 0")
+	errInvalidFallbackBypassDuration      = errors.New("invalid index cache fallback bypass_duration, must greater than 0")
+	errInvalidFallbackMaxBypassedRate     = errors.New("invalid index cache fallback max_bypassed_requests_rate, must not be negative")
+)
+
+// IndexCacheFallbackConfig configures the fallback read path used while the remote index cache is
+// unavailable: the cache is bypassed, and the index is read from the object storage at a limited rate.
+type IndexCacheFallbackConfig struct {
+	Enabled                 bool          `yaml:"enabled"`
+	ConsecutiveFailures     int           `yaml:"consecutive_failures"`
+	BypassDuration          time.Duration `yaml:"bypass_duration"`
+	MaxBypassedRequestsRate float64       `yaml:"max_bypassed_requests_rate"`
+}
+
+func (cfg *IndexCacheFallbackConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.BoolVar(&cfg.Enabled, prefix+"fallback.enabled", false, "[Experimental] If true, the index cache is bypassed while it's unavailable, and the index is read from the object storage instead, at a rate limited by max-bypassed-requests-rate.")
+	f.IntVar(&cfg.ConsecutiveFailures, prefix+"fallback.consecutive-failures", 5, "[Experimental] Number of consecutive failed index cache lookups after which the index cache is considered unavailable.")
+	f.DurationVar(&cfg.BypassDuration, prefix+"fallback.bypass-duration", 30*time.Second, "[Experimental] How long the index cache is bypassed once considered unavailable, before being tried again.")
+	f.Float64Var(&cfg.MaxBypassedRequestsRate, prefix+"fallback.max-bypassed-requests-rate", 100, "[Experimental] Maximum per-second rate of index cache lookups bypassing the index cache, and so reading from the object storage, while it's unavailable. Lookups above the rate are delayed, and the ones which can't be allowed before the request deadline fail the request. 0 to disable the limit.")
+}
+
+func (cfg *IndexCacheFallbackConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.ConsecutiveFailures <= 0 {
+		return errInvalidFallbackConsecutiveFailures
+	}
+	if cfg.BypassDuration <= 0 {
+		return errInvalidFallbackBypassDuration
+	}
+	if cfg.MaxBypassedRequestsRate < 0 {
+		return errInvalidFallbackMaxBypassedRate
+	}
+	return nil
+}
+
+// fallbackCacheClient wraps a remote cache client, bypassing it while it's unavailable. The
+// cache is considered unavailable after a number of consecutive failed lookups, which the
+// wrapped client reports by returning a nil map.
+type fallbackCacheClient struct {
+	cacheutil.RemoteCacheClient
+
+	cfg     IndexCacheFallbackConfig
+	limiter *rate.Limiter
+	logger  log.Logger
+
+	mtx         sync.Mutex
+	failures    int
+	bypassUntil time.Time
+
+	bypassedRequests prometheus.Counter
+}
+
+func newFallbackCacheClient(c cacheutil.RemoteCacheClient, cfg IndexCacheFallbackConfig, logger log.Logger, reg prometheus.Registerer) *fallbackCacheClient {
+	f := &fallbackCacheClient{
+		RemoteCacheClient: c,
+		cfg:               cfg,
+		logger:            logger,
+		bypassedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_store_index_cache_bypassed_requests_total",
+			Help: "Total number of index cache lookups which bypassed the index cache because it was unavailable.",
+		}),
+	}
+	if cfg.MaxBypassedRequestsRate > 0 {
+		f.limiter = rate.NewLimiter(rate.Limit(cfg.MaxBypassedRequestsRate), int(math.Max(1, math.Ceil(cfg.MaxBypassedRequestsRate))))
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_store_index_cache_unavailable",
+		Help: "Whether the index cache is considered unavailable and bypassed (1) or not (0).",
+	}, func() float64 {
+		if f.bypassing() {
+			return 1
+		}
+		return 0
+	})
+	return f
+}
+
+// GetMulti implements cacheutil.RemoteCacheClient.
+func (c *fallbackCacheClient) GetMulti(ctx context.Context, keys []string) map[string][]byte {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if c.bypassing() {
+		c.bypassedRequests.Inc()
+		// The missing items are read from the object storage by the caller, so the lookups
+		// are throttled to not overload it. The wait fails straight away if the context is
+		// done before the lookup is allowed, in which case the lookup is held until the context
+		// is done, so that the caller fails to read the object storage instead of exceeding
+		// the rate.
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				<-ctx.Done()
+			}
+		}
+		return nil
+	}
+
+	hits := c.RemoteCacheClient.GetMulti(ctx, keys)
+	// A lookup failing because the request is canceled doesn't tell about the cache availability.
+	if ctx.Err() == nil {
+		c.trackLookup(hits != nil)
+	}
+	return hits
+}
+
+// SetAsync implements cacheutil.RemoteCacheClient.
+func (c *fallbackCacheClient) SetAsync(key string, value []byte, ttl time.Duration) error {
+	if c.bypassing() {
+		return nil
+	}
+	return c.RemoteCacheClient.SetAsync(key, value, ttl)
+}
+
+func (c *fallbackCacheClient) bypassing() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return time.Now().Before(c.bypassUntil)
+}
+
+// trackLookup records the outcome of a lookup, starting to bypass the cache if too many lookups
+// failed in a row. The failures aren't reset when the cache starts being bypassed, so that the
+// first lookup failing once the bypass is over starts bypassing the cache again.
+func (c *fallbackCacheClient) trackLookup(ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if ok {
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.failures < c.cfg.ConsecutiveFailures {
+		return
+	}
+	if now := time.Now(); !now.Before(c.bypassUntil) {
+		c.bypassUntil = now.Add(c.cfg.BypassDuration)
+		level.Warn(c.logger).Log("msg", "index cache is unavailable, bypassing it", "failures", c.failures, "duration", c.cfg.BypassDuration)
+	}
+}
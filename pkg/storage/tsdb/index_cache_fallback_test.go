@@ -0,0 +1,206 @@
+package tsdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexCacheFallbackConfig_Validate(t *testing.T) {
+	valid := IndexCacheFallbackConfig{Enabled: true, ConsecutiveFailures: 5, BypassDuration: time.Second, MaxBypassedRequestsRate: 10}
+	require.NoError(t, valid.Validate())
+
+	for name, tc := range map[string]struct {
+		cfg      func(cfg *IndexCacheFallbackConfig)
+		expected error
+	}{
+		"disabled": {
+			cfg: func(cfg *IndexCacheFallbackConfig) {
+				cfg.Enabled = false
+				cfg.ConsecutiveFailures = 0
+			},
+		},
+		"no consecutive failures": {
+			cfg:      func(cfg *IndexCacheFallbackConfig) { cfg.ConsecutiveFailures = 0 },
+			expected: errInvalidFallbackConsecutiveFailures,
+		},
+		"no bypass duration": {
+			cfg:      func(cfg *IndexCacheFallbackConfig) { cfg.BypassDuration = 0 },
+			expected: errInvalidFallbackBypassDuration,
+		},
+		"negative rate": {
+			cfg:      func(cfg *IndexCacheFallbackConfig) { cfg.MaxBypassedRequestsRate = -1 },
+			expected: errInvalidFallbackMaxBypassedRate,
+		},
+		"unlimited rate": {
+			cfg: func(cfg *IndexCacheFallbackConfig) { cfg.MaxBypassedRequestsRate = 0 },
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid
+			tc.cfg(&cfg)
+			assert.Equal(t, tc.expected, cfg.Validate())
+		})
+	}
+}
+
+func TestFallbackCacheClient(t *testing.T) {
+	remote := &mockRemoteCacheClient{}
+	reg := prometheus.NewPedanticRegistry()
+	c := newFallbackCacheClient(remote, IndexCacheFallbackConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 2,
+		BypassDuration:      200 * time.Millisecond,
+	}, log.NewNopLogger(), reg)
+
+	ctx := context.Background()
+	keys := []string{"a", "b"}
+
+	// A failure followed by a successful lookup doesn't make the cache unavailable.
+	remote.available = false
+	assert.Nil(t, c.GetMulti(ctx, keys))
+	remote.available = true
+	assert.Equal(t, map[string][]byte{"a": []byte("a")}, c.GetMulti(ctx, keys))
+	remote.available = false
+	assert.Nil(t, c.GetMulti(ctx, keys))
+	assert.Equal(t, 3, remote.lookups)
+
+	// A lookup failing because the request is canceled isn't tracked.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Nil(t, c.GetMulti(canceled, keys))
+	assert.False(t, c.bypassing())
+
+	// The cache is bypassed after the consecutive failures.
+	assert.Nil(t, c.GetMulti(ctx, keys))
+	assert.True(t, c.bypassing())
+	assert.Equal(t, 5, remote.lookups)
+
+	remote.available = true
+	assert.Nil(t, c.GetMulti(ctx, keys))
+	require.NoError(t, c.SetAsync("a", []byte("a"), time.Minute))
+	assert.Equal(t, 5, remote.lookups)
+	assert.Equal(t, 0, remote.stores)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_store_index_cache_bypassed_requests_total Total number of index cache lookups which bypassed the index cache because it was unavailable.
+		# TYPE cortex_store_index_cache_bypassed_requests_total counter
+		cortex_store_index_cache_bypassed_requests_total 1
+		# HELP cortex_store_index_cache_unavailable Whether the index cache is considered unavailable and bypassed (1) or not (0).
+		# TYPE cortex_store_index_cache_unavailable gauge
+		cortex_store_index_cache_unavailable 1
+	`)))
+
+	// The cache is used again once the bypass is over.
+	require.Eventually(t, func() bool { return !c.bypassing() }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string][]byte{"a": []byte("a")}, c.GetMulti(ctx, keys))
+	require.NoError(t, c.SetAsync("a", []byte("a"), time.Minute))
+	assert.Equal(t, 6, remote.lookups)
+	assert.Equal(t, 1, remote.stores)
+}
+
+func TestFallbackCacheClient_ShouldBypassAgainIfTheCacheIsStillUnavailable(t *testing.T) {
+	remote := &mockRemoteCacheClient{}
+	c := newFallbackCacheClient(remote, IndexCacheFallbackConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 3,
+		BypassDuration:      100 * time.Millisecond,
+	}, log.NewNopLogger(), nil)
+
+	for i := 0; i < 3; i++ {
+		c.GetMulti(context.Background(), []string{"a"})
+	}
+	require.True(t, c.bypassing())
+
+	// A single failed lookup once the bypass is over is enough to bypass the cache again.
+	require.Eventually(t, func() bool { return !c.bypassing() }, time.Second, 10*time.Millisecond)
+	c.GetMulti(context.Background(), []string{"a"})
+	assert.True(t, c.bypassing())
+	assert.Equal(t, 4, remote.lookups)
+}
+
+func TestFallbackCacheClient_ShouldRateLimitBypassedLookups(t *testing.T) {
+	remote := &mockRemoteCacheClient{}
+	c := newFallbackCacheClient(remote, IndexCacheFallbackConfig{
+		Enabled:                 true,
+		ConsecutiveFailures:     1,
+		BypassDuration:          time.Minute,
+		MaxBypassedRequestsRate: 10,
+	}, log.NewNopLogger(), nil)
+
+	c.GetMulti(context.Background(), []string{"a"})
+	require.True(t, c.bypassing())
+
+	// The bypassed lookups within the burst aren't delayed.
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		c.GetMulti(context.Background(), []string{"a"})
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// The next ones are delayed to honor the rate.
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		c.GetMulti(context.Background(), []string{"a"})
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, 1, remote.lookups)
+}
+
+func TestFallbackCacheClient_ShouldHoldTheBypassedLookupsNotAllowedBeforeTheContextDeadline(t *testing.T) {
+	remote := &mockRemoteCacheClient{}
+	c := newFallbackCacheClient(remote, IndexCacheFallbackConfig{
+		Enabled:                 true,
+		ConsecutiveFailures:     1,
+		BypassDuration:          time.Minute,
+		MaxBypassedRequestsRate: 1,
+	}, log.NewNopLogger(), nil)
+
+	c.GetMulti(context.Background(), []string{"a"})
+	require.True(t, c.bypassing())
+	c.GetMulti(context.Background(), []string{"a"})
+
+	// The next lookup is only allowed in a second, after the context deadline, so it's held
+	// until the context is done rather than returned straight away.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, c.GetMulti(ctx, []string{"a"}))
+	assert.Error(t, ctx.Err())
+	assert.Equal(t, 1, remote.lookups)
+}
+
+// mockRemoteCacheClient returns the looked up keys equal to "a" if available, or a nil map
+// like the memcached client does on failures.
+type mockRemoteCacheClient struct {
+	available bool
+	lookups   int
+	stores    int
+}
+
+func (m *mockRemoteCacheClient) GetMulti(_ context.Context, keys []string) map[string][]byte {
+	m.lookups++
+	if !m.available {
+		return nil
+	}
+	hits := map[string][]byte{}
+	for _, k := range keys {
+		if k == "a" {
+			hits[k] = []byte(k)
+		}
+	}
+	return hits
+}
+
+func (m *mockRemoteCacheClient) SetAsync(string, []byte, time.Duration) error {
+	m.stores++
+	return nil
+}
+
+func (m *mockRemoteCacheClient) Stop() {}
@@ -0,0 +1,341 @@
+package tsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	storecache "github.com/thanos-io/thanos/pkg/store/cache"
+)
+
+// IndexCacheTierSizes is the index cache capacity, in bytes, reserved to each tenant tier.
+type IndexCacheTierSizes map[string]uint64
+
+// String implements flag.Value
+func (s IndexCacheTierSizes) String() string {
+	out, err := json.Marshal(map[string]uint64(s))
+	if err != nil {
+		return fmt.Sprintf("failed to marshal: %v", err)
+	}
+	return string(out)
+}
+
+// Set implements flag.Value
+func (s IndexCacheTierSizes) Set(v string) error {
+	newSizes := map[string]uint64{}
+	return s.update(json.Unmarshal([]byte(v), &newSizes), newSizes)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s IndexCacheTierSizes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	newSizes := map[string]uint64{}
+	return s.update(unmarshal(newSizes), newSizes)
+}
+
+func (s IndexCacheTierSizes) update(unmarshalErr error, newSizes map[string]uint64) error {
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	for tier, size := range newSizes {
+		if tier == "" {
+			return errors.New("the index cache tier name must not be empty")
+		}
+		if size == 0 {
+			return errors.Errorf("the reserved index cache size of tier %s must be greater than 0", tier)
+		}
+		s[tier] = size
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (s IndexCacheTierSizes) MarshalYAML() (interface{}, error) {
+	return map[string]uint64(s), nil
+}
+
+// IndexCacheTierLimits are the per-tenant limits used by the TieredIndexCache.
+type IndexCacheTierLimits interface {
+	// StoreGatewayIndexCacheTier returns the index cache tier of the tenant. Empty = no tier.
+	StoreGatewayIndexCacheTier(userID string) string
+}
+
+type tieredIndexCacheMetrics struct {
+	hits      *prometheus.CounterVec
+	misses    *prometheus.CounterVec
+	evictions *prometheus.CounterVec
+	sizeBytes *prometheus.GaugeVec
+}
+
+// TieredIndexCache reserves index cache capacity to tenant tiers. Each tier gets a dedicated
+// in-memory LRU partition, so that its entries can't be evicted by the tenants of other tiers.
+// The partitions sit in front of the configured index cache, which is still populated and
+// looked up on partition misses.
+type TieredIndexCache struct {
+	cache  storecache.IndexCache
+	limits IndexCacheTierLimits
+	tiers  map[string]*tierIndexCache
+}
+
+// NewTieredIndexCache makes a new TieredIndexCache in front of the given index cache.
+func NewTieredIndexCache(cache storecache.IndexCache, sizes IndexCacheTierSizes, limits IndexCacheTierLimits, logger log.Logger, reg prometheus.Registerer) (*TieredIndexCache, error) {
+	metrics := tieredIndexCacheMetrics{
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_index_cache_tier_hits_total",
+			Help: "Total number of index cache requests served by the partition reserved to the tenant tier.",
+		}, []string{"tier", "item_type"}),
+		misses: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_index_cache_tier_misses_total",
+			Help: "Total number of index cache requests not found in the partition reserved to the tenant tier.",
+		}, []string{"tier", "item_type"}),
+		evictions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_index_cache_tier_evictions_total",
+			Help: "Total number of items evicted from the partition reserved to the tenant tier.",
+		}, []string{"tier", "item_type"}),
+		sizeBytes: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_bucket_store_index_cache_tier_size_bytes",
+			Help: "Current size in bytes of the partition reserved to the tenant tier.",
+		}, []string{"tier"}),
+	}
+
+	c := &TieredIndexCache{
+		cache:  cache,
+		limits: limits,
+		tiers:  make(map[string]*tierIndexCache, len(sizes)),
+	}
+
+	for tier, size := range sizes {
+		t, err := newTierIndexCache(tier, size, metrics)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create index cache partition for tier %s", tier)
+		}
+		c.tiers[tier] = t
+
+		level.Info(logger).Log("msg", "created index cache partition", "tier", tier, "maxSizeBytes", size)
+	}
+
+	return c, nil
+}
+
+// ForTenant returns the index cache to use for the given tenant. The tier of the tenant is looked
+// up at every request, so that runtime changes are honored.
+func (c *TieredIndexCache) ForTenant(userID string) storecache.IndexCache {
+	return &tenantTieredIndexCache{parent: c, userID: userID}
+}
+
+// tenantTieredIndexCache is the index cache of a single tenant. It uses the partition reserved
+// to the tenant tier, if any, in front of the shared index cache.
+type tenantTieredIndexCache struct {
+	parent *TieredIndexCache
+	userID string
+}
+
+func (c *tenantTieredIndexCache) tier() *tierIndexCache {
+	return c.parent.tiers[c.parent.limits.StoreGatewayIndexCacheTier(c.userID)]
+}
+
+// StorePostings implements storecache.IndexCache.
+func (c *tenantTieredIndexCache) StorePostings(blockID ulid.ULID, l labels.Label, v []byte, tenant string) {
+	if t := c.tier(); t != nil {
+		t.set(cacheTypePostings, storecache.CacheKey{Block: blockID.String(), Key: copyToKey(l)}, v)
+	}
+	c.parent.cache.StorePostings(blockID, l, v, tenant)
+}
+
+// FetchMultiPostings implements storecache.IndexCache.
+func (c *tenantTieredIndexCache) FetchMultiPostings(ctx context.Context, blockID ulid.ULID, keys []labels.Label, tenant string) (map[labels.Label][]byte, []labels.Label) {
+	t := c.tier()
+	if t == nil {
+		return c.parent.cache.FetchMultiPostings(ctx, blockID, keys, tenant)
+	}
+
+	hits := map[labels.Label][]byte{}
+	blockIDKey := blockID.String()
+
+	var missing []labels.Label
+	for _, key := range keys {
+		if b, ok := t.get(cacheTypePostings, storecache.CacheKey{Block: blockIDKey, Key: storecache.CacheKeyPostings(key)}); ok {
+			hits[key] = b
+			continue
+		}
+		missing = append(missing, key)
+	}
+	if len(missing) == 0 {
+		return hits, nil
+	}
+
+	sharedHits, misses := c.parent.cache.FetchMultiPostings(ctx, blockID, missing, tenant)
+	for key, b := range sharedHits {
+		hits[key] = b
+		t.set(cacheTypePostings, storecache.CacheKey{Block: blockIDKey, Key: copyToKey(key)}, b)
+	}
+	return hits, misses
+}
+
+// StoreExpandedPostings implements storecache.IndexCache.
+func (c *tenantTieredIndexCache) StoreExpandedPostings(blockID ulid.ULID, matchers []*labels.Matcher, v []byte, tenant string) {
+	if t := c.tier(); t != nil {
+		t.set(cacheTypeExpandedPostings, storecache.CacheKey{Block: blockID.String(), Key: storecache.CacheKeyExpandedPostings(storecache.LabelMatchersToString(matchers))}, v)
+	}
+	c.parent.cache.StoreExpandedPostings(blockID, matchers, v, tenant)
+}
+
+// FetchExpandedPostings implements storecache.IndexCache.
+func (c *tenantTieredIndexCache) FetchExpandedPostings(ctx context.Context, blockID ulid.ULID, matchers []*labels.Matcher, tenant string) ([]byte, bool) {
+	t := c.tier()
+	if t == nil {
+		return c.parent.cache.FetchExpandedPostings(ctx, blockID, matchers, tenant)
+	}
+
+	key := storecache.CacheKey{Block: blockID.String(), Key: storecache.CacheKeyExpandedPostings(storecache.LabelMatchersToString(matchers))}
+	if b, ok := t.get(cacheTypeExpandedPostings, key); ok {
+		return b, true
+	}
+
+	b, ok := c.parent.cache.FetchExpandedPostings(ctx, blockID, matchers, tenant)
+	if ok {
+		t.set(cacheTypeExpandedPostings, key, b)
+	}
+	return b, ok
+}
+
+// StoreSeries implements storecache.IndexCache.
+func (c *tenantTieredIndexCache) StoreSeries(blockID ulid.ULID, id storage.SeriesRef, v []byte, tenant string) {
+	if t := c.tier(); t != nil {
+		t.set(cacheTypeSeries, storecache.CacheKey{Block: blockID.String(), Key: storecache.CacheKeySeries(id)}, v)
+	}
+	c.parent.cache.StoreSeries(blockID, id, v, tenant)
+}
+
+// FetchMultiSeries implements storecache.IndexCache.
+func (c *tenantTieredIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid.ULID, ids []storage.SeriesRef, tenant string) (map[storage.SeriesRef][]byte, []storage.SeriesRef) {
+	t := c.tier()
+	if t == nil {
+		return c.parent.cache.FetchMultiSeries(ctx, blockID, ids, tenant)
+	}
+
+	hits := map[storage.SeriesRef][]byte{}
+	blockIDKey := blockID.String()
+
+	var missing []storage.SeriesRef
+	for _, id := range ids {
+		if b, ok := t.get(cacheTypeSeries, storecache.CacheKey{Block: blockIDKey, Key: storecache.CacheKeySeries(id)}); ok {
+			hits[id] = b
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return hits, nil
+	}
+
+	sharedHits, misses := c.parent.cache.FetchMultiSeries(ctx, blockID, missing, tenant)
+	for id, b := range sharedHits {
+		hits[id] = b
+		t.set(cacheTypeSeries, storecache.CacheKey{Block: blockIDKey, Key: storecache.CacheKeySeries(id)}, b)
+	}
+	return hits, misses
+}
+
+// tierIndexCache is the size-bounded LRU partition reserved to a tenant tier.
+type tierIndexCache struct {
+	maxSizeBytes uint64
+
+	hits      *prometheus.CounterVec
+	misses    *prometheus.CounterVec
+	evictions *prometheus.CounterVec
+	sizeBytes prometheus.Gauge
+
+	mtx          sync.Mutex
+	lru          *simplelru.LRU[storecache.CacheKey, []byte]
+	curSizeBytes uint64
+}
+
+func newTierIndexCache(tier string, maxSizeBytes uint64, metrics tieredIndexCacheMetrics) (*tierIndexCache, error) {
+	t := &tierIndexCache{
+		maxSizeBytes: maxSizeBytes,
+		hits:         metrics.hits.MustCurryWith(prometheus.Labels{"tier": tier}),
+		misses:       metrics.misses.MustCurryWith(prometheus.Labels{"tier": tier}),
+		evictions:    metrics.evictions.MustCurryWith(prometheus.Labels{"tier": tier}),
+		sizeBytes:    metrics.sizeBytes.WithLabelValues(tier),
+	}
+
+	for _, typ := range []string{cacheTypePostings, cacheTypeSeries, cacheTypeExpandedPostings} {
+		t.hits.WithLabelValues(typ)
+		t.misses.WithLabelValues(typ)
+		t.evictions.WithLabelValues(typ)
+	}
+
+	// The LRU is bounded by size in bytes, not by number of items.
+	lru, err := simplelru.NewLRU[storecache.CacheKey, []byte](math.MaxInt, t.onEvict)
+	if err != nil {
+		return nil, err
+	}
+	t.lru = lru
+
+	return t, nil
+}
+
+func (t *tierIndexCache) get(typ string, key storecache.CacheKey) ([]byte, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	v, ok := t.lru.Get(key)
+	if !ok {
+		t.misses.WithLabelValues(typ).Inc()
+		return nil, false
+	}
+	t.hits.WithLabelValues(typ).Inc()
+	return v, true
+}
+
+func (t *tierIndexCache) set(typ string, key storecache.CacheKey, val []byte) {
+	size := entrySize(key, val)
+	if size > t.maxSizeBytes {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.lru.Contains(key) {
+		return
+	}
+
+	for t.curSizeBytes+size > t.maxSizeBytes {
+		if _, _, ok := t.lru.RemoveOldest(); !ok {
+			break
+		}
+	}
+
+	// The caller may be passing in a sub-slice of a huge array. Copy the data
+	// to ensure we don't waste huge amounts of space for something small.
+	v := make([]byte, len(val))
+	copy(v, val)
+	t.lru.Add(key, v)
+
+	t.curSizeBytes += size
+	t.sizeBytes.Set(float64(t.curSizeBytes))
+}
+
+// onEvict is called by the LRU with the lock held.
+func (t *tierIndexCache) onEvict(key storecache.CacheKey, val []byte) {
+	t.evictions.WithLabelValues(key.KeyType()).Inc()
+	t.curSizeBytes -= entrySize(key, val)
+	t.sizeBytes.Set(float64(t.curSizeBytes))
+}
+
+func entrySize(key storecache.CacheKey, val []byte) uint64 {
+	return key.Size() + uint64(len(val))
+}
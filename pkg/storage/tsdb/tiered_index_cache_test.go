@@ -0,0 +1,139 @@
+package tsdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	storecache "github.com/thanos-io/thanos/pkg/store/cache"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestIndexCacheTierSizes_Set(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected IndexCacheTierSizes
+		err      string
+	}{
+		"should parse valid sizes": {
+			input:    `{"premium": 1024, "standard": 512}`,
+			expected: IndexCacheTierSizes{"premium": 1024, "standard": 512},
+		},
+		"should fail on empty tier name": {
+			input: `{"": 1024}`,
+			err:   "the index cache tier name must not be empty",
+		},
+		"should fail on zero size": {
+			input: `{"premium": 0}`,
+			err:   "the reserved index cache size of tier premium must be greater than 0",
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			sizes := IndexCacheTierSizes{}
+			err := sizes.Set(testData.input)
+			if testData.err != "" {
+				assert.EqualError(t, err, testData.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, sizes)
+		})
+	}
+}
+
+func TestTieredIndexCache(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	shared, err := newInMemoryIndexCache(InMemoryIndexCacheConfig{MaxSizeBytes: 1024 * 1024}, log.NewNopLogger(), prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	limits := tierLimits{"user-premium": "premium", "user-unknown-tier": "unknown"}
+	cache, err := NewTieredIndexCache(shared, IndexCacheTierSizes{"premium": 1024}, limits, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+
+	blockID := ulid.MustNew(1, nil)
+	lbl := labels.Label{Name: "foo", Value: "bar"}
+	ctx := context.Background()
+
+	// Tenants without a reserved tier only use the shared cache.
+	for _, userID := range []string{"user-free", "user-unknown-tier"} {
+		cache.ForTenant(userID).StorePostings(blockID, lbl, []byte("free"), tenancy.DefaultTenant)
+	}
+	assert.Equal(t, 0.0, prom_testutil.ToFloat64(cache.tiers["premium"].sizeBytes))
+
+	// Premium tenants find the entries of the shared cache, and keep them in their partition.
+	premium := cache.ForTenant("user-premium")
+	hits, misses := premium.FetchMultiPostings(ctx, blockID, []labels.Label{lbl, {Name: "foo", Value: "baz"}}, tenancy.DefaultTenant)
+	assert.Equal(t, map[labels.Label][]byte{lbl: []byte("free")}, hits)
+	assert.Equal(t, []labels.Label{{Name: "foo", Value: "baz"}}, misses)
+
+	hits, misses = premium.FetchMultiPostings(ctx, blockID, []labels.Label{lbl}, tenancy.DefaultTenant)
+	assert.Equal(t, map[labels.Label][]byte{lbl: []byte("free")}, hits)
+	assert.Empty(t, misses)
+
+	premium.StoreSeries(blockID, storage.SeriesRef(1), []byte("series"), tenancy.DefaultTenant)
+	seriesHits, seriesMisses := premium.FetchMultiSeries(ctx, blockID, []storage.SeriesRef{1}, tenancy.DefaultTenant)
+	assert.Equal(t, map[storage.SeriesRef][]byte{1: []byte("series")}, seriesHits)
+	assert.Empty(t, seriesMisses)
+
+	assert.NoError(t, prom_testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_bucket_store_index_cache_tier_hits_total Total number of index cache requests served by the partition reserved to the tenant tier.
+		# TYPE cortex_bucket_store_index_cache_tier_hits_total counter
+		cortex_bucket_store_index_cache_tier_hits_total{item_type="ExpandedPostings",tier="premium"} 0
+		cortex_bucket_store_index_cache_tier_hits_total{item_type="Postings",tier="premium"} 1
+		cortex_bucket_store_index_cache_tier_hits_total{item_type="Series",tier="premium"} 1
+		# HELP cortex_bucket_store_index_cache_tier_misses_total Total number of index cache requests not found in the partition reserved to the tenant tier.
+		# TYPE cortex_bucket_store_index_cache_tier_misses_total counter
+		cortex_bucket_store_index_cache_tier_misses_total{item_type="ExpandedPostings",tier="premium"} 0
+		cortex_bucket_store_index_cache_tier_misses_total{item_type="Postings",tier="premium"} 2
+		cortex_bucket_store_index_cache_tier_misses_total{item_type="Series",tier="premium"} 0
+	`), "cortex_bucket_store_index_cache_tier_hits_total", "cortex_bucket_store_index_cache_tier_misses_total"))
+}
+
+func TestTieredIndexCache_ShouldEvictOnlyWithinTheTierPartition(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	shared, err := newInMemoryIndexCache(InMemoryIndexCacheConfig{MaxSizeBytes: 1024 * 1024}, log.NewNopLogger(), prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	// Each series entry takes 24 bytes of key plus the value.
+	limits := tierLimits{"user-1": "tier-1", "user-2": "tier-2"}
+	cache, err := NewTieredIndexCache(shared, IndexCacheTierSizes{"tier-1": 100, "tier-2": 100}, limits, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+
+	blockID := ulid.MustNew(1, nil)
+	value := make([]byte, 26)
+
+	user1 := cache.ForTenant("user-1")
+	user1.StoreSeries(blockID, 1, value, tenancy.DefaultTenant)
+
+	// Filling up the partition of another tier doesn't evict the entries of the first one.
+	user2 := cache.ForTenant("user-2")
+	for id := storage.SeriesRef(1); id <= 3; id++ {
+		user2.StoreSeries(blockID, id, value, tenancy.DefaultTenant)
+	}
+
+	_, ok := cache.tiers["tier-1"].get(cacheTypeSeries, storecache.CacheKey{Block: blockID.String(), Key: storecache.CacheKeySeries(1)})
+	assert.True(t, ok)
+	_, ok = cache.tiers["tier-2"].get(cacheTypeSeries, storecache.CacheKey{Block: blockID.String(), Key: storecache.CacheKeySeries(1)})
+	assert.False(t, ok)
+
+	assert.Equal(t, 0.0, prom_testutil.ToFloat64(cache.tiers["tier-1"].evictions.WithLabelValues(cacheTypeSeries)))
+	assert.Equal(t, 1.0, prom_testutil.ToFloat64(cache.tiers["tier-2"].evictions.WithLabelValues(cacheTypeSeries)))
+	assert.Equal(t, 50.0, prom_testutil.ToFloat64(cache.tiers["tier-1"].sizeBytes))
+	assert.Equal(t, 100.0, prom_testutil.ToFloat64(cache.tiers["tier-2"].sizeBytes))
+}
+
+type tierLimits map[string]string
+
+func (l tierLimits) StoreGatewayIndexCacheTier(userID string) string {
+	return l[userID]
+}
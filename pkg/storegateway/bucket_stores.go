@@ -29,6 +29,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/logging"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -56,6 +57,10 @@ type BucketStores struct {
 	// Index cache shared across all tenants.
 	indexCache storecache.IndexCache
 
+	// Index cache partitions reserved to the tenant tiers, in front of the shared
+	// index cache. Nil if no tier has reserved capacity.
+	tieredIndexCache *tsdb.TieredIndexCache
+
 	// Chunks bytes pool shared across all tenants.
 	chunksPool pool.Bytes
 
@@ -65,14 +70,36 @@ type BucketStores struct {
 	// Gate used to limit query concurrency across all tenants.
 	queryGate gate.Gate
 
+	// Gate used to limit the concurrent index-header loads while syncing the blocks.
+	indexHeaderLoadGate gate.Gate
+
 	// Keeps a bucket store for each tenant.
 	storesMu sync.RWMutex
 	stores   map[string]*store.BucketStore
 
+	// Keeps the tenants whose bucket store has been evicted under memory pressure. Guarded by storesMu.
+	evicted map[string]struct{}
+
+	// Tracks the queries of each tenant bucket store, to evict the least recently queried ones.
+	storesUsageMu sync.Mutex
+	storesUsage   map[string]*storeUsage
+
+	// Serializes the reloads of the evicted bucket stores.
+	reloadMu sync.Mutex
+
+	// Held while syncing the bucket stores, so that a bucket store being synced is not evicted.
+	syncMu sync.Mutex
+
+	// Returns the memory usage compared to the eviction threshold.
+	memoryUsage func() uint64
+
 	// Keeps the last sync error for the  bucket store for each tenant.
 	storesErrorsMu sync.RWMutex
 	storesErrors   map[string]error
 
+	// Max age of the blocks loaded by the current sync stage, or 0 if all blocks are loaded.
+	loadingMaxAge atomic.Duration
+
 	// Keeps number of inflight requests
 	inflightRequestCnt int
 	inflightRequestMu  sync.RWMutex
@@ -82,6 +109,10 @@ type BucketStores struct {
 	syncLastSuccess   prometheus.Gauge
 	tenantsDiscovered prometheus.Gauge
 	tenantsSynced     prometheus.Gauge
+	storesEvicted     prometheus.Counter
+	storesReloaded    prometheus.Counter
+
+	recentBlocksSyncLastSuccess *prometheus.GaugeVec
 }
 
 var ErrTooManyInflightRequests = status.Error(codes.ResourceExhausted, "too many inflight requests in store gateway")
@@ -102,19 +133,26 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		Help: "Number of maximum concurrent queries allowed.",
 	}).Set(float64(cfg.BucketStore.MaxConcurrent))
 
+	// The number of concurrent index-header loads while syncing the blocks is limited across all tenants.
+	indexHeaderLoadGate := gate.New(queryGateReg, cfg.BucketStore.IndexHeaderLoadConcurrency, indexHeaderLoads)
+
 	u := &BucketStores{
-		logger:             logger,
-		cfg:                cfg,
-		limits:             limits,
-		bucket:             cachingBucket,
-		shardingStrategy:   shardingStrategy,
-		stores:             map[string]*store.BucketStore{},
-		storesErrors:       map[string]error{},
-		logLevel:           logLevel,
-		bucketStoreMetrics: NewBucketStoreMetrics(),
-		metaFetcherMetrics: NewMetadataFetcherMetrics(),
-		queryGate:          queryGate,
-		partitioner:        newGapBasedPartitioner(cfg.BucketStore.PartitionerMaxGapBytes, reg),
+		logger:              logger,
+		cfg:                 cfg,
+		limits:              limits,
+		bucket:              cachingBucket,
+		shardingStrategy:    shardingStrategy,
+		stores:              map[string]*store.BucketStore{},
+		evicted:             map[string]struct{}{},
+		storesUsage:         map[string]*storeUsage{},
+		memoryUsage:         heapInUseBytes,
+		storesErrors:        map[string]error{},
+		logLevel:            logLevel,
+		bucketStoreMetrics:  NewBucketStoreMetrics(),
+		metaFetcherMetrics:  NewMetadataFetcherMetrics(),
+		queryGate:           queryGate,
+		indexHeaderLoadGate: indexHeaderLoadGate,
+		partitioner:         newGapBasedPartitioner(cfg.BucketStore.PartitionerMaxGapBytes, reg),
 		syncTimes: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 			Name:    "cortex_bucket_stores_blocks_sync_seconds",
 			Help:    "The total time it takes to perform a sync stores",
@@ -132,12 +170,29 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 			Name: "cortex_bucket_stores_tenants_synced",
 			Help: "Number of tenants synced.",
 		}),
+		recentBlocksSyncLastSuccess: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_bucket_stores_recent_blocks_last_successful_sync_timestamp_seconds",
+			Help: "Unix timestamp of the last successful sync of the blocks with data more recent than max age, when blocks are loaded from the most recent to the oldest ones.",
+		}, []string{"max_age"}),
+		storesEvicted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_tenants_evicted_total",
+			Help: "Total number of tenants whose index-headers have been unloaded under memory pressure.",
+		}),
+		storesReloaded: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_tenants_reloaded_total",
+			Help: "Total number of evicted tenants whose index-headers have been loaded again by a query.",
+		}),
 	}
 
 	// Init the index cache.
 	if u.indexCache, err = tsdb.NewIndexCache(cfg.BucketStore.IndexCache, logger, reg); err != nil {
 		return nil, errors.Wrap(err, "create index cache")
 	}
+	if len(cfg.BucketStore.IndexCache.TiersReservedSizeBytes) > 0 {
+		if u.tieredIndexCache, err = tsdb.NewTieredIndexCache(u.indexCache, cfg.BucketStore.IndexCache.TiersReservedSizeBytes, limits, logger, reg); err != nil {
+			return nil, errors.Wrap(err, "create tiered index cache")
+		}
+	}
 
 	// Init the chunks bytes pool.
 	if u.chunksPool, err = newChunkBytesPool(cfg.BucketStore.ChunkPoolMinBucketSizeBytes, cfg.BucketStore.ChunkPoolMaxBucketSizeBytes, cfg.BucketStore.MaxChunkPoolBytes, reg); err != nil {
@@ -167,12 +222,36 @@ func (u *BucketStores) InitialSync(ctx context.Context) error {
 }
 
 // SyncBlocks synchronizes the stores state with the Bucket store for every user.
+// The initial sync doesn't load the most recent blocks first, since the store-gateway
+// doesn't serve queries before all its blocks are loaded.
 func (u *BucketStores) SyncBlocks(ctx context.Context) error {
+	u.syncRecentBlocks(ctx)
+
 	return u.syncUsersBlocksWithRetries(ctx, func(ctx context.Context, s *store.BucketStore) error {
 		return s.SyncBlocks(ctx)
 	})
 }
 
+// syncRecentBlocks syncs the blocks in stages, from the most recent to the oldest ones, according to the
+// configured recent blocks loading stages. The blocks older than the last stage are left to the sync of
+// all the blocks following it. Failures are logged but not returned, because the following sync loads all blocks anyway.
+func (u *BucketStores) syncRecentBlocks(ctx context.Context) {
+	defer u.loadingMaxAge.Store(0)
+
+	for _, maxAge := range u.cfg.BucketStore.RecentBlocksLoadingStages {
+		u.loadingMaxAge.Store(maxAge)
+
+		if err := u.syncUsersBlocksStage(ctx, func(ctx context.Context, s *store.BucketStore) error {
+			return s.SyncBlocks(ctx)
+		}); err != nil {
+			level.Warn(u.logger).Log("msg", "failed to synchronize recent TSDB blocks", "max_age", maxAge, "err", err)
+			continue
+		}
+
+		u.recentBlocksSyncLastSuccess.WithLabelValues(maxAge.String()).SetToCurrentTime()
+	}
+}
+
 func (u *BucketStores) syncUsersBlocksWithRetries(ctx context.Context, f func(context.Context, *store.BucketStore) error) error {
 	retries := backoff.New(ctx, backoff.Config{
 		MinBackoff: 1 * time.Second,
@@ -205,6 +284,15 @@ func (u *BucketStores) syncUsersBlocks(ctx context.Context, f func(context.Conte
 		}
 	}(time.Now())
 
+	return u.syncUsersBlocksStage(ctx, f)
+}
+
+// syncUsersBlocksStage is like syncUsersBlocks, but doesn't track the sync metrics, which
+// only account for syncs of all the blocks.
+func (u *BucketStores) syncUsersBlocksStage(ctx context.Context, f func(context.Context, *store.BucketStore) error) error {
+	u.syncMu.Lock()
+	defer u.syncMu.Unlock()
+
 	type job struct {
 		userID string
 		store  *store.BucketStore
@@ -228,6 +316,8 @@ func (u *BucketStores) syncUsersBlocks(ctx context.Context, f func(context.Conte
 		includeUserIDs[userID] = struct{}{}
 	}
 
+	u.forgetEvictedStores(includeUserIDs)
+
 	u.tenantsDiscovered.Set(float64(len(userIDs)))
 	u.tenantsSynced.Set(float64(len(includeUserIDs)))
 
@@ -240,7 +330,7 @@ func (u *BucketStores) syncUsersBlocks(ctx context.Context, f func(context.Conte
 			defer wg.Done()
 
 			for job := range jobs {
-				if err := f(ctx, job.store); err != nil {
+				if err := f(withBlocksSync(ctx), job.store); err != nil {
 					if errors.Is(err, bucket.ErrCustomerManagedKeyAccessDenied) {
 						u.storesErrorsMu.Lock()
 						u.storesErrors[job.userID] = httpgrpc.Errorf(int(codes.PermissionDenied), "store error: %s", err)
@@ -270,6 +360,11 @@ func (u *BucketStores) syncUsersBlocks(ctx context.Context, f func(context.Conte
 			continue
 		}
 
+		// The evicted stores are synced once loaded again by a query.
+		if u.isEvicted(userID) {
+			continue
+		}
+
 		bs, err := u.getOrCreateStore(userID)
 		if err != nil {
 			errsMx.Lock()
@@ -316,10 +411,14 @@ func (u *BucketStores) Series(req *storepb.SeriesRequest, srv storepb.Store_Seri
 		return err
 	}
 
-	store := u.getStore(userID)
+	store, release, err := u.acquireStore(spanCtx, userID)
+	if err != nil {
+		return err
+	}
 	if store == nil {
 		return nil
 	}
+	defer release()
 
 	maxInflightRequests := u.cfg.BucketStore.MaxInflightRequests
 	if maxInflightRequests > 0 {
@@ -377,10 +476,14 @@ func (u *BucketStores) LabelNames(ctx context.Context, req *storepb.LabelNamesRe
 		return nil, err
 	}
 
-	store := u.getStore(userID)
+	store, release, err := u.acquireStore(spanCtx, userID)
+	if err != nil {
+		return nil, err
+	}
 	if store == nil {
 		return &storepb.LabelNamesResponse{}, nil
 	}
+	defer release()
 
 	resp, err := store.LabelNames(ctx, req)
 
@@ -407,10 +510,14 @@ func (u *BucketStores) LabelValues(ctx context.Context, req *storepb.LabelValues
 		return nil, err
 	}
 
-	store := u.getStore(userID)
+	store, release, err := u.acquireStore(spanCtx, userID)
+	if err != nil {
+		return nil, err
+	}
 	if store == nil {
 		return &storepb.LabelValuesResponse{}, nil
 	}
+	defer release()
 
 	return store.LabelValues(ctx, req)
 }
@@ -475,6 +582,10 @@ func (u *BucketStores) closeEmptyBucketStore(userID string) error {
 	unlockInDefer = false
 	u.storesMu.Unlock()
 
+	u.storesUsageMu.Lock()
+	delete(u.storesUsage, userID)
+	u.storesUsageMu.Unlock()
+
 	u.metaFetcherMetrics.RemoveUserRegistry(userID)
 	u.bucketStoreMetrics.RemoveUserRegistry(userID)
 	return bs.Close()
@@ -505,6 +616,26 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		return bs, nil
 	}
 
+	bs, fetcherReg, bucketStoreReg, err := u.newStore(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	u.addStoreLocked(userID, bs, fetcherReg, bucketStoreReg)
+	return bs, nil
+}
+
+// addStoreLocked adds the bucket store of the given user to the stores map and metrics.
+// The caller must hold storesMu.
+func (u *BucketStores) addStoreLocked(userID string, bs *store.BucketStore, fetcherReg, bucketStoreReg *prometheus.Registry) {
+	u.stores[userID] = bs
+	delete(u.evicted, userID)
+	u.metaFetcherMetrics.AddUserRegistry(userID, fetcherReg)
+	u.bucketStoreMetrics.AddUserRegistry(userID, bucketStoreReg)
+}
+
+// newStore creates a new bucket store for the given user, without adding it to the stores map.
+func (u *BucketStores) newStore(userID string) (*store.BucketStore, *prometheus.Registry, *prometheus.Registry, error) {
 	userLogger := util_log.WithUserID(userID, u.logger)
 
 	level.Info(userLogger).Log("msg", "creating user bucket store")
@@ -524,6 +655,8 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		NewReplicaLabelRemover(userLogger, []string{
 			tsdb.TenantIDExternalLabel,
 			tsdb.IngesterIDExternalLabel,
+			tsdb.BlockSourceExternalLabel,
+			tsdb.ShardExternalLabel,
 		}),
 		// Remove Cortex external labels so that they're not injected when querying blocks.
 	}...)
@@ -533,6 +666,11 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		filters = append(filters, NewIgnoreNonQueryableBlocksFilter(userLogger, u.cfg.BucketStore.IgnoreBlocksWithin))
 	}
 
+	if len(u.cfg.BucketStore.RecentBlocksLoadingStages) > 0 {
+		// Must be the last filter, to track the blocks synced by the previous syncs.
+		filters = append(filters, NewRecentBlocksFirstFilter(u.loadingMaxAge.Load))
+	}
+
 	// Instantiate a different blocks metadata fetcher based on whether bucket index is enabled or not.
 	var fetcher block.MetadataFetcher
 	if u.cfg.BucketStore.BucketIndex.Enabled {
@@ -562,9 +700,9 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		case tsdb.RecursiveDiscovery:
 			blockLister = block.NewRecursiveLister(userLogger, userBkt)
 		case tsdb.BucketIndexDiscovery:
-			return nil, tsdb.ErrInvalidBucketIndexBlockDiscoveryStrategy
+			return nil, nil, nil, tsdb.ErrInvalidBucketIndexBlockDiscoveryStrategy
 		default:
-			return nil, tsdb.ErrBlockDiscoveryStrategy
+			return nil, nil, nil, tsdb.ErrBlockDiscoveryStrategy
 		}
 		fetcher, err = block.NewMetaFetcher(
 			userLogger,
@@ -576,10 +714,15 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 			filters,
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 
+	indexCache := u.indexCache
+	if u.tieredIndexCache != nil {
+		indexCache = u.tieredIndexCache.ForTenant(userID)
+	}
+
 	bucketStoreReg := prometheus.NewRegistry()
 	bucketStoreOpts := []store.BucketStoreOption{
 		store.WithLogger(userLogger),
@@ -587,7 +730,7 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 			return util_log.HeadersFromContext(ctx, logger)
 		}),
 		store.WithRegistry(bucketStoreReg),
-		store.WithIndexCache(u.indexCache),
+		store.WithIndexCache(indexCache),
 		store.WithQueryGate(u.queryGate),
 		store.WithChunkPool(u.chunksPool),
 		store.WithSeriesBatchSize(u.cfg.BucketStore.SeriesBatchSize),
@@ -613,7 +756,7 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 	}
 
 	bs, err := store.NewBucketStore(
-		userBkt,
+		newIndexHeaderLoadingBucket(userBkt, u.indexHeaderLoadGate),
 		fetcher,
 		u.syncDirForUser(userID),
 		newChunksLimiterFactory(u.limits, userID),
@@ -629,14 +772,10 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		bucketStoreOpts...,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	u.stores[userID] = bs
-	u.metaFetcherMetrics.AddUserRegistry(userID, fetcherReg)
-	u.bucketStoreMetrics.AddUserRegistry(userID, bucketStoreReg)
-
-	return bs, nil
+	return bs, fetcherReg, bucketStoreReg, nil
 }
 
 // deleteLocalFilesForExcludedTenants removes local "sync" directories for tenants that are not included in the current
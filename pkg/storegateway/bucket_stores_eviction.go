@@ -0,0 +1,208 @@
+package storegateway
+
+import (
+	"context"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/thanos-io/thanos/pkg/store"
+
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+// storeUsage tracks the queries running against the bucket store of a tenant.
+type storeUsage struct {
+	// Held for reading by the queries, and for writing while evicting the bucket store,
+	// so that a bucket store is never closed while being queried.
+	mtx sync.RWMutex
+
+	lastQueryMtx sync.Mutex
+	lastQuery    time.Time
+}
+
+func (s *storeUsage) setLastQuery(t time.Time) {
+	s.lastQueryMtx.Lock()
+	s.lastQuery = t
+	s.lastQueryMtx.Unlock()
+}
+
+func (s *storeUsage) getLastQuery() time.Time {
+	s.lastQueryMtx.Lock()
+	defer s.lastQueryMtx.Unlock()
+	return s.lastQuery
+}
+
+func (u *BucketStores) getStoreUsage(userID string) *storeUsage {
+	u.storesUsageMu.Lock()
+	defer u.storesUsageMu.Unlock()
+
+	usage := u.storesUsage[userID]
+	if usage == nil {
+		usage = &storeUsage{}
+		u.storesUsage[userID] = usage
+	}
+	return usage
+}
+
+// acquireStore returns the bucket store of the given user to run a query against, loading it
+// again if it has been evicted. The returned function must be called once the query completes,
+// to allow the bucket store to be evicted. Returns a nil store if the user has no bucket store.
+func (u *BucketStores) acquireStore(ctx context.Context, userID string) (*store.BucketStore, func(), error) {
+	for {
+		bs := u.getStore(userID)
+		if bs == nil {
+			if !u.isEvicted(userID) {
+				return nil, nil, nil
+			}
+
+			var err error
+			if bs, err = u.reloadStore(ctx, userID); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		usage := u.getStoreUsage(userID)
+		usage.mtx.RLock()
+
+		// The store may have been evicted before we acquired it, in which case we retry.
+		if u.getStore(userID) != bs {
+			usage.mtx.RUnlock()
+			continue
+		}
+
+		usage.setLastQuery(time.Now())
+		return bs, usage.mtx.RUnlock, nil
+	}
+}
+
+func (u *BucketStores) isEvicted(userID string) bool {
+	u.storesMu.RLock()
+	defer u.storesMu.RUnlock()
+	_, ok := u.evicted[userID]
+	return ok
+}
+
+// forgetEvictedStores removes the evicted stores of the users not included in the store-gateway
+// shard anymore, so that they're not loaded again by a query.
+func (u *BucketStores) forgetEvictedStores(includeUserIDs map[string]struct{}) {
+	u.storesMu.Lock()
+	defer u.storesMu.Unlock()
+
+	for userID := range u.evicted {
+		if _, included := includeUserIDs[userID]; !included {
+			delete(u.evicted, userID)
+		}
+	}
+}
+
+// reloadStore loads again the evicted bucket store of the given user. The store is added to
+// the stores map only once its blocks have been loaded, so that it's never queried with a
+// subset of its blocks.
+func (u *BucketStores) reloadStore(ctx context.Context, userID string) (*store.BucketStore, error) {
+	u.reloadMu.Lock()
+	defer u.reloadMu.Unlock()
+
+	// Check again in the event it has been loaded while waiting for the lock.
+	if !u.isEvicted(userID) {
+		return u.getStore(userID), nil
+	}
+
+	level.Info(util_log.WithUserID(userID, u.logger)).Log("msg", "loading again the evicted user bucket store")
+
+	bs, fetcherReg, bucketStoreReg, err := u.newStore(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bs.InitialSync(ctx); err != nil {
+		_ = bs.Close()
+		return nil, err
+	}
+
+	u.storesMu.Lock()
+	u.addStoreLocked(userID, bs, fetcherReg, bucketStoreReg)
+	u.storesMu.Unlock()
+
+	u.storesReloaded.Inc()
+	return bs, nil
+}
+
+// EvictUnderMemoryPressure unloads the index-headers of the tenant least recently queried,
+// if the memory usage exceeds the configured threshold. A single tenant is evicted per call,
+// since the memory is only released by the next garbage collection. The eviction is skipped
+// while the bucket stores are being synced.
+func (u *BucketStores) EvictUnderMemoryPressure() {
+	threshold := u.cfg.BucketStore.MemoryPressureEvictionThresholdBytes
+	if threshold == 0 || u.memoryUsage() <= threshold {
+		return
+	}
+
+	if !u.syncMu.TryLock() {
+		return
+	}
+	defer u.syncMu.Unlock()
+
+	userID, ok := u.leastRecentlyQueriedStore()
+	if !ok {
+		return
+	}
+
+	// Wait until the running queries complete. New queries wait until the store is removed
+	// from the stores map, and then load it again.
+	usage := u.getStoreUsage(userID)
+	usage.mtx.Lock()
+
+	u.storesMu.Lock()
+	bs := u.stores[userID]
+	delete(u.stores, userID)
+	u.evicted[userID] = struct{}{}
+	u.storesMu.Unlock()
+
+	usage.mtx.Unlock()
+
+	u.metaFetcherMetrics.RemoveUserRegistry(userID)
+	u.bucketStoreMetrics.RemoveUserRegistry(userID)
+
+	userLogger := util_log.WithUserID(userID, u.logger)
+	if err := bs.Close(); err != nil {
+		level.Warn(userLogger).Log("msg", "failed to close the evicted user bucket store", "err", err)
+	}
+
+	level.Info(userLogger).Log("msg", "evicted user bucket store under memory pressure", "memory_usage_bytes", u.memoryUsage(), "threshold_bytes", threshold)
+	u.storesEvicted.Inc()
+}
+
+// leastRecentlyQueriedStore returns the user whose non-empty bucket store has been queried
+// least recently. The stores never queried are evicted first.
+func (u *BucketStores) leastRecentlyQueriedStore() (string, bool) {
+	u.storesMu.RLock()
+	defer u.storesMu.RUnlock()
+
+	var (
+		oldestUserID string
+		oldestQuery  time.Time
+		found        bool
+	)
+
+	for userID, bs := range u.stores {
+		if isEmptyBucketStore(bs) {
+			continue
+		}
+
+		lastQuery := u.getStoreUsage(userID).getLastQuery()
+		if !found || lastQuery.Before(oldestQuery) {
+			oldestUserID, oldestQuery, found = userID, lastQuery, true
+		}
+	}
+
+	return oldestUserID, found
+}
+
+// heapInUseBytes returns the bytes of the Go heap occupied by live or not yet collected objects.
+func heapInUseBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
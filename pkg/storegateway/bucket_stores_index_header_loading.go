@@ -0,0 +1,92 @@
+package storegateway
+
+import (
+	"context"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/gate"
+)
+
+// indexHeaderLoads is the operation name of the gate limiting the concurrent index-header loads.
+const indexHeaderLoads gate.OperationName = "index_header_loads"
+
+type blocksSyncContextKey struct{}
+
+// withBlocksSync marks the context as used to sync the blocks, so that the index-header
+// loads done while syncing are limited by the index-header loading gate.
+func withBlocksSync(ctx context.Context) context.Context {
+	return context.WithValue(ctx, blocksSyncContextKey{}, true)
+}
+
+func isBlocksSync(ctx context.Context) bool {
+	v, _ := ctx.Value(blocksSyncContextKey{}).(bool)
+	return v
+}
+
+// indexHeaderLoadingBucket limits the concurrent reads of the blocks index done while syncing
+// the blocks, which are the reads done to build the index-headers of the blocks not yet on the
+// local disk. An index-header is built reading a few sections of the index one after another, so
+// limiting the concurrent reads limits the concurrent index-header loads. The reads of the index
+// done by the queries are never limited.
+type indexHeaderLoadingBucket struct {
+	objstore.InstrumentedBucketReader
+
+	gate gate.Gate
+}
+
+func newIndexHeaderLoadingBucket(bkt objstore.InstrumentedBucketReader, g gate.Gate) *indexHeaderLoadingBucket {
+	return &indexHeaderLoadingBucket{
+		InstrumentedBucketReader: bkt,
+		gate:                     g,
+	}
+}
+
+// Get implements objstore.BucketReader.
+func (b *indexHeaderLoadingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.gated(ctx, name, func() (io.ReadCloser, error) {
+		return b.InstrumentedBucketReader.Get(ctx, name)
+	})
+}
+
+// GetRange implements objstore.BucketReader.
+func (b *indexHeaderLoadingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.gated(ctx, name, func() (io.ReadCloser, error) {
+		return b.InstrumentedBucketReader.GetRange(ctx, name, off, length)
+	})
+}
+
+// gated opens the reader through the gate if the object is a block index read while syncing
+// the blocks. The gate is held until the reader is closed.
+func (b *indexHeaderLoadingBucket) gated(ctx context.Context, name string, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if !isBlocksSync(ctx) || path.Base(name) != block.IndexFilename {
+		return open()
+	}
+
+	if err := b.gate.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	r, err := open()
+	if err != nil {
+		b.gate.Done()
+		return nil, err
+	}
+	return &gatedReadCloser{ReadCloser: r, done: b.gate.Done}, nil
+}
+
+type gatedReadCloser struct {
+	io.ReadCloser
+
+	once sync.Once
+	done func()
+}
+
+func (r *gatedReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.done)
+	return err
+}
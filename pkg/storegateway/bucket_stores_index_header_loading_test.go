@@ -0,0 +1,68 @@
+package storegateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/gate"
+)
+
+func TestIndexHeaderLoadingBucket(t *testing.T) {
+	inmem := objstore.NewInMemBucket()
+	require.NoError(t, inmem.Upload(context.Background(), "block/index", bytes.NewReader([]byte("index"))))
+	require.NoError(t, inmem.Upload(context.Background(), "block/meta.json", bytes.NewReader([]byte("meta"))))
+
+	bkt := newIndexHeaderLoadingBucket(objstore.WithNoopInstr(inmem), gate.New(prometheus.NewPedanticRegistry(), 1, indexHeaderLoads))
+	syncCtx := withBlocksSync(context.Background())
+
+	// Hold the only slot of the gate.
+	first, err := bkt.GetRange(syncCtx, "block/index", 0, 2)
+	require.NoError(t, err)
+
+	// The reads of other objects, and the reads of the index not done while syncing, are not limited.
+	for _, open := range []func() (io.ReadCloser, error){
+		func() (io.ReadCloser, error) { return bkt.Get(syncCtx, "block/meta.json") },
+		func() (io.ReadCloser, error) { return bkt.Get(context.Background(), "block/index") },
+		func() (io.ReadCloser, error) { return bkt.GetRange(context.Background(), "block/index", 0, 2) },
+	} {
+		r, err := open()
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+	}
+
+	// The reads of the index done while syncing wait for the gate.
+	ctx, cancel := context.WithTimeout(syncCtx, 100*time.Millisecond)
+	defer cancel()
+	_, err = bkt.Get(ctx, "block/index")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	opened := make(chan io.ReadCloser)
+	go func() {
+		r, err := bkt.Get(syncCtx, "block/index")
+		assert.NoError(t, err)
+		opened <- r
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("the index has been read while the gate was full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing the first reader, even multiple times, releases the gate once.
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+
+	second := <-opened
+	data, err := io.ReadAll(second)
+	require.NoError(t, err)
+	assert.Equal(t, "index", string(data))
+	require.NoError(t, second.Close())
+}
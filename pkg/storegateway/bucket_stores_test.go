@@ -249,12 +249,22 @@ func TestBucketStores_InitialSync(t *testing.T) {
 			# HELP cortex_bucket_stores_gate_queries_in_flight Number of queries that are currently in flight.
 			# TYPE cortex_bucket_stores_gate_queries_in_flight gauge
 			cortex_bucket_stores_gate_queries_in_flight 0
+
+			# HELP cortex_bucket_stores_gate_index_header_loads_in_flight Number of index_header_loads that are currently in flight.
+			# TYPE cortex_bucket_stores_gate_index_header_loads_in_flight gauge
+			cortex_bucket_stores_gate_index_header_loads_in_flight 0
+
+			# HELP cortex_bucket_stores_gate_index_header_loads_total Total number of index_header_loads.
+			# TYPE cortex_bucket_stores_gate_index_header_loads_total counter
+			cortex_bucket_stores_gate_index_header_loads_total 8
 	`),
 		"cortex_bucket_store_blocks_loaded",
 		"cortex_bucket_store_block_loads_total",
 		"cortex_bucket_store_block_load_failures_total",
 		"cortex_bucket_stores_gate_queries_concurrent_max",
 		"cortex_bucket_stores_gate_queries_in_flight",
+		"cortex_bucket_stores_gate_index_header_loads_in_flight",
+		"cortex_bucket_stores_gate_index_header_loads_total",
 	))
 
 	assert.Greater(t, testutil.ToFloat64(stores.syncLastSuccess), float64(0))
@@ -390,6 +400,65 @@ func TestBucketStores_SyncBlocks(t *testing.T) {
 	assert.Greater(t, testutil.ToFloat64(stores.syncLastSuccess), float64(0))
 }
 
+func TestBucketStores_SyncBlocksShouldLoadRecentBlocksFirst(t *testing.T) {
+	t.Parallel()
+	const (
+		userID     = "user-1"
+		metricName = "series_1"
+	)
+
+	ctx := context.Background()
+	cfg := prepareStorageConfig(t)
+	cfg.BucketStore.RecentBlocksLoadingStages = cortex_tsdb.DurationList{time.Hour}
+
+	storageDir := t.TempDir()
+
+	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	stores, err := NewBucketStores(cfg, NewNoShardingStrategy(log.NewNopLogger(), nil), objstore.WithNoopInstr(bucket), defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), reg)
+	require.NoError(t, err)
+
+	now := time.Now().UnixMilli()
+	generateStorageBlock(t, storageDir, userID, metricName, 10, 100, 15)
+	generateStorageBlock(t, storageDir, userID, metricName, now-60000, now, 15000)
+
+	// The recent blocks stage only loads the recent block.
+	stores.syncRecentBlocks(ctx)
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_bucket_store_blocks_loaded Number of currently loaded blocks.
+			# TYPE cortex_bucket_store_blocks_loaded gauge
+			cortex_bucket_store_blocks_loaded{user="user-1"} 1
+	`), "cortex_bucket_store_blocks_loaded"))
+	assert.Greater(t, testutil.ToFloat64(stores.recentBlocksSyncLastSuccess.WithLabelValues(time.Hour.String())), float64(0))
+	assert.Equal(t, 0.0, testutil.ToFloat64(stores.syncLastSuccess))
+
+	// Once synced, all blocks are loaded.
+	require.NoError(t, stores.SyncBlocks(ctx))
+
+	// Blocks loaded by previous syncs are not dropped by the recent blocks stage of following syncs.
+	stores.syncRecentBlocks(ctx)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_bucket_store_blocks_loaded Number of currently loaded blocks.
+			# TYPE cortex_bucket_store_blocks_loaded gauge
+			cortex_bucket_store_blocks_loaded{user="user-1"} 2
+
+			# HELP cortex_bucket_store_block_loads_total Total number of remote block loading attempts.
+			# TYPE cortex_bucket_store_block_loads_total counter
+			cortex_bucket_store_block_loads_total 2
+
+			# HELP cortex_bucket_store_block_drops_total Total number of local blocks that were dropped.
+			# TYPE cortex_bucket_store_block_drops_total counter
+			cortex_bucket_store_block_drops_total 0
+	`),
+		"cortex_bucket_store_blocks_loaded",
+		"cortex_bucket_store_block_loads_total",
+		"cortex_bucket_store_block_drops_total",
+	))
+}
+
 func TestBucketStores_syncUsersBlocks(t *testing.T) {
 	t.Parallel()
 	allUsers := []string{"user-1", "user-2", "user-3"}
@@ -559,6 +628,79 @@ func TestBucketStores_Series_ShouldNotCheckMaxInflightRequestsIfTheLimitIsDisabl
 	assert.Equal(t, 1, len(series))
 }
 
+func TestBucketStores_EvictUnderMemoryPressure(t *testing.T) {
+	ctx := context.Background()
+	cfg := prepareStorageConfig(t)
+	cfg.BucketStore.MemoryPressureEvictionThresholdBytes = 1000
+
+	storageDir := t.TempDir()
+	generateStorageBlock(t, storageDir, "user-1", "series_1", 10, 100, 15)
+	generateStorageBlock(t, storageDir, "user-2", "series_2", 10, 100, 15)
+
+	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	stores, err := NewBucketStores(cfg, NewNoShardingStrategy(log.NewNopLogger(), nil), objstore.WithNoopInstr(bucket), defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, stores.InitialSync(ctx))
+
+	memoryUsage := uint64(0)
+	stores.memoryUsage = func() uint64 { return memoryUsage }
+
+	// Query user-2, so that user-1 is the least recently queried.
+	seriesSet, _, err := querySeries(stores, "user-2", "series_2", 20, 40)
+	require.NoError(t, err)
+	require.Len(t, seriesSet, 1)
+
+	// Nothing is evicted below the threshold.
+	stores.EvictUnderMemoryPressure()
+	require.NotNil(t, stores.getStore("user-1"))
+
+	memoryUsage = 2000
+	stores.EvictUnderMemoryPressure()
+	assert.Nil(t, stores.getStore("user-1"))
+	assert.NotNil(t, stores.getStore("user-2"))
+
+	// The evicted store is not loaded again by the periodic sync.
+	require.NoError(t, stores.SyncBlocks(ctx))
+	assert.Nil(t, stores.getStore("user-1"))
+
+	// The evicted store is loaded again by the next query, which returns all its series.
+	seriesSet, _, err = querySeries(stores, "user-1", "series_1", 20, 40)
+	require.NoError(t, err)
+	require.Len(t, seriesSet, 1)
+	assert.Equal(t, []labelpb.ZLabel{{Name: labels.MetricName, Value: "series_1"}}, seriesSet[0].Labels)
+	assert.NotNil(t, stores.getStore("user-1"))
+
+	labelNames, err := queryLabelsNames(stores, "user-1", "series_1", 20, 40)
+	require.NoError(t, err)
+	assert.Equal(t, []string{labels.MetricName}, labelNames.Names)
+
+	// Now user-2 is the least recently queried.
+	stores.EvictUnderMemoryPressure()
+	assert.Nil(t, stores.getStore("user-2"))
+	assert.NotNil(t, stores.getStore("user-1"))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_bucket_stores_tenants_evicted_total Total number of tenants whose index-headers have been unloaded under memory pressure.
+		# TYPE cortex_bucket_stores_tenants_evicted_total counter
+		cortex_bucket_stores_tenants_evicted_total 2
+
+		# HELP cortex_bucket_stores_tenants_reloaded_total Total number of evicted tenants whose index-headers have been loaded again by a query.
+		# TYPE cortex_bucket_stores_tenants_reloaded_total counter
+		cortex_bucket_stores_tenants_reloaded_total 1
+
+		# HELP cortex_bucket_store_blocks_loaded Number of currently loaded blocks.
+		# TYPE cortex_bucket_store_blocks_loaded gauge
+		cortex_bucket_store_blocks_loaded{user="user-1"} 1
+	`),
+		"cortex_bucket_stores_tenants_evicted_total",
+		"cortex_bucket_stores_tenants_reloaded_total",
+		"cortex_bucket_store_blocks_loaded",
+	))
+}
+
 func prepareStorageConfig(t *testing.T) cortex_tsdb.BlocksStorageConfig {
 	cfg := cortex_tsdb.BlocksStorageConfig{}
 	flagext.DefaultValues(&cfg)
@@ -41,6 +41,10 @@ const (
 	// in the ring will be automatically removed.
 	ringAutoForgetUnhealthyPeriods = 10
 
+	// memoryPressureCheckInterval is how frequently the memory usage is compared to the eviction
+	// threshold, if the eviction under memory pressure is enabled.
+	memoryPressureCheckInterval = 15 * time.Second
+
 	instanceLimitsMetric     = "cortex_storegateway_instance_limits"
 	instanceLimitsMetricHelp = "Instance limits used by this store gateway."
 	limitLabel               = "limit"
@@ -329,10 +333,19 @@ func (g *StoreGateway) running(ctx context.Context) error {
 		ringTickerChan = ringTicker.C
 	}
 
+	var evictionTickerChan <-chan time.Time
+	if g.storageCfg.BucketStore.MemoryPressureEvictionThresholdBytes > 0 {
+		evictionTicker := time.NewTicker(memoryPressureCheckInterval)
+		defer evictionTicker.Stop()
+		evictionTickerChan = evictionTicker.C
+	}
+
 	for {
 		select {
 		case <-syncTicker.C:
 			g.syncStores(ctx, syncReasonPeriodic)
+		case <-evictionTickerChan:
+			g.stores.EvictUnderMemoryPressure()
 		case <-ringTickerChan:
 			// We ignore the error because in case of error it will return an empty
 			// replication set which we use to compare with the previous state.
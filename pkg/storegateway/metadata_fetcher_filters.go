@@ -105,3 +105,45 @@ func (f *IgnoreNonQueryableBlocksFilter) Filter(ctx context.Context, metas map[u
 
 	return nil
 }
+
+// NewRecentBlocksFirstFilter creates a RecentBlocksFirstFilter. The max age of the blocks to
+// let through is read from the given function, with 0 meaning no max age.
+func NewRecentBlocksFirstFilter(maxAge func() time.Duration) *RecentBlocksFirstFilter {
+	return &RecentBlocksFirstFilter{
+		maxAge: maxAge,
+		synced: map[ulid.ULID]struct{}{},
+	}
+}
+
+// RecentBlocksFirstFilter is used to load blocks from the most recent to the oldest ones. While a
+// max age is set, it filters out the blocks with data older than the max age, unless they've been
+// let through by the last sync without max age, so that already loaded blocks aren't dropped.
+// It has to be the last filter, to track the blocks synced without max age.
+type RecentBlocksFirstFilter struct {
+	maxAge func() time.Duration
+	synced map[ulid.ULID]struct{}
+}
+
+// Filter implements block.MetadataFilter.
+func (f *RecentBlocksFirstFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, _ block.GaugeVec, _ block.GaugeVec) error {
+	maxAge := f.maxAge()
+	if maxAge <= 0 {
+		f.synced = make(map[ulid.ULID]struct{}, len(metas))
+		for id := range metas {
+			f.synced[id] = struct{}{}
+		}
+		return nil
+	}
+
+	minMaxTime := time.Now().Add(-maxAge).UnixMilli()
+	for id, m := range metas {
+		if _, ok := f.synced[id]; ok {
+			continue
+		}
+		if m.MaxTime < minMaxTime {
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
@@ -174,3 +174,53 @@ func TestIgnoreNonQueryableBlocksFilter(t *testing.T) {
 	require.NoError(t, f.Filter(ctx, inputMetas, synced, modified))
 	assert.Equal(t, expectedMetas, inputMetas)
 }
+
+func TestRecentBlocksFirstFilter(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	ctx := context.Background()
+
+	newMetas := func() map[ulid.ULID]*metadata.Meta {
+		return map[ulid.ULID]*metadata.Meta{
+			ulid.MustNew(1, nil): {BlockMeta: tsdb.BlockMeta{MinTime: now.Add(-2 * time.Hour).UnixMilli(), MaxTime: now.UnixMilli()}},
+			ulid.MustNew(2, nil): {BlockMeta: tsdb.BlockMeta{MinTime: now.Add(-26 * time.Hour).UnixMilli(), MaxTime: now.Add(-24 * time.Hour).UnixMilli()}},
+			ulid.MustNew(3, nil): {BlockMeta: tsdb.BlockMeta{MinTime: now.Add(-74 * time.Hour).UnixMilli(), MaxTime: now.Add(-72 * time.Hour).UnixMilli()}},
+		}
+	}
+	ids := func(metas map[ulid.ULID]*metadata.Meta) []ulid.ULID {
+		var out []ulid.ULID
+		for id := range metas {
+			out = append(out, id)
+		}
+		return out
+	}
+
+	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+	modified := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "modified"}, []string{"state"})
+
+	maxAge := 12 * time.Hour
+	f := NewRecentBlocksFirstFilter(func() time.Duration { return maxAge })
+
+	// Only the blocks more recent than the max age pass.
+	metas := newMetas()
+	require.NoError(t, f.Filter(ctx, metas, synced, modified))
+	assert.ElementsMatch(t, []ulid.ULID{ulid.MustNew(1, nil)}, ids(metas))
+
+	maxAge = 48 * time.Hour
+	metas = newMetas()
+	require.NoError(t, f.Filter(ctx, metas, synced, modified))
+	assert.ElementsMatch(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)}, ids(metas))
+
+	// Without max age, all blocks pass.
+	maxAge = 0
+	metas = newMetas()
+	require.NoError(t, f.Filter(ctx, metas, synced, modified))
+	assert.Len(t, metas, 3)
+
+	// The blocks synced without max age keep passing.
+	maxAge = 12 * time.Hour
+	metas = newMetas()
+	metas[ulid.MustNew(4, nil)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: now.Add(-98 * time.Hour).UnixMilli(), MaxTime: now.Add(-96 * time.Hour).UnixMilli()}}
+	require.NoError(t, f.Filter(ctx, metas, synced, modified))
+	assert.ElementsMatch(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil)}, ids(metas))
+}
@@ -139,6 +139,7 @@ func SetupTracing(ctx context.Context, name string, c Config) (func(context.Cont
 		bridge.SetTextMapPropagator(propagator)
 		opentracing.SetGlobalTracer(bridge)
 		otel.SetTracerProvider(wrappedProvider)
+		otel.SetTextMapPropagator(propagator)
 
 		return tracerProvider.Shutdown, nil
 	}
@@ -76,6 +76,18 @@ func (b *Backoff) Wait() {
 	// Increase the number of retries and get the next delay
 	sleepTime := b.NextDelay()
 
+	b.sleep(sleepTime)
+}
+
+// WaitFor sleeps for the given time instead of the backoff time, then increases the retry count
+// and backoff time like Wait. Returns immediately if Context is terminated
+func (b *Backoff) WaitFor(sleepTime time.Duration) {
+	b.NextDelay()
+
+	b.sleep(sleepTime)
+}
+
+func (b *Backoff) sleep(sleepTime time.Duration) {
 	if b.Ongoing() {
 		select {
 		case <-b.ctx.Done():
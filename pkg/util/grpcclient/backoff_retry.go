@@ -2,20 +2,35 @@ package grpcclient
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/util/backoff"
 )
 
-// NewBackoffRetry gRPC middleware.
-func NewBackoffRetry(cfg backoff.Config) grpc.UnaryClientInterceptor {
+// retryAfterKey is the key of the response metadata holding the duration the server asks the
+// client to wait before retrying.
+const retryAfterKey = "retry-after"
+
+// NewBackoffRetry gRPC middleware. If honorRetryAfter is true, the retry-after duration in the
+// response metadata of a rate-limited call, if any, is waited instead of the backoff time,
+// capped to the max backoff period.
+func NewBackoffRetry(cfg backoff.Config, honorRetryAfter bool) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		backoff := backoff.New(ctx, cfg)
 		for backoff.Ongoing() {
-			err := invoker(ctx, method, req, reply, cc, opts...)
+			var header, trailer metadata.MD
+			callOpts := opts
+			if honorRetryAfter {
+				callOpts = append(opts[:len(opts):len(opts)], grpc.Header(&header), grpc.Trailer(&trailer))
+			}
+
+			err := invoker(ctx, method, req, reply, cc, callOpts...)
 			if err == nil {
 				return nil
 			}
@@ -24,8 +39,32 @@ func NewBackoffRetry(cfg backoff.Config) grpc.UnaryClientInterceptor {
 				return err
 			}
 
+			if retryAfter, ok := parseRetryAfter(trailer, header); honorRetryAfter && ok {
+				backoff.WaitFor(min(retryAfter, cfg.MaxBackoff))
+				continue
+			}
 			backoff.Wait()
 		}
 		return backoff.Err()
 	}
 }
+
+// parseRetryAfter returns the first valid retry-after duration of the response metadata. The
+// duration is either a number of seconds, like the HTTP Retry-After header, or a duration
+// string like "1.5s".
+func parseRetryAfter(mds ...metadata.MD) (time.Duration, bool) {
+	for _, md := range mds {
+		for _, value := range md.Get(retryAfterKey) {
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				if seconds >= 0 {
+					return time.Duration(seconds * float64(time.Second)), true
+				}
+				continue
+			}
+			if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+				return d, true
+			}
+		}
+	}
+	return 0, false
+}
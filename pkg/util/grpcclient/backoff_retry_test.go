@@ -0,0 +1,134 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/util/backoff"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	for name, tc := range map[string]struct {
+		mds      []metadata.MD
+		expected time.Duration
+		found    bool
+	}{
+		"no metadata": {},
+		"no retry-after": {
+			mds: []metadata.MD{metadata.Pairs("other", "1")},
+		},
+		"seconds": {
+			mds:      []metadata.MD{metadata.Pairs(retryAfterKey, "2")},
+			expected: 2 * time.Second,
+			found:    true,
+		},
+		"fractional seconds": {
+			mds:      []metadata.MD{metadata.Pairs(retryAfterKey, "0.5")},
+			expected: 500 * time.Millisecond,
+			found:    true,
+		},
+		"duration": {
+			mds:      []metadata.MD{metadata.Pairs(retryAfterKey, "1m30s")},
+			expected: 90 * time.Second,
+			found:    true,
+		},
+		"invalid values are skipped": {
+			mds:      []metadata.MD{metadata.Pairs(retryAfterKey, "soon", retryAfterKey, "-1"), metadata.Pairs(retryAfterKey, "3")},
+			expected: 3 * time.Second,
+			found:    true,
+		},
+		"the first metadata takes precedence": {
+			mds:      []metadata.MD{metadata.Pairs(retryAfterKey, "1"), metadata.Pairs(retryAfterKey, "3")},
+			expected: time.Second,
+			found:    true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d, found := parseRetryAfter(tc.mds...)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.expected, d)
+		})
+	}
+}
+
+func TestBackoffRetry_RetryAfter(t *testing.T) {
+	cfg := backoff.Config{MinBackoff: 5 * time.Second, MaxBackoff: 10 * time.Second, MaxRetries: 3}
+
+	for name, tc := range map[string]struct {
+		honorRetryAfter bool
+		trailer         metadata.MD
+		expectRetried   bool
+	}{
+		"retry-after honored": {
+			honorRetryAfter: true,
+			trailer:         metadata.Pairs(retryAfterKey, "10ms"),
+			expectRetried:   true,
+		},
+		"retry-after ignored if not honored": {
+			trailer: metadata.Pairs(retryAfterKey, "10ms"),
+		},
+		"backoff time waited without retry-after": {
+			honorRetryAfter: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			invoker := func(_ context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				if calls > 1 {
+					return nil
+				}
+				for _, opt := range opts {
+					if o, ok := opt.(grpc.TrailerCallOption); ok {
+						*o.TrailerAddr = tc.trailer
+					}
+				}
+				return status.Error(codes.ResourceExhausted, "rate limited")
+			}
+
+			// Without honoring the retry-after, the backoff time is waited until the context times out.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			err := NewBackoffRetry(cfg, tc.honorRetryAfter)(ctx, "method", nil, nil, nil, invoker)
+			if tc.expectRetried {
+				require.NoError(t, err)
+				assert.Equal(t, 2, calls)
+			} else {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.Equal(t, 1, calls)
+			}
+		})
+	}
+}
+
+func TestBackoffRetry_RetryAfterCappedToMaxBackoff(t *testing.T) {
+	cfg := backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, MaxRetries: 3}
+
+	calls := 0
+	invoker := func(_ context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if calls > 1 {
+			return nil
+		}
+		for _, opt := range opts {
+			if o, ok := opt.(grpc.HeaderCallOption); ok {
+				*o.HeaderAddr = metadata.Pairs(retryAfterKey, "3600")
+			}
+		}
+		return status.Error(codes.ResourceExhausted, "rate limited")
+	}
+
+	start := time.Now()
+	require.NoError(t, NewBackoffRetry(cfg, true)(context.Background(), "method", nil, nil, nil, invoker))
+	assert.Equal(t, 2, calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,110 @@
+package grpcclient
+
+import (
+	"context"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+func (cfg *Config) validateCircuitBreaker() error {
+	if !cfg.CircuitBreakerEnabled {
+		return nil
+	}
+	if cfg.CircuitBreakerFailureThreshold == 0 {
+		return errors.New("invalid circuit breaker failure threshold: it must be greater than 0")
+	}
+	if cfg.CircuitBreakerCooldown <= 0 {
+		return errors.Errorf("invalid circuit breaker cooldown: %s, it must be greater than 0", cfg.CircuitBreakerCooldown)
+	}
+	if cfg.CircuitBreakerHalfOpenProbes == 0 {
+		return errors.New("invalid circuit breaker half-open probes: it must be greater than 0")
+	}
+	return nil
+}
+
+// CircuitBreaker stops sending the RPCs to a target that is consistently failing. After the
+// configured number of consecutive failures, the RPCs fail immediately with the Unavailable code
+// for the cooldown period, then a limited number of probe RPCs is let through, closing the
+// circuit again if they all succeed.
+type CircuitBreaker struct {
+	cb *gobreaker.TwoStepCircuitBreaker
+}
+
+// NewCircuitBreaker creates a CircuitBreaker for the RPCs sent to the target.
+func NewCircuitBreaker(cfg *Config, target string) *CircuitBreaker {
+	failureThreshold := uint32(cfg.CircuitBreakerFailureThreshold)
+	return &CircuitBreaker{
+		cb: gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+			Name:        target,
+			MaxRequests: uint32(cfg.CircuitBreakerHalfOpenProbes),
+			Timeout:     cfg.CircuitBreakerCooldown,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= failureThreshold
+			},
+			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+				level.Info(util_log.Logger).Log("msg", "gRPC client circuit breaker state change", "target", name, "from-state", from, "to-state", to)
+			},
+		}),
+	}
+}
+
+// UnaryClientInterceptor returns the interceptor applying the circuit breaker to the unary RPCs.
+func (c *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := c.allow()
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(!isCircuitBreakerFailure(err))
+		return err
+	}
+}
+
+// StreamClientInterceptor returns the interceptor applying the circuit breaker to the creation
+// of the streams. The errors received once the stream is established are not accounted.
+func (c *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done, err := c.allow()
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		done(!isCircuitBreakerFailure(err))
+		return stream, err
+	}
+}
+
+func (c *CircuitBreaker) allow() (func(success bool), error) {
+	done, err := c.cb.Allow()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%s: %s", err, c.cb.Name())
+	}
+	return done, nil
+}
+
+// isCircuitBreakerFailure returns whether the error tells the target is failing, as opposed
+// to the errors caused by the request itself, like the invalid or rate-limited ones.
+func isCircuitBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+	switch code := s.Code(); code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	default:
+		// The errors sent by httpgrpc servers carry the HTTP status code.
+		return code/100 == 5
+	}
+}
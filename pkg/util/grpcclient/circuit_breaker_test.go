@@ -0,0 +1,126 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker_UnaryClientInterceptor(t *testing.T) {
+	cfg := Config{
+		CircuitBreakerEnabled:          true,
+		CircuitBreakerFailureThreshold: 3,
+		CircuitBreakerCooldown:         100 * time.Millisecond,
+		CircuitBreakerHalfOpenProbes:   2,
+	}
+	require.NoError(t, cfg.validateCircuitBreaker())
+
+	var (
+		calls     int
+		invokeErr error
+	)
+	invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		calls++
+		return invokeErr
+	}
+	interceptor := NewCircuitBreaker(&cfg, "ingester-1:9095").UnaryClientInterceptor()
+	call := func() error {
+		return interceptor(context.Background(), "/cortex.Ingester/Push", nil, nil, nil, invoker)
+	}
+
+	// The errors caused by the requests don't open the circuit.
+	invokeErr = status.Error(codes.InvalidArgument, "invalid")
+	for i := 0; i < 5; i++ {
+		require.Equal(t, invokeErr, call())
+	}
+	invokeErr = httpgrpc.Errorf(429, "rate limited")
+	for i := 0; i < 5; i++ {
+		require.Equal(t, invokeErr, call())
+	}
+	assert.Equal(t, 10, calls)
+
+	// The consecutive failures open the circuit.
+	invokeErr = status.Error(codes.Unavailable, "unavailable")
+	for i := 0; i < 3; i++ {
+		require.Equal(t, invokeErr, call())
+	}
+	assert.Equal(t, 13, calls)
+
+	err := call()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorContains(t, err, "circuit breaker is open: ingester-1:9095")
+	assert.Equal(t, 13, calls)
+
+	// A failed probe opens the circuit again after the cooldown.
+	time.Sleep(150 * time.Millisecond)
+	invokeErr = httpgrpc.Errorf(500, "internal")
+	require.Equal(t, invokeErr, call())
+	assert.Equal(t, 14, calls)
+	assert.ErrorContains(t, call(), "circuit breaker is open")
+	assert.Equal(t, 14, calls)
+
+	// The circuit closes once all the probes succeeded.
+	time.Sleep(150 * time.Millisecond)
+	invokeErr = nil
+	for i := 0; i < 5; i++ {
+		require.NoError(t, call())
+	}
+	assert.Equal(t, 19, calls)
+}
+
+func TestCircuitBreaker_StreamClientInterceptor(t *testing.T) {
+	cfg := Config{
+		CircuitBreakerEnabled:          true,
+		CircuitBreakerFailureThreshold: 1,
+		CircuitBreakerCooldown:         time.Minute,
+		CircuitBreakerHalfOpenProbes:   1,
+	}
+
+	calls := 0
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	}
+	interceptor := NewCircuitBreaker(&cfg, "ingester-1:9095").StreamClientInterceptor()
+
+	_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/cortex.Ingester/QueryStream", streamer)
+	assert.EqualError(t, err, "connection refused")
+
+	_, err = interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/cortex.Ingester/QueryStream", streamer)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, calls)
+}
+
+func TestConfig_ValidateCircuitBreaker(t *testing.T) {
+	valid := Config{
+		CircuitBreakerEnabled:          true,
+		CircuitBreakerFailureThreshold: 5,
+		CircuitBreakerCooldown:         10 * time.Second,
+		CircuitBreakerHalfOpenProbes:   1,
+	}
+	require.NoError(t, valid.validateCircuitBreaker())
+
+	cfg := valid
+	cfg.CircuitBreakerFailureThreshold = 0
+	assert.EqualError(t, cfg.validateCircuitBreaker(), "invalid circuit breaker failure threshold: it must be greater than 0")
+
+	cfg = valid
+	cfg.CircuitBreakerCooldown = 0
+	assert.EqualError(t, cfg.validateCircuitBreaker(), "invalid circuit breaker cooldown: 0s, it must be greater than 0")
+
+	cfg = valid
+	cfg.CircuitBreakerHalfOpenProbes = 0
+	assert.EqualError(t, cfg.validateCircuitBreaker(), "invalid circuit breaker half-open probes: it must be greater than 0")
+
+	// The settings are not validated when the circuit breaker is disabled.
+	cfg.CircuitBreakerEnabled = false
+	assert.NoError(t, cfg.validateCircuitBreaker())
+}
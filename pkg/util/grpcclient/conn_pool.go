@@ -0,0 +1,66 @@
+package grpcclient
+
+import (
+	"context"
+
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+
+	"github.com/cortexproject/cortex/pkg/util/multierror"
+)
+
+// ConnPool is a pool of connections to the same target, sending the RPCs over the connections
+// in round-robin. A single HTTP/2 connection is limited by the max concurrent streams of the
+// server and by the throughput of a single TCP connection, while the pool spreads the load over
+// multiple connections.
+type ConnPool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+}
+
+// DialPool creates a ConnPool of size connections to the target, at least one.
+func DialPool(target string, size int, opts ...grpc.DialOption) (*ConnPool, error) {
+	p := &ConnPool{conns: make([]*grpc.ClientConn, 0, max(size, 1))}
+	for i := 0; i < cap(p.conns); i++ {
+		conn, err := grpc.Dial(target, opts...)
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	return p, nil
+}
+
+// Size returns the number of connections of the pool.
+func (p *ConnPool) Size() int {
+	return len(p.conns)
+}
+
+// Conn returns the next connection of the pool, in round-robin. It allows to spread the RPCs
+// of the generated clients requiring a *grpc.ClientConn.
+func (p *ConnPool) Conn() *grpc.ClientConn {
+	if len(p.conns) == 1 {
+		return p.conns[0]
+	}
+	return p.conns[(p.next.Inc()-1)%uint64(len(p.conns))]
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (p *ConnPool) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return p.Conn().Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (p *ConnPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return p.Conn().NewStream(ctx, desc, method, opts...)
+}
+
+// Close closes all the connections of the pool.
+func (p *ConnPool) Close() error {
+	errs := multierror.New()
+	for _, conn := range p.conns {
+		errs.Add(conn.Close())
+	}
+	return errs.Err()
+}
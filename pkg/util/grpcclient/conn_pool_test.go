@@ -0,0 +1,60 @@
+package grpcclient_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+
+	"github.com/cortexproject/cortex/pkg/util/grpcclient"
+)
+
+func TestConnPool_ShouldSpreadTheRPCsOverTheConnections(t *testing.T) {
+	for _, size := range []int{0, 1, 3} {
+		var (
+			mtx   sync.Mutex
+			peers = map[string]int{}
+		)
+		// The server records the client address of each connection.
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			p, _ := peer.FromContext(ctx)
+			mtx.Lock()
+			peers[p.Addr.String()]++
+			mtx.Unlock()
+			return handler(ctx, req)
+		}))
+		grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		go func() { _ = server.Serve(listener) }()
+
+		pool, err := grpcclient.DialPool(listener.Addr().String(), size, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+
+		expectedConns := max(size, 1)
+		assert.Equal(t, expectedConns, pool.Size())
+
+		client := grpc_health_v1.NewHealthClient(pool)
+		for i := 0; i < 2*expectedConns; i++ {
+			_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, pool.Close())
+		server.Stop()
+
+		// Each connection received the same number of RPCs.
+		assert.Len(t, peers, expectedConns)
+		for _, calls := range peers {
+			assert.Equal(t, 2, calls)
+		}
+	}
+}
@@ -7,11 +7,13 @@ import (
 	"github.com/go-kit/log"
 	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/keepalive"
 
 	"github.com/cortexproject/cortex/pkg/util/backoff"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/grpcencoding/snappy"
 	"github.com/cortexproject/cortex/pkg/util/grpcencoding/snappyblock"
 	"github.com/cortexproject/cortex/pkg/util/grpcencoding/zstd"
@@ -26,12 +28,50 @@ type Config struct {
 	RateLimit       float64 `yaml:"rate_limit"`
 	RateLimitBurst  int     `yaml:"rate_limit_burst"`
 
-	BackoffOnRatelimits bool           `yaml:"backoff_on_ratelimits"`
-	BackoffConfig       backoff.Config `yaml:"backoff_config"`
+	RateLimitPerTenant      float64 `yaml:"rate_limit_per_tenant"`
+	RateLimitPerTenantBurst int     `yaml:"rate_limit_per_tenant_burst"`
+
+	MethodCompressionOverrides map[string]string `yaml:"method_compression_overrides" doc:"nocli|description=[Experimental] Compression used when sending the messages of specific RPC methods, overriding the grpc_compression for them. The keys are the full method names, like '/cortex.Ingester/Push', and the values are the compression types supported by grpc_compression, '' disabling the compression for the method."`
+
+	LoadBalancingPolicy string `yaml:"load_balancing_policy"`
+	ServiceConfig       string `yaml:"service_config"`
+
+	TracingStatsHandlerEnabled bool `yaml:"tracing_stats_handler_enabled"`
+
+	ProxyURL string `yaml:"proxy_url"`
+
+	TCPKeepAliveIdle     time.Duration `yaml:"tcp_keepalive_idle"`
+	TCPKeepAliveInterval time.Duration `yaml:"tcp_keepalive_interval"`
+	TCPKeepAliveCount    int           `yaml:"tcp_keepalive_count"`
+
+	HedgingDelay       time.Duration          `yaml:"hedging_delay"`
+	HedgingMaxAttempts int                    `yaml:"hedging_max_attempts"`
+	HedgingMethods     flagext.StringSliceCSV `yaml:"hedging_methods"`
+
+	CircuitBreakerEnabled          bool          `yaml:"circuit_breaker_enabled"`
+	CircuitBreakerFailureThreshold uint          `yaml:"circuit_breaker_failure_threshold"`
+	CircuitBreakerCooldown         time.Duration `yaml:"circuit_breaker_cooldown"`
+	CircuitBreakerHalfOpenProbes   uint          `yaml:"circuit_breaker_half_open_probes"`
+
+	RetryCodes         flagext.StringSliceCSV `yaml:"retry_codes"`
+	RetryMaxAttempts   int                    `yaml:"retry_max_attempts"`
+	RetryPerTryTimeout time.Duration          `yaml:"retry_per_try_timeout"`
+	RetryBudgetRatio   float64                `yaml:"retry_budget_ratio"`
+
+	BackoffOnRatelimits    bool           `yaml:"backoff_on_ratelimits"`
+	BackoffHonorRetryAfter bool           `yaml:"backoff_honor_retry_after"`
+	BackoffConfig          backoff.Config `yaml:"backoff_config"`
 
 	TLSEnabled               bool             `yaml:"tls_enabled"`
 	TLS                      tls.ClientConfig `yaml:",inline"`
 	SignWriteRequestsEnabled bool             `yaml:"-"`
+
+	// TargetTLSConfigs is consulted for the TLS config to connect to each target, before
+	// falling back to the global TLS config.
+	TargetTLSConfigs TargetMatcherTLSProvider `yaml:"target_tls_configs" doc:"nocli|description=[Experimental] List of TLS configs used to connect to the targets whose address matches their regex, the first matching one being used, like while migrating the cluster to mTLS. The global TLS config is used for the targets not matched by any of them."`
+
+	// TLSProvider, if set, is consulted instead of the TargetTLSConfigs.
+	TLSProvider TLSProvider `yaml:"-"`
 }
 
 // RegisterFlags registers flags.
@@ -46,7 +86,28 @@ func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	f.StringVar(&cfg.GRPCCompression, prefix+".grpc-compression", "", "Use compression when sending messages. Supported values are: 'gzip', 'snappy', 'snappy-block' ,'zstd' and '' (disable compression)")
 	f.Float64Var(&cfg.RateLimit, prefix+".grpc-client-rate-limit", 0., "Rate limit for gRPC client; 0 means disabled.")
 	f.IntVar(&cfg.RateLimitBurst, prefix+".grpc-client-rate-limit-burst", 0, "Rate limit burst for gRPC client.")
+	f.Float64Var(&cfg.RateLimitPerTenant, prefix+".grpc-client-rate-limit-per-tenant", 0., "[Experimental] Rate limit for gRPC client of each tenant, keyed on the org ID of the outgoing requests, so that a tenant can't exhaust the rate limit shared by all the tenants. The requests without org ID are not limited per tenant. 0 means disabled.")
+	f.IntVar(&cfg.RateLimitPerTenantBurst, prefix+".grpc-client-rate-limit-per-tenant-burst", 0, "[Experimental] Rate limit burst for gRPC client of each tenant. 0 means the per-tenant rate limit, with a minimum of 1.")
+	f.StringVar(&cfg.LoadBalancingPolicy, prefix+".grpc-load-balancing-policy", "", "gRPC load balancing policy used to pick the connection to send each request to, among the addresses the target resolves to. Supported values are the policies registered in the gRPC library, like 'pick_first' and 'round_robin'. If empty, the gRPC default 'pick_first' policy is used.")
+	f.StringVar(&cfg.ServiceConfig, prefix+".grpc-service-config", "", "[Experimental] gRPC service config, in JSON, applied to the connections unless the target resolver provides one, like '{\"loadBalancingConfig\": [{\"round_robin\": {}}], \"methodConfig\": [{\"name\": [{}], \"timeout\": \"10s\"}]}'. The load balancing policies are the ones registered in the gRPC library. It can't be set together with the load balancing policy.")
+	f.BoolVar(&cfg.TracingStatsHandlerEnabled, prefix+".grpc-tracing-stats-handler-enabled", false, "[Experimental] Trace the outgoing RPCs with the OpenTelemetry gRPC stats handler, which creates a client span with the standard RPC attributes for each RPC and propagates the trace context to the server. The spans are created in addition to the OpenTracing ones of the gRPC client interceptors, if any.")
+	f.StringVar(&cfg.ProxyURL, prefix+".grpc-proxy-url", "", "[Experimental] URL of the proxy to connect to the servers through, either an HTTP proxy with the 'http' scheme, using the HTTP CONNECT method, or a SOCKS5 proxy with the 'socks5' scheme. The user info of the URL, if any, is used to authenticate to the proxy. If empty, the proxy set by the HTTPS_PROXY and NO_PROXY environment variables is used, if any.")
+	f.DurationVar(&cfg.TCPKeepAliveIdle, prefix+".grpc-tcp-keepalive-idle", 0, "[Experimental] Time the connection must be idle before the TCP keepalive probes are sent, set at the socket level to detect the half-open connections the gRPC keepalive pings don't, like the ones dropped by NATs. It must be a number of seconds. The TCP keepalive is enabled on the connections only if any of the TCP keepalive parameters is set, with the OS defaults for the others. Only supported on Linux. 0 = OS default.")
+	f.DurationVar(&cfg.TCPKeepAliveInterval, prefix+".grpc-tcp-keepalive-interval", 0, "[Experimental] Time between the TCP keepalive probes. It must be a number of seconds. Only supported on Linux. 0 = OS default.")
+	f.IntVar(&cfg.TCPKeepAliveCount, prefix+".grpc-tcp-keepalive-count", 0, "[Experimental] Number of unanswered TCP keepalive probes before the connection is closed. Only supported on Linux. 0 = OS default.")
+	f.DurationVar(&cfg.HedgingDelay, prefix+".grpc-hedging-delay", 0, "[Experimental] Delay after which a unary call of the hedged methods is sent again if no response has been received yet, the first successful response winning. It should be set around the p99 latency of the methods. The hedged calls are sent over the same connection, so they reach another replica only if the target resolves to multiple addresses and the load balancing policy, like 'round_robin', spreads the calls. The clients connecting to a single replica, like the ingester and store-gateway ones, only send the hedged calls to the same replica. 0 = disabled.")
+	f.IntVar(&cfg.HedgingMaxAttempts, prefix+".grpc-hedging-max-attempts", 2, "[Experimental] Max number of attempts of a hedged call, the original one included.")
+	f.Var(&cfg.HedgingMethods, prefix+".grpc-hedging-methods", "[Experimental] Comma separated list of the full names of the methods to hedge, like '/grpc.health.v1.Health/Check'. Only the unary methods are hedged, the streaming ones being sent once, and only the idempotent ones should be hedged.")
+	f.BoolVar(&cfg.CircuitBreakerEnabled, prefix+".circuit-breaker-enabled", false, "[Experimental] Enable the circuit breaker, failing the RPCs immediately instead of sending them to a server that is consistently failing, like an unhealthy ingester. Only the errors telling the server is failing, like the unavailable, timed out or internal errors, are counted as failures.")
+	f.UintVar(&cfg.CircuitBreakerFailureThreshold, prefix+".circuit-breaker-failure-threshold", 5, "[Experimental] Number of consecutive failed RPCs opening the circuit breaker.")
+	f.DurationVar(&cfg.CircuitBreakerCooldown, prefix+".circuit-breaker-cooldown", 10*time.Second, "[Experimental] Time the circuit breaker stays open, failing the RPCs, before letting probe RPCs through.")
+	f.UintVar(&cfg.CircuitBreakerHalfOpenProbes, prefix+".circuit-breaker-half-open-probes", 1, "[Experimental] Number of probe RPCs let through once the cooldown has elapsed. The circuit breaker closes if they all succeed, and opens again on the first failure.")
+	f.Var(&cfg.RetryCodes, prefix+".grpc-retry-codes", "[Experimental] Comma separated list of the gRPC codes of the failed unary calls to retry, like 'Unavailable,ResourceExhausted', backing off between the attempts with the backoff min and max periods. The codes are the names of the gRPC library codes. Only the idempotent calls should be retried with codes other than 'Unavailable'. The retry is disabled if empty.")
+	f.IntVar(&cfg.RetryMaxAttempts, prefix+".grpc-retry-max-attempts", 3, "[Experimental] Max number of attempts of a retried call, the original one included.")
+	f.DurationVar(&cfg.RetryPerTryTimeout, prefix+".grpc-retry-per-try-timeout", 0, "[Experimental] Timeout of each attempt of a retried call. The attempts timing out are retried only if 'DeadlineExceeded' is a retry code. 0 = disabled.")
+	f.Float64Var(&cfg.RetryBudgetRatio, prefix+".grpc-retry-budget-ratio", 0.1, "[Experimental] Max ratio of the retries to the calls, allowing bursts of 10 retries, to avoid overloading a failing server with the retries. 0 = no budget.")
 	f.BoolVar(&cfg.BackoffOnRatelimits, prefix+".backoff-on-ratelimits", false, "Enable backoff and retry when we hit ratelimits.")
+	f.BoolVar(&cfg.BackoffHonorRetryAfter, prefix+".backoff-honor-retry-after", false, "[Experimental] When backing off on ratelimits, wait for the retry-after duration in the response metadata, if set by the server, instead of the backoff time. The duration is capped to the backoff max period.")
 	f.BoolVar(&cfg.TLSEnabled, prefix+".tls-enabled", cfg.TLSEnabled, "Enable TLS in the GRPC client. This flag needs to be enabled when any other TLS flag is set. If set to false, insecure connection to gRPC server will be used.")
 
 	cfg.BackoffConfig.RegisterFlagsWithPrefix(prefix, f)
@@ -55,13 +116,37 @@ func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 }
 
 func (cfg *Config) Validate(log log.Logger) error {
-	switch cfg.GRPCCompression {
+	if !isSupportedCompression(cfg.GRPCCompression) {
+		return errors.Errorf("unsupported compression type: %s", cfg.GRPCCompression)
+	}
+	if err := cfg.validateMethodCompressionOverrides(); err != nil {
+		return err
+	}
+	if err := cfg.validateRetry(); err != nil {
+		return err
+	}
+	if err := cfg.validateHedging(); err != nil {
+		return err
+	}
+	if err := cfg.validateCircuitBreaker(); err != nil {
+		return err
+	}
+	if err := cfg.validateServiceConfig(); err != nil {
+		return err
+	}
+	if err := cfg.validateProxy(); err != nil {
+		return err
+	}
+	return cfg.validateTCPKeepAlive()
+}
+
+func isSupportedCompression(compression string) bool {
+	switch compression {
 	case gzip.Name, snappy.Name, zstd.Name, snappyblock.Name, "":
-		// valid
+		return true
 	default:
-		return errors.Errorf("unsupported compression type: %s", cfg.GRPCCompression)
+		return false
 	}
-	return nil
 }
 
 // CallOptions returns the config in terms of CallOptions.
@@ -75,27 +160,84 @@ func (cfg *Config) CallOptions() []grpc.CallOption {
 	return opts
 }
 
-// DialOption returns the config as a grpc.DialOptions.
+// DialOption returns the config as a grpc.DialOptions, using the global TLS config.
 func (cfg *Config) DialOption(unaryClientInterceptors []grpc.UnaryClientInterceptor, streamClientInterceptors []grpc.StreamClientInterceptor) ([]grpc.DialOption, error) {
+	return cfg.DialOptionForTarget("", unaryClientInterceptors, streamClientInterceptors)
+}
+
+// DialOptionForTarget returns the config as a grpc.DialOptions to connect to the target
+// address, using the TLS config returned by the TLSProvider or the TargetTLSConfigs for the
+// target, if any.
+func (cfg *Config) DialOptionForTarget(target string, unaryClientInterceptors []grpc.UnaryClientInterceptor, streamClientInterceptors []grpc.StreamClientInterceptor) ([]grpc.DialOption, error) {
 	var opts []grpc.DialOption
-	tlsOpts, err := cfg.TLS.GetGRPCDialOptions(cfg.TLSEnabled)
+	tlsEnabled, tlsCfg := cfg.TLSEnabled, cfg.TLS
+	provider := cfg.TLSProvider
+	if provider == nil && len(cfg.TargetTLSConfigs) > 0 {
+		provider = cfg.TargetTLSConfigs
+	}
+	if provider != nil && target != "" {
+		if enabled, targetTLSCfg, found := provider.TLSConfigForTarget(target); found {
+			tlsEnabled, tlsCfg = enabled, targetTLSCfg
+		}
+	}
+	tlsOpts, err := tlsCfg.GetGRPCDialOptions(tlsEnabled)
 	if err != nil {
 		return nil, err
 	}
 	opts = append(opts, tlsOpts...)
 
+	// The circuit breaker accounts each attempt of the RPCs retried by the backoff.
+	if cfg.CircuitBreakerEnabled {
+		cb := NewCircuitBreaker(cfg, target)
+		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{cb.UnaryClientInterceptor()}, unaryClientInterceptors...)
+		streamClientInterceptors = append([]grpc.StreamClientInterceptor{cb.StreamClientInterceptor()}, streamClientInterceptors...)
+	}
+
+	if cfg.retryEnabled() {
+		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewRetry(cfg)}, unaryClientInterceptors...)
+	}
+
 	if cfg.BackoffOnRatelimits {
-		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewBackoffRetry(cfg.BackoffConfig)}, unaryClientInterceptors...)
+		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewBackoffRetry(cfg.BackoffConfig, cfg.BackoffHonorRetryAfter)}, unaryClientInterceptors...)
 	}
 
 	if cfg.RateLimit > 0 {
 		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewRateLimiter(cfg)}, unaryClientInterceptors...)
 	}
 
+	// The per-tenant rate limit is applied first, so that the requests of a throttled tenant
+	// don't consume the shared rate limit while waiting.
+	if cfg.RateLimitPerTenant > 0 {
+		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewPerTenantRateLimiter(cfg)}, unaryClientInterceptors...)
+	}
+
+	if len(cfg.MethodCompressionOverrides) > 0 {
+		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewMethodCompressionUnaryClientInterceptor(cfg.MethodCompressionOverrides)}, unaryClientInterceptors...)
+		streamClientInterceptors = append([]grpc.StreamClientInterceptor{NewMethodCompressionStreamClientInterceptor(cfg.MethodCompressionOverrides)}, streamClientInterceptors...)
+	}
+
+	// The hedging is applied first, so that each attempt is rate limited and accounted by the
+	// circuit breaker.
+	if cfg.hedgingEnabled() {
+		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewHedgingUnaryClientInterceptor(cfg)}, unaryClientInterceptors...)
+	}
+
 	if cfg.SignWriteRequestsEnabled {
 		unaryClientInterceptors = append(unaryClientInterceptors, UnarySigningClientInterceptor)
 	}
 
+	if serviceConfig := cfg.serviceConfig(); serviceConfig != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+
+	if cfg.TracingStatsHandlerEnabled {
+		opts = append(opts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	}
+
+	if dialer := cfg.contextDialer(); dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(dialer))
+	}
+
 	return append(
 		opts,
 		grpc.WithDefaultCallOptions(cfg.CallOptions()...),
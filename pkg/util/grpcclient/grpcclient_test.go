@@ -0,0 +1,304 @@
+package grpcclient_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cortexproject/cortex/pkg/util/grpcclient"
+	"github.com/cortexproject/cortex/pkg/util/grpcencoding/snappy"
+	"github.com/cortexproject/cortex/pkg/util/tls"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		loadBalancingPolicy string
+		compression         string
+		methodCompression   map[string]string
+		serviceConfig       string
+		expectedErr         string
+	}{
+		"should pass with the default load balancing policy": {
+			loadBalancingPolicy: "",
+		},
+		"should pass with pick_first load balancing policy": {
+			loadBalancingPolicy: "pick_first",
+		},
+		"should pass with round_robin load balancing policy": {
+			loadBalancingPolicy: "round_robin",
+		},
+		"should fail with unknown load balancing policy": {
+			loadBalancingPolicy: "unknown",
+			expectedErr:         "unsupported load balancing policy: unknown",
+		},
+		"should pass with a service config": {
+			serviceConfig: `{"loadBalancingConfig": [{"round_robin": {}}]}`,
+		},
+		"should fail with an invalid service config": {
+			serviceConfig: `{"loadBalancingConfig": [{"unknown": {}}]}`,
+			expectedErr:   `invalid service config: grpc: the provided default service config is invalid: no supported policies found in config: [{"unknown": {}}]`,
+		},
+		"should fail with both the load balancing policy and the service config": {
+			loadBalancingPolicy: "round_robin",
+			serviceConfig:       `{"loadBalancingConfig": [{"round_robin": {}}]}`,
+			expectedErr:         "the load balancing policy and the service config can't be set together, set the load balancing config in the service config instead",
+		},
+		"should pass with a supported compression": {
+			compression: "snappy",
+		},
+		"should fail with unknown compression": {
+			compression: "unknown",
+			expectedErr: "unsupported compression type: unknown",
+		},
+		"should pass with per-method compression overrides": {
+			compression:       "snappy",
+			methodCompression: map[string]string{"/cortex.Ingester/QueryStream": "zstd", "/cortex.Ingester/Push": ""},
+		},
+		"should fail with unknown per-method compression": {
+			compression:       "snappy",
+			methodCompression: map[string]string{"/cortex.Ingester/QueryStream": "unknown"},
+			expectedErr:       "unsupported compression type for method /cortex.Ingester/QueryStream: unknown",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.LoadBalancingPolicy = testData.loadBalancingPolicy
+			cfg.GRPCCompression = testData.compression
+			cfg.MethodCompressionOverrides = testData.methodCompression
+			cfg.ServiceConfig = testData.serviceConfig
+
+			err := cfg.Validate(log.NewNopLogger())
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testData.expectedErr)
+			}
+		})
+	}
+}
+
+func TestConfig_DialOption_ShouldApplyMethodCompressionOverrides(t *testing.T) {
+	recorder := &compressionRecorder{}
+
+	check := func(cfg grpcclient.Config) {
+		require.NoError(t, cfg.Validate(log.NewNopLogger()))
+
+		server := grpc.NewServer(grpc.StatsHandler(recorder))
+		grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+		conn, closer, err := grpcclient.DialInProcess(context.Background(), cfg, server, nil, nil)
+		require.NoError(t, err)
+		defer closer()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+
+	cfg := defaultConfig()
+	cfg.GRPCCompression = snappy.Name
+	check(cfg)
+
+	// The override takes precedence over the default compression.
+	cfg.MethodCompressionOverrides = map[string]string{"/grpc.health.v1.Health/Check": gzip.Name}
+	check(cfg)
+
+	// The overrides of other methods don't apply.
+	cfg.MethodCompressionOverrides = map[string]string{"/grpc.health.v1.Health/Watch": gzip.Name}
+	check(cfg)
+
+	// An empty override disables the compression.
+	cfg.MethodCompressionOverrides = map[string]string{"/grpc.health.v1.Health/Check": ""}
+	check(cfg)
+
+	assert.Equal(t, []string{snappy.Name, gzip.Name, snappy.Name, ""}, recorder.compressions)
+}
+
+func TestConfig_DialOption_ShouldApplyLoadBalancingPolicy(t *testing.T) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+	cfg := defaultConfig()
+	cfg.LoadBalancingPolicy = "round_robin"
+
+	conn, closer, err := grpcclient.DialInProcess(context.Background(), cfg, server, nil, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+
+	// The policy is applied through the default service config, which fails to dial when no policy is supported.
+	cfg.LoadBalancingPolicy = "unknown"
+	_, _, err = grpcclient.DialInProcess(context.Background(), cfg, grpc.NewServer(), nil, nil)
+	require.Error(t, err)
+}
+
+func TestConfig_DialOption_ShouldApplyServiceConfig(t *testing.T) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+	// The method config sets a timeout which has already expired.
+	cfg := defaultConfig()
+	cfg.ServiceConfig = `{"loadBalancingConfig": [{"round_robin": {}}], "methodConfig": [{"name": [{"service": "grpc.health.v1.Health"}], "timeout": "0.000000001s"}]}`
+	require.NoError(t, cfg.Validate(log.NewNopLogger()))
+
+	conn, closer, err := grpcclient.DialInProcess(context.Background(), cfg, server, nil, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestConfig_DialOptionForTarget_ShouldUseTheTargetTLSConfigs(t *testing.T) {
+	cfg := defaultConfig()
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+target_tls_configs:
+  # A missing CA file makes the dial options creation fail, telling which TLS config was used.
+  - target_regex: mtls-.*
+    tls_enabled: true
+    tls_ca_path: missing-ca.crt
+  - target_regex: plaintext-.*
+    tls_enabled: false
+`), &cfg))
+
+	_, err := cfg.DialOptionForTarget("mtls-ingester:9095", nil, nil)
+	assert.ErrorContains(t, err, "missing-ca.crt")
+
+	_, err = cfg.DialOptionForTarget("plaintext-ingester:9095", nil, nil)
+	assert.NoError(t, err)
+
+	// The regex must match the whole target.
+	_, err = cfg.DialOptionForTarget("other-mtls-ingester:9095", nil, nil)
+	assert.NoError(t, err)
+
+	// The targets not matched by any config use the global TLS config.
+	cfg.TLSEnabled = true
+	cfg.TLS.CAPath = "global-ca.crt"
+
+	_, err = cfg.DialOptionForTarget("plaintext-ingester:9095", nil, nil)
+	assert.NoError(t, err)
+
+	_, err = cfg.DialOptionForTarget("other-ingester:9095", nil, nil)
+	assert.ErrorContains(t, err, "global-ca.crt")
+
+	_, err = cfg.DialOption(nil, nil)
+	assert.ErrorContains(t, err, "global-ca.crt")
+}
+
+func TestConfig_ShouldFailOnInvalidTargetTLSConfigRegex(t *testing.T) {
+	cfg := defaultConfig()
+	err := yaml.UnmarshalStrict([]byte(`
+target_tls_configs:
+  - target_regex: "ingester-("
+`), &cfg)
+	assert.ErrorContains(t, err, `invalid target regex "ingester-("`)
+}
+
+func TestConfig_DialOptionForTarget_ShouldUseTheTLSProvider(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TLSProvider = tlsProviderFunc(func(target string) (bool, tls.ClientConfig, bool) {
+		return true, tls.ClientConfig{CAPath: "provider-ca.crt"}, target == "ingester:9095"
+	})
+
+	_, err := cfg.DialOptionForTarget("ingester:9095", nil, nil)
+	assert.ErrorContains(t, err, "provider-ca.crt")
+
+	_, err = cfg.DialOptionForTarget("store-gateway:9095", nil, nil)
+	assert.NoError(t, err)
+}
+
+type tlsProviderFunc func(target string) (bool, tls.ClientConfig, bool)
+
+func (f tlsProviderFunc) TLSConfigForTarget(target string) (bool, tls.ClientConfig, bool) {
+	return f(target)
+}
+
+func TestConfig_DialOption_ShouldTraceWithTheStatsHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	var traceParents []string
+
+	check := func(cfg grpcclient.Config) {
+		// The server records the trace context propagated by the client.
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			traceParents = append(traceParents, md.Get("traceparent")...)
+			return handler(ctx, req)
+		}))
+		grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+		conn, closer, err := grpcclient.DialInProcess(context.Background(), cfg, server, nil, nil)
+		require.NoError(t, err)
+		defer closer()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+
+	// The RPCs are not traced by default.
+	cfg := defaultConfig()
+	check(cfg)
+	assert.Empty(t, recorder.Ended())
+	assert.Empty(t, traceParents)
+
+	cfg.TracingStatsHandlerEnabled = true
+	check(cfg)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "grpc.health.v1.Health/Check", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contains(t, spans[0].Attributes(), otelgrpc.RPCSystemGRPC)
+
+	require.Len(t, traceParents, 1)
+	assert.Contains(t, traceParents[0], spans[0].SpanContext().TraceID().String())
+}
+
+// compressionRecorder records the compression of the requests received by the server.
+type compressionRecorder struct {
+	compressions []string
+}
+
+func (r *compressionRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		r.compressions = append(r.compressions, h.Compression)
+	}
+}
+
+func (r *compressionRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,97 @@
+package grpcclient
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+func (cfg *Config) hedgingEnabled() bool {
+	return cfg.HedgingDelay > 0
+}
+
+func (cfg *Config) validateHedging() error {
+	if cfg.HedgingDelay < 0 {
+		return errors.Errorf("invalid hedging delay: %s, it must be positive or 0 to disable the hedging", cfg.HedgingDelay)
+	}
+	if !cfg.hedgingEnabled() {
+		return nil
+	}
+	if cfg.HedgingMaxAttempts < 2 {
+		return errors.Errorf("invalid hedging max attempts: %d, it must be at least 2", cfg.HedgingMaxAttempts)
+	}
+	if len(cfg.HedgingMethods) == 0 {
+		return errors.New("the hedged methods must be set when the hedging is enabled")
+	}
+	return nil
+}
+
+type hedgingResult struct {
+	reply interface{}
+	err   error
+}
+
+// NewHedgingUnaryClientInterceptor creates a UnaryClientInterceptor hedging the calls of the
+// configured methods: while no response has been received, a new attempt of the call is sent
+// every hedging delay, up to the max attempts, and the first successful response wins. The
+// other attempts are canceled. The error of a failed attempt is returned if no other attempt
+// is in flight, the failures are not retried.
+//
+// The attempts are sent over the same connection, so they reach another replica only if the
+// target resolves to multiple addresses and the load balancing policy spreads the calls. The
+// streaming calls are not intercepted, so they are never hedged.
+func NewHedgingUnaryClientInterceptor(cfg *Config) grpc.UnaryClientInterceptor {
+	methods := make(map[string]struct{}, len(cfg.HedgingMethods))
+	for _, m := range cfg.HedgingMethods {
+		methods[m] = struct{}{}
+	}
+	delay, maxAttempts := cfg.HedgingDelay, cfg.HedgingMaxAttempts
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := methods[method]; !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Buffered so that the attempts completing after the winner don't block.
+		results := make(chan hedgingResult, maxAttempts)
+		attempt := func() {
+			// Each attempt decodes into its own reply, copied to the caller's one if it wins.
+			attemptReply := reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+			err := invoker(ctx, method, req, attemptReply, cc, opts...)
+			results <- hedgingResult{reply: attemptReply, err: err}
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		go attempt()
+		sent, inFlight := 1, 1
+		for {
+			select {
+			case <-timer.C:
+				go attempt()
+				sent++
+				inFlight++
+				if sent < maxAttempts {
+					timer.Reset(delay)
+				}
+
+			case res := <-results:
+				inFlight--
+				if res.err == nil {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+					return nil
+				}
+				if inFlight == 0 {
+					return res.err
+				}
+			}
+		}
+	}
+}
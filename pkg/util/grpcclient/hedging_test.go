@@ -0,0 +1,118 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestHedgingUnaryClientInterceptor(t *testing.T) {
+	const method = "/grpc.health.v1.Health/Check"
+
+	cfg := Config{
+		HedgingDelay:       50 * time.Millisecond,
+		HedgingMaxAttempts: 3,
+		HedgingMethods:     []string{method},
+	}
+	require.NoError(t, cfg.validateHedging())
+	interceptor := NewHedgingUnaryClientInterceptor(&cfg)
+
+	// attemptsInvoker replies after the latency of each attempt, with the attempt number as the
+	// response status, or with the error of the attempt if any.
+	attemptsInvoker := func(calls *atomic.Int32, latencies []time.Duration, errs []error) grpc.UnaryInvoker {
+		return func(ctx context.Context, _ string, _, reply interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			attempt := calls.Inc() - 1
+			select {
+			case <-time.After(latencies[attempt]):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if errs != nil && errs[attempt] != nil {
+				return errs[attempt]
+			}
+			reply.(*grpc_health_v1.HealthCheckResponse).Status = grpc_health_v1.HealthCheckResponse_ServingStatus(attempt)
+			return nil
+		}
+	}
+
+	t.Run("should not hedge a fast call", func(t *testing.T) {
+		calls := atomic.NewInt32(0)
+		reply := &grpc_health_v1.HealthCheckResponse{}
+		err := interceptor(context.Background(), method, nil, reply, nil, attemptsInvoker(calls, []time.Duration{0}, nil))
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_ServingStatus(0), reply.Status)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("should return the first successful response of the hedged attempts", func(t *testing.T) {
+		calls := atomic.NewInt32(0)
+		reply := &grpc_health_v1.HealthCheckResponse{}
+		start := time.Now()
+		err := interceptor(context.Background(), method, nil, reply, nil, attemptsInvoker(calls, []time.Duration{time.Minute, 0, time.Minute}, nil))
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_ServingStatus(1), reply.Status)
+		assert.Equal(t, int32(2), calls.Load())
+		assert.Less(t, time.Since(start), time.Minute)
+	})
+
+	t.Run("should send up to the max attempts", func(t *testing.T) {
+		calls := atomic.NewInt32(0)
+		reply := &grpc_health_v1.HealthCheckResponse{}
+		err := interceptor(context.Background(), method, nil, reply, nil, attemptsInvoker(calls, []time.Duration{time.Minute, time.Minute, 200 * time.Millisecond}, nil))
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_ServingStatus(2), reply.Status)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("should wait for the attempts in flight when an attempt fails", func(t *testing.T) {
+		calls := atomic.NewInt32(0)
+		reply := &grpc_health_v1.HealthCheckResponse{}
+		errs := []error{nil, status.Error(codes.Unavailable, "unavailable"), nil}
+		err := interceptor(context.Background(), method, nil, reply, nil, attemptsInvoker(calls, []time.Duration{200 * time.Millisecond, 0, time.Minute}, errs))
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_ServingStatus(0), reply.Status)
+		assert.GreaterOrEqual(t, calls.Load(), int32(2))
+	})
+
+	t.Run("should return the error when no other attempt is in flight", func(t *testing.T) {
+		calls := atomic.NewInt32(0)
+		reply := &grpc_health_v1.HealthCheckResponse{}
+		errs := []error{status.Error(codes.Unavailable, "unavailable")}
+		err := interceptor(context.Background(), method, nil, reply, nil, attemptsInvoker(calls, []time.Duration{0}, errs))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("should not hedge the other methods", func(t *testing.T) {
+		calls := atomic.NewInt32(0)
+		reply := &grpc_health_v1.HealthCheckResponse{}
+		err := interceptor(context.Background(), "/grpc.health.v1.Health/Other", nil, reply, nil, attemptsInvoker(calls, []time.Duration{200 * time.Millisecond}, nil))
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestConfig_ValidateHedging(t *testing.T) {
+	cfg := Config{HedgingMaxAttempts: 1}
+	require.NoError(t, cfg.validateHedging())
+
+	cfg.HedgingDelay = -time.Second
+	assert.EqualError(t, cfg.validateHedging(), "invalid hedging delay: -1s, it must be positive or 0 to disable the hedging")
+
+	cfg.HedgingDelay = time.Second
+	assert.EqualError(t, cfg.validateHedging(), "invalid hedging max attempts: 1, it must be at least 2")
+
+	cfg.HedgingMaxAttempts = 2
+	assert.EqualError(t, cfg.validateHedging(), "the hedged methods must be set when the hedging is enabled")
+
+	cfg.HedgingMethods = []string{"/cortex.Ingester/QueryStream"}
+	assert.NoError(t, cfg.validateHedging())
+}
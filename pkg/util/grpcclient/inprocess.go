@@ -0,0 +1,44 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const inProcessBufferSize = 1024 * 1024
+
+// DialInProcess serves the given gRPC server on an in-memory listener and returns a client
+// connection to it, dialed with the dial options built from the config, including all the
+// configured interceptors. It's intended to be used by tests which need to exercise the
+// client config without real networking. The returned function closes the connection and
+// stops the server.
+func DialInProcess(ctx context.Context, cfg Config, server *grpc.Server, unaryClientInterceptors []grpc.UnaryClientInterceptor, streamClientInterceptors []grpc.StreamClientInterceptor) (*grpc.ClientConn, func(), error) {
+	opts, err := cfg.DialOption(unaryClientInterceptors, streamClientInterceptors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener := bufconn.Listen(inProcessBufferSize)
+	go func() {
+		// Serve returns once the server is stopped.
+		_ = server.Serve(listener)
+	}()
+
+	opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+
+	conn, err := grpc.DialContext(ctx, "in-process", opts...)
+	if err != nil {
+		server.Stop()
+		return nil, nil, err
+	}
+
+	return conn, func() {
+		_ = conn.Close()
+		server.Stop()
+	}, nil
+}
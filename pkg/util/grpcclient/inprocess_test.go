@@ -0,0 +1,108 @@
+package grpcclient_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/grpcclient"
+)
+
+func TestDialInProcess_ShouldApplyUnaryClientInterceptors(t *testing.T) {
+	server := grpc.NewServer()
+	healthServer := &mockHealthServer{}
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+
+	var intercepted []string
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		intercepted = append(intercepted, method)
+		return invoker(metadata.AppendToOutgoingContext(ctx, "intercepted", "true"), method, req, reply, cc, opts...)
+	}
+
+	conn, closer, err := grpcclient.DialInProcess(context.Background(), defaultConfig(), server, []grpc.UnaryClientInterceptor{interceptor}, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	assert.Equal(t, []string{"/grpc.health.v1.Health/Check"}, intercepted)
+	assert.Equal(t, []string{"true"}, healthServer.intercepted)
+}
+
+func TestDialInProcess_ShouldApplyStreamClientInterceptors(t *testing.T) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+	var intercepted []string
+	interceptor := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		intercepted = append(intercepted, method)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	conn, closer, err := grpcclient.DialInProcess(context.Background(), defaultConfig(), server, nil, []grpc.StreamClientInterceptor{interceptor})
+	require.NoError(t, err)
+	defer closer()
+
+	stream, err := grpc_health_v1.NewHealthClient(conn).Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	assert.Equal(t, []string{"/grpc.health.v1.Health/Watch"}, intercepted)
+}
+
+func TestDialInProcess_ShouldApplyConfiguredRateLimiter(t *testing.T) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, &mockHealthServer{})
+
+	cfg := defaultConfig()
+	cfg.RateLimit = 0.001
+	cfg.RateLimitBurst = 1
+
+	conn, closer, err := grpcclient.DialInProcess(context.Background(), cfg, server, nil, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// The burst has been consumed, so the next request is rate-limited.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func defaultConfig() grpcclient.Config {
+	cfg := grpcclient.Config{}
+	flagext.DefaultValues(&cfg)
+	return cfg
+}
+
+type mockHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+
+	intercepted []string
+}
+
+func (m *mockHealthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	m.intercepted = md.Get("intercepted")
+
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (m *mockHealthServer) Watch(_ *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	return stream.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING})
+}
@@ -0,0 +1,40 @@
+package grpcclient
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+func (cfg *Config) validateMethodCompressionOverrides() error {
+	for method, compression := range cfg.MethodCompressionOverrides {
+		if !isSupportedCompression(compression) {
+			return errors.Errorf("unsupported compression type for method %s: %s", method, compression)
+		}
+	}
+	return nil
+}
+
+// NewMethodCompressionUnaryClientInterceptor creates a UnaryClientInterceptor compressing the
+// messages sent by the overridden methods with their compression, instead of the default one.
+func NewMethodCompressionUnaryClientInterceptor(overrides map[string]string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if compression, ok := overrides[method]; ok {
+			// The call options are applied after the default ones, so the last compressor wins.
+			opts = append(opts, grpc.UseCompressor(compression))
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// NewMethodCompressionStreamClientInterceptor is the StreamClientInterceptor version of
+// NewMethodCompressionUnaryClientInterceptor.
+func NewMethodCompressionStreamClientInterceptor(overrides map[string]string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if compression, ok := overrides[method]; ok {
+			opts = append(opts, grpc.UseCompressor(compression))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,177 @@
+package grpcclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	proxySchemeHTTP   = "http"
+	proxySchemeSOCKS5 = "socks5"
+)
+
+// proxyFromEnvironment returns the proxy set by the HTTPS_PROXY and NO_PROXY environment variables.
+var proxyFromEnvironment = http.ProxyFromEnvironment
+
+func (cfg *Config) validateProxy() error {
+	if cfg.ProxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.ProxyURL)
+	if err != nil {
+		return errors.Wrap(err, "invalid proxy URL")
+	}
+	if u.Scheme != proxySchemeHTTP && u.Scheme != proxySchemeSOCKS5 {
+		return errors.Errorf("unsupported proxy URL scheme: %s, supported schemes are %s and %s", u.Scheme, proxySchemeHTTP, proxySchemeSOCKS5)
+	}
+	if u.Host == "" {
+		return errors.Errorf("invalid proxy URL: %s, the host is missing", cfg.ProxyURL)
+	}
+	return nil
+}
+
+// contextDialer returns the dialer of the gRPC connections, or nil to use the gRPC default one.
+// The custom dialers look up the proxy in the environment when no proxy URL is configured,
+// like the gRPC default dialer does.
+func (cfg *Config) contextDialer() func(ctx context.Context, addr string) (net.Conn, error) {
+	if cfg.ProxyURL == "" && !cfg.tcpKeepAliveEnabled() {
+		return nil
+	}
+
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	if cfg.tcpKeepAliveEnabled() {
+		dial = cfg.tcpKeepAliveDialer()
+	}
+
+	var proxyURL *url.URL
+	if cfg.ProxyURL != "" {
+		// The URL has already been validated.
+		proxyURL, _ = url.Parse(cfg.ProxyURL)
+	}
+	return proxyDialer(proxyURL, dial)
+}
+
+// proxyDialer returns a dialer connecting to the target addresses through the proxy, either
+// with the HTTP CONNECT method or the SOCKS5 protocol. If the proxy URL is nil, the proxy is
+// looked up in the environment for each address, and the addresses without proxy are dialed
+// directly.
+func proxyDialer(proxyURL *url.URL, dial func(ctx context.Context, addr string) (net.Conn, error)) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		u := proxyURL
+		if u == nil {
+			var err error
+			if u, err = proxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}}); err != nil {
+				return nil, err
+			}
+			if u == nil {
+				return dial(ctx, addr)
+			}
+		}
+
+		if u.Scheme == proxySchemeSOCKS5 {
+			conn, err := socks5Dial(ctx, u, addr, dial)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to connect to %s through the proxy %s", addr, u.Host)
+			}
+			return conn, nil
+		}
+
+		conn, err := dial(ctx, u.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		// The handshake with the proxy is bounded by the dial deadline.
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		conn, err = httpConnectHandshake(conn, addr, u.User)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to connect to %s through the proxy %s", addr, u.Host)
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// bufConn is a net.Conn reading from the buffered reader of the connection, so that the bytes
+// buffered while reading the proxy response are not lost.
+type bufConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func httpConnectHandshake(conn net.Conn, addr string, user *url.Userinfo) (_ net.Conn, err error) {
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected proxy response status: %s", resp.Status)
+	}
+	return &bufConn{Conn: conn, r: r}, nil
+}
+
+// dialerFunc is a proxy.ContextDialer dialing the connections to the proxy with the dial function.
+type dialerFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+func (f dialerFunc) Dial(_, addr string) (net.Conn, error) {
+	return f(context.Background(), addr)
+}
+
+func (f dialerFunc) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	return f(ctx, addr)
+}
+
+// socks5Dial connects to the address through the SOCKS5 proxy, authenticating with the
+// username and password of the proxy URL if set.
+func socks5Dial(ctx context.Context, u *url.URL, addr string, dial func(ctx context.Context, addr string) (net.Conn, error)) (net.Conn, error) {
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	d, err := proxy.SOCKS5("tcp", u.Host, auth, dialerFunc(dial))
+	if err != nil {
+		return nil, err
+	}
+	// The SOCKS5 dialer of golang.org/x/net always implements proxy.ContextDialer.
+	return d.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+}
@@ -2,7 +2,10 @@ package grpcclient
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"github.com/weaveworks/common/user"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -24,3 +27,76 @@ func NewRateLimiter(cfg *Config) grpc.UnaryClientInterceptor {
 		return invoker(ctx, method, req, reply, cc, opts...)
 	}
 }
+
+// idleTenantRateLimitersEvictionInterval is how often the limiters of the idle tenants are evicted.
+const idleTenantRateLimitersEvictionInterval = time.Minute
+
+// NewPerTenantRateLimiter creates a UnaryClientInterceptor for client side rate limiting of
+// each tenant, keyed on the org ID of the outgoing context, so that a tenant can't exhaust
+// the rate limit shared by all the tenants. The calls without org ID are not limited.
+func NewPerTenantRateLimiter(cfg *Config) grpc.UnaryClientInterceptor {
+	limiters := newPerTenantRateLimiter(cfg)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if userID, err := user.ExtractOrgID(ctx); err == nil {
+			if err := limiters.tenantLimiter(userID).Wait(ctx); err != nil {
+				return status.Errorf(codes.ResourceExhausted, "tenant %s: %s", userID, err)
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// perTenantRateLimiter holds the rate limiter of each tenant. The limiters of the idle tenants
+// are periodically evicted, so that they don't accumulate for all the tenants ever seen.
+type perTenantRateLimiter struct {
+	limit rate.Limit
+	burst int
+	now   func() time.Time
+
+	mtx          sync.Mutex
+	limiters     map[string]*rate.Limiter
+	lastEviction time.Time
+}
+
+func newPerTenantRateLimiter(cfg *Config) *perTenantRateLimiter {
+	burst := cfg.RateLimitPerTenantBurst
+	if burst == 0 {
+		burst = max(int(cfg.RateLimitPerTenant), 1)
+	}
+
+	return &perTenantRateLimiter{
+		limit:        rate.Limit(cfg.RateLimitPerTenant),
+		burst:        burst,
+		now:          time.Now,
+		limiters:     map[string]*rate.Limiter{},
+		lastEviction: time.Now(),
+	}
+}
+
+func (l *perTenantRateLimiter) tenantLimiter(userID string) *rate.Limiter {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if now := l.now(); now.Sub(l.lastEviction) >= idleTenantRateLimitersEvictionInterval {
+		l.evictIdle(now)
+		l.lastEviction = now
+	}
+
+	limiter, ok := l.limiters[userID]
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[userID] = limiter
+	}
+	return limiter
+}
+
+// evictIdle removes the limiters whose tokens are all available again, since they behave like
+// new limiters. Must be called with the lock held.
+func (l *perTenantRateLimiter) evictIdle(now time.Time) {
+	for userID, limiter := range l.limiters {
+		if limiter.TokensAt(now) >= float64(l.burst) {
+			delete(l.limiters, userID)
+		}
+	}
+}
@@ -1,19 +1,21 @@
-package grpcclient_test
+package grpcclient
 
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-
-	"github.com/cortexproject/cortex/pkg/util/grpcclient"
 )
 
 func TestRateLimiterFailureResultsInResourceExhaustedError(t *testing.T) {
-	config := grpcclient.Config{
+	config := Config{
 		RateLimitBurst: 0,
 		RateLimit:      0,
 	}
@@ -22,7 +24,7 @@ func TestRateLimiterFailureResultsInResourceExhaustedError(t *testing.T) {
 		return nil
 	}
 
-	limiter := grpcclient.NewRateLimiter(&config)
+	limiter := NewRateLimiter(&config)
 	err := limiter(context.Background(), "methodName", "", "expectedReply", &conn, invoker)
 
 	if se, ok := err.(interface {
@@ -34,3 +36,71 @@ func TestRateLimiterFailureResultsInResourceExhaustedError(t *testing.T) {
 		assert.Fail(t, "Could not convert error into expected Status type")
 	}
 }
+
+func TestPerTenantRateLimiter(t *testing.T) {
+	config := Config{
+		RateLimitPerTenant:      1,
+		RateLimitPerTenantBurst: 2,
+	}
+	conn := grpc.ClientConn{}
+	calls := 0
+	invoker := func(currentCtx context.Context, currentMethod string, currentReq, currentRepl interface{}, currentConn *grpc.ClientConn, currentOpts ...grpc.CallOption) error {
+		calls++
+		return nil
+	}
+	limiter := NewPerTenantRateLimiter(&config)
+
+	// The rate limit would be exceeded by the wait for the next token, given the deadline.
+	call := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		return limiter(ctx, "methodName", "", "expectedReply", &conn, invoker)
+	}
+
+	// The burst of the noisy tenant is exhausted.
+	noisyCtx := user.InjectOrgID(context.Background(), "noisy")
+	require.NoError(t, call(noisyCtx))
+	require.NoError(t, call(noisyCtx))
+	err := call(noisyCtx)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "tenant noisy")
+
+	// The other tenants and the requests without tenant are not limited by the noisy tenant.
+	require.NoError(t, call(user.InjectOrgID(context.Background(), "other")))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, call(context.Background()))
+	}
+	assert.Equal(t, 8, calls)
+}
+
+func TestPerTenantRateLimiter_ShouldEvictIdleTenants(t *testing.T) {
+	// A token is refilled every 1000s.
+	limiters := newPerTenantRateLimiter(&Config{RateLimitPerTenant: 0.001, RateLimitPerTenantBurst: 1})
+	start := time.Now()
+	limiters.now = func() time.Time { return start }
+
+	require.True(t, limiters.tenantLimiter("busy").Allow())
+	limiters.tenantLimiter("idle")
+
+	// The limiters are not evicted before the interval.
+	limiters.tenantLimiter("other")
+	assert.Len(t, limiters.limiters, 3)
+
+	// The idle tenant is evicted, while the busy one is still waiting for its token.
+	limiters.now = func() time.Time { return start.Add(idleTenantRateLimitersEvictionInterval) }
+	limiters.tenantLimiter("other")
+	assert.ElementsMatch(t, []string{"busy", "other"}, mapKeys(limiters.limiters))
+
+	// Once its token is refilled, the busy tenant is evicted too.
+	limiters.now = func() time.Time { return start.Add(2000 * time.Second) }
+	limiters.tenantLimiter("other")
+	assert.ElementsMatch(t, []string{"other"}, mapKeys(limiters.limiters))
+}
+
+func mapKeys(m map[string]*rate.Limiter) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,133 @@
+package grpcclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/util/backoff"
+)
+
+// retryBudgetMaxTokens is the max number of retries the retry budget allows in a burst.
+const retryBudgetMaxTokens = 10
+
+func (cfg *Config) retryEnabled() bool {
+	return len(cfg.RetryCodes) > 0
+}
+
+func (cfg *Config) validateRetry() error {
+	if _, err := parseRetryCodes(cfg.RetryCodes); err != nil {
+		return err
+	}
+	if !cfg.retryEnabled() {
+		return nil
+	}
+	if cfg.RetryMaxAttempts < 2 {
+		return errors.Errorf("invalid retry max attempts: %d, it must be at least 2", cfg.RetryMaxAttempts)
+	}
+	if cfg.RetryPerTryTimeout < 0 {
+		return errors.Errorf("invalid retry per-try timeout: %s, it must be positive or 0 to disable it", cfg.RetryPerTryTimeout)
+	}
+	if cfg.RetryBudgetRatio < 0 {
+		return errors.Errorf("invalid retry budget ratio: %v, it must be positive or 0 to disable the retry budget", cfg.RetryBudgetRatio)
+	}
+	return nil
+}
+
+// parseRetryCodes parses the names of the gRPC codes, like "Unavailable".
+func parseRetryCodes(names []string) (map[codes.Code]struct{}, error) {
+	known := map[string]codes.Code{}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		known[c.String()] = c
+	}
+
+	retryCodes := make(map[codes.Code]struct{}, len(names))
+	for _, name := range names {
+		c, ok := known[name]
+		if !ok {
+			return nil, errors.Errorf("unsupported retry code: %s", name)
+		}
+		retryCodes[c] = struct{}{}
+	}
+	return retryCodes, nil
+}
+
+// retryBudget limits the ratio of the retries to the requests. Each request deposits the ratio
+// in the budget, up to retryBudgetMaxTokens, and each retry withdraws one token. The budget is
+// disabled if the ratio is 0.
+type retryBudget struct {
+	ratio float64
+
+	mtx    sync.Mutex
+	tokens float64
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio, tokens: retryBudgetMaxTokens}
+}
+
+func (b *retryBudget) deposit() {
+	if b.ratio == 0 {
+		return
+	}
+	b.mtx.Lock()
+	b.tokens = min(b.tokens+b.ratio, retryBudgetMaxTokens)
+	b.mtx.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	if b.ratio == 0 {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// NewRetry creates a UnaryClientInterceptor retrying the calls failing with one of the retry
+// codes, up to the max attempts and as long as the retry budget allows it, backing off between
+// the attempts. If the per-try timeout is set, each attempt is canceled after it.
+func NewRetry(cfg *Config) grpc.UnaryClientInterceptor {
+	// The codes have already been validated.
+	retryCodes, _ := parseRetryCodes(cfg.RetryCodes)
+	backoffCfg := backoff.Config{MinBackoff: cfg.BackoffConfig.MinBackoff, MaxBackoff: cfg.BackoffConfig.MaxBackoff}
+	maxAttempts, perTryTimeout := cfg.RetryMaxAttempts, cfg.RetryPerTryTimeout
+	budget := newRetryBudget(cfg.RetryBudgetRatio)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		budget.deposit()
+
+		invoke := func() error {
+			if perTryTimeout <= 0 {
+				return invoker(ctx, method, req, reply, cc, opts...)
+			}
+			tryCtx, cancel := context.WithTimeout(ctx, perTryTimeout)
+			defer cancel()
+			return invoker(tryCtx, method, req, reply, cc, opts...)
+		}
+
+		backoff := backoff.New(ctx, backoffCfg)
+		for attempt := 1; ; attempt++ {
+			err := invoke()
+			if err == nil || attempt >= maxAttempts || ctx.Err() != nil {
+				return err
+			}
+			if _, ok := retryCodes[status.Code(err)]; !ok || !budget.withdraw() {
+				return err
+			}
+
+			backoff.Wait()
+			if ctx.Err() != nil {
+				return err
+			}
+		}
+	}
+}
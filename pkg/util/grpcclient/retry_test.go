@@ -0,0 +1,129 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/util/backoff"
+)
+
+func TestRetry(t *testing.T) {
+	newConfig := func() Config {
+		return Config{
+			RetryCodes:       []string{"Unavailable", "DeadlineExceeded"},
+			RetryMaxAttempts: 3,
+			BackoffConfig:    backoff.Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		}
+	}
+
+	// failingInvoker fails with the errors of the first calls, then succeeds.
+	failingInvoker := func(calls *int, errs ...error) grpc.UnaryInvoker {
+		return func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			*calls++
+			if *calls <= len(errs) {
+				return errs[*calls-1]
+			}
+			return nil
+		}
+	}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	t.Run("should retry the retry codes", func(t *testing.T) {
+		cfg := newConfig()
+		require.NoError(t, cfg.validateRetry())
+
+		calls := 0
+		err := NewRetry(&cfg)(context.Background(), "method", nil, nil, nil, failingInvoker(&calls, unavailable, status.Error(codes.DeadlineExceeded, "timeout")))
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should not retry the other codes", func(t *testing.T) {
+		cfg := newConfig()
+
+		calls := 0
+		err := NewRetry(&cfg)(context.Background(), "method", nil, nil, nil, failingInvoker(&calls, status.Error(codes.InvalidArgument, "invalid")))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should stop after the max attempts", func(t *testing.T) {
+		cfg := newConfig()
+
+		calls := 0
+		err := NewRetry(&cfg)(context.Background(), "method", nil, nil, nil, failingInvoker(&calls, unavailable, unavailable, unavailable, unavailable))
+		assert.Equal(t, unavailable, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should time out each attempt after the per-try timeout", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.RetryPerTryTimeout = 10 * time.Millisecond
+
+		calls := 0
+		err := NewRetry(&cfg)(context.Background(), "method", nil, nil, nil, func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			calls++
+			if calls == 1 {
+				<-ctx.Done()
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should stop retrying once the retry budget is exhausted", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.RetryMaxAttempts = 2
+		cfg.RetryBudgetRatio = 0.5
+		retry := NewRetry(&cfg)
+
+		// Each call failing twice withdraws one retry and deposits half of one, exhausting the
+		// initial budget.
+		for i := 0; i < 20; i++ {
+			_ = retry(context.Background(), "method", nil, nil, nil, failingInvoker(new(int), unavailable, unavailable))
+		}
+
+		// Once the budget is exhausted, the retries are limited to the ratio of the calls.
+		calls, failed := 0, 0
+		for i := 0; i < 4; i++ {
+			callCalls := 0
+			if err := retry(context.Background(), "method", nil, nil, nil, failingInvoker(&callCalls, unavailable)); err != nil {
+				failed++
+			}
+			calls += callCalls
+		}
+		assert.Equal(t, 6, calls)
+		assert.Equal(t, 2, failed)
+	})
+}
+
+func TestConfig_ValidateRetry(t *testing.T) {
+	cfg := Config{RetryMaxAttempts: 1}
+	require.NoError(t, cfg.validateRetry())
+
+	cfg.RetryCodes = []string{"Unavailable", "unknown"}
+	assert.EqualError(t, cfg.validateRetry(), "unsupported retry code: unknown")
+
+	cfg.RetryCodes = []string{"Unavailable"}
+	assert.EqualError(t, cfg.validateRetry(), "invalid retry max attempts: 1, it must be at least 2")
+
+	cfg.RetryMaxAttempts = 3
+	cfg.RetryPerTryTimeout = -time.Second
+	assert.EqualError(t, cfg.validateRetry(), "invalid retry per-try timeout: -1s, it must be positive or 0 to disable it")
+
+	cfg.RetryPerTryTimeout = 0
+	cfg.RetryBudgetRatio = -1
+	assert.EqualError(t, cfg.validateRetry(), "invalid retry budget ratio: -1, it must be positive or 0 to disable the retry budget")
+
+	cfg.RetryBudgetRatio = 0.1
+	assert.NoError(t, cfg.validateRetry())
+}
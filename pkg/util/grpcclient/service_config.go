@@ -0,0 +1,41 @@
+package grpcclient
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// serviceConfig returns the default service config of the connections, either the configured
+// one or the one applying the load balancing policy.
+func (cfg *Config) serviceConfig() string {
+	if cfg.ServiceConfig != "" {
+		return cfg.ServiceConfig
+	}
+	if cfg.LoadBalancingPolicy != "" {
+		return fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, cfg.LoadBalancingPolicy)
+	}
+	return ""
+}
+
+func (cfg *Config) validateServiceConfig() error {
+	if cfg.LoadBalancingPolicy != "" && cfg.ServiceConfig != "" {
+		return errors.New("the load balancing policy and the service config can't be set together, set the load balancing config in the service config instead")
+	}
+	if cfg.LoadBalancingPolicy != "" && balancer.Get(cfg.LoadBalancingPolicy) == nil {
+		return errors.Errorf("unsupported load balancing policy: %s", cfg.LoadBalancingPolicy)
+	}
+	if cfg.ServiceConfig == "" {
+		return nil
+	}
+
+	// The service config is parsed when the client is created, which doesn't connect to the target.
+	conn, err := grpc.NewClient("passthrough:///service-config-validation", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultServiceConfig(cfg.ServiceConfig))
+	if err != nil {
+		return errors.Wrap(err, "invalid service config")
+	}
+	return conn.Close()
+}
@@ -0,0 +1,58 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tcpKeepAliveEnabled returns whether the TCP keepalive is configured at the socket level.
+func (cfg *Config) tcpKeepAliveEnabled() bool {
+	return cfg.TCPKeepAliveIdle > 0 || cfg.TCPKeepAliveInterval > 0 || cfg.TCPKeepAliveCount > 0
+}
+
+func (cfg *Config) validateTCPKeepAlive() error {
+	for name, d := range map[string]time.Duration{"idle": cfg.TCPKeepAliveIdle, "interval": cfg.TCPKeepAliveInterval} {
+		// The socket options are set in seconds.
+		if d < 0 || (d > 0 && d%time.Second != 0) {
+			return errors.Errorf("invalid TCP keepalive %s: %s, it must be a positive number of seconds or 0 to use the OS default", name, d)
+		}
+	}
+	if cfg.TCPKeepAliveCount < 0 {
+		return errors.Errorf("invalid TCP keepalive count: %d, it must be positive or 0 to use the OS default", cfg.TCPKeepAliveCount)
+	}
+	if cfg.tcpKeepAliveEnabled() && !tcpKeepAliveParamsSupported {
+		return errors.New("the TCP keepalive parameters are not supported on this platform")
+	}
+	return nil
+}
+
+// tcpKeepAliveDialer returns the dialer of the gRPC connections enabling the TCP keepalive on
+// the sockets, with the configured parameters. The parameters not set keep the OS defaults.
+//
+// Unlike the gRPC keepalive pings, the TCP keepalive probes are answered by the kernel of the
+// peer, and detect the half-open connections dropped by NATs or firewalls even while the
+// connection is idle.
+func (cfg *Config) tcpKeepAliveDialer() func(ctx context.Context, addr string) (net.Conn, error) {
+	d := &net.Dialer{
+		// Disable the keepalive set by the Go runtime, which overrides the OS defaults,
+		// since it's set on the socket by the Control function instead.
+		KeepAlive: -1,
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = setTCPKeepAlive(fd, cfg.TCPKeepAliveIdle, cfg.TCPKeepAliveInterval, cfg.TCPKeepAliveCount)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
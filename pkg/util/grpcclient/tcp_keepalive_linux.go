@@ -0,0 +1,32 @@
+package grpcclient
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+const tcpKeepAliveParamsSupported = true
+
+// setTCPKeepAlive enables the TCP keepalive on the socket, setting the parameters greater than 0.
+func setTCPKeepAlive(fd uintptr, idle, interval time.Duration, count int) error {
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1); err != nil {
+		return os.NewSyscallError("setsockopt SO_KEEPALIVE", err)
+	}
+	if idle > 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, int(idle/time.Second)); err != nil {
+			return os.NewSyscallError("setsockopt TCP_KEEPIDLE", err)
+		}
+	}
+	if interval > 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, int(interval/time.Second)); err != nil {
+			return os.NewSyscallError("setsockopt TCP_KEEPINTVL", err)
+		}
+	}
+	if count > 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count); err != nil {
+			return os.NewSyscallError("setsockopt TCP_KEEPCNT", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_TCPKeepAliveDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	getSockOpts := func(t *testing.T, dial func(ctx context.Context, addr string) (net.Conn, error)) map[string]int {
+		conn, err := dial(context.Background(), l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		raw, err := conn.(*net.TCPConn).SyscallConn()
+		require.NoError(t, err)
+
+		opts := map[string]int{}
+		require.NoError(t, raw.Control(func(fd uintptr) {
+			for name, opt := range map[string][2]int{
+				"keepalive": {syscall.SOL_SOCKET, syscall.SO_KEEPALIVE},
+				"idle":      {syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE},
+				"interval":  {syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL},
+				"count":     {syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT},
+			} {
+				v, err := syscall.GetsockoptInt(int(fd), opt[0], opt[1])
+				require.NoError(t, err)
+				opts[name] = v
+			}
+		}))
+		return opts
+	}
+
+	// The parameters not set keep the OS defaults, which depend on the host.
+	defaultDialer := &net.Dialer{KeepAlive: -1}
+	defaults := getSockOpts(t, func(ctx context.Context, addr string) (net.Conn, error) {
+		return defaultDialer.DialContext(ctx, "tcp", addr)
+	})
+	assert.Equal(t, 0, defaults["keepalive"])
+
+	cfg := Config{TCPKeepAliveIdle: 42 * time.Second, TCPKeepAliveCount: 7}
+	opts := getSockOpts(t, cfg.tcpKeepAliveDialer())
+	assert.Equal(t, map[string]int{"keepalive": 1, "idle": 42, "interval": defaults["interval"], "count": 7}, opts)
+
+	cfg = Config{TCPKeepAliveInterval: 5 * time.Second}
+	opts = getSockOpts(t, cfg.tcpKeepAliveDialer())
+	assert.Equal(t, map[string]int{"keepalive": 1, "idle": defaults["idle"], "interval": 5, "count": defaults["count"]}, opts)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package grpcclient
+
+import (
+	"time"
+)
+
+// The TCP keepalive parameters are only set on Linux, the config validation rejects them on the
+// other platforms.
+const tcpKeepAliveParamsSupported = false
+
+func setTCPKeepAlive(uintptr, time.Duration, time.Duration, int) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+package grpcclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_ValidateTCPKeepAlive(t *testing.T) {
+	tests := map[string]struct {
+		idle, interval time.Duration
+		count          int
+		expectedErr    string
+	}{
+		"should pass with the OS defaults": {},
+		"should pass with all the parameters set": {
+			idle:     time.Minute,
+			interval: 10 * time.Second,
+			count:    3,
+		},
+		"should fail with a negative idle time": {
+			idle:        -time.Second,
+			expectedErr: "invalid TCP keepalive idle: -1s, it must be a positive number of seconds or 0 to use the OS default",
+		},
+		"should fail with an interval not in seconds": {
+			interval:    1500 * time.Millisecond,
+			expectedErr: "invalid TCP keepalive interval: 1.5s, it must be a positive number of seconds or 0 to use the OS default",
+		},
+		"should fail with a negative count": {
+			count:       -1,
+			expectedErr: "invalid TCP keepalive count: -1, it must be positive or 0 to use the OS default",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := Config{TCPKeepAliveIdle: testData.idle, TCPKeepAliveInterval: testData.interval, TCPKeepAliveCount: testData.count}
+
+			err := cfg.validateTCPKeepAlive()
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testData.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package grpcclient
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/cortexproject/cortex/pkg/util/tls"
+)
+
+// TLSProvider resolves the TLS config used to connect to a target address, allowing
+// to connect to some targets with TLS and to others without, for example while migrating
+// a cluster to mTLS.
+type TLSProvider interface {
+	// TLSConfigForTarget returns whether TLS is enabled and the TLS config to connect to the
+	// target. The last returned value is false if the provider has no config for the target,
+	// in which case the global TLS config of the client is used.
+	TLSConfigForTarget(target string) (enabled bool, cfg tls.ClientConfig, found bool)
+}
+
+// TargetTLSConfig is the TLS config used to connect to the targets matching the regex.
+type TargetTLSConfig struct {
+	TargetRegex        string `yaml:"target_regex" doc:"nocli|description=Regular expression matching the whole address of the targets the TLS config applies to, like 'ingester-zone-a-.*:9095'."`
+	TLSEnabled         bool   `yaml:"tls_enabled" doc:"nocli|default=false|description=Enable TLS to connect to the matching targets."`
+	CertPath           string `yaml:"tls_cert_path" doc:"nocli|description=Path to the client certificate file used to authenticate with the matching targets."`
+	KeyPath            string `yaml:"tls_key_path" doc:"nocli|description=Path to the key file of the client certificate."`
+	CAPath             string `yaml:"tls_ca_path" doc:"nocli|description=Path to the CA certificates file to validate the certificate of the matching targets against. If not set, the host's root CA certificates are used."`
+	ServerName         string `yaml:"tls_server_name" doc:"nocli|description=Override the expected name on the certificate of the matching targets."`
+	InsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify" doc:"nocli|default=false|description=Skip validating the certificate of the matching targets."`
+
+	matcher *regexp.Regexp
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *TargetTLSConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TargetTLSConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	matcher, err := regexp.Compile("^(?:" + c.TargetRegex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid target regex %q: %w", c.TargetRegex, err)
+	}
+	c.matcher = matcher
+	return nil
+}
+
+func (c *TargetTLSConfig) clientConfig() tls.ClientConfig {
+	return tls.ClientConfig{
+		CertPath:           c.CertPath,
+		KeyPath:            c.KeyPath,
+		CAPath:             c.CAPath,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+}
+
+// TargetMatcherTLSProvider is a TLSProvider returning the config of the first entry
+// whose regex matches the target address.
+type TargetMatcherTLSProvider []TargetTLSConfig
+
+// TLSConfigForTarget implements TLSProvider.
+func (p TargetMatcherTLSProvider) TLSConfigForTarget(target string) (bool, tls.ClientConfig, bool) {
+	for _, entry := range p {
+		if entry.matcher != nil && entry.matcher.MatchString(target) {
+			return entry.TLSEnabled, entry.clientConfig(), true
+		}
+	}
+	return false, tls.ClientConfig{}, false
+}
@@ -3,8 +3,10 @@ package zstd
 import (
 	"bytes"
 	"io"
+	"sync"
 
 	"github.com/klauspost/compress/zstd"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc/encoding"
 )
 
@@ -13,6 +15,11 @@ const Name = "zstd"
 type compressor struct {
 	encoder *zstd.Encoder
 	decoder *zstd.Decoder
+
+	// When enabled, responses are decompressed while being read, by decoders reused across
+	// responses, instead of decompressing the whole response into a new buffer.
+	pooledDecompression atomic.Bool
+	decodersPool        sync.Pool
 }
 
 func init() {
@@ -44,6 +51,13 @@ func SetLevel(level zstd.EncoderLevel) error {
 	return nil
 }
 
+// EnablePooledDecompression makes the registered compressor decompress with a pool of
+// reusable decoders. The pool is shared by all the gRPC clients and servers of the process,
+// and once enabled it can't be disabled.
+func EnablePooledDecompression() {
+	encoding.GetCompressor(Name).(*compressor).pooledDecompression.Store(true)
+}
+
 func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
 	return &zstdWriteCloser{
 		enc:    c.encoder,
@@ -68,6 +82,10 @@ func (z *zstdWriteCloser) Close() error {
 }
 
 func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	if c.pooledDecompression.Load() {
+		return c.decompressPooled(r)
+	}
+
 	compressed, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
@@ -81,6 +99,46 @@ func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
 	return bytes.NewReader(uncompressed), nil
 }
 
+func (c *compressor) decompressPooled(r io.Reader) (io.Reader, error) {
+	dec, ok := c.decodersPool.Get().(*zstd.Decoder)
+	if !ok {
+		var err error
+		// A single goroutine decodes the stream synchronously, so that idle decoders in the
+		// pool don't hold any background goroutine.
+		dec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := dec.Reset(r); err != nil {
+		c.decodersPool.Put(dec)
+		return nil, err
+	}
+	return &pooledReader{decoder: dec, pool: &c.decodersPool}, nil
+}
+
 func (c *compressor) Name() string {
 	return Name
 }
+
+// pooledReader returns the decoder to the pool once the response has been fully read.
+type pooledReader struct {
+	decoder *zstd.Decoder
+	pool    *sync.Pool
+}
+
+func (r *pooledReader) Read(p []byte) (int, error) {
+	if r.decoder == nil {
+		return 0, io.EOF
+	}
+
+	n, err := r.decoder.Read(p)
+	if err == io.EOF {
+		// Release the reference to the compressed data.
+		_ = r.decoder.Reset(nil)
+		r.pool.Put(r.decoder)
+		r.decoder = nil
+	}
+	return n, err
+}
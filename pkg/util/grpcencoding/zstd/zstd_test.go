@@ -0,0 +1,79 @@
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressor_PooledDecompression(t *testing.T) {
+	c := newCompressor()
+	c.pooledDecompression.Store(true)
+
+	for _, input := range []string{"", "hello world", strings.Repeat("123456789", 2024)} {
+		compressed := compress(t, c, []byte(input))
+
+		// Decompress multiple times, to reuse the pooled decoders.
+		for i := 0; i < 3; i++ {
+			r, err := c.Decompress(bytes.NewReader(compressed))
+			require.NoError(t, err)
+			out, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, input, string(out))
+
+			// Reading past the end doesn't touch the decoder, which is back in the pool.
+			n, err := r.Read(make([]byte, 1))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+		}
+	}
+
+	// Corrupted data fails to decompress.
+	r, err := c.Decompress(bytes.NewReader([]byte("not zstd")))
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	assert.Error(t, err)
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	data := []byte(strings.Repeat("123456789", 1024))
+
+	for _, pooled := range []bool{false, true} {
+		name := "default"
+		if pooled {
+			name = "pooled"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			c := newCompressor()
+			c.pooledDecompression.Store(pooled)
+			compressed := compress(b, c, data)
+
+			out := bytes.NewBuffer(make([]byte, 0, len(data)+bytes.MinRead))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r, err := c.Decompress(bytes.NewReader(compressed))
+				require.NoError(b, err)
+				out.Reset()
+				_, err = out.ReadFrom(r)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func compress(t testing.TB, c *compressor, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := c.Compress(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
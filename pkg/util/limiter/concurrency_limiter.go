@@ -0,0 +1,126 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTooManyConcurrentRequests is returned when a request of a tenant exceeds the concurrency limit.
+var ErrTooManyConcurrentRequests = errors.New("too many concurrent requests")
+
+// ConcurrencyLimiter limits the number of concurrent requests of each tenant. Requests
+// exceeding the limit wait for a slot to be released, up to a timeout, before being rejected.
+type ConcurrencyLimiter struct {
+	mtx     sync.Mutex
+	tenants map[string]*tenantRequests
+}
+
+type tenantRequests struct {
+	inflight int
+	waiting  int
+	// released is closed, and replaced, every time a slot is released.
+	released chan struct{}
+}
+
+// NewConcurrencyLimiter makes a new ConcurrencyLimiter.
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		tenants: map[string]*tenantRequests{},
+	}
+}
+
+// Acquire blocks until the request of the user can be handled without exceeding the limit.
+// It returns ErrTooManyConcurrentRequests if no slot gets released within the wait timeout,
+// or the context error if the context is done first. On success, the returned function must be
+// called to release the slot once the request has been handled. A limit <= 0 disables the limit.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, userID string, limit int, waitTimeout time.Duration) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	var timeout <-chan time.Time
+	if waitTimeout > 0 {
+		timer := time.NewTimer(waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		l.mtx.Lock()
+		t, ok := l.tenants[userID]
+		if !ok {
+			t = &tenantRequests{released: make(chan struct{})}
+			l.tenants[userID] = t
+		}
+
+		if t.inflight < limit {
+			t.inflight++
+			l.mtx.Unlock()
+			return func() { l.release(userID) }, nil
+		}
+
+		if timeout == nil {
+			l.cleanupLocked(userID, t)
+			l.mtx.Unlock()
+			return nil, ErrTooManyConcurrentRequests
+		}
+
+		t.waiting++
+		released := t.released
+		l.mtx.Unlock()
+
+		var err error
+		select {
+		case <-released:
+		case <-timeout:
+			err = ErrTooManyConcurrentRequests
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		l.mtx.Lock()
+		t.waiting--
+		l.cleanupLocked(userID, t)
+		l.mtx.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *ConcurrencyLimiter) release(userID string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	t, ok := l.tenants[userID]
+	if !ok {
+		return
+	}
+
+	t.inflight--
+	close(t.released)
+	t.released = make(chan struct{})
+	l.cleanupLocked(userID, t)
+}
+
+// Inflight returns the number of requests of the user currently being handled.
+func (l *ConcurrencyLimiter) Inflight(userID string) int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if t, ok := l.tenants[userID]; ok {
+		return t.inflight
+	}
+	return 0
+}
+
+// cleanupLocked removes the tenant once it has no request in flight or waiting,
+// so that the inactive tenants don't accumulate. Must be called with the lock held.
+func (l *ConcurrencyLimiter) cleanupLocked(userID string, t *tenantRequests) {
+	if t.inflight == 0 && t.waiting == 0 && l.tenants[userID] == t {
+		delete(l.tenants, userID)
+	}
+}
@@ -0,0 +1,68 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewConcurrencyLimiter()
+
+	// A limit <= 0 disables the limit.
+	release, err := l.Acquire(ctx, "user-1", 0, 0)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, 0, l.Inflight("user-1"))
+
+	release1, err := l.Acquire(ctx, "user-1", 2, 0)
+	require.NoError(t, err)
+	release2, err := l.Acquire(ctx, "user-1", 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, l.Inflight("user-1"))
+
+	// Without a wait timeout, the exceeding requests are rejected immediately.
+	_, err = l.Acquire(ctx, "user-1", 2, 0)
+	assert.Equal(t, ErrTooManyConcurrentRequests, err)
+
+	// The exceeding requests are rejected once the wait timeout elapsed.
+	_, err = l.Acquire(ctx, "user-1", 2, 10*time.Millisecond)
+	assert.Equal(t, ErrTooManyConcurrentRequests, err)
+
+	// The limit is per user.
+	release3, err := l.Acquire(ctx, "user-2", 2, 0)
+	require.NoError(t, err)
+	release3()
+
+	// The exceeding requests waiting get the slots once released.
+	acquired := make(chan error)
+	go func() {
+		release, err := l.Acquire(ctx, "user-1", 2, time.Minute)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	release1()
+	require.NoError(t, <-acquired)
+
+	// The waiting requests give up when the context is canceled.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		_, err := l.Acquire(cancelCtx, "user-1", 1, time.Minute)
+		acquired <- err
+	}()
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-acquired)
+
+	// The users without any request are removed.
+	release2()
+	assert.Equal(t, 0, l.Inflight("user-1"))
+	assert.Empty(t, l.tenants)
+}
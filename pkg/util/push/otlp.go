@@ -1,6 +1,7 @@
 package push
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/go-kit/log/level"
@@ -12,6 +13,9 @@ import (
 	"github.com/weaveworks/common/middleware"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/util"
@@ -37,31 +41,14 @@ func OTLPHandler(sourceIPs *middleware.SourceIPExtractor, push Func) http.Handle
 			return
 		}
 
-		promConverter := prometheusremotewrite.NewPrometheusConverter()
-		err = promConverter.FromMetrics(convertToMetricsAttributes(req.Metrics()), prometheusremotewrite.Settings{DisableTargetInfo: true})
+		prwReq, err := convertOTLPToWriteRequest(req.Metrics())
 		if err != nil {
 			level.Error(logger).Log("err", err.Error())
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		prwReq := cortexpb.WriteRequest{
-			Source:                  cortexpb.API,
-			Metadata:                nil,
-			SkipLabelNameValidation: false,
-		}
-
-		tsList := []cortexpb.PreallocTimeseries(nil)
-		for _, v := range promConverter.TimeSeries() {
-			tsList = append(tsList, cortexpb.PreallocTimeseries{TimeSeries: &cortexpb.TimeSeries{
-				Labels:    makeLabels(v.Labels),
-				Samples:   makeSamples(v.Samples),
-				Exemplars: makeExemplars(v.Exemplars),
-			}})
-		}
-		prwReq.Timeseries = tsList
-
-		if _, err := push(ctx, &prwReq); err != nil {
+		if _, err := push(ctx, prwReq); err != nil {
 			resp, ok := httpgrpc.HTTPResponseFromError(err)
 			if !ok {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -77,6 +64,81 @@ func OTLPHandler(sourceIPs *middleware.SourceIPExtractor, push Func) http.Handle
 	})
 }
 
+// OTLPGRPCServer is a pmetricotlp.GRPCServer which accepts OTLP metrics over gRPC.
+type OTLPGRPCServer struct {
+	pmetricotlp.UnimplementedGRPCServer
+
+	push Func
+}
+
+// NewOTLPGRPCServer makes a new OTLPGRPCServer pushing the metrics with the push function.
+func NewOTLPGRPCServer(push Func) *OTLPGRPCServer {
+	return &OTLPGRPCServer{push: push}
+}
+
+// Export implements pmetricotlp.GRPCServer.
+func (s *OTLPGRPCServer) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	logger := log.WithContext(ctx, log.Logger)
+
+	prwReq, err := convertOTLPToWriteRequest(req.Metrics())
+	if err != nil {
+		level.Error(logger).Log("err", err.Error())
+		return pmetricotlp.NewExportResponse(), status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if _, err := s.push(ctx, prwReq); err != nil {
+		resp, ok := httpgrpc.HTTPResponseFromError(err)
+		if !ok {
+			return pmetricotlp.NewExportResponse(), status.Error(codes.Internal, err.Error())
+		}
+		// The OTLP exporters retry the Unavailable and ResourceExhausted codes only.
+		var code codes.Code
+		switch {
+		case resp.GetCode() == http.StatusAccepted:
+			// The samples dropped by the HA deduplication are accepted.
+			return pmetricotlp.NewExportResponse(), nil
+		case resp.GetCode()/100 == 5:
+			level.Error(logger).Log("msg", "push error", "err", err)
+			code = codes.Unavailable
+		case resp.GetCode() == http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+		default:
+			level.Warn(logger).Log("msg", "push refused", "err", err)
+			code = codes.InvalidArgument
+		}
+		return pmetricotlp.NewExportResponse(), status.Error(code, string(resp.Body))
+	}
+	return pmetricotlp.NewExportResponse(), nil
+}
+
+// convertOTLPToWriteRequest translates the OTLP metrics into a write request. The resource
+// attributes are added to the labels of the series, and the exponential histograms are
+// translated into native histograms.
+func convertOTLPToWriteRequest(md pmetric.Metrics) (*cortexpb.WriteRequest, error) {
+	promConverter := prometheusremotewrite.NewPrometheusConverter()
+	if err := promConverter.FromMetrics(convertToMetricsAttributes(md), prometheusremotewrite.Settings{DisableTargetInfo: true}); err != nil {
+		return nil, err
+	}
+
+	prwReq := &cortexpb.WriteRequest{
+		Source:                  cortexpb.API,
+		Metadata:                nil,
+		SkipLabelNameValidation: false,
+	}
+
+	tsList := []cortexpb.PreallocTimeseries(nil)
+	for _, v := range promConverter.TimeSeries() {
+		tsList = append(tsList, cortexpb.PreallocTimeseries{TimeSeries: &cortexpb.TimeSeries{
+			Labels:     makeLabels(v.Labels),
+			Samples:    makeSamples(v.Samples),
+			Exemplars:  makeExemplars(v.Exemplars),
+			Histograms: makeHistograms(v.Histograms),
+		}})
+	}
+	prwReq.Timeseries = tsList
+	return prwReq, nil
+}
+
 func makeLabels(in []prompb.Label) []cortexpb.LabelAdapter {
 	out := make(labels.Labels, 0, len(in))
 	for _, l := range in {
@@ -108,6 +170,50 @@ func makeExemplars(in []prompb.Exemplar) []cortexpb.Exemplar {
 	return out
 }
 
+func makeHistograms(in []prompb.Histogram) []cortexpb.Histogram {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]cortexpb.Histogram, 0, len(in))
+	for _, h := range in {
+		ch := cortexpb.Histogram{
+			Sum:            h.Sum,
+			Schema:         h.Schema,
+			ZeroThreshold:  h.ZeroThreshold,
+			NegativeSpans:  makeBucketSpans(h.NegativeSpans),
+			NegativeDeltas: h.NegativeDeltas,
+			NegativeCounts: h.NegativeCounts,
+			PositiveSpans:  makeBucketSpans(h.PositiveSpans),
+			PositiveDeltas: h.PositiveDeltas,
+			PositiveCounts: h.PositiveCounts,
+			ResetHint:      cortexpb.Histogram_ResetHint(h.ResetHint),
+			TimestampMs:    h.Timestamp,
+		}
+		switch c := h.Count.(type) {
+		case *prompb.Histogram_CountInt:
+			ch.Count = &cortexpb.Histogram_CountInt{CountInt: c.CountInt}
+		case *prompb.Histogram_CountFloat:
+			ch.Count = &cortexpb.Histogram_CountFloat{CountFloat: c.CountFloat}
+		}
+		switch c := h.ZeroCount.(type) {
+		case *prompb.Histogram_ZeroCountInt:
+			ch.ZeroCount = &cortexpb.Histogram_ZeroCountInt{ZeroCountInt: c.ZeroCountInt}
+		case *prompb.Histogram_ZeroCountFloat:
+			ch.ZeroCount = &cortexpb.Histogram_ZeroCountFloat{ZeroCountFloat: c.ZeroCountFloat}
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+func makeBucketSpans(in []prompb.BucketSpan) []cortexpb.BucketSpan {
+	out := make([]cortexpb.BucketSpan, 0, len(in))
+	for _, s := range in {
+		out = append(out, cortexpb.BucketSpan{Offset: s.Offset, Length: s.Length})
+	}
+	return out
+}
+
 func convertToMetricsAttributes(md pmetric.Metrics) pmetric.Metrics {
 	cloneMd := pmetric.NewMetrics()
 	md.CopyTo(cloneMd)
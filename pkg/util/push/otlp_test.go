@@ -3,6 +3,7 @@ package push
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,9 +11,12 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 )
@@ -37,6 +41,52 @@ func TestOTLPWriteHandler(t *testing.T) {
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestOTLPGRPCServer(t *testing.T) {
+	exportRequest := generateOTLPWriteRequest(t)
+
+	t.Run("should push the metrics", func(t *testing.T) {
+		server := NewOTLPGRPCServer(verifyOTLPWriteRequestHandler(t, cortexpb.API))
+		_, err := server.Export(context.Background(), exportRequest)
+		require.NoError(t, err)
+	})
+
+	tests := map[string]struct {
+		pushErr      error
+		expectedCode codes.Code
+	}{
+		"HA deduplicated samples": {
+			pushErr:      httpgrpc.Errorf(http.StatusAccepted, "deduplicated"),
+			expectedCode: codes.OK,
+		},
+		"invalid samples": {
+			pushErr:      httpgrpc.Errorf(http.StatusBadRequest, "out of bounds"),
+			expectedCode: codes.InvalidArgument,
+		},
+		"rate limited": {
+			pushErr:      httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit"),
+			expectedCode: codes.ResourceExhausted,
+		},
+		"server error": {
+			pushErr:      httpgrpc.Errorf(http.StatusInternalServerError, "ingesters unavailable"),
+			expectedCode: codes.Unavailable,
+		},
+		"unexpected error": {
+			pushErr:      errors.New("unexpected"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := NewOTLPGRPCServer(func(context.Context, *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+				return nil, tc.pushErr
+			})
+			_, err := server.Export(context.Background(), exportRequest)
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
+
 func generateOTLPWriteRequest(t *testing.T) pmetricotlp.ExportRequest {
 	d := pmetric.NewMetrics()
 
@@ -121,6 +171,20 @@ func verifyOTLPWriteRequestHandler(t *testing.T, expectSource cortexpb.WriteRequ
 	t.Helper()
 	return func(ctx context.Context, request *cortexpb.WriteRequest) (response *cortexpb.WriteResponse, err error) {
 		assert.Len(t, request.Timeseries, 12) // 1 (counter) + 1 (gauge) + 7 (hist_bucket) + 2 (hist_sum, hist_count) + 1 (exponential histogram)
+
+		// The exponential histogram is translated into a native histogram.
+		var histograms []cortexpb.Histogram
+		for _, ts := range request.Timeseries {
+			histograms = append(histograms, ts.Histograms...)
+		}
+		require.Len(t, histograms, 1)
+		assert.Equal(t, int32(2), histograms[0].Schema)
+		assert.Equal(t, &cortexpb.Histogram_CountInt{CountInt: 10}, histograms[0].Count)
+		assert.Equal(t, &cortexpb.Histogram_ZeroCountInt{ZeroCountInt: 2}, histograms[0].ZeroCount)
+		assert.Equal(t, 30.0, histograms[0].Sum)
+		assert.Equal(t, []cortexpb.BucketSpan{{Offset: 1, Length: 5}}, histograms[0].PositiveSpans)
+		assert.Equal(t, []int64{2, 0, 0, 0, 0}, histograms[0].PositiveDeltas)
+
 		// TODO: test more things
 		assert.Equal(t, expectSource, request.Source)
 		assert.False(t, request.SkipLabelNameValidation)
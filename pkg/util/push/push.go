@@ -16,6 +16,20 @@ import (
 // Func defines the type of the push. It is similar to http.HandlerFunc.
 type Func func(context.Context, *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error)
 
+type requestSizeContextKey struct{}
+
+// ContextWithRequestSize returns a context carrying the size of the decompressed push request.
+func ContextWithRequestSize(ctx context.Context, size int) context.Context {
+	return context.WithValue(ctx, requestSizeContextKey{}, size)
+}
+
+// RequestSizeFromContext returns the size of the decompressed push request, if known, so that
+// it doesn't need to be computed again from the parsed request.
+func RequestSizeFromContext(ctx context.Context) (int, bool) {
+	size, ok := ctx.Value(requestSizeContextKey{}).(int)
+	return size, ok
+}
+
 // Handler is a http.Handler which accepts WriteRequests.
 func Handler(maxRecvMsgSize int, sourceIPs *middleware.SourceIPExtractor, push Func) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -28,20 +42,42 @@ func Handler(maxRecvMsgSize int, sourceIPs *middleware.SourceIPExtractor, push F
 				logger = log.WithSourceIPs(source, logger)
 			}
 		}
-		var req cortexpb.PreallocWriteRequest
-		err := util.ParseProtoReader(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, &req, util.RawSnappy)
+		// The Remote Write 2.0 clients fall back to 1.0 when the request is rejected with 415
+		// Unsupported Media Type.
+		protoMsg, err := remoteWriteProtoMsg(r.Header.Get("Content-Type"))
+		if err != nil {
+			level.Error(logger).Log("err", err.Error())
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var (
+			req   *cortexpb.WriteRequest
+			reqV2 *writeRequestV2
+			size  int
+		)
+		if protoMsg == remoteWriteProtoMsgV2 {
+			reqV2 = &writeRequestV2{}
+			size, err = util.ParseProtoReaderWithSize(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, reqV2, util.RawSnappy)
+			req = &reqV2.WriteRequest
+		} else {
+			var reqV1 cortexpb.PreallocWriteRequest
+			size, err = util.ParseProtoReaderWithSize(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, &reqV1, util.RawSnappy)
+			req = &reqV1.WriteRequest
+		}
 		if err != nil {
 			level.Error(logger).Log("err", err.Error())
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		ctx = ContextWithRequestSize(ctx, size)
 
 		req.SkipLabelNameValidation = false
 		if req.Source == 0 {
 			req.Source = cortexpb.API
 		}
 
-		if _, err := push(ctx, &req.WriteRequest); err != nil {
+		if _, err := push(ctx, req); err != nil {
 			resp, ok := httpgrpc.HTTPResponseFromError(err)
 			if !ok {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -53,6 +89,13 @@ func Handler(maxRecvMsgSize int, sourceIPs *middleware.SourceIPExtractor, push F
 				level.Warn(logger).Log("msg", "push refused", "err", err)
 			}
 			http.Error(w, string(resp.Body), int(resp.Code))
+			return
+		}
+
+		if reqV2 != nil {
+			for name, value := range reqV2.writtenHeaders() {
+				w.Header().Set(name, value)
+			}
 		}
 	})
 }
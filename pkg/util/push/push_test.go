@@ -3,6 +3,7 @@ package push
 import (
 	"bytes"
 	"context"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/middleware"
+	"google.golang.org/protobuf/encoding/protowire"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 )
@@ -34,6 +36,20 @@ func TestHandler_cortexWriteRequest(t *testing.T) {
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestHandler_ShouldPropagateTheRequestSize(t *testing.T) {
+	body := createCortexWriteRequestProtobuf(t, false)
+	req := createRequest(t, body)
+	resp := httptest.NewRecorder()
+	handler := Handler(100000, nil, func(ctx context.Context, _ *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+		size, ok := RequestSizeFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, len(body), size)
+		return &cortexpb.WriteResponse{}, nil
+	})
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+}
+
 func TestHandler_ignoresSkipLabelNameValidationIfSet(t *testing.T) {
 	for _, req := range []*http.Request{
 		createRequest(t, createCortexWriteRequestProtobuf(t, true)),
@@ -46,6 +62,103 @@ func TestHandler_ignoresSkipLabelNameValidationIfSet(t *testing.T) {
 	}
 }
 
+func TestHandler_remoteWriteV2(t *testing.T) {
+	histogram := cortexpb.Histogram{
+		Count:          &cortexpb.Histogram_CountInt{CountInt: 3},
+		Sum:            6,
+		Schema:         1,
+		ZeroCount:      &cortexpb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+		PositiveSpans:  []cortexpb.BucketSpan{{Offset: 0, Length: 2}},
+		PositiveDeltas: []int64{1, 0},
+		TimestampMs:    1000,
+	}
+
+	req := createRequest(t, createRemoteWriteV2Protobuf(t, histogram))
+	req.Header.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "2.0.0")
+
+	resp := httptest.NewRecorder()
+	handler := Handler(100000, nil, func(_ context.Context, request *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+		require.Len(t, request.Timeseries, 2)
+		assert.Equal(t, cortexpb.API, request.Source)
+
+		counter := request.Timeseries[0]
+		assert.Equal(t, []cortexpb.LabelAdapter{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "test"}}, counter.Labels)
+		// The created timestamp is ingested as a zero sample.
+		assert.Equal(t, []cortexpb.Sample{{Value: 0, TimestampMs: 500}, {Value: 1, TimestampMs: 1000}}, counter.Samples)
+		assert.Equal(t, []cortexpb.Exemplar{{Labels: []cortexpb.LabelAdapter{{Name: "trace_id", Value: "abc"}}, Value: 2, TimestampMs: 1000}}, counter.Exemplars)
+
+		hist := request.Timeseries[1]
+		assert.Equal(t, []cortexpb.LabelAdapter{{Name: "__name__", Value: "bar"}, {Name: "job", Value: "test"}}, hist.Labels)
+		zeroHistogram := cortexpb.Histogram{
+			Count:       &cortexpb.Histogram_CountInt{},
+			Schema:      1,
+			ZeroCount:   &cortexpb.Histogram_ZeroCountInt{},
+			ResetHint:   cortexpb.Histogram_YES,
+			TimestampMs: 500,
+		}
+		assert.Equal(t, []cortexpb.Histogram{zeroHistogram, histogram}, hist.Histograms)
+
+		assert.Equal(t, []*cortexpb.MetricMetadata{{Type: cortexpb.COUNTER, MetricFamilyName: "foo", Help: "help text", Unit: "seconds"}}, request.Metadata)
+		return &cortexpb.WriteResponse{}, nil
+	})
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get("X-Prometheus-Remote-Write-Samples-Written"))
+	assert.Equal(t, "1", resp.Header().Get("X-Prometheus-Remote-Write-Histograms-Written"))
+	assert.Equal(t, "1", resp.Header().Get("X-Prometheus-Remote-Write-Exemplars-Written"))
+}
+
+func TestHandler_remoteWriteV2InvalidSymbolReference(t *testing.T) {
+	// The series references the 2nd symbol, but the symbols table has a single one.
+	ts := protowire.AppendTag(nil, 1, protowire.BytesType)
+	ts = protowire.AppendBytes(ts, protowire.AppendVarint(protowire.AppendVarint(nil, 0), 1))
+	body := protowire.AppendTag(nil, 4, protowire.BytesType)
+	body = protowire.AppendString(body, "")
+	body = protowire.AppendTag(body, 5, protowire.BytesType)
+	body = protowire.AppendBytes(body, ts)
+
+	req := createRequest(t, body)
+	req.Header.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+
+	resp := httptest.NewRecorder()
+	handler := Handler(100000, nil, verifyWriteRequestHandler(t, cortexpb.API))
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, 400, resp.Code)
+	assert.Contains(t, resp.Body.String(), "invalid symbol reference: 1, the symbols table has 1 symbols")
+}
+
+func TestHandler_remoteWriteV2InvalidFirstSymbol(t *testing.T) {
+	body := protowire.AppendTag(nil, 4, protowire.BytesType)
+	body = protowire.AppendString(body, "__name__")
+
+	req := createRequest(t, body)
+	req.Header.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+
+	resp := httptest.NewRecorder()
+	handler := Handler(100000, nil, verifyWriteRequestHandler(t, cortexpb.API))
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, 400, resp.Code)
+	assert.Contains(t, resp.Body.String(), `invalid symbols table, the first symbol must be an empty string but it is "__name__"`)
+}
+
+func TestHandler_unsupportedProtoMessage(t *testing.T) {
+	for contentType, expectedCode := range map[string]int{
+		"application/x-protobuf;proto=prometheus.WriteRequest":        200,
+		"application/x-protobuf":                                      200,
+		"application/x-protobuf;proto=io.prometheus.write.v3.Request": 415,
+	} {
+		req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
+		req.Header.Set("Content-Type", contentType)
+
+		resp := httptest.NewRecorder()
+		handler := Handler(100000, nil, verifyWriteRequestHandler(t, cortexpb.API))
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, expectedCode, resp.Code, contentType)
+	}
+}
+
 func verifyWriteRequestHandler(t *testing.T, expectSource cortexpb.WriteRequest_SourceEnum) func(ctx context.Context, request *cortexpb.WriteRequest) (response *cortexpb.WriteResponse, err error) {
 	t.Helper()
 	return func(ctx context.Context, request *cortexpb.WriteRequest) (response *cortexpb.WriteResponse, err error) {
@@ -108,3 +221,66 @@ func createCortexWriteRequestProtobuf(t *testing.T, skipLabelNameValidation bool
 	require.NoError(t, err)
 	return inoutBytes
 }
+
+// createRemoteWriteV2Protobuf creates a Remote Write 2.0 request with a counter, with an exemplar
+// and metadata, and a native histogram, both with a created timestamp.
+func createRemoteWriteV2Protobuf(t *testing.T, histogram cortexpb.Histogram) []byte {
+	t.Helper()
+	symbols := []string{"", "__name__", "foo", "job", "test", "trace_id", "abc", "help text", "seconds", "bar"}
+
+	appendMessage := func(b []byte, num protowire.Number, msg []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, msg)
+	}
+	appendRefs := func(b []byte, num protowire.Number, refs ...uint64) []byte {
+		var packed []byte
+		for _, ref := range refs {
+			packed = protowire.AppendVarint(packed, ref)
+		}
+		return appendMessage(b, num, packed)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(1))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, 1000)
+
+	exemplar := appendRefs(nil, 1, 5, 6)
+	exemplar = protowire.AppendTag(exemplar, 2, protowire.Fixed64Type)
+	exemplar = protowire.AppendFixed64(exemplar, math.Float64bits(2))
+	exemplar = protowire.AppendTag(exemplar, 3, protowire.VarintType)
+	exemplar = protowire.AppendVarint(exemplar, 1000)
+
+	var metadata []byte
+	metadata = protowire.AppendTag(metadata, 1, protowire.VarintType)
+	metadata = protowire.AppendVarint(metadata, uint64(cortexpb.COUNTER))
+	metadata = protowire.AppendTag(metadata, 3, protowire.VarintType)
+	metadata = protowire.AppendVarint(metadata, 7)
+	metadata = protowire.AppendTag(metadata, 4, protowire.VarintType)
+	metadata = protowire.AppendVarint(metadata, 8)
+
+	counter := appendRefs(nil, 1, 1, 2, 3, 4)
+	counter = appendMessage(counter, 2, sample)
+	counter = appendMessage(counter, 4, exemplar)
+	counter = appendMessage(counter, 5, metadata)
+	counter = protowire.AppendTag(counter, 6, protowire.VarintType)
+	counter = protowire.AppendVarint(counter, 500)
+
+	// The histograms have the same fields as the cortexpb ones.
+	histogramBytes, err := histogram.Marshal()
+	require.NoError(t, err)
+	hist := appendRefs(nil, 1, 1, 9, 3, 4)
+	hist = appendMessage(hist, 3, histogramBytes)
+	hist = protowire.AppendTag(hist, 6, protowire.VarintType)
+	hist = protowire.AppendVarint(hist, 500)
+
+	// The series are encoded before the symbols, which is valid protobuf.
+	body := appendMessage(nil, 5, counter)
+	body = appendMessage(body, 5, hist)
+	for _, s := range symbols {
+		body = protowire.AppendTag(body, 4, protowire.BytesType)
+		body = protowire.AppendString(body, s)
+	}
+	return body
+}
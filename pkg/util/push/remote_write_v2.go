@@ -0,0 +1,365 @@
+package push
+
+import (
+	"math"
+	"mime"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+const (
+	remoteWriteProtoMsgV1 = "prometheus.WriteRequest"
+	remoteWriteProtoMsgV2 = "io.prometheus.write.v2.Request"
+
+	// The headers of the Remote Write 2.0 responses, with the number of samples, histograms
+	// and exemplars written.
+	rw20WrittenSamplesHeader    = "X-Prometheus-Remote-Write-Samples-Written"
+	rw20WrittenHistogramsHeader = "X-Prometheus-Remote-Write-Histograms-Written"
+	rw20WrittenExemplarsHeader  = "X-Prometheus-Remote-Write-Exemplars-Written"
+
+	// customBucketsSchema is the schema of the native histograms with custom buckets, which
+	// can't be represented by the cortexpb histograms.
+	customBucketsSchema = -53
+)
+
+// remoteWriteProtoMsg returns the protobuf message of the request, from the proto parameter of
+// its content type. The requests of the clients not setting it are Remote Write 1.0 requests.
+func remoteWriteProtoMsg(contentType string) (string, error) {
+	if contentType == "" {
+		return remoteWriteProtoMsgV1, nil
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return remoteWriteProtoMsgV1, nil
+	}
+	switch msg, ok := params["proto"]; {
+	case !ok:
+		return remoteWriteProtoMsgV1, nil
+	case msg == remoteWriteProtoMsgV1 || msg == remoteWriteProtoMsgV2:
+		return msg, nil
+	default:
+		return "", errors.Errorf("unsupported remote write protobuf message: %s, supported messages are %s and %s", msg, remoteWriteProtoMsgV1, remoteWriteProtoMsgV2)
+	}
+}
+
+// writeRequestV2 is a Remote Write 2.0 request (io.prometheus.write.v2.Request), decoded into
+// a WriteRequest. The label references of the series and exemplars are resolved into the
+// symbols table, and the metadata of the series is moved into the metadata of the request.
+// The created timestamps are ingested as zero samples.
+type writeRequestV2 struct {
+	cortexpb.WriteRequest
+
+	symbols []string
+
+	// The number of samples, histograms and exemplars of the request.
+	samples, histograms, exemplars int
+}
+
+// Unmarshal implements proto.Unmarshaler.
+func (r *writeRequestV2) Unmarshal(b []byte) error {
+	// The symbols may be encoded after the series referencing them.
+	var series [][]byte
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n >= 0 {
+				r.symbols = append(r.symbols, string(v))
+			}
+			return n, nil
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n >= 0 {
+				series = append(series, v)
+			}
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(r.symbols) > 0 && r.symbols[0] != "" {
+		return errors.Errorf("invalid symbols table, the first symbol must be an empty string but it is %q", r.symbols[0])
+	}
+
+	r.Timeseries = cortexpb.PreallocTimeseriesSliceFromPool()
+	metadata := map[string]struct{}{}
+	for _, b := range series {
+		ts := cortexpb.TimeseriesFromPool()
+		r.Timeseries = append(r.Timeseries, cortexpb.PreallocTimeseries{TimeSeries: ts})
+		md, createdTimestamp, err := r.unmarshalTimeSeries(b, ts)
+		if err != nil {
+			return err
+		}
+
+		// The zero samples of the created timestamps aren't counted as written, like in Prometheus.
+		r.samples += len(ts.Samples)
+		r.histograms += len(ts.Histograms)
+		r.exemplars += len(ts.Exemplars)
+		appendCreatedTimestampZeroSample(ts, createdTimestamp)
+
+		if md == nil {
+			continue
+		}
+		md.MetricFamilyName = cortexpb.FromLabelAdaptersToLabels(ts.Labels).Get(labels.MetricName)
+		if _, ok := metadata[md.MetricFamilyName]; !ok {
+			metadata[md.MetricFamilyName] = struct{}{}
+			r.Metadata = append(r.Metadata, md)
+		}
+	}
+	return nil
+}
+
+// unmarshalTimeSeries decodes the series, and returns its metadata if set and its created timestamp.
+func (r *writeRequestV2) unmarshalTimeSeries(b []byte, ts *cortexpb.TimeSeries) (*cortexpb.MetricMetadata, int64, error) {
+	var (
+		md               *cortexpb.MetricMetadata
+		createdTimestamp int64
+		labelRefs        []uint64
+	)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1:
+			refs, n := consumeRefs(typ, b)
+			labelRefs = append(labelRefs, refs...)
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			var s cortexpb.Sample
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					v, n := protowire.ConsumeFixed64(b)
+					s.Value = math.Float64frombits(v)
+					return n, nil
+				case num == 2 && typ == protowire.VarintType:
+					v, n := protowire.ConsumeVarint(b)
+					s.TimestampMs = int64(v)
+					return n, nil
+				default:
+					return protowire.ConsumeFieldValue(num, typ, b), nil
+				}
+			})
+			ts.Samples = append(ts.Samples, s)
+			return n, err
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			// The fields of the histograms are the same as the cortexpb ones, but the custom values.
+			var h cortexpb.Histogram
+			if err := h.Unmarshal(v); err != nil {
+				return n, err
+			}
+			if h.Schema == customBucketsSchema {
+				return n, errors.New("native histograms with custom buckets are not supported")
+			}
+			ts.Histograms = append(ts.Histograms, h)
+			return n, nil
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			var (
+				e         cortexpb.Exemplar
+				labelRefs []uint64
+			)
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch {
+				case num == 1:
+					refs, n := consumeRefs(typ, b)
+					labelRefs = append(labelRefs, refs...)
+					return n, nil
+				case num == 2 && typ == protowire.Fixed64Type:
+					v, n := protowire.ConsumeFixed64(b)
+					e.Value = math.Float64frombits(v)
+					return n, nil
+				case num == 3 && typ == protowire.VarintType:
+					v, n := protowire.ConsumeVarint(b)
+					e.TimestampMs = int64(v)
+					return n, nil
+				default:
+					return protowire.ConsumeFieldValue(num, typ, b), nil
+				}
+			})
+			if err != nil {
+				return n, err
+			}
+			e.Labels, err = r.labels(labelRefs)
+			ts.Exemplars = append(ts.Exemplars, e)
+			return n, err
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			m := &cortexpb.MetricMetadata{}
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				if typ != protowire.VarintType || (num != 1 && num != 3 && num != 4) {
+					return protowire.ConsumeFieldValue(num, typ, b), nil
+				}
+				v, n := protowire.ConsumeVarint(b)
+				if n < 0 {
+					return n, nil
+				}
+				var err error
+				switch num {
+				case 1:
+					m.Type = cortexpb.MetricMetadata_MetricType(v)
+				case 3:
+					m.Help, err = r.symbol(v)
+				case 4:
+					m.Unit, err = r.symbol(v)
+				}
+				return n, err
+			})
+			if m.Type != cortexpb.UNKNOWN || m.Help != "" || m.Unit != "" {
+				md = m
+			}
+			return n, err
+		case num == 6 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			createdTimestamp = int64(v)
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	lbls, err := r.labels(labelRefs)
+	ts.Labels = append(ts.Labels, lbls...)
+	return md, createdTimestamp, err
+}
+
+// appendCreatedTimestampZeroSample inserts a zero sample, or a zero histogram, at the created
+// timestamp of the series, if set and older than its first sample, so that the increase since
+// the series has been created is accounted, like Prometheus does for the created timestamps.
+func appendCreatedTimestampZeroSample(ts *cortexpb.TimeSeries, createdTimestamp int64) {
+	if createdTimestamp <= 0 {
+		return
+	}
+
+	if len(ts.Samples) > 0 && createdTimestamp < ts.Samples[0].TimestampMs {
+		ts.Samples = append(ts.Samples, cortexpb.Sample{})
+		copy(ts.Samples[1:], ts.Samples)
+		ts.Samples[0] = cortexpb.Sample{TimestampMs: createdTimestamp}
+	}
+
+	if len(ts.Histograms) > 0 && createdTimestamp < ts.Histograms[0].TimestampMs {
+		first := ts.Histograms[0]
+		zero := cortexpb.Histogram{
+			Count:         &cortexpb.Histogram_CountInt{},
+			ZeroCount:     &cortexpb.Histogram_ZeroCountInt{},
+			Schema:        first.Schema,
+			ZeroThreshold: first.ZeroThreshold,
+			// The zero histogram is a counter reset by definition.
+			ResetHint:   cortexpb.Histogram_YES,
+			TimestampMs: createdTimestamp,
+		}
+		if first.IsFloatHistogram() {
+			zero.Count = &cortexpb.Histogram_CountFloat{}
+			zero.ZeroCount = &cortexpb.Histogram_ZeroCountFloat{}
+		}
+		ts.Histograms = append(ts.Histograms, cortexpb.Histogram{})
+		copy(ts.Histograms[1:], ts.Histograms)
+		ts.Histograms[0] = zero
+	}
+}
+
+// labels resolves the label references, pairs of references to the name and value of each label.
+func (r *writeRequestV2) labels(refs []uint64) ([]cortexpb.LabelAdapter, error) {
+	if len(refs)%2 != 0 {
+		return nil, errors.Errorf("invalid number of label references: %d, it must be even", len(refs))
+	}
+	lbls := make([]cortexpb.LabelAdapter, 0, len(refs)/2)
+	for i := 0; i < len(refs); i += 2 {
+		name, err := r.symbol(refs[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.symbol(refs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		lbls = append(lbls, cortexpb.LabelAdapter{Name: name, Value: value})
+	}
+	return lbls, nil
+}
+
+func (r *writeRequestV2) symbol(ref uint64) (string, error) {
+	if ref >= uint64(len(r.symbols)) {
+		return "", errors.Errorf("invalid symbol reference: %d, the symbols table has %d symbols", ref, len(r.symbols))
+	}
+	return r.symbols[ref], nil
+}
+
+// writtenHeaders returns the headers of the Remote Write 2.0 response.
+func (r *writeRequestV2) writtenHeaders() map[string]string {
+	return map[string]string{
+		rw20WrittenSamplesHeader:    strconv.Itoa(r.samples),
+		rw20WrittenHistogramsHeader: strconv.Itoa(r.histograms),
+		rw20WrittenExemplarsHeader:  strconv.Itoa(r.exemplars),
+	}
+}
+
+// consumeFields calls fn with the number, type and encoded value of each field of the message.
+// fn returns the length of the value, or a negative protowire error code.
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := fn(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// consumeRefs decodes the references, either packed or not.
+func consumeRefs(typ protowire.Type, b []byte) ([]uint64, int) {
+	switch typ {
+	case protowire.VarintType:
+		v, n := protowire.ConsumeVarint(b)
+		return []uint64{v}, n
+	case protowire.BytesType:
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, n
+		}
+		var refs []uint64
+		for len(v) > 0 {
+			ref, m := protowire.ConsumeVarint(v)
+			if m < 0 {
+				return nil, m
+			}
+			refs = append(refs, ref)
+			v = v[m:]
+		}
+		return refs, n
+	default:
+		return nil, protowire.ConsumeFieldValue(0, typ, b)
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"crypto/x509"
 	"flag"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
 // ClientConfig is the config for client TLS.
@@ -19,6 +24,8 @@ type ClientConfig struct {
 	CAPath             string `yaml:"tls_ca_path"`
 	ServerName         string `yaml:"tls_server_name"`
 	InsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify"`
+
+	ReloadInterval time.Duration `yaml:"tls_reload_interval"`
 }
 
 var (
@@ -33,6 +40,7 @@ func (cfg *ClientConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet)
 	f.StringVar(&cfg.CAPath, prefix+".tls-ca-path", "", "Path to the CA certificates file to validate server certificate against. If not set, the host's root CA certificates are used.")
 	f.StringVar(&cfg.ServerName, prefix+".tls-server-name", "", "Override the expected name on the server certificate.")
 	f.BoolVar(&cfg.InsecureSkipVerify, prefix+".tls-insecure-skip-verify", false, "Skip validating server certificate.")
+	f.DurationVar(&cfg.ReloadInterval, prefix+".tls-reload-interval", 0, "[Experimental] Interval after which the client certificate, key and CA certificates files are read again, when establishing a new connection, so that the rotated certificates are used without restarting. If a file can't be read, the previously loaded certificates are kept. 0 = disabled.")
 }
 
 // GetTLSConfig initialises tls.Config from config options
@@ -44,14 +52,10 @@ func (cfg *ClientConfig) GetTLSConfig() (*tls.Config, error) {
 
 	// read ca certificates
 	if cfg.CAPath != "" {
-		var caCertPool *x509.CertPool
-		caCert, err := os.ReadFile(cfg.CAPath)
+		caCertPool, err := loadCACertPool(cfg.CAPath)
 		if err != nil {
-			return nil, errors.Wrapf(err, "error loading ca cert: %s", cfg.CAPath)
+			return nil, err
 		}
-		caCertPool = x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-
 		config.RootCAs = caCertPool
 	}
 
@@ -63,16 +67,121 @@ func (cfg *ClientConfig) GetTLSConfig() (*tls.Config, error) {
 		if cfg.KeyPath == "" {
 			return nil, errKeyMissing
 		}
-		clientCert, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
+		clientCert, err := loadClientCertificate(cfg.CertPath, cfg.KeyPath)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to load TLS certificate %s,%s", cfg.CertPath, cfg.KeyPath)
+			return nil, err
 		}
-		config.Certificates = []tls.Certificate{clientCert}
+		config.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	if cfg.ReloadInterval > 0 {
+		newReloader(cfg, config).apply(config)
 	}
 
 	return config, nil
 }
 
+func loadCACertPool(path string) (*x509.CertPool, error) {
+	caCert, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading ca cert: %s", path)
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+	return caCertPool, nil
+}
+
+func loadClientCertificate(certPath, keyPath string) (*tls.Certificate, error) {
+	clientCert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load TLS certificate %s,%s", certPath, keyPath)
+	}
+	return &clientCert, nil
+}
+
+// reloader reads the client certificate and the CA certificates files again when they are
+// used to establish a connection, once the reload interval has elapsed since the last read.
+type reloader struct {
+	cfg ClientConfig
+
+	mtx        sync.Mutex
+	reloadedAt time.Time
+	caCertPool *x509.CertPool
+	clientCert *tls.Certificate
+}
+
+func newReloader(cfg *ClientConfig, config *tls.Config) *reloader {
+	r := &reloader{cfg: *cfg, reloadedAt: time.Now(), caCertPool: config.RootCAs}
+	if len(config.Certificates) > 0 {
+		r.clientCert = &config.Certificates[0]
+	}
+	return r
+}
+
+// apply makes the TLS config use the reloaded certificates. The server certificate can't be
+// verified against reloaded CA certificates by the TLS library, so it's verified by the
+// reloader instead.
+func (r *reloader) apply(config *tls.Config) {
+	if r.clientCert != nil {
+		config.Certificates = nil
+		config.GetClientCertificate = r.getClientCertificate
+	}
+	if r.caCertPool != nil && !r.cfg.InsecureSkipVerify {
+		config.RootCAs = nil
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = r.verifyConnection
+	}
+}
+
+func (r *reloader) reload() (*x509.CertPool, *tls.Certificate) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if time.Since(r.reloadedAt) < r.cfg.ReloadInterval {
+		return r.caCertPool, r.clientCert
+	}
+	r.reloadedAt = time.Now()
+
+	if r.caCertPool != nil {
+		if caCertPool, err := loadCACertPool(r.cfg.CAPath); err != nil {
+			level.Warn(util_log.Logger).Log("msg", "failed to reload the TLS CA certificates, keeping the previous ones", "err", err)
+		} else {
+			r.caCertPool = caCertPool
+		}
+	}
+	if r.clientCert != nil {
+		if clientCert, err := loadClientCertificate(r.cfg.CertPath, r.cfg.KeyPath); err != nil {
+			level.Warn(util_log.Logger).Log("msg", "failed to reload the TLS client certificate, keeping the previous one", "err", err)
+		} else {
+			r.clientCert = clientCert
+		}
+	}
+	return r.caCertPool, r.clientCert
+}
+
+func (r *reloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, clientCert := r.reload()
+	return clientCert, nil
+}
+
+func (r *reloader) verifyConnection(cs tls.ConnectionState) error {
+	caCertPool, _ := r.reload()
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         caCertPool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
 // GetGRPCDialOptions creates GRPC DialOptions for TLS
 func (cfg *ClientConfig) GetGRPCDialOptions(enabled bool) ([]grpc.DialOption, error) {
 	if !enabled {
@@ -1,12 +1,21 @@
 package tls
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/integration/ca"
 )
 
 // certPEM and keyPEM are copied from the golang crypto/tls library
@@ -184,3 +193,107 @@ func TestGetTLSConfig_ServerName(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "myserver.com", tlsConfig.ServerName)
 }
+
+func TestGetTLSConfig_ReloadInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// Two generations of server and client CAs and certificates, the second one rotating the first.
+	for _, gen := range []string{"1", "2"} {
+		serverCA, clientCA := ca.New("server CA "+gen), ca.New("client CA "+gen)
+		require.NoError(t, serverCA.WriteCACertificate(path("server-ca-"+gen+".crt")))
+		require.NoError(t, clientCA.WriteCACertificate(path("client-ca-"+gen+".crt")))
+		require.NoError(t, serverCA.WriteCertificate(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: "server-" + gen},
+			DNSNames:    []string{"localhost"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, path("server-"+gen+".crt"), path("server-"+gen+".key")))
+		require.NoError(t, clientCA.WriteCertificate(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: "client-" + gen},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, path("client-"+gen+".crt"), path("client-"+gen+".key")))
+	}
+	rotate := func(gen string) {
+		for src, dst := range map[string]string{"server-ca-" + gen + ".crt": "ca.crt", "client-" + gen + ".crt": "client.crt", "client-" + gen + ".key": "client.key"} {
+			data, err := os.ReadFile(path(src))
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path(dst), data, 0600))
+		}
+	}
+
+	// The server presents the certificate of the current generation, and trusts both client CAs.
+	var serverGen atomic.Value
+	serverGen.Store("1")
+	clientCAs := x509.NewCertPool()
+	for _, gen := range []string{"1", "2"} {
+		caCert, err := os.ReadFile(path("client-ca-" + gen + ".crt"))
+		require.NoError(t, err)
+		clientCAs.AppendCertsFromPEM(caCert)
+	}
+	listener, err := tls.Listen("tcp", "localhost:0", &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			gen := serverGen.Load().(string)
+			return loadClientCertificate(path("server-"+gen+".crt"), path("server-"+gen+".key"))
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	clientNames := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if err := conn.(*tls.Conn).Handshake(); err == nil {
+				clientNames <- conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	handshake := func(config *tls.Config) error {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// Read the server response, to get the error of the client certificate verification.
+		_, err = conn.Read(make([]byte, 1))
+		if err == io.EOF {
+			err = nil
+		}
+		return err
+	}
+
+	rotate("1")
+	cfg := ClientConfig{CAPath: path("ca.crt"), CertPath: path("client.crt"), KeyPath: path("client.key"), ServerName: "localhost"}
+	staticConfig, err := cfg.GetTLSConfig()
+	require.NoError(t, err)
+	cfg.ReloadInterval = 10 * time.Millisecond
+	reloadingConfig, err := cfg.GetTLSConfig()
+	require.NoError(t, err)
+
+	require.NoError(t, handshake(staticConfig))
+	assert.Equal(t, "client-1", <-clientNames)
+	require.NoError(t, handshake(reloadingConfig))
+	assert.Equal(t, "client-1", <-clientNames)
+
+	// Rotate the certificates and the CAs.
+	rotate("2")
+	serverGen.Store("2")
+	time.Sleep(2 * cfg.ReloadInterval)
+
+	require.ErrorContains(t, handshake(staticConfig), "certificate signed by unknown authority")
+	require.NoError(t, handshake(reloadingConfig))
+	assert.Equal(t, "client-2", <-clientNames)
+
+	// The previous certificates are kept if the files can't be read.
+	require.NoError(t, os.Remove(path("client.key")))
+	time.Sleep(2 * cfg.ReloadInterval)
+	require.NoError(t, handshake(reloadingConfig))
+	assert.Equal(t, "client-2", <-clientNames)
+}
@@ -115,6 +115,14 @@ func newLabelsNotSortedError(series []cortexpb.LabelAdapter, labelName string) V
 	}
 }
 
+func newMissingRequiredLabelError(series []cortexpb.LabelAdapter, labelName string) ValidationError {
+	return &genericValidationError{
+		message: "series missing required label: %.200q metric %.200q",
+		cause:   labelName,
+		series:  series,
+	}
+}
+
 type tooManyLabelsError struct {
 	series []cortexpb.LabelAdapter
 	limit  int
@@ -184,6 +192,34 @@ func newSampleTimestampTooNewError(metricName string, timestamp int64) Validatio
 	}
 }
 
+// nativeHistogramValidationError is a ValidationError implementation suitable for native histogram
+// validation errors.
+type nativeHistogramValidationError struct {
+	cause      string
+	metricName string
+	timestamp  int64
+}
+
+func (e *nativeHistogramValidationError) Error() string {
+	return fmt.Sprintf("%s, timestamp: %d metric: %.200q", e.cause, e.timestamp, e.metricName)
+}
+
+func newNativeHistogramSchemaInvalidError(metricName string, timestamp int64, schema int32) ValidationError {
+	return &nativeHistogramValidationError{
+		cause:      fmt.Sprintf("invalid native histogram schema %d, must be between %d and %d", schema, nativeHistogramMinSchema, nativeHistogramMaxSchema),
+		metricName: metricName,
+		timestamp:  timestamp,
+	}
+}
+
+func newNativeHistogramBucketsExceededError(metricName string, timestamp int64, buckets, limit int) ValidationError {
+	return &nativeHistogramValidationError{
+		cause:      fmt.Sprintf("native histogram has too many buckets (buckets: %d, limit: %d)", buckets, limit),
+		metricName: metricName,
+		timestamp:  timestamp,
+	}
+}
+
 // exemplarValidationError is a ValidationError implementation suitable for exemplar validation errors.
 type exemplarValidationError struct {
 	message        string
@@ -214,11 +250,18 @@ func newExemplarMissingTimestampError(seriesLabels []cortexpb.LabelAdapter, exem
 	}
 }
 
-var labelLenMsg = "exemplar combined labelset exceeds " + strconv.Itoa(ExemplarMaxLabelSetLength) + " characters, timestamp: %d series: %s labels: %s"
+func newExemplarLabelLengthError(seriesLabels []cortexpb.LabelAdapter, exemplarLabels []cortexpb.LabelAdapter, timestamp int64, limit int) ValidationError {
+	return &exemplarValidationError{
+		message:        "exemplar combined labelset exceeds " + strconv.Itoa(limit) + " characters, timestamp: %d series: %s labels: %s",
+		seriesLabels:   seriesLabels,
+		exemplarLabels: exemplarLabels,
+		timestamp:      timestamp,
+	}
+}
 
-func newExemplarLabelLengthError(seriesLabels []cortexpb.LabelAdapter, exemplarLabels []cortexpb.LabelAdapter, timestamp int64) ValidationError {
+func newExemplarTooManyLabelNamesError(seriesLabels []cortexpb.LabelAdapter, exemplarLabels []cortexpb.LabelAdapter, timestamp int64, limit int) ValidationError {
 	return &exemplarValidationError{
-		message:        labelLenMsg,
+		message:        "exemplar has more than " + strconv.Itoa(limit) + " label names, timestamp: %d series: %s labels: %s",
 		seriesLabels:   seriesLabels,
 		exemplarLabels: exemplarLabels,
 		timestamp:      timestamp,
@@ -6,8 +6,9 @@ import (
 
 // OverridesExporter exposes per-tenant resource limit overrides as Prometheus metrics
 type OverridesExporter struct {
-	tenantLimits TenantLimits
-	description  *prometheus.Desc
+	tenantLimits           TenantLimits
+	description            *prometheus.Desc
+	validationCheckEnabled *prometheus.Desc
 }
 
 // NewOverridesExporter creates an OverridesExporter that reads updates to per-tenant
@@ -21,11 +22,18 @@ func NewOverridesExporter(tenantLimits TenantLimits) *OverridesExporter {
 			[]string{"limit_name", "user"},
 			nil,
 		),
+		validationCheckEnabled: prometheus.NewDesc(
+			"cortex_overrides_validation_check_enabled",
+			"Whether the write path validation check is enabled (1) or disabled (0) for the tenant.",
+			[]string{"check", "user"},
+			nil,
+		),
 	}
 }
 
 func (oe *OverridesExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- oe.description
+	ch <- oe.validationCheckEnabled
 }
 
 func (oe *OverridesExporter) Collect(ch chan<- prometheus.Metric) {
@@ -33,10 +41,25 @@ func (oe *OverridesExporter) Collect(ch chan<- prometheus.Metric) {
 	for tenant, limits := range allLimits {
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, limits.IngestionRate, "ingestion_rate", tenant)
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.IngestionBurstSize), "ingestion_burst_size", tenant)
+		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, limits.IngestionRateBytes, "ingestion_rate_bytes", tenant)
+		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.IngestionBurstSizeBytes), "ingestion_burst_size_bytes", tenant)
 
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxLocalSeriesPerUser), "max_local_series_per_user", tenant)
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxLocalSeriesPerMetric), "max_local_series_per_metric", tenant)
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxGlobalSeriesPerUser), "max_global_series_per_user", tenant)
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxGlobalSeriesPerMetric), "max_global_series_per_metric", tenant)
+
+		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, limits.MaxExemplarsIngestionRate, "max_exemplars_ingestion_rate", tenant)
+		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxExemplarsIngestionBurstSize), "max_exemplars_ingestion_burst_size", tenant)
+		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, limits.DistributorExemplarsIngestionRate, "distributor_exemplars_ingestion_rate", tenant)
+		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.DistributorExemplarsIngestionBurstSize), "distributor_exemplars_ingestion_burst_size", tenant)
+
+		for _, check := range ValidationChecks {
+			enabled := 1.0
+			if limits.ValidationCheckDisabled(check) {
+				enabled = 0
+			}
+			ch <- prometheus.MustNewConstMetric(oe.validationCheckEnabled, prometheus.GaugeValue, enabled, check, tenant)
+		}
 	}
 }
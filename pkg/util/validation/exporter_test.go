@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -28,3 +29,21 @@ func TestOverridesExporter_withConfig(t *testing.T) {
 	count := testutil.CollectAndCount(exporter, "cortex_overrides")
 	assert.Greater(t, count, 0)
 }
+
+func TestOverridesExporter_ValidationChecks(t *testing.T) {
+	tenantLimits := map[string]*Limits{
+		"tenant-a": {
+			DisabledValidationChecks: []string{ValidationCheckLabelNameFormat},
+		},
+	}
+
+	exporter := NewOverridesExporter(newMockTenantLimits(tenantLimits))
+
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(`
+		# HELP cortex_overrides_validation_check_enabled Whether the write path validation check is enabled (1) or disabled (0) for the tenant.
+		# TYPE cortex_overrides_validation_check_enabled gauge
+		cortex_overrides_validation_check_enabled{check="label_name_format",user="tenant-a"} 0
+		cortex_overrides_validation_check_enabled{check="metric_name_format",user="tenant-a"} 1
+		cortex_overrides_validation_check_enabled{check="sample_timestamp",user="tenant-a"} 1
+	`), "cortex_overrides_validation_check_enabled"))
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"math"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -24,13 +26,54 @@ import (
 var errMaxGlobalSeriesPerUserValidation = errors.New("The ingester.max-global-series-per-user limit is unsupported if distributor.shard-by-all-labels is disabled")
 var errDuplicateQueryPriorities = errors.New("duplicate entry of priorities found. Make sure they are all unique, including the default priority")
 var errCompilingQueryPriorityRegex = errors.New("error compiling query priority regex")
+var errInvalidCompactionOrder = errors.New("unsupported compactor compaction order, supported values are: " + strings.Join(CompactionOrders, ", "))
+var errInvalidMinQueryStepPolicy = errors.New("unsupported min query step policy, supported values are: " + strings.Join(MinQueryStepPolicies, ", "))
+var errInvalidIngestAggregationFunction = errors.New("unsupported ingest aggregation function, supported values are: " + strings.Join(IngestAggregationFunctions, ", "))
+var errInvalidWriteQuorum = errors.New("unsupported write quorum, supported values are: " + strings.Join(WriteQuorums, ", "))
+var errInvalidDisabledValidationCheck = errors.New("unsupported disabled validation check, supported values are: " + strings.Join(ValidationChecks, ", "))
+var errInvalidMaxExemplarLabelSetLength = fmt.Errorf("max exemplar label set length must not be greater than %d", ExemplarMaxLabelSetLength)
 
 // Supported values for enum limits
 const (
 	LocalIngestionRateStrategy  = "local"
 	GlobalIngestionRateStrategy = "global"
+
+	CompactionOrderOldestFirst = "oldest-first"
+	CompactionOrderNewestFirst = "newest-first"
+
+	MinQueryStepPolicyReject = "reject"
+	MinQueryStepPolicyClamp  = "clamp"
+
+	IngestAggregationLast = "last"
+	IngestAggregationAvg  = "avg"
+	IngestAggregationMax  = "max"
+
+	WriteQuorumMajority      = "majority"
+	WriteQuorumEachZone      = "each-zone"
+	WriteQuorumAllButOneZone = "all-but-one-zone"
+
+	ValidationCheckMetricNameFormat = "metric_name_format"
+	ValidationCheckLabelNameFormat  = "label_name_format"
+	ValidationCheckSampleTimestamp  = "sample_timestamp"
 )
 
+// CompactionOrders is the list of supported compactor compaction orders.
+var CompactionOrders = []string{CompactionOrderOldestFirst, CompactionOrderNewestFirst}
+
+// MinQueryStepPolicies is the list of supported policies for range queries with a step smaller than the min query step.
+var MinQueryStepPolicies = []string{MinQueryStepPolicyReject, MinQueryStepPolicyClamp}
+
+// IngestAggregationFunctions is the list of supported functions to aggregate the samples on ingest.
+var IngestAggregationFunctions = []string{IngestAggregationLast, IngestAggregationAvg, IngestAggregationMax}
+
+// WriteQuorums is the list of supported quorums of the writes to the ingesters.
+var WriteQuorums = []string{WriteQuorumMajority, WriteQuorumEachZone, WriteQuorumAllButOneZone}
+
+// ValidationChecks is the list of the write path validation checks which can be disabled per tenant.
+// The labels order and duplicated label names check can't be disabled, since the ingesters rely on
+// the sorted and unique label names of the series.
+var ValidationChecks = []string{ValidationCheckMetricNameFormat, ValidationCheckLabelNameFormat, ValidationCheckSampleTimestamp}
+
 // AccessDeniedError are errors that do not comply with the limits specified.
 type AccessDeniedError string
 
@@ -53,6 +96,12 @@ type DisabledRuleGroup struct {
 
 type DisabledRuleGroups []DisabledRuleGroup
 
+// HALabelPair is a pair of cluster and replica label names identifying the HA replicas.
+type HALabelPair struct {
+	ClusterLabel string `yaml:"cluster_label" json:"cluster_label" doc:"nocli|description=Label identifying the HA cluster."`
+	ReplicaLabel string `yaml:"replica_label" json:"replica_label" doc:"nocli|description=Label identifying the HA replica."`
+}
+
 type QueryPriority struct {
 	Enabled         bool          `yaml:"enabled" json:"enabled"`
 	DefaultPriority int64         `yaml:"default_priority" json:"default_priority"`
@@ -90,10 +139,14 @@ type Limits struct {
 	IngestionRate             float64             `yaml:"ingestion_rate" json:"ingestion_rate"`
 	IngestionRateStrategy     string              `yaml:"ingestion_rate_strategy" json:"ingestion_rate_strategy"`
 	IngestionBurstSize        int                 `yaml:"ingestion_burst_size" json:"ingestion_burst_size"`
+	IngestionRateBytes        float64             `yaml:"ingestion_rate_bytes" json:"ingestion_rate_bytes"`
+	IngestionBurstSizeBytes   int                 `yaml:"ingestion_burst_size_bytes" json:"ingestion_burst_size_bytes"`
 	AcceptHASamples           bool                `yaml:"accept_ha_samples" json:"accept_ha_samples"`
 	HAClusterLabel            string              `yaml:"ha_cluster_label" json:"ha_cluster_label"`
 	HAReplicaLabel            string              `yaml:"ha_replica_label" json:"ha_replica_label"`
 	HAMaxClusters             int                 `yaml:"ha_max_clusters" json:"ha_max_clusters"`
+	HALabelPairs              []HALabelPair       `yaml:"ha_label_pairs" json:"ha_label_pairs" doc:"nocli|description=[Experimental] Additional pairs of cluster and replica label names identifying the HA replicas, for example to deduplicate Prometheus and Thanos ruler HA pairs of the same tenant using different labels. The pairs are looked for in order, after the ha_cluster_label and ha_replica_label pair, and the first pair with both labels in the series is used. The cluster label values must be unique across the pairs."`
+	HAFailoverTimeout         model.Duration      `yaml:"ha_failover_timeout" json:"ha_failover_timeout" doc:"nocli|description=[Experimental] Per-tenant failover timeout of the HA tracker, overriding -distributor.ha-tracker.failover-timeout. It's raised to the update timeout plus the max update timeout jitter plus 1s if lower. 0 to use -distributor.ha-tracker.failover-timeout.|default=0"`
 	DropLabels                flagext.StringSlice `yaml:"drop_labels" json:"drop_labels"`
 	MaxLabelNameLength        int                 `yaml:"max_label_name_length" json:"max_label_name_length"`
 	MaxLabelValueLength       int                 `yaml:"max_label_value_length" json:"max_label_value_length"`
@@ -106,8 +159,20 @@ type Limits struct {
 	EnforceMetadataMetricName bool                `yaml:"enforce_metadata_metric_name" json:"enforce_metadata_metric_name"`
 	EnforceMetricName         bool                `yaml:"enforce_metric_name" json:"enforce_metric_name"`
 	IngestionTenantShardSize  int                 `yaml:"ingestion_tenant_shard_size" json:"ingestion_tenant_shard_size"`
+	WriteQuorum               string              `yaml:"write_quorum" json:"write_quorum"`
 	MetricRelabelConfigs      []*relabel.Config   `yaml:"metric_relabel_configs,omitempty" json:"metric_relabel_configs,omitempty" doc:"nocli|description=List of metric relabel configurations. Note that in most situations, it is more effective to use metrics relabeling directly in the Prometheus server, e.g. remote_write.write_relabel_configs."`
 	MaxExemplars              int                 `yaml:"max_exemplars" json:"max_exemplars"`
+	SeriesSamplingRatio       int                 `yaml:"series_sampling_ratio" json:"series_sampling_ratio"`
+	SeriesSamplingMinSeries   int                 `yaml:"series_sampling_min_series" json:"series_sampling_min_series"`
+	StripStaleMarkers         bool                `yaml:"strip_stale_markers" json:"strip_stale_markers"`
+	IngestAggregationInterval model.Duration      `yaml:"ingest_aggregation_interval" json:"ingest_aggregation_interval"`
+	IngestAggregationFunction string              `yaml:"ingest_aggregation_function" json:"ingest_aggregation_function"`
+	RequiredLabels            flagext.StringSlice `yaml:"required_labels" json:"required_labels"`
+	DisabledValidationChecks  flagext.StringSlice `yaml:"disabled_validation_checks" json:"disabled_validation_checks"`
+
+	MaxConcurrentPushRequests         int                    `yaml:"max_concurrent_push_requests" json:"max_concurrent_push_requests"`
+	ConcurrentPushRequestsWaitTimeout model.Duration         `yaml:"concurrent_push_requests_wait_timeout" json:"concurrent_push_requests_wait_timeout"`
+	PushAcceptanceWindows             []PushAcceptanceWindow `yaml:"push_acceptance_windows" json:"push_acceptance_windows" doc:"nocli|description=[Experimental] Daily time windows within which the pushes of the tenant are accepted. The pushes received outside of all the windows are rejected, and their samples, exemplars and metadata discarded. Empty list to accept the pushes at any time."`
 
 	// Ingester enforced limits.
 	// Series
@@ -117,25 +182,61 @@ type Limits struct {
 	MaxGlobalSeriesPerMetric int                    `yaml:"max_global_series_per_metric" json:"max_global_series_per_metric"`
 	MaxSeriesPerLabelSet     []MaxSeriesPerLabelSet `yaml:"max_series_per_label_set" json:"max_series_per_label_set" doc:"nocli|description=[Experimental] The maximum number of active series per LabelSet, across the cluster before replication. Empty list to disable."`
 
+	// Exemplars
+	MaxExemplarsIngestionRate              float64 `yaml:"max_exemplars_ingestion_rate" json:"max_exemplars_ingestion_rate"`
+	MaxExemplarsIngestionBurstSize         int     `yaml:"max_exemplars_ingestion_burst_size" json:"max_exemplars_ingestion_burst_size"`
+	DistributorExemplarsIngestionRate      float64 `yaml:"distributor_exemplars_ingestion_rate" json:"distributor_exemplars_ingestion_rate"`
+	DistributorExemplarsIngestionBurstSize int     `yaml:"distributor_exemplars_ingestion_burst_size" json:"distributor_exemplars_ingestion_burst_size"`
+	MaxExemplarLabelNames                  int     `yaml:"max_exemplar_label_names" json:"max_exemplar_label_names"`
+	MaxExemplarLabelSetLength              int     `yaml:"max_exemplar_label_set_length" json:"max_exemplar_label_set_length"`
+
 	// Metadata
 	MaxLocalMetricsWithMetadataPerUser  int `yaml:"max_metadata_per_user" json:"max_metadata_per_user"`
 	MaxLocalMetadataPerMetric           int `yaml:"max_metadata_per_metric" json:"max_metadata_per_metric"`
 	MaxGlobalMetricsWithMetadataPerUser int `yaml:"max_global_metadata_per_user" json:"max_global_metadata_per_user"`
 	MaxGlobalMetadataPerMetric          int `yaml:"max_global_metadata_per_metric" json:"max_global_metadata_per_metric"`
+
+	RejectMetricTypeConflicts bool `yaml:"reject_metric_type_conflicts" json:"reject_metric_type_conflicts"`
 	// Out-of-order
-	OutOfOrderTimeWindow model.Duration `yaml:"out_of_order_time_window" json:"out_of_order_time_window"`
+	OutOfOrderTimeWindow           model.Duration `yaml:"out_of_order_time_window" json:"out_of_order_time_window"`
+	OutOfOrderRecentRejectedWindow model.Duration `yaml:"out_of_order_recent_rejected_window" json:"out_of_order_recent_rejected_window"`
+	// Native histograms
+	EnableNativeHistograms    bool `yaml:"enable_native_histograms" json:"enable_native_histograms"`
+	MaxNativeHistogramBuckets int  `yaml:"max_native_histogram_buckets" json:"max_native_histogram_buckets"`
+
+	ShippedBlockShards     int            `yaml:"shipped_block_shards" json:"shipped_block_shards"`
+	FlushedBlocksRetention model.Duration `yaml:"flushed_blocks_retention" json:"flushed_blocks_retention"`
+
+	// Queries
+	MaxConcurrentIngesterQueries         int            `yaml:"max_concurrent_ingester_queries" json:"max_concurrent_ingester_queries"`
+	ConcurrentIngesterQueriesWaitTimeout model.Duration `yaml:"concurrent_ingester_queries_wait_timeout" json:"concurrent_ingester_queries_wait_timeout"`
 
 	// Querier enforced limits.
-	MaxChunksPerQuery            int            `yaml:"max_fetched_chunks_per_query" json:"max_fetched_chunks_per_query"`
-	MaxFetchedSeriesPerQuery     int            `yaml:"max_fetched_series_per_query" json:"max_fetched_series_per_query"`
-	MaxFetchedChunkBytesPerQuery int            `yaml:"max_fetched_chunk_bytes_per_query" json:"max_fetched_chunk_bytes_per_query"`
-	MaxFetchedDataBytesPerQuery  int            `yaml:"max_fetched_data_bytes_per_query" json:"max_fetched_data_bytes_per_query"`
-	MaxQueryLookback             model.Duration `yaml:"max_query_lookback" json:"max_query_lookback"`
-	MaxQueryLength               model.Duration `yaml:"max_query_length" json:"max_query_length"`
-	MaxQueryParallelism          int            `yaml:"max_query_parallelism" json:"max_query_parallelism"`
-	MaxCacheFreshness            model.Duration `yaml:"max_cache_freshness" json:"max_cache_freshness"`
-	MaxQueriersPerTenant         float64        `yaml:"max_queriers_per_tenant" json:"max_queriers_per_tenant"`
-	QueryVerticalShardSize       int            `yaml:"query_vertical_shard_size" json:"query_vertical_shard_size" doc:"hidden"`
+	MaxChunksPerQuery                    int            `yaml:"max_fetched_chunks_per_query" json:"max_fetched_chunks_per_query"`
+	MaxFetchedSeriesPerQuery             int            `yaml:"max_fetched_series_per_query" json:"max_fetched_series_per_query"`
+	MaxFetchedChunkBytesPerQuery         int            `yaml:"max_fetched_chunk_bytes_per_query" json:"max_fetched_chunk_bytes_per_query"`
+	MaxFetchedDataBytesPerQuery          int            `yaml:"max_fetched_data_bytes_per_query" json:"max_fetched_data_bytes_per_query"`
+	MaxStoreGatewayStreamedBytesPerQuery int            `yaml:"max_store_gateway_streamed_bytes_per_query" json:"max_store_gateway_streamed_bytes_per_query"`
+	MaxExemplarsPerQuery                 int            `yaml:"max_exemplars_per_query" json:"max_exemplars_per_query"`
+	MaxQueryLookback                     model.Duration `yaml:"max_query_lookback" json:"max_query_lookback"`
+	MaxQueryLength                       model.Duration `yaml:"max_query_length" json:"max_query_length"`
+	MaxQueryParallelism                  int            `yaml:"max_query_parallelism" json:"max_query_parallelism"`
+	MaxCacheFreshness                    model.Duration `yaml:"max_cache_freshness" json:"max_cache_freshness"`
+	MaxQueriersPerTenant                 float64        `yaml:"max_queriers_per_tenant" json:"max_queriers_per_tenant"`
+	QueryVerticalShardSize               int            `yaml:"query_vertical_shard_size" json:"query_vertical_shard_size" doc:"hidden"`
+	MaxSamplesPerQueryResponse           int            `yaml:"max_samples_per_query_response" json:"max_samples_per_query_response"`
+	SortInstantQueryResults              bool           `yaml:"sort_instant_query_results" json:"sort_instant_query_results"`
+	MinQueryStep                         model.Duration `yaml:"min_query_step" json:"min_query_step"`
+	MinQueryStepPolicy                   string         `yaml:"min_query_step_policy" json:"min_query_step_policy"`
+	QueryPartialResults                  bool           `yaml:"query_partial_results" json:"query_partial_results"`
+	SplitQueriesMinRange                 model.Duration `yaml:"split_queries_min_range" json:"split_queries_min_range"`
+	MaxSplitQueries                      int            `yaml:"max_split_queries" json:"max_split_queries"`
+
+	QueryInvalidValuesFilteredFunctions flagext.StringSlice `yaml:"query_invalid_values_filtered_functions" json:"query_invalid_values_filtered_functions"`
+
+	QueryResultRelabelConfigs []*relabel.Config `yaml:"query_result_relabel_configs,omitempty" json:"query_result_relabel_configs,omitempty" doc:"nocli|description=[Experimental] List of relabel configurations applied by the querier to the series returned by the queries, to present the labels under different names without changing the stored series. Only the replace, labelmap, labeldrop, labelkeep, lowercase and uppercase actions are supported. The label matchers of the queries still select the stored labels, and the series ending up with the same labels are merged. The label names and values APIs return the relabeled labels."`
+
+	TenantFederationSelectors []string `yaml:"tenant_federation_selectors,omitempty" json:"tenant_federation_selectors,omitempty" doc:"nocli|description=[Experimental] List of tenant selectors a federated query for this tenant ID is resolved to, when -tenant-federation.tenant-selectors-enabled is true. Each selector is a tenant ID where * matches any sequence of characters, resolved to the known tenants matching it. The selectors are only read from this limit, never from the X-Scope-OrgID header."`
 
 	// Query Frontend / Scheduler enforced limits.
 	MaxOutstandingPerTenant    int           `yaml:"max_outstanding_requests_per_tenant" json:"max_outstanding_requests_per_tenant"`
@@ -144,18 +245,26 @@ type Limits struct {
 	queryPriorityCompiledRegex map[string]*regexp.Regexp
 
 	// Ruler defaults and limits.
-	RulerEvaluationDelay        model.Duration `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
-	RulerTenantShardSize        int            `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
-	RulerMaxRulesPerRuleGroup   int            `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
-	RulerMaxRuleGroupsPerTenant int            `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
+	RulerEvaluationDelay        model.Duration      `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
+	RulerTenantShardSize        int                 `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
+	RulerMaxRulesPerRuleGroup   int                 `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
+	RulerMaxRuleGroupsPerTenant int                 `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
+	RulerFeatureFlags           flagext.StringSlice `yaml:"ruler_feature_flags" json:"ruler_feature_flags"`
+
+	RulerMaxConcurrentGroupEvaluations   int            `yaml:"ruler_max_concurrent_group_evaluations" json:"ruler_max_concurrent_group_evaluations"`
+	RulerSkipUnchangedResultsMaxInterval model.Duration `yaml:"ruler_skip_unchanged_results_max_interval" json:"ruler_skip_unchanged_results_max_interval"`
+	RulerReloadQuietPeriod               model.Duration `yaml:"ruler_reload_quiet_period" json:"ruler_reload_quiet_period"`
+	RulerNotificationDeduplication       bool           `yaml:"ruler_notification_deduplication" json:"ruler_notification_deduplication"`
 
 	// Store-gateway.
 	StoreGatewayTenantShardSize  float64 `yaml:"store_gateway_tenant_shard_size" json:"store_gateway_tenant_shard_size"`
 	MaxDownloadedBytesPerRequest int     `yaml:"max_downloaded_bytes_per_request" json:"max_downloaded_bytes_per_request"`
+	StoreGatewayIndexCacheTier   string  `yaml:"store_gateway_index_cache_tier" json:"store_gateway_index_cache_tier"`
 
 	// Compactor.
 	CompactorBlocksRetentionPeriod model.Duration `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
 	CompactorTenantShardSize       int            `yaml:"compactor_tenant_shard_size" json:"compactor_tenant_shard_size"`
+	CompactorCompactionOrder       string         `yaml:"compactor_compaction_order" json:"compactor_compaction_order"`
 
 	// This config doesn't have a CLI flag registered here because they're registered in
 	// their own original config struct.
@@ -176,6 +285,12 @@ type Limits struct {
 	AlertmanagerMaxDispatcherAggregationGroups int                `yaml:"alertmanager_max_dispatcher_aggregation_groups" json:"alertmanager_max_dispatcher_aggregation_groups"`
 	AlertmanagerMaxAlertsCount                 int                `yaml:"alertmanager_max_alerts_count" json:"alertmanager_max_alerts_count"`
 	AlertmanagerMaxAlertsSizeBytes             int                `yaml:"alertmanager_max_alerts_size_bytes" json:"alertmanager_max_alerts_size_bytes"`
+	AlertmanagerMaxConcurrentNotifications     int                `yaml:"alertmanager_max_concurrent_notifications" json:"alertmanager_max_concurrent_notifications"`
+	AlertmanagerTemplateExecutionTimeout       model.Duration     `yaml:"alertmanager_template_execution_timeout" json:"alertmanager_template_execution_timeout"`
+	AlertmanagerTemplateMaxOutputSizeBytes     int                `yaml:"alertmanager_template_max_output_size_bytes" json:"alertmanager_template_max_output_size_bytes"`
+	AlertmanagerMaxLabelSetsPerAlertName       int                `yaml:"alertmanager_max_label_sets_per_alert_name" json:"alertmanager_max_label_sets_per_alert_name"`
+	AlertmanagerLabelSetsWindow                model.Duration     `yaml:"alertmanager_label_sets_window" json:"alertmanager_label_sets_window"`
+	AlertmanagerMaxActiveAlerts                int                `yaml:"alertmanager_max_active_alerts" json:"alertmanager_max_active_alerts"`
 	DisabledRuleGroups                         DisabledRuleGroups `yaml:"disabled_rule_groups" json:"disabled_rule_groups" doc:"nocli|description=list of rule groups to disable"`
 }
 
@@ -184,9 +299,12 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	flagext.DeprecatedFlag(f, "ingester.max-series-per-query", "Deprecated: The maximum number of series for which a query can fetch samples from each ingester. This limit is enforced only in the ingesters (when querying samples not flushed to the storage yet) and it's a per-instance limit. This limit is ignored when running the Cortex blocks storage. When running Cortex with blocks storage use -querier.max-fetched-series-per-query limit instead.", util_log.Logger)
 
 	f.IntVar(&l.IngestionTenantShardSize, "distributor.ingestion-tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used. Must be set both on ingesters and distributors. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant.")
+	f.StringVar(&l.WriteQuorum, "distributor.write-quorum", WriteQuorumMajority, "[Experimental] The quorum of the ingesters a series must be written to. majority requires a majority of the replicas, each-zone requires at least one replica in each zone, and all-but-one-zone requires all the replicas except the ones of at most one zone. The zone quorums apply only to the series whose replicas span multiple zones, the others use majority. Supported values are: "+strings.Join(WriteQuorums, ", ")+".")
 	f.Float64Var(&l.IngestionRate, "distributor.ingestion-rate-limit", 25000, "Per-user ingestion rate limit in samples per second.")
 	f.StringVar(&l.IngestionRateStrategy, "distributor.ingestion-rate-limit-strategy", "local", "Whether the ingestion rate limit should be applied individually to each distributor instance (local), or evenly shared across the cluster (global).")
 	f.IntVar(&l.IngestionBurstSize, "distributor.ingestion-burst-size", 50000, "Per-user allowed ingestion burst size (in number of samples).")
+	f.Float64Var(&l.IngestionRateBytes, "distributor.ingestion-rate-limit-bytes", 0, "[Experimental] Per-user ingestion rate limit in bytes per second, based on the uncompressed size of the push requests. It's applied like -distributor.ingestion-rate-limit, depending on -distributor.ingestion-rate-limit-strategy, and the requests exceeding it are rejected. 0 to disable.")
+	f.IntVar(&l.IngestionBurstSizeBytes, "distributor.ingestion-burst-size-bytes", 100<<20, "[Experimental] Per-user allowed ingestion burst size in bytes, based on the uncompressed size of the push requests. It should be greater than the size of the largest push request.")
 	f.BoolVar(&l.AcceptHASamples, "distributor.ha-tracker.enable-for-all-users", false, "Flag to enable, for all users, handling of samples with external labels identifying replicas in an HA Prometheus setup.")
 	f.StringVar(&l.HAClusterLabel, "distributor.ha-tracker.cluster", "cluster", "Prometheus label to look for in samples to identify a Prometheus HA cluster.")
 	f.StringVar(&l.HAReplicaLabel, "distributor.ha-tracker.replica", "__replica__", "Prometheus label to look for in samples to identify a Prometheus HA replica.")
@@ -204,22 +322,47 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.CreationGracePeriod, "validation.create-grace-period", "Duration which table will be created/deleted before/after it's needed; we won't accept sample from before this time.")
 	f.BoolVar(&l.EnforceMetricName, "validation.enforce-metric-name", true, "Enforce every sample has a metric name.")
 	f.BoolVar(&l.EnforceMetadataMetricName, "validation.enforce-metadata-metric-name", true, "Enforce every metadata has a metric name.")
+	f.IntVar(&l.SeriesSamplingRatio, "distributor.series-sampling-ratio", 0, "[Experimental] If greater than 1, the distributor deterministically keeps only 1 in N series, based on the hash of the series labels, and drops all the samples and exemplars of the other series. The same series are consistently kept or dropped. Dropped data is lost and can't be recovered. 0 or 1 to disable.")
+	f.IntVar(&l.SeriesSamplingMinSeries, "distributor.series-sampling-min-series", 0, "[Experimental] If greater than 0, the series sampling configured by -distributor.series-sampling-ratio applies only while the tenant has at least this number of in-memory series in the ingesters, as a soft series budget, instead of always. The number of series of the tenants is refreshed from the ingesters every -distributor.series-sampling-refresh-period. The sampling stops once the series of the tenant decrease below the budget, for example after the sampled out series have been removed from the ingesters. 0 to always apply the sampling.")
+	f.BoolVar(&l.StripStaleMarkers, "distributor.strip-stale-markers", false, "[Experimental] Strip the Prometheus staleness markers from the received samples, for example while backfilling series. Stripped markers are tracked by the discarded samples metric with the 'stale_marker_stripped' reason.")
+	f.Var(&l.IngestAggregationInterval, "distributor.ingest-aggregation-interval", "[Experimental] If greater than 0, the distributor aggregates the float samples of each series received in the same write request into one sample per interval, aligned to the interval, before forwarding them to the ingesters. The aggregation is scoped to a single write request: the samples are not buffered across requests, so the samples of the same interval received in different write requests are not aggregated together, and a series can still have more than one sample per interval. This is only effective for clients batching many samples of each series in a write request. Aggregation reduces the stored resolution and the original samples are lost: 'avg' and 'max' also change the stored values, and counter resets within an interval are hidden. 0 to disable.")
+	f.StringVar(&l.IngestAggregationFunction, "distributor.ingest-aggregation-function", IngestAggregationLast, "[Experimental] Function used to aggregate the samples of each interval, when -distributor.ingest-aggregation-interval is enabled. Supported values are: "+strings.Join(IngestAggregationFunctions, ", ")+".")
+	f.Var(&l.RequiredLabels, "validation.required-label", "[Experimental] Label name every series must have, with a non-empty value. Series missing any of the required labels are rejected, and tracked by the discarded samples metric with the 'missing_required_label' reason. This flag can be repeated to require multiple labels.")
+	f.Var(&l.DisabledValidationChecks, "validation.disabled-check", "[Experimental] Validation check skipped by the distributor for the series pushed by the tenant, to save the cost of the check for trusted tenants. Disabling a check weakens the safety of the write path: the invalid series it would have rejected are ingested, and may fail later or break the queries. Supported values are: "+strings.Join(ValidationChecks, ", ")+". The sample_timestamp check covers the too old and too far in the future samples. The check of the sorted and duplicated label names can't be disabled. This flag can be repeated to disable multiple checks.")
+	f.IntVar(&l.MaxConcurrentPushRequests, "distributor.max-concurrent-push-requests", 0, "[Experimental] Maximum number of push requests of a single user that each distributor handles concurrently. This limit is per-distributor. Requests exceeding the limit wait for a request to complete, up to -distributor.concurrent-push-requests-wait-timeout, and are then rejected with a 429 status code. 0 = unlimited.")
+	f.Var(&l.ConcurrentPushRequestsWaitTimeout, "distributor.concurrent-push-requests-wait-timeout", "[Experimental] Maximum time a push request exceeding -distributor.max-concurrent-push-requests waits for a request of the same user to complete, before being rejected. 0 to reject the exceeding requests immediately.")
 
 	f.IntVar(&l.MaxLocalSeriesPerUser, "ingester.max-series-per-user", 5000000, "The maximum number of active series per user, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxLocalSeriesPerMetric, "ingester.max-series-per-metric", 50000, "The maximum number of active series per metric name, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxGlobalSeriesPerUser, "ingester.max-global-series-per-user", 0, "The maximum number of active series per user, across the cluster before replication. 0 to disable. Supported only if -distributor.shard-by-all-labels is true.")
 	f.IntVar(&l.MaxGlobalSeriesPerMetric, "ingester.max-global-series-per-metric", 0, "The maximum number of active series per metric name, across the cluster before replication. 0 to disable.")
 	f.IntVar(&l.MaxExemplars, "ingester.max-exemplars", 0, "Enables support for exemplars in TSDB and sets the maximum number that will be stored. less than zero means disabled. If the value is set to zero, cortex will fallback to blocks-storage.tsdb.max-exemplars value.")
+	f.Float64Var(&l.MaxExemplarsIngestionRate, "ingester.max-exemplars-ingestion-rate", 0, "[Experimental] Per-user exemplars ingestion rate limit (exemplars/sec), per ingester. The exemplars exceeding the limit are dropped, while their samples are still ingested. 0 to disable.")
+	f.IntVar(&l.MaxExemplarsIngestionBurstSize, "ingester.max-exemplars-ingestion-burst-size", 1000, "[Experimental] Per-user allowed exemplars ingestion burst size (in number of exemplars), per ingester. The exemplars of a series are all ingested or dropped together, so the burst size should be greater than the number of exemplars pushed per series.")
+	f.Float64Var(&l.DistributorExemplarsIngestionRate, "distributor.exemplars-ingestion-rate-limit", 0, "[Experimental] Per-user exemplars ingestion rate limit (exemplars/sec) in the distributors, applied individually to each distributor or evenly shared across the cluster like -distributor.ingestion-rate-limit, depending on -distributor.ingestion-rate-limit-strategy. The exemplars of the requests exceeding the limit are dropped, while their samples are still ingested. Unlike -ingester.max-exemplars-ingestion-rate, enforced by each ingester, this limit is enforced by the distributors. 0 to disable.")
+	f.IntVar(&l.DistributorExemplarsIngestionBurstSize, "distributor.exemplars-ingestion-burst-size", 1000, "[Experimental] Per-user allowed exemplars ingestion burst size (in number of exemplars) in the distributors. The exemplars of a request are all ingested or dropped together, so the burst size should be greater than the number of exemplars pushed per request.")
+	f.IntVar(&l.MaxExemplarLabelNames, "validation.max-exemplar-label-names", 0, "[Experimental] Maximum number of label names per exemplar. 0 to disable.")
+	f.IntVar(&l.MaxExemplarLabelSetLength, "validation.max-exemplar-label-set-length", ExemplarMaxLabelSetLength, "[Experimental] Maximum combined length of the label names and values of an exemplar, in UTF-8 characters. Must not be greater than 128, the limit of the OpenMetrics specification enforced by the ingesters. 0 to disable the check in the distributors.")
 	f.Var(&l.OutOfOrderTimeWindow, "ingester.out-of-order-time-window", "[Experimental] Configures the allowed time window for ingestion of out-of-order samples. Disabled (0s) by default.")
+	f.Var(&l.OutOfOrderRecentRejectedWindow, "ingester.out-of-order-recent-rejected-window", "[Experimental] Samples rejected for being older than the out-of-order time window by less than this duration are tracked by the cortex_ingester_out_of_order_recent_rejected_samples_total metric, and their timestamps are logged (rate limited) to help diagnosing clock skew. Samples are rejected anyway. Requires the out-of-order time window to be enabled. Disabled (0s) by default.")
+	f.BoolVar(&l.EnableNativeHistograms, "ingester.enable-native-histograms", false, "[Experimental] Enables the ingestion of native histograms. When disabled, the native histogram samples are discarded by the ingesters and tracked by cortex_discarded_samples_total{reason=\"native-histogram-sample\"}.")
+	f.IntVar(&l.MaxNativeHistogramBuckets, "validation.max-native-histogram-buckets", 0, "[Experimental] Maximum number of buckets of a native histogram sample, counting both the positive and negative buckets. The native histogram samples with more buckets are rejected by the distributor. 0 to disable.")
+	f.IntVar(&l.ShippedBlockShards, "ingester.shipped-block-shards", 0, "[Experimental] If greater than 1, the ingester splits each block compacted from the head in this number of smaller blocks by series hash, and uploads them in parallel to the storage, to reduce the time for the blocks to be queryable. Each block has the __shard__ external label set to its shard, like 1_of_4. The compactor merges the shards back together. 0 or 1 to ship the blocks as they are.")
+	f.Var(&l.FlushedBlocksRetention, "ingester.flushed-blocks-retention", "[Experimental] Minimum time the ingester keeps a block queryable after it has been shipped to the storage, so that the queries of the recent data are still served while the store-gateways have not synced the block yet. Within this time, the block is neither deleted by the TSDB retention nor by closing the idle TSDB of the user. The time is tracked since the block has been first seen shipped by the ingester, including after a restart. 0 to disable.")
+	f.IntVar(&l.MaxConcurrentIngesterQueries, "ingester.max-concurrent-queries", 0, "[Experimental] Maximum number of QueryStream, QueryExemplars, label and series requests of a single user that each ingester handles concurrently, so that the heavy queries of a user cannot starve the push path and the queries of the other users. This limit is per-ingester. Requests exceeding the limit wait in a queue for a request to complete, up to -ingester.concurrent-queries-wait-timeout, and are then rejected with a 429 status code. 0 = unlimited.")
+	f.Var(&l.ConcurrentIngesterQueriesWaitTimeout, "ingester.concurrent-queries-wait-timeout", "[Experimental] Maximum time a query request exceeding -ingester.max-concurrent-queries waits for a query of the same user to complete, before being rejected. 0 to shed the exceeding requests immediately.")
 
 	f.IntVar(&l.MaxLocalMetricsWithMetadataPerUser, "ingester.max-metadata-per-user", 8000, "The maximum number of active metrics with metadata per user, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxLocalMetadataPerMetric, "ingester.max-metadata-per-metric", 10, "The maximum number of metadata per metric, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxGlobalMetricsWithMetadataPerUser, "ingester.max-global-metadata-per-user", 0, "The maximum number of active metrics with metadata per user, across the cluster. 0 to disable. Supported only if -distributor.shard-by-all-labels is true.")
 	f.IntVar(&l.MaxGlobalMetadataPerMetric, "ingester.max-global-metadata-per-metric", 0, "The maximum number of metadata per metric, across the cluster. 0 to disable.")
+	f.BoolVar(&l.RejectMetricTypeConflicts, "ingester.reject-metric-type-conflicts", false, "[Experimental] Reject the metadata of a metric whose type conflicts with the type of the metadata already held in memory for the same metric, for example a counter and a gauge exposed with the same name by different targets. Rejected metadata is tracked by the discarded metadata metric with the 'metric_type_conflict' reason. The samples carry no type, so they're still ingested.")
 	f.IntVar(&l.MaxChunksPerQuery, "querier.max-fetched-chunks-per-query", 2000000, "Maximum number of chunks that can be fetched in a single query from ingesters and long-term storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
 	f.IntVar(&l.MaxFetchedSeriesPerQuery, "querier.max-fetched-series-per-query", 0, "The maximum number of unique series for which a query can fetch samples from each ingesters and blocks storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable")
 	f.IntVar(&l.MaxFetchedChunkBytesPerQuery, "querier.max-fetched-chunk-bytes-per-query", 0, "Deprecated (use max-fetched-data-bytes-per-query instead): The maximum size of all chunks in bytes that a query can fetch from each ingester and storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
 	f.IntVar(&l.MaxFetchedDataBytesPerQuery, "querier.max-fetched-data-bytes-per-query", 0, "The maximum combined size of all data that a query can fetch from each ingester and storage. This limit is enforced in the querier and ruler for `query`, `query_range` and `series` APIs. 0 to disable.")
+	f.IntVar(&l.MaxStoreGatewayStreamedBytesPerQuery, "querier.max-store-gateway-streamed-bytes-per-query", 0, "[Experimental] The maximum number of bytes of series responses the store-gateways can stream back for a single query. The size of the responses of all the store-gateways queried, including the retries, is accounted by the querier while streaming, and the query is aborted as soon as the limit is exceeded. 0 to disable.")
+	f.IntVar(&l.MaxExemplarsPerQuery, "querier.max-exemplars-per-query", 0, "[Experimental] The maximum number of exemplars an exemplar query can return, across all the returned series. When exceeded, the exemplars of the series in label order are returned up to the limit, and the response has the X-Cortex-Partial-Response header. This limit is enforced in the distributor when merging the exemplars of the ingesters. 0 to disable.")
 	f.Var(&l.MaxQueryLength, "store.max-query-length", "Limit the query time range (end - start time of range query parameter and max - min of data fetched time range). This limit is enforced in the query-frontend and ruler (on the received query). 0 to disable.")
 	f.Var(&l.MaxQueryLookback, "querier.max-query-lookback", "Limit how long back data (series and metadata) can be queried, up until <lookback> duration ago. This limit is enforced in the query-frontend, querier and ruler. If the requested time range is outside the allowed range, the request will not fail but will be manipulated to only query data within the allowed time range. 0 to disable.")
 	f.IntVar(&l.MaxQueryParallelism, "querier.max-query-parallelism", 14, "Maximum number of split queries will be scheduled in parallel by the frontend.")
@@ -227,6 +370,14 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.MaxCacheFreshness, "frontend.max-cache-freshness", "Most recent allowed cacheable result per-tenant, to prevent caching very recent results that might still be in flux.")
 	f.Float64Var(&l.MaxQueriersPerTenant, "frontend.max-queriers-per-tenant", 0, "Maximum number of queriers that can handle requests for a single tenant. If set to 0 or value higher than number of available queriers, *all* queriers will handle requests for the tenant. If the value is < 1, it will be treated as a percentage and the gets a percentage of the total queriers. Each frontend (or query-scheduler, if used) will select the same set of queriers for the same tenant (given that all queriers are connected to all frontends / query-schedulers). This option only works with queriers connecting to the query-frontend / query-scheduler, not when using downstream URL.")
 	f.IntVar(&l.QueryVerticalShardSize, "frontend.query-vertical-shard-size", 0, "[Experimental] Number of shards to use when distributing shardable PromQL queries.")
+	f.IntVar(&l.MaxSamplesPerQueryResponse, "frontend.max-samples-per-query-response", 0, "The maximum number of samples (points) a range query response can contain, across all the returned series. When exceeded, the query fails suggesting to increase the query step. This limit is enforced in the query-frontend. 0 to disable.")
+	f.BoolVar(&l.SortInstantQueryResults, "frontend.sort-instant-query-results", false, "[Experimental] Sort the series of instant vector query results by their labels, to return them in a stable order. Results of queries whose order is defined by the query itself, like sort(), sort_desc(), topk() and bottomk(), are not sorted. This is enforced in the query-frontend.")
+	f.Var(&l.MinQueryStep, "frontend.min-query-step", "[Experimental] The minimum step of range queries. Range queries with a smaller step are rejected or get their step increased to the minimum, depending on -frontend.min-query-step-policy. This limit is enforced in the query-frontend. 0 to disable.")
+	f.BoolVar(&l.QueryPartialResults, "frontend.query-partial-results", false, "[Experimental] If true, when some of the range queries split by interval fail with a server error, the query-frontend returns the results of the other ones with a 'partial result' warning, instead of failing the query. The results of the failed time ranges are missing. If false, the query fails as soon as one of them fails.")
+	f.Var(&l.SplitQueriesMinRange, "frontend.split-queries-min-range", "[Experimental] The minimum time range of range queries split by interval. Range queries with a shorter time range are executed as a single query, since the overhead of splitting them exceeds the benefit. This is enforced in the query-frontend. 0 to disable.")
+	f.Var(&l.QueryInvalidValuesFilteredFunctions, "querier.invalid-values-filtered-function", "[Experimental] PromQL function or aggregation, like sum or rate, whose input samples are filtered from the Inf and NaN values by the querier, emulating a skip invalid values mode. This changes the query results: the Inf and NaN samples are dropped as if they were never ingested, instead of propagating to the result. Only the samples of the series the function is directly applied to are filtered: x is filtered in sum(x) if sum is configured, but in sum(rate(x[5m])) only if rate is configured. The staleness markers are kept. A warning is added to the query response when samples are filtered. The selected series are loaded in memory to filter them. This flag can be repeated to filter the input of multiple functions.")
+	f.IntVar(&l.MaxSplitQueries, "frontend.max-split-queries", 0, "[Experimental] Maximum number of queries a single range query can be split into by interval. Range queries exceeding the limit are rejected. This is enforced in the query-frontend. 0 to disable.")
+	f.StringVar(&l.MinQueryStepPolicy, "frontend.min-query-step-policy", MinQueryStepPolicyReject, "[Experimental] How to handle range queries with a step smaller than -frontend.min-query-step. Supported values are: "+strings.Join(MinQueryStepPolicies, ", ")+".")
 	f.BoolVar(&l.QueryPriority.Enabled, "frontend.query-priority.enabled", false, "Whether queries are assigned with priorities.")
 	f.Int64Var(&l.QueryPriority.DefaultPriority, "frontend.query-priority.default-priority", 0, "Priority assigned to all queries by default. Must be a unique value. Use this as a baseline to make certain queries higher/lower priority.")
 
@@ -236,13 +387,20 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.RulerTenantShardSize, "ruler.tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used by ruler. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant.")
 	f.IntVar(&l.RulerMaxRulesPerRuleGroup, "ruler.max-rules-per-rule-group", 0, "Maximum number of rules per rule group per-tenant. 0 to disable.")
 	f.IntVar(&l.RulerMaxRuleGroupsPerTenant, "ruler.max-rule-groups-per-tenant", 0, "Maximum number of rule groups per-tenant. 0 to disable.")
+	f.Var(&l.RulerFeatureFlags, "ruler.feature-flags", "Feature flag enabled for the tenant. Rule groups tagged with a feature flag are only evaluated for tenants having it. This flag can be repeated to enable multiple feature flags.")
+	f.IntVar(&l.RulerMaxConcurrentGroupEvaluations, "ruler.max-concurrent-group-evaluations", 0, "[Experimental] Maximum number of rule groups of a tenant evaluated concurrently by a ruler. Rule group evaluations exceeding the limit wait for a running one to complete. 0 to disable.")
+	f.Var(&l.RulerSkipUnchangedResultsMaxInterval, "ruler.skip-unchanged-results-max-interval", "[Experimental] When greater than 0, the ruler skips writing the results of a rule evaluation identical to the ones written by the previous evaluation, detected by hashing the result series and values. The results are written anyway once this interval has elapsed since the last write, so it must be lower than the query lookback delta to not get the series marked as stale. 0 to disable.")
+	f.Var(&l.RulerReloadQuietPeriod, "ruler.reload-quiet-period", "[Experimental] When greater than 0, the changes to the content of the rule groups of a tenant owned by the ruler are applied only once the rule groups have not changed for this period, so that rapid successive updates coalesce into a single reload. The rule groups newly owned by the ruler, because created or moved from another ruler, are loaded straight away, and the rule groups not owned anymore are unloaded straight away. 0 to reload the rule groups on every change.")
+	f.BoolVar(&l.RulerNotificationDeduplication, "ruler.notification-deduplication", true, "[Experimental] Whether the alert notifications of the tenant are deduplicated across the ruler replicas, when -ruler.notification-dedup.enabled is true.")
 
 	f.Var(&l.CompactorBlocksRetentionPeriod, "compactor.blocks-retention-period", "Delete blocks containing samples older than the specified retention period. 0 to disable.")
 	f.IntVar(&l.CompactorTenantShardSize, "compactor.tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used by the compactor. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant.")
+	f.StringVar(&l.CompactorCompactionOrder, "compactor.compaction-order", CompactionOrderOldestFirst, "[Experimental] Order in which the compactor compacts blocks with the same time range size. Smaller time ranges are always compacted before bigger ones, this only changes whether older or newer time ranges are compacted first. The newest-first order is only supported by the shuffle-sharding strategy of the compactor. Supported values are: "+strings.Join(CompactionOrders, ", ")+".")
 
 	// Store-gateway.
 	f.Float64Var(&l.StoreGatewayTenantShardSize, "store-gateway.tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used. Must be set when the store-gateway sharding is enabled with the shuffle-sharding strategy. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant. If the value is < 1 the shard size will be a percentage of the total store-gateways.")
 	f.IntVar(&l.MaxDownloadedBytesPerRequest, "store-gateway.max-downloaded-bytes-per-request", 0, "The maximum number of data bytes to download per gRPC request in Store Gateway, including Series/LabelNames/LabelValues requests. 0 to disable.")
+	f.StringVar(&l.StoreGatewayIndexCacheTier, "store-gateway.index-cache-tier", "", "[Experimental] The index cache tier of the tenant. If the tier has a reserved capacity configured in -blocks-storage.bucket-store.index-cache.tiers-reserved-size-bytes, the tenant index cache entries are also kept in the tier dedicated partition, which can't be evicted by tenants of other tiers. Empty to not assign the tenant to any tier.")
 
 	// Alertmanager.
 	f.Var(&l.AlertmanagerReceiversBlockCIDRNetworks, "alertmanager.receivers-firewall-block-cidr-networks", "Comma-separated list of network CIDRs to block in Alertmanager receiver integrations.")
@@ -260,6 +418,13 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.AlertmanagerMaxDispatcherAggregationGroups, "alertmanager.max-dispatcher-aggregation-groups", 0, "Maximum number of aggregation groups in Alertmanager's dispatcher that a tenant can have. Each active aggregation group uses single goroutine. When the limit is reached, dispatcher will not dispatch alerts that belong to additional aggregation groups, but existing groups will keep working properly. 0 = no limit.")
 	f.IntVar(&l.AlertmanagerMaxAlertsCount, "alertmanager.max-alerts-count", 0, "Maximum number of alerts that a single user can have. Inserting more alerts will fail with a log message and metric increment. 0 = no limit.")
 	f.IntVar(&l.AlertmanagerMaxAlertsSizeBytes, "alertmanager.max-alerts-size-bytes", 0, "Maximum total size of alerts that a single user can have, alert size is the sum of the bytes of its labels, annotations and generatorURL. Inserting more alerts will fail with a log message and metric increment. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxConcurrentNotifications, "alertmanager.max-concurrent-notifications", 0, "Maximum number of notifications that a single user can have in-flight at the same time, across all integrations. Notifications exceeding the limit are queued until an in-flight notification completes. 0 = no limit.")
+	f.Var(&l.AlertmanagerTemplateExecutionTimeout, "alertmanager.template-execution-timeout", "[Experimental] Maximum time the execution of the templates of a single notification can take. The time spent sending the notification to the receiver is not included. Notifications exceeding the timeout are failed and logged, and are not retried. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerTemplateMaxOutputSizeBytes, "alertmanager.template-max-output-size-bytes", 0, "[Experimental] Maximum size of the output of a single template executed for a notification. Notifications exceeding the limit are failed and logged, and are not retried. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxLabelSetsPerAlertName, "alertmanager.max-label-sets-per-alert-name", 0, "[Experimental] Maximum number of distinct label sets that a single user can send for the same alert name within -alertmanager.label-sets-window. Alerts with a new label set exceeding the limit are rejected with a log message and metric increment, while updates of the alerts already stored are always allowed. 0 = no limit.")
+	_ = l.AlertmanagerLabelSetsWindow.Set("1h")
+	f.Var(&l.AlertmanagerLabelSetsWindow, "alertmanager.label-sets-window", "[Experimental] Sliding window over which the distinct label sets of an alert name are counted by -alertmanager.max-label-sets-per-alert-name.")
+	f.IntVar(&l.AlertmanagerMaxActiveAlerts, "alertmanager.max-active-alerts", 0, "[Experimental] Maximum number of active alerts that a single user can have, not counting the resolved alerts still stored. Alerts becoming active beyond the limit are rejected with a log message and metric increment, while the active alerts keep being updated and resolved. 0 = no limit.")
 }
 
 // Validate the limits config and returns an error if the validation
@@ -271,9 +436,45 @@ func (l *Limits) Validate(shardByAllLabels bool) error {
 		return errMaxGlobalSeriesPerUserValidation
 	}
 
+	// An empty compaction order falls back to the default oldest-first order.
+	if l.CompactorCompactionOrder != "" && l.CompactorCompactionOrder != CompactionOrderOldestFirst && l.CompactorCompactionOrder != CompactionOrderNewestFirst {
+		return errInvalidCompactionOrder
+	}
+
+	// An empty policy falls back to the default reject policy.
+	if l.MinQueryStepPolicy != "" && l.MinQueryStepPolicy != MinQueryStepPolicyReject && l.MinQueryStepPolicy != MinQueryStepPolicyClamp {
+		return errInvalidMinQueryStepPolicy
+	}
+
+	// An empty function falls back to the default last function.
+	if l.IngestAggregationFunction != "" && !slices.Contains(IngestAggregationFunctions, l.IngestAggregationFunction) {
+		return errInvalidIngestAggregationFunction
+	}
+
+	// An empty quorum falls back to the default majority quorum.
+	if l.WriteQuorum != "" && !slices.Contains(WriteQuorums, l.WriteQuorum) {
+		return errInvalidWriteQuorum
+	}
+
+	for _, check := range l.DisabledValidationChecks {
+		if !slices.Contains(ValidationChecks, check) {
+			return errInvalidDisabledValidationCheck
+		}
+	}
+
+	// The ingesters reject the exemplars whose label set is longer anyway.
+	if l.MaxExemplarLabelSetLength > ExemplarMaxLabelSetLength {
+		return errInvalidMaxExemplarLabelSetLength
+	}
+
 	return nil
 }
 
+// ValidationCheckDisabled returns whether the write path validation check is disabled.
+func (l *Limits) ValidationCheckDisabled(check string) bool {
+	return slices.Contains(l.DisabledValidationChecks, check)
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (l *Limits) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// We want to set l to the defaults and then overwrite it with the input.
@@ -295,6 +496,18 @@ func (l *Limits) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
+	if err := l.compilePushAcceptanceWindows(); err != nil {
+		return err
+	}
+
+	if err := l.validateHALabelPairs(); err != nil {
+		return err
+	}
+
+	if err := l.validateQueryResultRelabelConfigs(); err != nil {
+		return err
+	}
+
 	l.calculateMaxSeriesPerLabelSetId()
 
 	return nil
@@ -323,11 +536,32 @@ func (l *Limits) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	if err := l.compilePushAcceptanceWindows(); err != nil {
+		return err
+	}
+
+	if err := l.validateHALabelPairs(); err != nil {
+		return err
+	}
+
+	if err := l.validateQueryResultRelabelConfigs(); err != nil {
+		return err
+	}
+
 	l.calculateMaxSeriesPerLabelSetId()
 
 	return nil
 }
 
+func (l *Limits) validateHALabelPairs() error {
+	for _, pair := range l.HALabelPairs {
+		if pair.ClusterLabel == "" || pair.ReplicaLabel == "" {
+			return errors.New("invalid HA label pair: the cluster and replica labels must be set")
+		}
+	}
+	return nil
+}
+
 func (l *Limits) calculateMaxSeriesPerLabelSetId() {
 	for k, limit := range l.MaxSeriesPerLabelSet {
 		limit.Id = limit.LabelSet.String()
@@ -452,6 +686,16 @@ func (o *Overrides) IngestionBurstSize(userID string) int {
 	return o.GetOverridesForUser(userID).IngestionBurstSize
 }
 
+// IngestionRateBytes returns the limit on the ingestion rate in bytes per second.
+func (o *Overrides) IngestionRateBytes(userID string) float64 {
+	return o.GetOverridesForUser(userID).IngestionRateBytes
+}
+
+// IngestionBurstSizeBytes returns the burst size in bytes of the ingestion rate limit in bytes.
+func (o *Overrides) IngestionBurstSizeBytes(userID string) int {
+	return o.GetOverridesForUser(userID).IngestionBurstSizeBytes
+}
+
 // AcceptHASamples returns whether the distributor should track and accept samples from HA replicas for this user.
 func (o *Overrides) AcceptHASamples(userID string) bool {
 	return o.GetOverridesForUser(userID).AcceptHASamples
@@ -467,6 +711,21 @@ func (o *Overrides) HAReplicaLabel(userID string) string {
 	return o.GetOverridesForUser(userID).HAReplicaLabel
 }
 
+// SeriesSamplingRatio returns N, where the distributor keeps only 1 in N series for the user.
+func (o *Overrides) SeriesSamplingRatio(userID string) int {
+	return o.GetOverridesForUser(userID).SeriesSamplingRatio
+}
+
+// SeriesSamplingMinSeries returns the number of series the user must have for the series sampling to apply.
+func (o *Overrides) SeriesSamplingMinSeries(userID string) int {
+	return o.GetOverridesForUser(userID).SeriesSamplingMinSeries
+}
+
+// StripStaleMarkers returns whether the distributor strips the staleness markers from the samples of the user.
+func (o *Overrides) StripStaleMarkers(userID string) bool {
+	return o.GetOverridesForUser(userID).StripStaleMarkers
+}
+
 // DropLabels returns the list of labels to be dropped when ingesting HA samples for the user.
 func (o *Overrides) DropLabels(userID string) flagext.StringSlice {
 	return o.GetOverridesForUser(userID).DropLabels
@@ -531,11 +790,32 @@ func (o *Overrides) MaxGlobalSeriesPerUser(userID string) int {
 	return o.GetOverridesForUser(userID).MaxGlobalSeriesPerUser
 }
 
+// EnableNativeHistograms returns whether the ingestion of native histograms is enabled for a given user.
+func (o *Overrides) EnableNativeHistograms(userID string) bool {
+	return o.GetOverridesForUser(userID).EnableNativeHistograms
+}
+
 // OutOfOrderTimeWindow returns the allowed time window for ingestion of out-of-order samples.
 func (o *Overrides) OutOfOrderTimeWindow(userID string) model.Duration {
 	return o.GetOverridesForUser(userID).OutOfOrderTimeWindow
 }
 
+// OutOfOrderRecentRejectedWindow returns the time window, beyond the out-of-order time window, within which
+// rejected samples are tracked as recently rejected.
+func (o *Overrides) OutOfOrderRecentRejectedWindow(userID string) model.Duration {
+	return o.GetOverridesForUser(userID).OutOfOrderRecentRejectedWindow
+}
+
+// FlushedBlocksRetention returns the minimum time the ingester keeps the blocks of the user queryable after they've been shipped.
+func (o *Overrides) FlushedBlocksRetention(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).FlushedBlocksRetention)
+}
+
+// ShippedBlockShards returns the number of shards the ingester splits the blocks of the user in before shipping them.
+func (o *Overrides) ShippedBlockShards(userID string) int {
+	return o.GetOverridesForUser(userID).ShippedBlockShards
+}
+
 // MaxGlobalSeriesPerMetric returns the maximum number of series allowed per metric across the cluster.
 func (o *Overrides) MaxGlobalSeriesPerMetric(userID string) int {
 	return o.GetOverridesForUser(userID).MaxGlobalSeriesPerMetric
@@ -562,6 +842,11 @@ func (o *Overrides) MaxFetchedSeriesPerQuery(userID string) int {
 	return o.GetOverridesForUser(userID).MaxFetchedSeriesPerQuery
 }
 
+// MaxExemplarsPerQuery returns the maximum number of exemplars an exemplar query can return.
+func (o *Overrides) MaxExemplarsPerQuery(userID string) int {
+	return o.GetOverridesForUser(userID).MaxExemplarsPerQuery
+}
+
 // MaxFetchedChunkBytesPerQuery returns the maximum number of bytes for chunks allowed per query when fetching
 // chunks from ingesters and blocks storage.
 func (o *Overrides) MaxFetchedChunkBytesPerQuery(userID string) int {
@@ -580,6 +865,12 @@ func (o *Overrides) MaxDownloadedBytesPerRequest(userID string) int {
 	return o.GetOverridesForUser(userID).MaxDownloadedBytesPerRequest
 }
 
+// MaxStoreGatewayStreamedBytesPerQuery returns the maximum number of bytes the store-gateways can stream back
+// to the querier for a single query.
+func (o *Overrides) MaxStoreGatewayStreamedBytesPerQuery(userID string) int {
+	return o.GetOverridesForUser(userID).MaxStoreGatewayStreamedBytesPerQuery
+}
+
 // MaxQueryLookback returns the max lookback period of queries.
 func (o *Overrides) MaxQueryLookback(userID string) time.Duration {
 	return time.Duration(o.GetOverridesForUser(userID).MaxQueryLookback)
@@ -606,12 +897,53 @@ func (o *Overrides) QueryVerticalShardSize(userID string) int {
 	return o.GetOverridesForUser(userID).QueryVerticalShardSize
 }
 
+// QueryPartialResults returns whether the query-frontend returns partial results when some of the split range queries fail.
+func (o *Overrides) QueryPartialResults(userID string) bool {
+	return o.GetOverridesForUser(userID).QueryPartialResults
+}
+
+// SplitQueriesMinRange returns the minimum time range of the range queries split by interval.
+func (o *Overrides) SplitQueriesMinRange(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).SplitQueriesMinRange)
+}
+
+// MaxSplitQueries returns the maximum number of queries a single range query can be split into by interval.
+func (o *Overrides) MaxSplitQueries(userID string) int {
+	return o.GetOverridesForUser(userID).MaxSplitQueries
+}
+
+// QueryInvalidValuesFilteredFunctions returns the PromQL functions whose input samples are filtered from the Inf and NaN values for the given user.
+func (o *Overrides) QueryInvalidValuesFilteredFunctions(userID string) []string {
+	return o.GetOverridesForUser(userID).QueryInvalidValuesFilteredFunctions
+}
+
+// SortInstantQueryResults returns whether the series of instant vector query results should be sorted by labels.
+func (o *Overrides) SortInstantQueryResults(userID string) bool {
+	return o.GetOverridesForUser(userID).SortInstantQueryResults
+}
+
 // MaxQueryParallelism returns the limit to the number of split queries the
 // frontend will process in parallel.
 func (o *Overrides) MaxQueryParallelism(userID string) int {
 	return o.GetOverridesForUser(userID).MaxQueryParallelism
 }
 
+// MinQueryStep returns the minimum step of range queries.
+func (o *Overrides) MinQueryStep(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).MinQueryStep)
+}
+
+// MinQueryStepPolicy returns how to handle range queries with a step smaller than the minimum.
+func (o *Overrides) MinQueryStepPolicy(userID string) string {
+	return o.GetOverridesForUser(userID).MinQueryStepPolicy
+}
+
+// MaxSamplesPerQueryResponse returns the limit to the number of samples
+// a range query response can contain.
+func (o *Overrides) MaxSamplesPerQueryResponse(userID string) int {
+	return o.GetOverridesForUser(userID).MaxSamplesPerQueryResponse
+}
+
 // MaxOutstandingPerTenant returns the limit to the maximum number
 // of outstanding requests per tenant per request queue.
 func (o *Overrides) MaxOutstandingPerTenant(userID string) int {
@@ -628,6 +960,36 @@ func (o *Overrides) EnforceMetricName(userID string) bool {
 	return o.GetOverridesForUser(userID).EnforceMetricName
 }
 
+// RequiredLabels returns the label names every series of the user must have.
+func (o *Overrides) RequiredLabels(userID string) []string {
+	return o.GetOverridesForUser(userID).RequiredLabels
+}
+
+// DisabledValidationChecks returns the write path validation checks skipped for the user.
+func (o *Overrides) DisabledValidationChecks(userID string) []string {
+	return o.GetOverridesForUser(userID).DisabledValidationChecks
+}
+
+// MaxConcurrentPushRequests returns the maximum number of push requests of the user each distributor handles concurrently.
+func (o *Overrides) MaxConcurrentPushRequests(userID string) int {
+	return o.GetOverridesForUser(userID).MaxConcurrentPushRequests
+}
+
+// ConcurrentPushRequestsWaitTimeout returns how long a push request exceeding the concurrent push requests limit waits before being rejected.
+func (o *Overrides) ConcurrentPushRequestsWaitTimeout(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).ConcurrentPushRequestsWaitTimeout)
+}
+
+// MaxConcurrentIngesterQueries returns the maximum number of query requests of the user each ingester handles concurrently.
+func (o *Overrides) MaxConcurrentIngesterQueries(userID string) int {
+	return o.GetOverridesForUser(userID).MaxConcurrentIngesterQueries
+}
+
+// ConcurrentIngesterQueriesWaitTimeout returns how long a query request exceeding the concurrent ingester queries limit waits before being rejected.
+func (o *Overrides) ConcurrentIngesterQueriesWaitTimeout(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).ConcurrentIngesterQueriesWaitTimeout)
+}
+
 // EnforceMetadataMetricName whether to enforce the presence of a metric name on metadata.
 func (o *Overrides) EnforceMetadataMetricName(userID string) bool {
 	return o.GetOverridesForUser(userID).EnforceMetadataMetricName
@@ -653,11 +1015,21 @@ func (o *Overrides) MaxGlobalMetadataPerMetric(userID string) int {
 	return o.GetOverridesForUser(userID).MaxGlobalMetadataPerMetric
 }
 
+// RejectMetricTypeConflicts returns whether the ingester rejects the metadata of the user with a type conflicting with the metadata already held.
+func (o *Overrides) RejectMetricTypeConflicts(userID string) bool {
+	return o.GetOverridesForUser(userID).RejectMetricTypeConflicts
+}
+
 // IngestionTenantShardSize returns the ingesters shard size for a given user.
 func (o *Overrides) IngestionTenantShardSize(userID string) int {
 	return o.GetOverridesForUser(userID).IngestionTenantShardSize
 }
 
+// WriteQuorum returns the quorum of the ingesters the series of a given user must be written to.
+func (o *Overrides) WriteQuorum(userID string) string {
+	return o.GetOverridesForUser(userID).WriteQuorum
+}
+
 // EvaluationDelay returns the rules evaluation delay for a given user.
 func (o *Overrides) EvaluationDelay(userID string) time.Duration {
 	return time.Duration(o.GetOverridesForUser(userID).RulerEvaluationDelay)
@@ -673,6 +1045,22 @@ func (o *Overrides) CompactorTenantShardSize(userID string) int {
 	return o.GetOverridesForUser(userID).CompactorTenantShardSize
 }
 
+// CompactorCompactionOrder returns the order in which the compactor compacts blocks with the same time range size.
+func (o *Overrides) CompactorCompactionOrder(userID string) string {
+	return o.GetOverridesForUser(userID).CompactorCompactionOrder
+}
+
+// QueryResultRelabelConfigs returns the relabel configs applied to the series returned by the
+// queries of the given user.
+func (o *Overrides) QueryResultRelabelConfigs(userID string) []*relabel.Config {
+	return o.GetOverridesForUser(userID).QueryResultRelabelConfigs
+}
+
+// TenantFederationSelectors returns the tenant selectors a federated query for the given user is resolved to.
+func (o *Overrides) TenantFederationSelectors(userID string) []string {
+	return o.GetOverridesForUser(userID).TenantFederationSelectors
+}
+
 // MetricRelabelConfigs returns the metric relabel configs for a given user.
 func (o *Overrides) MetricRelabelConfigs(userID string) []*relabel.Config {
 	return o.GetOverridesForUser(userID).MetricRelabelConfigs
@@ -693,11 +1081,51 @@ func (o *Overrides) RulerMaxRuleGroupsPerTenant(userID string) int {
 	return o.GetOverridesForUser(userID).RulerMaxRuleGroupsPerTenant
 }
 
+// RulerFeatureFlags returns the feature flags enabled for a given user, used to select the rule groups to evaluate.
+func (o *Overrides) RulerFeatureFlags(userID string) []string {
+	return o.GetOverridesForUser(userID).RulerFeatureFlags
+}
+
+// RulerSkipUnchangedResultsMaxInterval returns the maximum interval the writes of unchanged rule evaluation results can be skipped for a given user.
+func (o *Overrides) RulerSkipUnchangedResultsMaxInterval(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).RulerSkipUnchangedResultsMaxInterval)
+}
+
+// RulerReloadQuietPeriod returns the period the rule groups of a given user must not change for before being reloaded.
+func (o *Overrides) RulerReloadQuietPeriod(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).RulerReloadQuietPeriod)
+}
+
+// RulerNotificationDeduplication returns whether the alert notifications of a given user are deduplicated across the ruler replicas.
+func (o *Overrides) RulerNotificationDeduplication(userID string) bool {
+	return o.GetOverridesForUser(userID).RulerNotificationDeduplication
+}
+
+// RulerMaxConcurrentGroupEvaluations returns the maximum number of rule groups of a given user evaluated concurrently.
+func (o *Overrides) RulerMaxConcurrentGroupEvaluations(userID string) int {
+	return o.GetOverridesForUser(userID).RulerMaxConcurrentGroupEvaluations
+}
+
+// PushAcceptanceWindows returns the daily time windows within which the pushes of a given user are accepted.
+func (o *Overrides) PushAcceptanceWindows(userID string) []PushAcceptanceWindow {
+	return o.GetOverridesForUser(userID).PushAcceptanceWindows
+}
+
+// StoreGatewayIndexCacheTier returns the store-gateway index cache tier for a given user.
+func (o *Overrides) StoreGatewayIndexCacheTier(userID string) string {
+	return o.GetOverridesForUser(userID).StoreGatewayIndexCacheTier
+}
+
 // StoreGatewayTenantShardSize returns the store-gateway shard size for a given user.
 func (o *Overrides) StoreGatewayTenantShardSize(userID string) float64 {
 	return o.GetOverridesForUser(userID).StoreGatewayTenantShardSize
 }
 
+// HAFailoverTimeout returns the failover timeout of the HA tracker for a user, or 0 to use the configured one.
+func (o *Overrides) HAFailoverTimeout(user string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(user).HAFailoverTimeout)
+}
+
 // MaxHAReplicaGroups returns maximum number of clusters that HA tracker will track for a user.
 func (o *Overrides) MaxHAReplicaGroups(user string) int {
 	return o.GetOverridesForUser(user).HAMaxClusters
@@ -735,6 +1163,26 @@ func (o *Overrides) MaxExemplars(userID string) int {
 	return o.GetOverridesForUser(userID).MaxExemplars
 }
 
+// MaxExemplarsIngestionRate returns the limit on the exemplars ingestion rate per user, per ingester.
+func (o *Overrides) MaxExemplarsIngestionRate(userID string) float64 {
+	return o.GetOverridesForUser(userID).MaxExemplarsIngestionRate
+}
+
+// MaxExemplarsIngestionBurstSize returns the burst size of the exemplars ingestion rate limit.
+func (o *Overrides) MaxExemplarsIngestionBurstSize(userID string) int {
+	return o.GetOverridesForUser(userID).MaxExemplarsIngestionBurstSize
+}
+
+// DistributorExemplarsIngestionRate returns the limit on the exemplars ingestion rate per user in the distributors.
+func (o *Overrides) DistributorExemplarsIngestionRate(userID string) float64 {
+	return o.GetOverridesForUser(userID).DistributorExemplarsIngestionRate
+}
+
+// DistributorExemplarsIngestionBurstSize returns the burst size of the exemplars ingestion rate limit of the distributors.
+func (o *Overrides) DistributorExemplarsIngestionBurstSize(userID string) int {
+	return o.GetOverridesForUser(userID).DistributorExemplarsIngestionBurstSize
+}
+
 // Notification limits are special. Limits are returned in following order:
 // 1. per-tenant limits for given integration
 // 2. default limits for given integration
@@ -807,6 +1255,30 @@ func (o *Overrides) AlertmanagerMaxAlertsSizeBytes(userID string) int {
 	return o.GetOverridesForUser(userID).AlertmanagerMaxAlertsSizeBytes
 }
 
+func (o *Overrides) AlertmanagerMaxConcurrentNotifications(userID string) int {
+	return o.GetOverridesForUser(userID).AlertmanagerMaxConcurrentNotifications
+}
+
+func (o *Overrides) AlertmanagerTemplateExecutionTimeout(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).AlertmanagerTemplateExecutionTimeout)
+}
+
+func (o *Overrides) AlertmanagerTemplateMaxOutputSizeBytes(userID string) int {
+	return o.GetOverridesForUser(userID).AlertmanagerTemplateMaxOutputSizeBytes
+}
+
+func (o *Overrides) AlertmanagerMaxLabelSetsPerAlertName(userID string) int {
+	return o.GetOverridesForUser(userID).AlertmanagerMaxLabelSetsPerAlertName
+}
+
+func (o *Overrides) AlertmanagerLabelSetsWindow(userID string) time.Duration {
+	return time.Duration(o.GetOverridesForUser(userID).AlertmanagerLabelSetsWindow)
+}
+
+func (o *Overrides) AlertmanagerMaxActiveAlerts(userID string) int {
+	return o.GetOverridesForUser(userID).AlertmanagerMaxActiveAlerts
+}
+
 func (o *Overrides) DisabledRuleGroups(userID string) DisabledRuleGroups {
 	if o.tenantLimits != nil {
 		l := o.tenantLimits.ByUserID(userID)
@@ -854,6 +1326,24 @@ func SmallestPositiveIntPerTenant(tenantIDs []string, f func(string) int) int {
 	return *result
 }
 
+// SmallestPositiveNonZeroIntPerTenant is returning the minimal positive and
+// non-zero value of the supplied limit function for all given tenants. In many
+// limits a value of 0 means unlimited so the method will return 0 only if all
+// inputs have a limit of 0 or an empty tenant list is given.
+func SmallestPositiveNonZeroIntPerTenant(tenantIDs []string, f func(string) int) int {
+	var result *int
+	for _, tenantID := range tenantIDs {
+		v := f(tenantID)
+		if v > 0 && (result == nil || v < *result) {
+			result = &v
+		}
+	}
+	if result == nil {
+		return 0
+	}
+	return *result
+}
+
 // SmallestPositiveNonZeroFloat64PerTenant is returning the minimal positive and
 // non-zero value of the supplied limit function for all given tenants. In many
 // limits a value of 0 means unlimited so the method will return 0 only if all
@@ -62,6 +62,66 @@ func TestLimits_Validate(t *testing.T) {
 			shardByAllLabels: true,
 			expected:         nil,
 		},
+		"compactor-compaction-order newest-first": {
+			limits:           Limits{CompactorCompactionOrder: CompactionOrderNewestFirst},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"compactor-compaction-order unsupported": {
+			limits:           Limits{CompactorCompactionOrder: "random"},
+			shardByAllLabels: true,
+			expected:         errInvalidCompactionOrder,
+		},
+		"min-query-step-policy clamp": {
+			limits:           Limits{MinQueryStepPolicy: MinQueryStepPolicyClamp},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"min-query-step-policy unsupported": {
+			limits:           Limits{MinQueryStepPolicy: "random"},
+			shardByAllLabels: true,
+			expected:         errInvalidMinQueryStepPolicy,
+		},
+		"ingest-aggregation-function avg": {
+			limits:           Limits{IngestAggregationFunction: IngestAggregationAvg},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"ingest-aggregation-function unsupported": {
+			limits:           Limits{IngestAggregationFunction: "sum"},
+			shardByAllLabels: true,
+			expected:         errInvalidIngestAggregationFunction,
+		},
+		"write-quorum each-zone": {
+			limits:           Limits{WriteQuorum: WriteQuorumEachZone},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"write-quorum unsupported": {
+			limits:           Limits{WriteQuorum: "all"},
+			shardByAllLabels: true,
+			expected:         errInvalidWriteQuorum,
+		},
+		"disabled validation checks supported": {
+			limits:           Limits{DisabledValidationChecks: []string{ValidationCheckLabelNameFormat, ValidationCheckSampleTimestamp}},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"disabled validation check unsupported": {
+			limits:           Limits{DisabledValidationChecks: []string{ValidationCheckMetricNameFormat, "labels_order"}},
+			shardByAllLabels: true,
+			expected:         errInvalidDisabledValidationCheck,
+		},
+		"max-exemplar-label-set-length within the ingesters limit": {
+			limits:           Limits{MaxExemplarLabelSetLength: ExemplarMaxLabelSetLength},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"max-exemplar-label-set-length greater than the ingesters limit": {
+			limits:           Limits{MaxExemplarLabelSetLength: ExemplarMaxLabelSetLength + 1},
+			shardByAllLabels: true,
+			expected:         errInvalidMaxExemplarLabelSetLength,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -231,6 +291,25 @@ metric_relabel_configs:
 	assert.Equal(t, []*relabel.Config{&exp}, l.MetricRelabelConfigs)
 }
 
+func TestHALabelPairsLoadingFromYaml(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	l := Limits{}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+ha_label_pairs:
+- cluster_label: ruler_cluster
+  replica_label: ruler_replica
+`), &l))
+	assert.Equal(t, []HALabelPair{{ClusterLabel: "ruler_cluster", ReplicaLabel: "ruler_replica"}}, l.HALabelPairs)
+
+	l = Limits{}
+	err := yaml.UnmarshalStrict([]byte(`
+ha_label_pairs:
+- cluster_label: ruler_cluster
+`), &l)
+	assert.EqualError(t, err, "invalid HA label pair: the cluster and replica labels must be set")
+}
+
 func TestSmallestPositiveIntPerTenant(t *testing.T) {
 	tenantLimits := map[string]*Limits{
 		"tenant-a": {
@@ -263,6 +342,38 @@ func TestSmallestPositiveIntPerTenant(t *testing.T) {
 	}
 }
 
+func TestSmallestPositiveNonZeroIntPerTenant(t *testing.T) {
+	tenantLimits := map[string]*Limits{
+		"tenant-a": {
+			MaxSamplesPerQueryResponse: 5,
+		},
+		"tenant-b": {
+			MaxSamplesPerQueryResponse: 10,
+		},
+	}
+
+	defaults := Limits{
+		MaxSamplesPerQueryResponse: 0,
+	}
+	ov, err := NewOverrides(defaults, newMockTenantLimits(tenantLimits))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		tenantIDs []string
+		expLimit  int
+	}{
+		{tenantIDs: []string{}, expLimit: 0},
+		{tenantIDs: []string{"tenant-a"}, expLimit: 5},
+		{tenantIDs: []string{"tenant-b"}, expLimit: 10},
+		{tenantIDs: []string{"tenant-c"}, expLimit: 0},
+		{tenantIDs: []string{"tenant-a", "tenant-b"}, expLimit: 5},
+		{tenantIDs: []string{"tenant-c", "tenant-d", "tenant-e"}, expLimit: 0},
+		{tenantIDs: []string{"tenant-a", "tenant-b", "tenant-c"}, expLimit: 5},
+	} {
+		assert.Equal(t, tc.expLimit, SmallestPositiveNonZeroIntPerTenant(tc.tenantIDs, ov.MaxSamplesPerQueryResponse))
+	}
+}
+
 func TestSmallestPositiveNonZeroFloat64PerTenant(t *testing.T) {
 	tenantLimits := map[string]*Limits{
 		"tenant-a": {
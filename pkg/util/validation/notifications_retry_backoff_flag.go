@@ -0,0 +1,97 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+var (
+	errInvalidRetryBackoffBase       = errors.New("the retry backoff base must be greater than 0")
+	errInvalidRetryBackoffMax        = errors.New("the retry backoff max must be greater than or equal to the base")
+	errInvalidRetryBackoffMultiplier = errors.New("the retry backoff multiplier must be greater than or equal to 1")
+)
+
+// NotificationRetryBackoff is the exponential backoff applied between the retries of a failed notification.
+type NotificationRetryBackoff struct {
+	Base       model.Duration `yaml:"base" json:"base"`
+	Max        model.Duration `yaml:"max" json:"max"`
+	Multiplier float64        `yaml:"multiplier" json:"multiplier"`
+}
+
+// Validate validates the backoff parameters.
+func (b NotificationRetryBackoff) Validate() error {
+	if b.Base <= 0 {
+		return errInvalidRetryBackoffBase
+	}
+	if b.Max < b.Base {
+		return errInvalidRetryBackoffMax
+	}
+	if b.Multiplier < 1 {
+		return errInvalidRetryBackoffMultiplier
+	}
+	return nil
+}
+
+// Delay returns the delay to wait before the given retry, starting from 0.
+func (b NotificationRetryBackoff) Delay(retry int) time.Duration {
+	delay := float64(b.Base)
+	for i := 0; i < retry && delay < float64(b.Max); i++ {
+		delay *= b.Multiplier
+	}
+	if delay > float64(b.Max) {
+		return time.Duration(b.Max)
+	}
+	return time.Duration(delay)
+}
+
+// NotificationRetryBackoffMap is the per-integration notification retry backoff.
+type NotificationRetryBackoffMap map[string]NotificationRetryBackoff
+
+// String implements flag.Value
+func (m NotificationRetryBackoffMap) String() string {
+	out, err := json.Marshal(map[string]NotificationRetryBackoff(m))
+	if err != nil {
+		return fmt.Sprintf("failed to marshal: %v", err)
+	}
+	return string(out)
+}
+
+// Set implements flag.Value
+func (m NotificationRetryBackoffMap) Set(s string) error {
+	newMap := map[string]NotificationRetryBackoff{}
+	return m.updateMap(json.Unmarshal([]byte(s), &newMap), newMap)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m NotificationRetryBackoffMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	newMap := map[string]NotificationRetryBackoff{}
+	return m.updateMap(unmarshal(newMap), newMap)
+}
+
+func (m NotificationRetryBackoffMap) updateMap(unmarshalErr error, newMap map[string]NotificationRetryBackoff) error {
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	for k, v := range newMap {
+		if !util.StringsContain(allowedIntegrationNames, k) {
+			return errors.Errorf("unknown integration name: %s", k)
+		}
+		if err := v.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid retry backoff for integration %s", k)
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m NotificationRetryBackoffMap) MarshalYAML() (interface{}, error) {
+	return map[string]NotificationRetryBackoff(m), nil
+}
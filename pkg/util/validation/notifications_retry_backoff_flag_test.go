@@ -0,0 +1,107 @@
+package validation
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNotificationRetryBackoffMap(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		expected NotificationRetryBackoffMap
+		error    string
+	}{
+		"basic test": {
+			args: []string{"-map-flag", `{"email": {"base": "1m", "max": "10m", "multiplier": 2}, "webhook": {"base": "1s", "max": "1s", "multiplier": 1}}`},
+			expected: NotificationRetryBackoffMap{
+				"email":   {Base: model.Duration(time.Minute), Max: model.Duration(10 * time.Minute), Multiplier: 2},
+				"webhook": {Base: model.Duration(time.Second), Max: model.Duration(time.Second), Multiplier: 1},
+			},
+		},
+		"unknown integration": {
+			args:  []string{"-map-flag", `{"unknown": {"base": "1s", "max": "1s", "multiplier": 1}}`},
+			error: `invalid value "{\"unknown\": {\"base\": \"1s\", \"max\": \"1s\", \"multiplier\": 1}}" for flag -map-flag: unknown integration name: unknown`,
+		},
+		"missing base": {
+			args:  []string{"-map-flag", `{"email": {"max": "1s", "multiplier": 1}}`},
+			error: `invalid value "{\"email\": {\"max\": \"1s\", \"multiplier\": 1}}" for flag -map-flag: invalid retry backoff for integration email: the retry backoff base must be greater than 0`,
+		},
+		"max lower than base": {
+			args:  []string{"-map-flag", `{"email": {"base": "1m", "max": "1s", "multiplier": 1}}`},
+			error: `invalid value "{\"email\": {\"base\": \"1m\", \"max\": \"1s\", \"multiplier\": 1}}" for flag -map-flag: invalid retry backoff for integration email: the retry backoff max must be greater than or equal to the base`,
+		},
+		"multiplier lower than 1": {
+			args:  []string{"-map-flag", `{"email": {"base": "1s", "max": "1m", "multiplier": 0.5}}`},
+			error: `invalid value "{\"email\": {\"base\": \"1s\", \"max\": \"1m\", \"multiplier\": 0.5}}" for flag -map-flag: invalid retry backoff for integration email: the retry backoff multiplier must be greater than or equal to 1`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := NotificationRetryBackoffMap{}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(&bytes.Buffer{}) // otherwise errors would go to stderr.
+			fs.Var(v, "map-flag", "Map flag, you can pass JSON into this")
+			err := fs.Parse(tc.args)
+
+			if tc.error != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, tc.error, err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, v)
+			}
+		})
+	}
+}
+
+func TestNotificationRetryBackoffMapYaml(t *testing.T) {
+	type testStruct struct {
+		Flag NotificationRetryBackoffMap `yaml:"flag"`
+	}
+
+	var expectedStruct testStruct
+	expectedStruct.Flag = NotificationRetryBackoffMap{}
+	require.NoError(t, expectedStruct.Flag.Set(`{"email": {"base": "1m", "max": "10m", "multiplier": 2}}`))
+
+	expected := []byte(`flag:
+  email:
+    base: 1m
+    max: 10m
+    multiplier: 2
+`)
+
+	actual, err := yaml.Marshal(expectedStruct)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	var actualStruct testStruct
+	actualStruct.Flag = NotificationRetryBackoffMap{} // must be set, otherwise unmarshalling panics.
+
+	require.NoError(t, yaml.Unmarshal(expected, &actualStruct))
+	assert.Equal(t, expectedStruct, actualStruct)
+
+	// Invalid backoffs are rejected when unmarshalling too.
+	actualStruct.Flag = NotificationRetryBackoffMap{}
+	assert.Error(t, yaml.Unmarshal([]byte("flag:\n  email:\n    base: 1m\n    max: 1s\n    multiplier: 2\n"), &actualStruct))
+}
+
+func TestNotificationRetryBackoff_Delay(t *testing.T) {
+	backoff := NotificationRetryBackoff{Base: model.Duration(time.Second), Max: model.Duration(10 * time.Second), Multiplier: 3}
+
+	var delays []time.Duration
+	for retry := 0; retry < 5; retry++ {
+		delays = append(delays, backoff.Delay(retry))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 3 * time.Second, 9 * time.Second, 10 * time.Second, 10 * time.Second}, delays)
+
+	// A multiplier of 1 retries at a constant interval.
+	backoff = NotificationRetryBackoff{Base: model.Duration(time.Second), Max: model.Duration(time.Minute), Multiplier: 1}
+	assert.Equal(t, time.Second, backoff.Delay(100))
+}
@@ -0,0 +1,89 @@
+package validation
+
+import (
+	"fmt"
+	"time"
+)
+
+// PushAcceptanceWindow is a daily time window within which the pushes of a tenant are accepted.
+type PushAcceptanceWindow struct {
+	Start    string `yaml:"start" json:"start" doc:"nocli|description=Start time of the window, in the HH:MM format."`
+	End      string `yaml:"end" json:"end" doc:"nocli|description=End time of the window, in the HH:MM format, excluded. If earlier than the start time, the window spans midnight."`
+	Timezone string `yaml:"timezone" json:"timezone" doc:"nocli|description=Timezone of the start and end times, as a name of the IANA Time Zone database, like Europe/Rome. If empty, UTC is used."`
+
+	// Start and end times, as offsets from midnight, and timezone, parsed when the limits are loaded.
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// compile parses the start and end times and the timezone of the window.
+func (w *PushAcceptanceWindow) compile() error {
+	var err error
+	if w.start, err = parseTimeOfDay(w.Start); err != nil {
+		return fmt.Errorf("invalid push acceptance window start time %q: %w", w.Start, err)
+	}
+	if w.end, err = parseTimeOfDay(w.End); err != nil {
+		return fmt.Errorf("invalid push acceptance window end time %q: %w", w.End, err)
+	}
+	if w.start == w.end {
+		return fmt.Errorf("invalid push acceptance window %s-%s: the start and end times must differ", w.Start, w.End)
+	}
+	if w.location, err = time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("invalid push acceptance window timezone %q: %w", w.Timezone, err)
+	}
+	return nil
+}
+
+// Contains returns whether the time is within the window, in the timezone of the window.
+func (w *PushAcceptanceWindow) Contains(t time.Time) bool {
+	if w.location != nil {
+		t = t.In(w.location)
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// PushAccepted returns whether the pushes are accepted at the given time, that is if there are
+// no push acceptance windows or the time is within any of them.
+func PushAccepted(windows []PushAcceptanceWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for i := range windows {
+		if windows[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePushAcceptanceWindows parses the push acceptance windows. They're copied first, since the
+// limits may share them with the default limits, read concurrently.
+func (l *Limits) compilePushAcceptanceWindows() error {
+	if len(l.PushAcceptanceWindows) == 0 {
+		return nil
+	}
+
+	windows := make([]PushAcceptanceWindow, len(l.PushAcceptanceWindows))
+	copy(windows, l.PushAcceptanceWindows)
+	for i := range windows {
+		if err := windows[i].compile(); err != nil {
+			return err
+		}
+	}
+	l.PushAcceptanceWindows = windows
+	return nil
+}
@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPushAccepted(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		windows  []PushAcceptanceWindow
+		time     time.Time
+		expected bool
+	}{
+		"no windows": {
+			time:     time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC),
+			expected: true,
+		},
+		"within the window": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "18:00"}},
+			time:     time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC),
+			expected: true,
+		},
+		"at the end of the window": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "18:00"}},
+			time:     time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC),
+			expected: false,
+		},
+		"outside of the window": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "18:00"}},
+			time:     time.Date(2024, 1, 1, 7, 59, 59, 0, time.UTC),
+			expected: false,
+		},
+		"within the second window": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "12:00"}, {Start: "14:00", End: "18:00"}},
+			time:     time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC),
+			expected: true,
+		},
+		"between the windows": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "12:00"}, {Start: "14:00", End: "18:00"}},
+			time:     time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+			expected: false,
+		},
+		"within the window spanning midnight, before midnight": {
+			windows:  []PushAcceptanceWindow{{Start: "22:00", End: "02:00"}},
+			time:     time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC),
+			expected: true,
+		},
+		"within the window spanning midnight, after midnight": {
+			windows:  []PushAcceptanceWindow{{Start: "22:00", End: "02:00"}},
+			time:     time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC),
+			expected: true,
+		},
+		"outside of the window spanning midnight": {
+			windows:  []PushAcceptanceWindow{{Start: "22:00", End: "02:00"}},
+			time:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			expected: false,
+		},
+		"within the window of another timezone": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "09:00", Timezone: "Europe/Rome"}},
+			time:     time.Date(2024, 1, 1, 7, 30, 0, 0, time.UTC),
+			expected: true,
+		},
+		"outside of the window of another timezone": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "09:00", Timezone: "Europe/Rome"}},
+			time:     time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC),
+			expected: false,
+		},
+		"within the window, with the time in another timezone": {
+			windows:  []PushAcceptanceWindow{{Start: "08:00", End: "09:00"}},
+			time:     time.Date(2024, 1, 1, 9, 30, 0, 0, rome),
+			expected: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := range tc.windows {
+				require.NoError(t, tc.windows[i].compile())
+			}
+			assert.Equal(t, tc.expected, PushAccepted(tc.windows, tc.time))
+		})
+	}
+}
+
+func TestPushAcceptanceWindowsLoading(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	t.Run("should load the windows from yaml", func(t *testing.T) {
+		l := Limits{}
+		require.NoError(t, yaml.UnmarshalStrict([]byte(`push_acceptance_windows: [{start: "22:00", end: "02:00", timezone: "Europe/Rome"}]`), &l))
+		require.Len(t, l.PushAcceptanceWindows, 1)
+		assert.True(t, l.PushAcceptanceWindows[0].Contains(time.Date(2024, 1, 1, 22, 30, 0, 0, time.UTC)))
+		assert.False(t, l.PushAcceptanceWindows[0].Contains(time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)))
+	})
+
+	t.Run("should load the windows from json", func(t *testing.T) {
+		l := Limits{}
+		require.NoError(t, json.Unmarshal([]byte(`{"push_acceptance_windows": [{"start": "08:00", "end": "18:00"}]}`), &l))
+		require.Len(t, l.PushAcceptanceWindows, 1)
+		assert.True(t, l.PushAcceptanceWindows[0].Contains(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)))
+		assert.False(t, l.PushAcceptanceWindows[0].Contains(time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)))
+	})
+
+	for name, tc := range map[string]struct {
+		input       string
+		expectedErr string
+	}{
+		"invalid start time": {
+			input:       `push_acceptance_windows: [{start: "8am", end: "18:00"}]`,
+			expectedErr: `invalid push acceptance window start time "8am"`,
+		},
+		"invalid end time": {
+			input:       `push_acceptance_windows: [{start: "08:00", end: "24:00"}]`,
+			expectedErr: `invalid push acceptance window end time "24:00"`,
+		},
+		"empty window": {
+			input:       `push_acceptance_windows: [{start: "08:00", end: "08:00"}]`,
+			expectedErr: "invalid push acceptance window 08:00-08:00: the start and end times must differ",
+		},
+		"invalid timezone": {
+			input:       `push_acceptance_windows: [{start: "08:00", end: "18:00", timezone: "Mars/Olympus"}]`,
+			expectedErr: `invalid push acceptance window timezone "Mars/Olympus"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := Limits{}
+			err := yaml.UnmarshalStrict([]byte(tc.input), &l)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErr)
+		})
+	}
+}
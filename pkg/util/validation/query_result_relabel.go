@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// QueryResultRelabelActions are the relabel actions supported by the query result relabel configs.
+// The actions dropping whole series are not supported, since the relabeling only changes how the
+// series are presented.
+var QueryResultRelabelActions = []relabel.Action{relabel.Replace, relabel.LabelMap, relabel.LabelDrop, relabel.LabelKeep, relabel.Lowercase, relabel.Uppercase}
+
+// validateQueryResultRelabelConfigs ensures the query result relabel configs only rename or drop
+// labels.
+func (l *Limits) validateQueryResultRelabelConfigs() error {
+	for i, cfg := range l.QueryResultRelabelConfigs {
+		if cfg == nil {
+			return fmt.Errorf("invalid query result relabel config at position %d: empty config", i)
+		}
+		if !isQueryResultRelabelAction(cfg.Action) {
+			return fmt.Errorf("invalid query result relabel config at position %d: unsupported action %q, supported actions are: %v", i, cfg.Action, QueryResultRelabelActions)
+		}
+	}
+	return nil
+}
+
+func isQueryResultRelabelAction(action relabel.Action) bool {
+	for _, a := range QueryResultRelabelActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
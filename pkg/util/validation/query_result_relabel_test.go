@@ -0,0 +1,64 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestQueryResultRelabelConfigsLoading(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	for name, tc := range map[string]struct {
+		input       string
+		expectedErr string
+	}{
+		"rename a label": {
+			input: `
+query_result_relabel_configs:
+  - source_labels: [instance]
+    target_label: host
+  - action: labeldrop
+    regex: instance
+`,
+		},
+		"unsupported action": {
+			input: `
+query_result_relabel_configs:
+  - source_labels: [instance]
+    regex: localhost.*
+    action: drop
+`,
+			expectedErr: `invalid query result relabel config at position 0: unsupported action "drop"`,
+		},
+		"empty config": {
+			input: `
+query_result_relabel_configs:
+  -
+`,
+			expectedErr: "invalid query result relabel config at position 0: empty config",
+		},
+		"invalid relabel config": {
+			input: `
+query_result_relabel_configs:
+  - action: labelmap
+    regex: "("
+`,
+			expectedErr: "error parsing regexp",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := Limits{}
+			err := yaml.UnmarshalStrict([]byte(tc.input), &l)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, l.QueryResultRelabelConfigs, 2)
+		})
+	}
+}
@@ -35,6 +35,15 @@ const (
 	// ErrQueryTooLong is used in chunk store, querier and query frontend.
 	ErrQueryTooLong = "the query time range exceeds the limit (query length: %s, limit: %s)"
 
+	// ErrQueryStepTooSmall is used in query frontend.
+	ErrQueryStepTooSmall = "the query step (%s) is smaller than the minimum query step (%s), consider increasing the query step"
+
+	// ErrTooManySplitQueries is used in query frontend.
+	ErrTooManySplitQueries = "the query would be split into %d queries, exceeding the limit of %d split queries, consider increasing the query step, reducing the query time range or increasing the split interval"
+
+	// ErrTooManySamplesInResponse is used in query frontend.
+	ErrTooManySamplesInResponse = "the query response contains too many samples (samples: %d, limit: %d), consider increasing the query step (current step: %s) or reducing the query time range"
+
 	missingMetricName       = "missing_metric_name"
 	invalidMetricName       = "metric_name_invalid"
 	greaterThanMaxSampleAge = "greater_than_max_sample_age"
@@ -46,16 +55,28 @@ const (
 	labelsNotSorted         = "labels_not_sorted"
 	labelValueTooLong       = "label_value_too_long"
 	labelsSizeBytesExceeded = "labels_size_bytes_exceeded"
+	missingRequiredLabel    = "missing_required_label"
+
+	// Native histogram specific validation reasons
+	nativeHistogramInvalidSchema   = "native_histogram_invalid_schema"
+	nativeHistogramBucketsExceeded = "native_histogram_buckets_exceeded"
 
 	// Exemplar-specific validation reasons
-	exemplarLabelsMissing    = "exemplar_labels_missing"
-	exemplarLabelsTooLong    = "exemplar_labels_too_long"
-	exemplarTimestampInvalid = "exemplar_timestamp_invalid"
+	exemplarLabelsMissing     = "exemplar_labels_missing"
+	exemplarLabelsTooLong     = "exemplar_labels_too_long"
+	exemplarTimestampInvalid  = "exemplar_timestamp_invalid"
+	exemplarTooManyLabelNames = "exemplar_too_many_label_names"
 
 	// RateLimited is one of the values for the reason to discard samples.
 	// Declared here to avoid duplication in ingester and distributor.
 	RateLimited = "rate_limited"
 
+	// BytesRateLimited is the reason to discard the requests exceeding the per-tenant ingestion rate limit in bytes.
+	BytesRateLimited = "bytes_rate_limited"
+
+	// ExemplarsRateLimited Exemplars discarded because of the per-tenant exemplars ingestion rate limit of the distributors
+	ExemplarsRateLimited = "exemplars_rate_limited"
+
 	// Too many HA clusters is one of the reasons for discarding samples.
 	TooManyHAClusters = "too_many_ha_clusters"
 
@@ -63,10 +84,20 @@ const (
 	DroppedByRelabelConfiguration = "relabel_configuration"
 	// DroppedByUserConfigurationOverride Samples discarded due to user configuration removing label __name__
 	DroppedByUserConfigurationOverride = "user_label_removal_configuration"
+	// SampledOut Samples discarded because their series has been dropped by the per-tenant series sampling
+	SampledOut = "sampled_out"
+	// StaleMarkerStripped Samples discarded because they're staleness markers and the per-tenant stripping is enabled
+	StaleMarkerStripped = "stale_marker_stripped"
+	// OutsidePushAcceptanceWindows Samples discarded because they've been pushed outside of the per-tenant push acceptance windows
+	OutsidePushAcceptanceWindows = "outside_push_acceptance_windows"
 
 	// The combined length of the label names and values of an Exemplar's LabelSet MUST NOT exceed 128 UTF-8 characters
 	// https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
 	ExemplarMaxLabelSetLength = 128
+
+	// The schemas currently supported by the native histograms.
+	nativeHistogramMinSchema = -4
+	nativeHistogramMaxSchema = 8
 )
 
 type ValidateMetrics struct {
@@ -119,6 +150,10 @@ func NewValidateMetrics(r prometheus.Registerer) *ValidateMetrics {
 // ValidateSample returns an err if the sample is invalid.
 // The returned error may retain the provided series labels.
 func ValidateSample(validateMetrics *ValidateMetrics, limits *Limits, userID string, ls []cortexpb.LabelAdapter, s cortexpb.Sample) ValidationError {
+	if limits.ValidationCheckDisabled(ValidationCheckSampleTimestamp) {
+		return nil
+	}
+
 	unsafeMetricName, _ := extract.UnsafeMetricNameFromLabelAdapters(ls)
 
 	if limits.RejectOldSamples && model.Time(s.TimestampMs) < model.Now().Add(-time.Duration(limits.RejectOldSamplesMaxAge)) {
@@ -134,9 +169,42 @@ func ValidateSample(validateMetrics *ValidateMetrics, limits *Limits, userID str
 	return nil
 }
 
+// ValidateNativeHistogram returns an err if the native histogram sample is invalid. Its timestamp
+// is validated like the timestamp of the float samples.
+// The returned error may retain the provided series labels.
+func ValidateNativeHistogram(validateMetrics *ValidateMetrics, limits *Limits, userID string, ls []cortexpb.LabelAdapter, h cortexpb.Histogram) ValidationError {
+	if err := ValidateSample(validateMetrics, limits, userID, ls, cortexpb.Sample{TimestampMs: h.TimestampMs}); err != nil {
+		return err
+	}
+
+	unsafeMetricName, _ := extract.UnsafeMetricNameFromLabelAdapters(ls)
+
+	if h.Schema < nativeHistogramMinSchema || h.Schema > nativeHistogramMaxSchema {
+		validateMetrics.DiscardedSamples.WithLabelValues(nativeHistogramInvalidSchema, userID).Inc()
+		return newNativeHistogramSchemaInvalidError(unsafeMetricName, h.TimestampMs, h.Schema)
+	}
+
+	if limits.MaxNativeHistogramBuckets <= 0 {
+		return nil
+	}
+
+	var buckets int
+	if h.IsFloatHistogram() {
+		buckets = len(h.GetPositiveCounts()) + len(h.GetNegativeCounts())
+	} else {
+		buckets = len(h.GetPositiveDeltas()) + len(h.GetNegativeDeltas())
+	}
+	if buckets > limits.MaxNativeHistogramBuckets {
+		validateMetrics.DiscardedSamples.WithLabelValues(nativeHistogramBucketsExceeded, userID).Inc()
+		return newNativeHistogramBucketsExceededError(unsafeMetricName, h.TimestampMs, buckets, limits.MaxNativeHistogramBuckets)
+	}
+
+	return nil
+}
+
 // ValidateExemplar returns an error if the exemplar is invalid.
 // The returned error may retain the provided series labels.
-func ValidateExemplar(validateMetrics *ValidateMetrics, userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exemplar) ValidationError {
+func ValidateExemplar(validateMetrics *ValidateMetrics, limits *Limits, userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exemplar) ValidationError {
 	if len(e.Labels) <= 0 {
 		validateMetrics.DiscardedExemplars.WithLabelValues(exemplarLabelsMissing, userID).Inc()
 		return newExemplarEmtpyLabelsError(ls, []cortexpb.LabelAdapter{}, e.TimestampMs)
@@ -151,6 +219,20 @@ func ValidateExemplar(validateMetrics *ValidateMetrics, userID string, ls []cort
 		)
 	}
 
+	if limits.MaxExemplarLabelNames > 0 && len(e.Labels) > limits.MaxExemplarLabelNames {
+		validateMetrics.DiscardedExemplars.WithLabelValues(exemplarTooManyLabelNames, userID).Inc()
+		return newExemplarTooManyLabelNamesError(
+			ls,
+			e.Labels,
+			e.TimestampMs,
+			limits.MaxExemplarLabelNames,
+		)
+	}
+
+	if limits.MaxExemplarLabelSetLength <= 0 {
+		return nil
+	}
+
 	// Exemplar label length does not include chars involved in text
 	// rendering such as quotes, commas, etc.  See spec and const definition.
 	labelSetLen := 0
@@ -159,12 +241,13 @@ func ValidateExemplar(validateMetrics *ValidateMetrics, userID string, ls []cort
 		labelSetLen += utf8.RuneCountInString(l.Value)
 	}
 
-	if labelSetLen > ExemplarMaxLabelSetLength {
+	if labelSetLen > limits.MaxExemplarLabelSetLength {
 		validateMetrics.DiscardedExemplars.WithLabelValues(exemplarLabelsTooLong, userID).Inc()
 		return newExemplarLabelLengthError(
 			ls,
 			e.Labels,
 			e.TimestampMs,
+			limits.MaxExemplarLabelSetLength,
 		)
 	}
 
@@ -181,7 +264,7 @@ func ValidateLabels(validateMetrics *ValidateMetrics, limits *Limits, userID str
 			return newNoMetricNameError()
 		}
 
-		if !model.IsValidMetricName(model.LabelValue(unsafeMetricName)) {
+		if !limits.ValidationCheckDisabled(ValidationCheckMetricNameFormat) && !model.IsValidMetricName(model.LabelValue(unsafeMetricName)) {
 			validateMetrics.DiscardedSamples.WithLabelValues(invalidMetricName, userID).Inc()
 			return newInvalidMetricNameError(unsafeMetricName)
 		}
@@ -199,6 +282,8 @@ func ValidateLabels(validateMetrics *ValidateMetrics, limits *Limits, userID str
 	maxLabelsSizeBytes := limits.MaxLabelsSizeBytes
 	labelsSizeBytes := 0
 
+	skipLabelNameValidation = skipLabelNameValidation || limits.ValidationCheckDisabled(ValidationCheckLabelNameFormat)
+
 	for _, l := range ls {
 		if !skipLabelNameValidation && !model.LabelName(l.Name).IsValid() {
 			validateMetrics.DiscardedSamples.WithLabelValues(invalidLabel, userID).Inc()
@@ -226,9 +311,25 @@ func ValidateLabels(validateMetrics *ValidateMetrics, limits *Limits, userID str
 		validateMetrics.DiscardedSamples.WithLabelValues(labelsSizeBytesExceeded, userID).Inc()
 		return labelSizeBytesExceededError(ls, labelsSizeBytes, maxLabelsSizeBytes)
 	}
+	for _, required := range limits.RequiredLabels {
+		if !hasLabel(ls, required) {
+			validateMetrics.DiscardedSamples.WithLabelValues(missingRequiredLabel, userID).Inc()
+			return newMissingRequiredLabelError(ls, required)
+		}
+	}
 	return nil
 }
 
+// hasLabel returns whether the series has a non-empty value for the label.
+func hasLabel(ls []cortexpb.LabelAdapter, name string) bool {
+	for _, l := range ls {
+		if l.Name == name {
+			return l.Value != ""
+		}
+	}
+	return false
+}
+
 // ValidateMetadata returns an err if a metric metadata is invalid.
 func ValidateMetadata(validateMetrics *ValidateMetrics, cfg *Limits, userID string, metadata *cortexpb.MetricMetadata) error {
 	if cfg.EnforceMetadataMetricName && metadata.GetMetricFamilyName() == "" {
@@ -1,9 +1,11 @@
 package validation
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -125,10 +127,156 @@ func TestValidateLabels(t *testing.T) {
 	`), "cortex_discarded_samples_total"))
 }
 
+func TestValidateLabels_RequiredLabels(t *testing.T) {
+	cfg := new(Limits)
+	cfg.MaxLabelValueLength = 25
+	cfg.MaxLabelNameLength = 25
+	cfg.MaxLabelNamesPerSeries = 5
+	cfg.EnforceMetricName = true
+	cfg.RequiredLabels = []string{"env", "team"}
+	userID := "testUser"
+
+	reg := prometheus.NewRegistry()
+	validateMetrics := NewValidateMetrics(reg)
+
+	for name, c := range map[string]struct {
+		metric model.Metric
+		err    error
+	}{
+		"all required labels": {
+			metric: model.Metric{model.MetricNameLabel: "foo", "env": "prod", "team": "a"},
+		},
+		"missing required label": {
+			metric: model.Metric{model.MetricNameLabel: "foo", "env": "prod"},
+			err: newMissingRequiredLabelError([]cortexpb.LabelAdapter{
+				{Name: model.MetricNameLabel, Value: "foo"},
+				{Name: "env", Value: "prod"},
+			}, "team"),
+		},
+		"empty required label": {
+			metric: model.Metric{model.MetricNameLabel: "foo", "env": "", "team": "a"},
+			err: newMissingRequiredLabelError([]cortexpb.LabelAdapter{
+				{Name: model.MetricNameLabel, Value: "foo"},
+				{Name: "env", Value: ""},
+				{Name: "team", Value: "a"},
+			}, "env"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateLabels(validateMetrics, cfg, userID, cortexpb.FromMetricsToLabelAdapters(c.metric), false)
+			assert.Equal(t, c.err, err)
+		})
+	}
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+			# TYPE cortex_discarded_samples_total counter
+			cortex_discarded_samples_total{reason="missing_required_label",user="testUser"} 2
+	`), "cortex_discarded_samples_total"))
+}
+
+func TestValidateLabels_DisabledValidationChecks(t *testing.T) {
+	userID := "testUser"
+
+	for name, c := range map[string]struct {
+		labels        []cortexpb.LabelAdapter
+		disabledCheck string
+		err           error
+	}{
+		"invalid metric name": {
+			labels:        []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo-bar"}},
+			disabledCheck: ValidationCheckMetricNameFormat,
+			err:           newInvalidMetricNameError("foo-bar"),
+		},
+		"invalid label name": {
+			labels:        []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}, {Name: "invalid-label", Value: "a"}},
+			disabledCheck: ValidationCheckLabelNameFormat,
+			err:           newInvalidLabelError([]cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}, {Name: "invalid-label", Value: "a"}}, "invalid-label"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := new(Limits)
+			cfg.MaxLabelValueLength = 25
+			cfg.MaxLabelNameLength = 25
+			cfg.MaxLabelNamesPerSeries = 5
+			cfg.EnforceMetricName = true
+			validateMetrics := NewValidateMetrics(prometheus.NewRegistry())
+
+			assert.Equal(t, c.err, ValidateLabels(validateMetrics, cfg, userID, c.labels, false))
+
+			// The other checks are still enforced once the check is disabled.
+			cfg.DisabledValidationChecks = []string{c.disabledCheck}
+			assert.Nil(t, ValidateLabels(validateMetrics, cfg, userID, c.labels, false))
+
+			cfg.MaxLabelNamesPerSeries = len(c.labels) - 1
+			assert.Equal(t, newTooManyLabelsError(c.labels, len(c.labels)-1), ValidateLabels(validateMetrics, cfg, userID, c.labels, false))
+		})
+	}
+}
+
+func TestValidateSample_DisabledValidationChecks(t *testing.T) {
+	cfg := new(Limits)
+	cfg.RejectOldSamples = true
+	cfg.RejectOldSamplesMaxAge = model.Duration(time.Hour)
+	cfg.CreationGracePeriod = model.Duration(time.Minute)
+	validateMetrics := NewValidateMetrics(prometheus.NewRegistry())
+
+	ls := []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}}
+	tooOld := cortexpb.Sample{TimestampMs: time.Now().Add(-2 * time.Hour).UnixMilli()}
+	tooNew := cortexpb.Sample{TimestampMs: time.Now().Add(time.Hour).UnixMilli()}
+
+	assert.Equal(t, newSampleTimestampTooOldError("foo", tooOld.TimestampMs), ValidateSample(validateMetrics, cfg, "testUser", ls, tooOld))
+	assert.Equal(t, newSampleTimestampTooNewError("foo", tooNew.TimestampMs), ValidateSample(validateMetrics, cfg, "testUser", ls, tooNew))
+
+	cfg.DisabledValidationChecks = []string{ValidationCheckSampleTimestamp}
+	assert.Nil(t, ValidateSample(validateMetrics, cfg, "testUser", ls, tooOld))
+	assert.Nil(t, ValidateSample(validateMetrics, cfg, "testUser", ls, tooNew))
+}
+
+func TestValidateNativeHistogram(t *testing.T) {
+	cfg := new(Limits)
+	cfg.RejectOldSamples = true
+	cfg.RejectOldSamplesMaxAge = model.Duration(time.Hour)
+	cfg.CreationGracePeriod = model.Duration(time.Minute)
+	cfg.MaxNativeHistogramBuckets = 3
+	reg := prometheus.NewRegistry()
+	validateMetrics := NewValidateMetrics(reg)
+
+	ls := []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}}
+	now := time.Now().UnixMilli()
+
+	valid := cortexpb.Histogram{TimestampMs: now, Schema: 3, PositiveDeltas: []int64{1, 2}, NegativeDeltas: []int64{1}}
+	assert.Nil(t, ValidateNativeHistogram(validateMetrics, cfg, "testUser", ls, valid))
+
+	tooOld := cortexpb.Histogram{TimestampMs: time.Now().Add(-2 * time.Hour).UnixMilli()}
+	assert.Equal(t, newSampleTimestampTooOldError("foo", tooOld.TimestampMs), ValidateNativeHistogram(validateMetrics, cfg, "testUser", ls, tooOld))
+
+	tooNew := cortexpb.Histogram{TimestampMs: time.Now().Add(time.Hour).UnixMilli()}
+	assert.Equal(t, newSampleTimestampTooNewError("foo", tooNew.TimestampMs), ValidateNativeHistogram(validateMetrics, cfg, "testUser", ls, tooNew))
+
+	invalidSchema := cortexpb.Histogram{TimestampMs: now, Schema: 9}
+	assert.EqualError(t, ValidateNativeHistogram(validateMetrics, cfg, "testUser", ls, invalidSchema),
+		fmt.Sprintf(`invalid native histogram schema 9, must be between -4 and 8, timestamp: %d metric: "foo"`, now))
+
+	tooManyBuckets := cortexpb.Histogram{TimestampMs: now, Count: &cortexpb.Histogram_CountFloat{CountFloat: 4}, PositiveCounts: []float64{1, 1}, NegativeCounts: []float64{1, 1}}
+	assert.EqualError(t, ValidateNativeHistogram(validateMetrics, cfg, "testUser", ls, tooManyBuckets),
+		fmt.Sprintf(`native histogram has too many buckets (buckets: 4, limit: 3), timestamp: %d metric: "foo"`, now))
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+			# TYPE cortex_discarded_samples_total counter
+			cortex_discarded_samples_total{reason="greater_than_max_sample_age",user="testUser"} 1
+			cortex_discarded_samples_total{reason="native_histogram_buckets_exceeded",user="testUser"} 1
+			cortex_discarded_samples_total{reason="native_histogram_invalid_schema",user="testUser"} 1
+			cortex_discarded_samples_total{reason="too_far_in_future",user="testUser"} 1
+		`), "cortex_discarded_samples_total"))
+}
+
 func TestValidateExemplars(t *testing.T) {
 	userID := "testUser"
 	reg := prometheus.NewRegistry()
 	validateMetrics := NewValidateMetrics(reg)
+	limits := &Limits{MaxExemplarLabelNames: 2, MaxExemplarLabelSetLength: ExemplarMaxLabelSetLength}
 	invalidExemplars := []cortexpb.Exemplar{
 		{
 			// Missing labels
@@ -143,21 +291,33 @@ func TestValidateExemplars(t *testing.T) {
 			Labels:      []cortexpb.LabelAdapter{{Name: "foo", Value: strings.Repeat("0", 126)}},
 			TimestampMs: 1000,
 		},
+		{
+			// Too many label names
+			Labels:      []cortexpb.LabelAdapter{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}},
+			TimestampMs: 1000,
+		},
 	}
 
 	for _, ie := range invalidExemplars {
-		err := ValidateExemplar(validateMetrics, userID, []cortexpb.LabelAdapter{}, ie)
+		err := ValidateExemplar(validateMetrics, limits, userID, []cortexpb.LabelAdapter{}, ie)
 		assert.NotNil(t, err)
 	}
 
+	// The combined labelset length limit can be lowered or disabled.
+	longExemplar := cortexpb.Exemplar{Labels: []cortexpb.LabelAdapter{{Name: "foo", Value: "barbaz"}}, TimestampMs: 1000}
+	assert.EqualError(t, ValidateExemplar(validateMetrics, &Limits{MaxExemplarLabelSetLength: 5}, userID, []cortexpb.LabelAdapter{}, longExemplar),
+		`exemplar combined labelset exceeds 5 characters, timestamp: 1000 series: {} labels: {foo="barbaz"}`)
+	assert.Nil(t, ValidateExemplar(validateMetrics, &Limits{}, userID, []cortexpb.LabelAdapter{}, longExemplar))
+
 	validateMetrics.DiscardedExemplars.WithLabelValues("random reason", "different user").Inc()
 
 	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
 			# HELP cortex_discarded_exemplars_total The total number of exemplars that were discarded.
 			# TYPE cortex_discarded_exemplars_total counter
 			cortex_discarded_exemplars_total{reason="exemplar_labels_missing",user="testUser"} 1
-			cortex_discarded_exemplars_total{reason="exemplar_labels_too_long",user="testUser"} 1
+			cortex_discarded_exemplars_total{reason="exemplar_labels_too_long",user="testUser"} 2
 			cortex_discarded_exemplars_total{reason="exemplar_timestamp_invalid",user="testUser"} 1
+			cortex_discarded_exemplars_total{reason="exemplar_too_many_label_names",user="testUser"} 1
 
 			cortex_discarded_exemplars_total{reason="random reason",user="different user"} 1
 		`), "cortex_discarded_exemplars_total"))
@@ -291,3 +451,18 @@ func TestValidateLabelDuplication(t *testing.T) {
 	}, "a")
 	assert.Equal(t, expected, actual)
 }
+
+func TestValidateLabels_ShouldCheckTheLabelsOrderWithAllTheChecksDisabled(t *testing.T) {
+	cfg := new(Limits)
+	cfg.MaxLabelValueLength = 25
+	cfg.MaxLabelNameLength = 25
+	cfg.MaxLabelNamesPerSeries = 5
+	cfg.DisabledValidationChecks = ValidationChecks
+	validateMetrics := NewValidateMetrics(prometheus.NewRegistry())
+
+	unsorted := []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}, {Name: "b", Value: "b"}, {Name: "a", Value: "a"}}
+	assert.Equal(t, newLabelsNotSortedError(unsorted, "a"), ValidateLabels(validateMetrics, cfg, "testUser", unsorted, false))
+
+	duplicated := []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}, {Name: "a", Value: "a"}, {Name: "a", Value: "a"}}
+	assert.Equal(t, newDuplicatedLabelError(duplicated, "a"), ValidateLabels(validateMetrics, cfg, "testUser", duplicated, false))
+}
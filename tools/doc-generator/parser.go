@@ -192,7 +192,8 @@ func parseConfig(block *configBlock, cfg interface{}, flags map[uintptr]*flag.Fl
 		fieldDefault := ""
 		if field.Type.Kind() == reflect.Slice {
 			sliceElementType := field.Type.Elem()
-			if sliceElementType.Kind() == reflect.Struct {
+			// The element blocks are generated only once, even if the element type is used by multiple fields.
+			if _, _, seen := isRootBlock(sliceElementType); !seen && sliceElementType.Kind() == reflect.Struct {
 				if field.Type.String() != "labels.Labels" {
 					rootBlocks = append(rootBlocks, rootBlock{
 						name:       field.Type.Elem().Name(),